@@ -31,7 +31,6 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
-	"slices"
 	"time"
 
 	"github.com/yeetrun/yeet/pkg/catch"
@@ -53,13 +52,65 @@ var (
 
 	// TODO: This should be randomly assigned at stored in the JSON DB.
 	registryInternalAddr = flag.String("registry-internal-addr", "127.0.0.1:0", "address for registry to listen on internally")
+
+	registryMaxBlobSize     = flag.Int64("registry-max-blob-size", 0, "maximum size in bytes of a blob pushed to the registry (0 for the default of 10GiB)")
+	registryMaxManifestSize = flag.Int64("registry-max-manifest-size", 0, "maximum size in bytes of a manifest pushed to the registry (0 for the default of 4MiB)")
+	registryUploadsPerMin   = flag.Int("registry-uploads-per-min", 0, "maximum registry write requests per caller per minute (0 for the default of 600, negative for no limit)")
+
+	shareFunnel = flag.Bool("share-funnel", false, "serve share links publicly through Tailscale Funnel on port 8443, if the tailnet allows it")
+	healthzAuth = flag.Bool("healthz-auth", false, "require /healthz callers to be authorized like API callers")
+
+	heartbeatInterval = flag.Duration("heartbeat-interval", 0, "how often heartbeat events are published while a client listens for them (0 for the default of 1s)")
+	monitorInterval   = flag.Duration("monitor-interval", 0, "longest time background loops like health checks sleep before looking for work (0 for the default of 1m)")
 )
 
+// shareFunnelPort is the Funnel port share links are served on. Funnel only
+// allows 443, 8443 and 10000, and 443 is taken by the tailnet-only web
+// listener.
+const shareFunnelPort = 8443
+
 var (
 	ipv4Loopback = netip.MustParseAddr("127.0.0.1")
 	ipv6Loopback = netip.MustParseAddr("::1")
 )
 
+// dialLoopback dials the loopback address of the same family as dst on
+// dst's port, falling back to the other family so that forwarding works on
+// hosts that only have one of the two loopback addresses configured.
+func dialLoopback(dst netip.AddrPort) (net.Conn, error) {
+	dialIPs := []netip.Addr{ipv4Loopback, ipv6Loopback}
+	if dst.Addr().Is6() {
+		dialIPs = []netip.Addr{ipv6Loopback, ipv4Loopback}
+	}
+	var d net.Dialer
+	var firstErr error
+	for _, ip := range dialIPs {
+		c, err := d.Dial("tcp", netip.AddrPortFrom(ip, dst.Port()).String())
+		if err == nil {
+			return c, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// listenInternal listens on addr, falling back to the IPv6 loopback if addr is
+// the default IPv4 loopback address and the host has no IPv4 loopback.
+func listenInternal(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err == nil {
+		return ln, nil
+	}
+	if host, port, _ := net.SplitHostPort(addr); host == ipv4Loopback.String() {
+		if ln, err6 := net.Listen("tcp", net.JoinHostPort(ipv6Loopback.String(), port)); err6 == nil {
+			return ln, nil
+		}
+	}
+	return nil, err
+}
+
 // initTSNet initializes and returns a tsnet.Server if tsnetHost is set.
 func initTSNet() *tsnet.Server {
 	if *tsnetHost == "" {
@@ -70,23 +121,17 @@ func initTSNet() *tsnet.Server {
 		Hostname: *tsnetHost,
 		Port:     uint16(*tsnetPort),
 	}
-	st := must.Get(ts.Up(context.Background()))
-	tsIPs := st.TailscaleIPs
+	must.Get(ts.Up(context.Background()))
 
 	ts.RegisterFallbackTCPHandler(func(src, dst netip.AddrPort) (handler func(net.Conn), intercept bool) {
-		var d net.Dialer
-		if !slices.Contains(tsIPs, dst.Addr()) {
+		// Look up the addresses on every connection rather than once at
+		// startup, the node may be IPv4-only, IPv6-only or dual-stack and
+		// gain or lose addresses over time.
+		ip4, ip6 := ts.TailscaleIPs()
+		if dst.Addr() != ip4 && dst.Addr() != ip6 {
 			return nil, false
 		}
-
-		var dialIP netip.Addr
-		if dst.Addr().Is4() {
-			dialIP = ipv4Loopback
-		} else {
-			dialIP = ipv6Loopback
-		}
-
-		bc, err := d.Dial("tcp", fmt.Sprintf("%s:%d", dialIP, dst.Port()))
+		bc, err := dialLoopback(dst)
 		if err != nil {
 			log.Printf("failed to dial %v: %v", dst, err)
 			return nil, false
@@ -161,6 +206,15 @@ func main() {
 		MountsRoot:           mountsDir,
 		InternalRegistryAddr: irAddr,
 		RegistryRoot:         registryDir,
+
+		RegistryMaxBlobSize:     *registryMaxBlobSize,
+		RegistryMaxManifestSize: *registryMaxManifestSize,
+		RegistryUploadsPerMin:   *registryUploadsPerMin,
+
+		HealthzAuth: *healthzAuth,
+
+		HeartbeatInterval: *heartbeatInterval,
+		MonitorInterval:   *monitorInterval,
 	}
 
 	if len(flag.Args()) == 1 {
@@ -175,6 +229,14 @@ func main() {
 				log.Fatal("failed to install: ", err)
 			}
 			setupDocker()
+			if err := selfCheck(scfg); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "selfcheck":
+			if err := selfCheck(scfg); err != nil {
+				log.Fatal(err)
+			}
 			return
 		}
 	}
@@ -185,6 +247,8 @@ func main() {
 		log.Fatal("failed to initialize tsnet")
 	}
 	scfg.LocalClient = must.Get(ts.LocalClient())
+	scfg.HTTPClient = ts.HTTPClient()
+	scfg.TailnetDial = ts.Dial
 
 	domains := ts.CertDomains()
 	if len(domains) == 0 {
@@ -204,9 +268,25 @@ func main() {
 
 	// Acquire the listeners.
 	sshln := must.Get(ts.Listen("tcp", ":22"))
-	internalRegLn := must.Get(net.Listen("tcp", *registryInternalAddr))
+	internalRegLn := must.Get(listenInternal(*registryInternalAddr))
 	scfg.InternalRegistryAddr = internalRegLn.Addr().String()
+	var shareLn net.Listener
+	if *shareFunnel {
+		ln, err := ts.ListenFunnel("tcp", fmt.Sprintf(":%d", shareFunnelPort), tsnet.FunnelOnly())
+		if err != nil {
+			log.Printf("share links are only available on the tailnet: failed to listen on Funnel: %v", err)
+		} else {
+			shareLn = ln
+			scfg.ShareAddr = fmt.Sprintf("%s:%d", domains[0], shareFunnelPort)
+		}
+	}
 	server := catch.NewServer(scfg)
+	if shareLn != nil {
+		go func() {
+			hs := &http.Server{Handler: server.ShareHandler()}
+			must.Do(hs.Serve(shareLn))
+		}()
+	}
 	go func() {
 		ln := must.Get(ts.Listen("tcp", ":80"))
 		hs := &http.Server{
@@ -277,6 +357,13 @@ func setupDocker() error {
 	return nil
 }
 
+// selfCheck checks that the host can run services and prints a report.
+func selfCheck(cfg *catch.Config) error {
+	fmt.Println("Running self-check...")
+	server := catch.NewUnstartedServer(cfg)
+	return catch.WriteSelfCheckReport(os.Stdout, server.SelfCheck(context.Background()))
+}
+
 // doInstall installs the catch binary as a service.
 func doInstall(cfg *catch.Config) error {
 	// Set up Tailscale
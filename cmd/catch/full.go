@@ -0,0 +1,23 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build full
+
+package main
+
+// The "full" build includes detectors that are too heavy for the default
+// build. Build with `go build -tags full ./cmd/catch` to enable them.
+import (
+	_ "github.com/yeetrun/yeet/pkg/ftdetect/tsdetect"
+)
@@ -0,0 +1,266 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/catch"
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// API fallback: some networks block outbound SSH but allow HTTPS over the
+// tailnet. When ssh can't reach the host, commands run over the run-command
+// websocket of the catch API and payloads are uploaded over HTTPS instead.
+//
+// Callers of sshCmd and sshTTYCmd expect an *exec.Cmd, so the websocket
+// session is run by re-executing yeet with apiExecEnv set, which makes main
+// run the command given as arguments over the API instead of parsing them.
+// The websocket has no way to mark the end of input, so commands fed from a
+// file or pipe fail rather than wait for input that never arrives.
+
+// apiExecEnv is set to <svc>@<host> when yeet is re-executed to run a command
+// over the API.
+const apiExecEnv = "YEET_API_EXEC"
+
+// apiTTYEnv is set to false when yeet is re-executed to run a command over
+// the API without a pty, as for sshCmd.
+const apiTTYEnv = "YEET_API_TTY"
+
+// sshProbeTimeout bounds how long to wait for the SSH port before falling back
+// to the API.
+const sshProbeTimeout = 5 * time.Second
+
+// sshReachable reports whether ssh can reach the host, as configured in the
+// user's ssh config. It is only probed once per run.
+var sshReachable = sync.OnceValue(func() bool {
+	host := loadedPrefs.Host
+	c := sshConfigFor(host)
+	if c.controlPath != "" && exec.Command("ssh", "-O", "check", host).Run() == nil {
+		// A shared connection is already up.
+		return true
+	}
+	if c.proxyJump != "" || c.proxyCommand != "" {
+		// There is no port to probe; leave it to ssh.
+		return true
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.hostname, c.port), sshProbeTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "SSH to %s is unreachable (%v), falling back to the HTTPS API\n", host, err)
+		return false
+	}
+	conn.Close()
+	return true
+})
+
+// apiCmd returns a command that runs args for the service over the
+// run-command websocket, with a pty if tty is set, like sshTTYCmd and sshCmd
+// do over SSH.
+func apiCmd(user string, tty bool, args ...string) *exec.Cmd {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	cmd := cmdutil.NewStdCmd(exe, args...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%s@%s", apiExecEnv, user, loadedPrefs.Host),
+		fmt.Sprintf("%s=%t", apiTTYEnv, tty),
+	)
+	return cmd
+}
+
+// apiHost returns the full tailnet name of the host, the only name the catch
+// API has a certificate for.
+func apiHost(ctx context.Context) (string, error) {
+	if strings.Contains(loadedPrefs.Host, ".") {
+		return loadedPrefs.Host, nil
+	}
+	fqdn, err := getDockerHost(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s on the tailnet: %w", loadedPrefs.Host, err)
+	}
+	return fqdn, nil
+}
+
+// runAPIExec runs the command args for the service and host in target, as
+// set in apiExecEnv, and returns the exit code.
+func runAPIExec(target string, args []string) int {
+	sn, host, _ := strings.Cut(target, "@")
+	loadedPrefs.Host = host
+	tty, err := strconv.ParseBool(cmp.Or(os.Getenv(apiTTYEnv), "true"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid %s: %v\n", apiTTYEnv, err)
+		return 1
+	}
+	err = apiExec(context.Background(), sn, tty, args)
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) && ce.Code == catch.CloseCommandFailed {
+		// catch already printed the error.
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// apiExec runs args for service sn over the run-command websocket, with a
+// pty of the size of the local terminal if tty is set. Input is only
+// forwarded from a terminal: the websocket has no way to mark the end of
+// input, so commands fed from files or pipes still need SSH.
+func apiExec(ctx context.Context, sn string, tty bool, args []string) error {
+	if len(args) == 0 {
+		return errors.New("interactive sessions are not supported over the API")
+	}
+	fd := int(os.Stdin.Fd())
+	isTerm := term.IsTerminal(fd)
+	if !isTerm && !isCharDevice(os.Stdin) {
+		return fmt.Errorf("%q reads its input from a file or pipe, which is not supported over the API; it needs SSH", strings.Join(args, " "))
+	}
+	fqdn, err := apiHost(ctx)
+	if err != nil {
+		return err
+	}
+	cols, rows := 80, 24
+	if isTerm {
+		if w, h, err := term.GetSize(fd); err == nil {
+			cols, rows = w, h
+		}
+	}
+	q := url.Values{
+		"service": {sn},
+		"command": {args[0]},
+		"args":    args[1:],
+		"tty":     {strconv.FormatBool(tty)},
+		"rows":    {strconv.Itoa(rows)},
+		"cols":    {strconv.Itoa(cols)},
+		"session": {clientSession},
+	}
+	u := "wss://" + fqdn + "/api/v0/run-command?" + q.Encode()
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u, nil)
+	if err != nil {
+		if resp != nil {
+			b, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("failed to connect to %s: %s: %s", fqdn, resp.Status, strings.TrimSpace(string(b)))
+		}
+		return fmt.Errorf("failed to connect to %s: %w", fqdn, err)
+	}
+	defer conn.Close()
+
+	var writeMu sync.Mutex
+	send := func(b []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteMessage(websocket.BinaryMessage, b)
+	}
+	if isTerm && tty {
+		old, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to make terminal raw: %w", err)
+		}
+		defer term.Restore(fd, old)
+
+		winch := make(chan os.Signal, 1)
+		notifyResize(winch)
+		defer signal.Stop(winch)
+		go func() {
+			for range winch {
+				if w, h, err := term.GetSize(fd); err == nil {
+					// The resize message run-command understands.
+					send(fmt.Appendf(nil, "\x01[8;%d;%dt", h, w))
+				}
+			}
+		}()
+	}
+	if isTerm {
+		go func() {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if n > 0 && send(buf[:n]) != nil {
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		_, b, err := conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		os.Stdout.Write(b)
+	}
+}
+
+// isCharDevice reports whether f is a character device such as /dev/null,
+// which there is no input to forward from.
+func isCharDevice(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// apiUpload uploads file to path of service sn over the catch API, like
+// `scp file svc@host:path`.
+func apiUpload(ctx context.Context, sn, file, path string) error {
+	fqdn, err := apiHost(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	u := fmt.Sprintf("https://%s/api/v0/services/%s/upload?%s", fqdn, url.PathEscape(sn), url.Values{"path": {path}}.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, f)
+	if err != nil {
+		return err
+	}
+	if st, err := f.Stat(); err == nil {
+		req.ContentLength = st.Size()
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", file, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to upload %s: %s: %s", file, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
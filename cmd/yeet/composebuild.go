@@ -0,0 +1,214 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeBuild is the build: section of a compose service, either the path
+// of the build context or a mapping.
+type composeBuild struct {
+	Context    string
+	Dockerfile string
+	Target     string
+	// Args are the build arguments as KEY=value.
+	Args []string
+}
+
+func (b *composeBuild) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		b.Context = n.Value
+		return nil
+	}
+	var m struct {
+		Context    string    `yaml:"context"`
+		Dockerfile string    `yaml:"dockerfile"`
+		Target     string    `yaml:"target"`
+		Args       yaml.Node `yaml:"args"`
+	}
+	if err := n.Decode(&m); err != nil {
+		return err
+	}
+	b.Context, b.Dockerfile, b.Target = m.Context, m.Dockerfile, m.Target
+	switch m.Args.Kind {
+	case yaml.MappingNode:
+		var args map[string]string
+		if err := m.Args.Decode(&args); err != nil {
+			return err
+		}
+		for _, k := range slices.Sorted(maps.Keys(args)) {
+			b.Args = append(b.Args, k+"="+args[k])
+		}
+	case yaml.SequenceNode:
+		return m.Args.Decode(&b.Args)
+	}
+	return nil
+}
+
+// quoteArg quotes s as a single word for the shell-like splitting catch does
+// on the command of an ssh session.
+func quoteArg(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// contextDockerfile is the name the Dockerfile of a service is sent as when
+// it is outside of its build context.
+const contextDockerfile = ".yeet.Dockerfile"
+
+// buildComposeImages builds the image of each service of the compose file at
+// file with a build: section on the catch host of service sn, by sending its
+// build context there. Installing the compose file then uses the built
+// images.
+func buildComposeImages(sn, file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var cf struct {
+		Services map[string]struct {
+			Build *composeBuild `yaml:"build"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		// Compose templates may not parse until they are rendered on the
+		// host, which reports any build: sections it can't honor.
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(cf.Services)) {
+		bc := cf.Services[name].Build
+		if bc == nil {
+			continue
+		}
+		if strings.Contains(bc.Context, "://") || strings.HasPrefix(bc.Context, "git@") {
+			return fmt.Errorf("service %q: remote build contexts are not supported", name)
+		}
+		dir := filepath.Join(filepath.Dir(file), cmp.Or(bc.Context, "."))
+		if st, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("service %q: %w", name, err)
+		} else if !st.IsDir() {
+			return fmt.Errorf("service %q: build context %s is not a directory", name, dir)
+		}
+
+		args := []string{"build", name}
+		var extra string // Dockerfile outside of the build context
+		if bc.Dockerfile != "" {
+			df := bc.Dockerfile
+			if !filepath.IsAbs(df) {
+				df = filepath.Join(dir, df)
+			}
+			if rel, err := filepath.Rel(dir, df); err == nil && filepath.IsLocal(rel) {
+				args = append(args, quoteArg("--dockerfile="+filepath.ToSlash(rel)))
+			} else {
+				extra = df
+				args = append(args, "--dockerfile="+contextDockerfile)
+			}
+		}
+		if bc.Target != "" {
+			args = append(args, quoteArg("--target="+bc.Target))
+		}
+		for _, a := range bc.Args {
+			// catch splits the command like a shell, so values with
+			// spaces or quotes must be quoted.
+			args = append(args, quoteArg("--build-arg="+a))
+		}
+
+		fmt.Fprintf(os.Stderr, "Building %s from %s on %s\n", name, dir, loadedPrefs.Host)
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(writeBuildContext(pw, dir, extra))
+		}()
+		c := sshCmd(sn, args...)
+		c.Stdin = pr
+		err := c.Run()
+		pr.Close()
+		if err != nil {
+			return fmt.Errorf("failed to build %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// writeBuildContext writes a tarball of the directories and regular files in
+// dir to w, skipping .git directories. If dockerfile is set, that file is
+// added as contextDockerfile.
+func writeBuildContext(w io.Writer, dir, dockerfile string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() && de.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if p == dir || !de.IsDir() && !de.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return addTarFile(tw, filepath.ToSlash(rel), p)
+	})
+	if err != nil {
+		return err
+	}
+	if dockerfile != "" {
+		if err := addTarFile(tw, contextDockerfile, dockerfile); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// addTarFile adds the file or directory at p to tw as name.
+func addTarFile(tw *tar.Writer, name, p string) error {
+	st, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	h, err := tar.FileInfoHeader(st, "")
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if st.IsDir() {
+		h.Name += "/"
+	}
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,288 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+)
+
+func cpCmd() *cobra.Command {
+	var recursive, quiet bool
+	cmd := &cobra.Command{
+		Use:   "cp <svc>:<path> <local> | <local> <svc>:<path>",
+		Short: "Copy files to or from a service's data directory",
+		Long: `Copy files between this machine and the data directory of a service over SFTP.
+Remote paths are relative to the data directory. Directories are copied with
+--recursive. If the destination is an existing directory, the source is copied
+into it.`,
+		Example:      "  yeet cp web:config.yml .\n  yeet cp -r ./seed web:seed",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCp(args[0], args[1], recursive, quiet)
+		},
+	}
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Copy directories recursively")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Don't report progress")
+	return cmd
+}
+
+// parseRemotePath parses a <svc>:<path> argument into the service and the
+// path in the SFTP /data namespace. Arguments that look like local paths,
+// e.g. ./a:b, are not remote.
+func parseRemotePath(arg string) (svc, p string, ok bool) {
+	svc, rel, ok := strings.Cut(arg, ":")
+	if !ok || svc == "" || strings.ContainsAny(svc, `/\.`) {
+		return "", "", false
+	}
+	return svc, path.Join("/data", path.Clean("/"+rel)), true
+}
+
+func runCp(src, dst string, recursive, quiet bool) error {
+	srcSvc, srcPath, srcRemote := parseRemotePath(src)
+	dstSvc, dstPath, dstRemote := parseRemotePath(dst)
+	switch {
+	case srcRemote && dstRemote:
+		return fmt.Errorf("copying between services is not supported, copy through this machine instead")
+	case !srcRemote && !dstRemote:
+		return fmt.Errorf("one of the paths must be remote, e.g. <svc>:<path>")
+	}
+	svc := srcSvc
+	if dstRemote {
+		svc = dstSvc
+	}
+	c, closeClient, err := dialSFTP(svc)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	cp := &copier{c: c, recursive: recursive, quiet: quiet}
+	if dstRemote {
+		return cp.upload(src, dstPath)
+	}
+	return cp.download(srcPath, dst)
+}
+
+// dialSFTP starts an SFTP session with catch as service svc over ssh. The
+// returned func closes it.
+func dialSFTP(svc string) (*sftp.Client, func() error, error) {
+	args := append(sshOpts(loadedPrefs.Host), "-q", "-s", fmt.Sprintf("%s@%s", svc, loadedPrefs.Host), "sftp")
+	cmd := exec.Command("ssh", args...)
+	cmd.Stderr = os.Stderr
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start ssh: %w", err)
+	}
+	c, err := sftp.NewClientPipe(r, w)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, nil, fmt.Errorf("failed to start sftp session: %w", err)
+	}
+	return c, func() error {
+		c.Close()
+		return cmd.Wait()
+	}, nil
+}
+
+// copier copies files between the local filesystem and an SFTP client.
+type copier struct {
+	c         *sftp.Client
+	recursive bool
+	quiet     bool
+}
+
+// upload copies the local file or directory src to remote path dst.
+func (cp *copier) upload(src, dst string) error {
+	st, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if rst, err := cp.c.Stat(dst); err == nil && rst.IsDir() {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+	if !st.IsDir() {
+		return cp.uploadFile(src, dst, st.Size())
+	}
+	if !cp.recursive {
+		return fmt.Errorf("%s is a directory, use --recursive to copy it", src)
+	}
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		rp := path.Join(dst, filepath.ToSlash(rel))
+		switch {
+		case d.IsDir():
+			if err := cp.c.Mkdir(rp); err != nil {
+				if st, serr := cp.c.Stat(rp); serr != nil || !st.IsDir() {
+					return fmt.Errorf("failed to create %s: %w", rp, err)
+				}
+			}
+			return nil
+		case !d.Type().IsRegular():
+			fmt.Fprintf(os.Stderr, "skipping %s: not a regular file\n", p)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return cp.uploadFile(p, rp, info.Size())
+	})
+}
+
+func (cp *copier) uploadFile(src, dst string, size int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rf, err := cp.c.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if err := cp.copy(rf, f, src, size); err != nil {
+		rf.Close()
+		return fmt.Errorf("failed to upload %s: %w", src, err)
+	}
+	return rf.Close()
+}
+
+// download copies the remote file or directory src to local path dst.
+func (cp *copier) download(src, dst string) error {
+	st, err := cp.c.Stat(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.TrimPrefix(src, "/data/"), err)
+	}
+	if lst, err := os.Stat(dst); err == nil && lst.IsDir() {
+		dst = filepath.Join(dst, path.Base(src))
+	}
+	if !st.IsDir() {
+		return cp.downloadFile(src, dst, st.Size())
+	}
+	if !cp.recursive {
+		return fmt.Errorf("%s is a directory, use --recursive to copy it", strings.TrimPrefix(src, "/data/"))
+	}
+	w := cp.c.Walk(src)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(w.Path(), src), "/")
+		lp := filepath.Join(dst, filepath.FromSlash(rel))
+		switch st := w.Stat(); {
+		case st.IsDir():
+			if err := os.MkdirAll(lp, 0755); err != nil {
+				return err
+			}
+		case st.Mode().IsRegular():
+			if err := cp.downloadFile(w.Path(), lp, st.Size()); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "skipping %s: not a regular file\n", w.Path())
+		}
+	}
+	return nil
+}
+
+func (cp *copier) downloadFile(src, dst string, size int64) error {
+	rf, err := cp.c.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer rf.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := cp.copy(f, rf, dst, size); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to download %s: %w", src, err)
+	}
+	return f.Close()
+}
+
+// copy copies size bytes from r to w, reporting the progress of name on
+// stderr unless quiet.
+func (cp *copier) copy(w io.Writer, r io.Reader, name string, size int64) error {
+	if cp.quiet {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	pw := &progressWriter{name: name, total: size, start: time.Now()}
+	_, err := io.Copy(io.MultiWriter(w, pw), r)
+	pw.report(true)
+	fmt.Fprintln(os.Stderr)
+	return err
+}
+
+// progressWriter counts the bytes written to it and reports them at most
+// every progressInterval.
+type progressWriter struct {
+	name  string
+	total int64
+	n     int64
+	start time.Time
+	last  time.Time
+}
+
+const progressInterval = 200 * time.Millisecond
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.n += int64(len(p))
+	pw.report(false)
+	return len(p), nil
+}
+
+func (pw *progressWriter) report(final bool) {
+	now := time.Now()
+	if !final && now.Sub(pw.last) < progressInterval {
+		return
+	}
+	pw.last = now
+	pct := 100
+	if pw.total > 0 {
+		pct = int(pw.n * 100 / pw.total)
+	}
+	var rate uint64
+	if d := now.Sub(pw.start).Seconds(); d > 0 {
+		rate = uint64(float64(pw.n) / d)
+	}
+	fmt.Fprintf(os.Stderr, "\r%s  %s/%s  %d%%  %s/s\033[K", pw.name, formatBytes(uint64(pw.n)), formatBytes(uint64(pw.total)), pct, formatBytes(rate))
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var devFlags struct {
+	watch    []string
+	build    string
+	debounce time.Duration
+	interval time.Duration
+}
+
+func devCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dev <svc> <file|image> [args...]",
+		Short: "Watch local files and redeploy a dev service on every change",
+		Long: `Watch local files and redeploy a dev service on every change.
+
+The payload is deployed once on start and again whenever any of the watched
+paths change, after running the optional build command. The service logs are
+streamed continuously in between deploys.`,
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true,
+		RunE:         runDev,
+	}
+	cmd.Flags().StringSliceVarP(&devFlags.watch, "watch", "w", nil, "Paths to watch for changes; defaults to the payload file")
+	cmd.Flags().StringVarP(&devFlags.build, "build", "b", "", "Command to run (with sh -c) before each deploy")
+	cmd.Flags().DurationVar(&devFlags.debounce, "debounce", 500*time.Millisecond, "How long files must be unchanged before redeploying")
+	cmd.Flags().DurationVar(&devFlags.interval, "interval", 300*time.Millisecond, "How often to poll the watched paths")
+	return cmd
+}
+
+func runDev(cmd *cobra.Command, args []string) error {
+	svc, payload, runArgs := args[0], args[1], args[2:]
+	if err := rootCmd.PersistentFlags().Set("service", svc); err != nil {
+		return err
+	}
+	watch := devFlags.watch
+	if len(watch) == 0 {
+		watch = []string{payload}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	deploy := func() {
+		if devFlags.build != "" {
+			fmt.Fprintf(os.Stderr, "dev: running %q\n", devFlags.build)
+			c := exec.CommandContext(ctx, "sh", "-c", devFlags.build)
+			c.Stdout = os.Stdout
+			c.Stderr = os.Stderr
+			if err := c.Run(); err != nil {
+				fmt.Fprintf(os.Stderr, "dev: build failed: %v\n", err)
+				return
+			}
+		}
+		fmt.Fprintf(os.Stderr, "dev: deploying %s to %s\n", payload, svc)
+		if err := runRun(payload, runArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "dev: deploy failed: %v\n", err)
+		}
+	}
+
+	deploy()
+	go streamDevLogs(ctx, svc)
+
+	last := snapshotPaths(watch)
+	var changedAt time.Time
+	t := time.NewTicker(devFlags.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		cur := snapshotPaths(watch)
+		if cur != last {
+			// Still changing; wait for it to settle.
+			last = cur
+			changedAt = time.Now()
+			continue
+		}
+		if !changedAt.IsZero() && time.Since(changedAt) >= devFlags.debounce {
+			changedAt = time.Time{}
+			deploy()
+			// The build may have touched watched files; don't treat
+			// that as a new change.
+			last = snapshotPaths(watch)
+		}
+	}
+}
+
+// streamDevLogs follows the logs of svc until ctx is done, reconnecting
+// whenever the stream ends (e.g. because the service was redeployed). While
+// connecting fails, it backs off up to devLogsMaxBackoff between attempts.
+func streamDevLogs(ctx context.Context, svc string) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		c := withContext(ctx, sshCmd(svc, "logs", "--follow", "--lines=10"))
+		c.Stdin = nil
+		start := time.Now()
+		if err := c.Start(); err != nil {
+			fmt.Fprintf(os.Stderr, "dev: failed to follow logs: %v\n", err)
+		} else {
+			c.Wait()
+		}
+		if time.Since(start) > devLogsMaxBackoff {
+			// The stream was up; reconnect quickly.
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, devLogsMaxBackoff)
+	}
+}
+
+// devLogsMaxBackoff is the longest streamDevLogs waits before reconnecting.
+const devLogsMaxBackoff = 30 * time.Second
+
+// withContext returns a command like c that is killed when ctx is done.
+func withContext(ctx context.Context, c *exec.Cmd) *exec.Cmd {
+	cc := exec.CommandContext(ctx, c.Path, c.Args[1:]...)
+	cc.Env = c.Env
+	cc.Dir = c.Dir
+	cc.Stdin = c.Stdin
+	cc.Stdout = c.Stdout
+	cc.Stderr = c.Stderr
+	return cc
+}
+
+// snapshotPaths returns a string that changes whenever any regular file under
+// paths is added, removed or modified. Hidden directories such as .git are
+// skipped.
+func snapshotPaths(paths []string) string {
+	var sb strings.Builder
+	for _, root := range paths {
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if p != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(&sb, "%s:%d:%d\n", p, fi.Size(), fi.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return sb.String()
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+// envSealCmd returns the `env seal` command. It runs on the client so that
+// values never leave it unencrypted; only the public key of the host is
+// fetched.
+func envSealCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "seal KEY=value [KEY=value...]",
+		Short: "Encrypt env values so that only the catch host can read them",
+		Long: `Encrypt env values with the public key of the catch host and print them as
+env file lines. The sealed lines can be committed with the rest of the env file;
+catch decrypts them when it installs the env file for the service.
+
+A KEY without "=value" reads the value from stdin, which keeps it out of the
+shell history.`,
+		Example:      "  yeet env seal DATABASE_URL=postgres://... >> prod.env",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pub, err := fetchEnvPubKey(loadedPrefs.Host)
+			if err != nil {
+				return fmt.Errorf("failed to get public key of %s: %w", loadedPrefs.Host, err)
+			}
+			stdin := bufio.NewReader(os.Stdin)
+			for _, arg := range args {
+				k, v, ok := strings.Cut(arg, "=")
+				if k == "" {
+					return fmt.Errorf("invalid argument %q, use KEY=value", arg)
+				}
+				if !ok {
+					fmt.Fprintf(os.Stderr, "Value for %s: ", k)
+					line, err := stdin.ReadString('\n')
+					fmt.Fprintln(os.Stderr)
+					if err != nil && line == "" {
+						return fmt.Errorf("failed to read value of %s: %w", k, err)
+					}
+					v = strings.TrimRight(line, "\r\n")
+				}
+				sealed, err := secrets.SealTo(pub, []byte(v))
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s=%s\n", k, sealed)
+			}
+			return nil
+		},
+	}
+}
+
+// fetchEnvPubKey returns the public key env values are sealed to on host.
+func fetchEnvPubKey(host string) (string, error) {
+	c := exec.Command("ssh", append(sshOpts(host), "-q", fmt.Sprintf("sys@%s", host), "env", "pubkey")...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/spf13/cobra"
+)
+
+var historyFile = filepath.Join(filepath.Dir(prefsFile), "history.json")
+
+// historyMax is the number of commands kept in the history.
+const historyMax = 100
+
+// historyCmds are the commands recorded in the history: those that deploy.
+var historyCmds = []string{"run", "stage", "push", "cron"}
+
+// historyEntry is a deploy command as it was run.
+type historyEntry struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Service string    `json:"service"`
+	// Dir is the working directory, which relative paths in Args are
+	// resolved against.
+	Dir  string   `json:"dir"`
+	Args []string `json:"args"`
+}
+
+func loadHistory() ([]historyEntry, error) {
+	b, err := os.ReadFile(historyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var h []historyEntry
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("failed to parse history: %w", err)
+	}
+	return h, nil
+}
+
+// recordHistory appends args to the history if they are a deploy command.
+// Failures are only logged, the command already ran.
+func recordHistory(args []string) {
+	if len(args) == 0 || !slices.Contains(historyCmds, args[0]) {
+		return
+	}
+	h, err := loadHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to load history: %v\n", err)
+		return
+	}
+	dir, _ := os.Getwd()
+	h = append(h, historyEntry{
+		Time:    time.Now(),
+		Host:    loadedPrefs.Host,
+		Service: getService(),
+		Dir:     dir,
+		Args:    args,
+	})
+	if len(h) > historyMax {
+		h = h[len(h)-historyMax:]
+	}
+	j, err := json.MarshalIndent(h, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(historyFile), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(historyFile, j, 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to save history: %v\n", err)
+	}
+}
+
+func historyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history",
+		Short: "Show the deploy commands run from this machine",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			h, err := loadHistory()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+			defer w.Flush()
+			fmt.Fprintln(w, "#\tTIME\tHOST\tSERVICE\tCOMMAND\t")
+			for i, e := range slices.Backward(h) {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\tyeet %s\t\n", len(h)-i, e.Time.Format(time.DateTime), e.Host, e.Service, strings.Join(e.Args, " "))
+			}
+			return nil
+		},
+	}
+}
+
+func redoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "redo [n]",
+		Short: "Run the n-th most recent deploy command again (default 1)",
+		Long: `Run a deploy command from the history again, against the same host and
+from the same working directory, so relative paths resolve as they did.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n := 1
+			if len(args) == 1 {
+				var err error
+				if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+					return fmt.Errorf("invalid history number %q", args[0])
+				}
+			}
+			h, err := loadHistory()
+			if err != nil {
+				return err
+			}
+			if n > len(h) {
+				return fmt.Errorf("history has only %d commands", len(h))
+			}
+			e := h[len(h)-n]
+			self, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Running: yeet %s (host %s, in %s)\n", strings.Join(e.Args, " "), e.Host, e.Dir)
+			c := cmdutil.NewStdCmd(self, e.Args...)
+			c.Dir = e.Dir
+			c.Env = append(os.Environ(), "CATCH_HOST="+e.Host)
+			if err := c.Run(); err != nil {
+				var ee *exec.ExitError
+				if errors.As(err, &ee) {
+					os.Exit(ee.ExitCode())
+				}
+				return err
+			}
+			return nil
+		},
+	}
+}
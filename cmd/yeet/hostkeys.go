@@ -0,0 +1,360 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tailscale/golang-x-crypto/ssh"
+	"tailscale.com/util/mak"
+	"github.com/spf13/cobra"
+)
+
+// The host keys of catch hosts are pinned on first use in their own
+// known_hosts file next to the prefs. A host already in ~/.ssh/known_hosts
+// is pinned with the key found there rather than trusted anew. Every ssh and
+// scp invocation to catch is made with sshOpts, so ssh records the key of a
+// host it has not seen and refuses to connect if it changed. When that
+// happens, explainHostKeyError turns ssh's failure into a clear error
+// pointing at `yeet hosts forget`.
+
+var knownHostsFile = filepath.Join(filepath.Dir(prefsFile), "known_hosts")
+
+// hostKeyTimeout bounds how long fetching a host key for an error message
+// may take.
+const hostKeyTimeout = 5 * time.Second
+
+// sshOpts returns the ssh options that pin the host key of catch host host.
+func sshOpts(host string) []string {
+	if err := os.MkdirAll(filepath.Dir(knownHostsFile), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", filepath.Dir(knownHostsFile), err)
+	}
+	cfg := sshConfigFor(host)
+	if err := seedHostKeys(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to pin the host key of %s from ~/.ssh/known_hosts: %v\n", host, err)
+	}
+	opts := []string{
+		"-o", "SetEnv=YEET_SESSION=" + clientSession,
+		"-o", "UserKnownHostsFile=" + knownHostsFile,
+		"-o", "GlobalKnownHostsFile=/dev/null",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "HashKnownHosts=no",
+	}
+	if cfg.hostKeyAlias == "" {
+		// Key the pin on the catch host name, whatever it resolves to.
+		opts = append(opts, "-o", "HostKeyAlias="+host)
+	}
+	return opts
+}
+
+// sshHostConfig is the ssh configuration of a catch host, as resolved by
+// `ssh -G` from the user's ssh config.
+type sshHostConfig struct {
+	// host is the catch host name.
+	host string
+	// hostname and port are where ssh connects to.
+	hostname string
+	port     string
+	// hostKeyAlias is the HostKeyAlias set in the user's ssh config, if
+	// any.
+	hostKeyAlias string
+	// proxyJump and proxyCommand are set if ssh doesn't connect to
+	// hostname:port directly.
+	proxyJump    string
+	proxyCommand string
+	// controlPath is the socket of the ssh connection to share, if any.
+	controlPath string
+}
+
+// keyName returns the name the host key of the host is pinned under: the
+// user's HostKeyAlias if set, or the catch host name.
+func (c sshHostConfig) keyName() string {
+	return cmp.Or(c.hostKeyAlias, c.host)
+}
+
+var sshConfigs struct {
+	sync.Mutex
+	m map[string]sshHostConfig
+}
+
+// sshConfigFor returns the ssh configuration of host. If `ssh -G` fails,
+// it assumes host on port 22 without a HostKeyAlias or proxy.
+func sshConfigFor(host string) sshHostConfig {
+	sshConfigs.Lock()
+	defer sshConfigs.Unlock()
+	if c, ok := sshConfigs.m[host]; ok {
+		return c
+	}
+	c := sshHostConfig{host: host, hostname: host, port: "22"}
+	if out, err := exec.Command("ssh", "-G", host).Output(); err == nil {
+		for line := range strings.Lines(string(out)) {
+			k, v, _ := strings.Cut(strings.TrimSpace(line), " ")
+			switch k {
+			case "hostname":
+				c.hostname = v
+			case "port":
+				c.port = v
+			case "hostkeyalias":
+				c.hostKeyAlias = v
+			case "proxyjump":
+				c.proxyJump = noneToEmpty(v)
+			case "proxycommand":
+				c.proxyCommand = noneToEmpty(v)
+			case "controlpath":
+				c.controlPath = noneToEmpty(v)
+			}
+		}
+	}
+	mak.Set(&sshConfigs.m, host, c)
+	return c
+}
+
+// noneToEmpty returns v, or "" if v is "none", which `ssh -G` prints for
+// options that are explicitly unset.
+func noneToEmpty(v string) string {
+	if v == "none" {
+		return ""
+	}
+	return v
+}
+
+// seedHostKeys pins the keys ~/.ssh/known_hosts has for the host of c, if
+// none are pinned yet, so that a host the user already trusts isn't trusted
+// anew on first use.
+func seedHostKeys(c sshHostConfig) error {
+	if pinned, err := pinnedHostKeys(c.keyName()); err != nil || len(pinned) > 0 {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	userKnownHosts := filepath.Join(home, ".ssh", "known_hosts")
+	if _, err := os.Stat(userKnownHosts); err != nil {
+		return nil
+	}
+	// The name ssh looks the host up by in known_hosts.
+	lookup := c.hostKeyAlias
+	if lookup == "" {
+		lookup = c.hostname
+		if c.port != "22" {
+			lookup = fmt.Sprintf("[%s]:%s", c.hostname, c.port)
+		}
+	}
+	// ssh-keygen also finds hashed entries, and exits with 1 if there are
+	// none.
+	out, _ := exec.Command("ssh-keygen", "-F", lookup, "-f", userKnownHosts).Output()
+	var pins bytes.Buffer
+	for line := range strings.Lines(string(out)) {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			// Comments and @cert-authority or @revoked entries.
+			continue
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fields[1] + " " + fields[2])); err != nil {
+			continue
+		}
+		fmt.Fprintf(&pins, "%s %s %s\n", c.keyName(), fields[1], fields[2])
+	}
+	if pins.Len() == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(knownHostsFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(pins.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pinnedHostKeys returns the host keys pinned for host.
+func pinnedHostKeys(host string) ([]ssh.PublicKey, error) {
+	b, err := os.ReadFile(knownHostsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for line := range strings.Lines(string(b)) {
+		h, key, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok || h != host {
+			continue
+		}
+		pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key for %s in %s: %w", host, knownHostsFile, err)
+		}
+		keys = append(keys, pk)
+	}
+	return keys, nil
+}
+
+// forgetHostKeys removes the host keys pinned for host. It reports whether
+// there were any.
+func forgetHostKeys(host string) (bool, error) {
+	b, err := os.ReadFile(knownHostsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	var out bytes.Buffer
+	found := false
+	for line := range strings.Lines(string(b)) {
+		if h, _, _ := strings.Cut(strings.TrimSpace(line), " "); h == host {
+			found = true
+			continue
+		}
+		out.WriteString(line)
+	}
+	if !found {
+		return false, nil
+	}
+	return true, os.WriteFile(knownHostsFile, out.Bytes(), 0600)
+}
+
+// errGotHostKey aborts the handshake of fetchHostKey once the key is known.
+var errGotHostKey = errors.New("got host key")
+
+// fetchHostKey returns the host key the SSH server of the host of c presents.
+func fetchHostKey(c sshHostConfig) (ssh.PublicKey, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.hostname, c.port), hostKeyTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(hostKeyTimeout))
+	var key ssh.PublicKey
+	_, _, _, err = ssh.NewClientConn(conn, c.hostname, &ssh.ClientConfig{
+		User: "sys",
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errGotHostKey
+		},
+	})
+	if key == nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// explainHostKeyError returns a clear error if err is ssh failing to connect
+// to host because its key no longer matches the pinned one, or err.
+func explainHostKeyError(host string, err error) error {
+	var ee *exec.ExitError
+	// ssh exits with 255 when it fails to connect.
+	if !errors.As(err, &ee) || ee.ExitCode() != 255 {
+		return err
+	}
+	c := sshConfigFor(host)
+	pinned, perr := pinnedHostKeys(c.keyName())
+	if perr != nil || len(pinned) == 0 {
+		return err
+	}
+	key, kerr := fetchHostKey(c)
+	if kerr != nil {
+		return err
+	}
+	for _, pk := range pinned {
+		if bytes.Equal(pk.Marshal(), key.Marshal()) {
+			return err
+		}
+	}
+	return fmt.Errorf("the host key of %s changed: pinned %s, got %s\n"+
+		"If catch was reinstalled on %s, run `yeet hosts forget %s` to pin the new key; otherwise someone may be impersonating it",
+		host, ssh.FingerprintSHA256(pinned[0]), ssh.FingerprintSHA256(key), host, host)
+}
+
+func hostsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "Manage the pinned host keys of catch hosts",
+		Long: `Manage the pinned host keys of catch hosts.
+
+The host key of a catch host is pinned the first time yeet connects to it,
+and yeet refuses to connect if it changes afterwards. The keys are kept in
+~/.yeet/known_hosts, apart from ~/.ssh/known_hosts; a host already in
+~/.ssh/known_hosts is pinned with the key found there.`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List the pinned host keys",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			f, err := os.Open(knownHostsFile)
+			if err != nil {
+				if os.IsNotExist(err) {
+					fmt.Println("No pinned host keys")
+					return nil
+				}
+				return err
+			}
+			defer f.Close()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			defer w.Flush()
+			fmt.Fprintln(w, "HOST\tTYPE\tFINGERPRINT\t")
+			sc := bufio.NewScanner(f)
+			for sc.Scan() {
+				host, key, ok := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+				if !ok {
+					continue
+				}
+				pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t\n", host, pk.Type(), ssh.FingerprintSHA256(pk))
+			}
+			return sc.Err()
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:          "forget <host>",
+		Short:        "Forget the pinned host key of a host, to pin its new key on the next connection",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			found, err := forgetHostKeys(sshConfigFor(args[0]).keyName())
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("no host key pinned for %s", args[0])
+			}
+			fmt.Printf("Forgot the host key of %s\n", args[0])
+			return nil
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/catch"
+	"github.com/spf13/cobra"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn/ipnstate"
+)
+
+var listHostsFlags struct {
+	tags []string
+	json bool
+}
+
+// hostInventory is one row of `yeet list-hosts`.
+type hostInventory struct {
+	Host string   `json:"host"`
+	Tags []string `json:"tags"`
+	catch.ServerInfo
+	Error string `json:"error,omitempty"`
+}
+
+// hostInfoTimeout bounds how long list-hosts waits for a single host.
+const hostInfoTimeout = 10 * time.Second
+
+// taggedPeers returns the peers of the tailnet that have any of tags.
+func taggedPeers(ctx context.Context, tags []string) ([]*ipnstate.PeerStatus, error) {
+	var lc tailscale.LocalClient
+	st, err := lc.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, selfDomain, _ := strings.Cut(st.Self.DNSName, ".")
+	var peers []*ipnstate.PeerStatus
+	for _, peer := range st.Peer {
+		if peer.Tags == nil || !overlaps(peer.Tags.AsSlice(), tags) {
+			continue
+		}
+		if _, domain, _ := strings.Cut(peer.DNSName, "."); domain != selfDomain {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+func runListHosts(cmd *cobra.Command, _ []string) error {
+	peers, err := taggedPeers(cmd.Context(), listHostsFlags.tags)
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		hosts []hostInventory
+	)
+	for _, peer := range peers {
+		host, _, _ := strings.Cut(peer.DNSName, ".")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hi := hostInventory{Host: host, Tags: peer.Tags.AsSlice()}
+			info, err := fetchHostInfo(cmd.Context(), strings.TrimSuffix(peer.DNSName, "."))
+			if err != nil {
+				hi.Error = err.Error()
+			} else {
+				hi.ServerInfo = info
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			hosts = append(hosts, hi)
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(hosts, func(a, b hostInventory) int {
+		return strings.Compare(a.Host, b.Host)
+	})
+
+	if listHostsFlags.json {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(hosts)
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "HOST\tVERSION\tPLATFORM\tDOCKER\tSERVICES\tDISK FREE\tTAGS\t")
+	for _, h := range hosts {
+		tags := strings.Join(h.Tags, ",")
+		if h.Error != "" {
+			fmt.Fprintf(w, "%s\tunknown\t-\t-\t-\t-\t%s\t\n", h.Host, tags)
+			continue
+		}
+		var n int
+		for _, c := range h.Services {
+			n += c
+		}
+		docker := "no"
+		if h.Docker {
+			docker = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s\t%d\t%s\t%s\t\n", h.Host, h.Version, h.GOOS, h.GOARCH, docker, n, formatBytes(h.DiskFree), tags)
+	}
+	return nil
+}
+
+// fetchHostInfo queries the catch API of host for its info.
+func fetchHostInfo(ctx context.Context, host string) (catch.ServerInfo, error) {
+	var info catch.ServerInfo
+	ctx, cancel := context.WithTimeout(ctx, hostInfoTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+host+"/api/v0/info", nil)
+	if err != nil {
+		return info, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return info, fmt.Errorf("failed to get info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("failed to get info: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return info, fmt.Errorf("failed to decode info: %w", err)
+	}
+	return info, nil
+}
+
+// formatBytes formats n as a human-readable size.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
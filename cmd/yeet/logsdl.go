@@ -0,0 +1,180 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// logsDownloadRetries is how many times an interrupted download is resumed
+// before giving up.
+const logsDownloadRetries = 5
+
+// logsDownloadState is saved next to a partial download so that running the
+// same command again resumes it.
+type logsDownloadState struct {
+	Service string
+	Host    string
+	// Flags are the --since, --until and --grep flags as given.
+	Flags []string
+	// Since and Until are the resolved time range, fixed on the first
+	// attempt so that the export on the host stays the same.
+	Since string
+	Until string
+}
+
+// runLogsDownload downloads the logs selected by the flags of the logs
+// command cmd to the gzip file named by --download, resuming a previous
+// partial download of the same logs.
+func runLogsDownload(cmd *cobra.Command) error {
+	out, _ := cmd.Flags().GetString("download")
+	if out == "" || out == "-" {
+		return fmt.Errorf("--download needs a file name, e.g. --download=web.log.gz")
+	}
+	since, _ := cmd.Flags().GetString("since")
+	until, _ := cmd.Flags().GetString("until")
+	grep, _ := cmd.Flags().GetString("grep")
+	rate, _ := cmd.Flags().GetString("rate-limit")
+
+	part, statePath := out+".part", out+".part.json"
+	st := logsDownloadState{
+		Service: getService(),
+		Host:    loadedPrefs.Host,
+		Flags:   []string{since, until, grep},
+	}
+	var prev logsDownloadState
+	if b, err := os.ReadFile(statePath); err == nil && json.Unmarshal(b, &prev) == nil &&
+		prev.Service == st.Service && prev.Host == st.Host && slices.Equal(prev.Flags, st.Flags) {
+		st = prev
+		fmt.Fprintf(os.Stderr, "Resuming download of %s\n", out)
+	} else {
+		os.Remove(part)
+		now := time.Now()
+		st.Since = resolveLogTime(since, now)
+		st.Until = cmp.Or(resolveLogTime(until, now), now.UTC().Format(time.RFC3339))
+		b, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(statePath, b, 0644); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for attempt := 0; ; attempt++ {
+		offset, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		args := []string{"logs", "--download=-", "--until=" + st.Until, "--offset=" + strconv.FormatInt(offset, 10), "--rate-limit=" + rate}
+		if st.Since != "" {
+			args = append(args, "--since="+st.Since)
+		}
+		if grep != "" {
+			args = append(args, "--grep="+grep)
+		}
+		total, err := fetchLogExport(st.Service, args, f, offset)
+		if err != nil && total < 0 {
+			// The host refused the download; retrying won't help.
+			return err
+		}
+		size, serr := f.Seek(0, io.SeekEnd)
+		if serr != nil {
+			return serr
+		}
+		if size == total {
+			break
+		}
+		if attempt == logsDownloadRetries {
+			return fmt.Errorf("download interrupted at %d of %d bytes, run the command again to resume: %v", size, total, err)
+		}
+		fmt.Fprintf(os.Stderr, "Download interrupted (%v), resuming from %d bytes\n", err, size)
+		time.Sleep(time.Duration(attempt+1) * 2 * time.Second)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(part, out); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	fmt.Fprintf(os.Stderr, "Saved logs to %s\n", out)
+	return nil
+}
+
+// fetchLogExport runs `logs` with args on the host as service svc and
+// appends the export it streams to w, which already holds offset bytes of
+// it. It returns the total size of the export, or -1 if the host sent none.
+func fetchLogExport(svc string, args []string, w io.Writer, offset int64) (int64, error) {
+	c := exec.Command("ssh", append(append(sshOpts(loadedPrefs.Host), "-q", fmt.Sprintf("%s@%s", svc, loadedPrefs.Host)), args...)...)
+	c.Stderr = os.Stderr
+	r, err := c.StdoutPipe()
+	if err != nil {
+		return -1, err
+	}
+	if err := c.Start(); err != nil {
+		return -1, fmt.Errorf("failed to start ssh: %w", err)
+	}
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	size, ok := strings.CutPrefix(strings.TrimSpace(header), "yeet-log-export ")
+	if err != nil || !ok {
+		// Anything else is an error message from the host.
+		io.Copy(os.Stderr, strings.NewReader(header))
+		io.Copy(os.Stderr, br)
+		if werr := c.Wait(); werr != nil {
+			return -1, werr
+		}
+		return -1, fmt.Errorf("unexpected response from host")
+	}
+	total, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		c.Process.Kill()
+		c.Wait()
+		return -1, fmt.Errorf("invalid export size %q", size)
+	}
+	cp := &copier{}
+	err = cp.copy(w, io.LimitReader(br, total-offset), "logs", total-offset)
+	if werr := c.Wait(); err == nil {
+		err = werr
+	}
+	return total, err
+}
+
+// resolveLogTime turns a --since or --until duration like "2h" into a fixed
+// timestamp relative to now. Timestamps are passed to the host as is.
+func resolveLogTime(v string, now time.Time) string {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d).UTC().Format(time.RFC3339)
+	}
+	return v
+}
@@ -0,0 +1,206 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// targetHosts returns the catch hosts args should run against: the value of
+// a --host (or --hosts) flag in args or, failing that, the preferred host.
+// Several hosts are given as a comma separated list, e.g. --host=h1,h2, and
+// @name stands for every tailnet peer tagged tag:name, e.g. --hosts=@prod.
+func targetHosts(ctx context.Context, args []string) ([]string, error) {
+	host := loadedPrefs.Host
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		name, v, ok := strings.Cut(a, "=")
+		if name != "--host" && name != "--hosts" {
+			continue
+		}
+		if ok {
+			host = v
+		} else if i+1 < len(args) {
+			host = args[i+1]
+		}
+	}
+	var hosts []string
+	for _, h := range strings.Split(host, ",") {
+		h = strings.TrimSpace(h)
+		tag, ok := strings.CutPrefix(h, "@")
+		if !ok {
+			if h != "" && !slices.Contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+			continue
+		}
+		peers, err := taggedPeers(ctx, []string{"tag:" + tag})
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", h, err)
+		}
+		if len(peers) == 0 {
+			return nil, fmt.Errorf("no hosts tagged tag:%s", tag)
+		}
+		var tagged []string
+		for _, p := range peers {
+			name, _, _ := strings.Cut(p.DNSName, ".")
+			if !slices.Contains(hosts, name) {
+				tagged = append(tagged, name)
+			}
+		}
+		slices.Sort(tagged)
+		hosts = append(hosts, tagged...)
+	}
+	return hosts, nil
+}
+
+// hostGroupFlag reports whether args name their hosts with --hosts or a
+// @name tag, which run through fanOut even when they resolve to one host.
+func hostGroupFlag(args []string) bool {
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		name, v, ok := strings.Cut(a, "=")
+		if !ok && i+1 < len(args) {
+			v = args[i+1]
+		}
+		if name == "--hosts" || name == "--host" && strings.Contains(v, "@") {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutHostFlag returns args with any --host or --hosts flag removed.
+func withoutHostFlag(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(out, args[i:]...)
+		}
+		if strings.HasPrefix(a, "--host=") || strings.HasPrefix(a, "--hosts=") {
+			continue
+		}
+		if a == "--host" || a == "--hosts" {
+			i++ // Skip the value.
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// fanOut runs yeet with args against each of hosts in parallel, one process
+// per host, and returns the exit code for the whole run: 0 if it succeeded on
+// every host and 1 otherwise. Each line of output is prefixed with its host,
+// and a per-host summary is printed at the end. Stdin is not forwarded, so
+// commands that ask for confirmation fail.
+func fanOut(hosts, args []string) int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to find yeet binary: %v\n", err)
+		return 1
+	}
+	width := 0
+	for _, h := range hosts {
+		width = max(width, len(h))
+	}
+
+	var (
+		mu   sync.Mutex // serializes writes to stdout and stderr
+		wg   sync.WaitGroup
+		errs = make([]error, len(hosts))
+	)
+	for i, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prefix := fmt.Sprintf("%-*s | ", width, h)
+			stdout := &prefixWriter{mu: &mu, w: os.Stdout, prefix: prefix}
+			stderr := &prefixWriter{mu: &mu, w: os.Stderr, prefix: prefix}
+			c := exec.Command(exe, args...)
+			c.Env = append(os.Environ(), "CATCH_HOST="+h)
+			c.Stdout = stdout
+			c.Stderr = stderr
+			errs[i] = c.Run()
+			stdout.Flush()
+			stderr.Flush()
+		}()
+	}
+	wg.Wait()
+
+	code := 0
+	fmt.Fprintln(os.Stderr)
+	for i, h := range hosts {
+		if errs[i] != nil {
+			code = 1
+			fmt.Fprintf(os.Stderr, "%-*s   FAILED: %v\n", width, h, errs[i])
+		} else {
+			fmt.Fprintf(os.Stderr, "%-*s   ok\n", width, h)
+		}
+	}
+	return code
+}
+
+// prefixWriter writes every line written to it to w, prefixed with prefix.
+// Partial lines are buffered until they are complete or Flush is called.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes out any buffered partial line.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(p.buf)
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s%s\n", p.prefix, line)
+}
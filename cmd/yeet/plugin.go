@@ -0,0 +1,132 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/spf13/cobra"
+)
+
+// pluginPrefix is the prefix of executables on PATH that provide external
+// yeet subcommands, e.g. `yeet-foo` provides `yeet foo`.
+const pluginPrefix = "yeet-"
+
+// maybeRunPlugin runs the plugin for args[0] if it is not a builtin command
+// and a matching executable exists on PATH. It exits the process with the
+// plugin's exit code, and returns only if there is no such plugin.
+func maybeRunPlugin(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return
+	}
+	if c, _, err := rootCmd.Find(args); err == nil && c != rootCmd {
+		return
+	}
+	name := args[0]
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return
+	}
+	cmd := cmdutil.NewStdCmd(path, args[1:]...)
+	cmd.Env = append(os.Environ(), pluginEnv(args[1:])...)
+	if err := cmd.Run(); err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.ExitCode())
+		}
+		fmt.Fprintf(os.Stderr, "failed to run plugin %q: %v\n", name, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// pluginEnv returns the environment passed to plugins describing the context
+// yeet resolved:
+//
+//	YEET_BIN      path of the yeet binary, to call back into yeet
+//	YEET_HOST     catch host to talk to
+//	YEET_SERVICE  the first positional argument, following the
+//	              `yeet <cmd> <svc>` convention; a "svc@host" argument
+//	              also overrides YEET_HOST
+func pluginEnv(args []string) []string {
+	host := loadedPrefs.Host
+	var svc string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			svc = a
+			break
+		}
+	}
+	if s, h, ok := strings.Cut(svc, "@"); ok {
+		svc, host = s, h
+	}
+	env := []string{
+		"YEET_HOST=" + host,
+		"YEET_SERVICE=" + svc,
+	}
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, "YEET_BIN="+exe)
+	}
+	return env
+}
+
+// listPlugins returns the names of the plugins found on PATH.
+func listPlugins() []string {
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		ents, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range ents {
+			name, ok := strings.CutPrefix(e.Name(), pluginPrefix)
+			if !ok || name == "" || e.IsDir() {
+				continue
+			}
+			if _, err := exec.LookPath(filepath.Join(dir, e.Name())); err != nil {
+				continue // Not executable.
+			}
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func pluginsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "plugins",
+		Short: "List plugins found on PATH",
+		Long: `List plugins found on PATH.
+
+Any executable named yeet-<name> on PATH can be run as "yeet <name>". Plugins
+receive the resolved context in the YEET_HOST, YEET_SERVICE and YEET_BIN
+environment variables.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			for _, name := range listPlugins() {
+				fmt.Fprintln(cmd.OutOrStdout(), name)
+			}
+			return nil
+		},
+	}
+}
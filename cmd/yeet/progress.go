@@ -0,0 +1,69 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// noProgress is set by --no-progress to not print the progress of uploads.
+var noProgress bool
+
+// progressMilestone is the step in percent between progress lines when
+// stderr is not a terminal.
+const progressMilestone = 10
+
+// percentProgress prints the progress of an upload to stderr: in place on a
+// terminal, and as a line at every progressMilestone percent otherwise, so
+// that CI logs stay readable.
+type percentProgress struct {
+	term bool
+	last int64
+}
+
+func newPercentProgress() *percentProgress {
+	return &percentProgress{term: term.IsTerminal(int(os.Stderr.Fd())), last: -1}
+}
+
+// update prints the progress of done out of total bytes, if it changed
+// enough.
+func (p *percentProgress) update(done, total int64) {
+	if noProgress || total <= 0 {
+		return
+	}
+	pct := done * 100 / total
+	if !p.term {
+		pct -= pct % progressMilestone
+	}
+	if pct == p.last {
+		return
+	}
+	p.last = pct
+	if p.term {
+		fmt.Fprintf(os.Stderr, "\rUploaded: %d%%", pct)
+	} else {
+		fmt.Fprintf(os.Stderr, "Uploaded: %d%%\n", pct)
+	}
+}
+
+// finish ends the progress line on a terminal.
+func (p *percentProgress) finish() {
+	if p.term && p.last >= 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/yeetrun/yeet/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+func promoteEnvCmd() *cobra.Command {
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "promote-env <src-svc>[@host] <dst-svc>[@host]",
+		Short: "Stage the env file of one service onto another",
+		Long: `Stage the env file of one service onto another.
+
+The services may live on different catch hosts; the host defaults to the
+current --host. Values sealed with "yeet env seal" can only be promoted to a
+host with the same env key; seal them again for the destination otherwise.
+The change is only staged on the destination, run "yeet stage <dst-svc>
+commit" to apply it.`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPromoteEnv(args[0], args[1], yes)
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+	return cmd
+}
+
+// splitSvcHost splits "svc@host" into its parts, defaulting the host to the
+// current host.
+func splitSvcHost(s string) (svc, host string) {
+	svc, host, ok := strings.Cut(s, "@")
+	if !ok || host == "" {
+		host = loadedPrefs.Host
+	}
+	return svc, host
+}
+
+func runPromoteEnv(src, dst string, yes bool) error {
+	srcSvc, srcHost := splitSvcHost(src)
+	dstSvc, dstHost := splitSvcHost(dst)
+	if srcSvc == dstSvc && srcHost == dstHost {
+		return fmt.Errorf("source and destination are the same service")
+	}
+
+	srcEnv, err := fetchEnv(srcSvc, srcHost)
+	if err != nil {
+		return fmt.Errorf("failed to get env of %s@%s: %w", srcSvc, srcHost, err)
+	}
+	if srcHost != dstHost {
+		if err := checkSealedPromote(srcEnv, srcHost, dstHost); err != nil {
+			return err
+		}
+	}
+	// The destination may not have an env file yet.
+	dstEnv, _ := fetchEnv(dstSvc, dstHost)
+
+	diff := envDiff(dstEnv, srcEnv)
+	if len(diff) == 0 {
+		fmt.Fprintln(os.Stderr, "No changes")
+		return nil
+	}
+	fmt.Printf("Changes to %s@%s:\n", dstSvc, dstHost)
+	for _, l := range diff {
+		fmt.Println(l)
+	}
+	if !yes {
+		ok, err := cmdutil.Confirm(os.Stdin, os.Stdout, "Stage these changes?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	f, err := os.CreateTemp("", "yeet-env-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(srcEnv); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := cmdutil.NewStdCmd("scp", append(sshOpts(dstHost), f.Name(), fmt.Sprintf("%s@%s:stage/env", dstSvc, dstHost))...).Run(); err != nil {
+		return fmt.Errorf("failed to stage env: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Env staged on %s@%s; run `yeet stage %s commit` to apply\n", dstSvc, dstHost, dstSvc)
+	return nil
+}
+
+// checkSealedPromote returns an error if env has values sealed to srcHost
+// that dstHost can't open, because the hosts have different env keys. The
+// plaintext never leaves srcHost, so they can't be sealed again here.
+func checkSealedPromote(env []byte, srcHost, dstHost string) error {
+	var sealed []string
+	for _, l := range strings.Split(string(env), "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(l), "=")
+		if ok && !strings.HasPrefix(k, "#") && strings.HasPrefix(strings.Trim(v, `"'`), secrets.SealedPrefix) {
+			sealed = append(sealed, k)
+		}
+	}
+	if len(sealed) == 0 {
+		return nil
+	}
+	srcPub, err := fetchEnvPubKey(srcHost)
+	if err != nil {
+		return fmt.Errorf("failed to get public key of %s: %w", srcHost, err)
+	}
+	dstPub, err := fetchEnvPubKey(dstHost)
+	if err != nil {
+		return fmt.Errorf("failed to get public key of %s: %w", dstHost, err)
+	}
+	if srcPub == dstPub {
+		return nil
+	}
+	return fmt.Errorf("%s are sealed to %s and can't be read on %s; seal them for it with `yeet --host=%s env seal %s` and stage that env file instead",
+		strings.Join(sealed, ", "), srcHost, dstHost, dstHost, strings.Join(sealed, " "))
+}
+
+// fetchEnv returns the env file of svc on host.
+func fetchEnv(svc, host string) ([]byte, error) {
+	c := exec.Command("ssh", append(sshOpts(host), "-q", fmt.Sprintf("%s@%s", svc, host), "env")...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return bytes.TrimRight(out, "\n"), nil
+}
+
+// envDiff returns the lines removed from (prefixed with "-") and added to
+// (prefixed with "+") an env file going from old to new. Blank lines and
+// comments are ignored.
+func envDiff(old, new []byte) []string {
+	envLines := func(b []byte) []string {
+		var lines []string
+		for _, l := range strings.Split(string(b), "\n") {
+			l = strings.TrimSpace(l)
+			if l == "" || strings.HasPrefix(l, "#") {
+				continue
+			}
+			lines = append(lines, l)
+		}
+		return lines
+	}
+	oldLines, newLines := envLines(old), envLines(new)
+	var diff []string
+	for _, l := range oldLines {
+		if !slices.Contains(newLines, l) {
+			diff = append(diff, "-"+l)
+		}
+	}
+	for _, l := range newLines {
+		if !slices.Contains(oldLines, l) {
+			diff = append(diff, "+"+l)
+		}
+	}
+	return diff
+}
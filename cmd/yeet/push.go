@@ -0,0 +1,208 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/catch"
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/yeetrun/yeet/pkg/ftdetect"
+	"github.com/yeetrun/yeet/pkg/preflight"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/name"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/layout"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/remote"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// isImageArchive reports whether p is an image on disk rather than an image
+// in the local docker daemon: an OCI image layout directory, or a tarball of
+// one or of `docker save`.
+func isImageArchive(p string) bool {
+	st, err := os.Stat(p)
+	if err != nil {
+		return false
+	}
+	if st.IsDir() {
+		_, err := os.Stat(filepath.Join(p, "oci-layout"))
+		return err == nil
+	}
+	ok, err := ftdetect.IsImageArchive(p)
+	return err == nil && ok
+}
+
+// pushImageArchive pushes the image stored at p to the catch registry without
+// going through a docker daemon. p may be a docker-archive tarball (as
+// produced by `docker save`), an OCI image layout directory, or a tarball of
+// one.
+func pushImageArchive(ctx context.Context, svc, p, tag, goos, goarch string) error {
+	host, err := getDockerHost(ctx)
+	if err != nil {
+		return err
+	}
+	img, container, cleanup, err := loadImageArchive(p, goos, goarch)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	if container == "" {
+		container = svc
+	}
+	ref, err := name.NewTag(fmt.Sprintf("%s/%s/%s:%s", host, svc, container, tag))
+	if err != nil {
+		return fmt.Errorf("invalid image reference: %w", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("failed to read image config: %w", err)
+	}
+	if err := preflight.CheckImage(p, cf.OS, cf.Architecture, goos, goarch); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Pushing %s\n", ref)
+	updates := make(chan v1.Update, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		progress := newPercentProgress()
+		for u := range updates {
+			progress.update(u.Complete, u.Total)
+		}
+		progress.finish()
+	}()
+	err = remote.Write(ref, img, remote.WithContext(ctx), remote.WithProgress(updates))
+	<-done
+	if err != nil {
+		return fmt.Errorf("failed to push image: %w", err)
+	}
+	return nil
+}
+
+// loadImageArchive loads the image stored at p. It also returns the
+// container name to push the image as, derived from the image's repo tag if
+// the archive has one. cleanup removes the files extracted to load it, and
+// must be called once the image has been pushed.
+func loadImageArchive(p, goos, goarch string) (_ v1.Image, container string, cleanup func(), _ error) {
+	cleanup = func() {}
+	st, err := os.Stat(p)
+	if err != nil {
+		return nil, "", cleanup, err
+	}
+	if st.IsDir() {
+		img, err := loadOCILayout(p, goos, goarch)
+		return img, "", cleanup, err
+	}
+	opener := func() (io.ReadCloser, error) { return os.Open(p) }
+	m, err := tarball.LoadManifest(opener)
+	if err != nil {
+		// Not a docker archive, so it must be a tarball of an OCI image
+		// layout, which can only be read from a directory.
+		dir, err := os.MkdirTemp("", "yeet-oci-layout-")
+		if err != nil {
+			return nil, "", cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		if err := catch.ExtractTar(p, dir); err != nil {
+			return nil, "", cleanup, fmt.Errorf("failed to extract %q: %w", p, err)
+		}
+		img, err := loadOCILayout(dir, goos, goarch)
+		if err != nil {
+			return nil, "", cleanup, fmt.Errorf("%q: %w", p, err)
+		}
+		return img, "", cleanup, nil
+	}
+	if len(m) != 1 {
+		return nil, "", cleanup, fmt.Errorf("%q contains %d images, expected 1", p, len(m))
+	}
+	if len(m[0].RepoTags) > 0 {
+		repo := m[0].RepoTags[0]
+		if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+			repo = repo[:i]
+		}
+		container = path.Base(repo)
+	}
+	img, err := tarball.Image(opener, nil)
+	if err != nil {
+		return nil, "", cleanup, fmt.Errorf("failed to load image from %q: %w", p, err)
+	}
+	return img, container, cleanup, nil
+}
+
+// loadOCILayout returns the image in the OCI layout at dir that matches the
+// given platform. Images without a platform are assumed to match.
+func loadOCILayout(dir, goos, goarch string) (v1.Image, error) {
+	lp, err := layout.FromPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not an OCI image layout: %w", dir, err)
+	}
+	idx, err := lp.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCI image index: %w", err)
+	}
+	img, err := preflight.PlatformImage(idx, goos, goarch)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", dir, err)
+	}
+	return img, nil
+}
+
+// pushImageToServices pushes image to each of svcs. The image is stored under
+// each service's repo; the registry shares blobs between repos so only the
+// first push uploads the layers.
+func pushImageToServices(ctx context.Context, svcs []string, image, tag, goos, goarch string) error {
+	if isImageArchive(image) {
+		for _, s := range svcs {
+			if err := pushImageArchive(ctx, s, image, tag, goos, goarch); err != nil {
+				return fmt.Errorf("%s: %w", s, err)
+			}
+		}
+		return nil
+	}
+	host, err := getDockerHost(ctx)
+	if err != nil {
+		return err
+	}
+	if !imageExists(image) {
+		return fmt.Errorf("image %s does not exist", image)
+	}
+	if err := checkLocalImage(image, goos, goarch); err != nil {
+		return err
+	}
+	repo, err := imageRepo(image)
+	if err != nil {
+		return err
+	}
+	container := path.Base(repo)
+	for _, s := range svcs {
+		imgName := fmt.Sprintf("%s/%s/%s:%s", host, s, container, tag)
+		if err := do(
+			exec.Command("docker", "tag", image, imgName).Run,
+			cmdutil.NewStdCmd("docker", "push", imgName).Run,
+			exec.Command("docker", "rmi", imgName).Run,
+		); err != nil {
+			return fmt.Errorf("%s: %w", s, err)
+		}
+	}
+	return nil
+}
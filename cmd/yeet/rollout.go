@@ -0,0 +1,200 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/catch"
+)
+
+// defaultCanaryWait is how long a rollout waits on the canary hosts before
+// checking their health when --wait is not given.
+const defaultCanaryWait = 30 * time.Second
+
+// rolloutOpts are the client-only flags of a canary rollout, e.g.
+// `yeet run svc ./bin --hosts=@prod --canary=1 --wait=60s`.
+type rolloutOpts struct {
+	canary   string        // number of hosts, or a percentage like "10%"
+	wait     time.Duration // time the canary runs before its health is checked
+	rollback bool          // roll back the canary hosts if they are unhealthy
+}
+
+// rolloutFlags returns the rollout flags in args and whether a canary rollout
+// was asked for, along with args without those flags.
+func rolloutFlags(args []string) (opts rolloutOpts, ok bool, rest []string, err error) {
+	opts.wait = defaultCanaryWait
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, val, hasVal := strings.Cut(a, "=")
+		switch name {
+		case "--canary", "--wait":
+			if !hasVal {
+				if i+1 >= len(args) {
+					return opts, false, nil, fmt.Errorf("%s needs a value", name)
+				}
+				i++
+				val = args[i]
+			}
+			if name == "--canary" {
+				opts.canary = val
+				ok = true
+			} else if opts.wait, err = time.ParseDuration(val); err != nil {
+				return opts, false, nil, fmt.Errorf("invalid --wait: %w", err)
+			}
+		case "--rollback-canary":
+			opts.rollback = !hasVal || val == "true"
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return opts, ok, rest, nil
+}
+
+// canaryCount returns how many of n hosts the canary stage deploys to for a
+// --canary value of either a host count or a percentage of the hosts. At least
+// one host is always left for the rest of the rollout.
+func canaryCount(canary string, n int) (int, error) {
+	var c int
+	if pct, ok := strings.CutSuffix(canary, "%"); ok {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid --canary %q: percentage must be between 0 and 100", canary)
+		}
+		c = max(1, int(float64(n)*p/100))
+	} else {
+		v, err := strconv.Atoi(canary)
+		if err != nil || v < 1 {
+			return 0, fmt.Errorf("invalid --canary %q: must be a number of hosts or a percentage", canary)
+		}
+		c = v
+	}
+	if c >= n {
+		return 0, fmt.Errorf("--canary %q leaves no hosts after the canary (%d hosts)", canary, n)
+	}
+	return c, nil
+}
+
+// rollout runs yeet with args against the canary hosts first, waits, and only
+// runs it against the rest of hosts if the service is healthy on every canary
+// host. If it is not the rollout halts and, when asked, the canary hosts are
+// rolled back. It returns the exit code for the whole rollout.
+func rollout(hosts, args []string, opts rolloutOpts) int {
+	n, err := canaryCount(opts.canary, len(hosts))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	sn := rolloutService(args)
+	if sn == "" {
+		fmt.Fprintln(os.Stderr, "canary rollouts need a service")
+		return 1
+	}
+	canary, rest := hosts[:n], hosts[n:]
+
+	fmt.Fprintf(os.Stderr, "Deploying to canary hosts: %s\n", strings.Join(canary, ", "))
+	if code := fanOut(canary, args); code != 0 {
+		fmt.Fprintln(os.Stderr, "Canary deploy failed, halting rollout")
+		return haltRollout(canary, sn, opts)
+	}
+
+	fmt.Fprintf(os.Stderr, "Waiting %v before checking %q on the canary hosts\n", opts.wait, sn)
+	time.Sleep(opts.wait)
+	healthy := true
+	for _, h := range canary {
+		if err := checkCanary(h, sn); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", h, err)
+			healthy = false
+		}
+	}
+	if !healthy {
+		fmt.Fprintln(os.Stderr, "Canary is unhealthy, halting rollout")
+		return haltRollout(canary, sn, opts)
+	}
+
+	fmt.Fprintf(os.Stderr, "Canary is healthy, deploying to %s\n", strings.Join(rest, ", "))
+	return fanOut(rest, args)
+}
+
+// haltRollout rolls back sn on the canary hosts if asked to and returns the
+// exit code of a halted rollout.
+func haltRollout(canary []string, sn string, opts rolloutOpts) int {
+	if opts.rollback {
+		fmt.Fprintf(os.Stderr, "Rolling back %q on the canary hosts\n", sn)
+		fanOut(canary, []string{"rollback", sn})
+	}
+	return 1
+}
+
+// checkCanary returns an error unless sn is running on host with no unhealthy
+// or still starting components.
+func checkCanary(host, sn string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(exe, "status", sn, "--format=json")
+	c.Env = append(os.Environ(), "CATCH_HOST="+host)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to get status: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var statuses []catch.ServiceStatusData
+	if err := json.Unmarshal(stdout.Bytes(), &statuses); err != nil {
+		return fmt.Errorf("failed to parse status: %w", err)
+	}
+	if len(statuses) == 0 {
+		return fmt.Errorf("service %q not found", sn)
+	}
+	for _, st := range statuses {
+		if st.Status != catch.ComponentStatusRunning {
+			return fmt.Errorf("service is %s", st.Status)
+		}
+		for _, cs := range st.ComponentStatus {
+			if cs.Health == catch.ComponentStatusUnhealthy || cs.Health == catch.ComponentStatusStarting {
+				return fmt.Errorf("%s is %s", cs.Name, cs.Health)
+			}
+		}
+	}
+	return nil
+}
+
+// rolloutService returns the service args deploy: the first non flag argument
+// after the command.
+func rolloutService(args []string) string {
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		if !strings.HasPrefix(a, "-") {
+			return a
+		}
+	}
+	return ""
+}
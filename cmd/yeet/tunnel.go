@@ -0,0 +1,63 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/spf13/cobra"
+)
+
+func tunnelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tunnel <svc> <serviceport>:<localport>",
+		Short: "Let a service reach a port on this machine until interrupted",
+		Long: `Let a service reach a port on this machine, e.g. a mock API running locally,
+until the command is interrupted.
+
+Connections the service makes to localhost:<serviceport> are forwarded to
+localhost:<localport> on this machine. For docker compose services, the port
+is opened in every running container of the service.`,
+		Example:      "  yeet tunnel web 8080:3000",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTunnel(args[0], args[1])
+		},
+	}
+}
+
+func runTunnel(svc, spec string) error {
+	sp, lp, ok := strings.Cut(spec, ":")
+	if !ok {
+		return fmt.Errorf("invalid tunnel %q: want <serviceport>:<localport>", spec)
+	}
+	for _, p := range []string{sp, lp} {
+		if n, err := strconv.Atoi(p); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", p)
+		}
+	}
+	svcAt := fmt.Sprintf("%s@%s", svc, loadedPrefs.Host)
+	fmt.Fprintf(os.Stderr, "Forwarding localhost:%s in %s to localhost:%s; press Ctrl-C to stop\n", sp, svc, lp)
+	return cmdutil.NewStdCmd("ssh", append(sshOpts(loadedPrefs.Host), "-qN",
+		"-o", "ExitOnForwardFailure=yes",
+		"-R", fmt.Sprintf("%s:localhost:%s", sp, lp),
+		svcAt,
+	)...).Run()
+}
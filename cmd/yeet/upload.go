@@ -0,0 +1,275 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Resumable uploads: files are staged over the exec channel with the upload
+// command of catch, keyed by the hash of the file. If the connection drops,
+// the upload continues from the bytes catch already has, both on the next
+// attempt and on the next run of yeet.
+//
+// With --streams=N, large files are sent as N ranges over parallel SSH
+// connections, which gets more throughput out of high-latency links than a
+// single connection, and catch joins them before installing the file. With
+// --compress, files are zstd compressed before they are sent and catch
+// unpacks them.
+
+var (
+	// compressUploads is set by --compress to zstd compress files before
+	// uploading them.
+	compressUploads bool
+	// uploadStreams is set by --streams to the number of parallel
+	// connections to upload files over.
+	uploadStreams = 1
+)
+
+// maxUploadStreams is the most parallel connections an upload uses.
+const maxUploadStreams = 16
+
+// parallelMinSize is the size below which files are uploaded over a single
+// connection.
+const parallelMinSize = 8 << 20
+
+// uploadAttempts is how many times an interrupted upload is resumed.
+const uploadAttempts = 4
+
+// uploadRetryDelay is how long to wait before resuming an upload.
+const uploadRetryDelay = 2 * time.Second
+
+// errNoResume is returned by resumableUpload if catch does not support
+// resumable uploads.
+var errNoResume = errors.New("resumable uploads not supported")
+
+// uploadFlags parses the flags of yeet itself for uploads, --no-progress,
+// --compress and --streams, out of args and returns the rest.
+func uploadFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case a == "--no-progress":
+			noProgress = true
+		case a == "--compress":
+			compressUploads = true
+		case a == "--streams" || strings.HasPrefix(a, "--streams="):
+			v, ok := strings.CutPrefix(a, "--streams=")
+			if !ok {
+				if i+1 == len(args) {
+					return nil, errors.New("--streams needs a value")
+				}
+				i++
+				v = args[i]
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxUploadStreams {
+				return nil, fmt.Errorf("invalid --streams %q, must be between 1 and %d", v, maxUploadStreams)
+			}
+			uploadStreams = n
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return rest, nil
+}
+
+// uploadID returns the ID of the resumable upload of file, the hex prefix of
+// its SHA-256, and its size.
+func uploadID(file string) (string, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32], n, nil
+}
+
+// uploadReceived returns how many bytes of upload id svc has received.
+func uploadReceived(svc, id string) (int64, error) {
+	cmd := sshCmd(svc, "upload", "--status", "--id="+id)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// resumableUpload stages file for svc, resuming where a previous upload of
+// the same file stopped.
+func resumableUpload(svc, file string) error {
+	id, size, err := uploadID(file)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for attempt := range uploadAttempts {
+		if attempt > 0 {
+			time.Sleep(uploadRetryDelay)
+		}
+		offset, err := uploadReceived(svc, id)
+		if err != nil {
+			if attempt == 0 {
+				// Older catch versions don't know the upload
+				// command.
+				return errNoResume
+			}
+			lastErr = err
+			continue
+		}
+		if attempt > 0 && offset >= size {
+			// Everything arrived, so installing the file failed and
+			// catch already said why.
+			return lastErr
+		}
+		if offset > size {
+			offset = 0
+		}
+		if attempt == 0 && offset == 0 && uploadStreams > 1 && size >= parallelMinSize {
+			if err := parallelUpload(svc, file, id, size); err == nil {
+				return joinUpload(svc, id)
+			} else {
+				fmt.Fprintf(os.Stderr, "Parallel upload failed, uploading over one connection: %v\n", err)
+			}
+		}
+		if offset > 0 {
+			fmt.Fprintf(os.Stderr, "Resuming upload of %s at %s of %s\n", file, formatBytes(uint64(offset)), formatBytes(uint64(size)))
+		}
+		if lastErr = sendUpload(svc, file, id, offset, size); lastErr == nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Upload interrupted: %v\n", lastErr)
+	}
+	return lastErr
+}
+
+// sendUpload sends file from offset to the upload command of svc.
+func sendUpload(svc, file, id string, offset, size int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	var sent atomic.Int64
+	sent.Store(offset)
+	stop := watchProgress(&sent, size)
+	cmd := sshCmd(svc, "upload", "--stage", "--id="+id, "--offset="+strconv.FormatInt(offset, 10))
+	cmd.Stdin = &progressReader{r: f, n: &sent}
+	err = cmd.Run()
+	stop()
+	return err
+}
+
+// parallelUpload sends file to svc as uploadStreams ranges over parallel
+// connections. The ranges are only installed by joinUpload.
+func parallelUpload(svc, file, id string, size int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n := int64(uploadStreams)
+	chunk := (size + n - 1) / n
+	var sent atomic.Int64
+	stop := watchProgress(&sent, size)
+	defer stop()
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		off := i * chunk
+		if off >= size {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := sshCmd(svc, "upload", "--id="+id, "--part-at="+strconv.FormatInt(off, 10))
+			cmd.Stdin = &progressReader{r: io.NewSectionReader(f, off, min(chunk, size-off)), n: &sent}
+			errs[i] = cmd.Run()
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// joinUpload installs the ranges of upload id sent by parallelUpload.
+func joinUpload(svc, id string) error {
+	cmd := sshCmd(svc, "upload", "--stage", "--join", "--id="+id)
+	cmd.Stdin = nil
+	return cmd.Run()
+}
+
+// watchProgress prints the progress of an upload of size bytes of which sent
+// were sent until the returned function is called.
+func watchProgress(sent *atomic.Int64, size int64) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	progress := newPercentProgress()
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(250 * time.Millisecond):
+				progress.update(sent.Load(), size)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			progress.finish()
+		})
+	}
+}
+
+// progressReader counts the bytes read from r in n.
+type progressReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,222 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// workspaceFile is the name of the file declaring how a project is deployed.
+const workspaceFile = "yeet.yaml"
+
+// workspace is the deploy configuration of a project, read from its
+// yeet.yaml:
+//
+//	service: api
+//	host: catch-prod      # or h1,h2 or @prod
+//	payload: ./bin/api    # or image: ghcr.io/acme/api:latest
+//	env: .env
+//	flags: [--net=ts, --restart=false]
+type workspace struct {
+	// Service is the name of the service to deploy.
+	Service string `yaml:"service"`
+	// Host is the catch host to deploy to, as for --host.
+	Host string `yaml:"host"`
+	// Payload is the file to deploy, relative to the workspace.
+	Payload string `yaml:"payload"`
+	// Image is the local docker image to deploy instead of a file.
+	Image string `yaml:"image"`
+	// Env is the env file to stage with the payload, relative to the
+	// workspace.
+	Env string `yaml:"env"`
+	// Flags are the stage flags to deploy with, e.g. --net=ts, and the
+	// upload flags of up, e.g. --compress.
+	Flags []string `yaml:"flags"`
+
+	// dir is the directory of the yeet.yaml.
+	dir string
+}
+
+// findWorkspace returns the workspace of the yeet.yaml in the current
+// directory or the closest of its parents.
+func findWorkspace() (*workspace, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for dir := wd; ; {
+		b, err := os.ReadFile(filepath.Join(dir, workspaceFile))
+		if err == nil {
+			ws := &workspace{dir: dir}
+			if err := yaml.Unmarshal(b, ws); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, workspaceFile), err)
+			}
+			return ws, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no %s found in %s or its parents", workspaceFile, wd)
+		}
+		dir = parent
+	}
+}
+
+// path returns p, relative to the workspace, relative to the current
+// directory instead.
+func (ws *workspace) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(ws.dir, p)
+}
+
+// withWorkspaceHost returns the args of `yeet up` with a --host flag for the
+// host of the workspace, unless they or CATCH_HOST already name one, so that
+// it fans out to several hosts like --host does.
+func withWorkspaceHost(args []string) []string {
+	if os.Getenv("CATCH_HOST") != "" {
+		// Set by the user or by fanOut for each host.
+		return args
+	}
+	for _, a := range args {
+		if a == "--" {
+			break
+		}
+		name, _, _ := strings.Cut(a, "=")
+		if name == "--host" || name == "--hosts" {
+			return args
+		}
+	}
+	ws, err := findWorkspace()
+	if err != nil || ws.Host == "" {
+		// upCmd reports the error.
+		return args
+	}
+	return append([]string{args[0], "--host=" + ws.Host}, args[1:]...)
+}
+
+var upFlags struct {
+	service string
+	payload string
+	env     string
+}
+
+func upCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "up [-- stage flags...]",
+		Short: "Deploy the project as declared in its yeet.yaml",
+		Long: `Deploy the project as declared in its yeet.yaml.
+
+The yeet.yaml in the current directory or the closest of its parents names
+the service, the host, the payload file or image, the env file and the stage
+and upload flags to deploy with. Flags override it: --name, --payload and
+--env-file replace their fields, --host replaces the host, --no-progress,
+--compress and --streams replace those of the file and stage flags after "--"
+are applied after those of the file.`,
+		Example:      "  yeet up\n  yeet up --host=staging -- --restart=false",
+		SilenceUsage: true,
+		RunE:         runUp,
+	}
+	cmd.Flags().StringVar(&upFlags.service, "name", "", "Service to deploy; overrides service")
+	cmd.Flags().StringVar(&upFlags.payload, "payload", "", "File or image to deploy; overrides payload and image")
+	cmd.Flags().StringVar(&upFlags.env, "env-file", "", "Env file to stage; overrides env")
+	cmd.Flags().BoolVar(&noProgress, "no-progress", false, "Don't print the progress of uploads")
+	cmd.Flags().BoolVar(&compressUploads, "compress", false, "Compress uploads with zstd")
+	cmd.Flags().IntVar(&uploadStreams, "streams", 1, "Number of parallel connections to upload over")
+	return cmd
+}
+
+func runUp(cmd *cobra.Command, args []string) error {
+	ws, err := findWorkspace()
+	if err != nil {
+		return err
+	}
+	if upFlags.service != "" {
+		ws.Service = upFlags.service
+	}
+	payload := ws.path(ws.Payload)
+	if ws.Image != "" {
+		if ws.Payload != "" {
+			return fmt.Errorf("%s sets both payload and image", workspaceFile)
+		}
+		payload = ws.Image
+	}
+	if upFlags.payload != "" {
+		payload = upFlags.payload
+	}
+	env := ws.path(ws.Env)
+	if upFlags.env != "" {
+		env = upFlags.env
+	}
+	if ws.Service == "" {
+		return fmt.Errorf("no service in %s, set service or pass --name", workspaceFile)
+	}
+	if payload == "" {
+		return fmt.Errorf("nothing to deploy in %s, set payload or image or pass --payload", workspaceFile)
+	}
+	if ws.Image == "" && upFlags.payload == "" {
+		if _, err := os.Stat(payload); err != nil {
+			return fmt.Errorf("payload in %s: %w", workspaceFile, err)
+		}
+	}
+	// The upload flags of the file are for yeet rather than catch, and
+	// those given to up override them.
+	flagNoProgress, flagCompress, flagStreams := noProgress, compressUploads, uploadStreams
+	stageFlags, err := uploadFlags(ws.Flags)
+	if err != nil {
+		return fmt.Errorf("flags in %s: %w", workspaceFile, err)
+	}
+	if cmd.Flags().Changed("no-progress") {
+		noProgress = flagNoProgress
+	}
+	if cmd.Flags().Changed("compress") {
+		compressUploads = flagCompress
+	}
+	if cmd.Flags().Changed("streams") {
+		uploadStreams = flagStreams
+	}
+	if args, err = uploadFlags(args); err != nil {
+		return err
+	}
+	if uploadStreams < 1 || uploadStreams > maxUploadStreams {
+		return fmt.Errorf("invalid --streams %d, must be between 1 and %d", uploadStreams, maxUploadStreams)
+	}
+	if err := rootCmd.PersistentFlags().Set("service", ws.Service); err != nil {
+		return err
+	}
+
+	if env != "" {
+		if _, err := os.Stat(env); err != nil {
+			return fmt.Errorf("env file: %w", err)
+		}
+		if err := markTemplate(ws.Service, env); err != nil {
+			return err
+		}
+		// Staged so that it is committed along with the payload.
+		if err := uploadFile(ws.Service, env, "stage/env"); err != nil {
+			return fmt.Errorf("failed to stage env file: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Deploying %s to %s@%s\n", payload, ws.Service, loadedPrefs.Host)
+	return runRun(payload, append(stageFlags, args...))
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeWorkspace(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, workspaceFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindWorkspace(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proj := filepath.Join(root, "proj")
+	writeWorkspace(t, proj, `
+service: api
+host: catch-prod
+payload: ./bin/api
+env: .env
+flags: [--net=ts, --restart=false]
+unknown: ignored
+`)
+	sub := filepath.Join(proj, "cmd", "api")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+
+	ws, err := findWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Service != "api" || ws.Host != "catch-prod" || ws.Payload != "./bin/api" || ws.Image != "" || ws.Env != ".env" {
+		t.Errorf("findWorkspace = %+v", ws)
+	}
+	if want := []string{"--net=ts", "--restart=false"}; !slices.Equal(ws.Flags, want) {
+		t.Errorf("Flags = %q, want %q", ws.Flags, want)
+	}
+	if ws.dir != proj {
+		t.Errorf("dir = %q, want %q", ws.dir, proj)
+	}
+	for p, want := range map[string]string{
+		"":                          "",
+		"./bin/api":                 filepath.Join(proj, "bin", "api"),
+		".env":                      filepath.Join(proj, ".env"),
+		filepath.Join(root, "file"): filepath.Join(root, "file"),
+	} {
+		if got := ws.path(p); got != want {
+			t.Errorf("path(%q) = %q, want %q", p, got, want)
+		}
+	}
+
+	// The closest yeet.yaml wins.
+	writeWorkspace(t, filepath.Join(proj, "cmd"), "service: cmd\nimage: ghcr.io/acme/cmd:latest\n")
+	ws, err = findWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Service != "cmd" || ws.Image != "ghcr.io/acme/cmd:latest" || ws.Host != "" {
+		t.Errorf("findWorkspace = %+v, want the closest yeet.yaml", ws)
+	}
+}
+
+func TestFindWorkspaceErrors(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+	if _, err := findWorkspace(); err == nil || !strings.Contains(err.Error(), "no yeet.yaml found") {
+		t.Errorf("findWorkspace without yeet.yaml = %v, want not found error", err)
+	}
+
+	writeWorkspace(t, root, "service: [api\n")
+	if _, err := findWorkspace(); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("findWorkspace with invalid yeet.yaml = %v, want parse error", err)
+	}
+
+	writeWorkspace(t, root, "flags: --net=ts\n")
+	if _, err := findWorkspace(); err == nil {
+		t.Error("findWorkspace with flags that aren't a list succeeded")
+	}
+}
+
+func TestWithWorkspaceHost(t *testing.T) {
+	t.Setenv("CATCH_HOST", "")
+	t.Chdir(t.TempDir())
+	writeWorkspace(t, ".", "service: api\nhost: h1,h2\n")
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"up"}, want: []string{"up", "--host=h1,h2"}},
+		{args: []string{"up", "--", "--host=x"}, want: []string{"up", "--host=h1,h2", "--", "--host=x"}},
+		{args: []string{"up", "--host=staging"}, want: []string{"up", "--host=staging"}},
+		{args: []string{"up", "--hosts=@prod"}, want: []string{"up", "--hosts=@prod"}},
+	}
+	for _, tt := range tests {
+		if got := withWorkspaceHost(tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("withWorkspaceHost(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	t.Setenv("CATCH_HOST", "other")
+	if got := withWorkspaceHost([]string{"up"}); !slices.Equal(got, []string{"up"}) {
+		t.Errorf("withWorkspaceHost with CATCH_HOST = %q, want args unchanged", got)
+	}
+}
+
+func TestUploadFlags(t *testing.T) {
+	defer func(np, c bool, s int) {
+		noProgress, compressUploads, uploadStreams = np, c, s
+	}(noProgress, compressUploads, uploadStreams)
+
+	noProgress, compressUploads, uploadStreams = false, false, 1
+	rest, err := uploadFlags([]string{"--net=ts", "--compress", "--streams", "4", "--no-progress", "--", "--compress"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--net=ts", "--", "--compress"}; !slices.Equal(rest, want) {
+		t.Errorf("rest = %q, want %q", rest, want)
+	}
+	if !noProgress || !compressUploads || uploadStreams != 4 {
+		t.Errorf("noProgress, compressUploads, uploadStreams = %v, %v, %d; want true, true, 4", noProgress, compressUploads, uploadStreams)
+	}
+
+	for _, args := range [][]string{
+		{"--streams"},
+		{"--streams=0"},
+		{"--streams=x"},
+		{"--streams", "1000"},
+	} {
+		if _, err := uploadFlags(args); err == nil {
+			t.Errorf("uploadFlags(%q) succeeded", args)
+		}
+	}
+}
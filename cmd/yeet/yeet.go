@@ -17,6 +17,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,7 +28,6 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
-	"text/tabwriter"
 	"time"
 
 	"github.com/yeetrun/yeet/pkg/catch"
@@ -35,6 +35,8 @@ import (
 	"github.com/yeetrun/yeet/pkg/cmdutil"
 	"github.com/yeetrun/yeet/pkg/codecutil"
 	"github.com/yeetrun/yeet/pkg/ftdetect"
+	_ "github.com/yeetrun/yeet/pkg/ftdetect/tsdetect"
+	"github.com/yeetrun/yeet/pkg/preflight"
 	"github.com/yeetrun/yeet/pkg/svc"
 	"github.com/fatih/color"
 	"github.com/hugomd/ascii-live/frames"
@@ -69,6 +71,9 @@ var loadedPrefs prefs
 type prefs struct {
 	changed bool   `json:"-"`
 	Host    string `json:"host"`
+	// StatusColumns is the comma-separated list of columns shown by status
+	// when --columns is not set.
+	StatusColumns string `json:"statusColumns,omitempty"`
 }
 
 type flagPref[T comparable] struct {
@@ -101,6 +106,10 @@ func (p *prefs) HostValue() pflag.Value {
 	return flagPref[string]{t: &p.Host, changed: &p.changed}
 }
 
+func (p *prefs) StatusColumnsValue() pflag.Value {
+	return flagPref[string]{t: &p.StatusColumns, changed: &p.changed}
+}
+
 func (p *prefs) save() error {
 	if err := os.MkdirAll(filepath.Dir(prefsFile), 0755); err != nil {
 		return err
@@ -193,16 +202,24 @@ func asJSON(v any) string {
 }
 
 func main() {
+	if target, ok := os.LookupEnv(apiExecEnv); ok {
+		// Re-executed by apiCmd to run a command over the API.
+		os.Exit(runAPIExec(target, os.Args[1:]))
+	}
 	rw := &clientReadWriter{in: os.Stdin, out: os.Stdout}
 	h := cli.NewCommandHandler(rw, run)
 	rootCmd = h.RootCmd("yeet")
-	rootCmd.PersistentFlags().Var(loadedPrefs.HostValue(), "host", "remote host to connect to")
+	rootCmd.PersistentFlags().Var(loadedPrefs.HostValue(), "host", "remote host to connect to; a comma separated list or @tag runs the command on each")
 
 	// Collect all the commands from the cli package to determine which need the
 	// service flag
 	var remoteCmds []string
 	for _, cmd := range rootCmd.Commands() {
 		remoteCmds = append(remoteCmds, strings.Split(cmd.Use, " ")[0])
+		if cmd.Name() == "env" {
+			// env seal runs locally.
+			cmd.AddCommand(envSealCmd())
+		}
 	}
 
 	// Create and hide a service flag to plumb the service name through
@@ -231,9 +248,11 @@ func main() {
 	})
 	var pushShouldRun bool
 	var pushAllLocal bool
+	var pushTo []string
 	pushCmd := &cobra.Command{
-		Use:          "push <svc> <image>",
-		Short:        "Push a container image to the remote host",
+		Use:          "push <svc> <image|archive>",
+		Short:        "Push a container image, docker-archive tarball or OCI layout to the remote host",
+		Example:      "  yeet push --to=svc-a,svc-b app:latest",
 		Args:         cobra.MinimumNArgs(1),
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -241,6 +260,16 @@ func main() {
 			if err != nil {
 				return err
 			}
+			tag := "latest" // Default tag (does not auto-deploy)
+			if pushShouldRun {
+				tag = "run"
+			}
+			if len(pushTo) > 0 {
+				if pushAllLocal {
+					return errors.New("--to and --all-local are mutually exclusive")
+				}
+				return pushImageToServices(cmd.Context(), pushTo, args[0], tag, goos, goarch)
+			}
 			svc := args[0]
 			if pushAllLocal {
 				return pushAllLocalImages(svc, goos, goarch)
@@ -249,23 +278,39 @@ func main() {
 				return errors.New("missing image argument")
 			}
 			image := args[1]
-			tag := "latest" // Default tag (does not auto-deploy)
-			if pushShouldRun {
-				tag = "run"
+			if isImageArchive(image) {
+				// A docker-archive tarball or OCI layout on disk; push
+				// it directly without a docker daemon.
+				return pushImageArchive(cmd.Context(), svc, image, tag, goos, goarch)
+			}
+			if err := checkLocalImage(image, goos, goarch); err != nil {
+				return err
 			}
 			return pushImage(cmd.Context(), svc, image, tag)
 		},
 	}
 	pushCmd.Flags().BoolVar(&pushShouldRun, "run", false, "auto-deploy the image")
 	pushCmd.Flags().BoolVar(&pushAllLocal, "all-local", false, "auto-deploy the image")
+	pushCmd.Flags().StringSliceVar(&pushTo, "to", nil, "push the image to each of these services instead of a single one")
+	pushCmd.Flags().BoolVar(&noProgress, "no-progress", false, "don't print the progress of the push")
 	rootCmd.AddCommand(pushCmd)
 	lhCmd := &cobra.Command{
 		Use:   "list-hosts [--tags=tag:catch]",
-		Short: "List all hosts with the given tags",
+		Short: "List all hosts with the given tags and their capabilities",
 		RunE:  runListHosts,
 	}
 	lhCmd.PersistentFlags().StringSliceVar(&listHostsFlags.tags, "tags", []string{"tag:catch"}, "tags to filter by")
+	lhCmd.PersistentFlags().BoolVar(&listHostsFlags.json, "json", false, "output the inventory as JSON")
 	rootCmd.AddCommand(lhCmd)
+	rootCmd.AddCommand(devCmd())
+	rootCmd.AddCommand(promoteEnvCmd())
+	rootCmd.AddCommand(pluginsCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(redoCmd())
+	rootCmd.AddCommand(tunnelCmd())
+	rootCmd.AddCommand(hostsCmd())
+	rootCmd.AddCommand(cpCmd())
+	rootCmd.AddCommand(upCmd())
 
 	var save bool
 	prefsCmd := &cobra.Command{
@@ -290,6 +335,7 @@ func main() {
 		},
 	}
 	prefsCmd.PersistentFlags().BoolVar(&save, "save", false, "save the current prefs")
+	prefsCmd.Flags().Var(loadedPrefs.StatusColumnsValue(), "status-columns", "default columns of status, e.g. service,status,uptime,ips")
 
 	rootCmd.AddCommand(prefsCmd)
 
@@ -328,8 +374,48 @@ func main() {
 	})
 
 	args := os.Args[1:]
-	if len(args) > 1 && slices.Contains(remoteCmds, args[0]) {
-		// Find first non flag argument and assume it's the service
+	if len(args) > 0 && args[0] == "up" {
+		// The host of yeet.yaml applies unless --host overrides it.
+		args = withWorkspaceHost(args)
+		rootCmd.SetArgs(args)
+	}
+	if len(args) == 0 || args[0] != "prefs" {
+		ro, canary, rest, err := rolloutFlags(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		hosts, err := targetHosts(context.Background(), rest)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if canary {
+			// Deploy to a canary first, e.g. `yeet run svc ./bin
+			// --hosts=@prod --canary=1 --wait=60s`.
+			os.Exit(rollout(hosts, withoutHostFlag(rest), ro))
+		}
+		if len(hosts) > 1 || hostGroupFlag(rest) {
+			// Run the command against every host, e.g. `yeet run svc
+			// ./bin --host=h1,h2` or --hosts=@prod.
+			os.Exit(fanOut(hosts, withoutHostFlag(rest)))
+		}
+	}
+	maybeRunPlugin(args)
+	if isSysCmd(args) {
+		// sys, registry, gc, ls and trust commands always run against
+		// the sys service and take no service argument, nor does `images
+		// rm`, which names the image instead.
+		rootCmd.ParseFlags([]string{"--service", "sys"})
+	} else if sn, rest, ok := subcommandService(args); ok && (args[0] == "image" || args[0] == "secret" || args[0] == "share") {
+		// image, secret and share commands take the service after the
+		// subcommand, e.g. `yeet image replicate <svc>`.
+		rootCmd.ParseFlags(args)
+		rootCmd.ParseFlags([]string{"--service", sn})
+		rootCmd.SetArgs(rest)
+	} else if len(args) > 1 && slices.Contains(remoteCmds, args[0]) && !(args[0] == "env" && args[1] == "seal") {
+		// Find first non flag argument and assume it's the service. env seal
+		// is excluded as it runs locally and takes no service.
 		var firstArg string
 		for i := 1; i < len(args); i++ {
 			arg := args[i]
@@ -355,46 +441,71 @@ func main() {
 		rootCmd.SetArgs(args)
 	}
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, explainHostKeyError(loadedPrefs.Host, err))
+		os.Exit(1)
 	}
+	recordHistory(os.Args[1:])
 }
 
-var listHostsFlags struct {
-	tags []string
-}
-
-func runListHosts(cmd *cobra.Command, _ []string) error {
-	var lc tailscale.LocalClient
-	st, err := lc.Status(cmd.Context())
-	if err != nil {
-		return err
-	}
-	_, selfDomain, _ := strings.Cut(st.Self.DNSName, ".")
-
-	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
-	defer w.Flush()
-
-	fmt.Fprintln(w, "HOST\tVERSION\tTAGS")
-
-	for _, peer := range st.Peer {
-		if peer.Tags == nil || !overlaps(peer.Tags.AsSlice(), listHostsFlags.tags) {
-			continue
+// subcommandService returns the first positional argument after the command
+// and subcommand names of args, e.g. svc in `image --host=h replicate svc`,
+// along with args without it.
+func subcommandService(args []string) (string, []string, bool) {
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil || cmd == rootCmd {
+		return "", nil, false
+	}
+	names := 0
+	for c := cmd; c != rootCmd; c = c.Parent() {
+		names++
+	}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
 		}
-		host, domain, _ := strings.Cut(peer.DNSName, ".")
-		if domain != selfDomain {
+		if strings.HasPrefix(a, "-") {
+			if strings.Contains(a, "=") {
+				continue
+			}
+			var f *pflag.Flag
+			for _, fs := range []*pflag.FlagSet{cmd.Flags(), cmd.InheritedFlags()} {
+				if name, ok := strings.CutPrefix(a, "--"); ok {
+					f = fs.Lookup(name)
+				} else if len(a) == 2 {
+					f = fs.ShorthandLookup(a[1:])
+				}
+				if f != nil {
+					break
+				}
+			}
+			if f != nil && f.NoOptDefVal == "" {
+				i++ // Skip the value of the flag.
+			}
 			continue
 		}
-		c := cmdutil.NewStdCmd("ssh", host, "version")
-		c.Stdout = nil
-		version, err := c.Output()
-		if err != nil {
-			log.Printf("failed to get version for %s: %v", host, err)
-			version = []byte("unknown")
+		if names > 0 {
+			names--
+			continue
 		}
-		version = bytes.TrimSpace(version)
-		fmt.Fprintf(w, "%s\t%s\t%s\n", host, version, strings.Join(peer.Tags.AsSlice(), ","))
+		return a, append(args[:i:i], args[i+1:]...), true
 	}
-	return nil
+	return "", nil, false
+}
+
+// isSysCmd reports whether args are those of a command that runs against the
+// sys service and takes no service argument.
+func isSysCmd(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "sys", "registry", "gc", "ls", "trust":
+		return true
+	case "images":
+		return len(args) > 1 && args[1] == "rm"
+	}
+	return false
 }
 
 var archMap = map[string]string{
@@ -424,10 +535,17 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 		remote := args[0]
 		return initCatch(remote)
-	case "mount", "umount":
+	case "mount", "umount", "tail":
 		return sshTTYCmd("sys", os.Args[1:]...).Run()
 	}
+	if cmd.CalledAs() == "logs" && cmd.Flags().Changed("download") {
+		return runLogsDownload(cmd)
+	}
 	// Assume the command is a service command
+	var extra []string
+	if cmd.CalledAs() == "status" && !cmd.Flags().Changed("columns") && loadedPrefs.StatusColumns != "" {
+		extra = append(extra, "--columns="+loadedPrefs.StatusColumns)
+	}
 	cmds := []string{cmd.CalledAs()}
 	for cmd.Parent() != cmd.Root() && cmd.Parent() != nil {
 		cmd = cmd.Parent()
@@ -435,10 +553,14 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 	// Args turns into the series of subcommands plus the arguments. This is a
 	// remote command, pass the args over the wire. Args consist of os.Args,
-	// minus the binary, service name and any commands/subcommands.
+	// minus the binary, service name and any commands/subcommands. sys
+	// commands have no service name.
 	idx := min(len(cmds)+2, len(os.Args))
+	if isSysCmd(cmds) {
+		idx = min(len(cmds)+1, len(os.Args))
+	}
 	args = append(cmds, os.Args[idx:]...)
-	return handleSvcCmd(args)
+	return handleSvcCmd(append(args, extra...))
 }
 
 // remoteHostOSAndArch returns the system and architecture of a given remote
@@ -537,8 +659,13 @@ func buildCatch(goos, goarch string) (string, error) {
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("go is not installed")
 	}
-	// Build the catch binary
-	cmd = cmdutil.NewStdCmd("go", "build", "-o", "catch", "./cmd/catch")
+	// Build the catch binary. CATCH_BUILD_TAGS can be used to select the
+	// "full" build which includes the heavier file detectors.
+	args := []string{"build", "-o", "catch"}
+	if tags := os.Getenv("CATCH_BUILD_TAGS"); tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	cmd = cmdutil.NewStdCmd("go", append(args, "./cmd/catch")...)
 	cmd.Env = append(os.Environ(), "GOARCH="+goarch, "GOOS=linux")
 	cmd.Dir = gitRoot
 	if err := cmd.Run(); err != nil {
@@ -583,12 +710,158 @@ func initCatch(userAtRemote string) error {
 		return fmt.Errorf("failed to run catch binary on remote host")
 	}
 	// Remove the catch binary from the local machine and the remote host
-	return os.Remove(bin)
+	if err := os.Remove(bin); err != nil {
+		return err
+	}
+	return remoteSelfCheck()
+}
+
+// remoteSelfCheck runs the catch self-check over the tailnet, which also
+// checks that catch's SSH server is reachable. It retries while catch is
+// still coming up.
+func remoteSelfCheck() error {
+	const attempts = 20
+	for i := 0; ; i++ {
+		err := sshCmd(catch.SystemService, "sys", "selfcheck").Run()
+		var ee *exec.ExitError
+		// ssh exits with 255 when it fails to connect.
+		if err == nil || !errors.As(err, &ee) || ee.ExitCode() != 255 || i == attempts-1 {
+			if err != nil {
+				return fmt.Errorf("catch self-check failed on %s: %w", loadedPrefs.Host, err)
+			}
+			return nil
+		}
+		time.Sleep(3 * time.Second)
+	}
 }
 
+// templateSuffix is the suffix of compose and env files whose placeholders
+// catch renders when they are uploaded, e.g. compose.yml.tmpl.
+const templateSuffix = ".tmpl"
+
+// markTemplate marks the next file uploaded for svc as a template for catch to
+// render, if file is named like one.
+func markTemplate(svc, file string) error {
+	if !strings.HasSuffix(file, templateSuffix) {
+		return nil
+	}
+	f, err := os.CreateTemp("", "yeet-mark-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := uploadFile(svc, f.Name(), "stage/tmpl"); err != nil {
+		return fmt.Errorf("failed to mark %s as a template: %w", file, err)
+	}
+	return nil
+}
+
+// stageFile stages bin for svc. If bin has a minisign signature next to it, it
+// is uploaded first, for services that require signed files, and if it is a
+// template it is marked as one.
 func stageFile(svc, bin string) error {
+	if err := markTemplate(svc, bin); err != nil {
+		return err
+	}
+	if _, err := os.Stat(bin + ".minisig"); err == nil {
+		if err := uploadFile(svc, bin+".minisig", "stage/sig"); err != nil {
+			return fmt.Errorf("failed to upload signature: %w", err)
+		}
+	}
+	if err := stageDelta(svc, bin); err == nil {
+		return nil
+	} else if !errors.Is(err, errNoDelta) {
+		fmt.Fprintf(os.Stderr, "Delta upload failed, uploading the whole file: %v\n", err)
+	}
+	if compressUploads {
+		return stageCompressed(svc, bin)
+	}
+	return uploadFile(svc, bin, "stage")
+}
+
+// stageCompressed stages bin for svc zstd compressed; catch unpacks it.
+func stageCompressed(svc, bin string) error {
+	if _, err := os.Stat(bin + ".minisig"); err == nil {
+		// The signature is of the uncompressed file, which catch
+		// verifies before unpacking.
+		fmt.Fprintf(os.Stderr, "Not compressing %s as it is signed\n", bin)
+		return uploadFile(svc, bin, "stage")
+	}
+	tmp, err := os.CreateTemp("", "yeet-*.zst")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := codecutil.ZstdCompress(bin, tmp.Name()); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", bin, err)
+	}
+	return uploadFile(svc, tmp.Name(), "stage")
+}
+
+// deltaMinSize is the size below which files are always uploaded whole.
+const deltaMinSize = 1 << 20
+
+// errNoDelta is returned by stageDelta when there is nothing to make a delta
+// against.
+var errNoDelta = errors.New("no delta base")
+
+// stageDelta stages bin for svc by uploading a delta against the binary the
+// service already has, so only the changed blocks are transferred.
+func stageDelta(svc, bin string) error {
+	st, err := os.Stat(bin)
+	if err != nil || st.Size() < deltaMinSize || !sshReachable() {
+		return errNoDelta
+	}
+	cmd := sshCmd(svc, "block-sums")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	out, err := cmd.Output()
+	if err != nil {
+		// Older catch versions don't know block-sums.
+		return errNoDelta
+	}
+	var sums *codecutil.BlockSums
+	if err := json.Unmarshal(out, &sums); err != nil || sums == nil || len(sums.Weak) == 0 {
+		return errNoDelta
+	}
+
+	f, err := os.CreateTemp("", "yeet-delta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := codecutil.WriteDelta(f, bin, sums); err != nil {
+		return fmt.Errorf("failed to compute delta: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if dst, err := os.Stat(f.Name()); err == nil {
+		fmt.Fprintf(os.Stderr, "Uploading delta of %s against the current binary: %s of %s\n", filepath.Base(bin), formatBytes(uint64(dst.Size())), formatBytes(uint64(st.Size())))
+	}
+	return uploadFile(svc, f.Name(), "stage")
+}
+
+// uploadFile copies file to path of svc over scp, or over the API if SSH is
+// unreachable. Files are staged with resumable uploads when catch supports
+// them.
+func uploadFile(svc, file, path string) error {
+	if !sshReachable() {
+		return apiUpload(context.Background(), svc, file, path)
+	}
+	if path == "stage" {
+		if err := resumableUpload(svc, file); !errors.Is(err, errNoResume) {
+			return err
+		}
+	}
 	svcAt := fmt.Sprintf("%s@%s", svc, loadedPrefs.Host)
-	cmd := cmdutil.NewStdCmd("scp", bin, fmt.Sprintf("%s:stage", svcAt))
+	args := sshOpts(loadedPrefs.Host)
+	if noProgress {
+		args = append(args, "-q")
+	}
+	cmd := cmdutil.NewStdCmd("scp", append(args, file, fmt.Sprintf("%s:%s", svcAt, path))...)
 	return cmd.Run()
 }
 
@@ -598,6 +871,15 @@ func handleSvcCmd(args []string) error {
 		return sshTTYCmd(svc).Run()
 	}
 
+	switch args[0] {
+	case "run", "stage", "cron":
+		// Upload flags are for yeet, which does the uploads.
+		var err error
+		if args, err = uploadFlags(args); err != nil {
+			return err
+		}
+	}
+
 	// Check for special commands
 	switch args[0] {
 	// `run <svc> <file/docker-image> [args...]`
@@ -615,12 +897,44 @@ func handleSvcCmd(args []string) error {
 		}
 	case "events":
 		return sshCmd(svc, args...).Run()
+	// `convert <svc> --to=<type> [file]`
+	case "convert":
+		return runConvert(svc, args[1:])
 	}
 
 	// Assume the first argument is a command
 	return sshTTYCmd(svc, args...).Run()
 }
 
+// runConvert converts the service and stages the file among args, if any,
+// as its new artifact.
+func runConvert(svc string, args []string) error {
+	var file string
+	var flags []string
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--to" && i+1 < len(args):
+			flags = append(flags, a, args[i+1])
+			i++
+		case strings.HasPrefix(a, "-"):
+			flags = append(flags, a)
+		default:
+			file = a
+		}
+	}
+	if err := sshTTYCmd(svc, append([]string{"convert"}, flags...)...).Run(); err != nil {
+		return err
+	}
+	if file == "" {
+		return nil
+	}
+	if err := stageFile(svc, file); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", file, err)
+	}
+	fmt.Printf("Staged %s; run `yeet stage %s commit` to start it\n", file, svc)
+	return nil
+}
+
 func runRun(payload string, args []string) error {
 	if ok, err := tryRunFile(payload, args); err != nil {
 		return err
@@ -651,14 +965,20 @@ func tryRunFile(file string, args []string) (ok bool, _ error) {
 	if err != nil {
 		return false, err
 	}
-	ft, err := ftdetect.DetectFile(file, goos, goarch)
-	if err != nil {
+	ft, err := preflight.CheckFile(file, goos, goarch)
+	if errors.As(err, new(*preflight.Error)) {
+		return false, err
+	} else if err != nil && strings.HasSuffix(file, templateSuffix) {
+		// Placeholders may make a compose file invalid YAML until catch
+		// renders them.
+		ft = ftdetect.DockerCompose
+	} else if err != nil {
 		return false, fmt.Errorf("failed to detect file type: %w", err)
 	}
 	svc := getService()
 	if ft == ftdetect.DockerCompose {
-		if err := pushAllLocalImages(svc, goos, goarch); err != nil {
-			return false, fmt.Errorf("failed to push all local images: %w", err)
+		if err := prepareComposeFile(svc, file, goos, goarch); err != nil {
+			return false, err
 		}
 	}
 	if err := stageFile(svc, file); err != nil {
@@ -680,12 +1000,39 @@ func tryRunFile(file string, args []string) (ok bool, _ error) {
 	return true, nil
 }
 
+// prepareComposeFile pushes the local images and builds the build: sections
+// the compose file at file needs before it is staged for svc.
+func prepareComposeFile(svc, file, goos, goarch string) error {
+	if err := pushAllLocalImages(svc, goos, goarch); err != nil {
+		return fmt.Errorf("failed to push all local images: %w", err)
+	}
+	return buildComposeImages(svc, file)
+}
+
 func tryRunDocker(image string, args []string) (ok bool, _ error) {
 	if !imageExists(image) {
 		// If the image does not exist, it's not an error
 		return false, nil
 	}
 	svc := getService()
+	rt, args, err := runtimeFlag(args)
+	if err != nil {
+		return false, err
+	}
+	if rt != "" {
+		// The runtime decides how the pushed image is staged, so it must
+		// be set before the push.
+		if err := sshCmd(svc, "runtime", rt).Run(); err != nil {
+			return false, fmt.Errorf("failed to set runtime: %w", err)
+		}
+	}
+	goos, goarch, err := remoteCatchOSAndArch()
+	if err != nil {
+		return false, err
+	}
+	if err := checkLocalImage(image, goos, goarch); err != nil {
+		return false, err
+	}
 	if err := pushImage(context.Background(), svc, image, "latest"); err != nil {
 		return false, fmt.Errorf("failed to push image: %w", err)
 	}
@@ -704,6 +1051,32 @@ func tryRunDocker(image string, args []string) (ok bool, _ error) {
 	return true, nil
 }
 
+// runtimeFlag returns the value of the --runtime flag in args, if any, along
+// with args without it.
+func runtimeFlag(args []string) (rt string, rest []string, _ error) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, val, hasVal := strings.Cut(a, "=")
+		if name != "--runtime" {
+			rest = append(rest, a)
+			continue
+		}
+		if !hasVal {
+			if i+1 >= len(args) {
+				return "", nil, errors.New("--runtime needs a value")
+			}
+			i++
+			val = args[i]
+		}
+		rt = val
+	}
+	return rt, rest, nil
+}
+
 func pushImage(ctx context.Context, svc, image, tag string) error {
 	host, err := getDockerHost(ctx)
 	if err != nil {
@@ -713,7 +1086,26 @@ func pushImage(ctx context.Context, svc, image, tag string) error {
 	if !imageExists(image) {
 		return fmt.Errorf("image %s does not exist", image)
 	}
-	// Extract the repo from the image name
+	repo, err := imageRepo(image)
+	if err != nil {
+		return err
+	}
+
+	// Format of <fqdn>/<svc>/<svc>:<tag>
+	imgName := fmt.Sprintf("%s/%s:%s", host, repo, tag)
+	if err := do(
+		exec.Command("docker", "tag", image, imgName).Run,
+		cmdutil.NewStdCmd("docker", "push", imgName).Run,
+		exec.Command("docker", "rmi", imgName).Run,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+// imageRepo returns the repo of a local docker image name, stripped of its
+// tag and registry host.
+func imageRepo(image string) (string, error) {
 	repo := image
 	// Strip tag if present
 	if i := strings.LastIndex(repo, ":"); i >= 0 {
@@ -730,19 +1122,9 @@ func pushImage(ctx context.Context, svc, image, tag string) error {
 	}
 	// Validate repo format
 	if strings.Count(repo, "/") > 1 {
-		return fmt.Errorf("invalid image name %q - repo must be in format 'svc' or 'svc/container'", image)
+		return "", fmt.Errorf("invalid image name %q - repo must be in format 'svc' or 'svc/container'", image)
 	}
-
-	// Format of <fqdn>/<svc>/<svc>:<tag>
-	imgName := fmt.Sprintf("%s/%s:%s", host, repo, tag)
-	if err := do(
-		exec.Command("docker", "tag", image, imgName).Run,
-		cmdutil.NewStdCmd("docker", "push", imgName).Run,
-		exec.Command("docker", "rmi", imgName).Run,
-	); err != nil {
-		return err
-	}
-	return nil
+	return repo, nil
 }
 
 func pushAllLocalImages(s, goos, goarch string) error {
@@ -765,17 +1147,8 @@ func pushAllLocalImages(s, goos, goarch string) error {
 		return nil
 	}
 	for _, image := range images {
-		sys, arch, err := imageSystemAndArch(image)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "skipping, failed to get image arch for %q: %v\n", image, err)
-			continue
-		}
-		if sys != goos {
-			fmt.Fprintf(os.Stderr, "skipping, image %q is for (local) %s, not (remote) %s\n", image, sys, goos)
-			continue
-		}
-		if goarch != arch {
-			fmt.Fprintf(os.Stderr, "skipping, image %q is for (local) %s, not (remote) %s\n", image, arch, goarch)
+		if err := checkLocalImage(image, goos, goarch); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping, %v\n", err)
 			continue
 		}
 		if err := pushImage(context.Background(), s, image, "latest"); err != nil {
@@ -785,6 +1158,16 @@ func pushAllLocalImages(s, goos, goarch string) error {
 	return nil
 }
 
+// checkLocalImage runs the pre-flight check of the local docker image against
+// a goos/goarch host.
+func checkLocalImage(image, goos, goarch string) error {
+	sys, arch, err := imageSystemAndArch(image)
+	if err != nil {
+		return fmt.Errorf("failed to get image arch for %q: %w", image, err)
+	}
+	return preflight.CheckImage(image, sys, arch, goos, goarch)
+}
+
 func imageSystemAndArch(image string) (system, arch string, _ error) {
 	cmd := exec.Command("docker", "inspect", "--format", "{{.Os}},{{.Architecture}}", image)
 	output, err := cmd.Output()
@@ -803,6 +1186,9 @@ func runCron(file string, args []string) error {
 	defer f.Close()
 	svc := getService()
 	nargs := []string{"cron"}
+	if noProgress {
+		nargs = append(nargs, "--no-progress")
+	}
 	if len(args) > 0 {
 		// Skip the first two arguments "cron" and the file
 		nargs = append(nargs, args...)
@@ -827,20 +1213,48 @@ func runStageBinary(file string) error {
 			fmt.Fprintf(os.Stderr, "%q is a directory, ignoring\n", file)
 		}
 	}
+	goos, goarch, err := remoteCatchOSAndArch()
+	if err != nil {
+		return err
+	}
+	// Files that can't be detected here may still be templates catch can
+	// render, so only stop on incompatibilities.
+	ft, err := preflight.CheckFile(file, goos, goarch)
+	if errors.As(err, new(*preflight.Error)) {
+		return err
+	} else if err == nil && ft == ftdetect.DockerCompose {
+		if err := prepareComposeFile(svc, file, goos, goarch); err != nil {
+			return err
+		}
+	}
 	if err := stageFile(svc, file); err != nil {
 		return err
 	}
 	return nil
 }
 
+// clientSession identifies the ssh sessions of this yeet command to catch,
+// which shows the host banner once for all of them.
+var clientSession = rand.Text()
+
+// sshTTYCmd returns a command that runs args for user, the service, over SSH
+// with a TTY, or over the catch API if SSH is unreachable.
 func sshTTYCmd(user string, args ...string) *exec.Cmd {
+	if !sshReachable() {
+		return apiCmd(user, true, args...)
+	}
 	svcAt := fmt.Sprintf("%s@%s", user, loadedPrefs.Host)
-	args = append([]string{"-tq", svcAt}, args...)
+	args = append(append(sshOpts(loadedPrefs.Host), "-tq", svcAt), args...)
 	return cmdutil.NewStdCmd("ssh", args...)
 }
 
+// sshCmd returns a command that runs args for user, the service, over SSH
+// without a TTY, or over the catch API if SSH is unreachable.
 func sshCmd(user string, args ...string) *exec.Cmd {
+	if !sshReachable() {
+		return apiCmd(user, false, args...)
+	}
 	svcAt := fmt.Sprintf("%s@%s", user, loadedPrefs.Host)
-	args = append([]string{"-q", svcAt}, args...)
+	args = append(append(sshOpts(loadedPrefs.Host), "-q", svcAt), args...)
 	return cmdutil.NewStdCmd("ssh", args...)
 }
@@ -17,17 +17,26 @@ package catch
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/yeetrun/yeet/pkg/svc"
 	"github.com/yeetrun/yeet/pkg/websocketutil"
 	"github.com/gorilla/websocket"
 	gssh "tailscale.com/tempfork/gliderlabs/ssh"
 	"tailscale.com/types/opt"
+	"tailscale.com/util/mak"
 )
 
 func (s *Server) handleAPI() http.Handler {
@@ -42,9 +51,17 @@ func (s *Server) handleAPI() http.Handler {
 	}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/v0/services", s.handleServices)
+	mux.HandleFunc("GET /api/v0/services/{name}/artifacts/{artifact}", s.handleArtifact)
 	mux.HandleFunc("GET /api/v0/info", s.handleInfo)
+	mux.HandleFunc("GET /api/v0/status", s.handleStatus)
+	mux.HandleFunc("GET /api/v0/stats", s.handleStats)
+	mux.HandleFunc("GET /api/v0/audit", s.handleAudit)
 	mux.HandleFunc("GET /api/v0/run-command", s.handleRunCommand)
+	mux.HandleFunc("PUT /api/v0/services/{name}/upload", s.handleUpload)
 	mux.HandleFunc("GET /api/v0/events", s.handleEvents)
+	mux.HandleFunc("GET /api/v0/logs", s.handleLogs)
+	mux.HandleFunc("GET /api/v0/prometheus-sd", s.handlePrometheusSD)
+	mux.HandleFunc("GET /api/v0/catalog", s.handleCatalog)
 	return authZ(mux)
 }
 
@@ -52,6 +69,24 @@ type ServerInfo struct {
 	Version string `json:"version"`
 	GOOS    string `json:"goos"`
 	GOARCH  string `json:"goarch"`
+
+	// The fields below are only reported by the API.
+
+	// Docker reports whether docker is available on the host.
+	Docker bool `json:"docker,omitempty"`
+	// Services is the number of services by service type.
+	Services map[string]int `json:"services,omitempty"`
+	// DiskFree is the free space in bytes on the volume holding the data
+	// directory.
+	DiskFree uint64 `json:"diskFree,omitempty"`
+	// Events are the counters of the event bus, including events dropped
+	// for slow listeners.
+	Events *EventStats `json:"events,omitempty"`
+	// Registry are the latency counters of manifest pushes to the registry.
+	Registry *RegistryStats `json:"registry,omitempty"`
+	// AutoDeployOff is set if pushes of the run tag are only staged, see
+	// `sys autodeploy`.
+	AutoDeployOff *ServiceActionData `json:"autoDeployOff,omitempty"`
 }
 
 func GetInfo() ServerInfo {
@@ -62,10 +97,34 @@ func GetInfo() ServerInfo {
 	}
 }
 
+// hostInfo returns GetInfo extended with the capabilities and usage of the
+// host.
+func (s *Server) hostInfo() ServerInfo {
+	info := GetInfo()
+	_, err := svc.DockerCmd()
+	info.Docker = err == nil
+	if dv, err := s.getDB(); err == nil {
+		for _, sv := range dv.Services().All() {
+			mak.Set(&info.Services, string(sv.ServiceType()), info.Services[string(sv.ServiceType())]+1)
+		}
+		info.AutoDeployOff = ServiceActionDataFromServiceAction(dv.AutoDeployOff())
+	}
+	if free, ok := diskFree(s.cfg.RootDir); ok {
+		info.DiskFree = free
+	}
+	es := s.EventStats()
+	info.Events = &es
+	if s.registry != nil {
+		rs := s.registry.writes.stats.data()
+		info.Registry = &rs
+	}
+	return info
+}
+
 func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		json.NewEncoder(w).Encode(GetInfo())
+		json.NewEncoder(w).Encode(s.hostInfo())
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -82,22 +141,45 @@ func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) getServices(w http.ResponseWriter, _ *http.Request) {
-	d, err := s.cfg.DB.Get()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+func (s *Server) getServices(w http.ResponseWriter, r *http.Request) {
+	s.serveCached(w, r, "services", func() (any, error) {
+		d, err := s.cfg.DB.Get()
+		if err != nil {
+			return nil, err
+		}
+		return d.AsStruct().Services, nil
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	sn := r.URL.Query().Get("service")
+	if sn == "" {
+		sn = SystemService
 	}
-	if err := json.NewEncoder(w).Encode(d.AsStruct().Services); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	s.serveCached(w, r, "status/"+sn, func() (any, error) {
+		return s.serviceStatuses(sn)
+	})
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	sn := r.URL.Query().Get("service")
+	if sn == "" {
+		sn = SystemService
 	}
+	s.serveCached(w, r, "stats/"+sn, func() (any, error) {
+		return s.serviceStats(sn)
+	})
 }
 
 func (s *Server) postService(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// CloseCommandFailed is the websocket close code run-command ends a TTY
+// session with when the command fails, with the error as the close text.
+// Sessions of commands that succeed end with websocket.CloseNormalClosure.
+const CloseCommandFailed = 4000
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -134,6 +216,7 @@ func (s *Server) handleRunCommand(w http.ResponseWriter, r *http.Request) {
 	var closer io.Closer
 	var ptyReq gssh.Pty
 	var ws *websocketutil.ConnReadWriter
+	var wsConn *websocket.Conn
 	ctx := r.Context()
 	if tty {
 		rawRows := r.URL.Query().Get("rows")
@@ -154,7 +237,7 @@ func (s *Server) handleRunCommand(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		ptyReq = fakePtyReq(rows, cols)
-		wsConn, err := upgrader.Upgrade(w, r, nil)
+		wsConn, err = upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -186,6 +269,9 @@ func (s *Server) handleRunCommand(w http.ResponseWriter, r *http.Request) {
 		ptyWCh:    nil, // TODO: implement
 		ptyReq:    ptyReq,
 		args:      args,
+
+		remoteAddr:    r.RemoteAddr,
+		clientSession: r.URL.Query().Get("session"),
 	}
 
 	if ws != nil {
@@ -206,10 +292,90 @@ func (s *Server) handleRunCommand(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	if err := e.run(); err != nil {
+	err := e.run()
+	if err != nil {
 		log.Println("error running command:", err)
+	}
+	if wsConn != nil {
+		// Tell the client how the command ended, as the output alone
+		// doesn't.
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		if err != nil {
+			msg = websocket.FormatCloseMessage(CloseCommandFailed, err.Error())
+		}
+		wsConn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	}
+}
+
+// handleUpload installs or stages the request body for the service, as
+// `scp <file> <svc>@catch:<path>` would. The path query parameter is "" or
+// "stage" for the service payload, "env" or "stage/env" for the env file,
+// "sig" or "stage/sig" for the signature of the next payload and "tmpl" or
+// "stage/tmpl" to mark it as a template. It lets clients deploy when they
+// can't reach the SSH server.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	sn := r.PathValue("name")
+	if sn == SystemService || sn == CatchService {
+		http.Error(w, fmt.Sprintf("uploads to %q are not supported", sn), http.StatusBadRequest)
+		return
+	}
+	cfg := FileInstallerCfg{
+		InstallerCfg: InstallerCfg{
+			ServiceName: sn,
+			User:        "root", // TODO: get user from service
+			ClientOut:   io.Discard,
+			Actor:       s.callerName(r.Context(), r.RemoteAddr),
+		},
+	}
+	switch p := scpTargetPath(r.URL.Query().Get("path")); p {
+	case "/sig", "/stage/sig", "/tmpl", "/stage/tmpl":
+		if err := s.ensureDirs(sn, cfg.User); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to receive %s: %v", path.Base(p), err), http.StatusBadRequest)
+			return
+		}
+		dst := s.signaturePath(sn)
+		if path.Base(p) == "tmpl" {
+			dst = s.templateMarkPath(sn)
+		}
+		if err := os.WriteFile(dst, b, 0600); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "/", "/stage":
+		cfg.StageOnly = p == "/stage"
+	case "/env", "/stage/env":
+		cfg.EnvFile = true
+		cfg.StageOnly = p == "/stage/env"
+		if _, err := s.serviceView(sn); errors.Is(err, errServiceNotFound) {
+			cfg.StageOnly = true // only stage env file if service does not exist
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unsupported path: %q", p), http.StatusBadRequest)
+		return
+	}
+	fi, err := NewFileInstaller(s, cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := io.Copy(fi, r.Body); err != nil {
+		fi.Fail()
+		fi.Close()
+		http.Error(w, fmt.Sprintf("failed to receive file: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := fi.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func fakePtyReq(rows, cols int) gssh.Pty {
@@ -222,7 +388,24 @@ func fakePtyReq(rows, cols int) gssh.Pty {
 	}
 }
 
+// eventWriteTimeout is how long writing an event to a websocket may take.
+const eventWriteTimeout = 10 * time.Second
+
+// handleEvents streams events over a websocket. The query parameters are:
+//
+//   - service: comma separated services to send events of; all if empty.
+//   - type: comma separated event types to send; all if empty.
+//   - heartbeat: whether to send heartbeats, true by default.
+//   - last: send up to this many recent events on connect.
+//   - since: send the recent events since this time on connect, either in
+//     milliseconds since the epoch, a duration ago like "10m" or a
+//     timestamp.
 func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	filter, last, since, err := eventQueryFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -230,18 +413,80 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	ch := make(chan Event)
-	h := s.AddEventListener(ch, func(et Event) bool {
-		return true
-	})
-	defer s.RemoveEventListener(h)
+	el, history := s.AddEventListenerWithHistory(filter, last, since)
+	defer s.RemoveEventListener(el)
 
+	write := func(event Event) error {
+		// Don't let a stuck client hold on to the listener forever.
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(event)
+	}
+	for _, event := range history {
+		if err := write(event); err != nil {
+			return
+		}
+	}
 	for {
 		select {
-		case event := <-ch:
-			conn.WriteJSON(event)
+		case event := <-el.Events():
+			if err := write(event); err != nil {
+				return
+			}
+		case <-el.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow to read events"),
+				time.Now().Add(time.Second))
+			return
 		case <-r.Context().Done():
 			return
 		}
 	}
 }
+
+// eventQueryFilter parses the query parameters of handleEvents into an event
+// filter and the history to replay.
+func eventQueryFilter(q url.Values, now time.Time) (filter func(Event) bool, last int, since time.Time, _ error) {
+	split := func(v string) []string {
+		var out []string
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	services := split(q.Get("service"))
+	types := split(q.Get("type"))
+	heartbeat, ok := opt.Bool(q.Get("heartbeat")).Get()
+	if !ok {
+		heartbeat = true
+	}
+	if v := q.Get("last"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, 0, time.Time{}, fmt.Errorf("invalid last %q", v)
+		}
+		last = n
+	}
+	if v := q.Get("since"); v != "" {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			since = time.UnixMilli(ms)
+		} else if since, err = parseLogTime(v, now); err != nil {
+			return nil, 0, time.Time{}, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	filter = func(e Event) bool {
+		if e.Type == EventTypeHeartbeat && !heartbeat {
+			return false
+		}
+		if len(types) > 0 && !slices.Contains(types, string(e.Type)) {
+			return false
+		}
+		// Heartbeats are published for sys but concern every service.
+		if len(services) > 0 && e.Type != EventTypeHeartbeat && !slices.Contains(services, e.ServiceName) {
+			return false
+		}
+		return true
+	}
+	return filter, last, since, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// apiCacheTTL is how long a cached API response is served before it is
+// recomputed. Entries are also dropped as soon as a service event is
+// published, so this only bounds staleness for changes the monitors don't
+// report.
+const apiCacheTTL = 5 * time.Second
+
+// apiCache is a read-through cache of JSON API responses keyed by endpoint.
+// Responses are computed outside of mu, once for concurrent requests, so that
+// invalidate never waits for a slow fill.
+type apiCache struct {
+	sf singleflight.Group
+
+	mu  sync.Mutex
+	m   map[string]*apiCacheEntry
+	gen uint64 // incremented by invalidate
+}
+
+type apiCacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+func (c *apiCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.m)
+	c.gen++
+}
+
+// get returns the cached entry for key, calling fill to compute it if it is
+// missing or expired.
+func (c *apiCache) get(key string, fill func() (any, error)) (*apiCacheEntry, error) {
+	c.mu.Lock()
+	if e, ok := c.m[key]; ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		return e, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	// Requests after an invalidate don't join a fill that started before
+	// it.
+	v, err, _ := c.sf.Do(fmt.Sprintf("%s@%d", key, gen), func() (any, error) {
+		v, err := fill()
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		e := &apiCacheEntry{
+			body:    append(b, '\n'),
+			etag:    fmt.Sprintf(`"%x"`, sum[:8]),
+			expires: time.Now().Add(apiCacheTTL),
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.gen == gen {
+			// Only cache it if nothing changed while it was computed.
+			if c.m == nil {
+				c.m = make(map[string]*apiCacheEntry)
+			}
+			c.m[key] = e
+		}
+		return e, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*apiCacheEntry), nil
+}
+
+// serveCached writes the cached response for key, honoring If-None-Match.
+func (s *Server) serveCached(w http.ResponseWriter, r *http.Request, key string, fill func() (any, error)) {
+	e, err := s.apiCache.get(key, fill)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", e.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatch(r.Header.Get("If-None-Match"), e.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(e.body)
+}
+
+// etagMatch reports whether the If-None-Match header value inm matches etag.
+func etagMatch(inm, etag string) bool {
+	for _, t := range strings.Split(inm, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
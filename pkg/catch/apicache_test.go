@@ -0,0 +1,170 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestAPICacheGet(t *testing.T) {
+	var c apiCache
+	fills := 0
+	val := "a"
+	fill := func() (any, error) {
+		fills++
+		return val, nil
+	}
+
+	e1, err := c.get("k", fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(e1.body), "\"a\"\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	e2, err := c.get("k", fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fills != 1 || e2 != e1 {
+		t.Errorf("second get filled again (fills = %d), want cached entry", fills)
+	}
+
+	// Other keys are cached separately.
+	if _, err := c.get("other", fill); err != nil {
+		t.Fatal(err)
+	}
+	if fills != 2 {
+		t.Errorf("fills = %d, want 2", fills)
+	}
+
+	// Same content, same ETag, even after invalidate.
+	c.invalidate()
+	e3, err := c.get("k", fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fills != 3 {
+		t.Errorf("get after invalidate did not refill (fills = %d)", fills)
+	}
+	if e3.etag != e1.etag {
+		t.Errorf("etag changed for the same content: %s != %s", e3.etag, e1.etag)
+	}
+
+	val = "b"
+	c.invalidate()
+	e4, err := c.get("k", fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e4.etag == e1.etag {
+		t.Errorf("etag %s did not change with the content", e4.etag)
+	}
+}
+
+func TestAPICacheInvalidateDuringFill(t *testing.T) {
+	var c apiCache
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.get("k", func() (any, error) {
+			close(started)
+			<-release
+			return "stale", nil
+		})
+	}()
+	<-started
+	c.invalidate()
+	close(release)
+	wg.Wait()
+
+	// The fill started before the invalidate must not have been cached.
+	e, err := c.get("k", func() (any, error) { return "fresh", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(e.body), "\"fresh\"\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestServeCached(t *testing.T) {
+	s := &Server{eventLog: newEventLog(t.TempDir())}
+	val := "a"
+	fill := func() (any, error) { return val, nil }
+	do := func(inm string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/v0/services", nil)
+		if inm != "" {
+			r.Header.Set("If-None-Match", inm)
+		}
+		w := httptest.NewRecorder()
+		s.serveCached(w, r, "services", fill)
+		return w
+	}
+
+	w := do("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if w := do(etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match with current ETag: status = %d, body %q; want 304 and no body", w.Code, w.Body)
+	}
+
+	// Heartbeats don't invalidate the cache, other events do.
+	val = "b"
+	s.PublishEvent(Event{ServiceName: "sys", Type: EventTypeHeartbeat})
+	if w := do(etag); w.Code != http.StatusNotModified {
+		t.Errorf("after heartbeat: status = %d, want 304", w.Code)
+	}
+	s.PublishEvent(Event{ServiceName: "web", Type: EventTypeServiceDeleted})
+	w = do(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("after event: status = %d, want 200", w.Code)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Errorf("ETag did not change after the content changed")
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	tests := []struct {
+		inm  string
+		want bool
+	}{
+		{inm: "", want: false},
+		{inm: `"abc"`, want: true},
+		{inm: `W/"abc"`, want: true},
+		{inm: `"x", "abc"`, want: true},
+		{inm: `"x","y"`, want: false},
+		{inm: "*", want: true},
+		{inm: `abc`, want: false},
+	}
+	for _, tt := range tests {
+		if got := etagMatch(tt.inm, `"abc"`); got != tt.want {
+			t.Errorf("etagMatch(%q) = %v, want %v", tt.inm, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+// approvalWindow is how long a deploy of a protected service waits for
+// approval before it lapses.
+const approvalWindow = time.Hour
+
+// holdProtectedDeploy records a pending deploy of generation gen (0 for the
+// staged one) if the service being installed with cfg is protected, and
+// reports whether it did. The generation is then only installed once
+// approved with `approve`.
+func (s *Server) holdProtectedDeploy(cfg InstallerCfg, gen int) (bool, error) {
+	if cfg.skipApproval {
+		return false, nil
+	}
+	dv, err := s.getDB()
+	if err != nil {
+		return false, err
+	}
+	sv, ok := dv.Services().GetOk(cfg.ServiceName)
+	if !ok || !sv.Protected() {
+		return false, nil
+	}
+	now := time.Now()
+	pd := &db.PendingDeploy{
+		RequestedBy: cfg.Actor,
+		RequestedAt: now,
+		Expires:     now.Add(approvalWindow),
+		Gen:         gen,
+	}
+	if gen == 0 {
+		pd.Staged = stagedFingerprint(*dv, sv)
+	}
+	if _, _, err := s.cfg.DB.MutateService(cfg.ServiceName, func(_ *db.Data, s *db.Service) error {
+		s.PendingDeploy = pd
+		return nil
+	}); err != nil {
+		return false, fmt.Errorf("failed to record pending deploy: %w", err)
+	}
+	s.PublishEvent(Event{
+		Type:        EventTypeDeployRequested,
+		ServiceName: cfg.ServiceName,
+		Data:        EventData{pd},
+	})
+	what := "deploy"
+	if gen != 0 {
+		what = fmt.Sprintf("deploy of generation %d", gen)
+	}
+	if cfg.Printer != nil {
+		cfg.Printer("Service %q is protected; %s awaits approval with `yeet approve %s` until %s\n",
+			cfg.ServiceName, what, cfg.ServiceName, pd.Expires.Format(time.DateTime))
+	}
+	log.Printf("%s of %q by %q awaits approval", what, cfg.ServiceName, cfg.Actor)
+	return true, nil
+}
+
+// stagedFingerprint returns a hash of the artifacts and images staged for
+// service sv.
+func stagedFingerprint(dv db.DataView, sv db.ServiceView) string {
+	var lines []string
+	for name, a := range sv.AsStruct().Artifacts {
+		if p, ok := a.Refs["staged"]; ok {
+			lines = append(lines, fmt.Sprintf("artifact %s %s", name, p))
+		}
+	}
+	for rn, ir := range dv.AsStruct().Images {
+		if sn, _, _ := strings.Cut(string(rn), "/"); sn != sv.Name() {
+			continue
+		}
+		if m, ok := ir.Refs["staged"]; ok {
+			lines = append(lines, fmt.Sprintf("image %s %s", rn, m.BlobHash))
+		}
+	}
+	slices.Sort(lines)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(lines, "\n"))))
+}
+
+func (e *ttyExecer) protectCmdFunc(_ *cobra.Command, args []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot protect %q", e.sn)
+	}
+	sv, err := e.s.serviceView(e.sn)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		e.printf("protected: %v\n", sv.Protected())
+		if pd := sv.PendingDeploy(); pd != nil {
+			e.printf("pending deploy requested by %s at %s, expires %s\n",
+				actorOrUnknown(pd.RequestedBy), pd.RequestedAt.Format(time.DateTime), pd.Expires.Format(time.DateTime))
+		}
+		if pu := sv.PendingUnprotect(); pu != nil && time.Now().Before(pu.Expires) {
+			e.printf("unprotect requested by %s at %s, expires %s\n",
+				actorOrUnknown(pu.RequestedBy), pu.RequestedAt.Format(time.DateTime), pu.Expires.Format(time.DateTime))
+		}
+		return nil
+	}
+	var on bool
+	switch args[0] {
+	case "on":
+		on = true
+	case "off":
+		if sv.Protected() {
+			// Lifting the protection is itself subject to the two-person
+			// rule: a second identity has to confirm it.
+			if done, err := e.requestUnprotect(sv); err != nil || !done {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid argument %q, expected on or off", args[0])
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		s.Protected = on
+		s.PendingUnprotect = nil
+		if !on {
+			s.PendingDeploy = nil
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	e.printf("protected: %v\n", on)
+	return nil
+}
+
+// requestUnprotect records a request to lift the protection of sv, or
+// reports true if it confirms the request of another identity.
+func (e *ttyExecer) requestUnprotect(sv db.ServiceView) (bool, error) {
+	actor := e.s.callerName(e.ctx, e.remoteAddr)
+	if actor == "" {
+		return false, fmt.Errorf("cannot identify you; unprotecting requires a tailscale identity")
+	}
+	now := time.Now()
+	if pu := sv.PendingUnprotect(); pu != nil && now.Before(pu.Expires) && pu.RequestedBy != actor {
+		return true, nil
+	}
+	pu := &db.PendingDeploy{
+		RequestedBy: actor,
+		RequestedAt: now,
+		Expires:     now.Add(approvalWindow),
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		s.PendingUnprotect = pu
+		return nil
+	}); err != nil {
+		return false, fmt.Errorf("failed to record unprotect request: %w", err)
+	}
+	e.printf("Unprotecting %q must be confirmed with `yeet protect off` by someone other than %s until %s\n",
+		e.sn, actor, pu.Expires.Format(time.DateTime))
+	return false, nil
+}
+
+func (e *ttyExecer) approveCmdFunc(cmd *cobra.Command, _ []string) error {
+	sv, err := e.s.serviceView(e.sn)
+	if err != nil {
+		return err
+	}
+	pd := sv.PendingDeploy()
+	if pd == nil {
+		return fmt.Errorf("no deploy of %q is pending", e.sn)
+	}
+	if time.Now().After(pd.Expires) {
+		e.clearPendingDeploy()
+		return fmt.Errorf("the pending deploy of %q expired at %s", e.sn, pd.Expires.Format(time.DateTime))
+	}
+	actor := e.s.callerName(e.ctx, e.remoteAddr)
+	if actor == "" {
+		return fmt.Errorf("cannot identify you; approvals require a tailscale identity")
+	}
+	if cmd.CalledAs() == "deny" {
+		// Anyone, including the requester, may withdraw a deploy.
+		e.clearPendingDeploy()
+		e.s.PublishEvent(Event{
+			Type:        EventTypeDeployDenied,
+			ServiceName: e.sn,
+			Data:        EventData{DeployDecisionData{RequestedBy: pd.RequestedBy, DeniedBy: actor}},
+		})
+		e.printf("Deploy of %q denied\n", e.sn)
+		return nil
+	}
+	if pd.RequestedBy == "" {
+		return fmt.Errorf("the deploy was requested by an unknown identity and can't be approved; deny it and deploy again")
+	}
+	if actor == pd.RequestedBy {
+		return fmt.Errorf("the deploy must be approved by someone other than %s", actor)
+	}
+	if pd.Gen == 0 {
+		dv, err := e.s.getDB()
+		if err != nil {
+			return err
+		}
+		if stagedFingerprint(*dv, sv) != pd.Staged {
+			e.clearPendingDeploy()
+			return fmt.Errorf("something else was staged since the deploy was requested; deploy again")
+		}
+	}
+	e.clearPendingDeploy()
+	e.s.PublishEvent(Event{
+		Type:        EventTypeDeployApproved,
+		ServiceName: e.sn,
+		Data:        EventData{DeployDecisionData{RequestedBy: pd.RequestedBy, ApprovedBy: actor}},
+	})
+	e.printf("Deploy of %q approved, installing\n", e.sn)
+	cfg := e.installerCfg()
+	cfg.Reason = "approved deploy requested by " + actorOrUnknown(pd.RequestedBy)
+	cfg.skipApproval = true
+	si, err := e.s.NewInstaller(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create installer: %w", err)
+	}
+	si.NewCmd = e.newCmd
+	if pd.Gen == 0 {
+		return si.Install()
+	}
+	return si.InstallGen(pd.Gen)
+}
+
+// clearPendingDeploy drops the pending deploy of the service.
+func (e *ttyExecer) clearPendingDeploy() {
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		s.PendingDeploy = nil
+		return nil
+	}); err != nil {
+		log.Printf("failed to clear pending deploy of %q: %v", e.sn, err)
+	}
+}
+
+func actorOrUnknown(a string) string {
+	if a == "" {
+		return "unknown"
+	}
+	return a
+}
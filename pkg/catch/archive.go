@@ -0,0 +1,197 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"tailscale.com/util/mak"
+)
+
+// archiveRetention is how long removed services are kept in the archive
+// before they are purged.
+const archiveRetention = 7 * 24 * time.Hour
+
+// archivedServiceFile is the name of the file in an archive directory holding
+// the service's DB entry.
+const archivedServiceFile = "service.json"
+
+// ArchivedService is a removed service that can still be restored.
+type ArchivedService struct {
+	Name       string
+	ArchivedAt time.Time
+	Dir        string
+}
+
+func (s *Server) archiveRoot() string {
+	return filepath.Join(s.cfg.RootDir, "archive")
+}
+
+// newServiceArchive creates a new archive directory for the service and saves
+// its DB entry into it. It also purges expired archives.
+func (s *Server) newServiceArchive(name string) (string, error) {
+	s.purgeExpiredArchives(false)
+	dir := filepath.Join(s.archiveRoot(), fmt.Sprintf("%s-%d", name, time.Now().Unix()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if sv, err := s.serviceView(name); err == nil {
+		b, err := json.MarshalIndent(sv.AsStruct(), "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal service: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, archivedServiceFile), b, 0600); err != nil {
+			return "", fmt.Errorf("failed to archive service config: %w", err)
+		}
+	}
+	return dir, nil
+}
+
+// ArchivedServices returns the archived services, newest first. If name is
+// non-empty only archives of that service are returned.
+func (s *Server) ArchivedServices(name string) ([]ArchivedService, error) {
+	ents, err := os.ReadDir(s.archiveRoot())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	var out []ArchivedService
+	for _, ent := range ents {
+		i := strings.LastIndexByte(ent.Name(), '-')
+		if !ent.IsDir() || i < 0 {
+			continue
+		}
+		ts, err := strconv.ParseInt(ent.Name()[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		as := ArchivedService{
+			Name:       ent.Name()[:i],
+			ArchivedAt: time.Unix(ts, 0),
+			Dir:        filepath.Join(s.archiveRoot(), ent.Name()),
+		}
+		if name != "" && as.Name != name {
+			continue
+		}
+		out = append(out, as)
+	}
+	slices.SortFunc(out, func(a, b ArchivedService) int {
+		return b.ArchivedAt.Compare(a.ArchivedAt)
+	})
+	return out, nil
+}
+
+// UndeleteService restores the most recently archived version of the named
+// service and returns its restored config. The service must not exist.
+func (s *Server) UndeleteService(name string) (*db.Service, error) {
+	if _, err := s.serviceView(name); err == nil {
+		return nil, fmt.Errorf("service %q already exists", name)
+	} else if !errors.Is(err, errServiceNotFound) {
+		return nil, err
+	}
+	archives, err := s.ArchivedServices(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("no archive found for service %q", name)
+	}
+	as := archives[0]
+
+	b, err := os.ReadFile(filepath.Join(as.Dir, archivedServiceFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived service config: %w", err)
+	}
+	var sv db.Service
+	if err := json.Unmarshal(b, &sv); err != nil {
+		return nil, fmt.Errorf("failed to parse archived service config: %w", err)
+	}
+
+	ents, err := os.ReadDir(as.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if err := os.MkdirAll(s.serviceRootDir(name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create service directory: %w", err)
+	}
+	for _, ent := range ents {
+		if ent.Name() == archivedServiceFile {
+			continue
+		}
+		dst := filepath.Join(s.serviceRootDir(name), ent.Name())
+		if _, err := os.Stat(dst); err == nil {
+			return nil, fmt.Errorf("cannot restore %q: already exists", dst)
+		}
+		if err := os.Rename(filepath.Join(as.Dir, ent.Name()), dst); err != nil {
+			return nil, fmt.Errorf("failed to restore %q: %w", dst, err)
+		}
+	}
+	if _, err := s.cfg.DB.MutateData(func(d *db.Data) error {
+		mak.Set(&d.Services, name, &sv)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to restore service config: %w", err)
+	}
+	if err := os.RemoveAll(as.Dir); err != nil {
+		log.Printf("failed to remove archive %q: %v", as.Dir, err)
+	}
+	return &sv, nil
+}
+
+// purgeExpiredArchives deletes archives older than archiveRetention, along
+// with the tailscale devices of the archived services. It returns the
+// archives purged; with dryRun nothing is deleted.
+func (s *Server) purgeExpiredArchives(dryRun bool) []ArchivedService {
+	archives, err := s.ArchivedServices("")
+	if err != nil {
+		log.Printf("failed to list archived services: %v", err)
+		return nil
+	}
+	var purged []ArchivedService
+	for _, as := range archives {
+		if time.Since(as.ArchivedAt) < archiveRetention {
+			continue
+		}
+		purged = append(purged, as)
+		if dryRun {
+			continue
+		}
+		if b, err := os.ReadFile(filepath.Join(as.Dir, archivedServiceFile)); err == nil {
+			var sv db.Service
+			if err := json.Unmarshal(b, &sv); err == nil {
+				if err := s.deleteTSDevice(sv.TSNet.View()); err != nil {
+					log.Printf("failed to delete tailscale device of archived %q: %v", as.Name, err)
+				}
+			}
+		}
+		log.Printf("purging archived service %q from %v", as.Name, as.ArchivedAt)
+		if err := os.RemoveAll(as.Dir); err != nil {
+			log.Printf("failed to purge archive %q: %v", as.Dir, err)
+		}
+	}
+	return purged
+}
@@ -0,0 +1,89 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+)
+
+// This file lets the registry accept ORAS-style OCI artifacts carrying a
+// plain binary (or script) instead of a container image, e.g.
+//
+//	oras push catch:5000/svc/bin:run --artifact-type application/vnd.yeet.binary ./svc
+//
+// The file is installed through the same path as `yeet run`, so CI can use
+// the registry as the deploy trigger for non-container services too.
+
+// binaryArtifactType is the artifact type of artifacts carrying a file to
+// install.
+const binaryArtifactType = "application/vnd.yeet.binary"
+
+// isArtifact reports whether m is an artifact carrying a file to install
+// rather than a container image. Artifacts are typed by binaryArtifactType,
+// either in the artifactType of the manifest with the empty config (OCI 1.1)
+// or in the media type of the config (OCI 1.0, as ORAS falls back to). Other
+// artifacts, such as signatures or SBOMs, are not installed.
+func isArtifact(m *v1.Manifest) bool {
+	return m.ArtifactType == binaryArtifactType || m.Config.MediaType == binaryArtifactType
+}
+
+// artifactLayer returns the layer of m holding the file to install. Artifacts
+// must carry exactly one file.
+func artifactLayer(m *v1.Manifest) (v1.Descriptor, error) {
+	if len(m.Layers) != 1 {
+		return v1.Descriptor{}, fmt.Errorf("artifact must have exactly one layer, got %d", len(m.Layers))
+	}
+	return m.Layers[0], nil
+}
+
+// installArtifactService installs the file carried by artifact manifest m as
+// service sn, staging it unless install is set.
+func (cr *containerRegistry) installArtifactService(sn, actor string, m *v1.Manifest, install bool) error {
+	l, err := artifactLayer(m)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(cr.blobPath(l.Digest))
+	if err != nil {
+		return fmt.Errorf("failed to open artifact blob: %w", err)
+	}
+	defer f.Close()
+
+	inst, err := NewFileInstaller(cr.s, FileInstallerCfg{
+		InstallerCfg: InstallerCfg{
+			ServiceName:     sn,
+			ClientOut:       io.Discard,
+			Printer:         log.Printf,
+			Actor:           actor,
+			BackgroundWatch: true,
+		},
+		StageOnly: !install,
+		FromImage: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create installer: %w", err)
+	}
+	if _, err := io.Copy(inst, f); err != nil {
+		inst.Fail()
+		inst.Close()
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	return inst.Close()
+}
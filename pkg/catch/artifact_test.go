@@ -0,0 +1,44 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"testing"
+
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestIsArtifact(t *testing.T) {
+	tests := []struct {
+		name         string
+		artifactType string
+		config       types.MediaType
+		want         bool
+	}{
+		{"image", "", types.OCIConfigJSON, false},
+		{"docker image", "", types.DockerConfigJSON, false},
+		{"binary", binaryArtifactType, "application/vnd.oci.empty.v1+json", true},
+		{"binary oci 1.0", "", binaryArtifactType, true},
+		{"signature", "", "application/vnd.dev.cosign.simplesigning.v1+json", false},
+		{"sbom", "application/spdx+json", "application/vnd.oci.empty.v1+json", false},
+	}
+	for _, tt := range tests {
+		m := &v1.Manifest{ArtifactType: tt.artifactType, Config: v1.Descriptor{MediaType: tt.config}}
+		if got := isArtifact(m); got != tt.want {
+			t.Errorf("%s: isArtifact = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
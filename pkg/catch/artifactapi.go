@@ -0,0 +1,143 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// ArtifactData is the response of the artifact preview API.
+type ArtifactData struct {
+	Service  string    `json:"service"`
+	Artifact string    `json:"artifact"`
+	Ref      string    `json:"ref"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	// Content is the content of the artifact. It is omitted for binary
+	// artifacts and for those that may hold credentials.
+	Content string `json:"content,omitempty"`
+	// Redacted reports whether values in Content were redacted.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// artifactPreview describes how the content of an artifact is previewed.
+type artifactPreview int
+
+const (
+	previewText artifactPreview = iota
+	previewRedactEnv
+	previewNone
+)
+
+func artifactPreviewOf(name db.ArtifactName) artifactPreview {
+	switch name {
+	case db.ArtifactEnvFile, db.ArtifactTSEnv, db.ArtifactNetNSEnv:
+		return previewRedactEnv
+	case db.ArtifactBinary, db.ArtifactTSBinary, db.ArtifactTSConfig:
+		// The tailscaled config holds the auth key.
+		return previewNone
+	}
+	return previewText
+}
+
+// redactEnv replaces the values in the env file b, keeping keys and comments.
+func redactEnv(b []byte) string {
+	var out strings.Builder
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		if k, _, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(trimmed, "#") {
+			line = k + "=<redacted>"
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+// handleArtifact serves the content and metadata of an artifact of a service
+// at the generation given by the gen query parameter, which is a number,
+// "staged" or "latest" (the default).
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	sn := r.PathValue("name")
+	name := db.ArtifactName(r.PathValue("artifact"))
+	ref := db.ArtifactRef("latest")
+	if gen := r.URL.Query().Get("gen"); gen != "" {
+		if n, err := strconv.Atoi(gen); err == nil {
+			ref = db.Gen(n)
+		} else if gen == "staged" || gen == "latest" {
+			ref = db.ArtifactRef(gen)
+		} else {
+			http.Error(w, "invalid gen", http.StatusBadRequest)
+			return
+		}
+	}
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		if errors.Is(err, errServiceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	a, ok := sv.AsStruct().Artifacts[name]
+	if !ok {
+		http.Error(w, "artifact not found", http.StatusNotFound)
+		return
+	}
+	p, ok := a.Refs[ref]
+	if !ok {
+		http.Error(w, "artifact not found at "+string(ref), http.StatusNotFound)
+		return
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ad := ArtifactData{
+		Service:  sn,
+		Artifact: string(name),
+		Ref:      string(ref),
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+	}
+	if pv := artifactPreviewOf(name); pv != previewNone {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if pv == previewRedactEnv {
+			ad.Content, ad.Redacted = redactEnv(b), true
+		} else {
+			ad.Content = string(b)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ad)
+}
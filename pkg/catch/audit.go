@@ -0,0 +1,235 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// The audit trail records who installed, rolled back and removed each
+// service. It is kept as one JSON lines file per service in the audit
+// directory under the root directory, outside the service directory, so
+// that it outlives the removal of the service.
+
+// Actions recorded in the audit trail.
+const (
+	AuditActionInstall      = "install"
+	AuditActionRollback     = "rollback"
+	AuditActionAutoRollback = "auto-rollback"
+	AuditActionUndelete     = "undelete"
+	AuditActionRemove       = "remove"
+	AuditActionAdopt        = "adopt"
+	AuditActionConvert      = "convert"
+)
+
+// AuditEntry is an entry of the audit trail of a service.
+type AuditEntry struct {
+	// Time is when the action was taken in milliseconds since the epoch.
+	Time        int64  `json:"time"`
+	ServiceName string `json:"serviceName"`
+	Action      string `json:"action"`
+	// Actor is the Tailscale identity of who took the action, if known.
+	Actor string `json:"actor,omitempty"`
+	// User is the SSH user the action was requested as, if any.
+	User string `json:"user,omitempty"`
+	// Generation is the generation installed by the action.
+	Generation int    `json:"generation,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	// Error is why the action failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+func (s *Server) auditDir() string {
+	return filepath.Join(s.cfg.RootDir, "audit")
+}
+
+// recordAudit appends ae to the audit trail of its service. Failures are
+// logged but not returned, as the action itself already happened.
+func (s *Server) recordAudit(ae AuditEntry) {
+	if ae.Time == 0 {
+		ae.Time = time.Now().UnixMilli()
+	}
+	b, err := json.Marshal(ae)
+	if err != nil {
+		log.Printf("failed to marshal audit entry: %v", err)
+		return
+	}
+	b = append(b, '\n')
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	if err := os.MkdirAll(s.auditDir(), 0700); err != nil {
+		log.Printf("failed to create audit dir: %v", err)
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(s.auditDir(), ae.ServiceName+".log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Printf("failed to open audit trail of %q: %v", ae.ServiceName, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		log.Printf("failed to write audit trail of %q: %v", ae.ServiceName, err)
+	}
+}
+
+// auditTrail returns the audit entries of service sn, or of all services if
+// sn is empty or the system service, that are at or after since, oldest
+// first.
+func (s *Server) auditTrail(sn string, since time.Time) ([]AuditEntry, error) {
+	var paths []string
+	if sn == "" || sn == SystemService {
+		des, err := os.ReadDir(s.auditDir())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read audit dir: %w", err)
+		}
+		for _, de := range des {
+			if strings.HasSuffix(de.Name(), ".log") {
+				paths = append(paths, filepath.Join(s.auditDir(), de.Name()))
+			}
+		}
+	} else {
+		paths = []string{filepath.Join(s.auditDir(), sn+".log")}
+	}
+	var entries []AuditEntry
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to open audit trail: %w", err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var ae AuditEntry
+			if err := json.Unmarshal(sc.Bytes(), &ae); err != nil {
+				continue
+			}
+			if since.IsZero() || ae.Time >= since.UnixMilli() {
+				entries = append(entries, ae)
+			}
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit trail: %w", err)
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b AuditEntry) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+	return entries, nil
+}
+
+// audit records the outcome of installing generation gen in the audit
+// trail, attributed to the actor and user of the installer config.
+func (si *Installer) audit(gen int, err error) {
+	ae := AuditEntry{
+		ServiceName: si.icfg.ServiceName,
+		Action:      cmp.Or(si.icfg.Action, AuditActionInstall),
+		Actor:       si.icfg.Actor,
+		User:        si.icfg.User,
+		Generation:  gen,
+		Reason:      si.icfg.Reason,
+	}
+	if err != nil {
+		ae.Error = err.Error()
+	}
+	si.s.recordAudit(ae)
+}
+
+func (e *ttyExecer) auditCmdFunc(cmd *cobra.Command, _ []string) error {
+	formatOut, _ := cmd.Flags().GetString("format")
+	sinceStr, _ := cmd.Flags().GetString("since")
+	since, err := parseLogTime(sinceStr, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	entries, err := e.s.auditTrail(e.sn, since)
+	if err != nil {
+		return err
+	}
+	return writeAudit(cmd.OutOrStdout(), formatOut, entries)
+}
+
+// writeAudit writes entries to w in format, one of table, json or
+// json-pretty.
+func writeAudit(w io.Writer, format string, entries []AuditEntry) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(entries)
+	case "json-pretty":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "table":
+	default:
+		return fmt.Errorf("unknown format %q, use table, json or json-pretty", format)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSERVICE\tACTION\tGEN\tACTOR\tUSER\tRESULT")
+	for _, ae := range entries {
+		gen := "-"
+		if ae.Generation > 0 {
+			gen = fmt.Sprint(ae.Generation)
+		}
+		result := "ok"
+		if ae.Error != "" {
+			result = "failed: " + ae.Error
+		}
+		if ae.Reason != "" {
+			result += " (" + ae.Reason + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			time.UnixMilli(ae.Time).Format(time.DateTime), ae.ServiceName, ae.Action, gen,
+			actorOrUnknown(ae.Actor), cmp.Or(ae.User, "-"), result)
+	}
+	return tw.Flush()
+}
+
+// handleAudit serves the audit trail of the service in the service query
+// parameter, or of all services if it is empty. The since parameter limits
+// it to entries since a time, either a duration ago like "24h" or a
+// timestamp.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since, err := parseLogTime(q.Get("since"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+		return
+	}
+	entries, err := s.auditTrail(q.Get("service"), since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
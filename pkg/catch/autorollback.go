@@ -0,0 +1,229 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"tailscale.com/util/set"
+)
+
+// After a deploy, catch watches the service for a grace period. If it
+// crash-loops or exits in that time, the previous generation is installed
+// again.
+
+// defaultRollbackGrace is how long a deploy is watched for crashes when
+// InstallerCfg.RollbackGrace is not set.
+const defaultRollbackGrace = 10 * time.Second
+
+// errDeployRolledBack is returned by Install when the new generation failed
+// and the previous one was installed again.
+var errDeployRolledBack = fmt.Errorf("deploy rolled back")
+
+// watchDeploy watches the generation just installed by si for the grace
+// period and rolls back to prevGen if it fails. It returns nil if the
+// service stayed up.
+func (si *Installer) watchDeploy(prevGen int) error {
+	sn := si.icfg.ServiceName
+	if si.icfg.NoAutoRollback || prevGen == 0 || sn == CatchService {
+		return nil
+	}
+	sv, err := si.s.serviceView(sn)
+	if err != nil || sv.NoAutoRollback() {
+		return nil
+	}
+	if _, ok := sv.AsStruct().Artifacts.Gen(db.ArtifactSystemdTimerFile, sv.Generation()); ok {
+		// Cron services are not expected to stay up.
+		return nil
+	}
+	grace := cmp.Or(si.icfg.RollbackGrace, defaultRollbackGrace)
+	si.printf("Watching %q for %v\n", sn, grace)
+	reason := si.s.watchForCrash(sn, sv.ServiceType(), grace)
+	if reason == "" {
+		return nil
+	}
+	newGen := sv.Generation()
+	si.printf("Generation %d %s; rolling back to generation %d\n", newGen, reason, prevGen)
+	log.Printf("Deploy of %q generation %d %s; rolling back to %d", sn, newGen, reason, prevGen)
+	si.phases.fail(fmt.Errorf("generation %d %s", newGen, reason))
+	// The rollback is not part of the timeline of the failed deploy.
+	si.phases = nil
+	si.icfg.Action = AuditActionAutoRollback
+	si.icfg.Reason = fmt.Sprintf("generation %d %s", newGen, reason)
+	// prevGen was running before the deploy, so it doesn't need approval.
+	si.icfg.skipApproval = true
+	// Don't roll back a deploy made while watching.
+	si.icfg.IfGeneration = &newGen
+	if err := si.InstallGen(prevGen); err != nil {
+		return fmt.Errorf("generation %d %s and rollback to %d failed: %w", newGen, reason, prevGen, err)
+	}
+	si.s.PublishEvent(Event{
+		Type:        EventTypeServiceRollback,
+		ServiceName: sn,
+		Data: EventData{ServiceRollbackData{
+			FromGeneration: newGen,
+			ToGeneration:   prevGen,
+			Reason:         reason,
+		}},
+	})
+	return fmt.Errorf("%w: generation %d %s, generation %d is running again", errDeployRolledBack, newGen, reason, prevGen)
+}
+
+// watchForCrash polls service sn of type st until grace has passed. It
+// returns why the service is considered failed, or "" if it stayed up.
+func (s *Server) watchForCrash(sn string, st db.ServiceType, grace time.Duration) string {
+	restarts, _ := s.restartCounts(sn, st)
+	before := componentState{
+		restarts: restarts,
+		running:  s.runningComponents(sn, st),
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.After(grace)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return ""
+		case <-deadline:
+			return s.crashReason(sn, st, before)
+		case <-ticker.C:
+			if r := s.crashReason(sn, st, before); r != "" {
+				return r
+			}
+		}
+	}
+}
+
+// componentState is the state of the components of a service that crash
+// detection compares.
+type componentState struct {
+	// restarts is the restart count of each component.
+	restarts map[string]int
+	// running is the set of running components of a docker compose
+	// service, or nil if unknown or for other service types.
+	running set.Set[string]
+	// stopped is whether a systemd service is stopped.
+	stopped bool
+}
+
+// crashReason returns why service sn is considered failed, or "" if it is
+// up. before is the state of sn right after the deploy.
+func (s *Server) crashReason(sn string, st db.ServiceType, before componentState) string {
+	counts, err := s.restartCounts(sn, st)
+	if err != nil {
+		// Don't roll back on errors of our own.
+		log.Printf("failed to check %q for crashes: %v", sn, err)
+		return ""
+	}
+	now := componentState{restarts: counts}
+	if st == db.ServiceTypeSystemd {
+		status, err := s.SystemdStatus(sn)
+		now.stopped = err == nil && status == svc.StatusStopped
+	} else {
+		now.running = s.runningComponents(sn, st)
+	}
+	return detectCrash(sn, st, before, now)
+}
+
+// detectCrash returns why service sn is considered failed given its state
+// before, right after the deploy, and now, or "" if it is up. Components
+// that were not running before, like one-off init containers, may exit.
+func detectCrash(sn string, st db.ServiceType, before, now componentState) string {
+	for c, n := range now.restarts {
+		if n > before.restarts[c] {
+			return componentFailure(sn, c, "is crash-looping")
+		}
+	}
+	if st == db.ServiceTypeSystemd {
+		// A systemd service is restarted by the deploy, so it should be
+		// running whether or not it was when watching started.
+		if now.stopped {
+			return "exited"
+		}
+		return ""
+	}
+	if now.running == nil {
+		return ""
+	}
+	for c := range before.running {
+		if !now.running.Contains(c) {
+			return componentFailure(sn, c, "exited")
+		}
+	}
+	return ""
+}
+
+// componentFailure describes failure of component c of service sn.
+func componentFailure(sn, c, failure string) string {
+	if c == sn {
+		return failure
+	}
+	return fmt.Sprintf("%s (container %s)", failure, c)
+}
+
+// runningComponents returns the components of docker compose service sn
+// that are running. It returns nil for other service types.
+func (s *Server) runningComponents(sn string, st db.ServiceType) set.Set[string] {
+	if st != db.ServiceTypeDockerCompose {
+		return nil
+	}
+	statuses, err := s.DockerComposeStatus(sn)
+	if err != nil {
+		return nil
+	}
+	running := make(set.Set[string])
+	for c, status := range statuses {
+		if status == svc.StatusRunning {
+			running.Add(c)
+		}
+	}
+	return running
+}
+
+// restartCounts returns the restart count of each component of service sn.
+func (s *Server) restartCounts(sn string, st db.ServiceType) (map[string]int, error) {
+	switch st {
+	case db.ServiceTypeSystemd:
+		service, err := s.systemdService(sn)
+		if err != nil {
+			return nil, err
+		}
+		ri, err := service.RuntimeInfo()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{sn: ri.Restarts}, nil
+	case db.ServiceTypeDockerCompose:
+		service, err := s.dockerComposeService(sn)
+		if err != nil {
+			return nil, err
+		}
+		infos, err := service.RuntimeInfos()
+		if err != nil {
+			return nil, err
+		}
+		counts := make(map[string]int, len(infos))
+		for c, ri := range infos {
+			counts[c] = ri.Restarts
+		}
+		return counts, nil
+	}
+	return nil, nil
+}
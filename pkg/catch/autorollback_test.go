@@ -0,0 +1,147 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"tailscale.com/util/set"
+)
+
+func TestDetectCrash(t *testing.T) {
+	compose := db.ServiceTypeDockerCompose
+	systemd := db.ServiceTypeSystemd
+	tests := []struct {
+		name   string
+		st     db.ServiceType
+		before componentState
+		now    componentState
+		want   string
+	}{
+		{
+			name:   "systemd-up",
+			st:     systemd,
+			before: componentState{restarts: map[string]int{"web": 2}},
+			now:    componentState{restarts: map[string]int{"web": 2}},
+		},
+		{
+			name:   "systemd-restarted",
+			st:     systemd,
+			before: componentState{restarts: map[string]int{"web": 2}},
+			now:    componentState{restarts: map[string]int{"web": 3}},
+			want:   "is crash-looping",
+		},
+		{
+			name:   "systemd-stopped",
+			st:     systemd,
+			before: componentState{restarts: map[string]int{"web": 0}},
+			now:    componentState{restarts: map[string]int{"web": 0}, stopped: true},
+			want:   "exited",
+		},
+		{
+			name: "compose-up",
+			st:   compose,
+			before: componentState{
+				restarts: map[string]int{"app": 0, "db": 1},
+				running:  set.Of("app", "db"),
+			},
+			now: componentState{
+				restarts: map[string]int{"app": 0, "db": 1},
+				running:  set.Of("app", "db"),
+			},
+		},
+		{
+			name: "compose-container-restarted",
+			st:   compose,
+			before: componentState{
+				restarts: map[string]int{"app": 0, "db": 1},
+				running:  set.Of("app", "db"),
+			},
+			now: componentState{
+				restarts: map[string]int{"app": 0, "db": 2},
+				running:  set.Of("app", "db"),
+			},
+			want: "is crash-looping (container db)",
+		},
+		{
+			name: "compose-new-container-restarted",
+			st:   compose,
+			before: componentState{
+				restarts: map[string]int{"app": 0},
+				running:  set.Of("app"),
+			},
+			now: componentState{
+				restarts: map[string]int{"app": 0, "worker": 1},
+				running:  set.Of("app", "worker"),
+			},
+			want: "is crash-looping (container worker)",
+		},
+		{
+			name: "compose-container-exited",
+			st:   compose,
+			before: componentState{
+				restarts: map[string]int{"app": 0, "db": 0},
+				running:  set.Of("app", "db"),
+			},
+			now: componentState{
+				restarts: map[string]int{"app": 0, "db": 0},
+				running:  set.Of("db"),
+			},
+			want: "exited (container app)",
+		},
+		{
+			name: "compose-init-container-exited",
+			st:   compose,
+			before: componentState{
+				restarts: map[string]int{"app": 0, "migrate": 0},
+				running:  set.Of("app"),
+			},
+			now: componentState{
+				restarts: map[string]int{"app": 0, "migrate": 0},
+				running:  set.Of("app"),
+			},
+		},
+		{
+			name: "compose-status-unknown",
+			st:   compose,
+			before: componentState{
+				restarts: map[string]int{"app": 0},
+				running:  set.Of("app"),
+			},
+			now: componentState{restarts: map[string]int{"app": 0}},
+		},
+		{
+			name: "compose-single-component",
+			st:   compose,
+			before: componentState{
+				restarts: map[string]int{"web": 0},
+				running:  set.Of("web"),
+			},
+			now: componentState{
+				restarts: map[string]int{"web": 0},
+				running:  set.Set[string]{},
+			},
+			want: "exited",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectCrash("web", tt.st, tt.before, tt.now); got != tt.want {
+				t.Errorf("detectCrash = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
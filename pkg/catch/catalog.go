@@ -0,0 +1,194 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+// CatalogEntry is a service as listed by the catalog, on
+// /api/v0/catalog and `yeet ls`.
+type CatalogEntry struct {
+	Name        string            `json:"name"`
+	ServiceType string            `json:"serviceType"`
+	Generation  int               `json:"generation"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// catalogFilter selects services of the catalog.
+type catalogFilter struct {
+	// Labels are "key=value" selectors the labels of a service must all
+	// match; a bare "key" matches any value.
+	Labels []string
+	// Search, if set, must be contained in the name, description or owner
+	// of a service, ignoring case.
+	Search string
+}
+
+func (f catalogFilter) match(sv db.ServiceView) bool {
+	for _, sel := range f.Labels {
+		k, v, hasValue := strings.Cut(sel, "=")
+		got, ok := sv.Labels().GetOk(k)
+		if !ok || hasValue && got != v {
+			return false
+		}
+	}
+	if f.Search == "" {
+		return true
+	}
+	q := strings.ToLower(f.Search)
+	for _, s := range []string{sv.Name(), sv.Description(), sv.Owner()} {
+		if strings.Contains(strings.ToLower(s), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalog returns the services matching f, sorted by name.
+func (s *Server) catalog(f catalogFilter) ([]CatalogEntry, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	entries := []CatalogEntry{}
+	for name, sv := range dv.Services().All() {
+		if !f.match(sv) {
+			continue
+		}
+		entries = append(entries, CatalogEntry{
+			Name:        name,
+			ServiceType: string(sv.ServiceType()),
+			Generation:  sv.Generation(),
+			Description: sv.Description(),
+			Owner:       sv.Owner(),
+			Labels:      sv.Labels().AsMap(),
+		})
+	}
+	slices.SortFunc(entries, func(a, b CatalogEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return entries, nil
+}
+
+// handleCatalog serves the services matching the label and q query
+// parameters, e.g. /api/v0/catalog?label=team=infra&q=db.
+func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.catalog(catalogFilter{
+		Labels: r.URL.Query()["label"],
+		Search: r.URL.Query().Get("q"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// lsCmdFunc lists the services of the catalog.
+func (e *ttyExecer) lsCmdFunc(cmd *cobra.Command, _ []string) error {
+	labels, _ := cmd.Flags().GetStringArray("label")
+	search, _ := cmd.Flags().GetString("search")
+	entries, err := e.s.catalog(catalogFilter{Labels: labels, Search: search})
+	if err != nil {
+		return err
+	}
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return json.NewEncoder(e.rw).Encode(entries)
+	}
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "SERVICE\tTYPE\tOWNER\tLABELS\tDESCRIPTION\t")
+	for _, ce := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", ce.Name, orDash(ce.ServiceType), orDash(ce.Owner), orDash(formatLabels(ce.Labels)), ce.Description)
+	}
+	return nil
+}
+
+// formatLabels formats labels as sorted, comma separated key=value pairs.
+func formatLabels(labels map[string]string) string {
+	var out []string
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		out = append(out, k+"="+labels[k])
+	}
+	return strings.Join(out, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// labelCmdFunc shows or changes the labels, description and owner of the
+// service. Arguments are key=value to set a label or key- to remove it.
+func (e *ttyExecer) labelCmdFunc(cmd *cobra.Command, args []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot label %q", e.sn)
+	}
+	if _, err := e.s.serviceView(e.sn); err != nil {
+		return err
+	}
+	if len(args) > 0 || cmd.Flags().Changed("description") || cmd.Flags().Changed("owner") {
+		for _, a := range args {
+			if k, ok := strings.CutSuffix(a, "-"); ok && k != "" && !strings.Contains(k, "=") {
+				continue
+			}
+			if k, _, ok := strings.Cut(a, "="); !ok || k == "" {
+				return fmt.Errorf("invalid label %q, expected key=value or key-", a)
+			}
+		}
+		if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+			for _, a := range args {
+				if k, v, ok := strings.Cut(a, "="); ok {
+					if s.Labels == nil {
+						s.Labels = map[string]string{}
+					}
+					s.Labels[k] = v
+				} else {
+					delete(s.Labels, strings.TrimSuffix(a, "-"))
+				}
+			}
+			if cmd.Flags().Changed("description") {
+				s.Description, _ = cmd.Flags().GetString("description")
+			}
+			if cmd.Flags().Changed("owner") {
+				s.Owner, _ = cmd.Flags().GetString("owner")
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to update service: %w", err)
+		}
+	}
+	sv, err := e.s.serviceView(e.sn)
+	if err != nil {
+		return err
+	}
+	e.printf("labels: %s\nowner: %s\ndescription: %s\n", orDash(formatLabels(sv.Labels().AsMap())), orDash(sv.Owner()), orDash(sv.Description()))
+	return nil
+}
@@ -30,6 +30,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yeetrun/yeet/pkg/db"
@@ -66,17 +67,49 @@ type Server struct {
 	eventListeners struct {
 		mu sync.Mutex
 		s  set.HandleSet[*EventListener]
+
+		// recent are the last eventHistorySize events other than
+		// heartbeats, oldest first, for listeners to replay.
+		recent []Event
+
+		dropped      atomic.Int64 // events dropped for slow listeners
+		disconnected atomic.Int64 // listeners disconnected for being too slow
 	}
 
 	serviceStatus struct {
 		mu sync.Mutex
 		m  map[string]map[string]ComponentStatus // serviceName -> componentName -> ComponentStatus
+
+		watchdogTrips map[string]time.Time    // serviceName -> time of last watchdog trip
+		health        map[string]*healthState // serviceName -> result of its health checks
 	}
-}
 
-type EventListener struct {
-	ch     chan<- Event
-	filter func(Event) bool
+	editLeases struct {
+		mu sync.Mutex
+		m  map[string]*editLease // serviceName -> current edit session
+	}
+
+	motdShown struct {
+		mu sync.Mutex
+		m  map[string]time.Time // client session -> when the banner was shown
+	}
+
+	uploads struct {
+		mu     sync.Mutex
+		active set.Set[string] // part files of resumable uploads in progress
+	}
+
+	// wake is closed to wake the background loops up, see wakeMonitors.
+	wake struct {
+		mu sync.Mutex
+		ch chan struct{}
+	}
+
+	apiCache apiCache
+	eventLog *eventLog
+
+	auditMu sync.Mutex // guards writes to the audit trail
+	shareMu sync.Mutex // guards writes to the share revocations
 }
 
 type EventType string
@@ -89,6 +122,14 @@ const (
 	EventTypeServiceCreated       EventType = "ServiceCreated"
 	EventTypeServiceConfigChanged EventType = "ServiceConfigChanged"
 	EventTypeServiceConfigStaged  EventType = "ServiceConfigStaged"
+	EventTypeServiceAction        EventType = "ServiceAction"
+	EventTypeServiceWatchdog      EventType = "ServiceWatchdog"
+	EventTypeServiceHealthChanged EventType = "ServiceHealthChanged"
+	EventTypeServiceRollback      EventType = "ServiceRollback"
+	EventTypeInstallPhase         EventType = "InstallPhase"
+	EventTypeDeployRequested      EventType = "DeployRequested"
+	EventTypeDeployApproved       EventType = "DeployApproved"
+	EventTypeDeployDenied         EventType = "DeployDenied"
 )
 
 type EventData struct {
@@ -103,7 +144,18 @@ func (m EventData) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m.Data)
 }
 
+// UnmarshalJSON sets m.Data to the decoded value of b, e.g. for events read
+// back from the event log.
+func (m *EventData) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &m.Data)
+}
+
+// Event is a change on the host, published to event listeners. Its JSON
+// encoding follows the versioned schema described by EventSchemaVersion and
+// the Data type of each EventType in eventDataTypes.
 type Event struct {
+	// Version is the EventSchemaVersion of the event.
+	Version int `json:"version"`
 	// Time is the time the event was created in milliseconds since the epoch.
 	Time        int64     `json:"time"`
 	ServiceName string    `json:"serviceName"`
@@ -111,33 +163,6 @@ type Event struct {
 	Data        EventData `json:"data,omitempty"`
 }
 
-func (s *Server) PublishEvent(event Event) {
-	event.Time = time.Now().UnixMilli()
-	els := &s.eventListeners
-	els.mu.Lock()
-	defer els.mu.Unlock()
-	for _, el := range els.s {
-		if el.filter != nil && !el.filter(event) {
-			continue
-		}
-		el.ch <- event
-	}
-}
-
-func (s *Server) AddEventListener(ch chan<- Event, filter func(Event) bool) set.Handle {
-	els := &s.eventListeners
-	els.mu.Lock()
-	defer els.mu.Unlock()
-	return els.s.Add(&EventListener{ch: ch, filter: filter})
-}
-
-func (s *Server) RemoveEventListener(h set.Handle) {
-	els := &s.eventListeners
-	els.mu.Lock()
-	defer els.mu.Unlock()
-	delete(els.s, h)
-}
-
 // Config consists of an `Address` (ip:port) and an `SSHConfig` that is used to
 // configure the SSH server.
 type Config struct {
@@ -151,13 +176,47 @@ type Config struct {
 	ExternalRegistryAddr string
 	RegistryRoot         string
 	LocalClient          *tailscale.LocalClient
+
+	// RegistryMaxBlobSize and RegistryMaxManifestSize cap the size in bytes
+	// of blobs and manifests pushed to the registry.
+	RegistryMaxBlobSize     int64
+	RegistryMaxManifestSize int64
+	// RegistryUploadsPerMin limits the write requests each caller may make
+	// to the registry per minute. Negative disables the limit.
+	RegistryUploadsPerMin int
+
+	// HTTPClient, if set, is used to reach other catch hosts over the
+	// tailnet, e.g. to replicate images.
+	HTTPClient *http.Client
+	// TailnetDial, if set, dials addresses on the tailnet, e.g. for the
+	// self-check to reach the host's own SSH listener.
+	TailnetDial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// ShareAddr, if set, is the public host:port share links are served on
+	// through Tailscale Funnel. Otherwise share links use
+	// ExternalRegistryAddr and only work on the tailnet.
+	ShareAddr string
+
+	// HealthzAuth, if set, requires callers of /healthz to be authorized
+	// like API callers. Otherwise anyone who can reach the web listener can
+	// read it.
+	HealthzAuth bool
+
+	// HeartbeatInterval is how often heartbeat events are published while
+	// a listener wants them. Zero means every second.
+	HeartbeatInterval time.Duration
+	// MonitorInterval is the longest the background loops, e.g. health
+	// checks and scheduled garbage collection, sleep before looking for
+	// work. Zero means a minute.
+	MonitorInterval time.Duration
 }
 
 // NewUnstartedServer creates a new Server instance with the provided
 // configuration but does not start it.
 func NewUnstartedServer(config *Config) *Server {
 	s := &Server{
-		cfg: *config,
+		cfg:      *config,
+		eventLog: newEventLog(config.RootDir),
 	}
 	s.registry = s.newRegistry()
 	return s
@@ -179,6 +238,10 @@ func (s *Server) Start() {
 	s.waitGroup.Go(s.monitorSystemd)
 	s.waitGroup.Go(s.monitorDocker)
 	s.waitGroup.Go(s.heartbeat)
+	s.waitGroup.Go(s.writeEventLog)
+	s.waitGroup.Go(s.gcLoop)
+	s.waitGroup.Go(s.healthLoop)
+	s.waitGroup.Go(s.restoreSecrets)
 	if err := netns.InstallYeetNSService(); err != nil {
 		log.Fatalf("Failed to install bridge service: %v", err)
 	}
@@ -189,25 +252,6 @@ func (s *Server) Shutdown() {
 	s.waitGroup.Wait()
 }
 
-func (s *Server) heartbeat() {
-	ctx := s.ctx
-	// Publish a heartbeat event every second.
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			s.PublishEvent(Event{
-				Type:        EventTypeHeartbeat,
-				ServiceName: "sys",
-			})
-		}
-	}
-}
-
 // ServeSSH starts the server and listens for incoming connections. It blocks
 // until an error occurs.
 func (s *Server) ServeSSH(listener net.Listener) error {
@@ -268,6 +312,25 @@ func (s *Server) verifyCaller(ctx context.Context, remoteAddr string) error {
 	return errUnauthorized
 }
 
+// callerName returns a human-readable name for the caller at remoteAddr: the
+// login name for user-owned nodes, or the node name for tagged nodes. It
+// returns "" if the caller cannot be identified.
+func (s *Server) callerName(ctx context.Context, remoteAddr string) string {
+	if s.cfg.LocalClient == nil || remoteAddr == "" {
+		return ""
+	}
+	who, err := s.cfg.LocalClient.WhoIs(ctx, remoteAddr)
+	if err != nil {
+		log.Printf("failed to get whois for %v: %v", remoteAddr, err)
+		return ""
+	}
+	if who.Node.IsTagged() || who.UserProfile == nil {
+		name, _, _ := strings.Cut(who.Node.Name, ".")
+		return name
+	}
+	return who.UserProfile.LoginName
+}
+
 // handleSSHConnection should be called in a goroutine to handle an incoming SSH
 // connection. It will accept the connection and handle incoming channels.
 func (s *Server) handleSSHConnection(nConn net.Conn) {
@@ -298,6 +361,9 @@ func (s *Server) handleSSHConnection(nConn net.Conn) {
 	for k, v := range gssh.DefaultRequestHandlers {
 		ss.RequestHandlers[k] = v
 	}
+	th := s.newTunnelHandler()
+	ss.RequestHandlers["tcpip-forward"] = th.handleForward
+	ss.RequestHandlers["cancel-tcpip-forward"] = th.handleCancel
 	for k, v := range gssh.DefaultChannelHandlers {
 		ss.ChannelHandlers[k] = v
 	}
@@ -339,6 +405,11 @@ func (s *Server) dockerComposeService(sn string) (*svc.DockerComposeService, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to load service: %v", err)
 	}
+	service.DockerConfig = s.dockerConfigFunc(*d, sv)
+	if service.SecretEnv, err = s.secretEnv(sv); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %v", err)
+	}
+	service.CopyEnvFile = s.installEnvFile
 	return service, nil
 }
 
@@ -352,6 +423,7 @@ func (s *Server) systemdService(sn string) (*svc.SystemdService, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load service: %v", err)
 	}
+	service.CopyEnvFile = s.installEnvFile
 	return service, nil
 }
 
@@ -380,7 +452,7 @@ func (s *Server) serviceView(sn string) (db.ServiceView, error) {
 	return sv, nil
 }
 
-func (s *Server) serviceAndUser(conn gssh.Session) (service, user string, _ error) {
+func (s *Server) serviceAndUser(conn interface{ User() string }) (service, user string, _ error) {
 	if conn.User() == "" {
 		return "", "", fmt.Errorf("empty user")
 	}
@@ -411,6 +483,41 @@ type InstallerCfg struct {
 
 	// SSHSessionCloser is an io.Closer that closes the SSH session.
 	SSHSessionCloser io.Closer `json:"-"`
+
+	// IfGeneration, if set, makes the commit fail unless the service is
+	// currently at this generation. This is used to avoid concurrent deploys
+	// clobbering each other.
+	IfGeneration *int `json:",omitempty"`
+
+	// Actor is who requested the install, if known. It is used to attribute
+	// deploys of protected services and entries of the audit trail.
+	Actor string `json:",omitempty"`
+	// Action is what the install is recorded as in the audit trail. Empty
+	// means AuditActionInstall.
+	Action string `json:",omitempty"`
+	// Reason is recorded in the audit trail along with the install.
+	Reason string `json:",omitempty"`
+
+	// NoAutoRollback, if true, disables rolling back to the previous
+	// generation when the new one crashes right after the deploy, like
+	// db.Service.NoAutoRollback does for every deploy of the service.
+	NoAutoRollback bool `json:",omitempty"`
+	// BackgroundWatch, if true, makes Install return right after the deploy
+	// and watch the new generation for crashes in the background, for
+	// installs nobody waits on like those of registry pushes.
+	BackgroundWatch bool `json:"-"`
+	// RollbackGrace is how long the service is watched for crashes after a
+	// deploy. Zero means defaultRollbackGrace.
+	RollbackGrace time.Duration `json:",omitempty"`
+
+	// skipApproval, if true, installs protected services without holding
+	// the deploy for approval: for approved deploys and for rollbacks to
+	// the generation that was running before a failed deploy.
+	skipApproval bool
+	// checkBase, if set, is called with the service when the install is
+	// staged and fails it if it returns an error, for edits that must not
+	// overwrite concurrent changes.
+	checkBase func(*db.Service) error
 }
 
 // serviceRootDir returns the root directory for the given service name.
@@ -426,46 +533,121 @@ func (s *Server) serviceRunDir(sn string) string {
 	return filepath.Join(s.serviceRootDir(sn), "run")
 }
 
+// serviceDataDir returns the data directory for the given service name. This
+// is the DataDir recorded in the service config, if any, or the data dir
+// under the service root otherwise.
 func (s *Server) serviceDataDir(sn string) string {
+	if sv, err := s.serviceView(sn); err == nil && sv.DataDir() != "" {
+		return sv.DataDir()
+	}
 	return filepath.Join(s.serviceRootDir(sn), "data")
 }
 
+// stagedDataDir returns the data directory the staged generation of service
+// sn is installed with: its StagedDataDir if it has one, or its current data
+// directory otherwise.
+func (s *Server) stagedDataDir(sn string) string {
+	if sv, err := s.serviceView(sn); err == nil && sv.StagedDataDir() != "" {
+		return sv.StagedDataDir()
+	}
+	return s.serviceDataDir(sn)
+}
+
+// systemDataDirs are the directories that can't be the data directory of a
+// service, as they are not dedicated to it: ensureDirs would chown them to
+// the service user.
+var systemDataDirs = set.Of(
+	"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib32", "/lib64",
+	"/media", "/mnt", "/opt", "/proc", "/root", "/run", "/sbin", "/srv", "/sys",
+	"/tmp", "/usr", "/usr/bin", "/usr/lib", "/usr/local", "/usr/sbin",
+	"/usr/share", "/var", "/var/lib", "/var/log", "/var/run", "/var/tmp",
+)
+
+// checkDataDir validates dir as the data directory of a service and returns
+// it cleaned. It must be a directory dedicated to the service, not a system
+// directory, a home directory or one holding catch's own data. Its parent
+// must already exist, so that pointing at an unmounted volume fails instead
+// of silently writing to the root filesystem.
+func (s *Server) checkDataDir(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("data dir %q must be an absolute path", dir)
+	}
+	dir = filepath.Clean(dir)
+	if systemDataDirs.Contains(dir) || filepath.Dir(dir) == "/home" {
+		return "", fmt.Errorf("invalid data dir %q: not a dedicated directory", dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil && dir == filepath.Clean(home) {
+		return "", fmt.Errorf("invalid data dir %q: not a dedicated directory", dir)
+	}
+	for _, root := range []string{s.cfg.RootDir, s.cfg.ServicesRoot, s.cfg.MountsRoot, s.cfg.RegistryRoot} {
+		if root == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, root); err == nil && (rel == "." || filepath.IsLocal(rel)) {
+			return "", fmt.Errorf("invalid data dir %q: it holds catch's data in %s", dir, root)
+		}
+	}
+	if st, err := os.Stat(filepath.Dir(dir)); err != nil {
+		return "", fmt.Errorf("invalid data dir %q: %w", dir, err)
+	} else if !st.IsDir() {
+		return "", fmt.Errorf("invalid data dir %q: parent is not a directory", dir)
+	}
+	if st, err := os.Stat(dir); err == nil && !st.IsDir() {
+		return "", fmt.Errorf("invalid data dir %q: not a directory", dir)
+	}
+	return dir, nil
+}
+
 func (s *Server) serviceEnvDir(sn string) string {
 	return filepath.Join(s.serviceRootDir(sn), "env")
 }
 
 func (s *Server) ensureDirs(sn, uname string) error {
 	// Ensure bin and data directories exist.
-	for _, dir := range []string{
+	dirs := []string{
 		s.serviceBinDir(sn),
 		s.serviceDataDir(sn),
 		s.serviceEnvDir(sn),
 		s.serviceRunDir(sn),
-	} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create bin directory: %w", err)
-		}
-		if uname != "" && uname != "root" {
-			u, err := user.Lookup(uname)
-			if err != nil {
-				return fmt.Errorf("failed to lookup user: %w", err)
-			}
-			uid, err := strconv.Atoi(u.Uid)
-			if err != nil {
-				return fmt.Errorf("failed to convert uid to int: %w", err)
-			}
-			gid, err := strconv.Atoi(u.Gid)
-			if err != nil {
-				return fmt.Errorf("failed to convert gid to int: %w", err)
-			}
-			if err := os.Chown(dir, uid, gid); err != nil {
-				return fmt.Errorf("failed to chown directory: %w", err)
-			}
+	}
+	if dir := s.stagedDataDir(sn); dir != dirs[1] {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		if err := s.ensureDir(dir, uname); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// ensureDir creates dir if needed and chowns it to user uname, unless that
+// is empty or root.
+func (s *Server) ensureDir(dir, uname string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create bin directory: %w", err)
+	}
+	if uname == "" || uname == "root" {
+		return nil
+	}
+	u, err := user.Lookup(uname)
+	if err != nil {
+		return fmt.Errorf("failed to lookup user: %w", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("failed to convert uid to int: %w", err)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("failed to convert gid to int: %w", err)
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return fmt.Errorf("failed to chown directory: %w", err)
+	}
+	return nil
+}
+
 var errNoServiceConfigured = fmt.Errorf("no service configured")
 
 // serviceType returns the type of service for the given service name.
@@ -523,13 +705,51 @@ func (s *Server) DockerComposeStatuses() (map[string]svc.DockerComposeStatus, er
 // SystemdStatus returns the status of the service with the given name.
 // Possible statuses are svc.StatusRunning, svc.StatusStopped, and svc.StatusUnknown.
 func (s *Server) SystemdStatus(ns string) (svc.Status, error) {
-	service, err := s.systemdService(ns)
+	service, err := s.hostService(ns)
 	if err != nil {
 		return svc.StatusUnknown, fmt.Errorf("failed to get service: %w", err)
 	}
 	return service.Status()
 }
 
+// fillRuntimeInfo fills in the start time and restart count of each component
+// of st. Errors are logged and leave the fields unset.
+func (s *Server) fillRuntimeInfo(st *ServiceStatusData) {
+	if t, err := s.serviceType(st.ServiceName); err != nil || t == db.ServiceTypeExternal {
+		return
+	}
+	switch st.ServiceType {
+	case ServiceDataTypeService:
+		service, err := s.hostService(st.ServiceName)
+		if err != nil {
+			return
+		}
+		ri, err := service.RuntimeInfo()
+		if err != nil {
+			log.Printf("failed to get runtime info for %q: %v", st.ServiceName, err)
+			return
+		}
+		for i := range st.ComponentStatus {
+			st.ComponentStatus[i].setRuntimeInfo(ri)
+		}
+	case ServiceDataTypeDocker:
+		service, err := s.dockerComposeService(st.ServiceName)
+		if err != nil {
+			return
+		}
+		infos, err := service.RuntimeInfos()
+		if err != nil {
+			log.Printf("failed to get runtime info for %q: %v", st.ServiceName, err)
+			return
+		}
+		for i := range st.ComponentStatus {
+			if ri, ok := infos[st.ComponentStatus[i].Name]; ok {
+				st.ComponentStatus[i].setRuntimeInfo(ri)
+			}
+		}
+	}
+}
+
 // SystemdStatuses returns the status of all systemd services. The keys are the
 // service names and the values are the statuses. Possible statuses are
 // svc.StatusRunning, svc.StatusStopped, and svc.StatusUnknown.
@@ -589,6 +809,9 @@ func (s *Server) IsServiceRunning(name string) (bool, error) {
 			return false, err
 		}
 		return st == svc.StatusRunning, nil
+	case db.ServiceTypeExternal:
+		// External services can be forgotten while running.
+		return false, nil
 	}
 	return false, fmt.Errorf("unknown service type")
 }
@@ -596,6 +819,17 @@ func (s *Server) IsServiceRunning(name string) (bool, error) {
 // RemoveService checks if service is stopped, removes the service directory
 // from the filesystem, and removes the service from the database.
 func (s *Server) RemoveService(name string) error {
+	return s.removeService(name, false)
+}
+
+// ArchiveService is like RemoveService but moves the service's files and
+// config into the archive instead of deleting them, so that it can be
+// restored with UndeleteService within archiveRetention.
+func (s *Server) ArchiveService(name string) error {
+	return s.removeService(name, true)
+}
+
+func (s *Server) removeService(name string, archive bool) error {
 	// Check if service is still running, and if so, return an error. Do not
 	// remove the service if it is still running.
 	if running, err := s.IsServiceRunning(name); err != nil {
@@ -604,6 +838,15 @@ func (s *Server) RemoveService(name string) error {
 		return fmt.Errorf("service is not stopped")
 	}
 
+	var archiveDir string
+	if archive {
+		var err error
+		archiveDir, err = s.newServiceArchive(name)
+		if err != nil {
+			return err
+		}
+	}
+
 	dirs, err := filepath.Glob(filepath.Join(s.cfg.ServicesRoot, name, "*"))
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("failed to list service directories: %w", err)
@@ -613,28 +856,32 @@ func (s *Server) RemoveService(name string) error {
 			// Skip data directory.
 			continue
 		}
+		if archive {
+			log.Printf("archiving service directory: %v", dir)
+			if err := os.Rename(dir, filepath.Join(archiveDir, filepath.Base(dir))); err != nil {
+				return fmt.Errorf("failed to archive service directory: %w", err)
+			}
+			continue
+		}
 		log.Printf("removing service directory: %v", dir)
 		if err := os.RemoveAll(dir); err != nil {
 			return fmt.Errorf("failed to remove service directory: %w", err)
 		}
 	}
-	if sv, err := s.serviceView(name); err == nil {
-		if sv.TSNet().Valid() && !sv.TSNet().StableID().IsZero() {
-			c, err := tsClient(s.ctx)
-			if err != nil {
-				return fmt.Errorf("failed to get tailscale client: %w", err)
-			}
-			if err := c.DeleteDevice(s.ctx, string(sv.TSNet().StableID())); err != nil {
-				var errResp tailscale.ErrResponse
-				if errors.As(err, &errResp) && errResp.Status == http.StatusNotFound {
-					log.Printf("tailscale device not found: %v", errResp)
-				} else {
-					return fmt.Errorf("failed to delete tailscale device: %w", err)
-				}
-			}
+	// Archived services keep their tailscale device so that they can come
+	// back with the same identity; it is deleted when the archive expires.
+	if sv, err := s.serviceView(name); err == nil && !archive {
+		if err := s.deleteTSDevice(sv.TSNet()); err != nil {
+			return err
 		}
 	}
 
+	removeSecrets(name)
+
+	var dependents []string
+	if dv, err := s.getDB(); err == nil {
+		dependents = neededBy(dv, name)
+	}
 	_, err = s.cfg.DB.MutateData(func(d *db.Data) error {
 		delete(d.Services, name)
 		return nil
@@ -642,9 +889,40 @@ func (s *Server) RemoveService(name string) error {
 	if err != nil {
 		return fmt.Errorf("failed to remove service from db: %w", err)
 	}
+	// Services that needed it, removed with --force, would fail to start
+	// while their units still require its unit.
+	for _, dep := range dependents {
+		sd, err := s.systemdService(dep)
+		if err == nil {
+			err = sd.UpdateNeeds()
+		}
+		if err != nil {
+			log.Printf("failed to update the units of %q, which needed %q: %v", dep, name, err)
+		}
+	}
 	s.PublishEvent(Event{
 		Type:        EventTypeServiceDeleted,
 		ServiceName: name,
 	})
 	return nil
 }
+
+// deleteTSDevice deletes the tailscale device of a service, if any.
+func (s *Server) deleteTSDevice(tsNet db.TailscaleNetworkView) error {
+	if !tsNet.Valid() || tsNet.StableID().IsZero() {
+		return nil
+	}
+	c, err := tsClient(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tailscale client: %w", err)
+	}
+	if err := c.DeleteDevice(s.ctx, string(tsNet.StableID())); err != nil {
+		var errResp tailscale.ErrResponse
+		if errors.As(err, &errResp) && errResp.Status == http.StatusNotFound {
+			log.Printf("tailscale device not found: %v", errResp)
+		} else {
+			return fmt.Errorf("failed to delete tailscale device: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/fileutil"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+)
+
+// defaultComposeTemplate is the template used to generate the compose file of
+// a service when an image is pushed to it and its previous generation has no
+// compose file to reuse. It can be overridden per host and per service with
+// `template edit`, e.g. to change the restart policy or to publish some of
+// the ports in .Ports, which it leaves unpublished.
+const defaultComposeTemplate = `services:
+  {{.ServiceName}}:
+    image: {{.Image}}
+    restart: unless-stopped
+{{- if .Volumes}}
+    volumes:
+{{- range .Volumes}}
+      - {{.}}
+{{- end}}
+{{- end}}
+`
+
+// composeTemplateData is the data available to compose templates.
+type composeTemplateData struct {
+	// ServiceName is the name of the service.
+	ServiceName string
+	// Image is the canonical image reference, e.g. catchit.dev/svc/img.
+	Image string
+	// DataDir is the service's data directory on the host.
+	DataDir string
+	// Ports are the ports exposed by the image, in compose "host:container"
+	// form. They are not published unless the template does so.
+	Ports []string
+	// Volumes are the volumes to mount, in compose "src:dst" form.
+	Volumes []string
+}
+
+// composeTemplate returns the compose template to use for the given service
+// and whether it was overridden.
+func composeTemplate(d *db.Data, sn string) string {
+	if sv, ok := d.Services[sn]; ok && sv.ComposeTemplate != "" {
+		return sv.ComposeTemplate
+	}
+	if d.ComposeTemplate != "" {
+		return d.ComposeTemplate
+	}
+	return defaultComposeTemplate
+}
+
+func executeComposeTemplate(tmpl string, data composeTemplateData) (string, error) {
+	t, err := template.New("compose").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse compose template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute compose template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// renderComposeFile renders the compose template for the given service using
+// the pushed image manifest.
+func (s *Server) renderComposeFile(d *db.Data, sn, image string, manifest []byte) (string, error) {
+	dataDir := s.stagedDataDir(sn)
+	return executeComposeTemplate(composeTemplate(d, sn), composeTemplateData{
+		ServiceName: sn,
+		Image:       image,
+		DataDir:     dataDir,
+		Ports:       s.imageExposedPorts(manifest),
+		Volumes:     []string{dataDir + ":/data"},
+	})
+}
+
+// imageExposedPorts returns the ports exposed by the image described by the
+// given manifest. It returns nil if the ports cannot be determined, e.g. if
+// the manifest is an index.
+func (s *Server) imageExposedPorts(manifest []byte) []string {
+	m, err := v1.ParseManifest(bytes.NewReader(manifest))
+	if err != nil || m.Config.Digest.Hex == "" {
+		return nil
+	}
+	f, err := os.Open(filepath.Join(s.cfg.RegistryRoot, "blobs", m.Config.Digest.Algorithm, m.Config.Digest.Hex))
+	if err != nil {
+		log.Printf("failed to open image config: %v", err)
+		return nil
+	}
+	defer f.Close()
+	cf, err := v1.ParseConfigFile(f)
+	if err != nil {
+		log.Printf("failed to parse image config: %v", err)
+		return nil
+	}
+	var ports []string
+	for p := range cf.Config.ExposedPorts {
+		port, proto, _ := strings.Cut(p, "/")
+		if proto == "" || proto == "tcp" {
+			ports = append(ports, port+":"+port)
+		} else {
+			ports = append(ports, port+":"+port+"/"+proto)
+		}
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// validateComposeTemplate checks that tmpl parses and executes against
+// sample data.
+func validateComposeTemplate(tmpl string) error {
+	_, err := executeComposeTemplate(tmpl, composeTemplateData{
+		ServiceName: "svc",
+		Image:       "catchit.dev/svc/svc",
+		DataDir:     "/data",
+		Ports:       []string{"80:80"},
+		Volumes:     []string{"/data:/data"},
+	})
+	return err
+}
+
+func (e *ttyExecer) templateCmdFunc(cmd *cobra.Command, _ []string) error {
+	if e.sn == CatchService {
+		return fmt.Errorf("cannot set a compose template for the catch service")
+	}
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	current := composeTemplate(dv.AsStruct(), e.sn)
+
+	switch cmd.CalledAs() {
+	case "template", "show":
+		e.printf("%s", current)
+		return nil
+	case "reset":
+		return e.setComposeTemplate("")
+	case "edit":
+	default:
+		return fmt.Errorf("invalid argument %q", cmd.CalledAs())
+	}
+
+	srcf, err := createTmpFile()
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(srcf.Name())
+	if _, err := srcf.WriteString(current); err != nil {
+		srcf.Close()
+		return fmt.Errorf("failed to write to temp file: %w", err)
+	}
+	if err := srcf.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	tmpPath, err := copyToTmpFile(srcf.Name())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := e.editFile(tmpPath); err != nil {
+		return fmt.Errorf("failed to edit file: %w", err)
+	}
+	if same, err := fileutil.Identical(srcf.Name(), tmpPath); err != nil {
+		return err
+	} else if same {
+		e.printf("No changes detected\n")
+		return nil
+	}
+	bs, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to read temp file: %w", err)
+	}
+	if err := validateComposeTemplate(string(bs)); err != nil {
+		return err
+	}
+	if err := e.setComposeTemplate(string(bs)); err != nil {
+		return err
+	}
+	e.printf("Compose template updated\n")
+	return nil
+}
+
+// setComposeTemplate sets the compose template for e.sn, or the host-wide
+// template if e.sn is the system service. An empty tmpl resets it to the
+// default.
+func (e *ttyExecer) setComposeTemplate(tmpl string) error {
+	if tmpl == defaultComposeTemplate {
+		tmpl = ""
+	}
+	if e.sn == SystemService {
+		_, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			d.ComposeTemplate = tmpl
+			return nil
+		})
+		return err
+	}
+	_, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		s.ComposeTemplate = tmpl
+		return nil
+	})
+	return err
+}
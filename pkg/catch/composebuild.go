@@ -0,0 +1,289 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Compose files can have build: sections. yeet run and stage send the build
+// context of each such service to the build command, which builds it with
+// docker buildx on the host and imports the image into the registry as the
+// staged image sn/<compose service>. The build also marks the compose service
+// as built for the next file, so that uploading the compose file replaces the
+// build: sections of the services built for it with the built images, and
+// never with an image left staged by an earlier build.
+
+// builtMarkPath returns the path of the list of compose services built for
+// the next file of service sn.
+func (s *Server) builtMarkPath(sn string) string {
+	return filepath.Join(s.serviceBinDir(sn), "next.build")
+}
+
+// markBuilt adds compose service cs to the services built for the next file
+// of service sn.
+func (s *Server) markBuilt(sn, cs string) error {
+	p := s.builtMarkPath(sn)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, strings.ToLower(cs)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// takeBuilt returns the compose services built for the next file of service
+// sn, and removes the mark so that they are used by this file only.
+func (s *Server) takeBuilt(sn string) (map[string]bool, error) {
+	p := s.builtMarkPath(sn)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := os.Remove(p); err != nil {
+		return nil, err
+	}
+	built := make(map[string]bool)
+	for _, cs := range strings.Fields(string(b)) {
+		built[cs] = true
+	}
+	return built, nil
+}
+
+// buildOptions are the build: settings of a compose service.
+type buildOptions struct {
+	// Dockerfile is the path of the Dockerfile in the build context, or
+	// empty for the default.
+	Dockerfile string
+	// Target is the build stage to build, or empty for the last one.
+	Target string
+	// Args are the build arguments as KEY=value.
+	Args []string
+}
+
+// validBuildService matches the compose service names that can be used as an
+// image repo.
+var validBuildService = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// builtImageRepo returns the registry repo of the image built for compose
+// service cs of service sn.
+func builtImageRepo(sn, cs string) string {
+	return sn + "/" + strings.ToLower(cs)
+}
+
+func (e *ttyExecer) buildCmdFunc(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: build <compose service> < context.tar")
+	}
+	var opts buildOptions
+	opts.Dockerfile, _ = cmd.Flags().GetString("dockerfile")
+	opts.Target, _ = cmd.Flags().GetString("target")
+	opts.Args, _ = cmd.Flags().GetStringArray("build-arg")
+	image, err := e.s.buildImage(e.ctx, e.sn, args[0], cmd.InOrStdin(), opts, e.rw)
+	if err != nil {
+		return err
+	}
+	e.printf("Built image %s\n", image)
+	return nil
+}
+
+// buildImage builds the image of compose service cs of service sn from the
+// tarball of its build context read from r, writing the build output to out.
+// The image is imported into the registry as the staged image of the service
+// and its reference returned.
+func (s *Server) buildImage(ctx context.Context, sn, cs string, r io.Reader, opts buildOptions, out io.Writer) (string, error) {
+	if !validBuildService.MatchString(strings.ToLower(cs)) {
+		return "", fmt.Errorf("invalid compose service name %q", cs)
+	}
+	docker, err := svc.DockerCmd()
+	if err != nil {
+		return "", fmt.Errorf("building images needs docker on the host: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "yeet-build-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	tarPath := filepath.Join(dir, "context.tar")
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to receive build context: %w", err)
+	}
+	ctxDir := filepath.Join(dir, "context")
+	if err := os.Mkdir(ctxDir, 0700); err != nil {
+		return "", err
+	}
+	if err := ExtractTar(tarPath, ctxDir); err != nil {
+		return "", fmt.Errorf("failed to extract build context: %w", err)
+	}
+
+	imagePath := filepath.Join(dir, "image.tar")
+	args := []string{
+		"buildx", "build",
+		"--progress=plain",
+		"--output", "type=docker,dest=" + imagePath,
+		"--tag", strings.ToLower(cs),
+	}
+	if opts.Dockerfile != "" {
+		if !filepath.IsLocal(opts.Dockerfile) {
+			return "", fmt.Errorf("dockerfile %q is not in the build context", opts.Dockerfile)
+		}
+		args = append(args, "--file", filepath.Join(ctxDir, opts.Dockerfile))
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	for _, a := range opts.Args {
+		args = append(args, "--build-arg", a)
+	}
+	args = append(args, ctxDir)
+	c := exec.CommandContext(ctx, docker, args...)
+	c.Stdout = out
+	c.Stderr = out
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("failed to build image for %q: %w", cs, err)
+	}
+
+	image, _, err := s.importImageArchive(ctx, sn, imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to import built image: %w", err)
+	}
+	if err := s.markBuilt(sn, cs); err != nil {
+		return "", fmt.Errorf("failed to mark %q as built: %w", cs, err)
+	}
+	return image, nil
+}
+
+// useBuiltImages replaces the build: section of each service of the compose
+// file at p that buildImage built for it with the built image. It returns
+// the names of the services it changed.
+func (s *Server) useBuiltImages(sn, p string) ([]string, error) {
+	built, err := s.takeBuilt(sn)
+	if err != nil || len(built) == 0 {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	services := yamlMapValue(doc.Content, "services")
+	if services == nil {
+		return nil, nil
+	}
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	images := dv.AsStruct().Images
+
+	var changed []string
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		name, service := services.Content[i].Value, services.Content[i+1]
+		if service.Kind != yaml.MappingNode {
+			continue
+		}
+		build := -1
+		for j := 0; j+1 < len(service.Content); j += 2 {
+			if service.Content[j].Value == "build" {
+				build = j
+			}
+		}
+		if build < 0 || !built[strings.ToLower(name)] {
+			continue
+		}
+		repo := builtImageRepo(sn, name)
+		ir, ok := images[db.ImageRepoName(repo)]
+		if !ok {
+			continue
+		}
+		if _, ok := ir.Refs["staged"]; !ok {
+			continue
+		}
+		service.Content = append(service.Content[:build], service.Content[build+2:]...)
+		image := fmt.Sprintf("%s/%s", svc.InternalRegistryHost, repo)
+		if v := yamlMapValue([]*yaml.Node{service}, "image"); v != nil {
+			v.SetString(image)
+		} else {
+			service.Content = append(service.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: "image"},
+				&yaml.Node{Kind: yaml.ScalarNode, Value: image},
+			)
+		}
+		changed = append(changed, name)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return changed, os.WriteFile(p, buf.Bytes(), 0644)
+}
+
+// yamlMapValue returns the value of key in the mapping node of nodes, the
+// content of a document node or a mapping node itself, or nil if there is
+// none.
+func yamlMapValue(nodes []*yaml.Node, key string) *yaml.Node {
+	if len(nodes) != 1 || nodes[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	m := nodes[0].Content
+	for i := 0; i+1 < len(m); i += 2 {
+		if m[i].Value == key {
+			return m[i+1]
+		}
+	}
+	return nil
+}
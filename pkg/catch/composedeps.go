@@ -0,0 +1,425 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"gopkg.in/yaml.v3"
+)
+
+// composeDepsFile is the part of a compose file that composeDependencies
+// looks at.
+type composeDepsFile struct {
+	Services map[string]struct {
+		// DependsOn is either a list of service names or a map of service
+		// name to conditions.
+		DependsOn any `yaml:"depends_on"`
+		// Volumes entries are either "src:dst[:mode]" strings or maps with
+		// type and source.
+		Volumes []any `yaml:"volumes"`
+	} `yaml:"services"`
+	Networks map[string]composeExternalRef `yaml:"networks"`
+	Volumes  map[string]composeExternalRef `yaml:"volumes"`
+}
+
+// composeExternalRef is a top-level network or volume of a compose file.
+type composeExternalRef struct {
+	External any    `yaml:"external"`
+	Name     string `yaml:"name"`
+}
+
+// externalName returns the docker name of the network or volume declared
+// under key, and whether it is external, i.e. created outside this compose
+// project. The legacy `external: {name: ...}` form is supported.
+func (r composeExternalRef) externalName(key string) (string, bool) {
+	if m, ok := r.External.(map[string]any); ok {
+		name, _ := m["name"].(string)
+		return cmp.Or(name, r.Name, key), true
+	}
+	if !isYAMLTrue(r.External) {
+		return "", false
+	}
+	return cmp.Or(r.Name, key), true
+}
+
+// composeDependencies returns the services that service sn depends on
+// according to its compose file at path: depends_on entries naming other
+// services (allowed by compose with required: false), external networks
+// and volumes of other services' compose projects, and bind mounts from
+// other services' directories. dv is used to look up the other services.
+func (s *Server) composeDependencies(dv *db.DataView, sn, path string) ([]db.Dependency, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	var cf composeDepsFile
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	var deps []db.Dependency
+	add := func(dep, ref string, kind db.DependencyKind) {
+		if dep == "" || dep == sn {
+			return
+		}
+		d := db.Dependency{Service: dep, Kind: kind, Ref: ref}
+		if !slices.Contains(deps, d) {
+			deps = append(deps, d)
+		}
+	}
+	isService := func(name string) bool {
+		_, ok := dv.Services().GetOk(name)
+		return ok
+	}
+	// projectOwner returns the service whose compose project created the
+	// docker object name, e.g. "catch-db_default" is owned by db.
+	projectOwner := func(name string) string {
+		rest, ok := strings.CutPrefix(name, "catch-")
+		if !ok {
+			return ""
+		}
+		for other := range dv.Services().All() {
+			if rest == other || strings.HasPrefix(rest, other+"_") {
+				return other
+			}
+		}
+		return ""
+	}
+	// dirOwner returns the service whose directory contains path p.
+	dirOwner := func(p string) string {
+		p = filepath.Clean(p)
+		for other, sv := range dv.Services().All() {
+			for _, dir := range []string{s.serviceRootDir(other), sv.DataDir()} {
+				if dir != "" && (p == dir || strings.HasPrefix(p, dir+"/")) {
+					return other
+				}
+			}
+		}
+		return ""
+	}
+
+	for name, cs := range cf.Services {
+		var dependsOn []string
+		switch v := cs.DependsOn.(type) {
+		case []any:
+			for _, d := range v {
+				if d, ok := d.(string); ok {
+					dependsOn = append(dependsOn, d)
+				}
+			}
+		case map[string]any:
+			for d := range v {
+				dependsOn = append(dependsOn, d)
+			}
+		}
+		for _, d := range dependsOn {
+			if _, local := cf.Services[d]; !local && isService(d) {
+				add(d, name, db.DependencyDependsOn)
+			}
+		}
+		for _, v := range cs.Volumes {
+			var src string
+			switch v := v.(type) {
+			case string:
+				src, _, _ = strings.Cut(v, ":")
+			case map[string]any:
+				src, _ = v["source"].(string)
+			}
+			if filepath.IsAbs(src) {
+				add(dirOwner(src), src, db.DependencyVolume)
+			}
+		}
+	}
+	for key, n := range cf.Networks {
+		if name, ok := n.externalName(key); ok {
+			add(projectOwner(name), name, db.DependencyNetwork)
+		}
+	}
+	for key, v := range cf.Volumes {
+		if name, ok := v.externalName(key); ok {
+			add(projectOwner(name), name, db.DependencyVolume)
+		}
+	}
+	slices.SortFunc(deps, func(a, b db.Dependency) int {
+		return cmp.Or(
+			strings.Compare(a.Service, b.Service),
+			strings.Compare(string(a.Kind), string(b.Kind)),
+			strings.Compare(a.Ref, b.Ref),
+		)
+	})
+	return deps, nil
+}
+
+// dependencyNames returns the names of the services in deps, without
+// duplicates.
+func dependencyNames(deps []db.Dependency) []string {
+	var names []string
+	for _, d := range deps {
+		if !slices.Contains(names, d.Service) {
+			names = append(names, d.Service)
+		}
+	}
+	return names
+}
+
+// startOrder returns the transitive dependencies of service sn in the order
+// they should be started, dependencies first. sn itself is not included.
+// Dependency cycles are broken arbitrarily.
+func startOrder(dv *db.DataView, sn string) []string {
+	var order []string
+	visiting := map[string]bool{sn: true}
+	var visit func(name string)
+	visit = func(name string) {
+		sv, ok := dv.Services().GetOk(name)
+		if !ok {
+			return
+		}
+		for _, dep := range dependencyNames(sv.Dependencies().AsSlice()) {
+			if visiting[dep] {
+				continue
+			}
+			visiting[dep] = true
+			visit(dep)
+			order = append(order, dep)
+		}
+	}
+	visit(sn)
+	return order
+}
+
+// dependents returns the services that depend directly on service sn,
+// sorted by name.
+func dependents(dv *db.DataView, sn string) []string {
+	var out []string
+	for name, sv := range dv.Services().All() {
+		for _, d := range sv.Dependencies().All() {
+			if d.Service == sn {
+				out = append(out, name)
+				break
+			}
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// dependencyRefs returns the dependencies of other services on service sn,
+// by the name of the depending service. Besides the recorded dependencies,
+// the latest compose file of each service is scanned again, as it may have
+// been installed before its dependencies were recorded.
+func (s *Server) dependencyRefs(dv *db.DataView, sn string) map[string][]db.Dependency {
+	out := map[string][]db.Dependency{}
+	for name, sv := range dv.Services().All() {
+		if name == sn {
+			continue
+		}
+		deps := sv.Dependencies().AsSlice()
+		if p, ok := sv.AsStruct().Artifacts.Latest(db.ArtifactDockerComposeFile); ok {
+			if scanned, err := s.composeDependencies(dv, name, p); err == nil {
+				deps = append(deps, scanned...)
+			}
+		}
+		for _, d := range deps {
+			if d.Service == sn && !slices.Contains(out[name], d) {
+				out[name] = append(out[name], d)
+			}
+		}
+	}
+	return out
+}
+
+// formatDependencyRefs formats the output of dependencyRefs as one line per
+// depending service, e.g. "  web: network catch-db_default".
+func formatDependencyRefs(refs map[string][]db.Dependency) string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(refs)) {
+		var why []string
+		for _, d := range refs[name] {
+			if d.Ref != "" {
+				why = append(why, fmt.Sprintf("%s %s", d.Kind, d.Ref))
+			} else {
+				why = append(why, string(d.Kind))
+			}
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", name, strings.Join(why, ", "))
+	}
+	return b.String()
+}
+
+// withNeeds returns deps with the dependencies declared with --needs
+// replaced by needs.
+func withNeeds(deps []db.Dependency, needs []string) []db.Dependency {
+	out := slices.DeleteFunc(slices.Clone(deps), func(d db.Dependency) bool {
+		return d.Kind == db.DependencyNeeds
+	})
+	for _, n := range needs {
+		if d := (db.Dependency{Service: n, Kind: db.DependencyNeeds}); !slices.Contains(out, d) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// declaredDependencies returns the dependencies in deps that were declared
+// with --needs rather than discovered.
+func declaredDependencies(deps []db.Dependency) []db.Dependency {
+	var out []db.Dependency
+	for _, d := range deps {
+		if d.Kind == db.DependencyNeeds {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// validateNeeds returns an error if service sn can't need the services in
+// needs, because they don't exist or need sn themselves.
+func validateNeeds(dv *db.DataView, sn string, needs []string) error {
+	for _, n := range needs {
+		if n == sn {
+			return fmt.Errorf("service %q can't need itself", sn)
+		}
+		if n == SystemService || n == CatchService {
+			return fmt.Errorf("service %q can't be needed", n)
+		}
+		if _, ok := dv.Services().GetOk(n); !ok {
+			return fmt.Errorf("needed service %q not found", n)
+		}
+		if slices.Contains(startOrder(dv, n), sn) {
+			return fmt.Errorf("service %q already depends on %q", n, sn)
+		}
+	}
+	return nil
+}
+
+// stopOrder returns the services that transitively need service sn, in the
+// order they should be stopped, dependents first. sn itself is not included.
+func stopOrder(dv *db.DataView, sn string) []string {
+	var order []string
+	visiting := map[string]bool{sn: true}
+	var visit func(name string)
+	visit = func(name string) {
+		for _, dep := range neededBy(dv, name) {
+			if visiting[dep] {
+				continue
+			}
+			visiting[dep] = true
+			visit(dep)
+			order = append(order, dep)
+		}
+	}
+	visit(sn)
+	return order
+}
+
+// neededBy returns the services that declared with --needs that they need
+// service sn, sorted by name.
+func neededBy(dv *db.DataView, sn string) []string {
+	var out []string
+	for name, sv := range dv.Services().All() {
+		if slices.Contains(sv.Dependencies().AsSlice(), db.Dependency{Service: sn, Kind: db.DependencyNeeds}) {
+			out = append(out, name)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// serviceRunning reports whether any component of service sn is running.
+func (s *Server) serviceRunning(sn string) bool {
+	statuses, err := s.serviceStatusesWith(sn, statusDetails{})
+	if err != nil {
+		return false
+	}
+	for _, st := range statuses {
+		for _, c := range st.ComponentStatus {
+			if c.Status == ComponentStatusRunning {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// startDependencies starts the dependencies of the service that are not
+// running, in dependency order.
+func (e *ttyExecer) startDependencies() error {
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	for _, dep := range startOrder(dv, e.sn) {
+		if e.s.serviceRunning(dep) {
+			continue
+		}
+		e.printf("Starting dependency %q\n", dep)
+		runner, err := e.serviceRunnerFor(dep, e.newCmd)
+		if err != nil {
+			return fmt.Errorf("failed to get runner of dependency %q: %w", dep, err)
+		}
+		if err := runner.Start(); err != nil {
+			return fmt.Errorf("failed to start dependency %q: %w", dep, err)
+		}
+	}
+	return nil
+}
+
+// stopDependents stops the running services that need the service, in
+// reverse dependency order.
+func (e *ttyExecer) stopDependents() error {
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	for _, dep := range stopOrder(dv, e.sn) {
+		if !e.s.serviceRunning(dep) {
+			continue
+		}
+		e.printf("Stopping %q, which needs %q\n", dep, e.sn)
+		runner, err := e.serviceRunnerFor(dep, e.newCmd)
+		if err != nil {
+			return fmt.Errorf("failed to get runner of dependent %q: %w", dep, err)
+		}
+		if err := runner.Stop(); err != nil {
+			return fmt.Errorf("failed to stop dependent %q: %w", dep, err)
+		}
+	}
+	return nil
+}
+
+// warnRunningDependents prints the running services that depend on the
+// service, e.g. before it is stopped.
+func (e *ttyExecer) warnRunningDependents() {
+	dv, err := e.s.getDB()
+	if err != nil {
+		return
+	}
+	var running []string
+	for _, d := range dependents(dv, e.sn) {
+		if e.s.serviceRunning(d) {
+			running = append(running, d)
+		}
+	}
+	if len(running) > 0 {
+		e.printf("warning: running services depend on %q: %s\n", e.sn, strings.Join(running, ", "))
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeLintOptions describe how a compose file will be run by yeet.
+type composeLintOptions struct {
+	// NetNS is whether the service runs in a yeet network namespace.
+	NetNS bool
+	// AllowPrivileged is whether privileged containers were allowed with
+	// --allow-privileged.
+	AllowPrivileged bool
+}
+
+// composeIssue is a compose feature that yeet can't honor.
+type composeIssue struct {
+	// Service is the compose service the issue is in.
+	Service string
+	// Fatal is whether the file can't be installed because of the issue.
+	Fatal bool
+	Msg   string
+}
+
+func (ci composeIssue) String() string {
+	return fmt.Sprintf("service %q: %s", ci.Service, ci.Msg)
+}
+
+// composeLintService is the part of a compose service that lintCompose
+// looks at.
+type composeLintService struct {
+	Image       string   `yaml:"image"`
+	Build       any      `yaml:"build"`
+	Profiles    []string `yaml:"profiles"`
+	NetworkMode string   `yaml:"network_mode"`
+	Privileged  any      `yaml:"privileged"`
+}
+
+// lintCompose reports the features of the compose file at path that yeet
+// can't honor, sorted by service. It only returns an error if the file can't
+// be read or parsed.
+func lintCompose(path string, opts composeLintOptions) ([]composeIssue, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	var cf struct {
+		Services map[string]composeLintService `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	var issues []composeIssue
+	for name, s := range cf.Services {
+		add := func(fatal bool, format string, args ...any) {
+			issues = append(issues, composeIssue{Service: name, Fatal: fatal, Msg: fmt.Sprintf(format, args...)})
+		}
+		if s.Build != nil {
+			if s.Image == "" {
+				add(true, "build: has no built image; deploy the compose file with `yeet run` so the build context is built on the host, or build and push the image (e.g. with `yeet push`) and set image: instead")
+			} else {
+				add(false, "build: has no built image and is ignored, so %s must be pullable; deploy the compose file with `yeet run` to build it on the host", s.Image)
+			}
+		}
+		if len(s.Profiles) > 0 {
+			add(false, "profiles: %s are not enabled by yeet, so this service will never start", strings.Join(s.Profiles, ", "))
+		}
+		if s.NetworkMode == "host" && opts.NetNS {
+			add(true, "network_mode: host conflicts with the service's network namespace from --net; remove network_mode or deploy with --net=host")
+		}
+		if isYAMLTrue(s.Privileged) && !opts.AllowPrivileged {
+			add(true, "privileged: true gives the container full access to the host; pass --allow-privileged to allow it")
+		}
+	}
+	slices.SortStableFunc(issues, func(a, b composeIssue) int {
+		return strings.Compare(a.Service, b.Service)
+	})
+	return issues, nil
+}
+
+// isYAMLTrue reports whether v, a decoded YAML value, is true. Compose accepts
+// both booleans and strings for boolean fields.
+func isYAMLTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// checkCompose lints the compose file at path, printing warnings with
+// printf. It returns an error listing the issues that prevent the file from
+// being installed, if any.
+func checkCompose(path string, opts composeLintOptions, printf func(string, ...any)) error {
+	issues, err := lintCompose(path, opts)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, ci := range issues {
+		if ci.Fatal {
+			errs = append(errs, errors.New(ci.String()))
+			continue
+		}
+		printf("warning: %s\n", ci)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("compose file uses features yeet can't honor:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCompose(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "compose.yml")
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLintCompose(t *testing.T) {
+	type issue struct {
+		service string
+		fatal   bool
+	}
+	tests := []struct {
+		name    string
+		compose string
+		opts    composeLintOptions
+		want    []issue
+	}{
+		{
+			name: "clean",
+			compose: `
+services:
+  web:
+    image: nginx
+    network_mode: host
+    privileged: false
+`,
+		},
+		{
+			name: "build-without-image",
+			compose: `
+services:
+  web:
+    build: .
+`,
+			want: []issue{{"web", true}},
+		},
+		{
+			name: "build-with-image",
+			compose: `
+services:
+  web:
+    image: example.com/web
+    build:
+      context: .
+`,
+			want: []issue{{"web", false}},
+		},
+		{
+			name: "profiles",
+			compose: `
+services:
+  debug:
+    image: busybox
+    profiles: [debug]
+`,
+			want: []issue{{"debug", false}},
+		},
+		{
+			name: "host-network-in-netns",
+			compose: `
+services:
+  web:
+    image: nginx
+    network_mode: host
+`,
+			opts: composeLintOptions{NetNS: true},
+			want: []issue{{"web", true}},
+		},
+		{
+			name: "privileged",
+			compose: `
+services:
+  web:
+    image: nginx
+    privileged: true
+  db:
+    image: postgres
+    privileged: "true"
+`,
+			want: []issue{{"db", true}, {"web", true}},
+		},
+		{
+			name: "privileged-allowed",
+			compose: `
+services:
+  web:
+    image: nginx
+    privileged: true
+`,
+			opts: composeLintOptions{AllowPrivileged: true},
+		},
+		{
+			name: "sorted-by-service",
+			compose: `
+services:
+  z:
+    build: .
+    profiles: [x]
+  a:
+    image: busybox
+    profiles: [x]
+`,
+			want: []issue{{"a", false}, {"z", true}, {"z", false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := lintCompose(writeCompose(t, tt.compose), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []issue
+			for _, ci := range issues {
+				got = append(got, issue{ci.Service, ci.Fatal})
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("lintCompose issues = %v, want %v\n%v", got, tt.want, issues)
+			}
+		})
+	}
+}
+
+func TestLintComposeInvalid(t *testing.T) {
+	if _, err := lintCompose(writeCompose(t, "services: [\n"), composeLintOptions{}); err == nil {
+		t.Error("lintCompose of invalid YAML succeeded")
+	}
+	if _, err := lintCompose(filepath.Join(t.TempDir(), "missing.yml"), composeLintOptions{}); err == nil {
+		t.Error("lintCompose of a missing file succeeded")
+	}
+}
+
+func TestCheckCompose(t *testing.T) {
+	p := writeCompose(t, `
+services:
+  web:
+    image: nginx
+    privileged: true
+  debug:
+    image: busybox
+    profiles: [debug]
+`)
+	var warnings strings.Builder
+	printf := func(format string, args ...any) { fmt.Fprintf(&warnings, format, args...) }
+
+	err := checkCompose(p, composeLintOptions{}, printf)
+	if err == nil || !strings.Contains(err.Error(), `service "web": privileged: true`) {
+		t.Errorf("checkCompose error = %v, want privileged error for web", err)
+	}
+	if !strings.Contains(warnings.String(), `warning: service "debug": profiles: debug`) {
+		t.Errorf("warnings = %q, want profiles warning for debug", warnings.String())
+	}
+
+	warnings.Reset()
+	if err := checkCompose(p, composeLintOptions{AllowPrivileged: true}, printf); err != nil {
+		t.Errorf("checkCompose with AllowPrivileged = %v, want nil", err)
+	}
+	if strings.Count(warnings.String(), "warning:") != 1 {
+		t.Errorf("warnings = %q, want exactly one", warnings.String())
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+)
+
+// convertTargets are the service types `convert --to` accepts.
+var convertTargets = map[string]db.ServiceType{
+	"compose": db.ServiceTypeDockerCompose,
+	"systemd": db.ServiceTypeSystemd,
+}
+
+// convertCmdFunc converts the service to another service type. The running
+// units or containers are removed and the artifacts of the old type are
+// moved to an archive along with the service config, keeping the data
+// directory and env file. The service is then left without artifacts of the
+// new type, ready for them to be staged.
+func (e *ttyExecer) convertCmdFunc(cmd *cobra.Command, _ []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot convert system service")
+	}
+	toFlag, _ := cmd.Flags().GetString("to")
+	to, ok := convertTargets[toFlag]
+	if !ok {
+		return fmt.Errorf("invalid --to %q, expected compose or systemd", toFlag)
+	}
+	sv, err := e.s.serviceView(e.sn)
+	if err != nil {
+		return err
+	}
+	from := sv.ServiceType()
+	switch from {
+	case to:
+		return fmt.Errorf("service %q is already a %s service", e.sn, toFlag)
+	case db.ServiceTypeExternal:
+		return fmt.Errorf("service %q is not managed by yeet", e.sn)
+	case "":
+		return fmt.Errorf("service %q has not been installed yet; stage it as a %s service directly", e.sn, toFlag)
+	}
+	if ok, err := cmdutil.Confirm(e.rw, e.rw, fmt.Sprintf("Convert service %q from %s to %s? It is stopped and its %s artifacts are archived", e.sn, from, to, from)); err != nil {
+		return fmt.Errorf("failed to confirm conversion: %w", err)
+	} else if !ok {
+		// Fail so that the client doesn't stage a file for the new type.
+		return errors.New("conversion cancelled")
+	}
+
+	runner, err := e.serviceRunner()
+	if err != nil && !errors.Is(err, errNoServiceConfigured) {
+		return fmt.Errorf("failed to get service runner: %w", err)
+	}
+	if runner != nil {
+		if err := runner.Remove(); err != nil && !errors.Is(err, svc.ErrNotInstalled) {
+			return fmt.Errorf("failed to remove %s service: %w", from, err)
+		}
+	}
+
+	// The archive holds the old config and artifacts. The service still
+	// exists, so it can only be restored with undelete after removing the
+	// converted service.
+	archiveDir, err := e.s.newServiceArchive(e.sn)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{e.s.serviceBinDir(e.sn), e.s.serviceRunDir(e.sn)} {
+		if err := os.Rename(dir, filepath.Join(archiveDir, filepath.Base(dir))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to archive %s: %w", dir, err)
+		}
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		s.ServiceType = to
+		for name := range s.Artifacts {
+			if name != db.ArtifactEnvFile {
+				delete(s.Artifacts, name)
+			}
+		}
+		s.Quadlet = false
+		s.Runtime = ""
+		// Dependencies discovered from the old compose file no longer
+		// apply; the ones declared with --needs do.
+		s.Dependencies = declaredDependencies(s.Dependencies)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	if err := e.s.ensureDirs(e.sn, e.user); err != nil {
+		return err
+	}
+	e.s.recordAudit(AuditEntry{
+		ServiceName: e.sn,
+		Action:      AuditActionConvert,
+		Actor:       e.s.callerName(e.ctx, e.remoteAddr),
+		User:        e.user,
+		Reason:      fmt.Sprintf("%s to %s", from, to),
+	})
+	e.printf("Converted %q to a %s service; the %s artifacts are archived in %s\n", e.sn, to, from, archiveDir)
+	e.printf("Stage the new %s artifacts with `yeet stage %s <file>` or run them with `yeet run %s <file>`\n", toFlag, e.sn, e.sn)
+	return nil
+}
@@ -15,7 +15,9 @@
 package catch
 
 import (
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/yeetrun/yeet/pkg/db"
 	"github.com/yeetrun/yeet/pkg/svc"
@@ -35,17 +37,199 @@ const (
 	ComponentStatusStopping ComponentStatus = "stopping"
 	ComponentStatusStopped  ComponentStatus = "stopped"
 	ComponentStatusUnknown  ComponentStatus = "unknown"
+	// ComponentStatusDegraded is only a ServiceStatusData.Status: some
+	// components of the service are running and others are not.
+	ComponentStatusDegraded ComponentStatus = "degraded"
+
+	// ComponentStatusHealthy and ComponentStatusUnhealthy, along with
+	// ComponentStatusStarting, are the values of ComponentStatusData.Health.
+	ComponentStatusHealthy   ComponentStatus = "healthy"
+	ComponentStatusUnhealthy ComponentStatus = "unhealthy"
 )
 
 type ServiceStatusData struct {
 	ServiceName     string                `json:"serviceName"`
 	ServiceType     ServiceDataType       `json:"serviceType"`
 	ComponentStatus []ComponentStatusData `json:"components"`
+	// Status is the state of the service as a whole, computed from its
+	// components with ServiceStatus: running, degraded, stopped, starting,
+	// stopping or unknown.
+	Status     ComponentStatus    `json:"status,omitempty"`
+	LastAction *ServiceActionData `json:"lastAction,omitempty"`
+	// LastWatchdogTrip is the time the systemd watchdog last killed the
+	// service in milliseconds since the epoch, or 0 if it has not since catch
+	// started.
+	LastWatchdogTrip int64 `json:"lastWatchdogTrip,omitempty"`
+	// Generation is the generation of the service that is installed.
+	Generation int `json:"generation,omitempty"`
+	// IPs are the addresses of the service's network namespace, if it has
+	// one.
+	IPs []string `json:"ips,omitempty"`
+	// DependsOn are the services this service depends on.
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// ServiceStatsData is the resource usage of a service.
+type ServiceStatsData struct {
+	ServiceName string               `json:"serviceName"`
+	ServiceType ServiceDataType      `json:"serviceType"`
+	Components  []ComponentStatsData `json:"components"`
+}
+
+// ComponentStatsData is the resource usage of a component of a service: the
+// unit of a systemd service or a container of a docker compose service.
+type ComponentStatsData struct {
+	Name string `json:"name"`
+	// CPUPercent is the CPU usage in percent of one core.
+	CPUPercent  float64 `json:"cpuPercent"`
+	MemoryBytes uint64  `json:"memoryBytes"`
+	// NetRxBytes and NetTxBytes are the bytes received and sent since the
+	// component started. They are zero for services on the host network.
+	NetRxBytes uint64 `json:"netRxBytes"`
+	NetTxBytes uint64 `json:"netTxBytes"`
+}
+
+// ServiceRollbackData describes an automatic rollback of a failed deploy.
+type ServiceRollbackData struct {
+	FromGeneration int    `json:"fromGeneration"`
+	ToGeneration   int    `json:"toGeneration"`
+	Reason         string `json:"reason"`
+}
+
+// ServiceActionData describes the last manual action taken on a service.
+type ServiceActionData struct {
+	Action string `json:"action"`
+	Actor  string `json:"actor,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Time is the time the action was taken in milliseconds since the epoch.
+	Time int64 `json:"time"`
+}
+
+func ServiceActionDataFromServiceAction(a *db.ServiceAction) *ServiceActionData {
+	if a == nil {
+		return nil
+	}
+	return &ServiceActionData{
+		Action: a.Action,
+		Actor:  a.Actor,
+		Reason: a.Reason,
+		Time:   a.Time.UnixMilli(),
+	}
+}
+
+// Summary returns a human-readable summary of the action, e.g. "stopped by
+// alice 2h ago: disk maintenance".
+func (a *ServiceActionData) Summary(now time.Time) string {
+	if a == nil {
+		return ""
+	}
+	var verb string
+	switch a.Action {
+	case "stop":
+		verb = "stopped"
+	case "start":
+		verb = "started"
+	case "restart":
+		verb = "restarted"
+	default:
+		verb = a.Action
+	}
+	if a.Actor != "" {
+		verb += " by " + a.Actor
+	}
+	verb += " " + formatAgo(now.Sub(time.UnixMilli(a.Time)))
+	if a.Reason != "" {
+		verb += ": " + a.Reason
+	}
+	return verb
+}
+
+// formatAgo formats d as a coarse relative time, e.g. "2h ago".
+func formatAgo(d time.Duration) string {
+	if d < time.Minute {
+		return "just now"
+	}
+	return formatDuration(d) + " ago"
+}
+
+// formatDuration formats d coarsely in its largest unit, e.g. "45s", "2h".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
 }
 
 type ComponentStatusData struct {
 	Name   string          `json:"name"`
 	Status ComponentStatus `json:"status"`
+	// StartedAt is when the component was last started in milliseconds since
+	// the epoch, or 0 if it is not running.
+	StartedAt int64 `json:"startedAt,omitempty"`
+	// Restarts is the number of automatic restarts of the component.
+	Restarts int `json:"restarts"`
+	// Image is the image ID of a container.
+	Image string `json:"image,omitempty"`
+	// IPs are the addresses of a container on its docker networks.
+	IPs []string `json:"ips,omitempty"`
+	// Health is the result of the health check of the component, if it has
+	// one and is running: starting, healthy or unhealthy.
+	Health ComponentStatus `json:"health,omitempty"`
+	// HealthError is the error of the last failed health check probe.
+	HealthError string `json:"healthError,omitempty"`
+}
+
+func (c *ComponentStatusData) setRuntimeInfo(ri svc.RuntimeInfo) {
+	if !ri.StartedAt.IsZero() {
+		c.StartedAt = ri.StartedAt.UnixMilli()
+	}
+	c.Restarts = ri.Restarts
+	c.Image = ri.Image
+	c.IPs = ri.IPs
+	if ri.Health != "" && c.Status == ComponentStatusRunning {
+		c.Health = ComponentStatus(ri.Health)
+	}
+}
+
+// Uptime returns how long the component has been running formatted for
+// display, or "-" if it is not running.
+func (c ComponentStatusData) Uptime(now time.Time) string {
+	if c.StartedAt == 0 {
+		return "-"
+	}
+	return formatDuration(now.Sub(time.UnixMilli(c.StartedAt)))
+}
+
+// ServiceStatus returns the state of a service with the components cs. It is
+// the status of the components if they all have the same one, degraded if
+// some are running and others not, and otherwise the status of those that
+// are changing state, or stopped.
+func ServiceStatus(cs []ComponentStatusData) ComponentStatus {
+	if len(cs) == 0 {
+		return ComponentStatusUnknown
+	}
+	seen := map[ComponentStatus]bool{}
+	for _, c := range cs {
+		seen[c.Status] = true
+	}
+	switch {
+	case len(seen) == 1:
+		return cs[0].Status
+	case seen[ComponentStatusRunning]:
+		return ComponentStatusDegraded
+	case seen[ComponentStatusStarting]:
+		return ComponentStatusStarting
+	case seen[ComponentStatusStopping]:
+		return ComponentStatusStopping
+	default:
+		return ComponentStatusStopped
+	}
 }
 
 func ComponentStatusFromServiceStatus(st svc.Status) ComponentStatus {
@@ -0,0 +1,96 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+func TestCheckDataDir(t *testing.T) {
+	s := uploadTestServer(t, "svc")
+	vol := t.TempDir()
+	home, _ := os.UserHomeDir()
+	tests := []struct {
+		dir     string
+		wantErr string
+	}{
+		{dir: filepath.Join(vol, "svc")},
+		{dir: filepath.Join(vol, "svc") + "/"},
+		{dir: "relative/data", wantErr: "absolute path"},
+		{dir: "/", wantErr: "not a dedicated directory"},
+		{dir: "/etc", wantErr: "not a dedicated directory"},
+		{dir: "/usr/", wantErr: "not a dedicated directory"},
+		{dir: "/var/lib", wantErr: "not a dedicated directory"},
+		{dir: "/home/alice", wantErr: "not a dedicated directory"},
+		{dir: home, wantErr: "not a dedicated directory"},
+		{dir: filepath.Dir(s.cfg.ServicesRoot), wantErr: "catch's data"},
+		{dir: filepath.Join(vol, "missing", "svc"), wantErr: "no such file"},
+	}
+	for _, tt := range tests {
+		got, err := s.checkDataDir(tt.dir)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkDataDir(%q): %v", tt.dir, err)
+			} else if got != filepath.Clean(tt.dir) {
+				t.Errorf("checkDataDir(%q) = %q, want %q", tt.dir, got, filepath.Clean(tt.dir))
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("checkDataDir(%q) = %v, want error containing %q", tt.dir, err, tt.wantErr)
+		}
+	}
+}
+
+// TestStagedDataDir checks that a staged data dir is only used by the
+// service once its generation is committed.
+func TestStagedDataDir(t *testing.T) {
+	const sn = "svc"
+	s := uploadTestServer(t, sn)
+	def := s.serviceDataDir(sn)
+	dir := filepath.Join(t.TempDir(), "data")
+	if _, _, err := s.cfg.DB.MutateService(sn, func(_ *db.Data, sv *db.Service) error {
+		sv.StagedDataDir = dir
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.serviceDataDir(sn); got != def {
+		t.Errorf("serviceDataDir before commit = %q, want %q", got, def)
+	}
+	if got := s.stagedDataDir(sn); got != dir {
+		t.Errorf("stagedDataDir = %q, want %q", got, dir)
+	}
+
+	si := &Installer{s: s, icfg: InstallerCfg{ServiceName: sn}}
+	if _, _, err := si.commitGen(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.serviceDataDir(sn); got != dir {
+		t.Errorf("serviceDataDir after commit = %q, want %q", got, dir)
+	}
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sv.StagedDataDir() != "" {
+		t.Errorf("StagedDataDir = %q after commit, want it cleared", sv.StagedDataDir())
+	}
+}
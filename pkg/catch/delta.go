@@ -0,0 +1,83 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/yeetrun/yeet/pkg/codecutil"
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+// Delta uploads: `yeet run` and `yeet stage` fetch the block checksums of the
+// binary of the service with `block-sums` and upload a delta against it
+// instead of the whole file. The installer rebuilds the file from the delta
+// before anything else looks at it.
+
+// deltaBase returns the path of the file deltas for service sn are made
+// against: the staged binary if there is one, else the latest.
+func (s *Server) deltaBase(sn string) (string, bool) {
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		return "", false
+	}
+	as := sv.AsStruct().Artifacts
+	p, ok := as.Staged(db.ArtifactBinary)
+	if !ok {
+		p, ok = as.Latest(db.ArtifactBinary)
+	}
+	if !ok {
+		return "", false
+	}
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// blockSumsCmdFunc prints the block checksums of the base for deltas as
+// JSON, or null if the service has no binary yet.
+func (e *ttyExecer) blockSumsCmdFunc(_ *cobra.Command, _ []string) error {
+	var sums *codecutil.BlockSums
+	if p, ok := e.s.deltaBase(e.sn); ok {
+		var err error
+		if sums, err = codecutil.ComputeBlockSums(p, codecutil.DefaultBlockSize); err != nil {
+			return fmt.Errorf("failed to compute block sums: %w", err)
+		}
+	}
+	return json.NewEncoder(e.rw).Encode(sums)
+}
+
+// applyDelta replaces the file at p with the file rebuilt from it if it is a
+// delta.
+func (i *FileInstaller) applyDelta(p string) error {
+	if !codecutil.IsDelta(p) {
+		return nil
+	}
+	base, ok := i.s.deltaBase(i.cfg.ServiceName)
+	if !ok {
+		return errors.New("received a delta but the service has no binary to apply it to")
+	}
+	tmp := p + ".full"
+	if err := codecutil.ApplyDelta(tmp, p, base, codecutil.DefaultBlockSize); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to apply delta: %w", err)
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,84 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/diffutil"
+	"github.com/spf13/cobra"
+)
+
+// diffCmdFunc prints a unified diff of the artifacts of the running
+// generation of the service against the staged ones.
+func (e *ttyExecer) diffCmdFunc(cmd *cobra.Command, _ []string) error {
+	showEnv, _ := cmd.Flags().GetBool("env")
+	lines, _ := cmd.Flags().GetInt("context")
+	if lines < 0 {
+		return fmt.Errorf("invalid --context %d, must not be negative", lines)
+	}
+	diff, err := e.s.stageDiff(e.sn)
+	if err != nil {
+		return fmt.Errorf("failed to diff staged configuration: %w", err)
+	}
+	if !diff.Changed {
+		e.printf("No staged changes\n")
+		return nil
+	}
+	running := fmt.Sprintf("gen-%d", diff.Generation)
+	for _, a := range diff.Artifacts {
+		if a.Name == db.ArtifactEnvFile && !showEnv {
+			e.printf("%s changed, use --env to show its values\n", a.Name)
+			continue
+		}
+		var rb, sb []byte
+		if a.Running != "" {
+			if rb, err = os.ReadFile(a.Running); err != nil {
+				return fmt.Errorf("failed to read running %s: %w", a.Name, err)
+			}
+		}
+		if sb, err = os.ReadFile(a.Staged); err != nil {
+			return fmt.Errorf("failed to read staged %s: %w", a.Name, err)
+		}
+		if diffutil.IsBinary(rb) || diffutil.IsBinary(sb) {
+			e.printf("Binary %s differs\n", a.Name)
+			continue
+		}
+		oldName := fmt.Sprintf("%s (%s)", a.Name, running)
+		if a.Running == "" {
+			oldName = "/dev/null"
+		}
+		e.printf("%s", diffutil.Unified(oldName, fmt.Sprintf("%s (staged)", a.Name), rb, sb, lines))
+	}
+	for _, im := range diff.Images {
+		e.printf("Image %s: %s -> %s\n", im.Repo, shortDigest(im.Running), shortDigest(im.Staged))
+	}
+	return nil
+}
+
+// shortDigest returns the first 12 characters of the hex of digest d, or
+// "none".
+func shortDigest(d string) string {
+	if d == "" {
+		return "none"
+	}
+	if _, hex, ok := strings.Cut(d, ":"); ok {
+		d = hex
+	}
+	return d[:min(len(d), 12)]
+}
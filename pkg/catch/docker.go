@@ -25,6 +25,7 @@ import (
 
 	"github.com/yeetrun/yeet/pkg/svc"
 	"tailscale.com/logtail/backoff"
+	"tailscale.com/util/set"
 )
 
 var dockerComposeServiceStatus = map[string]ComponentStatus{
@@ -47,6 +48,10 @@ func (s *Server) monitorDocker() {
 	ctx := s.ctx
 	// Create a backoff mechanism for retrying on errors
 	bo := backoff.NewBackoff("docker-monitor", log.Printf, 60*time.Second)
+	// orphans are the compose projects without a service that were already
+	// reported.
+	orphans := make(set.Set[string])
+	checkedOrphans := false
 execLoop:
 	for {
 		select {
@@ -63,6 +68,10 @@ execLoop:
 			continue
 		}
 		bo.BackOff(ctx, nil) // reset backoff on success
+		if !checkedOrphans {
+			s.logComposeOrphans()
+			checkedOrphans = true
+		}
 
 		// Start Docker events monitoring
 		cmd := exec.CommandContext(ctx, docker, "events", "--format=json")
@@ -106,8 +115,11 @@ execLoop:
 			}
 
 			// Extract the service name from the Docker Compose project name
-			var sn string
-			if pn, ok := entry.Actor.Attributes["com.docker.compose.project"]; !ok {
+			var sn, cn string
+			if esn, ok := s.externalServiceFor("", entry.Actor.Attributes["name"]); ok {
+				// A container referenced by an external service.
+				sn, cn = esn, entry.Actor.Attributes["name"]
+			} else if pn, ok := entry.Actor.Attributes["com.docker.compose.project"]; !ok {
 				continue
 			} else if s, ok := strings.CutPrefix(pn, "catch-"); !ok {
 				continue
@@ -118,6 +130,12 @@ execLoop:
 			// Verify the service exists
 			if _, err := s.serviceView(sn); err != nil {
 				if errors.Is(err, errServiceNotFound) {
+					// Containers of removed services still stop after the
+					// service is gone, so only starts are reported.
+					if cn == "" && entry.Action == "start" && !orphans.Contains(sn) {
+						orphans.Add(sn)
+						log.Printf("compose project %q has no service; adopt or destroy it with `sys orphans`", "catch-"+sn)
+					}
 					continue
 				}
 				log.Printf("failed to get service view: %v", err)
@@ -125,10 +143,12 @@ execLoop:
 			}
 
 			// Get the Docker Compose service name
-			cn, ok := entry.Actor.Attributes["com.docker.compose.service"]
-			if !ok {
-				// No compose service.
-				continue
+			if cn == "" {
+				var ok bool
+				if cn, ok = entry.Actor.Attributes["com.docker.compose.service"]; !ok {
+					// No compose service.
+					continue
+				}
 			}
 
 			// Prepare the service status data
@@ -182,6 +202,7 @@ execLoop:
 					})
 				}
 				s.serviceStatus.mu.Unlock()
+				data.Status = ServiceStatus(data.ComponentStatus)
 				log.Printf("docker event: %s %s %s", sn, cn, entry.Action)
 				// Publish the service status change event
 				s.PublishEvent(Event{
@@ -0,0 +1,96 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"tailscale.com/util/mak"
+)
+
+// Edits of a service take an in-memory lease so that two people editing the
+// same service at once find out before one of them silently overwrites the
+// other. The lease is released when the edit session ends; it lapses after
+// maxEditLease in case a session is never cleaned up.
+
+// maxEditLease is how long an edit lease is honored.
+const maxEditLease = 2 * time.Hour
+
+// errEditConflict is returned when a service changed while it was being
+// edited.
+var errEditConflict = errors.New("edit conflict")
+
+// editLease records who is editing a service.
+type editLease struct {
+	actor   string
+	started time.Time
+}
+
+// acquireEditLease takes the edit lease of service sn for actor. If someone
+// else holds it, it returns an error unless force is set, in which case it
+// returns a warning and takes over the lease. The returned release func
+// gives up the lease if it is still held by this session.
+func (s *Server) acquireEditLease(sn, actor string, force bool) (release func(), warning string, err error) {
+	s.editLeases.mu.Lock()
+	defer s.editLeases.mu.Unlock()
+	now := time.Now()
+	if cur, ok := s.editLeases.m[sn]; ok && now.Sub(cur.started) < maxEditLease {
+		msg := fmt.Sprintf("service %q is being edited by %s since %s", sn, actorOrUnknown(cur.actor), formatAgo(now.Sub(cur.started)))
+		if !force {
+			return nil, "", fmt.Errorf("%s; use --force to edit anyway", msg)
+		}
+		warning = msg + "; the first edit to be saved wins"
+	}
+	l := &editLease{actor: actor, started: now}
+	mak.Set(&s.editLeases.m, sn, l)
+	return func() {
+		s.editLeases.mu.Lock()
+		defer s.editLeases.mu.Unlock()
+		if s.editLeases.m[sn] == l {
+			delete(s.editLeases.m, sn)
+		}
+	}, warning, nil
+}
+
+// editFingerprint returns a summary of the parts of sv an edit is based on.
+// With config, that is the whole service config; otherwise it is the
+// generations and artifacts of the service.
+func editFingerprint(sv db.ServiceView, config bool) string {
+	s := sv.AsStruct()
+	if config {
+		// Manual actions don't conflict with config edits.
+		s.LastAction = nil
+		return asJSON(s)
+	}
+	return asJSON(struct {
+		Generation       int
+		LatestGeneration int
+		Artifacts        db.ArtifactStore
+	}{s.Generation, s.LatestGeneration, s.Artifacts})
+}
+
+// checkEditBase returns an error wrapping errEditConflict if service s no
+// longer matches fingerprint, i.e. it was changed since the edit began. It
+// is called in the mutation that saves the edit, so that nothing can change
+// the service between the check and the write.
+func checkEditBase(s *db.Service, fingerprint string, config bool) error {
+	if editFingerprint(s.View(), config) != fingerprint {
+		return fmt.Errorf("%w: service %q was changed while it was being edited (now at generation %d); discard your changes and edit again", errEditConflict, s.Name, s.LatestGeneration)
+	}
+	return nil
+}
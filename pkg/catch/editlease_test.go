@@ -0,0 +1,49 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+func TestCheckEditBase(t *testing.T) {
+	s := &db.Service{Name: "web", Generation: 2, LatestGeneration: 2}
+	files := editFingerprint(s.View(), false)
+	config := editFingerprint(s.View(), true)
+
+	// Manual actions conflict with no edit.
+	s.LastAction = &db.ServiceAction{Action: "restart"}
+	if err := checkEditBase(s, config, true); err != nil {
+		t.Errorf("config edit after an action: %v", err)
+	}
+
+	// Config changes conflict with config edits only.
+	s.Description = "changed"
+	if err := checkEditBase(s, config, true); !errors.Is(err, errEditConflict) {
+		t.Errorf("config edit after a config change = %v, want %v", err, errEditConflict)
+	}
+	if err := checkEditBase(s, files, false); err != nil {
+		t.Errorf("file edit after a config change: %v", err)
+	}
+
+	// Deploys conflict with both.
+	s.Generation, s.LatestGeneration = 3, 3
+	if err := checkEditBase(s, files, false); !errors.Is(err, errEditConflict) {
+		t.Errorf("file edit after a deploy = %v, want %v", err, errEditConflict)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Events other than heartbeats are appended as JSON lines to the event log
+// in the root directory, so that what happened to a service can be looked
+// at later. When the log grows past eventLogMaxSize it is moved to
+// events.log.1, replacing the previous one, so at most two logs are kept.
+// The log is written by a single goroutine so that PublishEvent never waits
+// on the disk.
+
+const (
+	eventLogName = "events.log"
+	// eventLogMaxSize is the size in bytes at which the event log is rotated.
+	eventLogMaxSize = 8 << 20
+	// eventLogQueueSize is the number of events waiting to be written
+	// before new events are dropped from the log.
+	eventLogQueueSize = 256
+)
+
+type eventLog struct {
+	path    string
+	ch      chan Event
+	dropped atomic.Int64 // events not written because the queue was full
+}
+
+func newEventLog(rootDir string) *eventLog {
+	return &eventLog{
+		path: filepath.Join(rootDir, eventLogName),
+		ch:   make(chan Event, eventLogQueueSize),
+	}
+}
+
+// enqueue queues event to be written without blocking.
+func (l *eventLog) enqueue(event Event) {
+	select {
+	case l.ch <- event:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// writeEventLog writes the queued events to the event log until the server
+// is shut down.
+func (s *Server) writeEventLog() {
+	l := s.eventLog
+	var f *os.File
+	var size int64
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	write := func(event Event) error {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		b = append(b, '\n')
+		if f != nil && size+int64(len(b)) > eventLogMaxSize {
+			f.Close()
+			f = nil
+			if err := os.Rename(l.path, l.path+".1"); err != nil {
+				return fmt.Errorf("failed to rotate event log: %w", err)
+			}
+		}
+		if f == nil {
+			f, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				return err
+			}
+			st, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			size = st.Size()
+		}
+		n, err := f.Write(b)
+		size += int64(n)
+		return err
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			// Write what is already queued before returning.
+			for {
+				select {
+				case event := <-l.ch:
+					if err := write(event); err != nil {
+						log.Printf("failed to write event log: %v", err)
+					}
+				default:
+					return
+				}
+			}
+		case event := <-l.ch:
+			if err := write(event); err != nil {
+				log.Printf("failed to write event log: %v", err)
+			}
+		}
+	}
+}
+
+// eventHistory returns the logged events matching filter, or all events if
+// filter is nil, that happened at or after since, oldest first.
+func (s *Server) eventHistory(filter func(Event) bool, since time.Time) ([]Event, error) {
+	var events []Event
+	for _, p := range []string{s.eventLog.path + ".1", s.eventLog.path} {
+		f, err := os.Open(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to open event log: %w", err)
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			var event Event
+			if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+				// Skip lines cut short by a crash.
+				continue
+			}
+			if !since.IsZero() && event.Time < since.UnixMilli() {
+				continue
+			}
+			if filter == nil || filter(event) {
+				events = append(events, event)
+			}
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event log: %w", err)
+		}
+	}
+	return events, nil
+}
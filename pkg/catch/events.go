@@ -0,0 +1,200 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"tailscale.com/util/set"
+)
+
+// PublishEvent never blocks on listeners: each listener has a queue of
+// eventQueueSize events. When a listener falls behind, its oldest queued
+// events are dropped to make room, and once it has missed
+// maxListenerDrops events in a row it is disconnected. The last
+// eventHistorySize events are kept so that new listeners can catch up.
+// Events other than heartbeats are also written to the event log.
+
+const (
+	// eventQueueSize is the number of events queued for each listener.
+	eventQueueSize = 64
+	// maxListenerDrops is how many events in a row a listener may miss
+	// before it is disconnected. Heartbeats are published every second by
+	// default, so a listener that stopped reading is disconnected within a
+	// few minutes.
+	maxListenerDrops = 2 * eventQueueSize
+	// eventHistorySize is the number of recent events kept for replay.
+	eventHistorySize = 512
+)
+
+// EventListener receives the events matching its filter. Use Events to read
+// them and Done to find out if the listener was disconnected.
+type EventListener struct {
+	h      set.Handle
+	filter func(Event) bool
+	ch     chan Event
+	done   chan struct{}
+
+	// drops is the number of events dropped in a row. It is guarded by the
+	// eventListeners mutex of the Server.
+	drops int
+}
+
+// Events returns the channel events are delivered on.
+func (el *EventListener) Events() <-chan Event { return el.ch }
+
+// Done returns a channel that is closed when the listener is disconnected
+// for not keeping up with events.
+func (el *EventListener) Done() <-chan struct{} { return el.done }
+
+// EventStats are counters of the event bus.
+type EventStats struct {
+	// Listeners is the number of current listeners.
+	Listeners int `json:"listeners"`
+	// Dropped is the number of events dropped for slow listeners.
+	Dropped int64 `json:"dropped"`
+	// Disconnected is the number of listeners disconnected for being too
+	// slow.
+	Disconnected int64 `json:"disconnected"`
+}
+
+func (s *Server) PublishEvent(event Event) {
+	event.Version = EventSchemaVersion
+	event.Time = time.Now().UnixMilli()
+	if err := checkEventData(event); err != nil {
+		// Consumers rely on the schema, so this is a bug in catch.
+		log.Printf("publishing event that doesn't match the event schema: %v", err)
+	}
+	if event.Type != EventTypeHeartbeat {
+		s.apiCache.invalidate()
+	}
+	els := &s.eventListeners
+	els.mu.Lock()
+	defer els.mu.Unlock()
+	if event.Type != EventTypeHeartbeat {
+		if len(els.recent) >= eventHistorySize {
+			els.recent = slices.Delete(els.recent, 0, len(els.recent)-eventHistorySize+1)
+		}
+		els.recent = append(els.recent, event)
+		s.eventLog.enqueue(event)
+	}
+	for h, el := range els.s {
+		if el.filter != nil && !el.filter(event) {
+			continue
+		}
+		if s.deliverEvent(el, event) {
+			continue
+		}
+		if el.drops >= maxListenerDrops {
+			log.Printf("disconnecting event listener that missed %d events", el.drops)
+			delete(els.s, h)
+			close(el.done)
+			els.disconnected.Add(1)
+		}
+	}
+}
+
+// deliverEvent queues event for el without blocking, dropping the oldest
+// queued event if the queue is full. It reports whether the event was
+// queued without dropping one. s.eventListeners.mu must be held.
+func (s *Server) deliverEvent(el *EventListener, event Event) bool {
+	select {
+	case el.ch <- event:
+		el.drops = 0
+		return true
+	default:
+	}
+	// The queue is full, drop the oldest event. The listener may have read
+	// it in the meantime, in which case nothing is dropped.
+	select {
+	case <-el.ch:
+		el.drops++
+		s.eventListeners.dropped.Add(1)
+	default:
+	}
+	select {
+	case el.ch <- event:
+	default:
+		// Only PublishEvent sends, and it holds the lock, so this can't
+		// happen; count it rather than block if it does.
+		el.drops++
+		s.eventListeners.dropped.Add(1)
+	}
+	return false
+}
+
+// AddEventListener registers a listener for the events matching filter, or
+// all events if filter is nil. It must be removed with RemoveEventListener.
+func (s *Server) AddEventListener(filter func(Event) bool) *EventListener {
+	el, _ := s.AddEventListenerWithHistory(filter, 0, time.Time{})
+	return el
+}
+
+// AddEventListenerWithHistory is like AddEventListener but also returns the
+// recent events matching filter, oldest first, so that the listener starts
+// where they end: the last n events, or all kept events since since if it is
+// non-zero, or both limits if both are set. Heartbeats are never replayed.
+func (s *Server) AddEventListenerWithHistory(filter func(Event) bool, n int, since time.Time) (*EventListener, []Event) {
+	els := &s.eventListeners
+	els.mu.Lock()
+	defer els.mu.Unlock()
+	var history []Event
+	if n > 0 || !since.IsZero() {
+		for _, e := range els.recent {
+			if !since.IsZero() && e.Time < since.UnixMilli() {
+				continue
+			}
+			if filter == nil || filter(e) {
+				history = append(history, e)
+			}
+		}
+		if n > 0 && len(history) > n {
+			history = history[len(history)-n:]
+		}
+	}
+	el := &EventListener{
+		filter: filter,
+		ch:     make(chan Event, eventQueueSize),
+		done:   make(chan struct{}),
+	}
+	el.h = els.s.Add(el)
+	// Start heartbeats if they were paused for lack of listeners.
+	s.wakeMonitors()
+	return el, history
+}
+
+// RemoveEventListener unregisters el. It is a no-op if el was already
+// disconnected.
+func (s *Server) RemoveEventListener(el *EventListener) {
+	els := &s.eventListeners
+	els.mu.Lock()
+	defer els.mu.Unlock()
+	delete(els.s, el.h)
+}
+
+// EventStats returns the counters of the event bus.
+func (s *Server) EventStats() EventStats {
+	els := &s.eventListeners
+	els.mu.Lock()
+	n := len(els.s)
+	els.mu.Unlock()
+	return EventStats{
+		Listeners:    n,
+		Dropped:      els.dropped.Load(),
+		Disconnected: els.disconnected.Load(),
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"strconv"
+	"testing"
+)
+
+func publishN(s *Server, from, to int) {
+	for i := from; i < to; i++ {
+		s.PublishEvent(Event{ServiceName: strconv.Itoa(i), Type: EventTypeServiceWatchdog})
+	}
+}
+
+func TestEventListenerDropsOldest(t *testing.T) {
+	s := &Server{eventLog: newEventLog(t.TempDir())}
+	el := s.AddEventListener(nil)
+	defer s.RemoveEventListener(el)
+
+	const extra = 5
+	publishN(s, 0, eventQueueSize+extra)
+
+	if got := s.EventStats().Dropped; got != extra {
+		t.Errorf("Dropped = %d, want %d", got, extra)
+	}
+	// The queue holds the newest events, in order.
+	for i := extra; i < eventQueueSize+extra; i++ {
+		e := <-el.Events()
+		if want := strconv.Itoa(i); e.ServiceName != want {
+			t.Fatalf("got event %q, want %q", e.ServiceName, want)
+		}
+	}
+	select {
+	case e := <-el.Events():
+		t.Fatalf("unexpected event %q", e.ServiceName)
+	case <-el.Done():
+		t.Fatal("listener disconnected")
+	default:
+	}
+
+	// Delivering an event after the listener caught up resets its drops.
+	publishN(s, 0, 1)
+	s.eventListeners.mu.Lock()
+	drops := el.drops
+	s.eventListeners.mu.Unlock()
+	if drops != 0 {
+		t.Errorf("drops = %d after the listener caught up, want 0", drops)
+	}
+}
+
+func TestEventListenerDisconnect(t *testing.T) {
+	s := &Server{eventLog: newEventLog(t.TempDir())}
+	slow := s.AddEventListener(nil)
+	defer s.RemoveEventListener(slow)
+
+	// A listener that keeps up stays connected.
+	fast := s.AddEventListener(nil)
+	defer s.RemoveEventListener(fast)
+	// A listener whose filter matches nothing never drops.
+	filtered := s.AddEventListener(func(e Event) bool { return e.Type == EventTypeServiceDeleted })
+	defer s.RemoveEventListener(filtered)
+
+	for i := range eventQueueSize + maxListenerDrops - 1 {
+		publishN(s, i, i+1)
+		<-fast.Events()
+	}
+	select {
+	case <-slow.Done():
+		t.Fatalf("listener disconnected after %d drops, want %d", maxListenerDrops-1, maxListenerDrops)
+	default:
+	}
+
+	publishN(s, 0, 1)
+	<-fast.Events()
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatalf("listener not disconnected after %d drops", maxListenerDrops)
+	}
+	for _, el := range []*EventListener{fast, filtered} {
+		select {
+		case <-el.Done():
+			t.Errorf("listener that kept up was disconnected")
+		default:
+		}
+	}
+
+	st := s.EventStats()
+	if st.Listeners != 2 || st.Disconnected != 1 || st.Dropped != maxListenerDrops {
+		t.Errorf("EventStats = %+v, want 2 listeners, 1 disconnected, %d dropped", st, maxListenerDrops)
+	}
+	// Removing a disconnected listener is a no-op.
+	s.RemoveEventListener(slow)
+	if got := s.EventStats().Listeners; got != 2 {
+		t.Errorf("Listeners = %d, want 2", got)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// EventSchemaVersion is the version of the JSON encoding of events, sent as
+// the version field of every event on /api/v0/events, `yeet events` and the
+// event log.
+//
+// Within a version, event types and fields are only ever added: existing
+// ones keep their name, type and meaning, so consumers must ignore the types
+// and fields they don't know. Any other change bumps the version. Events
+// logged before versioning have no version field and are of version 1.
+const EventSchemaVersion = 1
+
+// The Data of each event type is described by eventDataTypes. The payloads
+// not defined elsewhere are below.
+
+// ServiceConfigData is the data of ServiceCreated and ServiceConfigChanged
+// events: the configuration of the service as stored by catch.
+type ServiceConfigData = db.Service
+
+// DeployRequestedData is the data of DeployRequested events: the deploy of
+// a protected service that awaits approval.
+type DeployRequestedData = db.PendingDeploy
+
+// DeployDecisionData is the data of DeployApproved and DeployDenied events.
+type DeployDecisionData struct {
+	// RequestedBy is who requested the deploy, if known.
+	RequestedBy string `json:"requestedBy"`
+	// ApprovedBy is who approved the deploy, for DeployApproved events.
+	ApprovedBy string `json:"approvedBy,omitempty"`
+	// DeniedBy is who denied the deploy, for DeployDenied events.
+	DeniedBy string `json:"deniedBy,omitempty"`
+}
+
+// eventDataTypes is the type of the Data of each event type, or nil for
+// event types without data.
+var eventDataTypes = map[EventType]reflect.Type{
+	EventTypeUnknown:              nil,
+	EventTypeHeartbeat:            nil,
+	EventTypeServiceStatusChanged: reflect.TypeFor[ServiceStatusData](),
+	EventTypeServiceDeleted:       nil,
+	EventTypeServiceCreated:       reflect.TypeFor[ServiceConfigData](),
+	EventTypeServiceConfigChanged: reflect.TypeFor[ServiceConfigData](),
+	EventTypeServiceConfigStaged:  reflect.TypeFor[ServiceConfigData](),
+	EventTypeServiceAction:        reflect.TypeFor[ServiceActionData](),
+	EventTypeServiceWatchdog:      nil,
+	EventTypeServiceHealthChanged: reflect.TypeFor[ServiceStatusData](),
+	EventTypeServiceRollback:      reflect.TypeFor[ServiceRollbackData](),
+	EventTypeInstallPhase:         reflect.TypeFor[InstallPhaseData](),
+	EventTypeDeployRequested:      reflect.TypeFor[DeployRequestedData](),
+	EventTypeDeployApproved:       reflect.TypeFor[DeployDecisionData](),
+	EventTypeDeployDenied:         reflect.TypeFor[DeployDecisionData](),
+}
+
+// checkEventData returns an error if the Data of event is not of the type
+// of its event type in eventDataTypes. Pointers to the type are accepted.
+func checkEventData(event Event) error {
+	want, ok := eventDataTypes[event.Type]
+	if !ok {
+		return fmt.Errorf("event type %q is not in the event schema", event.Type)
+	}
+	got := reflect.TypeOf(event.Data.Data)
+	if got != nil && got.Kind() == reflect.Pointer {
+		got = got.Elem()
+	}
+	if got != want {
+		return fmt.Errorf("%s event has data of type %v, want %v", event.Type, got, want)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the Data of the event into the type of its event
+// type in eventDataTypes, as a pointer. The data of event types not in the
+// schema, e.g. from a newer catch, is decoded as generic JSON values.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	type plainEvent Event
+	var raw struct {
+		plainEvent
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*e = Event(raw.plainEvent)
+	e.Data = EventData{}
+	if e.Version == 0 {
+		e.Version = 1
+	}
+	if len(raw.Data) == 0 || string(raw.Data) == "null" {
+		return nil
+	}
+	t, ok := eventDataTypes[e.Type]
+	if !ok || t == nil {
+		return json.Unmarshal(raw.Data, &e.Data)
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(raw.Data, v.Interface()); err != nil {
+		return fmt.Errorf("invalid data for %s event: %w", e.Type, err)
+	}
+	e.Data.Data = v.Interface()
+	return nil
+}
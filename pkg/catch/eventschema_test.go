@@ -0,0 +1,147 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestEventSchemaJSON pins the JSON encoding of events. Within an
+// EventSchemaVersion, fields may only be added: if this test fails because a
+// field was renamed or removed, bump the version instead of the test.
+func TestEventSchemaJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "Heartbeat",
+			event: Event{Version: 1, Time: 1, ServiceName: "sys", Type: EventTypeHeartbeat},
+			want:  `{"version":1,"time":1,"serviceName":"sys","type":"Heartbeat","data":null}`,
+		},
+		{
+			name: "ServiceStatusChanged",
+			event: Event{Version: 1, Time: 1, ServiceName: "web", Type: EventTypeServiceStatusChanged, Data: EventData{ServiceStatusData{
+				ServiceName:     "web",
+				ServiceType:     ServiceDataTypeService,
+				ComponentStatus: []ComponentStatusData{{Name: "web", Status: ComponentStatusRunning}},
+				Status:          ComponentStatusRunning,
+			}}},
+			want: `{"version":1,"time":1,"serviceName":"web","type":"ServiceStatusChanged","data":{"serviceName":"web","serviceType":"service","components":[{"name":"web","status":"running","restarts":0}],"status":"running"}}`,
+		},
+		{
+			name: "ServiceRollback",
+			event: Event{Version: 1, Time: 1, ServiceName: "web", Type: EventTypeServiceRollback, Data: EventData{ServiceRollbackData{
+				FromGeneration: 3, ToGeneration: 2, Reason: "crashed",
+			}}},
+			want: `{"version":1,"time":1,"serviceName":"web","type":"ServiceRollback","data":{"fromGeneration":3,"toGeneration":2,"reason":"crashed"}}`,
+		},
+		{
+			name: "InstallPhase",
+			event: Event{Version: 1, Time: 1, ServiceName: "web", Type: EventTypeInstallPhase, Data: EventData{InstallPhaseData{
+				Phase: InstallPhaseStaged, Duration: 2, Elapsed: 3,
+			}}},
+			want: `{"version":1,"time":1,"serviceName":"web","type":"InstallPhase","data":{"phase":"staged","duration":2,"elapsed":3}}`,
+		},
+		{
+			name: "DeployApproved",
+			event: Event{Version: 1, Time: 1, ServiceName: "web", Type: EventTypeDeployApproved, Data: EventData{DeployDecisionData{
+				RequestedBy: "alice", ApprovedBy: "bob",
+			}}},
+			want: `{"version":1,"time":1,"serviceName":"web","type":"DeployApproved","data":{"requestedBy":"alice","approvedBy":"bob"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkEventData(tt.event); err != nil {
+				t.Fatalf("checkEventData: %v", err)
+			}
+			b, err := json.Marshal(tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got  %s\nwant %s", b, tt.want)
+			}
+		})
+	}
+}
+
+// TestEventRoundTrip checks that decoding an event gives its data the type
+// of the schema, and encodes back to the same JSON.
+func TestEventRoundTrip(t *testing.T) {
+	in := Event{Version: 1, Time: 1, ServiceName: "web", Type: EventTypeServiceAction, Data: EventData{ServiceActionData{Action: "stop", Actor: "alice", Time: 2}}}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Event
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.Data.Data.(*ServiceActionData); !ok {
+		t.Fatalf("data is %T, want *ServiceActionData", out.Data.Data)
+	}
+	if err := checkEventData(out); err != nil {
+		t.Errorf("checkEventData: %v", err)
+	}
+	b2, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(b2) {
+		t.Errorf("round trip changed the event:\n got %s\nwant %s", b2, b)
+	}
+}
+
+func TestEventUnmarshalCompat(t *testing.T) {
+	// Events logged before versioning have no version, and events from a
+	// newer catch may have unknown types and fields.
+	var e Event
+	if err := json.Unmarshal([]byte(`{"time":1,"serviceName":"web","type":"ServiceRollback","data":{"fromGeneration":3,"toGeneration":2,"new":true}}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != 1 {
+		t.Errorf("version = %d, want 1", e.Version)
+	}
+	if got, want := e.Data.Data, (&ServiceRollbackData{FromGeneration: 3, ToGeneration: 2}); !reflect.DeepEqual(got, want) {
+		t.Errorf("data = %#v, want %#v", got, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"version":1,"time":1,"type":"SomethingNew","data":{"a":1}}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Data.Data, map[string]any{"a": float64(1)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("data = %#v, want %#v", got, want)
+	}
+}
+
+func TestCheckEventData(t *testing.T) {
+	if err := checkEventData(Event{Type: EventTypeServiceRollback, Data: EventData{&ServiceRollbackData{}}}); err != nil {
+		t.Errorf("pointer data: %v", err)
+	}
+	if err := checkEventData(Event{Type: EventTypeServiceRollback, Data: EventData{map[string]string{}}}); err == nil {
+		t.Error("wrong data type: got nil error")
+	}
+	if err := checkEventData(Event{Type: EventTypeServiceDeleted, Data: EventData{ServiceStatusData{}}}); err == nil {
+		t.Error("data on event without data: got nil error")
+	}
+	if err := checkEventData(Event{Type: "SomethingNew"}); err == nil {
+		t.Error("unknown event type: got nil error")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+)
+
+// execCmdFunc runs a one-off command in the environment of the service: in
+// its main container for docker compose services, or as a transient unit
+// with the user, env file, network namespace and sandbox of its unit for
+// systemd services.
+func (e *ttyExecer) execCmdFunc(cmd *cobra.Command, args []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot exec in %q", e.sn)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no command given, use yeet exec <svc> -- <cmd>")
+	}
+	sv, err := e.s.serviceView(e.sn)
+	if err != nil {
+		return err
+	}
+	var c *exec.Cmd
+	switch sv.ServiceType() {
+	case db.ServiceTypeDockerCompose:
+		service, err := e.s.dockerComposeService(e.sn)
+		if err != nil {
+			return err
+		}
+		service.NewCmd = e.newCmd
+		container, _ := cmd.Flags().GetString("container")
+		if container == "" {
+			if container, err = e.s.mainContainer(e.sn); err != nil {
+				return err
+			}
+		}
+		if c, err = service.ExecCmd(container, e.isPty, args...); err != nil {
+			return err
+		}
+	case db.ServiceTypeSystemd:
+		if c, err = e.systemdExecCmd(sv, args); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("exec is not supported for %s services", sv.ServiceType())
+	}
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to run command: %w", err)
+	}
+	return nil
+}
+
+// systemdExecCmd returns a command that runs args like systemd service sv
+// does, see systemdRunArgs, with a pseudo-terminal if the session has one.
+func (e *ttyExecer) systemdExecCmd(sv db.ServiceView, args []string) (*exec.Cmd, error) {
+	rargs, err := e.s.systemdRunArgs(sv, 0)
+	if err != nil {
+		return nil, err
+	}
+	if e.isPty {
+		rargs[slices.Index(rargs, "--pipe")] = "--pty"
+	}
+	rargs = append(rargs, args...)
+	return e.newCmd(rargs[0], rargs[1:]...), nil
+}
+
+// systemdRunArgs returns the systemd-run command line that runs a command
+// like systemd service sv: as its user, with its env file and in its network
+// namespace, root directory and sandbox. The command is run in a transient
+// unit, so it is stopped after timeout if that is set.
+func (s *Server) systemdRunArgs(sv db.ServiceView, timeout time.Duration) ([]string, error) {
+	arts := sv.AsStruct().Artifacts
+	unit, ok := arts.Gen(db.ArtifactSystemdUnit, sv.Generation())
+	if !ok {
+		return nil, fmt.Errorf("service %q has no unit file", sv.Name())
+	}
+	units := []string{unit}
+	if p, ok := arts.Gen(db.ArtifactSystemdOverride, sv.Generation()); ok {
+		units = append(units, p)
+	}
+	// Secrets are loaded as credentials by a drop-in under /run.
+	if p := secretsDropInPath(sv.Name()); fileExists(p) {
+		units = append(units, p)
+	}
+	props, err := svc.RunProperties(units...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read unit of %q: %w", sv.Name(), err)
+	}
+	args := []string{"systemd-run", "--quiet", "--collect", "--wait", "--pipe", "--service-type=exec"}
+	if timeout > 0 {
+		args = append(args, "-p", fmt.Sprintf("RuntimeMaxSec=%dms", timeout.Milliseconds()))
+	}
+	return append(args, props...), nil
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// mainContainer returns the container of docker compose service sn that
+// exec runs in: the compose service named after sn, or the only running
+// one.
+func (s *Server) mainContainer(sn string) (string, error) {
+	statuses, err := s.DockerComposeStatus(sn)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := statuses[sn]; ok {
+		return sn, nil
+	}
+	var running []string
+	for c, st := range statuses {
+		if st == svc.StatusRunning {
+			running = append(running, c)
+		}
+	}
+	switch len(running) {
+	case 0:
+		return "", fmt.Errorf("service %q has no running containers", sn)
+	case 1:
+		return running[0], nil
+	}
+	slices.Sort(running)
+	return "", fmt.Errorf("service %q has several containers, pick one with --container: %s", sn, strings.Join(running, ", "))
+}
+
+// readEnvFile reads the KEY=VALUE lines of the env file at p, skipping
+// blank lines and comments and unquoting quoted values like systemd does.
+func readEnvFile(p string) ([]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	defer f.Close()
+	var env []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		env = append(env, strings.TrimSpace(k)+"="+unquoteEnvValue(strings.TrimSpace(v)))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	return env, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+)
+
+// External services reference a systemd unit or docker container that is
+// installed and managed by something else. yeet reports their status, logs
+// and events alongside its own services but never starts, stops or removes
+// the underlying unit or container.
+
+var errExternalService = fmt.Errorf("service is external and not managed by yeet")
+
+// externalDataType returns the ServiceDataType used to report ext.
+func externalDataType(ext *db.ExternalService) ServiceDataType {
+	if ext != nil && ext.Container != "" {
+		return ServiceDataTypeDocker
+	}
+	return ServiceDataTypeService
+}
+
+// externalComponent returns the component name of ext in status output.
+func externalComponent(sn string, ext *db.ExternalService) string {
+	if ext != nil && ext.Container != "" {
+		return ext.Container
+	}
+	return sn
+}
+
+// externalStatus returns the status of the unit or container referenced by
+// ext.
+func externalStatus(ext *db.ExternalService) (svc.Status, error) {
+	if ext == nil {
+		return svc.StatusUnknown, fmt.Errorf("external service has no reference")
+	}
+	if ext.Unit != "" {
+		out, _ := exec.Command("systemctl", "is-active", ext.Unit).Output()
+		switch strings.TrimSpace(string(out)) {
+		case "active", "reloading", "activating", "deactivating":
+			return svc.StatusRunning, nil
+		case "inactive", "failed":
+			return svc.StatusStopped, nil
+		}
+		return svc.StatusUnknown, nil
+	}
+	docker, err := svc.DockerCmd()
+	if err != nil {
+		return svc.StatusUnknown, err
+	}
+	out, err := exec.Command(docker, "inspect", "--format={{.State.Status}}", ext.Container).Output()
+	if err != nil {
+		return svc.StatusUnknown, nil
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "running", "restarting":
+		return svc.StatusRunning, nil
+	case "created", "exited", "paused", "dead":
+		return svc.StatusStopped, nil
+	}
+	return svc.StatusUnknown, nil
+}
+
+// externalStatusData returns the status of external service sn.
+func (s *Server) externalStatusData(sn string, ext *db.ExternalService) ServiceStatusData {
+	st, err := externalStatus(ext)
+	if err != nil {
+		st = svc.StatusUnknown
+	}
+	return ServiceStatusData{
+		ServiceName: sn,
+		ServiceType: externalDataType(ext),
+		Status:      ComponentStatusFromServiceStatus(st),
+		ComponentStatus: []ComponentStatusData{
+			{
+				Name:   externalComponent(sn, ext),
+				Status: ComponentStatusFromServiceStatus(st),
+			},
+		},
+	}
+}
+
+// externalServiceFor returns the name of the external service referencing
+// the given systemd unit or docker container.
+func (s *Server) externalServiceFor(unit, container string) (string, bool) {
+	dv, err := s.getDB()
+	if err != nil {
+		return "", false
+	}
+	for sn, sv := range dv.Services().All() {
+		ext := sv.External()
+		if sv.ServiceType() != db.ServiceTypeExternal || ext == nil {
+			continue
+		}
+		if (unit != "" && ext.Unit == unit) || (container != "" && ext.Container == container) {
+			return sn, true
+		}
+	}
+	return "", false
+}
+
+// externalServiceRunner is the ServiceRunner of an external service. It only
+// supports showing logs.
+type externalServiceRunner struct {
+	ext    *db.ExternalService
+	newCmd func(string, ...string) *exec.Cmd
+}
+
+func (s *externalServiceRunner) SetNewCmd(f func(string, ...string) *exec.Cmd) {
+	s.newCmd = f
+}
+
+func (s *externalServiceRunner) Start() error   { return errExternalService }
+func (s *externalServiceRunner) Stop() error    { return errExternalService }
+func (s *externalServiceRunner) Restart() error { return errExternalService }
+
+// Remove does nothing; removing an external service only forgets it.
+func (s *externalServiceRunner) Remove() error { return nil }
+
+func (s *externalServiceRunner) Logs(opts *svc.LogOptions) error {
+	if opts == nil {
+		opts = &svc.LogOptions{}
+	}
+	var c *exec.Cmd
+	if s.ext.Unit != "" {
+		c = s.newCmd("journalctl", append(opts.JournalctlArgs(), "--unit="+s.ext.Unit)...)
+	} else {
+		docker, err := svc.DockerCmd()
+		if err != nil {
+			return err
+		}
+		args := append([]string{"logs"}, opts.DockerArgs()...)
+		c = s.newCmd(docker, append(args, s.ext.Container)...)
+		flush, err := svc.FilterLogs(c, opts.Grep)
+		if err != nil {
+			return err
+		}
+		defer flush()
+	}
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to show logs: %w", err)
+	}
+	return nil
+}
+
+func (e *ttyExecer) externalCmdFunc(cmd *cobra.Command, _ []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot make %q external", e.sn)
+	}
+	unit, _ := cmd.Flags().GetString("unit")
+	container, _ := cmd.Flags().GetString("container")
+	if (unit == "") == (container == "") {
+		return fmt.Errorf("exactly one of --unit and --container is required")
+	}
+	if unit != "" && !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		if s.ServiceType != "" && s.ServiceType != db.ServiceTypeExternal {
+			return fmt.Errorf("service %q is managed by yeet; remove it first", e.sn)
+		}
+		s.ServiceType = db.ServiceTypeExternal
+		s.External = &db.ExternalService{Unit: unit, Container: container}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	e.printf("service %q now tracks %s\n", e.sn, cmp.Or(unit, container))
+	return nil
+}
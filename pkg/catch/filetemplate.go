@@ -0,0 +1,109 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// Uploaded compose and env files may contain Go template placeholders, e.g.
+// {{.ServiceName}} or {{.TailscaleIP}}, so that the same file can be deployed
+// to several services and hosts. Rendering is opt-in: clients mark the next
+// file as a template by uploading to tmpl or stage/tmpl before it, as yeet
+// does for files named *.tmpl. The file is rendered once, when it is
+// uploaded, so later changes like a new Tailscale IP need a new upload. A
+// literal "{{" is written as {{"{{"}}.
+
+// templateMarkPath returns the path of the mark uploaded to tmpl for the next
+// file of service sn.
+func (s *Server) templateMarkPath(sn string) string {
+	return filepath.Join(s.serviceBinDir(sn), "next.tmpl")
+}
+
+// fileTemplateData is the data available to compose and env file templates.
+type fileTemplateData struct {
+	s *Server
+
+	// ServiceName is the name of the service.
+	ServiceName string
+	// DataDir is the service's data directory on the host.
+	DataDir string
+	// RunDir is the service's run directory on the host.
+	RunDir string
+	// Hostname is the hostname of the host.
+	Hostname string
+}
+
+// TailscaleIP returns the Tailscale IPv4 address of the host. It is a method
+// so that the host is only asked when a template uses it.
+func (d fileTemplateData) TailscaleIP() (string, error) {
+	if d.s.cfg.LocalClient == nil {
+		return "", fmt.Errorf("tailscale is not available")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st, err := d.s.cfg.LocalClient.StatusWithoutPeers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get tailscale status: %w", err)
+	}
+	for _, ip := range st.TailscaleIPs {
+		if ip.Is4() {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("host has no tailscale IPv4 address")
+}
+
+func (s *Server) fileTemplateData(sn, dataDir string) fileTemplateData {
+	hostname, _ := os.Hostname()
+	return fileTemplateData{
+		s:           s,
+		ServiceName: sn,
+		DataDir:     dataDir,
+		RunDir:      s.serviceRunDir(sn),
+		Hostname:    hostname,
+	}
+}
+
+// renderFileTemplate renders the template in the file at src for service sn
+// with data directory dataDir and writes the result to dst, which may be src.
+// It reports whether src was a template; if not, dst is left alone.
+func (s *Server) renderFileTemplate(sn, dataDir, src, dst string) (bool, error) {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Contains(b, []byte("{{")) {
+		return false, nil
+	}
+	t, err := template.New("file").Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, s.fileTemplateData(sn, dataDir)); err != nil {
+		return false, fmt.Errorf("failed to render template: %w", err)
+	}
+	if err := os.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,459 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/set"
+)
+
+// gcRegistryGracePeriod is how old an unreferenced registry blob or manifest
+// must be before it is collected, so that an in-progress push is not
+// collected before it is referenced.
+const gcRegistryGracePeriod = time.Hour
+
+// gcPhase is one of the cleanup subsystems run by `sys gc`. run returns the
+// items it removed, or would remove with dryRun.
+type gcPhase struct {
+	name string
+	run  func(dryRun bool) ([]string, error)
+}
+
+// gcPhaseResult is the outcome of running a gcPhase.
+type gcPhaseResult struct {
+	name     string
+	items    []string
+	duration time.Duration
+	err      error
+}
+
+func (s *Server) gcPhases() []gcPhase {
+	return []gcPhase{
+		{"generations", s.gcGenerations},
+		{"registry", s.gcRegistry},
+		{"rootfs", s.gcRootfs},
+		{"docker", s.gcDockerImages},
+		{"units", s.gcOrphanedUnits},
+		{"archives", s.gcArchives},
+		{"log exports", s.removeExpiredLogExports},
+	}
+}
+
+// runGC runs all cleanup phases in order. A failing phase does not stop the
+// later ones.
+func (s *Server) runGC(dryRun bool) []gcPhaseResult {
+	var results []gcPhaseResult
+	for _, p := range s.gcPhases() {
+		start := time.Now()
+		items, err := p.run(dryRun)
+		results = append(results, gcPhaseResult{
+			name:     p.name,
+			items:    items,
+			duration: time.Since(start),
+			err:      err,
+		})
+		if err != nil {
+			log.Printf("gc: %s: %v", p.name, err)
+		}
+	}
+	return results
+}
+
+func (s *Server) gcGenerations(dryRun bool) ([]string, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for sn := range dv.Services().All() {
+		r, err := s.pruneGenerations(sn, dryRun)
+		if err != nil {
+			return removed, fmt.Errorf("%s: %w", sn, err)
+		}
+		removed = append(removed, r...)
+	}
+	return removed, nil
+}
+
+func (s *Server) gcRegistry(dryRun bool) ([]string, error) {
+	return s.pruneRegistry(dryRun, gcRegistryGracePeriod)
+}
+
+// pruneRegistry drops image references to pruned generations and removes
+// the manifests and blobs of the internal registry that are no longer
+// referenced, directly or through a manifest list, by any image. Files
+// younger than grace are kept, so that pushes in flight, whose blobs arrive
+// before the manifest referencing them, are not collected. For the same
+// reason, blobs are not collected at all while a blob upload is in flight,
+// as a push that takes longer than grace has older blobs.
+func (s *Server) pruneRegistry(dryRun bool, grace time.Duration) ([]string, error) {
+	var removed []string
+	prune := func(d *db.Data) error {
+		for rn, ir := range d.Images {
+			sn, _, _ := strings.Cut(string(rn), "/")
+			sv, ok := d.Services[sn]
+			if !ok {
+				continue
+			}
+			minGen := minGeneration(d, sv)
+			for ref := range ir.Refs {
+				if gen, ok := parseGenRef(db.ArtifactRef(ref)); ok && gen < minGen {
+					removed = append(removed, fmt.Sprintf("%s:%s", rn, ref))
+					delete(ir.Refs, ref)
+				}
+			}
+		}
+		return nil
+	}
+	var d *db.Data
+	if dryRun {
+		dv, err := s.getDB()
+		if err != nil {
+			return nil, err
+		}
+		d = dv.AsStruct()
+		prune(d)
+	} else {
+		var err error
+		if d, err = s.cfg.DB.MutateData(prune); err != nil {
+			return nil, err
+		}
+	}
+
+	cr := s.registry
+	manifests := make(set.Set[string])
+	blobs := make(set.Set[string])
+	var mark func(hex string)
+	mark = func(hex string) {
+		if manifests.Contains(hex) {
+			return
+		}
+		manifests.Add(hex)
+		b, err := cr.readManifest(hex)
+		if err != nil {
+			log.Printf("gc: %v", err)
+			return
+		}
+		if idx, err := v1.ParseIndexManifest(bytes.NewReader(b)); err == nil && idx.MediaType.IsIndex() {
+			for _, m := range idx.Manifests {
+				mark(m.Digest.Hex)
+			}
+			return
+		}
+		m, err := v1.ParseManifest(bytes.NewReader(b))
+		if err != nil {
+			log.Printf("gc: failed to parse manifest %s: %v", hex, err)
+			return
+		}
+		blobs.Add(m.Config.Digest.Hex)
+		for _, l := range m.Layers {
+			blobs.Add(l.Digest.Hex)
+		}
+	}
+	for _, ir := range d.Images {
+		for _, m := range ir.Refs {
+			mark(m.BlobHash)
+		}
+	}
+
+	sweep := func(dir string, keep set.Set[string], grace time.Duration) error {
+		ents, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		for _, e := range ents {
+			if keep.Contains(e.Name()) {
+				continue
+			}
+			if fi, err := e.Info(); err != nil || time.Since(fi.ModTime()) < grace {
+				continue
+			}
+			p := filepath.Join(dir, e.Name())
+			if !dryRun {
+				if err := os.Remove(p); err != nil {
+					log.Printf("gc: %v", err)
+					continue
+				}
+			}
+			removed = append(removed, p)
+		}
+		return nil
+	}
+	if err := sweep(filepath.Join(cr.manifestDir, "sha256"), manifests, grace); err != nil {
+		return removed, err
+	}
+	if cr.limits.uploadsInFlight() {
+		log.Printf("gc: skipping registry blobs, an upload is in flight")
+		return removed, nil
+	}
+	if err := sweep(filepath.Join(s.cfg.RegistryRoot, "blobs", "sha256"), blobs, grace); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// gcRootfs removes the unpacked image root filesystems that are not used by
+// any retained generation of their service.
+func (s *Server) gcRootfs(dryRun bool) ([]string, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for sn, sv := range dv.Services().All() {
+		ents, err := os.ReadDir(filepath.Join(s.serviceRootDir(sn), "rootfs"))
+		if err != nil {
+			continue
+		}
+		inUse := set.Set[string]{}
+		unreadable := false
+		if a, ok := sv.AsStruct().Artifacts[db.ArtifactSystemdUnit]; ok {
+			for _, p := range a.Refs {
+				dir, err := svc.UnitRootDirectory(p)
+				if err != nil && !os.IsNotExist(err) {
+					log.Printf("gc: %v", err)
+					unreadable = true
+					break
+				}
+				if dir != "" {
+					inUse.Add(dir)
+				}
+			}
+		}
+		if unreadable {
+			// Don't guess which of them are in use.
+			continue
+		}
+		for _, e := range ents {
+			dir := filepath.Join(s.serviceRootDir(sn), "rootfs", e.Name())
+			if inUse.Contains(dir) {
+				continue
+			}
+			if !dryRun {
+				if err := os.RemoveAll(dir); err != nil {
+					log.Printf("gc: %v", err)
+					continue
+				}
+			}
+			removed = append(removed, dir)
+		}
+	}
+	return removed, nil
+}
+
+// gcDockerImages removes dangling docker images.
+func (s *Server) gcDockerImages(dryRun bool) ([]string, error) {
+	docker, err := svc.DockerCmd()
+	if err != nil {
+		return nil, nil // Nothing to do without docker.
+	}
+	out, err := exec.Command(docker, "images", "--filter", "dangling=true", "--format", "{{.ID}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dangling images: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	if dryRun || len(ids) == 0 {
+		return ids, nil
+	}
+	if out, err := exec.Command(docker, "image", "prune", "--force").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to prune images: %w: %s", err, out)
+	}
+	return ids, nil
+}
+
+// gcOrphanedUnits removes the netns and tailscale units and network
+// namespaces of services that no longer exist.
+func (s *Server) gcOrphanedUnits(dryRun bool) ([]string, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	var reload bool
+	for _, suffix := range []string{"-ns.service", "-ts.service"} {
+		units, _ := filepath.Glob("/etc/systemd/system/yeet-*" + suffix)
+		for _, p := range units {
+			unit := filepath.Base(p)
+			sn := strings.TrimSuffix(strings.TrimPrefix(unit, "yeet-"), suffix)
+			if dv.Services().Contains(sn) {
+				continue
+			}
+			if !dryRun {
+				if out, err := exec.Command("systemctl", "disable", "--now", unit).CombinedOutput(); err != nil {
+					log.Printf("gc: failed to disable %s: %v: %s", unit, err, out)
+					continue
+				}
+				if err := os.Remove(p); err != nil {
+					log.Printf("gc: %v", err)
+					continue
+				}
+				reload = true
+			}
+			removed = append(removed, p)
+		}
+	}
+	if reload {
+		if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+			return removed, fmt.Errorf("failed to reload systemd: %w", err)
+		}
+	}
+	nss, _ := filepath.Glob("/var/run/netns/yeet-*-ns")
+	for _, p := range nss {
+		ns := filepath.Base(p)
+		sn := strings.TrimSuffix(strings.TrimPrefix(ns, "yeet-"), "-ns")
+		if dv.Services().Contains(sn) {
+			continue
+		}
+		if !dryRun {
+			if out, err := exec.Command("ip", "netns", "delete", ns).CombinedOutput(); err != nil {
+				log.Printf("gc: failed to delete netns %q: %v: %s", ns, err, out)
+				continue
+			}
+		}
+		removed = append(removed, "netns "+ns)
+	}
+	return removed, nil
+}
+
+func (s *Server) gcArchives(dryRun bool) ([]string, error) {
+	var removed []string
+	for _, as := range s.purgeExpiredArchives(dryRun) {
+		removed = append(removed, as.Dir)
+	}
+	return removed, nil
+}
+
+// gcLoop runs the garbage collector every Data.GCInterval, if set.
+func (s *Server) gcLoop() {
+	last := time.Now()
+	for {
+		wake := s.monitorWake()
+		sleep := s.monitorInterval()
+		if dv, err := s.getDB(); err == nil && dv.GCInterval() > 0 {
+			if wait := dv.GCInterval() - time.Since(last); wait > 0 {
+				sleep = min(sleep, wait)
+			} else {
+				last = time.Now()
+				for _, r := range s.runGC(false) {
+					log.Printf("gc: %s: removed %d items in %v", r.name, len(r.items), r.duration.Round(time.Millisecond))
+				}
+				continue
+			}
+		}
+		if !s.sleepUntil(sleep, wake) {
+			return
+		}
+	}
+}
+
+// sysGCCmdFunc runs all cleanup phases and prints a report.
+func (e *ttyExecer) sysGCCmdFunc(cmd *cobra.Command, _ []string) error {
+	if cmd.Flags().Changed("every") {
+		every, _ := cmd.Flags().GetDuration("every")
+		if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			d.GCInterval = every
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to set gc interval: %w", err)
+		}
+		e.s.wakeMonitors()
+		if every > 0 {
+			e.printf("Garbage collection scheduled every %v\n", every)
+		} else {
+			e.printf("Scheduled garbage collection disabled\n")
+		}
+		return nil
+	}
+	if cmd.Flags().Changed("keep-generations") {
+		keep, _ := cmd.Flags().GetInt("keep-generations")
+		if keep < 0 {
+			return fmt.Errorf("invalid number of generations %d", keep)
+		}
+		if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			d.KeepGenerations = keep
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to set generations to keep: %w", err)
+		}
+		e.printf("Keeping %d previous generations of services that don't set their own\n", cmp.Or(keep, defaultKeepGenerations))
+		return nil
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	results := e.s.runGC(dryRun)
+
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	if verbose || dryRun {
+		for _, r := range results {
+			for _, it := range r.items {
+				e.printf("%s: %s %s\n", r.name, verb, it)
+			}
+		}
+	}
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "PHASE\tITEMS\tDURATION\tERROR\t")
+	for _, r := range results {
+		errStr := "-"
+		if r.err != nil {
+			errStr = r.err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%v\t%s\t\n", r.name, len(r.items), r.duration.Round(time.Millisecond), errStr)
+	}
+	return nil
+}
+
+// registryPruneCmdFunc removes the unreferenced manifests and blobs of the
+// internal registry.
+func (e *ttyExecer) registryPruneCmdFunc(cmd *cobra.Command) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	grace, _ := cmd.Flags().GetDuration("grace")
+	if grace < 0 {
+		return fmt.Errorf("--grace must not be negative")
+	}
+	removed, err := e.s.pruneRegistry(dryRun, grace)
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	for _, it := range removed {
+		e.printf("%s %s\n", verb, it)
+	}
+	if err != nil {
+		return err
+	}
+	e.printf("%s %d items\n", verb, len(removed))
+	return nil
+}
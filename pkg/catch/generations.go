@@ -0,0 +1,272 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+)
+
+// GenerationInfo describes a retained generation of a service.
+type GenerationInfo struct {
+	Generation int  `json:"generation"`
+	Active     bool `json:"active"`
+	// DeployedAt is when the generation was first installed in milliseconds
+	// since the epoch, or 0 if the audit trail doesn't say.
+	DeployedAt int64 `json:"deployedAt,omitempty"`
+	// Actor and User are who installed the generation, from the audit
+	// trail.
+	Actor string `json:"actor,omitempty"`
+	User  string `json:"user,omitempty"`
+	// Binary and Compose are the short sha256 hashes of the binary and
+	// compose file of the generation, if it has them.
+	Binary  string `json:"binary,omitempty"`
+	Compose string `json:"compose,omitempty"`
+	// Images maps the image repos of the service to their short digest in
+	// the generation.
+	Images map[string]string `json:"images,omitempty"`
+}
+
+// retainedGenerations returns the generations of service sn that can still
+// be rolled back to, newest first.
+func (s *Server) retainedGenerations(sn string) ([]GenerationInfo, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	d := dv.AsStruct()
+	service, ok := d.Services[sn]
+	if !ok {
+		return nil, errServiceNotFound
+	}
+	trail, err := s.auditTrail(sn, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	var gens []GenerationInfo
+	for gen := service.LatestGeneration; gen >= max(minGeneration(d, service), 1); gen-- {
+		if !hasGeneration(service, gen) {
+			continue
+		}
+		gi := GenerationInfo{
+			Generation: gen,
+			Active:     gen == service.Generation,
+			Images:     map[string]string{},
+		}
+		if i := slices.IndexFunc(trail, func(ae AuditEntry) bool {
+			return ae.Generation == gen && ae.Error == "" &&
+				(ae.Action == AuditActionInstall || ae.Action == AuditActionAdopt)
+		}); i >= 0 {
+			gi.DeployedAt = trail[i].Time
+			gi.Actor = trail[i].Actor
+			gi.User = trail[i].User
+		}
+		if p, ok := service.Artifacts.Gen(db.ArtifactBinary, gen); ok {
+			gi.Binary = fileHash(p)
+		}
+		if p, ok := service.Artifacts.Gen(db.ArtifactDockerComposeFile, gen); ok {
+			gi.Compose = fileHash(p)
+		}
+		for rn, ir := range d.Images {
+			repoSvc, repo, _ := strings.Cut(string(rn), "/")
+			if repoSvc != sn {
+				continue
+			}
+			if m, ok := ir.Refs[db.ImageRef(db.Gen(gen))]; ok {
+				gi.Images[repo] = shortDigest(m.BlobHash)
+			}
+		}
+		gens = append(gens, gi)
+	}
+	return gens, nil
+}
+
+// hasGeneration reports whether any artifact of service s is referenced by
+// generation gen.
+func hasGeneration(s *db.Service, gen int) bool {
+	for _, a := range s.Artifacts {
+		if _, ok := a.Refs[db.Gen(gen)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHash returns the first 12 hex characters of the sha256 of the file at
+// p, or "missing" if it can't be read.
+func fileHash(p string) string {
+	if h := fullFileHash(p); h != "" {
+		return h[:12]
+	}
+	return "missing"
+}
+
+// fullFileHash returns the hex sha256 of the file at p, or "" if it can't be
+// read.
+func fullFileHash(p string) string {
+	f, err := os.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (e *ttyExecer) generationsCmdFunc(cmd *cobra.Command, _ []string) error {
+	formatOut, _ := cmd.Flags().GetString("format")
+	gens, err := e.s.retainedGenerations(e.sn)
+	if err != nil {
+		return err
+	}
+	switch formatOut {
+	case "json":
+		return json.NewEncoder(e.rw).Encode(gens)
+	case "json-pretty":
+		enc := json.NewEncoder(e.rw)
+		enc.SetIndent("", "  ")
+		return enc.Encode(gens)
+	case "table":
+	default:
+		return fmt.Errorf("unknown format %q, use table, json or json-pretty", formatOut)
+	}
+	if len(gens) == 0 {
+		e.printf("No generations\n")
+		return nil
+	}
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "GEN\tACTIVE\tDEPLOYED\tBY\tBINARY\tCOMPOSE\tIMAGES\t")
+	for _, gi := range gens {
+		active, deployed := "", "-"
+		if gi.Active {
+			active = "*"
+		}
+		if gi.DeployedAt != 0 {
+			deployed = time.UnixMilli(gi.DeployedAt).Format(time.DateTime)
+		}
+		by := "-"
+		if gi.Actor != "" || gi.User != "" {
+			by = actorOrUnknown(gi.Actor)
+			if gi.User != "" {
+				by += " (" + gi.User + ")"
+			}
+		}
+		var images []string
+		for _, repo := range slices.Sorted(maps.Keys(gi.Images)) {
+			images = append(images, repo+"@"+gi.Images[repo])
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", gi.Generation, active, deployed, by,
+			cmp.Or(gi.Binary, "-"), cmp.Or(gi.Compose, "-"), cmp.Or(strings.Join(images, ","), "-"))
+	}
+	return nil
+}
+
+// generationForDigest returns the newest retained generation of service s,
+// other than the active one, whose binary has sha256 digest or whose image
+// has manifest digest, after checking the artifact still exists. digest may
+// be prefixed with "sha256:" and abbreviated to at least 12 hex characters.
+// It hashes binaries, so d and service should be a snapshot rather than be
+// read under the DB lock.
+func (s *Server) generationForDigest(d *db.Data, service *db.Service, digest string) (int, error) {
+	hex := strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+	if len(hex) < 12 || len(hex) > 64 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return 0, fmt.Errorf("invalid digest %q, expected sha256:<hex> with at least 12 hex characters", digest)
+	}
+	active := false
+	for gen := service.LatestGeneration; gen >= max(minGeneration(d, service), 1); gen-- {
+		if !hasGeneration(service, gen) {
+			continue
+		}
+		var found string
+		for rn, ir := range d.Images {
+			if repoSvc, _, _ := strings.Cut(string(rn), "/"); repoSvc != service.Name {
+				continue
+			}
+			if m, ok := ir.Refs[db.ImageRef(db.Gen(gen))]; ok && strings.HasPrefix(m.BlobHash, hex) {
+				if err := s.checkImageBlobs(m.BlobHash); err != nil {
+					return 0, fmt.Errorf("image %s of generation %d is no longer in the registry: %w", shortDigest(m.BlobHash), gen, err)
+				}
+				found = "image"
+				break
+			}
+		}
+		if found == "" {
+			if p, ok := service.Artifacts.Gen(db.ArtifactBinary, gen); ok {
+				if _, err := os.Stat(p); err == nil && strings.HasPrefix(fullFileHash(p), hex) {
+					found = "binary"
+				}
+			}
+		}
+		if found == "" {
+			continue
+		}
+		if gen == service.Generation {
+			active = true
+			continue
+		}
+		return gen, nil
+	}
+	if active {
+		return 0, fmt.Errorf("digest %s is already active", shortDigest(hex))
+	}
+	return 0, fmt.Errorf("no retained generation has digest %s, see `yeet generations`", shortDigest(hex))
+}
+
+// checkImageBlobs reports an error if the manifest with sha256 hex, or the
+// config or any layer it references, is missing from the registry. Manifests
+// of an index are checked in turn.
+func (s *Server) checkImageBlobs(hex string) error {
+	b, err := s.registry.readManifest(hex)
+	if err != nil {
+		return fmt.Errorf("manifest %s is missing", shortDigest(hex))
+	}
+	if idx, err := v1.ParseIndexManifest(bytes.NewReader(b)); err == nil && idx.MediaType.IsIndex() {
+		for _, m := range idx.Manifests {
+			if err := s.checkImageBlobs(m.Digest.Hex); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %w", shortDigest(hex), err)
+	}
+	for _, desc := range append([]v1.Descriptor{m.Config}, m.Layers...) {
+		if _, err := os.Stat(filepath.Join(s.cfg.RegistryRoot, "blobs", desc.Digest.Algorithm, desc.Digest.Hex)); err != nil {
+			return fmt.Errorf("blob %s is missing", shortDigest(desc.Digest.Hex))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// Health checks of systemd services are probed by catch itself. Docker
+// compose services use the healthchecks of their containers instead, which
+// are read from docker along with the other runtime info.
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthRetries  = 3
+)
+
+// healthState is the result of the health checks of a service.
+type healthState struct {
+	status   ComponentStatus
+	failures int    // consecutive failed probes
+	lastErr  string // error of the last failed probe
+	next     time.Time
+	probing  bool
+	check    db.HealthCheck // the check the state is for
+}
+
+// healthLoop probes the health checks of all services that have one. It
+// sleeps until the next probe is due, and is woken up when a probe finishes
+// or a check changes.
+func (s *Server) healthLoop() {
+	for {
+		wake := s.monitorWake()
+		if !s.sleepUntil(s.startDueProbes(s.monitorInterval()), wake) {
+			return
+		}
+	}
+}
+
+// startDueProbes starts the health probes that are due and returns how long
+// until the next one is, at most sleep.
+func (s *Server) startDueProbes(sleep time.Duration) time.Duration {
+	dv, err := s.getDB()
+	if err != nil {
+		return sleep
+	}
+	now := time.Now()
+	s.serviceStatus.mu.Lock()
+	for sn := range s.serviceStatus.health {
+		sv, ok := dv.Services().GetOk(sn)
+		if !ok || sv.HealthCheck() == nil || sv.ServiceType() != db.ServiceTypeSystemd {
+			delete(s.serviceStatus.health, sn)
+		}
+	}
+	var due []string
+	for sn, sv := range dv.Services().All() {
+		hc := sv.HealthCheck()
+		if hc == nil || sv.ServiceType() != db.ServiceTypeSystemd {
+			continue
+		}
+		st, ok := s.serviceStatus.health[sn]
+		if !ok || st.check != *hc {
+			// New or changed check, start over.
+			st = &healthState{status: ComponentStatusStarting, check: *hc}
+			mak.Set(&s.serviceStatus.health, sn, st)
+		}
+		if st.probing {
+			continue
+		}
+		if now.Before(st.next) {
+			sleep = min(sleep, st.next.Sub(now))
+			continue
+		}
+		st.probing = true
+		due = append(due, sn)
+	}
+	s.serviceStatus.mu.Unlock()
+	for _, sn := range due {
+		go s.probeHealth(sn)
+	}
+	return sleep
+}
+
+// probeHealth runs one probe of the health check of sn and records the
+// result, publishing an event if the health changed.
+func (s *Server) probeHealth(sn string) {
+	s.serviceStatus.mu.Lock()
+	st, ok := s.serviceStatus.health[sn]
+	if !ok {
+		s.serviceStatus.mu.Unlock()
+		return
+	}
+	hc := st.check
+	s.serviceStatus.mu.Unlock()
+
+	var err error
+	if running, _ := s.IsServiceRunning(sn); !running {
+		// Stopped services are not probed; report them as starting once
+		// they come back.
+		err = errHealthNotRunning
+	} else {
+		ctx, cancel := context.WithTimeout(s.ctx, cmp.Or(hc.Timeout, defaultHealthTimeout))
+		err = s.runHealthProbe(ctx, sn, hc)
+		cancel()
+	}
+
+	s.serviceStatus.mu.Lock()
+	if s.serviceStatus.health[sn] != st {
+		// The check was changed or removed while probing.
+		s.serviceStatus.mu.Unlock()
+		return
+	}
+	st.probing = false
+	st.next = time.Now().Add(cmp.Or(hc.Interval, defaultHealthInterval))
+	prev := st.status
+	switch {
+	case err == errHealthNotRunning:
+		st.status = ComponentStatusStarting
+		st.failures = 0
+		st.lastErr = ""
+	case err != nil:
+		st.failures++
+		st.lastErr = err.Error()
+		if st.failures >= cmp.Or(hc.Retries, defaultHealthRetries) {
+			st.status = ComponentStatusUnhealthy
+		}
+	default:
+		st.status = ComponentStatusHealthy
+		st.failures = 0
+		st.lastErr = ""
+	}
+	health, lastErr := st.status, st.lastErr
+	s.serviceStatus.mu.Unlock()
+	// Let the health loop schedule the next probe.
+	s.wakeMonitors()
+	if health == prev {
+		return
+	}
+	log.Printf("Service %q health: %v", sn, health)
+	s.PublishEvent(Event{
+		Type:        EventTypeServiceHealthChanged,
+		ServiceName: sn,
+		Data: EventData{Data: ServiceStatusData{
+			ServiceName: sn,
+			ServiceType: ServiceDataTypeService,
+			ComponentStatus: []ComponentStatusData{
+				{
+					Name:        sn,
+					Status:      ComponentStatusRunning,
+					Health:      health,
+					HealthError: lastErr,
+				},
+			},
+		}},
+	})
+}
+
+var errHealthNotRunning = fmt.Errorf("service is not running")
+
+// runHealthProbe runs the probe of hc once in the network namespace of sn.
+func (s *Server) runHealthProbe(ctx context.Context, sn string, hc db.HealthCheck) error {
+	paths, err := s.serviceNetNSPaths(sn)
+	if err != nil {
+		return err
+	}
+	nsPath := paths[0]
+	switch {
+	case hc.HTTP != "":
+		tr := &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialInNetNS(ctx, nsPath, network, addr)
+			},
+			DisableKeepAlives: true,
+		}
+		defer tr.CloseIdleConnections()
+		req, err := http.NewRequestWithContext(ctx, "GET", hc.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("%s returned %s", hc.HTTP, resp.Status)
+		}
+		return nil
+	case hc.TCP != "":
+		c, err := dialInNetNS(ctx, nsPath, "tcp", hc.TCP)
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	case hc.Exec != "":
+		sv, err := s.serviceView(sn)
+		if err != nil {
+			return err
+		}
+		// Run as the service runs, not as root on the host.
+		var timeout time.Duration
+		if d, ok := ctx.Deadline(); ok {
+			timeout = time.Until(d)
+		}
+		args, err := s.systemdRunArgs(sv, timeout)
+		if err != nil {
+			return err
+		}
+		args = append(args, "sh", "-c", hc.Exec)
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("%w: %s", err, msg)
+			}
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("health check has no probe")
+}
+
+// serviceHealth returns the health of systemd service sn and the error of
+// its last failed probe. It returns an empty status if sn has no health
+// check.
+func (s *Server) serviceHealth(sn string) (ComponentStatus, string) {
+	s.serviceStatus.mu.Lock()
+	defer s.serviceStatus.mu.Unlock()
+	st, ok := s.serviceStatus.health[sn]
+	if !ok {
+		return "", ""
+	}
+	return st.status, st.lastErr
+}
+
+// healthCmdFunc shows, sets or removes the health check of a systemd
+// service.
+func (e *ttyExecer) healthCmdFunc(cmd *cobra.Command, _ []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("health checks are not supported for %q", e.sn)
+	}
+	sv, err := e.s.serviceView(e.sn)
+	if err != nil {
+		return err
+	}
+	off, _ := cmd.Flags().GetBool("off")
+	var probes []string
+	for _, name := range []string{"http", "tcp", "exec"} {
+		if cmd.Flags().Changed(name) {
+			probes = append(probes, "--"+name)
+		}
+	}
+	if !off && len(probes) == 0 {
+		hc := sv.HealthCheck()
+		if hc == nil {
+			e.printf("no health check\n")
+			return nil
+		}
+		e.printf("%s every %v, timeout %v, unhealthy after %d failures\n",
+			hc.Probe(), cmp.Or(hc.Interval, defaultHealthInterval), cmp.Or(hc.Timeout, defaultHealthTimeout), cmp.Or(hc.Retries, defaultHealthRetries))
+		if st, lastErr := e.s.serviceHealth(e.sn); st != "" {
+			e.printf("health: %s\n", st)
+			if lastErr != "" {
+				e.printf("last error: %s\n", lastErr)
+			}
+		}
+		return nil
+	}
+	if off && len(probes) > 0 {
+		return fmt.Errorf("--off cannot be used with %s", strings.Join(probes, ", "))
+	}
+	var hc *db.HealthCheck
+	if !off {
+		if len(probes) > 1 {
+			return fmt.Errorf("only one of %s can be set", strings.Join(probes, ", "))
+		}
+		if sv.ServiceType() != db.ServiceTypeSystemd {
+			return fmt.Errorf("health checks are only supported for systemd services; compose services use the healthcheck of their containers")
+		}
+		hc = &db.HealthCheck{
+			HTTP:     First(cmd.Flags().GetString("http")),
+			TCP:      First(cmd.Flags().GetString("tcp")),
+			Exec:     First(cmd.Flags().GetString("exec")),
+			Interval: First(cmd.Flags().GetDuration("interval")),
+			Timeout:  First(cmd.Flags().GetDuration("timeout")),
+			Retries:  First(cmd.Flags().GetInt("retries")),
+		}
+		if err := validateHealthCheck(hc); err != nil {
+			return err
+		}
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		s.HealthCheck = hc
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	e.s.wakeMonitors()
+	if hc == nil {
+		e.printf("Health check of %q removed\n", e.sn)
+	} else {
+		e.printf("Health check of %q set to %s\n", e.sn, hc.Probe())
+	}
+	return nil
+}
+
+// validateHealthCheck returns an error if hc can't be probed.
+func validateHealthCheck(hc *db.HealthCheck) error {
+	if hc.HTTP != "" {
+		u, err := url.Parse(hc.HTTP)
+		if err != nil {
+			return fmt.Errorf("invalid --http: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid --http %q: must be an http or https URL", hc.HTTP)
+		}
+	}
+	if hc.TCP != "" {
+		if _, _, err := net.SplitHostPort(hc.TCP); err != nil {
+			return fmt.Errorf("invalid --tcp: %w", err)
+		}
+	}
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.Retries < 0 {
+		return fmt.Errorf("--interval, --timeout and --retries must not be negative")
+	}
+	return nil
+}
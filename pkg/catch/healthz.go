@@ -0,0 +1,115 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"tailscale.com/types/opt"
+)
+
+// /healthz is meant for uptime monitors outside of yeet, so unlike the API
+// it does not require the caller to be authorized unless Config.HealthzAuth
+// is set. It only reports counts, never service names.
+
+// Values of HealthzData.Status.
+const (
+	HealthzOK       = "ok"
+	HealthzDegraded = "degraded"
+	HealthzError    = "error"
+)
+
+// HealthzData is the response of /healthz.
+type HealthzData struct {
+	// Status is ok if catch and all services are healthy, degraded if some
+	// services are not, and error if the health of the services could not
+	// be determined.
+	Status  string `json:"status"`
+	Version string `json:"version"`
+	// Services is the number of services.
+	Services int `json:"services"`
+	// Unhealthy is the number of services that fail their health check or
+	// are not running without having been stopped.
+	Unhealthy int    `json:"unhealthy"`
+	Error     string `json:"error,omitempty"`
+}
+
+// healthz returns the health of catch and its services.
+func (s *Server) healthz() (HealthzData, error) {
+	hd := HealthzData{Status: HealthzOK, Version: VersionCommit()}
+	statuses, err := s.serviceStatusesWith(SystemService, statusDetails{runtime: true})
+	if err != nil {
+		return hd, err
+	}
+	hd.Services = len(statuses)
+	for _, st := range statuses {
+		if !serviceHealthy(st) {
+			hd.Unhealthy++
+		}
+	}
+	if hd.Unhealthy > 0 {
+		hd.Status = HealthzDegraded
+	}
+	return hd, nil
+}
+
+// serviceHealthy reports whether no component of st fails its health check
+// and, unless the service is a cron job or was stopped on purpose, all of
+// them are running.
+func serviceHealthy(st ServiceStatusData) bool {
+	if slices.ContainsFunc(st.ComponentStatus, func(c ComponentStatusData) bool {
+		return c.Health == ComponentStatusUnhealthy
+	}) {
+		return false
+	}
+	if st.ServiceType == ServiceDataTypeCron || (st.LastAction != nil && st.LastAction.Action == "stop") {
+		return true
+	}
+	return !slices.ContainsFunc(st.ComponentStatus, func(c ComponentStatusData) bool {
+		return c.Status == ComponentStatusStopped || c.Status == ComponentStatusUnknown
+	})
+}
+
+// handleHealthz serves the health of catch and the number of unhealthy
+// services. It responds with 503 if the health could not be determined, or
+// with strict=true also if any service is unhealthy.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.HealthzAuth {
+		if err := s.verifyCaller(r.Context(), r.RemoteAddr); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	code := http.StatusOK
+	var hd HealthzData
+	e, err := s.apiCache.get("healthz", func() (any, error) {
+		return s.healthz()
+	})
+	if err == nil {
+		err = json.Unmarshal(e.body, &hd)
+	}
+	if err != nil {
+		hd = HealthzData{Status: HealthzError, Version: VersionCommit(), Error: err.Error()}
+		code = http.StatusServiceUnavailable
+	} else if strict, _ := opt.Bool(r.URL.Query().Get("strict")).Get(); strict && hd.Unhealthy > 0 {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(hd)
+}
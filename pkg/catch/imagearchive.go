@@ -0,0 +1,263 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/preflight"
+	"github.com/yeetrun/yeet/pkg/svc"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/layout"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// Image archives, tarballs written by `docker save` or of an OCI image
+// layout, can be uploaded with run and stage like any other file. catch
+// imports the image into its registry as the staged image of the service and
+// installs it as a docker compose service, for clients that have the image
+// but can't reach the registry.
+
+// importImageArchive imports the image in the archive at p into the registry
+// as the staged image of service sn. It returns the image reference and its
+// manifest.
+func (s *Server) importImageArchive(ctx context.Context, sn, p string) (image string, manifest []byte, _ error) {
+	img, container, cleanup, err := loadImageArchive(p)
+	if err != nil {
+		return "", nil, err
+	}
+	defer cleanup()
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read image config: %w", err)
+	}
+	if err := preflight.CheckImage("in archive", cf.OS, cf.Architecture, runtime.GOOS, runtime.GOARCH); err != nil {
+		return "", nil, err
+	}
+
+	blobs := filepath.Join(s.cfg.RegistryRoot, "blobs")
+	put := func(h v1.Hash, open func() (io.ReadCloser, error)) error {
+		if _, err := os.Stat(filepath.Join(blobs, h.Algorithm, h.Hex)); err == nil {
+			return nil
+		}
+		rc, err := open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return putVerifiedBlob(blobs, h, rc)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read image layers: %w", err)
+	}
+	for _, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to digest layer: %w", err)
+		}
+		if err := put(h, l.Compressed); err != nil {
+			return "", nil, fmt.Errorf("failed to import layer %s: %w", h, err)
+		}
+	}
+	ch, err := img.ConfigName()
+	if err != nil {
+		return "", nil, err
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := put(ch, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(rawConfig)), nil
+	}); err != nil {
+		return "", nil, fmt.Errorf("failed to import image config: %w", err)
+	}
+
+	if manifest, err = img.RawManifest(); err != nil {
+		return "", nil, err
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return "", nil, err
+	}
+	mh, err := s.registry.storeManifest(manifest)
+	if err != nil {
+		return "", nil, err
+	}
+	repo := sn + "/" + cmp.Or(container, sn)
+	if _, err := s.registry.setRefs(repo, mh, string(mt), []string{"staged"}); err != nil {
+		return "", nil, fmt.Errorf("failed to tag image: %w", err)
+	}
+	return fmt.Sprintf("%s/%s", svc.InternalRegistryHost, repo), manifest, nil
+}
+
+// loadImageArchive loads the image in the archive at p. container is the
+// name to store it as, from its repo tag if it has one, or empty. cleanup
+// removes the files extracted to load it.
+func loadImageArchive(p string) (img v1.Image, container string, cleanup func(), _ error) {
+	cleanup = func() {}
+	opener := func() (io.ReadCloser, error) { return os.Open(p) }
+	m, err := tarball.LoadManifest(opener)
+	if err == nil {
+		if len(m) != 1 {
+			return nil, "", cleanup, fmt.Errorf("archive contains %d images, expected 1", len(m))
+		}
+		if len(m[0].RepoTags) > 0 {
+			repo := m[0].RepoTags[0]
+			if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+				repo = repo[:i]
+			}
+			container = path.Base(repo)
+		}
+		img, err := tarball.Image(opener, nil)
+		if err != nil {
+			return nil, "", cleanup, fmt.Errorf("failed to load docker archive: %w", err)
+		}
+		return img, container, cleanup, nil
+	}
+
+	// Not a docker archive, so it must be an OCI image layout, which can
+	// only be read from a directory.
+	dir, err := os.MkdirTemp(filepath.Dir(p), "oci-layout-")
+	if err != nil {
+		return nil, "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := ExtractTar(p, dir); err != nil {
+		return nil, "", cleanup, fmt.Errorf("failed to extract OCI layout: %w", err)
+	}
+	lp, err := layout.FromPath(dir)
+	if err != nil {
+		return nil, "", cleanup, fmt.Errorf("not an OCI image layout: %w", err)
+	}
+	idx, err := lp.ImageIndex()
+	if err != nil {
+		return nil, "", cleanup, fmt.Errorf("failed to read OCI image index: %w", err)
+	}
+	if img, err = preflight.PlatformImage(idx, runtime.GOOS, runtime.GOARCH); err != nil {
+		return nil, "", cleanup, err
+	}
+	return img, "", cleanup, nil
+}
+
+// ExtractTar extracts the regular files and directories of the tarball at p
+// into dir.
+func ExtractTar(p, dir string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(h.Name) {
+			return fmt.Errorf("invalid path %q in archive", h.Name)
+		}
+		dst := filepath.Join(dir, h.Name)
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600|os.FileMode(h.Mode)&0700)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// composeForImageArchive returns the compose file to install the image
+// imported for service sn with: its staged compose file if it has one, or
+// one rendered from the compose template.
+func (s *Server) composeForImageArchive(sn, image string, manifest []byte) ([]byte, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	d := dv.AsStruct()
+	if sv, ok := d.Services[sn]; ok {
+		if p, ok := sv.Artifacts.Staged(db.ArtifactDockerComposeFile); ok {
+			return os.ReadFile(p)
+		}
+	}
+	cf, err := s.renderComposeFile(d, sn, image, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render compose file: %w", err)
+	}
+	return []byte(cf), nil
+}
+
+// putVerifiedBlob writes the blob read from r to the blob store at dir under
+// its digest h, refusing it if its content doesn't hash to h. The archive is
+// uploaded by the user, so nothing guarantees that its layers match the
+// digests of its manifest.
+func putVerifiedBlob(dir string, h v1.Hash, r io.Reader) error {
+	if h.Algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest algorithm %q", h.Algorithm)
+	}
+	f, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	hw := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hw), r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hw.Sum(nil)); got != h.Hex {
+		return fmt.Errorf("digest mismatch: got sha256:%s, want %s", got, h)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, h.Algorithm), 0755); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, h.Algorithm, h.Hex))
+}
@@ -0,0 +1,47 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+)
+
+func TestPutVerifiedBlob(t *testing.T) {
+	dir := t.TempDir()
+	h, _, err := v1.SHA256(strings.NewReader("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := putVerifiedBlob(dir, h, strings.NewReader("tampered")); err == nil {
+		t.Fatal("putVerifiedBlob of mismatched content succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, h.Algorithm, h.Hex)); !os.IsNotExist(err) {
+		t.Errorf("mismatched blob was stored: %v", err)
+	}
+	if err := putVerifiedBlob(dir, h, strings.NewReader("layer")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, h.Algorithm, h.Hex)); err != nil || string(b) != "layer" {
+		t.Errorf("stored blob = %q, %v; want %q", b, err, "layer")
+	}
+	if ents, _ := filepath.Glob(filepath.Join(dir, "upload-*")); len(ents) > 0 {
+		t.Errorf("temporary files left behind: %v", ents)
+	}
+}
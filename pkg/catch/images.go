@@ -0,0 +1,132 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+// imagesCmdFunc lists the images in the internal registry, or deletes a tag
+// with `images rm`.
+func (e *ttyExecer) imagesCmdFunc(cmd *cobra.Command, args []string) error {
+	if cmd.CalledAs() == "rm" {
+		return e.imagesRmCmdFunc(cmd, args)
+	}
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	var repos []db.ImageRepoName
+	for rn := range dv.Images().All() {
+		sn, _, _ := strings.Cut(string(rn), "/")
+		if e.sn == SystemService || sn == e.sn {
+			repos = append(repos, rn)
+		}
+	}
+	slices.Sort(repos)
+
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "REPO\tTAG\tDIGEST\tSIZE\t")
+	for _, rn := range repos {
+		refs := dv.Images().Get(rn).Refs()
+		tags := slices.Sorted(maps.Keys(refs.AsMap()))
+		for _, tag := range tags {
+			m := refs.Get(tag)
+			size := "-"
+			if n, err := e.s.registry.imageSize(m.BlobHash); err == nil {
+				size = humanReadableBytes(float64(n))
+			}
+			fmt.Fprintf(w, "%s\t%s\tsha256:%.12s\t%s\t\n", rn, tag, m.BlobHash, size)
+		}
+	}
+	return nil
+}
+
+// imageSize returns the size of the config and layers of the image with
+// manifest hash mh, for the host platform if it is an index.
+func (cr *containerRegistry) imageSize(mh string) (int64, error) {
+	b, err := cr.readManifest(mh)
+	if err != nil {
+		return 0, err
+	}
+	m, err := cr.platformManifest(b)
+	if err != nil {
+		return 0, err
+	}
+	n := m.Config.Size
+	for _, l := range m.Layers {
+		n += l.Size
+	}
+	return n, nil
+}
+
+// imagesRmCmdFunc deletes the tag given as <svc>/<img>:<tag> from the
+// internal registry and removes the manifests and blobs no longer referenced.
+func (e *ttyExecer) imagesRmCmdFunc(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one image reference, e.g. web/web:v1")
+	}
+	repo, tag, ok := strings.Cut(args[0], ":")
+	if !ok || tag == "" || strings.Count(repo, "/") != 1 {
+		return fmt.Errorf("invalid image reference %q, expected <svc>/<img>:<tag>", args[0])
+	}
+	rn := db.ImageRepoName(repo)
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	ir, ok := dv.Images().GetOk(rn)
+	if !ok {
+		return fmt.Errorf("no image repo %q", repo)
+	}
+	if _, ok := ir.Refs().GetOk(db.ImageRef(tag)); !ok {
+		return fmt.Errorf("no tag %q in %q", tag, repo)
+	}
+	force, _ := cmd.Flags().GetBool("force")
+	sn, _, _ := strings.Cut(repo, "/")
+	if sv, installed := dv.Services().GetOk(sn); installed && !force {
+		if tag == "latest" || tag == string(db.Gen(sv.Generation())) {
+			return fmt.Errorf("%s is the running image of %q; pass --force to delete it anyway", args[0], sn)
+		}
+	}
+
+	cr := e.s.registry
+	unlock := cr.writes.lockRepo(rn)
+	err = cr.writes.update(manifestRefUpdate{repo: rn, del: []db.ImageRef{db.ImageRef(tag)}})
+	unlock()
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", args[0], err)
+	}
+	e.printf("Deleted %s\n", args[0])
+
+	grace, _ := cmd.Flags().GetDuration("grace")
+	if grace < 0 {
+		return fmt.Errorf("--grace must not be negative")
+	}
+	removed, err := e.s.pruneRegistry(false, grace)
+	if err != nil {
+		return fmt.Errorf("failed to remove unreferenced blobs: %w", err)
+	}
+	e.printf("Removed %d unreferenced manifests and blobs\n", len(removed))
+	return nil
+}
@@ -16,8 +16,10 @@ package catch
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -27,6 +29,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -38,8 +41,8 @@ import (
 	"github.com/yeetrun/yeet/pkg/fileutil"
 	"github.com/yeetrun/yeet/pkg/ftdetect"
 	"github.com/yeetrun/yeet/pkg/netns"
+	"github.com/yeetrun/yeet/pkg/preflight"
 	"github.com/yeetrun/yeet/pkg/svc"
-	"tailscale.com/net/netmon"
 	"tailscale.com/tstime/rate"
 	"tailscale.com/types/lazy"
 	"tailscale.com/util/mak"
@@ -55,10 +58,138 @@ type FileInstallerCfg struct {
 	StageOnly bool
 	NoBinary  bool
 
+	// DataDir, if set, overrides the data directory of the service. It is
+	// staged with the file and recorded in the service config, for all
+	// future installs, when that is committed.
+	DataDir string
+
+	// Watchdog, if set, changes the systemd watchdog interval of the
+	// service; zero disables the watchdog.
+	Watchdog *time.Duration
+
+	// AllowPrivileged, if set, changes whether privileged containers are
+	// allowed in the compose file of the service. It is recorded in the
+	// service config and used for all future installs.
+	AllowPrivileged *bool
+
+	// NoAutoRollback, if set, changes whether new generations that crash
+	// right after the deploy are rolled back. It is recorded in the service
+	// config and used for all future installs, including those of registry
+	// pushes.
+	NoAutoRollback *bool
+
+	// Resources, if set, changes the resource limits of the service. They
+	// are staged with the file and recorded in the service config when it
+	// is committed, then used for all future installs.
+	Resources *ResourceOpts
+
+	// Needs, if non-nil, replaces the services the service needs, which it
+	// requires and is started after. They are recorded in the service config
+	// and used for all future installs.
+	Needs []string
+
+	// Metrics, if set, changes where Prometheus scrapes the metrics of the
+	// service, as "<port>[/path]"; empty removes it. It is recorded in the
+	// service config.
+	Metrics *string
+
+	// KeepGenerations, if set, changes how many previous generations of the
+	// service are kept for rollbacks; 0 uses the host's setting. It is
+	// recorded in the service config.
+	KeepGenerations *int
+
+	// RequireSigned, if set, changes whether files and images of the
+	// service must be signed by a trusted key, including the file being
+	// installed. It is recorded in the service config. It can only be
+	// turned off with `trust require`.
+	RequireSigned *bool
+
+	// FromImage is set if the file comes from an image pushed to the
+	// internal registry, whose cosign signature is verified instead of a
+	// minisign signature of the file.
+	FromImage bool
+
+	// StageDefaultsApplied records in the service config that the host's
+	// stage defaults were applied to this config, so that they are not
+	// applied again.
+	StageDefaultsApplied bool
+
+	// UploadID, if set, makes the upload resumable: the file is received
+	// into a part file named after it that is kept if the upload is
+	// interrupted, and only installed once the hex prefix of its SHA-256
+	// matches UploadID.
+	UploadID string
+	// UploadOffset is where the upload continues in the part file, which
+	// is truncated to it.
+	UploadOffset int64
+	// UploadJoin, if set, first makes the ranges of the upload sent in
+	// parallel its part file, and continues the upload after them.
+	UploadJoin bool
+
 	// NewCmd, if set, will be used to create a new exec.Cmd.
 	NewCmd func(name string, arg ...string) *exec.Cmd
 }
 
+// ResourceOpts are changes to the resource limits of a service. Nil fields
+// are left as they are and zero removes the limit.
+type ResourceOpts struct {
+	CPU *float64
+	// Memory is a size like "512M" or "2G".
+	Memory   *string
+	IOWeight *int
+}
+
+// apply applies the changes of o to rl and returns the result, which is zero
+// if no limits are left.
+func (o *ResourceOpts) apply(rl *db.ResourceLimits) *db.ResourceLimits {
+	var n db.ResourceLimits
+	if rl != nil {
+		n = *rl
+	}
+	if o.CPU != nil {
+		n.CPU = *o.CPU
+	}
+	if o.Memory != nil {
+		n.Memory, _ = parseByteSize(*o.Memory)
+	}
+	if o.IOWeight != nil {
+		n.IOWeight = *o.IOWeight
+	}
+	return &n
+}
+
+// validate returns an error if any of the limits is invalid.
+func (o *ResourceOpts) validate() error {
+	if o.CPU != nil && *o.CPU < 0 {
+		return fmt.Errorf("invalid cpu limit %v", *o.CPU)
+	}
+	if o.Memory != nil {
+		if _, err := parseByteSize(*o.Memory); err != nil {
+			return fmt.Errorf("invalid memory limit: %w", err)
+		}
+	}
+	if o.IOWeight != nil && (*o.IOWeight < 0 || *o.IOWeight > 10000) {
+		return fmt.Errorf("invalid io weight %d, must be between 1 and 10000, or 0 to remove it", *o.IOWeight)
+	}
+	return nil
+}
+
+// parseByteSize parses a size in bytes with an optional K, M, G or T suffix
+// in powers of 1024, e.g. "512M".
+func parseByteSize(v string) (int64, error) {
+	n := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(v)), "B")
+	mult := int64(1)
+	if i := strings.IndexAny(n, "KMGT"); i >= 0 && i == len(n)-1 {
+		mult = 1 << (10 * (strings.IndexByte("KMGT", n[i]) + 1))
+		n = n[:i]
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return int64(f * float64(mult)), nil
+}
+
 type TailscaleOpts struct {
 	Version  string
 	ExitNode string
@@ -69,7 +200,8 @@ type TailscaleOpts struct {
 type MacvlanOpts struct {
 	Mac    string
 	Parent string
-	VLAN   int
+	// VLAN, if set, is the VLAN ID to tag the macvlan interface with.
+	VLAN *int
 }
 
 type NetworkOpts struct {
@@ -101,6 +233,15 @@ type FileInstaller struct {
 	ver string // memoized version number
 
 	failed bool
+	phases *installPhases
+
+	// template is whether the received file was marked as a template.
+	template bool
+	// stagesFile is whether the received file is staged as the payload of
+	// the service, rather than as its env file or not at all.
+	stagesFile bool
+	// unlockUpload, if set, releases the part file of the resumable upload.
+	unlockUpload func()
 }
 
 func (i *FileInstaller) WriteAt(p []byte, offset int64) (n int, err error) {
@@ -154,16 +295,78 @@ func NewFileInstaller(s *Server, cfg FileInstallerCfg) (*FileInstaller, error) {
 			HalfLife: 250 * time.Millisecond,
 		},
 		existingService: First(s.serviceView(cfg.ServiceName)),
+		phases:          s.newInstallPhases(cfg.ServiceName, InstallPhaseReceived),
 	}
 	if i.cfg.NewCmd == nil {
 		i.cfg.NewCmd = cmdutil.NewStdCmd
 	}
+	if rs := cfg.RequireSigned; rs != nil && !*rs && i.existingService.Valid() && i.existingService.RequireSigned() {
+		return nil, fmt.Errorf("service %q requires signed files and images; only `yeet trust require %s off` turns that off", cfg.ServiceName, cfg.ServiceName)
+	}
+	if slices.Contains(strings.Split(cfg.Network.Interfaces, ","), "lan") {
+		if err := validateMacvlanOpts(cfg.Network.Macvlan); err != nil {
+			return nil, err
+		}
+		if _, err := macvlanParent(cfg.Network.Macvlan.Parent); err != nil {
+			return nil, err
+		}
+	}
+	if wd := cfg.watchdog(); wd < 0 {
+		return nil, fmt.Errorf("invalid watchdog interval %v", wd)
+	} else if wd != 0 && cfg.Timer != nil {
+		return nil, fmt.Errorf("watchdog is not supported for cron services")
+	}
+	if cfg.Resources != nil {
+		if err := cfg.Resources.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Metrics != nil {
+		if _, err := parseMetricsTarget(*cfg.Metrics); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.KeepGenerations != nil && *cfg.KeepGenerations < 0 {
+		return nil, fmt.Errorf("invalid number of generations %d", *cfg.KeepGenerations)
+	}
+	if cfg.Needs != nil {
+		dv, err := s.getDB()
+		if err != nil {
+			return nil, err
+		}
+		if err := validateNeeds(dv, cfg.ServiceName, cfg.Needs); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DataDir != "" {
+		dir, err := s.checkDataDir(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		i.cfg.DataDir = dir
+	}
 	if err := s.ensureDirs(cfg.ServiceName, cfg.User); err != nil {
 		return nil, fmt.Errorf("failed to ensure directories: %w", err)
 	}
+	if i.cfg.DataDir != "" {
+		if err := s.ensureDir(i.cfg.DataDir, cfg.User); err != nil {
+			return nil, fmt.Errorf("failed to ensure directories: %w", err)
+		}
+	}
 	// Create temporary file.
 	var err error
-	i.File, err = os.OpenFile(i.tempFilePath(), os.O_CREATE|os.O_WRONLY, 0644)
+	if cfg.UploadID != "" {
+		if i.unlockUpload, err = s.lockUpload(cfg.ServiceName, cfg.UploadID); err != nil {
+			return nil, err
+		}
+		s.removeStaleUploads(cfg.ServiceName)
+		i.File, err = i.openUploadPart()
+		if err != nil {
+			i.unlockUpload()
+		}
+	} else {
+		i.File, err = os.OpenFile(i.tempFilePath(), os.O_CREATE|os.O_WRONLY, 0644)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -208,8 +411,8 @@ func (i *FileInstaller) parseNetwork() error {
 			if i.cfg.Network.Tailscale.Version != "" {
 				i.tsNet.Version = i.cfg.Network.Tailscale.Version
 			}
-			if i.cfg.Network.Tailscale.Tags != nil {
-				i.tsNet.Tags = i.cfg.Network.Tailscale.Tags
+			if tags := i.s.serviceTSTags(i.s.ctx, dv, i.cfg.Network.Tailscale.Tags); len(tags) > 0 {
+				i.tsNet.Tags = tags
 			}
 			if i.cfg.Network.Tailscale.ExitNode != "" {
 				i.tsNet.ExitNode = i.cfg.Network.Tailscale.ExitNode
@@ -224,21 +427,18 @@ func (i *FileInstaller) parseNetwork() error {
 				IPv4: ip,
 			}
 		case net == "lan":
-			iface, err := netmon.DefaultRouteInterface()
+			parent, err := macvlanParent(i.cfg.Network.Macvlan.Parent)
 			if err != nil {
-				return fmt.Errorf("failed to get default route interface: %v", err)
+				return err
 			}
-			log.Printf("default route interface: %v", iface)
+			log.Printf("macvlan parent interface: %v", parent)
 			i.macvlan = &db.MacvlanNetwork{
 				Interface: "ymv-" + hexStr(4),
-				Parent:    iface,
+				Parent:    parent,
 				Mac:       randomMAC(),
 			}
-			if i.cfg.Network.Macvlan.Parent != "" {
-				i.macvlan.Parent = i.cfg.Network.Macvlan.Parent
-			}
-			if i.cfg.Network.Macvlan.VLAN != 0 {
-				i.macvlan.VLAN = i.cfg.Network.Macvlan.VLAN
+			if i.cfg.Network.Macvlan.VLAN != nil {
+				i.macvlan.VLAN = *i.cfg.Network.Macvlan.VLAN
 			}
 			if i.cfg.Network.Macvlan.Mac != "" {
 				i.macvlan.Mac = i.cfg.Network.Macvlan.Mac
@@ -343,14 +543,8 @@ func (i *FileInstaller) configureNetwork() (*networkConfig, error) {
 			}
 			deps = append(deps, "yeet-"+i.cfg.ServiceName+"-ts.service")
 		}
-		dockerNet := fmt.Sprintf(`networks:
-  default:
-    driver: yeet
-    driver_opts:
-      dev.catchit.netns: %q
-`, filepath.Join("/var/run/netns", env.NetNS()))
 		dnf := filepath.Join(i.s.serviceBinDir(i.cfg.ServiceName), "compose.network")
-		if err := os.WriteFile(dnf, []byte(dockerNet), 0644); err != nil {
+		if err := svc.WriteComposeNetwork(dnf, filepath.Join("/var/run/netns", env.NetNS())); err != nil {
 			return nil, fmt.Errorf("failed to write docker compose network: %v", err)
 		}
 		mak.Set(&i.artifacts, db.ArtifactDockerComposeNetwork, dnf)
@@ -379,16 +573,34 @@ func (i *FileInstaller) Close() (err error) {
 		i.closed = true
 		close(i.ch)
 		i.err = err
+		if i.unlockUpload != nil {
+			i.unlockUpload()
+		}
 	}()
 	if err := i.File.Close(); err != nil {
 		return fmt.Errorf("failed to close temporary file: %v", err)
 	}
+	if i.failed && i.cfg.UploadID != "" {
+		n := i.s.uploadReceived(i.cfg.ServiceName, i.cfg.UploadID)
+		i.printf("Upload of %q interrupted after %d bytes; it can be resumed\n", i.cfg.ServiceName, n)
+		i.phases.fail(fmt.Errorf("upload interrupted"))
+		return fmt.Errorf("upload interrupted")
+	}
 	if i.failed {
 		log.Printf("Installation of %q failed\n", i.cfg.ServiceName)
 		i.printf("Installation of %q failed\n", i.cfg.ServiceName)
+		i.phases.fail(fmt.Errorf("upload aborted"))
 		return fmt.Errorf("installation failed")
 	}
+	if i.cfg.UploadID != "" {
+		if err := i.verifyUpload(); err != nil {
+			i.phases.fail(err)
+			i.printf("%v\n", err)
+			return err
+		}
+	}
 	if err := i.installOnClose(); err != nil {
+		i.phases.fail(err)
 		log.Printf("Failed to install service: %v", err)
 		i.printf("Failed to install service: %v", err)
 		return fmt.Errorf("failed to install service: %w", err)
@@ -396,7 +608,10 @@ func (i *FileInstaller) Close() (err error) {
 	return nil
 }
 
-func rewriteSystemdUnit(p, exe string, args []string) (string, error) {
+// rewriteSystemdUnit writes a new version of the systemd unit at p with the
+// ExecStart line replaced if args is non-nil, and the watchdog settings
+// replaced if watchdog is non-nil; they are removed if it is zero.
+func rewriteSystemdUnit(p, exe string, args []string, watchdog *time.Duration) (string, error) {
 	f, err := os.Open(p)
 	if err != nil {
 		return "", fmt.Errorf("failed to open systemd unit: %w", err)
@@ -411,9 +626,20 @@ func rewriteSystemdUnit(p, exe string, args []string) (string, error) {
 	sc := bufio.NewScanner(f)
 	for sc.Scan() {
 		line := sc.Text()
-		if strings.HasPrefix(strings.TrimSpace(line), "ExecStart=") {
-			fmt.Fprintf(out, "ExecStart=%s %s\n", exe, strings.Join(args, " "))
-		} else {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "ExecStart="):
+			if args != nil {
+				fmt.Fprintf(out, "ExecStart=%s %s\n", exe, strings.Join(args, " "))
+			} else {
+				fmt.Fprintln(out, line)
+			}
+			if watchdog != nil && *watchdog != 0 {
+				fmt.Fprintf(out, "Type=notify\nNotifyAccess=main\nWatchdogSec=%d\n", watchdogSec(*watchdog))
+			}
+		case watchdog != nil && (trimmed == "Type=notify" || strings.HasPrefix(trimmed, "NotifyAccess=") || strings.HasPrefix(trimmed, "WatchdogSec=")):
+			// Replaced above.
+		default:
 			fmt.Fprintln(out, line)
 		}
 	}
@@ -433,8 +659,8 @@ func (i *FileInstaller) ensureSystemdUnit() error {
 		s := i.existingService.AsStruct()
 		p, ok := s.Artifacts.Staged(db.ArtifactSystemdUnit)
 		if ok {
-			if i.cfg.Args != nil {
-				p, err := rewriteSystemdUnit(p, exe, i.cfg.Args)
+			if i.cfg.Args != nil || i.cfg.Watchdog != nil {
+				p, err := rewriteSystemdUnit(p, exe, i.cfg.Args, i.cfg.Watchdog)
 				if err != nil {
 					return fmt.Errorf("failed to rewrite systemd unit: %w", err)
 				}
@@ -443,7 +669,7 @@ func (i *FileInstaller) ensureSystemdUnit() error {
 			return nil
 		}
 	}
-	if i.cfg.StageOnly && i.cfg.Network.Interfaces == "" && i.cfg.Args == nil {
+	if i.cfg.StageOnly && i.cfg.Network.Interfaces == "" && i.cfg.Args == nil && i.cfg.watchdog() == 0 {
 		return nil
 	}
 	// If the service is not valid, we need to create a systemd unit file
@@ -451,10 +677,11 @@ func (i *FileInstaller) ensureSystemdUnit() error {
 	su := &svc.SystemdUnit{
 		Name:             i.cfg.ServiceName,
 		Executable:       exe,
-		WorkingDirectory: i.s.serviceDataDir(i.cfg.ServiceName),
+		WorkingDirectory: i.dataDir(),
 		Arguments:        i.cfg.Args,
 		EnvFile:          "-" + filepath.Join(runDir, "env"), // "-" means optional
 		Timer:            i.cfg.Timer,
+		WatchdogSec:      watchdogSec(i.cfg.watchdog()),
 	}
 
 	if n, err := i.configureNetwork(); err != nil {
@@ -476,6 +703,88 @@ func (i *FileInstaller) ensureSystemdUnit() error {
 	return nil
 }
 
+// takeTemplateMark reports whether the client marked the received file as a
+// template, and removes the mark so that it only applies to this file.
+func (i *FileInstaller) takeTemplateMark() bool {
+	return os.Remove(i.s.templateMarkPath(i.cfg.ServiceName)) == nil
+}
+
+// dataDir returns the data directory the file is installed with.
+func (i *FileInstaller) dataDir() string {
+	if i.cfg.DataDir != "" {
+		return i.cfg.DataDir
+	}
+	return i.s.stagedDataDir(i.cfg.ServiceName)
+}
+
+// renderTemplate renders the placeholders of the received compose or env
+// file at p in place, if it was marked as a template.
+func (i *FileInstaller) renderTemplate(p string) error {
+	if !i.template {
+		return nil
+	}
+	ok, err := i.s.renderFileTemplate(i.cfg.ServiceName, i.dataDir(), p, p)
+	if err != nil {
+		return err
+	}
+	if ok {
+		i.printf("Rendered template placeholders\n")
+	}
+	return nil
+}
+
+// detectFileType detects the type of the received file at p and runs the
+// pre-flight checks for it against this host.
+func (i *FileInstaller) detectFileType(p string) (ftdetect.FileType, error) {
+	ft, err := preflight.CheckFile(p, runtime.GOOS, runtime.GOARCH)
+	var pe *preflight.Error
+	if errors.As(err, &pe) {
+		return ft, err
+	}
+	if err != nil && i.template && i.isComposeTemplate(p) {
+		ft, err = ftdetect.DockerCompose, nil
+	}
+	if err != nil {
+		return ft, fmt.Errorf("failed to detect file type: %w", err)
+	}
+	if ft == ftdetect.Script {
+		return ft, preflight.CheckInterpreter(p)
+	}
+	return ft, nil
+}
+
+// isComposeTemplate reports whether the file at p is a compose file once its
+// placeholders are rendered. Unquoted placeholders like image: {{.Image}}
+// make a compose file invalid YAML until then.
+func (i *FileInstaller) isComposeTemplate(p string) bool {
+	rendered := p + ".render"
+	defer os.Remove(rendered)
+	if ok, err := i.s.renderFileTemplate(i.cfg.ServiceName, i.dataDir(), p, rendered); err != nil || !ok {
+		return false
+	}
+	ft, err := ftdetect.DetectFile(rendered, runtime.GOOS, runtime.GOARCH)
+	return err == nil && ft == ftdetect.DockerCompose
+}
+
+// importImageArchive imports the image of the received image archive at p
+// into the registry and replaces p with the compose file that runs it.
+func (i *FileInstaller) importImageArchive(p string) error {
+	i.printf("Detected image archive\n")
+	if _, err := svc.DockerCmd(); err != nil {
+		return fmt.Errorf("image archives need docker on the host: %w", err)
+	}
+	image, manifest, err := i.s.importImageArchive(context.Background(), i.cfg.ServiceName, p)
+	if err != nil {
+		return fmt.Errorf("failed to import image archive: %w", err)
+	}
+	i.printf("Imported image %s\n", image)
+	cf, err := i.s.composeForImageArchive(i.cfg.ServiceName, image, manifest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, cf, 0644)
+}
+
 func (i *FileInstaller) installOnClose() error {
 	if i.File == nil {
 		return fmt.Errorf("no temporary file")
@@ -486,9 +795,14 @@ func (i *FileInstaller) installOnClose() error {
 	var dst string
 	var postRenameActions []func() error
 	var detectedServiceType db.ServiceType
+	var unsigned bool
 	if i.cfg.EnvFile {
 		er := i.s.serviceEnvDir(i.cfg.ServiceName)
 		dst = filepath.Join(er, "env-"+i.version())
+		i.template = i.takeTemplateMark()
+		if err := i.renderTemplate(tmppath); err != nil {
+			return err
+		}
 		mak.Set(&i.artifacts, db.ArtifactEnvFile, dst)
 	} else if i.cfg.NoBinary {
 		if i.existingService.Valid() {
@@ -500,11 +814,22 @@ func (i *FileInstaller) installOnClose() error {
 			}
 		}
 	} else {
-		// Detect file type.
-		var err error
-		binFT, err := ftdetect.DetectFile(bin, runtime.GOOS, runtime.GOARCH)
+		i.template = i.takeTemplateMark()
+		if err := i.applyDelta(bin); err != nil {
+			return err
+		}
+		required := i.existingService.Valid() && i.existingService.RequireSigned()
+		if i.cfg.RequireSigned != nil && *i.cfg.RequireSigned {
+			required = true
+		}
+		if err := i.s.verifyFileSignature(i.cfg.ServiceName, bin, required && !i.cfg.FromImage); err != nil {
+			return err
+		}
+		i.stagesFile = true
+		unsigned = !required && !i.cfg.FromImage
+		binFT, err := i.detectFileType(bin)
 		if err != nil {
-			return fmt.Errorf("failed to detect file type: %w", err)
+			return err
 		}
 		if binFT == ftdetect.Zstd {
 			// Unpack zstd compressed files.
@@ -517,12 +842,18 @@ func (i *FileInstaller) installOnClose() error {
 			if err := os.Rename(unpackPath, bin); err != nil {
 				return fmt.Errorf("failed to rename file: %w", err)
 			}
-			binFT, err = ftdetect.DetectFile(bin, runtime.GOOS, runtime.GOARCH)
-			if err != nil {
-				return fmt.Errorf("failed to detect file type: %w", err)
+			if binFT, err = i.detectFileType(bin); err != nil {
+				return err
 			}
 		}
 
+		if binFT == ftdetect.ImageArchive {
+			if err := i.importImageArchive(bin); err != nil {
+				return err
+			}
+			binFT = ftdetect.DockerCompose
+		}
+
 		var artifactName db.ArtifactName
 		// Set the service type and "binary" name (file in the bin/ dir)
 		switch binFT {
@@ -549,6 +880,14 @@ func (i *FileInstaller) installOnClose() error {
 			}
 		case ftdetect.DockerCompose:
 			i.printf("Detected Docker Compose file\n")
+			if err := i.renderTemplate(bin); err != nil {
+				return err
+			}
+			if built, err := i.s.useBuiltImages(i.cfg.ServiceName, bin); err != nil {
+				return fmt.Errorf("failed to use built images: %w", err)
+			} else if len(built) > 0 {
+				i.printf("Using built images for %s\n", strings.Join(built, ", "))
+			}
 			// serviceType = db.ServiceTypeDockerCompose
 			binName := fmt.Sprintf("docker-compose.%s.yml", i.version())
 			// Move the "binary" file to the final location.
@@ -564,7 +903,7 @@ func (i *FileInstaller) installOnClose() error {
 			// Move the "binary" file to the final location.
 			binDir := i.s.serviceBinDir(i.cfg.ServiceName)
 			runDir := i.s.serviceRunDir(i.cfg.ServiceName)
-			dataDir := i.s.serviceDataDir(i.cfg.ServiceName)
+			dataDir := i.dataDir()
 			dst = filepath.Join(binDir, binName)
 			dockerCmd, err := svc.DockerCmd()
 			if err != nil {
@@ -598,6 +937,9 @@ func (i *FileInstaller) installOnClose() error {
 			return fmt.Errorf("unknown file type")
 		}
 		mak.Set(&i.artifacts, artifactName, dst)
+		if unsigned {
+			mak.Set(&i.artifacts, db.ArtifactUnsigned, dst)
+		}
 	}
 
 	if dst != "" {
@@ -614,11 +956,39 @@ func (i *FileInstaller) installOnClose() error {
 		os.Remove(tmppath)
 	}
 
+	i.phases.done(InstallPhaseReceived, InstallPhaseStaged)
+
 	if _, err := i.configureNetwork(); err != nil {
 		return fmt.Errorf("failed to configure network: %v", err)
 	}
 
+	var deps []db.Dependency
+	cf, hasCompose := i.artifacts[db.ArtifactDockerComposeFile]
+	if hasCompose {
+		dv, err := i.s.getDB()
+		if err != nil {
+			return err
+		}
+		if deps, err = i.s.composeDependencies(dv, i.cfg.ServiceName, cf); err != nil {
+			return fmt.Errorf("failed to discover dependencies: %w", err)
+		}
+		for _, d := range deps {
+			i.printf("Depends on %q (%s %s)\n", d.Service, d.Kind, d.Ref)
+		}
+	}
+
 	if _, _, err := i.s.cfg.DB.MutateService(i.cfg.ServiceName, func(d *db.Data, s *db.Service) error {
+		if i.cfg.checkBase != nil {
+			if err := i.cfg.checkBase(s); err != nil {
+				return err
+			}
+		}
+		if hasCompose {
+			s.Dependencies = append(declaredDependencies(s.Dependencies), deps...)
+		}
+		if i.cfg.Needs != nil {
+			s.Dependencies = withNeeds(s.Dependencies, i.cfg.Needs)
+		}
 		if s.ServiceType == "" {
 			s.ServiceType = detectedServiceType
 		} else if detectedServiceType != "" && s.ServiceType != detectedServiceType {
@@ -633,6 +1003,42 @@ func (i *FileInstaller) installOnClose() error {
 		if i.tsNet != nil {
 			s.TSNet = i.tsNet
 		}
+		if i.cfg.AllowPrivileged != nil {
+			s.AllowPrivileged = *i.cfg.AllowPrivileged
+		}
+		if i.cfg.NoAutoRollback != nil {
+			s.NoAutoRollback = *i.cfg.NoAutoRollback
+		}
+		if i.cfg.Resources != nil {
+			// Staged like the file, so that they don't apply before it is
+			// committed.
+			base := s.Resources
+			if s.StagedResources != nil {
+				base = s.StagedResources
+			}
+			s.StagedResources = i.cfg.Resources.apply(base)
+		}
+		if i.cfg.DataDir != "" {
+			s.StagedDataDir = i.cfg.DataDir
+		}
+		if i.cfg.Metrics != nil {
+			s.Metrics, _ = parseMetricsTarget(*i.cfg.Metrics)
+		}
+		if i.cfg.KeepGenerations != nil {
+			s.KeepGenerations = *i.cfg.KeepGenerations
+		}
+		if i.cfg.RequireSigned != nil && *i.cfg.RequireSigned {
+			// Turned off only by `trust require`.
+			s.RequireSigned = true
+		}
+		if af := s.Artifacts[db.ArtifactUnsigned]; af != nil && i.stagesFile {
+			// Replaced by the staged file, which is re-added below if it
+			// is unsigned too.
+			delete(af.Refs, "staged")
+		}
+		if i.cfg.StageDefaultsApplied {
+			s.StageDefaultsApplied = true
+		}
 		for a, p := range i.artifacts {
 			af, ok := s.Artifacts[a]
 			if !ok {
@@ -647,10 +1053,13 @@ func (i *FileInstaller) installOnClose() error {
 	}); err != nil {
 		return fmt.Errorf("failed to update service: %w", err)
 	}
-
 	if i.cfg.StageOnly {
+		i.phases.done(InstallPhaseStaged, "")
 		return nil
 	}
+	// The units are written by the Installer once the staged generation
+	// is committed.
+	i.phases.done(InstallPhaseStaged, InstallPhaseUnitsWritten)
 
 	i.printf("File received\n")
 	i.printf("Installing service\n")
@@ -659,6 +1068,7 @@ func (i *FileInstaller) installOnClose() error {
 		return fmt.Errorf("failed to create installer: %w", err)
 	}
 	si.NewCmd = i.cfg.NewCmd
+	si.phases = i.phases
 	if err := si.Install(); err != nil {
 		return fmt.Errorf("failed to install service: %w", err)
 	}
@@ -671,6 +1081,9 @@ func (i *FileInstaller) Fail() {
 }
 
 func (i *FileInstaller) tempFilePath() string {
+	if i.cfg.UploadID != "" {
+		return i.s.uploadPartPath(i.cfg.ServiceName, i.cfg.UploadID)
+	}
 	return filepath.Join(i.s.serviceBinDir(i.cfg.ServiceName),
 		fmt.Sprintf("%s-%s.tmp", i.cfg.ServiceName, i.version()))
 }
@@ -692,6 +1105,7 @@ func (s *Server) NewInstaller(cfg InstallerCfg) (*Installer, error) {
 		s:    s,
 
 		NewCmd: cmdutil.NewStdCmd,
+		phases: s.newInstallPhases(cfg.ServiceName, InstallPhaseUnitsWritten),
 	}
 	return si, nil
 }
@@ -701,8 +1115,9 @@ func (s *Server) NewInstaller(cfg InstallerCfg) (*Installer, error) {
 type Installer struct {
 	NewCmd func(name string, arg ...string) *exec.Cmd
 
-	icfg InstallerCfg
-	s    *Server
+	icfg   InstallerCfg
+	s      *Server
+	phases *installPhases
 }
 
 func (si *Installer) printf(format string, args ...any) {
@@ -732,6 +1147,20 @@ func unassignedIP(dv db.DataView) (netip.Addr, error) {
 	return ip, nil
 }
 
+// watchdog returns the watchdog interval set by the config, or zero.
+func (cfg *FileInstallerCfg) watchdog() time.Duration {
+	if cfg.Watchdog == nil {
+		return 0
+	}
+	return *cfg.Watchdog
+}
+
+// watchdogSec converts d to whole seconds for WatchdogSec, rounding up so that
+// sub-second intervals do not disable the watchdog.
+func watchdogSec(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
 func randomMAC() string {
 	var b [6]byte
 	for i := range b {
@@ -743,7 +1172,31 @@ func randomMAC() string {
 	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", b[0], b[1], b[2], b[3], b[4], b[5])
 }
 
-const maxGenerations = 10
+// defaultKeepGenerations is how many generations before the latest one are
+// kept for rollbacks, unless the host or the service set their own.
+const defaultKeepGenerations = 10
+
+// keepGenerations returns how many generations before the latest one of
+// service s are kept for rollbacks. d may be nil, in which case the host's
+// setting is not used.
+func keepGenerations(d *db.Data, s *db.Service) int {
+	if s.KeepGenerations > 0 {
+		return s.KeepGenerations
+	}
+	if d != nil && d.KeepGenerations > 0 {
+		return d.KeepGenerations
+	}
+	return defaultKeepGenerations
+}
+
+// minGeneration returns the oldest generation of service s that is kept.
+func minGeneration(d *db.Data, s *db.Service) int {
+	return s.LatestGeneration - keepGenerations(d, s)
+}
+
+// errGenerationMismatch is returned when committing with
+// InstallerCfg.IfGeneration set and the service is at a different generation.
+var errGenerationMismatch = errors.New("generation mismatch")
 
 func (si *Installer) mutateService(f func(*db.Data, *db.Service) error) (*db.Data, *db.Service, error) {
 	return si.s.cfg.DB.MutateService(si.icfg.ServiceName, f)
@@ -751,6 +1204,9 @@ func (si *Installer) mutateService(f func(*db.Data, *db.Service) error) (*db.Dat
 
 func (si *Installer) commitGen(gen int) (*db.Data, *db.Service, error) {
 	d, s, err := si.mutateService(func(d *db.Data, s *db.Service) error {
+		if want := si.icfg.IfGeneration; want != nil && s.Generation != *want {
+			return fmt.Errorf("%w: service is at generation %d, expected %d", errGenerationMismatch, s.Generation, *want)
+		}
 		var srcRefName string
 		var dstRefs []string
 		if gen == 0 {
@@ -759,6 +1215,15 @@ func (si *Installer) commitGen(gen int) (*db.Data, *db.Service, error) {
 
 			srcRefName = "staged"
 			dstRefs = append(dstRefs, "latest", string(db.Gen(s.Generation)))
+			if rl := s.StagedResources; rl != nil {
+				s.Resources, s.StagedResources = rl, nil
+				if rl.IsZero() {
+					s.Resources = nil
+				}
+			}
+			if dir := s.StagedDataDir; dir != "" {
+				s.DataDir, s.StagedDataDir = dir, ""
+			}
 		} else {
 			srcRefName = string(db.Gen(gen))
 			dstRefs = append(dstRefs, "latest")
@@ -814,11 +1279,20 @@ func parseGenRef(ref db.ArtifactRef) (int, bool) {
 
 // Prune removes old configurations from the database.
 func (si *Installer) prune() {
+	if _, err := si.s.pruneGenerations(si.icfg.ServiceName, false); err != nil {
+		log.Printf("failed to prune %q: %v", si.icfg.ServiceName, err)
+	}
+}
+
+// pruneGenerations drops the references to generations of service sn older
+// than it keeps and removes the files that are no longer referenced. It
+// returns the removed files; with dryRun nothing is changed.
+func (s *Server) pruneGenerations(sn string, dryRun bool) ([]string, error) {
 	knownBins := make(set.Set[string])
 	// TODO(maisem): this should not be hardcoded here.
-	knownBins.AddSlice([]string{"netns.env", "env", "main.ts", si.icfg.ServiceName})
-	_, _, err := si.mutateService(func(d *db.Data, s *db.Service) error {
-		minGen := s.LatestGeneration - maxGenerations
+	knownBins.AddSlice([]string{"netns.env", "env", "main.ts", sn})
+	prune := func(d *db.Data, s *db.Service) error {
+		minGen := minGeneration(d, s)
 		for _, refs := range s.Artifacts {
 			for ref, p := range refs.Refs {
 				if gen, ok := parseGenRef(ref); !ok || gen >= minGen {
@@ -829,40 +1303,57 @@ func (si *Installer) prune() {
 			}
 		}
 		return nil
-	})
-	if err != nil {
-		log.Printf("failed to mutate service: %v", err)
-		return
 	}
-
-	bd := si.s.serviceBinDir(si.icfg.ServiceName)
-	if err := keepOnlyKnownFilesInDir(bd, knownBins); err != nil {
-		log.Printf("failed to keep only known files in %q: %v", bd, err)
+	if dryRun {
+		dv, err := s.getDB()
+		if err != nil {
+			return nil, err
+		}
+		d := dv.AsStruct()
+		sv, ok := d.Services[sn]
+		if !ok {
+			return nil, errServiceNotFound
+		}
+		prune(d, sv)
+	} else if _, _, err := s.cfg.DB.MutateService(sn, prune); err != nil {
+		return nil, fmt.Errorf("failed to mutate service: %w", err)
 	}
-	ed := si.s.serviceEnvDir(si.icfg.ServiceName)
-	if err := keepOnlyKnownFilesInDir(ed, knownBins); err != nil {
-		log.Printf("failed to keep only known files in %q: %v", ed, err)
+
+	var removed []string
+	for _, dir := range []string{s.serviceBinDir(sn), s.serviceEnvDir(sn)} {
+		r, err := keepOnlyKnownFilesInDir(dir, knownBins, dryRun)
+		if err != nil {
+			log.Printf("failed to keep only known files in %q: %v", dir, err)
+		}
+		removed = append(removed, r...)
 	}
+	return removed, nil
 }
 
-func keepOnlyKnownFilesInDir(dir string, known set.Set[string]) error {
+// keepOnlyKnownFilesInDir removes the files in dir that are not in known and
+// returns their paths. With dryRun the files are only returned.
+func keepOnlyKnownFilesInDir(dir string, known set.Set[string], dryRun bool) ([]string, error) {
 	// Loop over all files in the bin directory and remove any that are not in
 	// the knownBins map.
 	files, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
+		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
+	var removed []string
 	for _, f := range files {
 		if !known.Contains(f.Name()) {
 			fp := filepath.Join(dir, f.Name())
-			if err := os.Remove(fp); err != nil {
+			if dryRun {
+				removed = append(removed, fp)
+			} else if err := os.Remove(fp); err != nil {
 				log.Printf("failed to remove file: %v", err)
 			} else {
 				log.Printf("Removed old file: %s", fp)
+				removed = append(removed, fp)
 			}
 		}
 	}
-	return nil
+	return removed, nil
 }
 
 /*
@@ -878,38 +1369,122 @@ func keepOnlyKnownFilesInDir(dir string, known set.Set[string]) error {
 	}
 */
 
+// InstallGen installs generation gen of the service, or the staged one if
+// gen is 0. Deploys of protected services are held for approval instead.
 func (si *Installer) InstallGen(gen int) error {
-	if runtime.GOOS == "darwin" {
-		panic("macOS is not supported")
+	if held, err := si.s.holdProtectedDeploy(si.icfg, gen); err != nil {
+		return err
+	} else if held {
+		return nil
 	}
+	return si.installGen(gen)
+}
 
+func (si *Installer) installGen(gen int) error {
+	if err := si.s.checkGenerationSigned(si.icfg.ServiceName, gen); err != nil {
+		si.phases.fail(err)
+		si.audit(gen, err)
+		return err
+	}
+	if err := si.checkCompose(gen); err != nil {
+		si.phases.fail(err)
+		si.audit(gen, err)
+		return err
+	}
 	d, s, err := si.commitGen(gen)
 	if err != nil {
+		si.phases.fail(err)
+		si.audit(gen, err)
 		return fmt.Errorf("failed to commit gen: %v", err)
 	}
 
 	si.prune()
 
-	return si.doInstall(d, s)
+	err = si.doInstall(d, s)
+	si.audit(s.Generation, err)
+	if err != nil {
+		si.phases.fail(err)
+		return err
+	}
+	return nil
 }
 
-// Install installs the service.
+// Install installs the service. Deploys of protected services are held for
+// approval instead. If the new generation crashes right after the deploy,
+// the previous one is installed again and an error is returned, unless
+// InstallerCfg.BackgroundWatch is set.
 func (si *Installer) Install() error {
-	return si.InstallGen(0)
+	if held, err := si.s.holdProtectedDeploy(si.icfg, 0); err != nil {
+		return err
+	} else if held {
+		return nil
+	}
+	var prevGen int
+	if sv, err := si.s.serviceView(si.icfg.ServiceName); err == nil {
+		prevGen = sv.Generation()
+	}
+	if err := si.installGen(0); err != nil {
+		return err
+	}
+	watch := func() error {
+		if err := si.watchDeploy(prevGen); err != nil {
+			return err
+		}
+		si.phases.done(InstallPhaseHealthy, "")
+		return nil
+	}
+	if si.icfg.BackgroundWatch {
+		si.s.waitGroup.Go(func() {
+			if err := watch(); err != nil {
+				log.Printf("Deploy of %q: %v", si.icfg.ServiceName, err)
+			}
+		})
+		return nil
+	}
+	return watch()
+}
+
+// checkCompose lints the compose file of generation gen of the service, or
+// of the staged one if gen is 0, if it has one. Flags like --net and
+// --allow-privileged may be staged after the file, so this is the first
+// point at which all of them are known.
+func (si *Installer) checkCompose(gen int) error {
+	sv, err := si.s.serviceView(si.icfg.ServiceName)
+	if err != nil || sv.ServiceType() != db.ServiceTypeDockerCompose {
+		return nil
+	}
+	af := sv.AsStruct().Artifacts
+	get := af.Staged
+	if gen != 0 {
+		get = func(name db.ArtifactName) (string, bool) { return af.Gen(name, gen) }
+	}
+	p, ok := get(db.ArtifactDockerComposeFile)
+	if !ok {
+		return nil
+	}
+	_, netns := get(db.ArtifactDockerComposeNetwork)
+	return checkCompose(p, composeLintOptions{
+		NetNS:           netns,
+		AllowPrivileged: sv.AllowPrivileged(),
+	}, si.printf)
 }
 
 func (si *Installer) doInstall(d *db.Data, s *db.Service) error {
 	switch s.ServiceType {
 	case db.ServiceTypeSystemd:
 		// Install and start the service.
-		service, err := svc.NewSystemdService(si.s.cfg.DB, s.View(), si.s.serviceRunDir(si.icfg.ServiceName))
+		service, err := si.s.newHostService(s.View())
 		if err != nil {
 			return fmt.Errorf("failed to create service: %v", err)
 		}
 		if err := service.Install(); err != nil {
 			return fmt.Errorf("failed to install service: %v", err)
 		}
+		if _, err := si.s.materializeSecrets(s.Name); err != nil {
+			return fmt.Errorf("failed to apply secrets: %v", err)
+		}
 		si.printf("Service installed: %s\n", s.Name)
+		si.phases.done(InstallPhaseUnitsWritten, InstallPhaseStarted)
 
 		if s.Name == CatchService && si.icfg.SSHSessionCloser != nil {
 			_ = si.icfg.SSHSessionCloser.Close()
@@ -918,41 +1493,66 @@ func (si *Installer) doInstall(d *db.Data, s *db.Service) error {
 			return fmt.Errorf("failed to restart service: %v", err)
 		}
 		si.printf("Service restarted: %s\n", s.Name)
+		si.phases.done(InstallPhaseStarted, InstallPhaseHealthy)
 	case db.ServiceTypeDockerCompose:
-		// Check that docker is installed before trying to install
-		if _, err := svc.DockerCmd(); err != nil {
-			return err // svc.ErrDockerNotFound
-		}
-		service, err := svc.NewDockerComposeService(si.s.cfg.DB, s.View(), si.s.cfg.InternalRegistryAddr, d.Images, si.s.serviceDataDir(s.Name), si.s.serviceRunDir(s.Name))
+		service, err := si.composeService(d, s)
 		if err != nil {
-			return fmt.Errorf("failed to create service: %v", err)
+			return err
 		}
-		service.NewCmd = si.NewCmd
 		if err := service.Install(); err != nil {
 			return fmt.Errorf("failed to install service: %v", err)
 		}
+		si.phases.done(InstallPhaseUnitsWritten, InstallPhaseImagesPulled)
 
-		err = service.Up()
-		if err != nil {
+		if err := service.Pull(); err != nil {
+			return fmt.Errorf("failed to pull images: %v", err)
+		}
+		si.phases.done(InstallPhaseImagesPulled, InstallPhaseStarted)
+		if err := service.UpPulled(); err != nil {
 			return fmt.Errorf("failed to up service: %v", err)
 		}
+		si.phases.done(InstallPhaseStarted, InstallPhaseHealthy)
 	default:
 		return fmt.Errorf("unknown service type: %v", s.ServiceType)
 	}
+	si.publishInstalled(s)
+	return nil
+}
+
+// composeService returns the docker compose service to install s with.
+func (si *Installer) composeService(d *db.Data, s *db.Service) (*svc.DockerComposeService, error) {
+	// Check that docker is installed before trying to install
+	if _, err := svc.DockerCmd(); err != nil {
+		return nil, err // svc.ErrDockerNotFound
+	}
+	service, err := svc.NewDockerComposeService(si.s.cfg.DB, s.View(), si.s.cfg.InternalRegistryAddr, d.Images, si.s.serviceDataDir(s.Name), si.s.serviceRunDir(s.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service: %v", err)
+	}
+	service.NewCmd = si.NewCmd
+	service.DockerConfig = si.s.dockerConfigFunc(d.View(), s.View())
+	if service.SecretEnv, err = si.s.secretEnv(s.View()); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %v", err)
+	}
+	service.CopyEnvFile = si.s.installEnvFile
+	return service, nil
+}
+
+// publishInstalled publishes the event for the install of s.
+func (si *Installer) publishInstalled(s *db.Service) {
 	if s.LatestGeneration == 1 {
 		si.s.PublishEvent(Event{
 			Type:        EventTypeServiceCreated,
 			ServiceName: s.Name,
-			Data:        EventData{s.View()},
+			Data:        EventData{s.View().AsStruct()},
 		})
 	} else {
 		si.s.PublishEvent(Event{
 			Type:        EventTypeServiceConfigChanged,
 			ServiceName: s.Name,
-			Data:        EventData{s.View()},
+			Data:        EventData{s.View().AsStruct()},
 		})
 	}
-	return nil
 }
 
 func asJSON(v any) string {
@@ -0,0 +1,59 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tailscale.com/types/ptr"
+)
+
+func TestRewriteSystemdUnitWatchdog(t *testing.T) {
+	const plain = "[Service]\nExecStart=/run/svc/svc\nRestart=always\n"
+	const watched = "[Service]\nExecStart=/run/svc/svc\nType=notify\nNotifyAccess=main\nWatchdogSec=30\nRestart=always\n"
+	tests := []struct {
+		name     string
+		unit     string
+		watchdog *time.Duration
+		want     string
+	}{
+		{name: "enable", unit: plain, watchdog: ptr.To(30 * time.Second), want: watched},
+		{name: "change", unit: watched, watchdog: ptr.To(time.Minute), want: "[Service]\nExecStart=/run/svc/svc\nType=notify\nNotifyAccess=main\nWatchdogSec=60\nRestart=always\n"},
+		{name: "disable", unit: watched, watchdog: ptr.To(time.Duration(0)), want: plain},
+		{name: "unchanged", unit: watched, watchdog: nil, want: watched},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "svc.service")
+			if err := os.WriteFile(p, []byte(tt.unit), 0644); err != nil {
+				t.Fatal(err)
+			}
+			out, err := rewriteSystemdUnit(p, "/run/svc/svc", nil, tt.watchdog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("rewritten unit =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
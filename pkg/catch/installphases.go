@@ -0,0 +1,129 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"sync"
+	"time"
+)
+
+// InstallPhase is a step of installing a service. An EventTypeInstallPhase
+// event is published when each phase completes or fails.
+type InstallPhase string
+
+const (
+	// InstallPhaseReceived is the payload being received and unpacked.
+	InstallPhaseReceived InstallPhase = "received"
+	// InstallPhaseStaged is the payload and config being recorded as the
+	// staged generation.
+	InstallPhaseStaged InstallPhase = "staged"
+	// InstallPhaseUnitsWritten is the systemd units and compose files of the
+	// new generation being written.
+	InstallPhaseUnitsWritten InstallPhase = "units-written"
+	// InstallPhaseImagesPulled is the images pushed to catch of a compose
+	// service being pulled. Other images are pulled in InstallPhaseStarted,
+	// as the service is started.
+	InstallPhaseImagesPulled InstallPhase = "images-pulled"
+	// InstallPhaseStarted is the service being (re)started.
+	InstallPhaseStarted InstallPhase = "started"
+	// InstallPhaseHealthy is the service being watched for crashes after
+	// the deploy.
+	InstallPhaseHealthy InstallPhase = "healthy"
+)
+
+// InstallPhaseData is the data of an EventTypeInstallPhase event.
+type InstallPhaseData struct {
+	Phase InstallPhase `json:"phase"`
+	// Failed is whether the phase failed, in which case the install was
+	// aborted and Error holds why.
+	Failed bool   `json:"failed,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Duration is how long the phase took in milliseconds.
+	Duration int64 `json:"duration"`
+	// Elapsed is the time since the install started in milliseconds.
+	Elapsed int64 `json:"elapsed"`
+}
+
+// installPhases tracks the phases of one install of a service and publishes
+// an event as each of them ends. It is shared between the FileInstaller and
+// the Installer of an install. A nil *installPhases does nothing.
+type installPhases struct {
+	s  *Server
+	sn string
+
+	mu      sync.Mutex
+	start   time.Time
+	last    time.Time    // end of the previous phase
+	current InstallPhase // phase in progress
+	failed  bool
+}
+
+func (s *Server) newInstallPhases(sn string, first InstallPhase) *installPhases {
+	now := time.Now()
+	return &installPhases{s: s, sn: sn, start: now, last: now, current: first}
+}
+
+// done publishes that phase completed and makes next the phase in progress.
+func (p *installPhases) done(phase, next InstallPhase) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	d := p.end(phase, nil)
+	p.current = next
+	p.mu.Unlock()
+	p.publish(d)
+}
+
+// fail publishes that the phase in progress failed with err. Only the first
+// failure of an install is published.
+func (p *installPhases) fail(err error) {
+	if p == nil || err == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.failed {
+		p.mu.Unlock()
+		return
+	}
+	p.failed = true
+	d := p.end(p.current, err)
+	p.mu.Unlock()
+	p.publish(d)
+}
+
+// end returns the event data of phase ending now. p.mu must be held.
+func (p *installPhases) end(phase InstallPhase, err error) InstallPhaseData {
+	now := time.Now()
+	d := InstallPhaseData{
+		Phase:    phase,
+		Duration: now.Sub(p.last).Milliseconds(),
+		Elapsed:  now.Sub(p.start).Milliseconds(),
+	}
+	if err != nil {
+		d.Failed = true
+		d.Error = err.Error()
+	}
+	p.last = now
+	return d
+}
+
+func (p *installPhases) publish(d InstallPhaseData) {
+	p.s.PublishEvent(Event{
+		Type:        EventTypeInstallPhase,
+		ServiceName: p.sn,
+		Data:        EventData{d},
+	})
+}
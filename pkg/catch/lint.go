@@ -0,0 +1,530 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"gopkg.in/yaml.v3"
+)
+
+// `lint` runs the checks the installer would run, and a few it can't afford
+// to, against the staged or running generation of a service without
+// installing anything.
+
+// LintSeverity is how bad a LintFinding is.
+type LintSeverity string
+
+const (
+	// LintSeverityError is for findings that make the install fail or the
+	// service not work.
+	LintSeverityError LintSeverity = "error"
+	// LintSeverityWarning is for findings that are likely mistakes.
+	LintSeverityWarning LintSeverity = "warning"
+)
+
+// LintFinding is a problem found by lint.
+type LintFinding struct {
+	Severity LintSeverity `json:"severity"`
+	// Check is the check that found the problem: unit, compose, env, ports or
+	// image.
+	Check string `json:"check"`
+	Msg   string `json:"msg"`
+}
+
+// lintTimeout bounds the external commands run by lint.
+const lintTimeout = 30 * time.Second
+
+// lintArtifacts are the artifacts of the generation being linted.
+type lintArtifacts struct {
+	sv     db.ServiceView
+	af     db.ArtifactStore
+	gen    int
+	staged bool
+}
+
+// path returns the path of artifact name in the linted generation. For the
+// staged generation that is the staged artifact if there is one, and the
+// running one otherwise, as the install would do.
+func (la lintArtifacts) path(name db.ArtifactName) (string, bool) {
+	if la.staged {
+		if p, ok := la.af.Staged(name); ok {
+			return p, true
+		}
+	}
+	return la.af.Gen(name, la.gen)
+}
+
+// hasStaged reports whether any artifact of the service is staged.
+func hasStaged(af db.ArtifactStore) bool {
+	for name := range af {
+		if _, ok := af.Staged(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lintService runs all checks against the staged generation of service sn,
+// or the running one if staged is false.
+func (s *Server) lintService(ctx context.Context, sn string, staged bool) ([]LintFinding, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	sv, ok := dv.Services().GetOk(sn)
+	if !ok {
+		return nil, errServiceNotFound
+	}
+	la := lintArtifacts{sv: sv, af: sv.AsStruct().Artifacts, gen: sv.Generation(), staged: staged}
+	var findings []LintFinding
+	add := func(sev LintSeverity, check, format string, args ...any) {
+		findings = append(findings, LintFinding{Severity: sev, Check: check, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	var defined []string
+	if p, ok := la.path(db.ArtifactEnvFile); ok {
+		env, err := readEnvFile(p)
+		if err != nil {
+			add(LintSeverityError, "env", "%v", err)
+		}
+		for _, kv := range env {
+			k, _, _ := strings.Cut(kv, "=")
+			defined = append(defined, k)
+		}
+	}
+	for name := range sv.Secrets().All() {
+		defined = append(defined, name)
+	}
+
+	for _, name := range []db.ArtifactName{db.ArtifactSystemdUnit, db.ArtifactSystemdTimerFile, db.ArtifactSystemdOverride} {
+		p, ok := la.path(name)
+		if !ok {
+			continue
+		}
+		for _, f := range lintUnitFile(ctx, sn, name, p) {
+			add(f.Severity, "unit", "%s: %s", name, f.Msg)
+		}
+		if name == db.ArtifactSystemdUnit {
+			for _, ref := range unitEnvRefs(p) {
+				if !slices.Contains(defined, ref) {
+					add(LintSeverityWarning, "env", "%s references $%s, which is not set in the env file", name, ref)
+				}
+			}
+		}
+	}
+
+	if cf, ok := la.path(db.ArtifactDockerComposeFile); ok {
+		_, netns := la.path(db.ArtifactDockerComposeNetwork)
+		issues, err := lintCompose(cf, composeLintOptions{
+			NetNS:           netns,
+			AllowPrivileged: sv.AllowPrivileged(),
+		})
+		if err != nil {
+			add(LintSeverityError, "compose", "%v", err)
+			return sortLintFindings(findings), nil
+		}
+		for _, ci := range issues {
+			sev := LintSeverityWarning
+			if ci.Fatal {
+				sev = LintSeverityError
+			}
+			add(sev, "compose", "%s", ci)
+		}
+		if msg := s.composeConfigErr(ctx, la, cf); msg != "" {
+			add(LintSeverityError, "compose", "%s", msg)
+		}
+		for _, ref := range composeEnvRefs(cf) {
+			if !slices.Contains(defined, ref) {
+				add(LintSeverityWarning, "env", "compose file references ${%s}, which is not set in the env file and has no default", ref)
+			}
+		}
+		if !netns {
+			for _, c := range s.composePortConflicts(dv, sn, cf) {
+				add(LintSeverityError, "ports", "%s", c)
+			}
+		}
+		for _, msg := range s.unresolvableImages(ctx, dv, cf) {
+			add(LintSeverityError, "image", "%s", msg)
+		}
+	}
+	return sortLintFindings(findings), nil
+}
+
+// sortLintFindings sorts findings by severity, errors first, then by check.
+func sortLintFindings(findings []LintFinding) []LintFinding {
+	slices.SortStableFunc(findings, func(a, b LintFinding) int {
+		return cmp.Or(
+			cmp.Compare(a.Severity, b.Severity),
+			strings.Compare(a.Check, b.Check),
+		)
+	})
+	return findings
+}
+
+// lintUnitFile checks the syntax of the systemd unit file at path, which is
+// artifact name of service sn. If systemd-analyze is available the file is
+// also verified by it.
+func lintUnitFile(ctx context.Context, sn string, name db.ArtifactName, path string) []LintFinding {
+	var findings []LintFinding
+	add := func(sev LintSeverity, format string, args ...any) {
+		findings = append(findings, LintFinding{Severity: sev, Msg: fmt.Sprintf(format, args...)})
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		add(LintSeverityError, "failed to read: %v", err)
+		return findings
+	}
+	var section string
+	var hasExecStart bool
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	continued := false
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		wasContinued := continued
+		continued = strings.HasSuffix(line, "\\")
+		switch {
+		case wasContinued:
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				add(LintSeverityError, "line %d: unterminated section header %q", n, line)
+				continue
+			}
+			section = strings.Trim(line, "[]")
+		default:
+			k, _, ok := strings.Cut(line, "=")
+			if !ok {
+				add(LintSeverityError, "line %d: expected key=value, got %q", n, line)
+				continue
+			}
+			if section == "" {
+				add(LintSeverityError, "line %d: %s is outside of any section", n, strings.TrimSpace(k))
+				continue
+			}
+			if section == "Service" && strings.TrimSpace(k) == "ExecStart" {
+				hasExecStart = true
+			}
+		}
+	}
+	if name == db.ArtifactSystemdUnit && !hasExecStart {
+		add(LintSeverityError, "[Service] has no ExecStart")
+	}
+	if len(findings) > 0 || name == db.ArtifactSystemdOverride {
+		// Files that are already broken aren't worth verifying, and
+		// systemd-analyze can't verify a drop-in on its own.
+		return findings
+	}
+	sa, err := exec.LookPath("systemd-analyze")
+	if err != nil {
+		return findings
+	}
+	// systemd-analyze needs the file to be named like the unit.
+	dir, err := os.MkdirTemp("", "yeet-lint-")
+	if err != nil {
+		return findings
+	}
+	defer os.RemoveAll(dir)
+	unit := filepath.Join(dir, sn+filepath.Ext(string(name)))
+	if err := os.WriteFile(unit, b, 0600); err != nil {
+		return findings
+	}
+	ctx, cancel := context.WithTimeout(ctx, lintTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, sa, "verify", unit).CombinedOutput()
+	sev := LintSeverityWarning
+	if err != nil {
+		sev = LintSeverityError
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line = strings.TrimSpace(strings.ReplaceAll(line, unit, string(name))); line != "" {
+			add(sev, "systemd-analyze: %s", line)
+		}
+	}
+	return findings
+}
+
+// unitEnvRe matches $VAR and ${VAR} references in a unit file.
+var unitEnvRe = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`)
+
+// unitEnvRefs returns the env variables referenced by the Exec lines of
+// the unit file at path.
+func unitEnvRefs(path string) []string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var refs []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "Exec") {
+			continue
+		}
+		for _, m := range unitEnvRe.FindAllStringSubmatch(line, -1) {
+			if !slices.Contains(refs, m[1]) {
+				refs = append(refs, m[1])
+			}
+		}
+	}
+	return refs
+}
+
+// composeEnvRe matches compose interpolations: $$ escapes, $VAR and ${VAR}
+// with an optional modifier like :-default or ?error.
+var composeEnvRe = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)([^}]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// composeEnvRefs returns the variables interpolated in the compose file at
+// path that have no default value.
+func composeEnvRefs(path string) []string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var refs []string
+	for _, m := range composeEnvRe.FindAllStringSubmatch(string(b), -1) {
+		name := cmp.Or(m[1], m[3])
+		if name == "" {
+			continue // $$
+		}
+		if mod := m[2]; strings.HasPrefix(mod, "-") || strings.HasPrefix(mod, ":-") {
+			continue
+		}
+		if !slices.Contains(refs, name) {
+			refs = append(refs, name)
+		}
+	}
+	return refs
+}
+
+// composeConfigErr validates the compose files of the linted generation
+// with `docker compose config` and returns its complaint, or "" if they are
+// valid or docker isn't available.
+func (s *Server) composeConfigErr(ctx context.Context, la lintArtifacts, cf string) string {
+	docker, err := svc.DockerCmd()
+	if err != nil {
+		return ""
+	}
+	args := []string{"compose", "--project-name", "catch-" + la.sv.Name(), "--file", cf}
+	if p, ok := la.path(db.ArtifactDockerComposeNetwork); ok {
+		args = append(args, "--file", p)
+	}
+	if p, ok := la.path(db.ArtifactEnvFile); ok {
+		args = append(args, "--env-file", p)
+	}
+	args = append(args, "config", "--quiet")
+	ctx, cancel := context.WithTimeout(ctx, lintTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, docker, args...).CombinedOutput()
+	if err == nil {
+		return ""
+	}
+	return cmp.Or(strings.TrimSpace(string(out)), err.Error())
+}
+
+// composePorts returns the host ports published by the compose file at
+// path, as "port/proto", mapped to the compose service publishing them.
+func composePorts(path string) map[string]string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cf struct {
+		Services map[string]struct {
+			Ports []any `yaml:"ports"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		return nil
+	}
+	ports := map[string]string{}
+	for name, cs := range cf.Services {
+		for _, p := range cs.Ports {
+			var published, proto string
+			switch p := p.(type) {
+			case string:
+				spec, pr, _ := strings.Cut(p, "/")
+				proto = pr
+				parts := strings.Split(spec, ":")
+				if len(parts) < 2 {
+					continue // Only a container port, docker picks the host port.
+				}
+				published = parts[len(parts)-2]
+			case map[string]any:
+				published = fmt.Sprint(p["published"])
+				proto, _ = p["protocol"].(string)
+			}
+			if _, err := strconv.Atoi(published); err != nil {
+				// Unset, a range or an interpolation.
+				continue
+			}
+			ports[published+"/"+cmp.Or(proto, "tcp")] = name
+		}
+	}
+	return ports
+}
+
+// composePortConflicts returns the host ports published by the compose
+// file cf of service sn that are also published by the running generation
+// of another service on the host network.
+func (s *Server) composePortConflicts(dv *db.DataView, sn, cf string) []string {
+	ours := composePorts(cf)
+	if len(ours) == 0 {
+		return nil
+	}
+	var conflicts []string
+	for other, sv := range dv.Services().All() {
+		if other == sn {
+			continue
+		}
+		af := sv.AsStruct().Artifacts
+		if _, netns := af.Gen(db.ArtifactDockerComposeNetwork, sv.Generation()); netns {
+			continue
+		}
+		p, ok := af.Gen(db.ArtifactDockerComposeFile, sv.Generation())
+		if !ok {
+			continue
+		}
+		for port := range composePorts(p) {
+			if cs, ok := ours[port]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("service %q publishes port %s, which is already published by %q", cs, port, other))
+			}
+		}
+	}
+	slices.Sort(conflicts)
+	return conflicts
+}
+
+// unresolvableImages returns why images of the compose file at path can't
+// be pulled: images of the internal registry must have been pushed, and
+// other images must exist locally or in their registry.
+func (s *Server) unresolvableImages(ctx context.Context, dv *db.DataView, path string) []string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cf struct {
+		Services map[string]struct {
+			Image string `yaml:"image"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		return nil
+	}
+	docker, dockerErr := svc.DockerCmd()
+	var msgs []string
+	for name, cs := range cf.Services {
+		img := cs.Image
+		if img == "" || strings.Contains(img, "$") {
+			continue
+		}
+		if repo, ok := strings.CutPrefix(img, svc.InternalRegistryHost+"/"); ok {
+			repo, _, _ = strings.Cut(repo, ":")
+			if _, ok := dv.Images().GetOk(db.ImageRepoName(repo)); !ok {
+				msgs = append(msgs, fmt.Sprintf("service %q: image %s has not been pushed", name, img))
+			}
+			continue
+		}
+		if dockerErr != nil {
+			continue
+		}
+		ictx, cancel := context.WithTimeout(ctx, lintTimeout)
+		if exec.CommandContext(ictx, docker, "image", "inspect", img).Run() != nil {
+			if out, err := exec.CommandContext(ictx, docker, "manifest", "inspect", img).CombinedOutput(); err != nil {
+				msgs = append(msgs, fmt.Sprintf("service %q: image %s can't be resolved: %s", name, img, cmp.Or(strings.TrimSpace(string(out)), err.Error())))
+			}
+		}
+		cancel()
+	}
+	slices.Sort(msgs)
+	return msgs
+}
+
+func (e *ttyExecer) lintCmdFunc(cmd *cobra.Command, _ []string) error {
+	formatOut, _ := cmd.Flags().GetString("format")
+	running, _ := cmd.Flags().GetBool("running")
+	switch formatOut {
+	case "table", "json", "json-pretty":
+	default:
+		return fmt.Errorf("unknown format %q, use table, json or json-pretty", formatOut)
+	}
+	sv, err := e.s.serviceView(e.sn)
+	if err != nil {
+		return err
+	}
+	staged := !running
+	if staged && !hasStaged(sv.AsStruct().Artifacts) {
+		if formatOut == "table" {
+			e.printf("Nothing is staged, linting the running generation %d\n", sv.Generation())
+		}
+		staged = false
+	}
+	findings, err := e.s.lintService(e.ctx, e.sn, staged)
+	if err != nil {
+		return err
+	}
+	if err := writeLintFindings(cmd.OutOrStdout(), formatOut, findings); err != nil {
+		return err
+	}
+	var errs int
+	for _, f := range findings {
+		if f.Severity == LintSeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("lint found %d error(s)", errs)
+	}
+	return nil
+}
+
+// writeLintFindings writes findings to w in format, one of table, json or
+// json-pretty.
+func writeLintFindings(w io.Writer, format string, findings []LintFinding) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(findings)
+	case "json-pretty":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(findings)
+	}
+	if len(findings) == 0 {
+		_, err := fmt.Fprintln(w, "No problems found")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "SEVERITY\tCHECK\tMESSAGE")
+	for _, f := range findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Severity, f.Check, f.Msg)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,223 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/gorilla/websocket"
+	"tailscale.com/types/opt"
+)
+
+// LogRecord is a log line of a service as streamed by the logs API.
+type LogRecord struct {
+	Time time.Time `json:"time"`
+	// Source is the systemd unit or container that logged the line.
+	Source string `json:"source"`
+	Line   string `json:"line"`
+}
+
+// handleLogs streams the logs of a service over a websocket as JSON
+// LogRecords. It takes the same options as the logs command as query
+// parameters: service, follow, lines, since, until and grep.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sn := q.Get("service")
+	if sn == "" || sn == SystemService {
+		http.Error(w, "missing service", http.StatusBadRequest)
+		return
+	}
+	opts := &svc.LogOptions{Grep: q.Get("grep")}
+	opts.Follow, _ = opt.Bool(q.Get("follow")).Get()
+	if v := q.Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid lines", http.StatusBadRequest)
+			return
+		}
+		opts.Lines = n
+	}
+	now := time.Now()
+	var err error
+	if opts.Since, err = parseLogTime(q.Get("since"), now); err != nil {
+		http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Until, err = parseLogTime(q.Get("until"), now); err != nil {
+		http.Error(w, "invalid until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var grep *regexp.Regexp
+	if opts.Grep != "" {
+		if grep, err = regexp.Compile(opts.Grep); err != nil {
+			http.Error(w, "invalid grep: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	st, err := s.serviceType(sn)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	c, parse, err := s.logRecordsCmd(ctx, sn, st, opts, grep)
+	if errors.Is(err, errLogsNotSupported) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out, err := c.StdoutPipe()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	// The request context is not canceled when a hijacked connection is
+	// closed, so watch for the client going away.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := c.Start(); err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+		return
+	}
+	defer c.Wait()
+	sc := bufio.NewScanner(out)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		rec, ok := parse(sc.Text())
+		if !ok {
+			continue
+		}
+		if err := conn.WriteJSON(rec); err != nil {
+			cancel()
+			return
+		}
+	}
+	if err := sc.Err(); err != nil && ctx.Err() == nil {
+		log.Printf("logs of %q: %v", sn, err)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+var errLogsNotSupported = errors.New("logs are not supported")
+
+// logRecordsCmd returns a command printing the logs of service sn of type st
+// selected by opts, and a function parsing its output lines into
+// LogRecords. The function reports false for lines to skip. grep, if non-nil,
+// is opts.Grep compiled.
+func (s *Server) logRecordsCmd(ctx context.Context, sn string, st db.ServiceType, opts *svc.LogOptions, grep *regexp.Regexp) (*exec.Cmd, func(string) (LogRecord, bool), error) {
+	switch st {
+	case db.ServiceTypeSystemd:
+		c := exec.CommandContext(ctx, "journalctl", append(opts.JournalctlArgs(), "--output=json", "--unit="+sn)...)
+		return c, parseJournalRecord, nil
+	case db.ServiceTypeDockerCompose:
+		service, err := s.dockerComposeService(sn)
+		if err != nil {
+			return nil, nil, err
+		}
+		service.NewCmd = func(name string, args ...string) *exec.Cmd {
+			return exec.CommandContext(ctx, name, args...)
+		}
+		opts.Timestamps = true
+		c, err := service.LogsCmd(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, func(l string) (LogRecord, bool) {
+			rec, ok := parseComposeRecord(l)
+			return rec, ok && (grep == nil || grep.MatchString(rec.Line))
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("%w for %s services", errLogsNotSupported, st)
+}
+
+// parseJournalRecord parses a line of `journalctl --output=json`.
+func parseJournalRecord(l string) (LogRecord, bool) {
+	var e struct {
+		Realtime string          `json:"__REALTIME_TIMESTAMP"`
+		Unit     string          `json:"_SYSTEMD_UNIT"`
+		Message  json.RawMessage `json:"MESSAGE"`
+	}
+	if err := json.Unmarshal([]byte(l), &e); err != nil {
+		return LogRecord{}, false
+	}
+	rec := LogRecord{Source: e.Unit}
+	if us, err := strconv.ParseInt(e.Realtime, 10, 64); err == nil {
+		rec.Time = time.UnixMicro(us)
+	}
+	// MESSAGE is a string, or an array of bytes if it isn't valid UTF-8.
+	if err := json.Unmarshal(e.Message, &rec.Line); err != nil {
+		var b []byte
+		var ints []int
+		if json.Unmarshal(e.Message, &ints) != nil {
+			return LogRecord{}, false
+		}
+		for _, v := range ints {
+			b = append(b, byte(v))
+		}
+		rec.Line = strings.ToValidUTF8(string(b), "�")
+	}
+	return rec, true
+}
+
+// parseComposeRecord parses a line of `docker compose logs --timestamps`,
+// which looks like "web-1  | 2006-01-02T15:04:05.999999999Z message".
+func parseComposeRecord(l string) (LogRecord, bool) {
+	src, rest, ok := strings.Cut(l, "|")
+	if !ok {
+		return LogRecord{}, false
+	}
+	rec := LogRecord{Source: strings.TrimSpace(src)}
+	rest = strings.TrimPrefix(rest, " ")
+	ts, line, _ := strings.Cut(rest, " ")
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		rec.Line = rest
+		return rec, true
+	}
+	rec.Time = t
+	rec.Line = line
+	return rec, true
+}
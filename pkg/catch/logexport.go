@@ -0,0 +1,221 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/svc"
+)
+
+// `logs --download` exports the logs of a service for a time range as a gzip
+// file. The export is written to the host first and then streamed to the
+// client, so that an interrupted download can resume from a byte offset:
+// once written, the export no longer changes even as new logs come in.
+//
+// The stream starts with a "yeet-log-export <size>" line giving the total
+// size of the export, followed by its bytes from the requested offset.
+
+// logExportTTL is how long exports are kept for downloads to resume.
+const logExportTTL = 24 * time.Hour
+
+// logExportHeader is the prefix of the first line of a log export stream.
+const logExportHeader = "yeet-log-export"
+
+func (s *Server) logExportDir() string {
+	return filepath.Join(s.cfg.RootDir, "log-exports")
+}
+
+// logExportPath returns the path of the export of the logs of service sn
+// selected by opts.
+func (s *Server) logExportPath(sn string, opts *svc.LogOptions) string {
+	h := sha256.Sum256(fmt.Appendf(nil, "%s\x00%d\x00%d\x00%s", sn, opts.Since.Unix(), opts.Until.Unix(), opts.Grep))
+	return filepath.Join(s.logExportDir(), fmt.Sprintf("%s-%x.log.gz", sn, h[:8]))
+}
+
+// exportLogs writes the logs of service sn selected by opts to a gzip file at
+// p, one "<time> <source> <line>" line per record. p only exists once the
+// export is complete.
+func (s *Server) exportLogs(ctx context.Context, sn string, opts *svc.LogOptions, p string) error {
+	st, err := s.serviceType(sn)
+	if err != nil {
+		return err
+	}
+	var grep *regexp.Regexp
+	if opts.Grep != "" {
+		if grep, err = regexp.Compile(opts.Grep); err != nil {
+			return fmt.Errorf("invalid --grep: %w", err)
+		}
+	}
+	c, parse, err := s.logRecordsCmd(ctx, sn, st, opts, grep)
+	if err != nil {
+		return err
+	}
+	out, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	bw := bufio.NewWriter(zw)
+
+	if err := c.Start(); err != nil {
+		return fmt.Errorf("failed to read logs: %w", err)
+	}
+	sc := bufio.NewScanner(out)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		rec, ok := parse(sc.Text())
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(bw, "%s %s %s\n", rec.Time.Format(time.RFC3339Nano), rec.Source, rec.Line)
+	}
+	if err := sc.Err(); err != nil {
+		c.Wait()
+		return fmt.Errorf("failed to read logs: %w", err)
+	}
+	if err := c.Wait(); err != nil {
+		return fmt.Errorf("failed to read logs: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// removeExpiredLogExports removes the exports older than logExportTTL, or
+// reports which it would remove with dryRun.
+func (s *Server) removeExpiredLogExports(dryRun bool) ([]string, error) {
+	ents, err := os.ReadDir(s.logExportDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, ent := range ents {
+		info, err := ent.Info()
+		if err != nil || time.Since(info.ModTime()) < logExportTTL {
+			continue
+		}
+		p := filepath.Join(s.logExportDir(), ent.Name())
+		if !dryRun {
+			if err := os.Remove(p); err != nil {
+				log.Printf("failed to remove log export: %v", err)
+				continue
+			}
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
+
+// downloadLogs streams the export of the logs selected by opts from byte
+// offset, creating the export first if needed. rateLimit, if non-zero, caps
+// the stream in bytes per second.
+func (e *ttyExecer) downloadLogs(opts *svc.LogOptions, offset, rateLimit int64) error {
+	if opts.Follow {
+		return fmt.Errorf("--download and --follow cannot be used together")
+	}
+	if opts.Until.IsZero() {
+		// Resuming needs the same export, so the range must not move.
+		return fmt.Errorf("--download requires --until")
+	}
+	e.s.removeExpiredLogExports(false)
+	p := e.s.logExportPath(e.sn, opts)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		log.Printf("exporting logs of %q to %s", e.sn, p)
+		if err := e.s.exportLogs(e.ctx, e.sn, opts, p); err != nil {
+			return fmt.Errorf("failed to export logs: %w", err)
+		}
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset > st.Size() {
+		return fmt.Errorf("invalid offset %d, export is %d bytes", offset, st.Size())
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.rw, "%s %d\n", logExportHeader, st.Size())
+	var w io.Writer = e.rw
+	if rateLimit > 0 {
+		w = &throttledWriter{w: w, rate: rateLimit, start: time.Now()}
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// throttledWriter is an io.Writer that writes to w at most rate bytes per
+// second on average.
+type throttledWriter struct {
+	w     io.Writer
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		// Write in chunks of at most a tenth of a second worth of bytes so
+		// that the rate is smooth.
+		chunk := p[:min(int64(len(p)), max(t.rate/10, 1))]
+		n, err := t.w.Write(chunk)
+		written += n
+		t.n += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		want := time.Duration(float64(t.n) / float64(t.rate) * float64(time.Second))
+		if d := want - time.Since(t.start); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"tailscale.com/net/netmon"
+)
+
+// validateMacvlanOpts validates the user supplied macvlan options so that bad
+// values are rejected when the service is staged rather than when the netns
+// is set up.
+func validateMacvlanOpts(o MacvlanOpts) error {
+	if o.VLAN != nil && (*o.VLAN < 1 || *o.VLAN > 4094) {
+		return fmt.Errorf("invalid macvlan VLAN ID %d: must be between 1 and 4094", *o.VLAN)
+	}
+	if o.Mac != "" {
+		hw, err := net.ParseMAC(o.Mac)
+		if err != nil {
+			return fmt.Errorf("invalid macvlan mac address %q: %w", o.Mac, err)
+		}
+		if len(hw) != 6 {
+			return fmt.Errorf("invalid macvlan mac address %q: must be a 48-bit address", o.Mac)
+		}
+		if hw[0]&0x01 != 0 {
+			return fmt.Errorf("invalid macvlan mac address %q: must be a unicast address", o.Mac)
+		}
+	}
+	if o.Parent != "" {
+		if _, err := net.InterfaceByName(o.Parent); err != nil {
+			return fmt.Errorf("invalid macvlan parent %q: %w (candidates: %s)", o.Parent, err, strings.Join(macvlanParentCandidates(), ", "))
+		}
+	}
+	return nil
+}
+
+// macvlanParent returns the parent interface to use for a macvlan interface.
+// If requested is set it is used as is. Otherwise the default route interface
+// is used if it is up, falling back to the only candidate parent interface.
+// If there are multiple candidates, an error listing them is returned.
+func macvlanParent(requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	if iface, err := netmon.DefaultRouteInterface(); err == nil {
+		if ifi, err := net.InterfaceByName(iface); err == nil && ifi.Flags&net.FlagUp != 0 {
+			return iface, nil
+		}
+	}
+	candidates := macvlanParentCandidates()
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no candidate macvlan parent interfaces found; use --macvlan-parent")
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("multiple candidate macvlan parent interfaces found (%s); use --macvlan-parent", strings.Join(candidates, ", "))
+	}
+}
+
+// macvlanParentCandidates returns the sorted names of physical interfaces that
+// are up and have carrier.
+func macvlanParentCandidates() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		sysDir := filepath.Join("/sys/class/net", ifi.Name)
+		// Only physical interfaces have a device link.
+		if _, err := os.Stat(filepath.Join(sysDir, "device")); err != nil {
+			continue
+		}
+		if carrier, err := os.ReadFile(filepath.Join(sysDir, "carrier")); err != nil || strings.TrimSpace(string(carrier)) != "1" {
+			continue
+		}
+		names = append(names, ifi.Name)
+	}
+	slices.Sort(names)
+	return names
+}
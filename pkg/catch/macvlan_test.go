@@ -0,0 +1,47 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"testing"
+
+	"tailscale.com/types/ptr"
+)
+
+func TestValidateMacvlanOpts(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MacvlanOpts
+		wantErr bool
+	}{
+		{name: "empty", opts: MacvlanOpts{}},
+		{name: "vlan-1", opts: MacvlanOpts{VLAN: ptr.To(1)}},
+		{name: "vlan-4094", opts: MacvlanOpts{VLAN: ptr.To(4094)}},
+		{name: "vlan-0", opts: MacvlanOpts{VLAN: ptr.To(0)}, wantErr: true},
+		{name: "vlan-negative", opts: MacvlanOpts{VLAN: ptr.To(-1)}, wantErr: true},
+		{name: "vlan-4095", opts: MacvlanOpts{VLAN: ptr.To(4095)}, wantErr: true},
+		{name: "mac", opts: MacvlanOpts{Mac: "02:00:00:00:00:01"}},
+		{name: "mac-multicast", opts: MacvlanOpts{Mac: "01:00:5e:00:00:01"}, wantErr: true},
+		{name: "mac-invalid", opts: MacvlanOpts{Mac: "nope"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMacvlanOpts(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateMacvlanOpts(%+v) = %v, wantErr %v", tt.opts, err, tt.wantErr)
+			}
+		})
+	}
+}
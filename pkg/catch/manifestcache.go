@@ -0,0 +1,86 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// manifestCacheMaxBytes bounds the total size of manifests kept in
+	// memory by the registry.
+	manifestCacheMaxBytes = 16 << 20
+
+	// manifestCacheMaxEntryBytes is the largest manifest that is cached.
+	// Larger manifests, like huge manifest lists, are streamed from disk on
+	// every request instead of evicting everything else.
+	manifestCacheMaxEntryBytes = manifestCacheMaxBytes / 8
+)
+
+// manifestCache is an LRU cache of manifest contents keyed by their sha256.
+// Manifests are content addressed, so entries never go stale; at worst an
+// entry outlives a manifest that was garbage collected until it is evicted.
+type manifestCache struct {
+	mu    sync.Mutex
+	size  int                      // total bytes of cached manifests
+	ll    *list.List               // of *manifestCacheEntry, most recent first
+	items map[string]*list.Element // sha256 -> element in ll
+}
+
+type manifestCacheEntry struct {
+	sha256 string
+	b      []byte
+}
+
+// get returns the cached contents of manifest sha256, if any. The returned
+// slice must not be modified.
+func (c *manifestCache) get(sha256 string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[sha256]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*manifestCacheEntry).b, true
+}
+
+// add caches the contents of manifest sha256, evicting the least recently
+// used manifests to stay within manifestCacheMaxBytes.
+func (c *manifestCache) add(sha256 string, b []byte) {
+	if len(b) > manifestCacheMaxEntryBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items == nil {
+		c.items = make(map[string]*list.Element)
+		c.ll = list.New()
+	}
+	if e, ok := c.items[sha256]; ok {
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[sha256] = c.ll.PushFront(&manifestCacheEntry{sha256: sha256, b: b})
+	c.size += len(b)
+	for c.size > manifestCacheMaxBytes {
+		e := c.ll.Back()
+		ent := e.Value.(*manifestCacheEntry)
+		c.ll.Remove(e)
+		delete(c.items, ent.sha256)
+		c.size -= len(ent.b)
+	}
+}
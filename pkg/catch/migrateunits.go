@@ -0,0 +1,146 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+)
+
+// templatedArtifacts are the artifacts generated from the templates of
+// package svc, which `sys migrate-units` re-renders when the templates
+// change.
+var templatedArtifacts = []db.ArtifactName{
+	db.ArtifactSystemdUnit,
+	db.ArtifactSystemdTimerFile,
+	db.ArtifactNetNSService,
+	db.ArtifactTSService,
+	db.ArtifactDockerComposeNetwork,
+}
+
+// outdatedUnits returns the staged artifacts of service sn that were
+// rendered with an older template version, and their paths.
+func (s *Server) outdatedUnits(sn string) (map[db.ArtifactName]string, error) {
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		return nil, err
+	}
+	af := sv.AsStruct().Artifacts
+	outdated := map[db.ArtifactName]string{}
+	for _, name := range templatedArtifacts {
+		p, ok := af.Staged(name)
+		if !ok {
+			continue
+		}
+		v, err := svc.ArtifactTemplateVersion(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if v < svc.TemplateVersion {
+			outdated[name] = p
+		}
+	}
+	return outdated, nil
+}
+
+// migrateUnits re-renders the outdated templated artifacts of service sn
+// with the current templates and stages them. It returns the names of the
+// migrated artifacts.
+func (s *Server) migrateUnits(sn string) ([]db.ArtifactName, error) {
+	outdated, err := s.outdatedUnits(sn)
+	if err != nil || len(outdated) == 0 {
+		return nil, err
+	}
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		return nil, err
+	}
+	af := sv.AsStruct().Artifacts
+	staged := map[db.ArtifactName]string{}
+	for _, name := range slices.Sorted(maps.Keys(outdated)) {
+		p := outdated[name]
+		var np string
+		switch name {
+		case db.ArtifactSystemdUnit:
+			timer, _ := af.Staged(db.ArtifactSystemdTimerFile)
+			np, err = svc.RerenderServiceUnit(p, timer)
+		case db.ArtifactNetNSService, db.ArtifactTSService:
+			np, err = svc.RerenderServiceUnit(p, "")
+		case db.ArtifactSystemdTimerFile:
+			np, err = svc.RerenderTimerUnit(p)
+		case db.ArtifactDockerComposeNetwork:
+			np, err = svc.RerenderComposeNetwork(p)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-render %s: %w", name, err)
+		}
+		staged[name] = np
+	}
+	if _, _, err := s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+		for name, p := range staged {
+			s.Artifacts[name].Refs["staged"] = p
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update service: %w", err)
+	}
+	return slices.Sorted(maps.Keys(staged)), nil
+}
+
+// sysMigrateUnitsCmdFunc stages the units of every service that were
+// rendered with older templates re-rendered with the current ones.
+func (e *ttyExecer) sysMigrateUnitsCmdFunc(cmd *cobra.Command, _ []string) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	var migrated []string
+	for _, sn := range slices.Sorted(maps.Keys(dv.AsStruct().Services)) {
+		var names []db.ArtifactName
+		if dryRun {
+			outdated, err := e.s.outdatedUnits(sn)
+			if err != nil {
+				return fmt.Errorf("%s: %w", sn, err)
+			}
+			names = slices.Sorted(maps.Keys(outdated))
+		} else if names, err = e.s.migrateUnits(sn); err != nil {
+			return fmt.Errorf("%s: %w", sn, err)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		migrated = append(migrated, sn)
+		verb := "Staged"
+		if dryRun {
+			verb = "Would stage"
+		}
+		e.printf("%s %s: %v\n", verb, sn, names)
+	}
+	if len(migrated) == 0 {
+		e.printf("All units use template version %d\n", svc.TemplateVersion)
+		return nil
+	}
+	if !dryRun {
+		e.printf("Run `yeet sys commit %s` to install them\n", strings.Join(migrated, " "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"time"
+)
+
+// The background loops of catch, heartbeats, health checks and scheduled
+// garbage collection, sleep as long as they can instead of polling: the
+// heartbeat only runs while a listener wants heartbeats, and the others
+// sleep until their next due work, at most Config.MonitorInterval. Changes
+// that affect them call wakeMonitors so they don't wait for that.
+
+const (
+	// defaultHeartbeatInterval is the default of Config.HeartbeatInterval.
+	defaultHeartbeatInterval = time.Second
+	// defaultMonitorInterval is the default of Config.MonitorInterval.
+	defaultMonitorInterval = time.Minute
+)
+
+func (s *Server) heartbeatInterval() time.Duration {
+	return cmp.Or(s.cfg.HeartbeatInterval, defaultHeartbeatInterval)
+}
+
+func (s *Server) monitorInterval() time.Duration {
+	return cmp.Or(s.cfg.MonitorInterval, defaultMonitorInterval)
+}
+
+// monitorWake returns a channel that is closed by the next call to
+// wakeMonitors. Loops must get it before checking for work, so that no
+// wake-up is missed.
+func (s *Server) monitorWake() <-chan struct{} {
+	s.wake.mu.Lock()
+	defer s.wake.mu.Unlock()
+	if s.wake.ch == nil {
+		s.wake.ch = make(chan struct{})
+	}
+	return s.wake.ch
+}
+
+// wakeMonitors wakes the background loops up to look for work.
+func (s *Server) wakeMonitors() {
+	s.wake.mu.Lock()
+	defer s.wake.mu.Unlock()
+	if s.wake.ch != nil {
+		close(s.wake.ch)
+		s.wake.ch = nil
+	}
+}
+
+// sleepUntil waits until d passed, wake is closed or the server is shut
+// down, in which case it returns false.
+func (s *Server) sleepUntil(d time.Duration, wake <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-wake:
+	case <-t.C:
+	}
+	return true
+}
+
+// wantsHeartbeats reports whether any event listener accepts heartbeats.
+func (s *Server) wantsHeartbeats() bool {
+	hb := Event{Type: EventTypeHeartbeat, ServiceName: SystemService}
+	els := &s.eventListeners
+	els.mu.Lock()
+	defer els.mu.Unlock()
+	for _, el := range els.s {
+		if el.filter == nil || el.filter(hb) {
+			return true
+		}
+	}
+	return false
+}
+
+// heartbeat publishes a heartbeat event every Config.HeartbeatInterval while
+// a listener wants them.
+func (s *Server) heartbeat() {
+	for {
+		wake := s.monitorWake()
+		if !s.wantsHeartbeats() {
+			// Sleep until a listener is added.
+			if !s.sleepUntil(s.monitorInterval(), wake) {
+				return
+			}
+			continue
+		}
+		if !s.sleepUntil(s.heartbeatInterval(), nil) {
+			return
+		}
+		s.PublishEvent(Event{
+			Type:        EventTypeHeartbeat,
+			ServiceName: SystemService,
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// mutatingCommands are the commands that change a service, which show the
+// notice of the service before they run.
+var mutatingCommands = map[string]bool{
+	"approve":  true,
+	"convert":  true,
+	"cron":     true,
+	"disable":  true,
+	"edit":     true,
+	"enable":   true,
+	"env":      true,
+	"label":    true,
+	"protect":  true,
+	"remove":   true,
+	"restart":  true,
+	"rollback": true,
+	"run":      true,
+	"runtime":  true,
+	"secret":   true,
+	"stage":    true,
+	"start":    true,
+	"stop":     true,
+}
+
+// motdSessionTTL is how long a client session is remembered to have been
+// shown the host banner.
+const motdSessionTTL = time.Hour
+
+// printNotices prints the host banner at the start of interactive sessions,
+// once per client session, and the notice of the service before commands
+// that change it. subCmd is the top-level command being run.
+func (e *ttyExecer) printNotices(cmd *cobra.Command, subCmd string) {
+	dv, err := e.s.getDB()
+	if err != nil {
+		log.Printf("getDB: %v", err)
+		return
+	}
+	if motd := dv.Motd(); e.isPty && motd != "" && e.s.firstMotd(e.clientSession, time.Now()) {
+		e.printf("%s\n\n", strings.TrimRight(motd, "\n"))
+	}
+	if !mutatingCommands[subCmd] || cmd.CalledAs() == "show" {
+		return
+	}
+	if sv, ok := dv.Services().GetOk(e.sn); ok && sv.Notice() != "" {
+		e.printf("Notice for %s:\n%s\n\n", e.sn, strings.TrimRight(sv.Notice(), "\n"))
+	}
+}
+
+// firstMotd reports whether the host banner is yet to be shown in client
+// session id, and records that it is shown at now. Sessions without an id
+// always show it.
+func (s *Server) firstMotd(id string, now time.Time) bool {
+	if id == "" {
+		return true
+	}
+	s.motdShown.mu.Lock()
+	defer s.motdShown.mu.Unlock()
+	for k, t := range s.motdShown.m {
+		if now.Sub(t) > motdSessionTTL {
+			delete(s.motdShown.m, k)
+		}
+	}
+	if _, ok := s.motdShown.m[id]; ok {
+		return false
+	}
+	mak.Set(&s.motdShown.m, id, now)
+	return true
+}
+
+// sysMotdCmdFunc shows, edits or clears the host banner, or the notice of the
+// service given as the second argument.
+func (e *ttyExecer) sysMotdCmdFunc(_ *cobra.Command, args []string) error {
+	action := "show"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	var sn string
+	if len(args) > 1 {
+		sn = args[1]
+		if _, err := e.s.serviceView(sn); err != nil {
+			return err
+		}
+	}
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	cur := dv.Motd()
+	if sn != "" {
+		cur = dv.Services().Get(sn).Notice()
+	}
+
+	var text string
+	switch action {
+	case "show":
+		if cur == "" {
+			e.printf("(none)\n")
+		} else {
+			e.printf("%s\n", strings.TrimRight(cur, "\n"))
+		}
+		return nil
+	case "edit":
+		f, err := createTmpFile()
+		if err != nil {
+			return fmt.Errorf("failed to create temp file: %w", err)
+		}
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(cur)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write temp file: %w", err)
+		}
+		if err := e.editFile(f.Name()); err != nil {
+			return fmt.Errorf("failed to edit: %w", err)
+		}
+		b, err := os.ReadFile(f.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read temp file: %w", err)
+		}
+		text = strings.TrimSpace(string(b))
+		if text == strings.TrimSpace(cur) {
+			e.printf("No changes\n")
+			return nil
+		}
+	case "clear":
+	default:
+		return fmt.Errorf("invalid argument %q, expected show, edit or clear", action)
+	}
+
+	if sn != "" {
+		_, _, err = e.s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+			s.Notice = text
+			return nil
+		})
+	} else {
+		_, err = e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			d.Motd = text
+			return nil
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update motd: %w", err)
+	}
+	switch {
+	case text == "" && sn != "":
+		e.printf("Cleared the notice of %s\n", sn)
+	case text == "":
+		e.printf("Cleared the host banner\n")
+	case sn != "":
+		e.printf("Updated the notice of %s\n", sn)
+	default:
+		e.printf("Updated the host banner\n")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFirstMotd(t *testing.T) {
+	s := &Server{}
+	now := time.Now()
+	if !s.firstMotd("a", now) {
+		t.Error("banner not shown at the start of session a")
+	}
+	if s.firstMotd("a", now.Add(time.Minute)) {
+		t.Error("banner shown twice in session a")
+	}
+	if !s.firstMotd("b", now) {
+		t.Error("banner not shown at the start of session b")
+	}
+	if !s.firstMotd("", now) || !s.firstMotd("", now) {
+		t.Error("banner not shown to a session without an id")
+	}
+	if !s.firstMotd("a", now.Add(2*motdSessionTTL)) {
+		t.Error("banner not shown again once session a expired")
+	}
+}
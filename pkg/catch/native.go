@@ -0,0 +1,134 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+)
+
+// hostService is a service of type db.ServiceTypeSystemd, run by the service
+// manager of the host: systemd on Linux, launchd on macOS and the service
+// control manager on Windows.
+type hostService interface {
+	Name() string
+	Install() error
+	Uninstall() error
+	Start() error
+	Stop() error
+	Restart() error
+	Enable() error
+	Disable() error
+	Status() (svc.Status, error)
+	RuntimeInfo() (svc.RuntimeInfo, error)
+}
+
+// nativeService is a hostService not run by systemd.
+type nativeService interface {
+	hostService
+	// LogCommand returns the command that prints the logs selected by opts.
+	LogCommand(opts *svc.LogOptions) (name string, args []string, _ error)
+}
+
+// newHostService returns the service sv run by the service manager of the
+// host.
+func (s *Server) newHostService(sv db.ServiceView) (hostService, error) {
+	runDir := s.serviceRunDir(sv.Name())
+	switch runtime.GOOS {
+	case "darwin":
+		ls := svc.NewLaunchdService(sv, runDir)
+		ls.CopyEnvFile = s.installEnvFile
+		ls.ReadEnvFile = readEnvFile
+		return ls, nil
+	case "windows":
+		ws := svc.NewWindowsService(sv, runDir)
+		ws.CopyEnvFile = s.installEnvFile
+		ws.ReadEnvFile = readEnvFile
+		return ws, nil
+	}
+	service, err := svc.NewSystemdService(s.cfg.DB, sv, runDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service: %v", err)
+	}
+	service.CopyEnvFile = s.installEnvFile
+	return service, nil
+}
+
+// hostService returns the service sn run by the service manager of the host.
+func (s *Server) hostService(sn string) (hostService, error) {
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service view: %v", err)
+	}
+	return s.newHostService(sv)
+}
+
+// nativeServiceRunner is the ServiceRunner of services run by launchd or the
+// Windows service control manager.
+type nativeServiceRunner struct {
+	nativeService
+	newCmd func(string, ...string) *exec.Cmd
+}
+
+func (s *nativeServiceRunner) SetNewCmd(f func(string, ...string) *exec.Cmd) {
+	s.newCmd = f
+}
+
+// Enable enables the service and starts it.
+func (s *nativeServiceRunner) Enable() error {
+	if err := s.nativeService.Enable(); err != nil {
+		return err
+	}
+	return s.nativeService.Start()
+}
+
+// Disable stops and disables the service.
+func (s *nativeServiceRunner) Disable() error {
+	if err := s.nativeService.Stop(); err != nil {
+		return err
+	}
+	return s.nativeService.Disable()
+}
+
+func (s *nativeServiceRunner) Logs(opts *svc.LogOptions) error {
+	if opts == nil {
+		opts = &svc.LogOptions{}
+	}
+	name, args, err := s.LogCommand(opts)
+	if err != nil {
+		return err
+	}
+	c := s.newCmd(name, args...)
+	flush, err := svc.FilterLogs(c, opts.Grep)
+	if err != nil {
+		return err
+	}
+	defer flush()
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *nativeServiceRunner) Remove() error {
+	if err := s.nativeService.Stop(); err != nil {
+		return err
+	}
+	return s.nativeService.Uninstall()
+}
@@ -0,0 +1,219 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/dnet"
+	"github.com/spf13/cobra"
+)
+
+// serviceNetwork returns the ID and a copy of the docker network living in
+// the netns of service sn.
+func (s *Server) serviceNetwork(sn string) (string, *db.DockerNetwork, error) {
+	d, err := s.getDB()
+	if err != nil {
+		return "", nil, err
+	}
+	ns := "yeet-" + sn + "-ns"
+	for id, n := range d.AsStruct().DockerNetworks {
+		if filepath.Base(n.NetNS) == ns {
+			return id, n, nil
+		}
+	}
+	return "", nil, fmt.Errorf("service %q has no yeet network", sn)
+}
+
+func (e *ttyExecer) netCmdFunc(cmd *cobra.Command, args []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("net commands are not supported for %q", e.sn)
+	}
+	switch cmd.CalledAs() {
+	case "show":
+		return e.netRulesShowCmdFunc(cmd)
+	case "edit":
+		return e.netRulesEditCmdFunc()
+	case "history":
+		return e.netRulesHistoryCmdFunc()
+	case "rollback":
+		return e.netRulesRollbackCmdFunc(args)
+	default:
+		return fmt.Errorf("unhandled net command %q", cmd.CalledAs())
+	}
+}
+
+func (e *ttyExecer) netRulesShowCmdFunc(cmd *cobra.Command) error {
+	_, n, err := e.s.serviceNetwork(e.sn)
+	if err != nil {
+		return err
+	}
+	if gen, _ := cmd.Flags().GetInt("gen"); gen >= 0 && gen != n.RulesGeneration {
+		extra, ok := dnet.ExtraRulesAt(n, gen)
+		if !ok {
+			return fmt.Errorf("generation %d is not kept", gen)
+		}
+		e.printf("# generation %d, rendered with the current published ports\n", gen)
+		e.printf("%s", dnet.RenderRules(n, extra))
+		return nil
+	}
+	e.printf("# generation %d\n", n.RulesGeneration)
+	out, err := exec.Command("nsenter", "--net="+n.NetNS, "nft", "list", "table", "ip", dnet.RulesTable).Output()
+	if err != nil {
+		e.printf("# live ruleset unavailable (%v), showing rendered ruleset\n", err)
+		e.printf("%s", dnet.RenderRules(n, n.ExtraRules))
+		return nil
+	}
+	e.printf("%s", out)
+	return nil
+}
+
+const netRulesHeader = `# Extra nftables rules for the yeet table of this service's network.
+# They are added to the table after the published port rules, e.g.
+#
+#   chain input {
+#       type filter hook input priority filter; policy accept;
+#       tcp dport 22 drop
+#   }
+#
+# The ruleset is validated before it is applied; lines starting with # are
+# ignored.
+`
+
+func (e *ttyExecer) netRulesEditCmdFunc() error {
+	_, n, err := e.s.serviceNetwork(e.sn)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "yeet-rules-*.nft")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, netRulesHeader)
+	if n.ExtraRules != "" {
+		fmt.Fprintf(f, "\n%s\n", n.ExtraRules)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := e.editFile(f.Name()); err != nil {
+		return fmt.Errorf("failed to edit rules: %w", err)
+	}
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read rules: %w", err)
+	}
+	var lines []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(l), "#") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	extra := strings.TrimSpace(strings.Join(lines, "\n"))
+	if extra == n.ExtraRules {
+		e.printf("No changes\n")
+		return nil
+	}
+	return e.setNetRules(extra)
+}
+
+func (e *ttyExecer) netRulesHistoryCmdFunc() error {
+	_, n, err := e.s.serviceNetwork(e.sn)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "GEN\tLINES\t")
+	fmt.Fprintf(tw, "%d\t%d\t(current)\n", n.RulesGeneration, countLines(n.ExtraRules))
+	for _, v := range slices.Backward(n.RulesHistory) {
+		fmt.Fprintf(tw, "%d\t%d\t\n", v.Generation, countLines(v.ExtraRules))
+	}
+	return tw.Flush()
+}
+
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	return strings.Count(s, "\n") + 1
+}
+
+func (e *ttyExecer) netRulesRollbackCmdFunc(args []string) error {
+	_, n, err := e.s.serviceNetwork(e.sn)
+	if err != nil {
+		return err
+	}
+	var gen int
+	if len(args) == 1 {
+		gen, err = strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid generation %q: %w", args[0], err)
+		}
+	} else {
+		if len(n.RulesHistory) == 0 {
+			return fmt.Errorf("no previous rules to roll back to")
+		}
+		gen = n.RulesHistory[len(n.RulesHistory)-1].Generation
+	}
+	if gen == n.RulesGeneration {
+		return fmt.Errorf("generation %d is the current one", gen)
+	}
+	extra, ok := dnet.ExtraRulesAt(n, gen)
+	if !ok {
+		return fmt.Errorf("generation %d is not kept", gen)
+	}
+	return e.setNetRules(extra)
+}
+
+// setNetRules validates and atomically applies extra as a new generation of
+// the extra rules of the service's network, keeping the current ones in its
+// history.
+func (e *ttyExecer) setNetRules(extra string) error {
+	id, n, err := e.s.serviceNetwork(e.sn)
+	if err != nil {
+		return err
+	}
+	rules := dnet.RenderRules(n, extra)
+	if err := dnet.ApplyRules(n.NetNS, rules, true); err != nil {
+		return fmt.Errorf("invalid rules, nothing was changed: %w", err)
+	}
+	if err := dnet.ApplyRules(n.NetNS, rules, false); err != nil {
+		return err
+	}
+	var gen int
+	if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+		dn, ok := d.DockerNetworks[id]
+		if !ok {
+			return fmt.Errorf("network not found")
+		}
+		dnet.SetExtraRules(dn, extra)
+		gen = dn.RulesGeneration
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to save rules: %w", err)
+	}
+	e.printf("Applied rules generation %d\n", gen)
+	return nil
+}
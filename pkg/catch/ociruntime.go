@@ -0,0 +1,236 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/fileutil"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// OCI runtime: for services with Runtime set to db.RuntimeOCI, a pushed image
+// is pulled from the internal registry by catch and run as a single container
+// by a generated systemd unit with `docker run`, or with nerdctl on hosts that
+// only have containerd. No compose file is involved, so such services are
+// managed as systemd services. The ports the image exposes are published on
+// the loopback interface only, unless the service has its own network
+// namespace from --net, which the container joins through the yeet docker
+// network plugin like compose services do.
+
+var ociUnitTemplate = template.Must(template.New("oci").Parse(`[Unit]
+Description=yeet service {{.ServiceName}}
+Wants=network-online.target
+After=network-online.target {{.Daemon}} catch.service{{with .NetNSUnit}} {{.}}{{end}}
+Requires={{.Daemon}}{{with .NetNSUnit}} {{.}}{{end}}
+
+[Service]
+ExecStartPre=-{{.CLI}} rm -f {{.ServiceName}}
+ExecStartPre=touch {{.EnvFile}}
+{{- if .NetNS}}
+ExecStartPre=-{{.CLI}} network create --driver yeet --opt {{.NetNSOpt}}={{.NetNS}} {{.Network}}
+{{- end}}
+ExecStart={{.CLI}} run --rm --pull=never --name {{.ServiceName}} --env-file {{.EnvFile}}
+{{- if .NetNS}} --network {{.Network}}{{end}}
+{{- range .Ports}} -p {{.}}{{end}}
+{{- range .Volumes}} -v {{.}}{{end}} {{.Image}}
+ExecStop={{.CLI}} stop {{.ServiceName}}
+Restart=always
+RestartSec=1
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// ociTemplateData is the data used to render the OCI runtime unit.
+type ociTemplateData struct {
+	ServiceName string
+	// CLI is the path of docker or nerdctl.
+	CLI string
+	// Daemon is the systemd unit of the container daemon CLI talks to.
+	Daemon string
+	// Image is the local tag of the pushed image, see pullLocalImage.
+	Image   string
+	EnvFile string
+	// NetNS is the path of the network namespace of the service, if it
+	// has one, NetNSUnit the unit that sets it up and Network the docker
+	// network joining it with the NetNSOpt driver option.
+	NetNS     string
+	NetNSUnit string
+	Network   string
+	NetNSOpt  string
+	Ports     []string
+	Volumes   []string
+}
+
+// ociCLI returns the path of the container CLI used to run OCI runtime
+// services and the systemd unit of its daemon: docker if it is installed,
+// otherwise containerd's nerdctl.
+func ociCLI() (cli, daemon, insecure string, _ error) {
+	if p, err := svc.DockerCmd(); err == nil {
+		return p, "docker.service", "", nil
+	}
+	if p, err := exec.LookPath("nerdctl"); err == nil {
+		return p, "containerd.service", "--insecure-registry", nil
+	}
+	return "", "", "", errors.New("neither docker nor nerdctl is installed")
+}
+
+// installOCIService renders a systemd unit that runs the image pushed to repo
+// for service sn and stages (or installs, if install is set) it.
+func (cr *containerRegistry) installOCIService(sn, actor, repo string, manifest []byte, install bool) error {
+	cli, daemon, insecure, err := ociCLI()
+	if err != nil {
+		return err
+	}
+	if err := cr.s.ensureDirs(sn, ""); err != nil {
+		return err
+	}
+	data := ociTemplateData{
+		ServiceName: sn,
+		CLI:         cli,
+		Daemon:      daemon,
+		EnvFile:     filepath.Join(cr.s.serviceRunDir(sn), "env"),
+		Volumes:     []string{cr.s.stagedDataDir(sn) + ":/data"},
+	}
+	if dv, err := cr.s.getDB(); err != nil {
+		return err
+	} else if sv, ok := dv.Services().GetOk(sn); ok && hasNetNS(sv.AsStruct()) {
+		if daemon != "docker.service" {
+			return fmt.Errorf("running %q in its network namespace needs docker, nerdctl can't join it", sn)
+		}
+		data.NetNS = filepath.Join("/var/run/netns", "yeet-"+sn+"-ns")
+		data.NetNSUnit = "yeet-" + sn + "-ns.service"
+		data.Network = "yeet-" + sn
+		data.NetNSOpt = svc.ComposeNetworkNetNSOpt
+	} else {
+		for _, p := range cr.s.imageExposedPorts(manifest) {
+			data.Ports = append(data.Ports, "127.0.0.1:"+p)
+		}
+	}
+	if data.Image, err = cr.pullLocalImage(cli, insecure, repo, manifest); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := ociUnitTemplate.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to render unit: %w", err)
+	}
+	p := fileutil.UpdateVersion(filepath.Join(cr.s.serviceBinDir(sn), sn+".service"))
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write unit: %w", err)
+	}
+	if _, _, err := cr.s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+		if s.ServiceType == "" {
+			s.ServiceType = db.ServiceTypeSystemd
+		} else if s.ServiceType != db.ServiceTypeSystemd {
+			return fmt.Errorf("service type mismatch: %v != %v; remove the service first", s.ServiceType, db.ServiceTypeSystemd)
+		}
+		af, ok := s.Artifacts[db.ArtifactSystemdUnit]
+		if !ok {
+			af = &db.Artifact{Refs: map[db.ArtifactRef]string{}}
+			mak.Set(&s.Artifacts, db.ArtifactSystemdUnit, af)
+		}
+		af.Refs["staged"] = p
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	if !install {
+		return nil
+	}
+	si, err := cr.s.NewInstaller(InstallerCfg{
+		ServiceName:     sn,
+		ClientOut:       io.Discard,
+		Printer:         log.Printf,
+		Actor:           actor,
+		BackgroundWatch: true,
+	})
+	if err != nil {
+		return err
+	}
+	return si.Install()
+}
+
+// hasNetNS reports whether service s runs in its own network namespace,
+// staged or installed with --net.
+func hasNetNS(s *db.Service) bool {
+	if _, ok := s.Artifacts.Staged(db.ArtifactNetNSService); ok {
+		return true
+	}
+	_, ok := s.Artifacts.Gen(db.ArtifactNetNSService, s.Generation)
+	return ok
+}
+
+// runtimeCmdFunc shows or sets how pushed images for the service are run.
+func (e *ttyExecer) runtimeCmdFunc(_ *cobra.Command, args []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("setting the runtime is not supported for %q", e.sn)
+	}
+	if len(args) == 0 {
+		sv, err := e.s.serviceView(e.sn)
+		if err != nil {
+			return err
+		}
+		if sv.Runtime() == "" {
+			e.printf("runtime: compose\n")
+		} else {
+			e.printf("runtime: %s\n", sv.Runtime())
+		}
+		return nil
+	}
+	return e.setRuntime(args[0])
+}
+
+// setRuntime sets the runtime of the service to rt, either "compose" or
+// db.RuntimeOCI.
+func (e *ttyExecer) setRuntime(rt string) error {
+	switch rt {
+	case "compose":
+		rt = ""
+	case db.RuntimeOCI:
+	default:
+		return fmt.Errorf("invalid runtime %q, expected compose or oci", rt)
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		if rt == db.RuntimeOCI {
+			if s.ServiceType == db.ServiceTypeDockerCompose {
+				return fmt.Errorf("service %q is a compose service; remove it before switching to the oci runtime", e.sn)
+			}
+			if s.Quadlet {
+				return fmt.Errorf("service %q runs as a quadlet; turn it off first", e.sn)
+			}
+		}
+		s.Runtime = rt
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	if rt == "" {
+		rt = "compose"
+	}
+	e.printf("runtime: %s; takes effect on the next push\n", rt)
+	return nil
+}
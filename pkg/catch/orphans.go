@@ -0,0 +1,248 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yeetrun/yeet/pkg/cmdutil"
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/fileutil"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+)
+
+// An orphan is a docker compose project named like the ones catch creates,
+// catch-<svc>, for which there is no service in the DB. They are left over
+// from crashes in the middle of an install or remove, or from running docker
+// compose by hand, and keep running unseen by yeet until adopted or
+// destroyed.
+
+// ComposeOrphan is a compose project without a service.
+type ComposeOrphan struct {
+	// Project is the compose project name.
+	Project string `json:"project"`
+	// ServiceName is the name of the service the project belonged to.
+	ServiceName string `json:"serviceName"`
+	// Status is the status of the project as reported by docker, e.g.
+	// "running(2)".
+	Status string `json:"status"`
+	// ConfigFiles are the compose files the project was started with.
+	ConfigFiles []string `json:"configFiles"`
+}
+
+// composeOrphans returns the compose projects, running or not, that are
+// named like catch projects but have no service in the DB.
+func (s *Server) composeOrphans() ([]ComposeOrphan, error) {
+	docker, err := svc.DockerCmd()
+	if err != nil {
+		if errors.Is(err, svc.ErrDockerNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out, err := exec.Command(docker, "compose", "ls", "--all", "--format", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list compose projects: %w", err)
+	}
+	var projects []struct {
+		Name        string
+		Status      string
+		ConfigFiles string
+	}
+	if err := json.Unmarshal(out, &projects); err != nil {
+		return nil, fmt.Errorf("failed to parse compose projects: %w", err)
+	}
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	var orphans []ComposeOrphan
+	for _, p := range projects {
+		sn, ok := strings.CutPrefix(p.Name, "catch-")
+		if !ok || sn == "" {
+			continue
+		}
+		if _, ok := dv.Services().GetOk(sn); ok {
+			continue
+		}
+		o := ComposeOrphan{Project: p.Name, ServiceName: sn, Status: p.Status}
+		if p.ConfigFiles != "" {
+			o.ConfigFiles = strings.Split(p.ConfigFiles, ",")
+		}
+		orphans = append(orphans, o)
+	}
+	return orphans, nil
+}
+
+// composeOrphan returns the orphaned compose project of service sn.
+func (s *Server) composeOrphan(sn string) (ComposeOrphan, error) {
+	orphans, err := s.composeOrphans()
+	if err != nil {
+		return ComposeOrphan{}, err
+	}
+	for _, o := range orphans {
+		if o.ServiceName == sn || o.Project == sn {
+			return o, nil
+		}
+	}
+	return ComposeOrphan{}, fmt.Errorf("no orphaned compose project for %q", sn)
+}
+
+// logComposeOrphans logs the orphaned compose projects, so that they are
+// noticed when catch starts.
+func (s *Server) logComposeOrphans() {
+	orphans, err := s.composeOrphans()
+	if err != nil {
+		log.Printf("failed to look for orphaned compose projects: %v", err)
+		return
+	}
+	for _, o := range orphans {
+		log.Printf("compose project %q (%s) has no service; adopt or destroy it with `sys orphans`", o.Project, o.Status)
+	}
+}
+
+// sysOrphansCmdFunc lists the orphaned compose projects, or adopts or
+// destroys the one of a service.
+func (e *ttyExecer) sysOrphansCmdFunc(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return e.listComposeOrphans()
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: sys orphans [list | adopt <svc> | destroy <svc>]")
+	}
+	o, err := e.s.composeOrphan(args[1])
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "adopt":
+		return e.adoptComposeOrphan(o)
+	case "destroy":
+		volumes, _ := cmd.Flags().GetBool("volumes")
+		return e.destroyComposeOrphan(o, volumes)
+	default:
+		return fmt.Errorf("invalid argument %q, expected list, adopt or destroy", args[0])
+	}
+}
+
+func (e *ttyExecer) listComposeOrphans() error {
+	orphans, err := e.s.composeOrphans()
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		e.printf("No orphaned compose projects\n")
+		return nil
+	}
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "PROJECT\tSERVICE\tSTATUS\tCONFIG FILES\t")
+	for _, o := range orphans {
+		files := "-"
+		if len(o.ConfigFiles) > 0 {
+			files = strings.Join(o.ConfigFiles, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", o.Project, o.ServiceName, o.Status, files)
+	}
+	return nil
+}
+
+// adoptComposeOrphan creates a docker compose service from the compose file
+// the orphaned project was started with and installs it. As the project
+// name is the same, compose takes over the running containers.
+func (e *ttyExecer) adoptComposeOrphan(o ComposeOrphan) error {
+	if len(o.ConfigFiles) == 0 {
+		return fmt.Errorf("project %q has no compose file to adopt, destroy it instead", o.Project)
+	}
+	if len(o.ConfigFiles) > 1 {
+		e.printf("Warning: project %q was started with %d compose files, only adopting %s\n", o.Project, len(o.ConfigFiles), o.ConfigFiles[0])
+	}
+	sn := o.ServiceName
+	if err := e.s.ensureDirs(sn, ""); err != nil {
+		return err
+	}
+	dst := filepath.Join(e.s.serviceBinDir(sn), fmt.Sprintf("docker-compose.%s.yml", fileutil.Version()))
+	if err := fileutil.CopyFile(o.ConfigFiles[0], dst); err != nil {
+		return fmt.Errorf("failed to copy compose file: %w", err)
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+		if s.ServiceType != "" {
+			return fmt.Errorf("service %q already exists", sn)
+		}
+		s.ServiceType = db.ServiceTypeDockerCompose
+		s.Artifacts = db.ArtifactStore{
+			db.ArtifactDockerComposeFile: {
+				Refs: map[db.ArtifactRef]string{"staged": dst},
+			},
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	e.printf("Adopting compose project %q as service %q\n", o.Project, sn)
+	cfg := e.installerCfg()
+	cfg.ServiceName = sn
+	cfg.Action = AuditActionAdopt
+	cfg.Reason = "orphaned compose project"
+	i, err := e.s.NewInstaller(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create installer: %w", err)
+	}
+	i.NewCmd = e.newCmd
+	if err := i.Install(); err != nil {
+		return err
+	}
+	e.printf("Service %q installed\n", sn)
+	return nil
+}
+
+// destroyComposeOrphan takes the orphaned project down, removing its
+// containers and networks, and its volumes if volumes is set.
+func (e *ttyExecer) destroyComposeOrphan(o ComposeOrphan, volumes bool) error {
+	if ok, err := cmdutil.Confirm(e.rw, e.rw, fmt.Sprintf("Are you sure you want to destroy compose project %q?", o.Project)); err != nil {
+		return fmt.Errorf("failed to confirm destroy: %w", err)
+	} else if !ok {
+		return nil
+	}
+	docker, err := svc.DockerCmd()
+	if err != nil {
+		return err
+	}
+	args := []string{"compose", "--project-name", o.Project, "down", "--remove-orphans"}
+	if volumes {
+		args = append(args, "--volumes")
+	}
+	c := e.newCmd(docker, args...)
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to destroy project %q: %w", o.Project, err)
+	}
+	e.s.recordAudit(AuditEntry{
+		ServiceName: o.ServiceName,
+		Action:      AuditActionRemove,
+		Actor:       e.s.callerName(e.ctx, e.remoteAddr),
+		User:        e.user,
+		Reason:      "orphaned compose project",
+	})
+	e.printf("Destroyed compose project %q\n", o.Project)
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+// The services with a metrics endpoint, set with --metrics, are listed in
+// the format of Prometheus' HTTP service discovery at
+// /api/v0/prometheus-sd, and by `sys prometheus-sd` for file based
+// discovery. Services on --net=ts are scraped on their own tailscale node,
+// others on the host's tailscale address.
+
+// PrometheusTargetGroup is a target group of Prometheus' HTTP and file
+// service discovery.
+type PrometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// parseMetricsTarget parses a --metrics value, "<port>[/path]". An empty
+// value returns nil.
+func parseMetricsTarget(v string) (*db.MetricsTarget, error) {
+	if v == "" {
+		return nil, nil
+	}
+	port, path, hasPath := strings.Cut(v, "/")
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return nil, fmt.Errorf("invalid metrics port %q, expected <port>[/path]", port)
+	}
+	mt := &db.MetricsTarget{Port: n}
+	if hasPath {
+		mt.Path = "/" + path
+	}
+	return mt, nil
+}
+
+// prometheusTargets returns a target group per service with a metrics
+// endpoint.
+func (s *Server) prometheusTargets(ctx context.Context) ([]PrometheusTargetGroup, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	hostAddr, dnsSuffix := hostname, ""
+	if s.cfg.LocalClient != nil {
+		st, err := s.cfg.LocalClient.StatusWithoutPeers(ctx)
+		if err != nil {
+			log.Printf("failed to get tailscale status: %v", err)
+		} else {
+			for _, ip := range st.TailscaleIPs {
+				if ip.Is4() {
+					hostAddr = ip.String()
+					break
+				}
+			}
+			if st.CurrentTailnet != nil {
+				dnsSuffix = st.CurrentTailnet.MagicDNSSuffix
+			}
+		}
+	}
+	groups := []PrometheusTargetGroup{}
+	for sn, sv := range dv.Services().All() {
+		mt := sv.Metrics()
+		if mt == nil {
+			continue
+		}
+		addr := hostAddr
+		if sv.TSNet().Valid() {
+			// The tailscale node of the service is named after it.
+			addr = sn
+			if dnsSuffix != "" {
+				addr += "." + dnsSuffix
+			}
+		}
+		groups = append(groups, PrometheusTargetGroup{
+			Targets: []string{net.JoinHostPort(addr, strconv.Itoa(mt.Port))},
+			Labels: map[string]string{
+				"__metrics_path__":  cmp.Or(mt.Path, "/metrics"),
+				"yeet_service":      sn,
+				"yeet_host":         hostname,
+				"yeet_service_type": string(sv.ServiceType()),
+			},
+		})
+	}
+	slices.SortFunc(groups, func(a, b PrometheusTargetGroup) int {
+		return strings.Compare(a.Labels["yeet_service"], b.Labels["yeet_service"])
+	})
+	return groups, nil
+}
+
+func (s *Server) handlePrometheusSD(w http.ResponseWriter, r *http.Request) {
+	s.serveCached(w, r, "prometheus-sd", func() (any, error) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		return s.prometheusTargets(ctx)
+	})
+}
+
+func (e *ttyExecer) sysPrometheusSDCmdFunc(_ *cobra.Command, _ []string) error {
+	groups, err := e.s.prometheusTargets(e.ctx)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(e.rw)
+	enc.SetIndent("", "  ")
+	return enc.Encode(groups)
+}
@@ -0,0 +1,211 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/fileutil"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// Quadlet support: instead of a compose file, a pushed image can be rendered
+// as podman quadlet .container and .network files. systemd's quadlet
+// generator turns these into a regular <svc>.service unit, so such services
+// are managed as systemd services.
+
+var quadletContainerTemplate = template.Must(template.New("container").Parse(`[Unit]
+Description=yeet service {{.ServiceName}}
+Wants=network-online.target
+After=network-online.target
+
+[Container]
+ContainerName={{.ServiceName}}
+Image={{.Image}}
+Pull=never
+Network={{.ServiceName}}.network
+EnvironmentFile={{.EnvFile}}
+{{- range .Ports}}
+PublishPort={{.}}
+{{- end}}
+{{- range .Volumes}}
+Volume={{.}}
+{{- end}}
+
+[Service]
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+const quadletNetworkTemplate = `[Network]
+NetworkName=yeet-%s
+`
+
+// quadletTemplateData is the data used to render the quadlet container file.
+type quadletTemplateData struct {
+	ServiceName string
+	// Image is the local tag of the pushed image, see pullLocalImage.
+	Image   string
+	EnvFile string
+	Ports   []string
+	Volumes []string
+}
+
+// installQuadletService renders quadlet files for the image pushed to repo
+// for service sn and stages (or installs, if install is set) them.
+func (cr *containerRegistry) installQuadletService(sn, actor, repo string, manifest []byte, install bool) error {
+	if err := cr.s.ensureDirs(sn, ""); err != nil {
+		return err
+	}
+	podman, err := exec.LookPath("podman")
+	if err != nil {
+		return err
+	}
+	image, err := cr.pullLocalImage(podman, "--tls-verify=false", repo, manifest)
+	if err != nil {
+		return err
+	}
+	dataDir := cr.s.stagedDataDir(sn)
+	var buf bytes.Buffer
+	if err := quadletContainerTemplate.Execute(&buf, quadletTemplateData{
+		ServiceName: sn,
+		Image:       image,
+		EnvFile:     filepath.Join(cr.s.serviceRunDir(sn), "env"),
+		Ports:       cr.s.imageExposedPorts(manifest),
+		Volumes:     []string{dataDir + ":/data"},
+	}); err != nil {
+		return fmt.Errorf("failed to render quadlet container: %w", err)
+	}
+	files := map[db.ArtifactName][]byte{
+		db.ArtifactQuadletContainer: buf.Bytes(),
+		db.ArtifactQuadletNetwork:   fmt.Appendf(nil, quadletNetworkTemplate, sn),
+	}
+	paths := map[db.ArtifactName]string{}
+	for name, b := range files {
+		p := fileutil.UpdateVersion(filepath.Join(cr.s.serviceBinDir(sn), string(name)))
+		if err := os.WriteFile(p, b, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		paths[name] = p
+	}
+	if _, _, err := cr.s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+		if s.ServiceType == "" {
+			s.ServiceType = db.ServiceTypeSystemd
+		} else if s.ServiceType != db.ServiceTypeSystemd {
+			return fmt.Errorf("service type mismatch: %v != %v; remove the service first", s.ServiceType, db.ServiceTypeSystemd)
+		}
+		for name, p := range paths {
+			af, ok := s.Artifacts[name]
+			if !ok {
+				af = &db.Artifact{Refs: map[db.ArtifactRef]string{}}
+				mak.Set(&s.Artifacts, name, af)
+			}
+			af.Refs["staged"] = p
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	if !install {
+		return nil
+	}
+	si, err := cr.s.NewInstaller(InstallerCfg{
+		ServiceName:     sn,
+		ClientOut:       io.Discard,
+		Printer:         log.Printf,
+		Actor:           actor,
+		BackgroundWatch: true,
+	})
+	if err != nil {
+		return err
+	}
+	return si.Install()
+}
+
+// pullLocalImage pulls the pushed image with the given manifest from the
+// internal registry with the container cli and tags it as
+// catchit.dev/<repo>:<digest prefix>. The returned tag is what units run:
+// the internal registry listens on a new port every time catch starts, so
+// units must not pull from it themselves, and the tag pins each generation
+// to the image that was pushed for it.
+//
+// insecure is the flag cli needs to pull over plain HTTP, if any.
+func (cr *containerRegistry) pullLocalImage(cli, insecure, repo string, manifest []byte) (string, error) {
+	digest := fmt.Sprintf("%x", sha256.Sum256(manifest))
+	src := fmt.Sprintf("%s/%s@sha256:%s", cr.s.cfg.InternalRegistryAddr, repo, digest)
+	dst := fmt.Sprintf("%s/%s:%s", svc.InternalRegistryHost, repo, digest[:12])
+	args := []string{"pull"}
+	if insecure != "" {
+		args = append(args, insecure)
+	}
+	if out, err := exec.Command(cli, append(args, src)...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to pull %s: %v: %s", src, err, out)
+	}
+	if out, err := exec.Command(cli, "tag", src, dst).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to tag %s: %v: %s", dst, err, out)
+	}
+	return dst, nil
+}
+
+// quadletCmdFunc shows or sets whether pushed images for the service are
+// rendered as quadlet files.
+func (e *ttyExecer) quadletCmdFunc(_ *cobra.Command, args []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("quadlet mode is not supported for %q", e.sn)
+	}
+	if len(args) == 0 {
+		sv, err := e.s.serviceView(e.sn)
+		if err != nil {
+			return err
+		}
+		e.printf("quadlet: %v\n", sv.Quadlet())
+		return nil
+	}
+	var on bool
+	switch args[0] {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return fmt.Errorf("invalid argument %q, expected on or off", args[0])
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		if on && s.ServiceType == db.ServiceTypeDockerCompose {
+			return fmt.Errorf("service %q is a compose service; remove it before switching to quadlet", e.sn)
+		}
+		if on && s.Runtime == db.RuntimeOCI {
+			return fmt.Errorf("service %q uses the oci runtime; switch it back to compose first", e.sn)
+		}
+		s.Quadlet = on
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	e.printf("quadlet: %v; takes effect on the next push\n", on)
+	return nil
+}
@@ -15,6 +15,7 @@
 package catch
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"errors"
 	"fmt"
@@ -24,7 +25,9 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/yeetrun/yeet/pkg/db"
 	"github.com/yeetrun/yeet/pkg/svc"
@@ -45,11 +48,16 @@ func (s *Server) newRegistry() *containerRegistry {
 	cr := &containerRegistry{
 		s:           s,
 		manifestDir: md,
+		limits:      newRegistryLimits(&s.cfg),
+		writes:      &manifestRefWriter{store: s.cfg.DB},
 	}
 	cr.r = registry.New(
 		registry.WithBlobHandler(bh),
 		registry.WithCallbackHandler(cr),
 		registry.WithManifestHandler(cr),
+		registry.WithPusher(func(r *http.Request) string {
+			return s.callerName(r.Context(), r.RemoteAddr)
+		}),
 	)
 	return cr
 }
@@ -58,6 +66,9 @@ type containerRegistry struct {
 	s *Server
 
 	manifestDir string
+	manifests   manifestCache
+	limits      *registryLimits
+	writes      *manifestRefWriter
 	r           http.Handler
 }
 
@@ -77,6 +88,11 @@ func (cr *containerRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		done, ok := cr.limits.check(w, r, cr.s.registryIdentity(r))
+		if !ok {
+			return
+		}
+		defer done()
 	}
 	cr.r.ServeHTTP(w, r)
 }
@@ -135,67 +151,130 @@ func (cr *containerRegistry) Manifests(repo string) (map[string]registry.Manifes
 }
 
 func (cr *containerRegistry) Manifest(repo, reference string) (registry.Manifest, bool) {
+	m, ok := cr.lookupManifest(repo, reference)
+	if !ok {
+		return registry.Manifest{}, false
+	}
+	mb, err := cr.readManifest(m.BlobHash)
+	if err != nil {
+		log.Printf("readManifest: %v", err)
+		return registry.Manifest{}, false
+	}
+	return registry.Manifest{
+		ContentType: m.ContentType,
+		Blob:        mb,
+	}, true
+}
+
+// lookupManifest returns the manifest stored for reference in repo.
+func (cr *containerRegistry) lookupManifest(repo, reference string) (db.ImageManifest, bool) {
 	log.Printf("Manifest: %s %s", repo, reference)
 	dv, err := cr.s.getDB()
 	if err != nil {
 		log.Printf("getDB: %v", err)
-		return registry.Manifest{}, false
+		return db.ImageManifest{}, false
 	}
 	ir, ok := dv.Images().GetOk(db.ImageRepoName(repo))
 	if !ok {
-		return registry.Manifest{}, false
+		return db.ImageManifest{}, false
 	}
-	m, ok := ir.Refs().GetOk(db.ImageRef(reference))
+	return ir.Refs().GetOk(db.ImageRef(reference))
+}
+
+// StatManifest implements registry.ManifestStreamer. Manifests are stored
+// by their sha256, so they don't need to be read to be described.
+func (cr *containerRegistry) StatManifest(repo, reference string) (registry.ManifestDesc, bool) {
+	m, ok := cr.lookupManifest(repo, reference)
 	if !ok {
-		return registry.Manifest{}, false
+		return registry.ManifestDesc{}, false
 	}
-	mb, err := cr.readManifest(m.BlobHash)
+	desc := registry.ManifestDesc{
+		ContentType: m.ContentType,
+		Digest:      "sha256:" + m.BlobHash,
+	}
+	if b, ok := cr.manifests.get(m.BlobHash); ok {
+		desc.Size = int64(len(b))
+		return desc, true
+	}
+	fi, err := os.Stat(cr.manifestPath(m.BlobHash))
+	if err != nil {
+		log.Printf("StatManifest: %v", err)
+		return registry.ManifestDesc{}, false
+	}
+	desc.Size = fi.Size()
+	return desc, true
+}
+
+// OpenManifest implements registry.ManifestStreamer. Cached manifests are
+// served from memory; manifests too large to cache are streamed from disk.
+func (cr *containerRegistry) OpenManifest(repo, reference string) (io.ReadCloser, registry.ManifestDesc, bool) {
+	desc, ok := cr.StatManifest(repo, reference)
+	if !ok {
+		return nil, registry.ManifestDesc{}, false
+	}
+	sha := strings.TrimPrefix(desc.Digest, "sha256:")
+	if desc.Size > manifestCacheMaxEntryBytes {
+		f, err := os.Open(cr.manifestPath(sha))
+		if err != nil {
+			log.Printf("OpenManifest: %v", err)
+			return nil, registry.ManifestDesc{}, false
+		}
+		return f, desc, true
+	}
+	b, err := cr.readManifest(sha)
 	if err != nil {
 		log.Printf("readManifest: %v", err)
-		return registry.Manifest{}, false
+		return nil, registry.ManifestDesc{}, false
 	}
-	return registry.Manifest{
-		ContentType: m.ContentType,
-		Blob:        mb,
-	}, true
+	return io.NopCloser(bytes.NewReader(b)), desc, true
+}
+
+func (cr *containerRegistry) manifestPath(sha256 string) string {
+	return filepath.Join(cr.manifestDir, "sha256", sha256)
 }
 
 func (cr *containerRegistry) storeManifest(b []byte) (string, error) {
 	sha := fmt.Sprintf("%x", sha256.Sum256(b))
-	if err := os.WriteFile(filepath.Join(cr.manifestDir, "sha256", sha), b, 0600); err != nil {
+	if err := os.WriteFile(cr.manifestPath(sha), b, 0600); err != nil {
 		return "", fmt.Errorf("storeManifest: %w", err)
 	}
+	cr.manifests.add(sha, b)
 	return sha, nil
 }
 
+// readManifest returns the contents of manifest sha256, from the cache if
+// possible. The returned slice must not be modified.
 func (cr *containerRegistry) readManifest(sha256 string) ([]byte, error) {
-	b, err := os.ReadFile(filepath.Join(cr.manifestDir, "sha256", sha256))
+	if b, ok := cr.manifests.get(sha256); ok {
+		return b, nil
+	}
+	b, err := os.ReadFile(cr.manifestPath(sha256))
 	if err != nil {
 		return nil, fmt.Errorf("readManifest(%q): %w", sha256, err)
 	}
+	cr.manifests.add(sha256, b)
 	return b, nil
 }
 
 func (cr *containerRegistry) DeleteManifest(repo, ref string) {
 	log.Printf("DeleteManifest: %s %s", repo, ref)
-	dv, err := cr.s.getDB()
-	if err != nil {
-		log.Printf("getDB: %v", err)
-		return
-	}
-	d := dv.AsStruct()
-	ir, ok := d.Images[db.ImageRepoName(repo)]
-	if !ok {
-		return
-	}
-	delete(ir.Refs, db.ImageRef(ref))
-	if err := cr.s.cfg.DB.Set(d); err != nil {
-		log.Printf("Set: %v", err)
+	unlock := cr.writes.lockRepo(db.ImageRepoName(repo))
+	defer unlock()
+	if err := cr.writes.update(manifestRefUpdate{
+		repo: db.ImageRepoName(repo),
+		del:  []db.ImageRef{db.ImageRef(ref)},
+	}); err != nil {
+		log.Printf("DeleteManifest: %v", err)
 	}
 }
 
 func (cr *containerRegistry) SetManifest(repo, tag string, manifest registry.Manifest) {
 	log.Printf("SetManifest: %s %s %v", repo, tag, manifest)
+	if repo == selfCheckRepo {
+		// Scratch image pushed by the self-check, which removes it again.
+		cr.keepManifest(repo, tag, manifest)
+		return
+	}
 	if strings.Count(repo, "/") != 1 {
 		// If the repo is not in the format of 'service/container', it's invalid.
 		return
@@ -214,10 +293,21 @@ func (cr *containerRegistry) SetManifest(repo, tag string, manifest registry.Man
 		}
 		svcName = svc
 	}
+	if isCosignSignatureTag(tag) {
+		// Signatures are only kept to verify the images they sign.
+		cr.keepManifest(repo, tag, manifest)
+		return
+	}
 	var references []string
 	var shouldInstall bool
 	switch tag {
 	case "run":
+		if off := cr.s.autoDeployOff(); off != nil {
+			// Auto-deploys are turned off host-wide, treat it as latest.
+			log.Printf("auto-deploys are off, staging %s without installing it", repo)
+			references = []string{"staged"}
+			break
+		}
 		// "run" == auto-deploy image, so we should install it.
 		references = []string{"run", "staged"}
 		shouldInstall = true
@@ -227,44 +317,86 @@ func (cr *containerRegistry) SetManifest(repo, tag string, manifest registry.Man
 	default:
 		references = []string{tag}
 	}
+	if cr.s.requiresSigned(svcName) {
+		mh := fmt.Sprintf("%x", sha256.Sum256(manifest.Blob))
+		if err := cr.verifyImageSignature(repo, mh); err != nil {
+			log.Printf("not staging %s:%s: %v", repo, tag, err)
+			// Keep it by digest so that it can be signed and pushed again.
+			cr.keepManifest(repo, "sha256:"+mh, manifest)
+			return
+		}
+	}
+	start := time.Now()
+	defer cr.writes.recordPush(repo, start)
+	mh, err := cr.storeManifest(manifest.Blob)
+	if err != nil {
+		log.Printf("storeManifest: %v", err)
+		return
+	}
+	unchanged, err := cr.setRefs(repo, mh, manifest.ContentType, references)
+	if err != nil {
+		log.Printf("SetManifest: %v", err)
+		return
+	}
+	if slices.Contains(references, "staged") {
+		// Pushes can't pass stage flags, so new services get the host's
+		// stage defaults here, before the rest reads their config.
+		if err := cr.s.stageDefaultsFor(svcName); err != nil {
+			log.Printf("failed to stage defaults for %q: %v", svcName, err)
+		}
+	}
 	dv, err := cr.s.getDB()
 	if err != nil {
 		log.Printf("getDB: %v", err)
 		return
 	}
 	d := dv.AsStruct()
-	ir, ok := d.Images[db.ImageRepoName(repo)]
-	if !ok {
-		ir = &db.ImageRepo{
-			Refs: make(map[db.ImageRef]db.ImageManifest, 1),
+	image := fmt.Sprintf("%s/%s", svc.InternalRegistryHost, repo)
+	if !unchanged && slices.Contains(references, "staged") {
+		cr.s.autoReplicate(svcName, shouldInstall)
+	}
+
+	if m, err := cr.platformManifest(manifest.Blob); err == nil && isArtifact(m) {
+		if err := cr.installArtifactService(svcName, manifest.Pusher, m, shouldInstall); err != nil {
+			log.Printf("failed to install artifact for %q: %v", svcName, err)
 		}
-		mak.Set(&d.Images, db.ImageRepoName(repo), ir)
+		return
 	}
-	mh, err := cr.storeManifest(manifest.Blob)
-	if err != nil {
-		log.Printf("storeManifest: %v", err)
+
+	if sv, ok := d.Services[svcName]; ok && sv.Quadlet {
+		if err := cr.installQuadletService(svcName, manifest.Pusher, repo, manifest.Blob, shouldInstall); err != nil {
+			log.Printf("failed to install quadlet service %q: %v", svcName, err)
+		}
 		return
 	}
-	for _, reference := range references {
-		ir.Refs[db.ImageRef(reference)] = db.ImageManifest{
-			ContentType: manifest.ContentType,
-			BlobHash:    mh,
+
+	if sv, ok := d.Services[svcName]; ok && sv.Runtime == db.RuntimeOCI {
+		if err := cr.installOCIService(svcName, manifest.Pusher, repo, manifest.Blob, shouldInstall); err != nil {
+			log.Printf("failed to install oci service %q: %v", svcName, err)
 		}
+		return
 	}
-	if err := cr.s.cfg.DB.Set(d); err != nil {
-		log.Printf("Set: %v", err)
+
+	if _, err := svc.DockerCmd(); errors.Is(err, svc.ErrDockerNotFound) {
+		// Without docker, fall back to running the image directly as a
+		// systemd service.
+		if err := cr.installRootfsService(svcName, manifest.Pusher, manifest.Blob, shouldInstall); err != nil {
+			log.Printf("failed to install %q without docker: %v", svcName, err)
+		}
 		return
 	}
-	image := fmt.Sprintf("%s/%s", svc.InternalRegistryHost, repo)
 
 	// TODO: remove FileInstaller, use the new Installer directly.
 	inst, err := NewFileInstaller(cr.s, FileInstallerCfg{
 		InstallerCfg: InstallerCfg{
-			ServiceName: svcName,
-			ClientOut:   io.Discard,
-			Printer:     log.Printf,
+			ServiceName:     svcName,
+			ClientOut:       io.Discard,
+			Printer:         log.Printf,
+			Actor:           manifest.Pusher,
+			BackgroundWatch: true,
 		},
 		StageOnly: !shouldInstall,
+		FromImage: true,
 	})
 	if err != nil {
 		log.Printf("NewFileInstaller: %v", err)
@@ -290,7 +422,12 @@ func (cr *containerRegistry) SetManifest(repo, tag string, manifest registry.Man
 
 	// If no previous file found or couldn't read it, use template
 	if composeFile == "" {
-		composeFile = fmt.Sprintf(composeTemplate, svcName, image, cr.s.serviceDataDir(svcName))
+		composeFile, err = cr.s.renderComposeFile(d, svcName, image, manifest.Blob)
+		if err != nil {
+			log.Printf("failed to render compose file: %v", err)
+			inst.Fail()
+			return
+		}
 	}
 
 	if _, err := io.Copy(inst, strings.NewReader(composeFile)); err != nil {
@@ -303,56 +440,91 @@ func (cr *containerRegistry) SetManifest(repo, tag string, manifest registry.Man
 	}
 }
 
-func (cr *containerRegistry) SetManifests(repo string, manifests map[string]registry.Manifest) {
-	log.Printf("SetManifests: %s %v", repo, manifests)
-	dv, err := cr.s.getDB()
+// keepManifest stores manifest and points ref of repo at it, without staging
+// or installing it.
+func (cr *containerRegistry) keepManifest(repo, ref string, manifest registry.Manifest) {
+	mh, err := cr.storeManifest(manifest.Blob)
 	if err != nil {
-		log.Printf("getDB: %v", err)
+		log.Printf("storeManifest: %v", err)
 		return
 	}
-	d := dv.AsStruct()
-	ir, ok := d.Images[db.ImageRepoName(repo)]
-	if !ok {
-		ir = &db.ImageRepo{
-			Refs: make(map[db.ImageRef]db.ImageManifest, len(manifests)),
-		}
-		mak.Set(&d.Images, db.ImageRepoName(repo), ir)
+	if _, err := cr.setRefs(repo, mh, manifest.ContentType, []string{ref}); err != nil {
+		log.Printf("SetManifest: %v", err)
+	}
+}
+
+// setRefs points references of repo at the manifest with hash mh. It
+// reports whether the staged ref already pointed at it, e.g. for a manifest
+// replicated back from a host we replicate to, which is then not replicated
+// again.
+func (cr *containerRegistry) setRefs(repo, mh, contentType string, references []string) (unchanged bool, _ error) {
+	rn := db.ImageRepoName(repo)
+	unlock := cr.writes.lockRepo(rn)
+	defer unlock()
+	dv, err := cr.s.getDB()
+	if err != nil {
+		return false, err
+	}
+	if ir, ok := dv.Images().GetOk(rn); ok {
+		staged, ok := ir.Refs().GetOk("staged")
+		unchanged = ok && staged.BlobHash == mh
 	}
+	u := manifestRefUpdate{repo: rn}
+	for _, reference := range references {
+		mak.Set(&u.set, db.ImageRef(reference), db.ImageManifest{
+			ContentType: contentType,
+			BlobHash:    mh,
+		})
+	}
+	return unchanged, cr.writes.update(u)
+}
+
+func (cr *containerRegistry) SetManifests(repo string, manifests map[string]registry.Manifest) {
+	log.Printf("SetManifests: %s %v", repo, manifests)
+	start := time.Now()
+	defer cr.writes.recordPush(repo, start)
+	u := manifestRefUpdate{repo: db.ImageRepoName(repo)}
 	for reference, manifest := range manifests {
 		mh, err := cr.storeManifest(manifest.Blob)
 		if err != nil {
 			log.Printf("storeManifest: %v", err)
 			return
 		}
-		ir.Refs[db.ImageRef(reference)] = db.ImageManifest{
+		mak.Set(&u.set, db.ImageRef(reference), db.ImageManifest{
 			ContentType: manifest.ContentType,
 			BlobHash:    mh,
-		}
+		})
 	}
-	if err := cr.s.cfg.DB.Set(d); err != nil {
-		log.Printf("Set: %v", err)
+	unlock := cr.writes.lockRepo(u.repo)
+	defer unlock()
+	if err := cr.writes.update(u); err != nil {
+		log.Printf("SetManifests: %v", err)
 	}
 }
 
-const composeTemplate = `services:
-  %s:
-    image: %s
-    restart: unless-stopped
-    volumes:
-      - %s:/data
-`
-
 func (cr *containerRegistry) OnImageReceived(repo, tag, digest string) error {
 	log.Printf("OnImageReceived: %s %s %s", repo, tag, digest)
+	if repo == selfCheckRepo {
+		return nil
+	}
 
 	if strings.Count(repo, "/") != 1 {
 		// If the repo is not in the format of 'service/container', it's invalid.
 		return errors.New("containers should follow the 'service/container' format")
 	}
 
+	if isCosignSignatureTag(tag) {
+		return nil
+	}
 	if tag != "latest" && tag != "run" {
 		return fmt.Errorf("invalid tag: %q", tag)
 	}
+	if sn, _, _ := strings.Cut(repo, "/"); cr.s.requiresSigned(sn) {
+		// SetManifest refused to stage it; tell the client why.
+		if err := cr.verifyImageSignature(repo, strings.TrimPrefix(digest, "sha256:")); err != nil {
+			return fmt.Errorf("service %q requires signed images: %w; it is kept as %s@%s to sign with cosign before pushing it again", sn, err, repo, digest)
+		}
+	}
 
 	return nil
 }
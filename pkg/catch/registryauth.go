@@ -0,0 +1,249 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/secrets"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// registryAuthKeyPath returns the path of the key used to encrypt registry
+// passwords at rest in the DB.
+func (s *Server) registryAuthKeyPath() string {
+	return filepath.Join(s.cfg.RootDir, "registry-auth.key")
+}
+
+func (s *Server) encryptRegistryPassword(password string) (string, error) {
+	b, err := secrets.Open(s.registryAuthKeyPath())
+	if err != nil {
+		return "", err
+	}
+	return b.Seal([]byte(password))
+}
+
+func (s *Server) decryptRegistryPassword(enc string) (string, error) {
+	b, err := secrets.Open(s.registryAuthKeyPath())
+	if err != nil {
+		return "", err
+	}
+	pt, err := b.Unseal(enc)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt registry password: %w", err)
+	}
+	return string(pt), nil
+}
+
+// dockerConfigFunc returns the svc.DockerComposeService.DockerConfig func
+// for service sv.
+func (s *Server) dockerConfigFunc(d db.DataView, sv db.ServiceView) func() (string, func(), error) {
+	return func() (string, func(), error) {
+		return s.writeDockerConfig(d, sv)
+	}
+}
+
+// writeDockerConfig writes a docker config.json holding the registry
+// credentials that apply to service sv into a new private directory and
+// returns it, to use as DOCKER_CONFIG, along with a function that removes
+// it. It returns an empty string if there are no credentials.
+func (s *Server) writeDockerConfig(d db.DataView, sv db.ServiceView) (_ string, cleanup func(), _ error) {
+	cleanup = func() {}
+	// Older versions kept the config around in the run dir.
+	os.RemoveAll(filepath.Join(s.serviceRunDir(sv.Name()), "docker"))
+	auths := maps.Collect(d.RegistryAuths().All())
+	for host, a := range sv.RegistryAuths().All() {
+		mak.Set(&auths, host, a)
+	}
+	if len(auths) == 0 {
+		return "", cleanup, nil
+	}
+	type authEntry struct {
+		Auth string `json:"auth"`
+	}
+	cfg := struct {
+		Auths map[string]authEntry `json:"auths"`
+	}{Auths: map[string]authEntry{}}
+	for host, a := range auths {
+		pw, err := s.decryptRegistryPassword(a.Password)
+		if err != nil {
+			return "", cleanup, fmt.Errorf("%s: %w", host, err)
+		}
+		cfg.Auths[host] = authEntry{Auth: base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + pw))}
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "", cleanup, err
+	}
+	if err := os.MkdirAll(s.serviceRunDir(sv.Name()), 0755); err != nil {
+		return "", cleanup, err
+	}
+	// MkdirTemp creates the directory with mode 0700.
+	dir, err := os.MkdirTemp(s.serviceRunDir(sv.Name()), "docker-")
+	if err != nil {
+		return "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), b, 0600); err != nil {
+		cleanup()
+		return "", func() {}, fmt.Errorf("failed to write docker config: %w", err)
+	}
+	return dir, cleanup, nil
+}
+
+// registryCmdFunc handles the `registry` subcommands which manage upstream
+// registry credentials.
+func (e *ttyExecer) registryCmdFunc(cmd *cobra.Command, args []string) error {
+	if e.sn != SystemService {
+		return fmt.Errorf("registry commands are only available on the %s service", SystemService)
+	}
+	svcName, _ := cmd.Flags().GetString("svc")
+	if svcName != "" {
+		if _, err := e.s.serviceView(svcName); err != nil {
+			return err
+		}
+	}
+	switch cmd.CalledAs() {
+	case "login":
+		return e.registryLoginCmdFunc(cmd, svcName, args[0])
+	case "logout":
+		return e.mutateRegistryAuths(svcName, func(m *map[string]db.RegistryAuth) error {
+			if _, ok := (*m)[args[0]]; !ok {
+				return fmt.Errorf("not logged in to %q", args[0])
+			}
+			delete(*m, args[0])
+			return nil
+		})
+	case "list":
+		return e.registryListCmdFunc()
+	case "prune":
+		return e.registryPruneCmdFunc(cmd)
+	default:
+		return fmt.Errorf("unhandled registry command %q", cmd.CalledAs())
+	}
+}
+
+// mutateRegistryAuths calls f with the host-wide registry credentials, or
+// those of service sn if set.
+func (e *ttyExecer) mutateRegistryAuths(sn string, f func(*map[string]db.RegistryAuth) error) error {
+	var err error
+	if sn == "" {
+		_, err = e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			return f(&d.RegistryAuths)
+		})
+	} else {
+		_, _, err = e.s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+			return f(&s.RegistryAuths)
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update registry credentials: %w", err)
+	}
+	return nil
+}
+
+func (e *ttyExecer) registryLoginCmdFunc(cmd *cobra.Command, sn, host string) error {
+	username, _ := cmd.Flags().GetString("username")
+	passwordStdin, _ := cmd.Flags().GetBool("password-stdin")
+	r := bufio.NewReader(e.rw)
+	if username == "" {
+		if passwordStdin {
+			return errors.New("--username is required with --password-stdin")
+		}
+		fmt.Fprint(e.rw, "Username: ")
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		username = strings.TrimSpace(line)
+	}
+	if !passwordStdin {
+		fmt.Fprint(e.rw, "Password: ")
+	}
+	password, err := e.readSecret(r)
+	if !passwordStdin {
+		fmt.Fprintln(e.rw)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	if username == "" || password == "" {
+		return errors.New("username and password must not be empty")
+	}
+	enc, err := e.s.encryptRegistryPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := e.mutateRegistryAuths(sn, func(m *map[string]db.RegistryAuth) error {
+		mak.Set(m, host, db.RegistryAuth{Username: username, Password: enc})
+		return nil
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.rw, "Stored credentials for %s\n", host)
+	return nil
+}
+
+// readSecret reads a line from r, disabling echo if the session is a pty.
+func (e *ttyExecer) readSecret(r *bufio.Reader) (string, error) {
+	if tty, ok := e.rw.(*os.File); ok {
+		defer disableEcho(int(tty.Fd()))()
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (e *ttyExecer) registryListCmdFunc() error {
+	dv, err := e.s.cfg.DB.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get db: %w", err)
+	}
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "REGISTRY\tSCOPE\tUSERNAME\t")
+	for _, host := range slices.Sorted(maps.Keys(dv.RegistryAuths().AsMap())) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", host, "host", dv.RegistryAuths().Get(host).Username)
+	}
+	var services []string
+	for sn, sv := range dv.Services().All() {
+		if sv.RegistryAuths().Len() > 0 {
+			services = append(services, sn)
+		}
+	}
+	slices.Sort(services)
+	for _, sn := range services {
+		auths := dv.Services().Get(sn).RegistryAuths()
+		for _, host := range slices.Sorted(maps.Keys(auths.AsMap())) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", host, sn, auths.Get(host).Username)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/tstime/rate"
+	"tailscale.com/util/mak"
+)
+
+// Default limits for pushes to the registry, used when the corresponding
+// Config field is zero.
+const (
+	defaultRegistryMaxBlobSize     = 10 << 30 // 10 GiB
+	defaultRegistryMaxManifestSize = 4 << 20  // 4 MiB, as in the OCI distribution spec
+	defaultRegistryUploadsPerMin   = 600
+)
+
+// registryUploadIdleTimeout is how long an upload session may go without a
+// request before registryLimits forgets it.
+const registryUploadIdleTimeout = time.Hour
+
+// registryLimits enforces size and rate limits on pushes to the registry.
+type registryLimits struct {
+	maxBlobSize     int64
+	maxManifestSize int64
+	uploadsPerMin   int
+
+	mu        sync.Mutex
+	uploads   map[string]*uploadUsage // by upload session path
+	limiters  map[string]*identityLimiter
+	lastPrune time.Time
+}
+
+// uploadUsage is the number of bytes received by an upload session.
+type uploadUsage struct {
+	received int64
+	lastSeen time.Time
+}
+
+// identityLimiter is the rate limiter of an identity.
+type identityLimiter struct {
+	*rate.Limiter
+	lastSeen time.Time
+}
+
+func newRegistryLimits(cfg *Config) *registryLimits {
+	return &registryLimits{
+		maxBlobSize:     cmp.Or(cfg.RegistryMaxBlobSize, defaultRegistryMaxBlobSize),
+		maxManifestSize: cmp.Or(cfg.RegistryMaxManifestSize, defaultRegistryMaxManifestSize),
+		uploadsPerMin:   cmp.Or(cfg.RegistryUploadsPerMin, defaultRegistryUploadsPerMin),
+	}
+}
+
+// writeRegistryError writes an error in the OCI distribution spec format.
+func writeRegistryError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	type regErr struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	json.NewEncoder(w).Encode(struct {
+		Errors []regErr `json:"errors"`
+	}{[]regErr{{code, msg}}})
+}
+
+// allow reports whether identity id may start another write request.
+func (l *registryLimits) allow(id string) bool {
+	if l.uploadsPerMin < 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.pruneLocked(now)
+	lim, ok := l.limiters[id]
+	if !ok {
+		lim = &identityLimiter{Limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.uploadsPerMin)), l.uploadsPerMin)}
+		mak.Set(&l.limiters, id, lim)
+	}
+	lim.lastSeen = now
+	return lim.Allow()
+}
+
+// pruneLocked forgets, at most once a minute, the limiters of identities that
+// were idle for a minute, which have refilled completely, and the upload
+// sessions that were idle for registryUploadIdleTimeout. l.mu must be held.
+func (l *registryLimits) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for id, lim := range l.limiters {
+		if now.Sub(lim.lastSeen) >= time.Minute {
+			delete(l.limiters, id)
+		}
+	}
+	for p, u := range l.uploads {
+		if now.Sub(u.lastSeen) >= registryUploadIdleTimeout {
+			delete(l.uploads, p)
+		}
+	}
+}
+
+// check applies the limits to the write request r from identity id. It
+// returns false if the request was rejected, in which case an error has
+// already been written to w. Otherwise the returned func must be called once
+// the request has been served.
+func (l *registryLimits) check(w http.ResponseWriter, r *http.Request, id string) (func(), bool) {
+	noop := func() {}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return noop, true
+	}
+	if !l.allow(id) {
+		writeRegistryError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", fmt.Sprintf("too many uploads from %s, limit is %d per minute", id, l.uploadsPerMin))
+		return nil, false
+	}
+	switch {
+	case strings.Contains(r.URL.Path, "/manifests/"):
+		if r.ContentLength > l.maxManifestSize {
+			writeRegistryError(w, http.StatusRequestEntityTooLarge, "MANIFEST_INVALID", fmt.Sprintf("manifest exceeds the limit of %d bytes", l.maxManifestSize))
+			return nil, false
+		}
+		r.Body = &limitedBody{rc: r.Body, remaining: l.maxManifestSize}
+	case strings.Contains(r.URL.Path, "/blobs/uploads/"):
+		switch r.Method {
+		case http.MethodDelete:
+			l.done(r.URL.Path)
+			return noop, true
+		case http.MethodPost:
+			// Starts an upload session, or is a monolithic upload.
+			if r.ContentLength > l.maxBlobSize {
+				writeRegistryError(w, http.StatusRequestEntityTooLarge, "SIZE_INVALID", fmt.Sprintf("blob exceeds the limit of %d bytes", l.maxBlobSize))
+				return nil, false
+			}
+			r.Body = &limitedBody{rc: r.Body, remaining: l.maxBlobSize}
+			return noop, true
+		}
+		l.mu.Lock()
+		u, ok := l.uploads[r.URL.Path]
+		if !ok {
+			u = &uploadUsage{}
+			mak.Set(&l.uploads, r.URL.Path, u)
+		}
+		u.lastSeen = time.Now()
+		received := u.received
+		l.mu.Unlock()
+		remaining := l.maxBlobSize - received
+		if r.ContentLength > remaining {
+			l.done(r.URL.Path)
+			writeRegistryError(w, http.StatusRequestEntityTooLarge, "SIZE_INVALID", fmt.Sprintf("blob exceeds the limit of %d bytes", l.maxBlobSize))
+			return nil, false
+		}
+		r.Body = &limitedBody{rc: r.Body, remaining: remaining, onRead: func(n int64) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			u.received += n
+			u.lastSeen = time.Now()
+		}}
+		if r.Method == http.MethodPut {
+			// PUT completes the upload session.
+			return func() { l.done(r.URL.Path) }, true
+		}
+	}
+	return noop, true
+}
+
+// uploadsInFlight reports whether any blob upload session is open, ignoring
+// sessions idle for registryUploadIdleTimeout.
+func (l *registryLimits) uploadsInFlight() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, u := range l.uploads {
+		if time.Since(u.lastSeen) < registryUploadIdleTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+// done forgets the upload session at path.
+func (l *registryLimits) done(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.uploads, path)
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedBody is an io.ReadCloser that fails once more than remaining bytes
+// are read, for requests without a Content-Length.
+type limitedBody struct {
+	rc        io.ReadCloser
+	remaining int64
+	onRead    func(int64)
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	b.remaining -= int64(n)
+	if b.onRead != nil {
+		b.onRead(int64(n))
+	}
+	if b.remaining < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
+
+// registryIdentity returns the identity rate limits are applied to for a
+// request from remoteAddr: the tailscale caller name if known, otherwise the
+// remote IP.
+func (s *Server) registryIdentity(r *http.Request) string {
+	if n := s.callerName(r.Context(), r.RemoteAddr); n != "" {
+		return n
+	}
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return ap.Addr().String()
+	}
+	return r.RemoteAddr
+}
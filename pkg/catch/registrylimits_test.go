@@ -0,0 +1,70 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistryLimitsPrune(t *testing.T) {
+	l := newRegistryLimits(&Config{})
+	for _, id := range []string{"a", "b"} {
+		if !l.allow(id) {
+			t.Fatalf("allow(%q) = false", id)
+		}
+	}
+	now := time.Now()
+	l.uploads = map[string]*uploadUsage{
+		"/v2/a/blobs/uploads/1": {received: 10, lastSeen: now.Add(-2 * registryUploadIdleTimeout)},
+		"/v2/a/blobs/uploads/2": {received: 10, lastSeen: now},
+	}
+	l.limiters["a"].lastSeen = now.Add(-2 * time.Minute)
+
+	// Pruning runs at most once a minute.
+	l.pruneLocked(now)
+	if len(l.limiters) != 2 || len(l.uploads) != 2 {
+		t.Fatalf("pruned too early: %d limiters, %d uploads", len(l.limiters), len(l.uploads))
+	}
+	l.lastPrune = now.Add(-time.Minute)
+	l.pruneLocked(now)
+	if _, ok := l.limiters["a"]; ok || len(l.limiters) != 1 {
+		t.Errorf("limiters = %v, want only b", l.limiters)
+	}
+	if _, ok := l.uploads["/v2/a/blobs/uploads/2"]; !ok || len(l.uploads) != 1 {
+		t.Errorf("uploads = %v, want only the active one", l.uploads)
+	}
+}
+
+func TestRegistryLimitsUploadsInFlight(t *testing.T) {
+	l := newRegistryLimits(&Config{})
+	if l.uploadsInFlight() {
+		t.Fatal("uploadsInFlight with no uploads")
+	}
+	l.uploads = map[string]*uploadUsage{
+		"/v2/a/blobs/uploads/1": {lastSeen: time.Now().Add(-2 * registryUploadIdleTimeout)},
+	}
+	if l.uploadsInFlight() {
+		t.Error("uploadsInFlight with an abandoned upload")
+	}
+	l.uploads["/v2/a/blobs/uploads/2"] = &uploadUsage{lastSeen: time.Now()}
+	if !l.uploadsInFlight() {
+		t.Error("!uploadsInFlight with an active upload")
+	}
+	l.done("/v2/a/blobs/uploads/2")
+	if l.uploadsInFlight() {
+		t.Error("uploadsInFlight after the upload completed")
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"tailscale.com/util/mak"
+)
+
+// Manifest pushes update the image refs in the DB, which rewrites the whole
+// DB file. To keep parallel pushes from queueing behind each other's writes,
+// ref updates are batched: while one batch is being written, the updates
+// that arrive are collected and written together in the next one. Pushes to
+// the same repo are serialized with a per-repo lock, so that reading the
+// current refs and acting on the update can't interleave, while pushes to
+// different repos proceed in parallel.
+
+// slowManifestWrite is how long a manifest push may take before it is
+// logged as slow.
+const slowManifestWrite = 2 * time.Second
+
+// manifestRefUpdate is a change to the refs of an image repo.
+type manifestRefUpdate struct {
+	repo db.ImageRepoName
+	set  map[db.ImageRef]db.ImageManifest
+	del  []db.ImageRef
+}
+
+func (u manifestRefUpdate) apply(d *db.Data) {
+	ir, ok := d.Images[u.repo]
+	if !ok {
+		if len(u.set) == 0 {
+			return
+		}
+		ir = &db.ImageRepo{}
+		mak.Set(&d.Images, u.repo, ir)
+	}
+	for ref, m := range u.set {
+		mak.Set(&ir.Refs, ref, m)
+	}
+	for _, ref := range u.del {
+		delete(ir.Refs, ref)
+	}
+}
+
+type pendingRefUpdate struct {
+	u    manifestRefUpdate
+	done chan error
+}
+
+// manifestRefWriter batches manifest ref updates into DB writes and keeps
+// per-repo locks.
+type manifestRefWriter struct {
+	store *db.Store
+
+	mu       sync.Mutex
+	pending  []pendingRefUpdate
+	flushing bool
+	repos    map[db.ImageRepoName]*sync.Mutex
+
+	stats registryWriteStats
+}
+
+// lockRepo locks repo for a manifest push and returns the func to unlock
+// it. The time spent waiting for the lock is recorded.
+func (w *manifestRefWriter) lockRepo(repo db.ImageRepoName) (unlock func()) {
+	w.mu.Lock()
+	l, ok := w.repos[repo]
+	if !ok {
+		l = new(sync.Mutex)
+		mak.Set(&w.repos, repo, l)
+	}
+	w.mu.Unlock()
+	start := time.Now()
+	l.Lock()
+	w.stats.lockWait.record(time.Since(start))
+	return l.Unlock
+}
+
+// update applies u to the DB, batched with other concurrent updates, and
+// returns once it is saved.
+func (w *manifestRefWriter) update(u manifestRefUpdate) error {
+	done := make(chan error, 1)
+	w.mu.Lock()
+	w.pending = append(w.pending, pendingRefUpdate{u: u, done: done})
+	if !w.flushing {
+		w.flushing = true
+		go w.flush()
+	}
+	w.mu.Unlock()
+	return <-done
+}
+
+// flush writes the pending updates in batches until there are none left.
+func (w *manifestRefWriter) flush() {
+	for {
+		w.mu.Lock()
+		batch := w.pending
+		w.pending = nil
+		if len(batch) == 0 {
+			w.flushing = false
+			w.mu.Unlock()
+			return
+		}
+		w.mu.Unlock()
+
+		start := time.Now()
+		_, err := w.store.MutateData(func(d *db.Data) error {
+			for _, p := range batch {
+				p.u.apply(d)
+			}
+			return nil
+		})
+		w.stats.dbWrite.record(time.Since(start))
+		w.stats.recordBatch(len(batch))
+		for _, p := range batch {
+			p.done <- err
+		}
+	}
+}
+
+// registryWriteStats are the latency counters of manifest pushes.
+type registryWriteStats struct {
+	push     latencyStats // whole SetManifest calls
+	lockWait latencyStats // waiting for the repo lock
+	dbWrite  latencyStats // writing a batch to the DB
+
+	mu       sync.Mutex
+	batches  int64
+	updates  int64
+	maxBatch int
+}
+
+func (s *registryWriteStats) recordBatch(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	s.updates += int64(n)
+	s.maxBatch = max(s.maxBatch, n)
+}
+
+// latencyStats accumulates durations.
+type latencyStats struct {
+	mu    sync.Mutex
+	count int64
+	total time.Duration
+	max   time.Duration
+	last  time.Duration
+}
+
+func (l *latencyStats) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	l.total += d
+	l.max = max(l.max, d)
+	l.last = d
+}
+
+func (l *latencyStats) data() LatencyData {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ld := LatencyData{
+		Count:  l.count,
+		MaxMs:  l.max.Milliseconds(),
+		LastMs: l.last.Milliseconds(),
+	}
+	if l.count > 0 {
+		ld.AvgMs = (l.total / time.Duration(l.count)).Milliseconds()
+	}
+	return ld
+}
+
+// LatencyData summarizes the durations of an operation.
+type LatencyData struct {
+	Count  int64 `json:"count"`
+	AvgMs  int64 `json:"avgMs"`
+	MaxMs  int64 `json:"maxMs"`
+	LastMs int64 `json:"lastMs"`
+}
+
+// RegistryStats are the latency counters of manifest pushes to the
+// registry, to diagnose contention between parallel pushes.
+type RegistryStats struct {
+	// Push is the latency of whole manifest pushes.
+	Push LatencyData `json:"push"`
+	// LockWait is the time pushes waited for other pushes to the same repo.
+	LockWait LatencyData `json:"lockWait"`
+	// DBWrite is the latency of writing a batch of ref updates to the DB.
+	DBWrite LatencyData `json:"dbWrite"`
+	// Batches and Updates are the number of DB writes and the ref updates
+	// they contained; MaxBatch is the largest batch.
+	Batches  int64 `json:"batches"`
+	Updates  int64 `json:"updates"`
+	MaxBatch int   `json:"maxBatch"`
+}
+
+func (s *registryWriteStats) data() RegistryStats {
+	rs := RegistryStats{
+		Push:     s.push.data(),
+		LockWait: s.lockWait.data(),
+		DBWrite:  s.dbWrite.data(),
+	}
+	s.mu.Lock()
+	rs.Batches, rs.Updates, rs.MaxBatch = s.batches, s.updates, s.maxBatch
+	s.mu.Unlock()
+	return rs
+}
+
+// recordPush records a manifest push of repo that started at start.
+func (w *manifestRefWriter) recordPush(repo string, start time.Time) {
+	d := time.Since(start)
+	w.stats.push.record(d)
+	if d > slowManifestWrite {
+		log.Printf("slow manifest push to %s: %v", repo, d.Round(time.Millisecond))
+	}
+}
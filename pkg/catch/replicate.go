@@ -0,0 +1,158 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/name"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+)
+
+// replicateTarget returns the registry host of the catch host h, qualifying
+// a bare host name with this host's tailnet domain.
+func (s *Server) replicateTarget(h string) string {
+	if strings.Contains(h, ".") {
+		return h
+	}
+	if _, domain, ok := strings.Cut(s.cfg.ExternalRegistryAddr, "."); ok {
+		return h + "." + domain
+	}
+	return h
+}
+
+// replicateService copies the staged images of service sn from the local
+// registry to the registry of each of hosts over the tailnet. With run set
+// they are pushed with the run tag, which deploys them on arrival; otherwise
+// they are only staged.
+func (s *Server) replicateService(ctx context.Context, sn string, hosts []string, run bool, printf func(string, ...any)) error {
+	dv, err := s.getDB()
+	if err != nil {
+		return err
+	}
+	var repos []string
+	for rn, ir := range dv.AsStruct().Images {
+		if _, ok := ir.Refs["staged"]; ok && strings.HasPrefix(string(rn), sn+"/") {
+			repos = append(repos, string(rn))
+		}
+	}
+	if len(repos) == 0 {
+		return fmt.Errorf("service %q has no staged images", sn)
+	}
+	slices.Sort(repos)
+	tag := "latest"
+	if run {
+		tag = "run"
+	}
+	client := s.cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	srcOpts := []remote.Option{remote.WithContext(ctx)}
+	dstOpts := []remote.Option{remote.WithContext(ctx), remote.WithTransport(client.Transport)}
+	for _, h := range hosts {
+		target := s.replicateTarget(h)
+		for _, repo := range repos {
+			src, err := name.ParseReference(fmt.Sprintf("%s/%s:staged", s.cfg.InternalRegistryAddr, repo), name.Insecure)
+			if err != nil {
+				return fmt.Errorf("invalid reference: %w", err)
+			}
+			dst, err := name.ParseReference(fmt.Sprintf("%s/%s:%s", target, repo, tag))
+			if err != nil {
+				return fmt.Errorf("invalid reference: %w", err)
+			}
+			printf("Replicating %s to %s\n", repo, target)
+			desc, err := remote.Get(src, srcOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", repo, err)
+			}
+			if desc.MediaType.IsIndex() {
+				idx, err := desc.ImageIndex()
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", repo, err)
+				}
+				err = remote.WriteIndex(dst, idx, dstOpts...)
+			} else {
+				img, err := desc.Image()
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", repo, err)
+				}
+				err = remote.Write(dst, img, dstOpts...)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to replicate %s to %s: %w", repo, target, err)
+			}
+		}
+	}
+	return nil
+}
+
+// autoReplicate replicates service sn to the hosts of its replication
+// policy, if any. It is called when a new image is staged for sn.
+func (s *Server) autoReplicate(sn string, run bool) {
+	sv, err := s.serviceView(sn)
+	if err != nil || sv.ReplicateTo().Len() == 0 {
+		return
+	}
+	hosts := sv.ReplicateTo().AsSlice()
+	go func() {
+		if err := s.replicateService(s.ctx, sn, hosts, run, log.Printf); err != nil {
+			log.Printf("failed to replicate %q: %v", sn, err)
+		}
+	}()
+}
+
+func (e *ttyExecer) imageCmdFunc(cmd *cobra.Command, _ []string) error {
+	if cmd.CalledAs() != "replicate" {
+		return fmt.Errorf("unhandled image command %q", cmd.CalledAs())
+	}
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot replicate %q", e.sn)
+	}
+	to, _ := cmd.Flags().GetStringSlice("to")
+	run, _ := cmd.Flags().GetBool("run")
+	auto, _ := cmd.Flags().GetBool("auto")
+	if cmd.Flags().Changed("auto") {
+		var policy []string
+		if auto {
+			policy = to
+		}
+		if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+			s.ReplicateTo = policy
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to update service: %w", err)
+		}
+		if auto {
+			e.printf("New images for %q will be replicated to %s\n", e.sn, strings.Join(to, ", "))
+		} else {
+			e.printf("Automatic replication of %q disabled\n", e.sn)
+		}
+	}
+	if len(to) == 0 {
+		if cmd.Flags().Changed("auto") {
+			return nil
+		}
+		return fmt.Errorf("--to is required")
+	}
+	return e.s.replicateService(e.ctx, e.sn, to, run, e.printf)
+}
@@ -0,0 +1,363 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/preflight"
+	"github.com/yeetrun/yeet/pkg/svc"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+	"tailscale.com/util/mak"
+)
+
+// This file implements a minimal container runtime for hosts without docker:
+// the image is unpacked from the internal registry into a root filesystem and
+// run as a systemd service confined to it with RootDirectory= and systemd's
+// namespacing options. Only single-container services are supported.
+
+// installRootfsService unpacks the image described by manifest for service sn
+// and stages (or installs, if install is set) a systemd unit that runs it.
+func (cr *containerRegistry) installRootfsService(sn, actor string, manifest []byte, install bool) error {
+	m, err := cr.platformManifest(manifest)
+	if err != nil {
+		return err
+	}
+	digest, _, err := v1.SHA256(bytes.NewReader(manifest))
+	if err != nil {
+		return err
+	}
+	rootfs := filepath.Join(cr.s.serviceRootDir(sn), "rootfs", digest.Hex[:12])
+	cf, err := cr.unpackImage(m, rootfs)
+	if err != nil {
+		os.RemoveAll(rootfs)
+		return fmt.Errorf("failed to unpack image: %w", err)
+	}
+	if err := cr.s.ensureDirs(sn, ""); err != nil {
+		return err
+	}
+
+	argv := append(append([]string{}, cf.Config.Entrypoint...), cf.Config.Cmd...)
+	if len(argv) == 0 {
+		return fmt.Errorf("image has no entrypoint or cmd")
+	}
+	exe, err := lookPathInRoot(rootfs, argv[0], cf.Config.Env)
+	if err != nil {
+		return err
+	}
+	if cf.Config.User != "" {
+		log.Printf("ignoring image user %q for %q; running as root", cf.Config.User, sn)
+	}
+	dataDir := cr.s.stagedDataDir(sn)
+	su := &svc.SystemdUnit{
+		Name:             sn,
+		Executable:       exe,
+		Arguments:        argv[1:],
+		WorkingDirectory: cmp.Or(cf.Config.WorkingDir, "/"),
+		RootDirectory:    rootfs,
+		BindPaths:        []string{dataDir + ":/data"},
+		Environment:      cf.Config.Env,
+		EnvFile:          "-" + filepath.Join(cr.s.serviceRunDir(sn), "env"),
+	}
+	units, err := su.WriteOutUnitFiles(cr.s.serviceBinDir(sn))
+	if err != nil {
+		return fmt.Errorf("failed to write unit files: %w", err)
+	}
+	if _, _, err := cr.s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+		if s.ServiceType == "" {
+			s.ServiceType = db.ServiceTypeSystemd
+		} else if s.ServiceType != db.ServiceTypeSystemd {
+			return fmt.Errorf("service type mismatch: %v != %v", s.ServiceType, db.ServiceTypeSystemd)
+		}
+		for a, p := range units {
+			af, ok := s.Artifacts[a]
+			if !ok {
+				af = &db.Artifact{Refs: map[db.ArtifactRef]string{}}
+				mak.Set(&s.Artifacts, a, af)
+			}
+			af.Refs["staged"] = p
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	if !install {
+		return nil
+	}
+	si, err := cr.s.NewInstaller(InstallerCfg{
+		ServiceName:     sn,
+		ClientOut:       io.Discard,
+		Printer:         log.Printf,
+		Actor:           actor,
+		BackgroundWatch: true,
+	})
+	if err != nil {
+		return err
+	}
+	return si.Install()
+}
+
+// platformManifest returns the image manifest for the host platform, resolving
+// manifest through an index if necessary.
+func (cr *containerRegistry) platformManifest(manifest []byte) (*v1.Manifest, error) {
+	for range 4 { // bound the nesting of indexes
+		m, err := v1.ParseManifest(bytes.NewReader(manifest))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if !m.MediaType.IsIndex() && len(m.Layers) > 0 {
+			return m, nil
+		}
+		idx, err := v1.ParseIndexManifest(bytes.NewReader(manifest))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse index: %w", err)
+		}
+		var found bool
+		for _, d := range idx.Manifests {
+			if d.Platform == nil || d.Platform.OS != runtime.GOOS || d.Platform.Architecture != runtime.GOARCH {
+				continue
+			}
+			if manifest, err = cr.readManifest(d.Digest.Hex); err != nil {
+				return nil, err
+			}
+			found = true
+			break
+		}
+		if !found {
+			return nil, preflight.NoImageForPlatform("", runtime.GOOS, runtime.GOARCH)
+		}
+	}
+	return nil, fmt.Errorf("index nested too deeply")
+}
+
+func (cr *containerRegistry) blobPath(d v1.Hash) string {
+	return filepath.Join(cr.s.cfg.RegistryRoot, "blobs", d.Algorithm, d.Hex)
+}
+
+// unpackImage extracts the layers of m into dst and returns the image config.
+// If dst already exists it is assumed to be a complete unpack of the same
+// image.
+func (cr *containerRegistry) unpackImage(m *v1.Manifest, dst string) (*v1.ConfigFile, error) {
+	f, err := os.Open(cr.blobPath(m.Config.Digest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image config: %w", err)
+	}
+	defer f.Close()
+	cf, err := v1.ParseConfigFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image config: %w", err)
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return cf, nil
+	}
+	tmp := dst + ".tmp"
+	os.RemoveAll(tmp)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return nil, err
+	}
+	for _, l := range m.Layers {
+		if err := cr.extractLayer(l, tmp); err != nil {
+			os.RemoveAll(tmp)
+			return nil, fmt.Errorf("failed to extract layer %v: %w", l.Digest, err)
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// extractLayer applies the layer described by l on top of dst, honoring OCI
+// whiteouts.
+func (cr *containerRegistry) extractLayer(l v1.Descriptor, dst string) error {
+	f, err := os.Open(cr.blobPath(l.Digest))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch l.MediaType {
+	case types.DockerLayer, types.OCILayer:
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case types.OCILayerZStd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case types.OCIUncompressedLayer, types.DockerUncompressedLayer:
+	default:
+		return fmt.Errorf("unsupported layer media type %q", l.MediaType)
+	}
+	return applyLayer(r, dst)
+}
+
+// applyLayer extracts the layer tarball r on top of dst, honoring OCI
+// whiteouts. All paths are resolved under dst with os.Root, so symlinks
+// planted by earlier entries can't make later ones write or remove files
+// outside of it.
+func applyLayer(r io.Reader, dst string) error {
+	root, err := os.OpenRoot(dst)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+h.Name), "/")
+		if name == "" {
+			// The root directory itself.
+			continue
+		}
+		dir, base := path.Split(name)
+		dir = cmp.Or(strings.TrimSuffix(dir, "/"), ".")
+
+		// Handle whiteouts.
+		if base == ".wh..wh..opq" {
+			d, err := root.Open(dir)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return err
+			}
+			names, err := d.Readdirnames(-1)
+			d.Close()
+			if err != nil {
+				return err
+			}
+			for _, n := range names {
+				if err := root.RemoveAll(path.Join(dir, n)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if hidden, ok := strings.CutPrefix(base, ".wh."); ok {
+			if err := root.RemoveAll(path.Join(dir, hidden)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		mode := os.FileMode(h.Mode).Perm() | os.FileMode(h.Mode)&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if st, err := root.Lstat(name); err == nil && !st.IsDir() {
+				if err := root.Remove(name); err != nil {
+					return err
+				}
+			}
+			if err := root.MkdirAll(name, mode); err != nil {
+				return err
+			}
+			if err := root.Chmod(name, mode); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := root.RemoveAll(name); err != nil {
+				return err
+			}
+			out, err := root.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// The link itself is never followed while extracting, and
+			// once the service runs it resolves inside its root.
+			if err := root.RemoveAll(name); err != nil {
+				return err
+			}
+			if err := root.Symlink(h.Linkname, name); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			src := strings.TrimPrefix(path.Clean("/"+h.Linkname), "/")
+			if err := root.RemoveAll(name); err != nil {
+				return err
+			}
+			if err := root.Link(src, name); err != nil {
+				return err
+			}
+		default:
+			// Device nodes and the like are not needed, systemd provides
+			// /dev with MountAPIVFS.
+			continue
+		}
+		root.Lchown(name, h.Uid, h.Gid)
+	}
+}
+
+// lookPathInRoot resolves name against the PATH in env inside the root
+// filesystem root, returning the path as seen from inside root.
+func lookPathInRoot(root, name string, env []string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	pathEnv := "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, "PATH="); ok {
+			pathEnv = v
+		}
+	}
+	for _, dir := range strings.Split(pathEnv, ":") {
+		p := path.Join(dir, name)
+		// Resolve relative to root; symlinks are resolved by the kernel
+		// once inside the root so just check for existence.
+		if _, err := os.Lstat(filepath.Join(root, filepath.FromSlash(p))); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("executable %q not found in image", name)
+}
@@ -0,0 +1,182 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is an entry of a test tarball.
+type tarEntry struct {
+	name, link, body string
+	typ              byte
+}
+
+func makeTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Linkname: e.link, Typeflag: e.typ, Mode: 0644, Size: int64(len(e.body))}
+		if e.typ == tar.TypeDir {
+			h.Mode = 0755
+		}
+		if e.typ != tar.TypeReg {
+			h.Size = 0
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if e.typ == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestApplyLayer(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "rootfs")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	layer := makeTar(t, []tarEntry{
+		{name: "etc/", typ: tar.TypeDir},
+		{name: "etc/hostname", body: "box", typ: tar.TypeReg},
+		{name: "bin/sh", body: "#!", typ: tar.TypeReg},
+		{name: "bin/bash", link: "sh", typ: tar.TypeSymlink},
+		{name: "bin/hard", link: "/bin/sh", typ: tar.TypeLink},
+		{name: "tmp/gone", body: "x", typ: tar.TypeReg},
+		{name: "tmp/.wh.gone", typ: tar.TypeReg},
+	})
+	if err := applyLayer(layer, root); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "etc/hostname")); err != nil || string(b) != "box" {
+		t.Errorf("etc/hostname = %q, %v", b, err)
+	}
+	if l, err := os.Readlink(filepath.Join(root, "bin/bash")); err != nil || l != "sh" {
+		t.Errorf("bin/bash -> %q, %v", l, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "bin/hard")); err != nil || string(b) != "#!" {
+		t.Errorf("bin/hard = %q, %v", b, err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "tmp/gone")); !os.IsNotExist(err) {
+		t.Errorf("tmp/gone not whited out: %v", err)
+	}
+}
+
+func TestApplyLayerHostile(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{
+			name: "write through absolute symlink",
+			entries: []tarEntry{
+				{name: "evil", link: "OUTSIDE", typ: tar.TypeSymlink},
+				{name: "evil/pwned", body: "x", typ: tar.TypeReg},
+			},
+		},
+		{
+			name: "write through relative symlink",
+			entries: []tarEntry{
+				{name: "a/evil", link: "../../outside", typ: tar.TypeSymlink},
+				{name: "a/evil/pwned", body: "x", typ: tar.TypeReg},
+			},
+		},
+		{
+			name: "dot dot in name",
+			entries: []tarEntry{
+				{name: "../../outside/pwned", body: "x", typ: tar.TypeReg},
+			},
+		},
+		{
+			name: "whiteout through symlink",
+			entries: []tarEntry{
+				{name: "evil", link: "OUTSIDE", typ: tar.TypeSymlink},
+				{name: "evil/.wh.keep", typ: tar.TypeReg},
+			},
+		},
+		{
+			name: "opaque whiteout through symlink",
+			entries: []tarEntry{
+				{name: "evil", link: "OUTSIDE", typ: tar.TypeSymlink},
+				{name: "evil/.wh..wh..opq", typ: tar.TypeReg},
+			},
+		},
+		{
+			name: "hard link through symlink",
+			entries: []tarEntry{
+				{name: "evil", link: "OUTSIDE", typ: tar.TypeSymlink},
+				{name: "stolen", link: "evil/keep", typ: tar.TypeLink},
+			},
+		},
+		{
+			name: "directory chmod through symlink",
+			entries: []tarEntry{
+				{name: "evil", link: "OUTSIDE", typ: tar.TypeSymlink},
+				{name: "evil/", typ: tar.TypeDir},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outside := filepath.Join(dir, "outside")
+			root := filepath.Join(dir, "a", "rootfs")
+			for _, d := range []string{outside, root} {
+				if err := os.MkdirAll(d, 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			keep := filepath.Join(outside, "keep")
+			if err := os.WriteFile(keep, []byte("keep"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			for i, e := range tt.entries {
+				if e.link == "OUTSIDE" {
+					tt.entries[i].link = outside
+				}
+			}
+			applyLayer(makeTar(t, tt.entries), root)
+
+			ents, err := os.ReadDir(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ents) != 1 || ents[0].Name() != "keep" {
+				t.Errorf("outside dir changed: %v", ents)
+			}
+			if st, err := os.Stat(outside); err != nil || st.Mode().Perm() != 0700 {
+				t.Errorf("outside dir mode changed: %v, %v", st.Mode(), err)
+			}
+			if b, err := os.ReadFile(keep); err != nil || string(b) != "keep" {
+				t.Errorf("outside file changed: %q, %v", b, err)
+			}
+			if _, err := os.Stat(filepath.Join(root, "stolen")); err == nil {
+				t.Errorf("hard link to outside file created")
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	gssh "tailscale.com/tempfork/gliderlabs/ssh"
+)
+
+// The legacy SCP protocol, used by `scp -O` and by clients without SFTP, runs
+// `scp -t <path>` on the server and streams the files over the session. catch
+// implements the sink side of it, so files can be uploaded to the same paths
+// as over SFTP:
+//
+//	scp ./binary svc@catch:           install the binary
+//	scp ./binary svc@catch:stage      stage the binary
+//	scp ./.env svc@catch:env          install the env file
+//	scp ./.env svc@catch:stage/env    stage the env file
+//	scp ./seed.sql svc@catch:data/    copy into the data dir
+//
+// Downloads and recursive copies are not supported; use SFTP for those.
+
+// isSCPCommand reports whether args is an scp command run by an scp client.
+func isSCPCommand(args []string) bool {
+	return len(args) > 0 && args[0] == "scp"
+}
+
+// handleSCP runs the sink side of the SCP protocol for the scp command args
+// on session.
+func (s *Server) handleSCP(session gssh.Session, args []string) error {
+	var sink, dirTarget bool
+	var target string
+	for _, a := range args[1:] {
+		switch {
+		case a == "-t":
+			sink = true
+		case a == "-d":
+			dirTarget = true
+		case a == "-f":
+			return scpFatal(session, fmt.Errorf("downloads are not supported over scp, use sftp"))
+		case a == "-r":
+			return scpFatal(session, fmt.Errorf("recursive copies are not supported over scp, use sftp"))
+		case a == "--":
+		case strings.HasPrefix(a, "-"):
+			// Ignore -v, -p and other flags that don't change the protocol.
+		default:
+			target = a
+		}
+	}
+	if !sink {
+		return scpFatal(session, fmt.Errorf("unsupported scp command %q", strings.Join(args, " ")))
+	}
+	fh := &fileHandler{s: s, session: session}
+	target = scpTargetPath(target)
+	if target == "/data" || strings.HasSuffix(target, "/") {
+		dirTarget = true
+	} else if strings.HasPrefix(target, "/data/") {
+		// Like cp, copy into existing directories.
+		if root, name, err := fh.resolvePath(target); err == nil {
+			if st, err := root.Stat(name); err == nil && st.IsDir() {
+				dirTarget = true
+			}
+			root.Close()
+		}
+	}
+	br := bufio.NewReader(session)
+	// Tell the client we are ready for the first file.
+	if err := scpAck(session); err != nil {
+		return err
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return scpFatal(session, fmt.Errorf("empty scp message"))
+		}
+		switch line[0] {
+		case 'T':
+			// Times of the next file, sent with -p. They are not kept.
+			if err := scpAck(session); err != nil {
+				return err
+			}
+			continue
+		case 'D', 'E':
+			return scpFatal(session, fmt.Errorf("recursive copies are not supported over scp, use sftp"))
+		case 'C':
+		case '\x01', '\x02':
+			return fmt.Errorf("scp client error: %s", line[1:])
+		default:
+			return scpFatal(session, fmt.Errorf("unexpected scp message %q", line))
+		}
+		mode, size, name, err := parseSCPFile(line)
+		if err != nil {
+			return scpFatal(session, err)
+		}
+		p := target
+		if dirTarget {
+			p = path.Join(target, name)
+		}
+		if err := receiveSCPFile(session, br, fh, p, mode, size); err != nil {
+			return scpFatal(session, err)
+		}
+	}
+}
+
+// receiveSCPFile reads size bytes of a file from br and writes it to path p
+// as an SFTP upload would.
+func receiveSCPFile(session gssh.Session, br *bufio.Reader, fh *fileHandler, p string, mode os.FileMode, size int64) error {
+	log.Printf("SCP: receiving %d bytes to %s", size, p)
+	wa, err := fh.openWriter(p)
+	if err != nil {
+		return err
+	}
+	if err := scpAck(session); err != nil {
+		return err
+	}
+	_, err = io.CopyN(io.NewOffsetWriter(wa, 0), br, size)
+	if err == nil {
+		// The client ends the file with a status byte.
+		var b byte
+		if b, err = br.ReadByte(); err == nil && b != 0 {
+			err = fmt.Errorf("client failed to send %s", p)
+		}
+	}
+	if err != nil {
+		if fi, ok := wa.(*FileInstaller); ok {
+			fi.Fail()
+		}
+	} else if f, ok := wa.(*os.File); ok {
+		err = f.Chmod(mode)
+	}
+	if c, ok := wa.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return scpAck(session)
+}
+
+// scpTargetPath maps the target path of an scp command to the path it would
+// have over SFTP. Paths are relative to the root, so the empty path and "."
+// install the service.
+func scpTargetPath(target string) string {
+	p := path.Clean("/" + target)
+	if strings.HasPrefix(p, "/data/") && strings.HasSuffix(target, "/") {
+		// Keep the trailing slash of directories inside the data dir so
+		// that the file name is appended.
+		return p + "/"
+	}
+	return p
+}
+
+// parseSCPFile parses a "C<mode> <size> <name>" line of the SCP protocol.
+func parseSCPFile(line string) (os.FileMode, int64, string, error) {
+	fields := strings.SplitN(line[1:], " ", 3)
+	if len(fields) != 3 {
+		return 0, 0, "", fmt.Errorf("invalid scp file message %q", line)
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid scp file mode %q", fields[0])
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", fmt.Errorf("invalid scp file size %q", fields[1])
+	}
+	name := fields[2]
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return 0, 0, "", fmt.Errorf("invalid scp file name %q", name)
+	}
+	return os.FileMode(mode).Perm(), size, name, nil
+}
+
+// scpAck tells the client that the last message was handled.
+func scpAck(w io.Writer) error {
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+// scpFatal sends err to the client as a fatal error and returns it.
+func scpFatal(w io.Writer, err error) error {
+	fmt.Fprintf(w, "\x02%s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+	return err
+}
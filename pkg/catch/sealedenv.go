@@ -0,0 +1,123 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/fileutil"
+	"github.com/yeetrun/yeet/pkg/secrets"
+)
+
+// Env values can be sealed client-side with `yeet env seal`, which encrypts
+// them to the public key of the host. The env file artifact keeps the sealed
+// values; they are only decrypted when the env file is installed for the
+// service to read, so env files can be kept in version control.
+
+func (s *Server) envKeyPair() (*secrets.KeyPair, error) {
+	return secrets.OpenKeyPair(filepath.Join(s.cfg.RootDir, "env-seal.key"))
+}
+
+// installEnvFile writes the env file at src to dst with its sealed values
+// decrypted. It is used as the CopyEnvFile of services.
+func (s *Server) installEnvFile(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Contains(b, []byte(secrets.SealedPrefix)) {
+		return fileutil.CopyFile(src, dst)
+	}
+	if b, err = s.unsealEnv(b); err != nil {
+		return err
+	}
+	// The decrypted file holds secrets, so keep it private.
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// unsealEnv returns the env file b with each sealed value replaced by its
+// plaintext.
+func (s *Server) unsealEnv(b []byte) ([]byte, error) {
+	unseal := s.envUnsealer()
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(strings.TrimSpace(k), "#") {
+			continue
+		}
+		v = unquoteEnvValue(strings.TrimSpace(v))
+		if !strings.HasPrefix(v, secrets.SealedPrefix) {
+			continue
+		}
+		pt, err := unseal(strings.TrimSpace(k), v)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = k + "=" + quoteEnvValue(pt)
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// envUnsealer returns a func that decrypts the sealed value v of env
+// variable k. The key pair is only loaded once it is needed.
+func (s *Server) envUnsealer() func(k, v string) (string, error) {
+	var kp *secrets.KeyPair
+	return func(k, v string) (string, error) {
+		if kp == nil {
+			var err error
+			if kp, err = s.envKeyPair(); err != nil {
+				return "", err
+			}
+		}
+		pt, err := kp.Open(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to unseal %s: %w", k, err)
+		}
+		return string(pt), nil
+	}
+}
+
+// unquoteEnvValue strips matching single or double quotes around v.
+func unquoteEnvValue(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// quoteEnvValue quotes v if it can't be written as is in an env file read by
+// both systemd and docker compose. Single quotes keep the value literal for
+// both, in particular compose doesn't expand ${...} in them. Values that
+// can't be single-quoted are double-quoted with $ escaped, which both
+// unescape.
+func quoteEnvValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n\"'\\#$") {
+		return v
+	}
+	if !strings.ContainsAny(v, "'\n") {
+		return "'" + v + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, `$`, `\$`).Replace(v) + `"`
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/secrets"
+)
+
+func TestQuoteEnvValue(t *testing.T) {
+	tests := []struct {
+		v    string
+		want string
+	}{
+		{v: "plain", want: "plain"},
+		{v: "", want: "''"},
+		{v: "two words", want: "'two words'"},
+		{v: "pa$$word", want: "'pa$$word'"},
+		{v: "${HOME}/x", want: "'${HOME}/x'"},
+		{v: `back\slash`, want: `'back\slash'`},
+		{v: `say "hi"`, want: `'say "hi"'`},
+		{v: "it's $HOME", want: `"it's \$HOME"`},
+		{v: "line\nbreak", want: `"line\nbreak"`},
+		{v: `it's "a" \ ${X}`, want: `"it's \"a\" \\ \${X}"`},
+	}
+	for _, tt := range tests {
+		if got := quoteEnvValue(tt.v); got != tt.want {
+			t.Errorf("quoteEnvValue(%q) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestUnsealEnv(t *testing.T) {
+	s := &Server{cfg: Config{RootDir: t.TempDir()}}
+	kp, err := s.envKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seal := func(v string) string {
+		sealed, err := secrets.SealTo(kp.PublicKey(), []byte(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sealed
+	}
+	env := strings.Join([]string{
+		"# comment",
+		"PLAIN=value",
+		"TOKEN=" + seal("abc123"),
+		`QUOTED="` + seal("${NOT_EXPANDED}") + `"`,
+		"PASSWORD=" + seal("pa$$ word"),
+	}, "\n")
+	got, err := s.unsealEnv([]byte(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"# comment",
+		"PLAIN=value",
+		"TOKEN=abc123",
+		"QUOTED='${NOT_EXPANDED}'",
+		"PASSWORD='pa$$ word'",
+	}, "\n")
+	if string(got) != want {
+		t.Errorf("unsealEnv =\n%s\nwant\n%s", got, want)
+	}
+
+	other := &Server{cfg: Config{RootDir: t.TempDir()}}
+	if _, err := other.unsealEnv([]byte(env)); err == nil || !strings.Contains(err.Error(), "TOKEN") {
+		t.Errorf("unsealEnv with another key = %v, want error naming TOKEN", err)
+	}
+}
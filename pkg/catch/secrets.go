@@ -0,0 +1,271 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/secrets"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// Secrets are stored encrypted in the DB and only decrypted when a service
+// starts:
+//
+//   - systemd services get them as credentials: each secret is written to a
+//     file under secretsRunRoot, which lives on tmpfs, and a runtime drop-in
+//     loads it with LoadCredential=, so the service reads it from
+//     $CREDENTIALS_DIRECTORY/<name>.
+//   - docker compose services get them in the environment of the compose
+//     commands, so the compose file can pass them on with
+//     `environment: [NAME]`.
+
+// secretsRunRoot is where decrypted secrets of systemd services are kept.
+// It must be on tmpfs.
+const secretsRunRoot = "/run/yeet/secrets"
+
+var validSecretName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (s *Server) secretsBox() (*secrets.Box, error) {
+	return secrets.Open(filepath.Join(s.cfg.RootDir, "secrets.key"))
+}
+
+// serviceSecrets returns the decrypted secrets of sv.
+func (s *Server) serviceSecrets(sv db.ServiceView) (map[string]string, error) {
+	if sv.Secrets().Len() == 0 {
+		return nil, nil
+	}
+	b, err := s.secretsBox()
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]string
+	for name, enc := range sv.Secrets().All() {
+		v, err := b.Unseal(enc)
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", name, err)
+		}
+		mak.Set(&out, name, string(v))
+	}
+	return out, nil
+}
+
+// secretEnv returns the secrets of sv as NAME=value pairs.
+func (s *Server) secretEnv(sv db.ServiceView) ([]string, error) {
+	m, err := s.serviceSecrets(sv)
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	for name, v := range m {
+		env = append(env, name+"="+v)
+	}
+	slices.Sort(env)
+	return env, nil
+}
+
+func secretsDropInPath(sn string) string {
+	return filepath.Join("/run/systemd/system", sn+".service.d", "yeet-secrets.conf")
+}
+
+// materializeSecrets writes the secrets of systemd service sn to tmpfs and
+// the drop-in loading them as credentials, or removes both if the service
+// has no secrets. It reports whether the drop-in was newly created, e.g.
+// because the host rebooted.
+func (s *Server) materializeSecrets(sn string) (created bool, _ error) {
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		return false, err
+	}
+	if sv.ServiceType() != db.ServiceTypeSystemd {
+		return false, nil
+	}
+	m, err := s.serviceSecrets(sv)
+	if err != nil {
+		return false, err
+	}
+	dir := filepath.Join(secretsRunRoot, sn)
+	dropIn := secretsDropInPath(sn)
+	_, statErr := os.Stat(dropIn)
+	existed := statErr == nil
+	if len(m) == 0 {
+		os.RemoveAll(dir)
+		if !existed {
+			return false, nil
+		}
+		if err := os.RemoveAll(filepath.Dir(dropIn)); err != nil {
+			return false, err
+		}
+		return false, exec.Command("systemctl", "daemon-reload").Run()
+	}
+
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false, err
+	}
+	var conf strings.Builder
+	conf.WriteString("# Generated by catch, do not edit.\n[Service]\n")
+	for _, name := range slices.Sorted(maps.Keys(m)) {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(m[name]), 0400); err != nil {
+			return false, fmt.Errorf("failed to write secret %q: %w", name, err)
+		}
+		fmt.Fprintf(&conf, "LoadCredential=%s:%s\n", name, p)
+	}
+	if err := os.MkdirAll(filepath.Dir(dropIn), 0755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(dropIn, []byte(conf.String()), 0644); err != nil {
+		return false, fmt.Errorf("failed to write secrets drop-in: %w", err)
+	}
+	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+		return false, fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	return !existed, nil
+}
+
+// removeSecrets removes the decrypted secrets of service sn and their
+// drop-in, if any.
+func removeSecrets(sn string) {
+	os.RemoveAll(filepath.Join(secretsRunRoot, sn))
+	if err := os.RemoveAll(filepath.Dir(secretsDropInPath(sn))); err != nil {
+		log.Printf("failed to remove secrets drop-in of %q: %v", sn, err)
+	}
+}
+
+// restoreSecrets materializes the secrets of all systemd services when catch
+// starts. Services that were started without them, as happens after a
+// reboot since the secrets only live on tmpfs, are restarted.
+func (s *Server) restoreSecrets() {
+	dv, err := s.getDB()
+	if err != nil {
+		log.Printf("restoreSecrets: %v", err)
+		return
+	}
+	for sn, sv := range dv.Services().All() {
+		if sv.Secrets().Len() == 0 || sv.ServiceType() != db.ServiceTypeSystemd {
+			continue
+		}
+		created, err := s.materializeSecrets(sn)
+		if err != nil {
+			log.Printf("failed to restore secrets of %q: %v", sn, err)
+			continue
+		}
+		if !created {
+			continue
+		}
+		if st, err := s.SystemdStatus(sn); err == nil && st == svc.StatusRunning {
+			log.Printf("restarting %q to provide its secrets", sn)
+			if err := exec.Command("systemctl", "restart", sn+".service").Run(); err != nil {
+				log.Printf("failed to restart %q: %v", sn, err)
+			}
+		}
+	}
+}
+
+func (e *ttyExecer) secretCmdFunc(cmd *cobra.Command, args []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("secrets are not supported for %q", e.sn)
+	}
+	if cmd.CalledAs() == "list" {
+		sv, err := e.s.serviceView(e.sn)
+		if err != nil {
+			return err
+		}
+		for _, name := range slices.Sorted(maps.Keys(sv.Secrets().AsMap())) {
+			e.printf("%s\n", name)
+		}
+		return nil
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected a secret name")
+	}
+	name := args[0]
+	if !validSecretName.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q: use letters, digits and underscores", name)
+	}
+	switch cmd.CalledAs() {
+	case "get":
+		sv, err := e.s.serviceView(e.sn)
+		if err != nil {
+			return err
+		}
+		m, err := e.s.serviceSecrets(sv)
+		if err != nil {
+			return err
+		}
+		v, ok := m[name]
+		if !ok {
+			return fmt.Errorf("secret %q not found", name)
+		}
+		e.printf("%s\n", v)
+		return nil
+	case "set":
+		if e.isPty {
+			fmt.Fprintf(e.rw, "Value for %s: ", name)
+		}
+		v, err := e.readSecret(bufio.NewReader(e.rw))
+		if e.isPty {
+			fmt.Fprintln(e.rw)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read secret: %w", err)
+		}
+		b, err := e.s.secretsBox()
+		if err != nil {
+			return err
+		}
+		enc, err := b.Seal([]byte(v))
+		if err != nil {
+			return err
+		}
+		if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+			mak.Set(&s.Secrets, name, enc)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to store secret: %w", err)
+		}
+	case "rm":
+		if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+			if _, ok := s.Secrets[name]; !ok {
+				return fmt.Errorf("secret %q not found", name)
+			}
+			delete(s.Secrets, name)
+			return nil
+		}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unhandled secret command %q", cmd.CalledAs())
+	}
+	if _, err := e.s.materializeSecrets(e.sn); err != nil && !errors.Is(err, errServiceNotFound) {
+		return fmt.Errorf("failed to apply secrets: %w", err)
+	}
+	e.printf("Secret %q %s; restart the service to apply\n", name, map[string]string{"set": "stored", "rm": "removed"}[cmd.CalledAs()])
+	return nil
+}
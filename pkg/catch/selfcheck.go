@@ -0,0 +1,297 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/name"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/random"
+	"github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+)
+
+// selfCheckTimeout bounds how long SelfCheck runs.
+const selfCheckTimeout = time.Minute
+
+// SelfCheckResult is the outcome of one check run by SelfCheck.
+type SelfCheckResult struct {
+	Name string
+	// Err is why the check failed, if it did.
+	Err error
+	// Skipped, if set, is why the check did not run.
+	Skipped string
+}
+
+// SelfCheck checks that the host is able to run services.
+func (s *Server) SelfCheck(ctx context.Context) []SelfCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+
+	var results []SelfCheckResult
+	add := func(name string, err error) {
+		results = append(results, SelfCheckResult{Name: name, Err: err})
+	}
+	skip := func(name, why string) {
+		results = append(results, SelfCheckResult{Name: name, Skipped: why})
+	}
+
+	add("catch service", runCheck(ctx, "systemctl", "is-active", "--quiet", CatchService+".service"))
+	if s.cfg.LocalClient == nil || s.cfg.TailnetDial == nil {
+		skip("ssh over tailnet", "run `yeet sys selfcheck` from a machine on the tailnet")
+	} else {
+		add("ssh over tailnet", s.checkTailnetSSH(ctx))
+	}
+	add("systemd", runCheck(ctx, "systemctl", "show", "--property=Version"))
+	if docker, err := svc.DockerCmd(); err != nil {
+		skip("docker compose", "docker is not installed")
+	} else {
+		add("docker compose", runCheck(ctx, docker, "compose", "version"))
+	}
+	add("network namespaces", checkNetNS(ctx))
+	add("registry", s.checkRegistry(ctx))
+	return results
+}
+
+// runCheck runs a command, returning its output in the error if it fails.
+func runCheck(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// checkTailnetSSH dials the SSH listener on the host's own tailnet address
+// and checks that it answers with an SSH banner.
+func (s *Server) checkTailnetSSH(ctx context.Context) error {
+	st, err := s.cfg.LocalClient.StatusWithoutPeers(ctx)
+	if err != nil {
+		return err
+	}
+	if st.Self == nil || len(st.Self.TailscaleIPs) == 0 {
+		return fmt.Errorf("no tailnet address")
+	}
+	addr := net.JoinHostPort(st.Self.TailscaleIPs[0].String(), "22")
+	c, err := s.cfg.TailnetDial(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		c.SetReadDeadline(dl)
+	}
+	banner, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("%s: %w", addr, err)
+	}
+	if !strings.HasPrefix(banner, "SSH-2.0-") {
+		return fmt.Errorf("%s: not an SSH server: %q", addr, strings.TrimSpace(banner))
+	}
+	return nil
+}
+
+// checkNetNS creates and deletes a network namespace.
+func checkNetNS(ctx context.Context) error {
+	ns := "yeet-selfcheck-" + rand.Text()[:8]
+	if err := runCheck(ctx, "ip", "netns", "add", ns); err != nil {
+		return err
+	}
+	return runCheck(ctx, "ip", "netns", "del", ns)
+}
+
+// selfCheckRepo is the scratch registry repository the registry check
+// pushes to. It is not in the service/container form, so SetManifest only
+// keeps what is pushed to it and never stages or installs it.
+const selfCheckRepo = "yeet-selfcheck"
+
+// checkRegistry pushes a small random image to a scratch repository, pulls
+// it back over the internal address the way docker does, compares digests
+// and deletes it again. Pushes are served in-process by the registry
+// handler, as the internal listener is read-only and the registry should
+// not be writable without auth on any listener.
+func (s *Server) checkRegistry(ctx context.Context) error {
+	pullAddr := s.cfg.InternalRegistryAddr
+	if _, port, _ := net.SplitHostPort(pullAddr); port == "" || port == "0" {
+		// Not serving, e.g. when run from the command line; serve the
+		// internal registry temporarily.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+		go http.Serve(ln, s.registry)
+		pullAddr = ln.Addr().String()
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		return err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	defer s.registry.dropSelfCheck(img)
+	push, err := name.NewTag(selfCheckPushHost+"/"+selfCheckRepo+":probe", name.Insecure)
+	if err != nil {
+		return err
+	}
+	if err := remote.Write(push, img, remote.WithContext(ctx), remote.WithTransport(handlerTransport{s.registry.r})); err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+
+	pull, err := name.NewDigest(fmt.Sprintf("%s/%s@%s", pullAddr, selfCheckRepo, digest), name.Insecure)
+	if err != nil {
+		return err
+	}
+	got, err := remote.Image(pull, remote.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("pull failed: %w", err)
+	}
+	gotDigest, err := got.Digest()
+	if err != nil {
+		return fmt.Errorf("pull failed: %w", err)
+	}
+	if gotDigest != digest {
+		return fmt.Errorf("pulled manifest %s, want %s", gotDigest, digest)
+	}
+	layers, err := got.Layers()
+	if err != nil {
+		return fmt.Errorf("pull failed: %w", err)
+	}
+	for _, l := range layers {
+		want, err := l.Digest()
+		if err != nil {
+			return fmt.Errorf("pull failed: %w", err)
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			return fmt.Errorf("pull failed: %w", err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("pull failed: %w", err)
+		}
+		if sum := fmt.Sprintf("sha256:%x", h.Sum(nil)); sum != want.String() {
+			return fmt.Errorf("pulled blob %s, want %s", sum, want)
+		}
+	}
+	return nil
+}
+
+// selfCheckPushHost is the registry host of the self-check's push
+// reference. The push never reaches the network, see handlerTransport.
+const selfCheckPushHost = "catch.invalid"
+
+// handlerTransport is an http.RoundTripper that serves requests with h
+// in-process.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	sr := r.Clone(r.Context())
+	if sr.Body == nil {
+		sr.Body = http.NoBody
+	}
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, sr)
+	res := rec.Result()
+	res.Request = r
+	return res, nil
+}
+
+// dropSelfCheck removes the scratch repository and the manifest and blobs
+// of img pushed to it by checkRegistry.
+func (cr *containerRegistry) dropSelfCheck(img v1.Image) {
+	unlock := cr.writes.lockRepo(selfCheckRepo)
+	defer unlock()
+	if _, err := cr.s.cfg.DB.MutateData(func(d *db.Data) error {
+		delete(d.Images, selfCheckRepo)
+		return nil
+	}); err != nil {
+		log.Printf("selfcheck: %v", err)
+	}
+	var hashes []v1.Hash
+	if h, err := img.ConfigName(); err == nil {
+		hashes = append(hashes, h)
+	}
+	if layers, err := img.Layers(); err == nil {
+		for _, l := range layers {
+			if h, err := l.Digest(); err == nil {
+				hashes = append(hashes, h)
+			}
+		}
+	}
+	blobs := filepath.Join(cr.s.cfg.RegistryRoot, "blobs")
+	for _, h := range hashes {
+		if err := os.Remove(filepath.Join(blobs, h.Algorithm, h.Hex)); err != nil && !os.IsNotExist(err) {
+			log.Printf("selfcheck: %v", err)
+		}
+	}
+	if h, err := img.Digest(); err == nil {
+		if err := os.Remove(cr.manifestPath(h.Hex)); err != nil && !os.IsNotExist(err) {
+			log.Printf("selfcheck: %v", err)
+		}
+	}
+}
+
+// WriteSelfCheckReport writes a pass/fail line per result to w. It returns
+// an error if any check failed.
+func WriteSelfCheckReport(w io.Writer, results []SelfCheckResult) error {
+	var failed []string
+	for _, r := range results {
+		switch {
+		case r.Skipped != "":
+			fmt.Fprintf(w, "SKIP  %s: %s\n", r.Name, r.Skipped)
+		case r.Err != nil:
+			fmt.Fprintf(w, "FAIL  %s: %v\n", r.Name, r.Err)
+			failed = append(failed, r.Name)
+		default:
+			fmt.Fprintf(w, "PASS  %s\n", r.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("self-check failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (e *ttyExecer) sysSelfCheckCmdFunc(_ *cobra.Command, _ []string) error {
+	return WriteSelfCheckReport(e.rw, e.s.SelfCheck(e.ctx))
+}
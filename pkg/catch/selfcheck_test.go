@@ -0,0 +1,54 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+func TestCheckRegistry(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{cfg: Config{
+		DB:           db.NewStore(filepath.Join(dir, "db.json"), filepath.Join(dir, "services")),
+		RegistryRoot: filepath.Join(dir, "registry"),
+	}}
+	s.registry = s.newRegistry()
+	if err := s.checkRegistry(context.Background()); err != nil {
+		t.Fatalf("checkRegistry: %v", err)
+	}
+
+	// The scratch image is removed again.
+	dv, err := s.getDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dv.Images().GetOk(selfCheckRepo); ok {
+		t.Errorf("repo %q left behind", selfCheckRepo)
+	}
+	for _, sub := range []string{"blobs/sha256", "manifests/sha256"} {
+		ents, err := os.ReadDir(filepath.Join(s.cfg.RegistryRoot, sub))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		for _, e := range ents {
+			t.Errorf("%s/%s left behind", sub, e.Name())
+		}
+	}
+}
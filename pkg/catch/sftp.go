@@ -21,6 +21,7 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -56,46 +57,86 @@ func (f *fileHandler) Fileread(req *sftp.Request) (io.ReaderAt, error) {
 	if req.Method != "Get" {
 		return nil, fmt.Errorf("unsupported method: %q", req.Method)
 	}
-	path, err := f.resolvePath(req.Filepath)
+	root, name, err := f.resolvePath(req.Filepath)
 	if err != nil {
 		return nil, err
 	}
-	return os.Open(path)
+	defer root.Close()
+	rf, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return rf, nil
 }
 
-// resolvePath validates the given path and returns the absolute path
-// on the host filesystem.
-func (f *fileHandler) resolvePath(fullPath string) (string, error) {
+// resolvePath validates the given path and returns the directory it is in on
+// the host filesystem, opened as an os.Root, and its name in there. Paths
+// under /data are resolved in the data dir of the service, so that symlinks
+// in it can't lead catch out of it. The caller must close the root.
+func (f *fileHandler) resolvePath(fullPath string) (*os.Root, string, error) {
 	sn, _, err := f.s.serviceAndUser(f.session)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 	if fullPath == "/env" || fullPath == "/stage/env" {
 		sv, err := f.s.serviceView(sn)
 		if err != nil {
-			return "", err
+			return nil, "", err
 		}
 		ef, err := f.s.envFile(sv, fullPath == "/stage/env")
 		if err != nil {
-			return "", err
+			return nil, "", err
+		}
+		if ef == "" {
+			return nil, "", fs.ErrNotExist
+		}
+		root, err := os.OpenRoot(filepath.Dir(ef))
+		if err != nil {
+			return nil, "", err
 		}
-		return ef, nil
+		return root, filepath.Base(ef), nil
+	}
+	name, err := dataName(fullPath)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := f.dataRoot()
+	if err != nil {
+		return nil, "", err
+	}
+	return root, name, nil
+}
+
+// dataRoot opens the data dir of the service as an os.Root.
+func (f *fileHandler) dataRoot() (*os.Root, error) {
+	sn, _, err := f.s.serviceAndUser(f.session)
+	if err != nil {
+		return nil, err
 	}
-	path, ok := strings.CutPrefix(fullPath, "/data")
+	return os.OpenRoot(f.s.serviceDataDir(sn))
+}
+
+// dataName returns the name of fullPath, which must be /data or a path under
+// it, relative to the data dir.
+func dataName(fullPath string) (string, error) {
+	p, ok := strings.CutPrefix(fullPath, "/data")
 	if !ok {
-		return "", fmt.Errorf("invalid path: %q", path)
+		return "", fmt.Errorf("invalid path: %q", fullPath)
 	}
-	if !strings.HasPrefix(path, "/") && path != "" {
-		return "", fmt.Errorf("invalid path: %q", path)
+	if !strings.HasPrefix(p, "/") && p != "" {
+		return "", fmt.Errorf("invalid path: %q", fullPath)
 	}
-	if path == "/.env" {
+	// Cleaning the path as rooted keeps it inside the data dir.
+	p = path.Clean("/" + p)
+	if p == "/.env" {
 		// The .env file is special and is stored in the service directory,
 		// so reject any attempts to access it via /data.
-		return "", fmt.Errorf("invalid path: %q", path)
+		return "", fmt.Errorf("invalid path: %q", fullPath)
 	}
-
-	svcDir := f.s.serviceRootDir(sn)
-	return filepath.Join(svcDir, fullPath), nil
+	if p == "/" {
+		return ".", nil
+	}
+	return p[1:], nil
 }
 
 func (f *fileHandler) Filelist(req *sftp.Request) (_ sftp.ListerAt, err error) {
@@ -103,57 +144,71 @@ func (f *fileHandler) Filelist(req *sftp.Request) (_ sftp.ListerAt, err error) {
 	defer func() {
 		log.Printf("Filelist: %v", err)
 	}()
-	path, err := f.resolvePath(req.Filepath)
+	if id, _, ok := parseUploadPath(req.Filepath); ok {
+		// sftp reput stats the file to find where to continue.
+		sn, _, err := f.s.serviceAndUser(f.session)
+		if err != nil {
+			return nil, err
+		}
+		p := f.s.uploadPartPath(sn, id)
+		root, err := os.OpenRoot(filepath.Dir(p))
+		if err != nil {
+			return nil, err
+		}
+		defer root.Close()
+		return newLister(req.Method, root, filepath.Base(p))
+	}
+	root, name, err := f.resolvePath(req.Filepath)
 	if err != nil {
 		return nil, err
 	}
-	return &lister{
-		method: req.Method,
-		path:   path,
-	}, nil
+	defer root.Close()
+	return newLister(req.Method, root, name)
 }
 
+// lister lists the files read by newLister.
 type lister struct {
-	method string
-	path   string
-	de     []fs.DirEntry
+	fis []os.FileInfo
 }
 
-func (ls *lister) ListAt(fis []os.FileInfo, off int64) (n int, err error) {
-	defer func() {
-		log.Printf("ListAt(%+v): %d, %v", ls, n, err)
-	}()
-	if ls.method == "Stat" {
-		fi, err := os.Stat(ls.path)
+// newLister returns the lister for method, Stat or List, on the file name in
+// root.
+func newLister(method string, root *os.Root, name string) (*lister, error) {
+	switch method {
+	case "Stat":
+		fi, err := root.Stat(name)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		fis[0] = fi
-		return 1, io.EOF
-	}
-	if ls.method != "List" {
-		return 0, fmt.Errorf("unsupported method: %q", ls.method)
-	}
-	if ls.de == nil {
-		de, err := os.ReadDir(ls.path)
+		return &lister{fis: []os.FileInfo{fi}}, nil
+	case "List":
+		d, err := root.Open(name)
 		if err != nil {
-			return 0, err
-		}
-		ls.de = de
-	}
-	count := 0
-	for i, d := range ls.de[off:] {
-		if i >= len(fis) {
-			return count, nil
+			return nil, err
 		}
-		fi, err := d.Info()
+		defer d.Close()
+		fis, err := d.Readdir(-1)
 		if err != nil {
-			return count, err
+			return nil, err
 		}
-		fis[i] = fi
-		count++
+		return &lister{fis: fis}, nil
+	default:
+		return nil, fmt.Errorf("unsupported method: %q", method)
 	}
-	return count, io.EOF
+}
+
+func (ls *lister) ListAt(fis []os.FileInfo, off int64) (n int, err error) {
+	defer func() {
+		log.Printf("ListAt(%d): %d, %v", off, n, err)
+	}()
+	if off >= int64(len(ls.fis)) {
+		return 0, io.EOF
+	}
+	n = copy(fis, ls.fis[off:])
+	if off+int64(n) == int64(len(ls.fis)) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
 func (f *fileHandler) Filecmd(req *sftp.Request) (ret error) {
@@ -161,19 +216,145 @@ func (f *fileHandler) Filecmd(req *sftp.Request) (ret error) {
 	defer func() {
 		log.Printf("Filecmd: %v", ret)
 	}()
-	if req.Method != "Setstat" {
+	switch req.Method {
+	case "Setstat":
+		log.Println("Setstat: ", req.Attributes())
+		log.Println("AttrFlags:", req.AttrFlags())
+		if _, ok := f.fileMapping.Load(req.Filepath); ok {
+			return nil
+		}
+		root, _, err := f.resolvePath(req.Filepath)
+		if err != nil {
+			return err
+		}
+		return root.Close()
+	case "Mkdir":
+		sn, user, err := f.s.serviceAndUser(f.session)
+		if err != nil {
+			return err
+		}
+		// Ensure the data directory exists, in case we haven't seen this
+		// service before.
+		if err := f.s.ensureDirs(sn, user); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+		name, err := dataPath(req.Filepath)
+		if err != nil {
+			return err
+		}
+		root, err := f.dataRoot()
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+		return root.Mkdir(name, 0755)
+	case "Rmdir", "Remove":
+		name, err := dataPath(req.Filepath)
+		if err != nil {
+			return err
+		}
+		root, err := f.dataRoot()
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+		if st, err := root.Lstat(name); err != nil {
+			return err
+		} else if req.Method == "Rmdir" && !st.IsDir() {
+			return fmt.Errorf("not a directory: %q", req.Filepath)
+		} else if req.Method == "Remove" && st.IsDir() {
+			return fmt.Errorf("is a directory: %q", req.Filepath)
+		}
+		return root.Remove(name)
+	case "Rename":
+		src, err := dataPath(req.Filepath)
+		if err != nil {
+			return err
+		}
+		dst, err := dataPath(req.Target)
+		if err != nil {
+			return err
+		}
+		root, err := f.dataRoot()
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+		// SFTP rename must not overwrite, unlike rename(2).
+		return renameNoReplace(root, src, dst)
+	case "Symlink":
+		// The target of the link is in Filepath and the link itself in
+		// Target. Relative targets are relative to the link.
+		link, err := dataPath(req.Target)
+		if err != nil {
+			return err
+		}
+		target := req.Filepath
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(req.Target), target)
+		}
+		// The target has to be in the data dir too, but it may be the data
+		// dir itself.
+		name, err := dataName(path.Clean(target))
+		if err != nil {
+			return fmt.Errorf("invalid symlink target: %q", req.Filepath)
+		}
+		root, err := f.dataRoot()
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+		return symlinkIn(root, name, link)
+	default:
 		return fmt.Errorf("unsupported method: %q", req.Method)
 	}
-	log.Println("Setstat: ", req.Attributes())
-	log.Println("AttrFlags:", req.AttrFlags())
-	if _, ok := f.fileMapping.Load(req.Filepath); ok {
-		return nil
+}
+
+// dataPath is like dataName but only allows paths inside the data dir of the
+// service, excluding the data dir itself, for commands that change it.
+func dataPath(fullPath string) (string, error) {
+	if !strings.HasPrefix(fullPath, "/data/") {
+		return "", fmt.Errorf("unsupported path: %q", fullPath)
+	}
+	name, err := dataName(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if name == "." {
+		return "", fmt.Errorf("unsupported path: %q", fullPath)
+	}
+	return name, nil
+}
+
+// symlinkIn creates the symlink link to target, both relative to root. The
+// link is relative to its directory so that it also works where the data dir
+// is mounted elsewhere, e.g. in a container. That directory must not be
+// reached through a symlink, or the link could point out of root.
+func symlinkIn(root *os.Root, target, link string) error {
+	dir := filepath.Dir(link)
+	for d := dir; d != "."; d = filepath.Dir(d) {
+		st, err := root.Lstat(d)
+		if err != nil {
+			return err
+		}
+		if !st.IsDir() {
+			return fmt.Errorf("invalid symlink: %q is not a directory", d)
+		}
 	}
-	if _, err := f.resolvePath(req.Filepath); err != nil {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
 		return err
 	}
+	return root.Symlink(rel, link)
+}
 
-	return nil
+// renameChecked renames src to dst in root unless dst exists. It is racy,
+// renameNoReplace uses it where the OS can't do it atomically.
+func renameChecked(root *os.Root, src, dst string) error {
+	if _, err := root.Lstat(dst); err == nil {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: fs.ErrExist}
+	}
+	return root.Rename(src, dst)
 }
 
 // serve handles SFTP requests and delegates them to the pre-configured handlers.
@@ -211,22 +392,47 @@ func (f *fileHandler) Filewrite(req *sftp.Request) (_ io.WriterAt, err error) {
 	if req.Method != "Put" {
 		return nil, fmt.Errorf("unsupported method: %q", req.Method)
 	}
-	if strings.HasPrefix(req.Filepath, "/data/") {
-		return f.uploadFile(req.Filepath)
+	if id, stage, ok := parseUploadPath(req.Filepath); ok {
+		// sftp reput opens the file without truncating it to continue
+		// the upload.
+		return f.uploadPart(req.Filepath, id, stage, req.Pflags().Trunc)
+	}
+	return f.openWriter(req.Filepath)
+}
+
+// openWriter returns the writer for an upload to p: the installer of the
+// service for /, /stage, /env and /stage/env and the resumable uploads under
+// /upload and /stage/upload, the signature of the next file for /sig and
+// /stage/sig, the template mark of the next file for /tmpl and /stage/tmpl,
+// or the file in the data dir for paths under /data. Installers install or
+// stage the file when closed.
+func (f *fileHandler) openWriter(p string) (io.WriterAt, error) {
+	if strings.HasPrefix(p, "/data/") {
+		return f.uploadFile(p)
+	}
+	if id, stage, ok := parseUploadPath(p); ok {
+		return f.uploadPart(p, id, stage, true)
+	}
+	if p == "/sig" || p == "/stage/sig" {
+		return f.nextFile(f.s.signaturePath)
+	}
+	if p == "/tmpl" || p == "/stage/tmpl" {
+		return f.nextFile(f.s.templateMarkPath)
 	}
 	var fs *FileInstaller
-	switch req.Filepath {
+	var err error
+	switch p {
 	case "/", "/stage":
-		fs, err = f.binFile(req.Filepath == "/")
+		fs, err = f.binFile(p == "/")
 	case "/env", "/stage/env":
-		fs, err = f.envFile(req.Filepath == "/env")
+		fs, err = f.envFile(p == "/env")
 	default:
-		return nil, fmt.Errorf("unsupported path: %q", req.Filepath)
+		return nil, fmt.Errorf("unsupported path: %q", p)
 	}
 	if err != nil {
 		return nil, err
 	}
-	f.fileMapping.Store(req.Filepath, fs)
+	f.fileMapping.Store(p, fs)
 	return fs, nil
 }
 
@@ -241,17 +447,35 @@ func (f *fileHandler) uploadFile(dst string) (io.WriterAt, error) {
 		return nil, fmt.Errorf("failed to create directories: %w", err)
 	}
 
-	path, err := f.resolvePath(dst)
+	name, err := dataPath(dst)
+	if err != nil {
+		return nil, err
+	}
+	root, err := f.dataRoot()
 	if err != nil {
 		return nil, err
 	}
-	pf, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	defer root.Close()
+	pf, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
 		return nil, err
 	}
 	return pf, nil
 }
 
+// nextFile returns the file at path(sn) that something about the next file
+// of service sn, like its signature, is uploaded to.
+func (f *fileHandler) nextFile(path func(sn string) string) (*os.File, error) {
+	sn, user, err := f.s.serviceAndUser(f.session)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.s.ensureDirs(sn, user); err != nil {
+		return nil, fmt.Errorf("failed to create directories: %w", err)
+	}
+	return os.OpenFile(path(sn), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+}
+
 func (f *fileHandler) envFile(install bool) (*FileInstaller, error) {
 	sn, user, err := f.s.serviceAndUser(f.session)
 	if err != nil {
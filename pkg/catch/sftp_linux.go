@@ -0,0 +1,47 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameNoReplace renames src to dst in root, failing with fs.ErrExist if dst
+// exists. It is atomic with renameat2(2) RENAME_NOREPLACE, on filesystems
+// that support it.
+func renameNoReplace(root *os.Root, src, dst string) error {
+	sd, err := root.Open(filepath.Dir(src))
+	if err != nil {
+		return err
+	}
+	defer sd.Close()
+	dd, err := root.Open(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	defer dd.Close()
+	err = unix.Renameat2(int(sd.Fd()), filepath.Base(src), int(dd.Fd()), filepath.Base(dst), unix.RENAME_NOREPLACE)
+	if errors.Is(err, unix.EINVAL) {
+		// Not supported by the filesystem.
+		return renameChecked(root, src, dst)
+	} else if err != nil {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string // empty for an error
+	}{
+		{"/data", "."},
+		{"/data/", "."},
+		{"/data/a/b", "a/b"},
+		{"/data/a/../../etc/passwd", "etc/passwd"},
+		{"/data/.env", ""},
+		{"/database", ""},
+		{"/env", ""},
+	}
+	for _, tt := range tests {
+		got, err := dataName(tt.path)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("dataName(%q) = %q, want error", tt.path, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("dataName(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+	if _, err := dataPath("/data/"); err == nil {
+		t.Error("dataPath of the data dir succeeded")
+	}
+}
+
+func openTestRoot(t *testing.T) (*os.Root, string) {
+	t.Helper()
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { root.Close() })
+	return root, dir
+}
+
+func TestSymlinkIn(t *testing.T) {
+	root, dir := openTestRoot(t)
+	if err := root.MkdirAll("a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := symlinkIn(root, "t", "a/b/l"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.Readlink(filepath.Join(dir, "a/b/l")); err != nil || got != "../../t" {
+		t.Errorf("link = %q, %v; want %q", got, err, "../../t")
+	}
+
+	// A link in a directory reached through a symlink is refused, as its
+	// relative target would be resolved from elsewhere.
+	if err := os.Symlink(".", filepath.Join(dir, "self")); err != nil {
+		t.Fatal(err)
+	}
+	if err := symlinkIn(root, "t", "self/l"); err == nil {
+		t.Error("symlinkIn through a symlinked directory succeeded")
+	}
+}
+
+func TestDataRootEscape(t *testing.T) {
+	root, dir := openTestRoot(t)
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "l")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Open("l"); err == nil {
+		t.Error("Open followed a symlink out of the root")
+	}
+	if _, err := newLister("Stat", root, "l"); err == nil {
+		t.Error("Stat followed a symlink out of the root")
+	}
+	if _, err := root.OpenFile("l", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666); err == nil {
+		t.Error("OpenFile followed a symlink out of the root")
+	}
+	if b, err := os.ReadFile(outside); err != nil || string(b) != "secret" {
+		t.Errorf("file outside the root = %q, %v", b, err)
+	}
+}
+
+func TestRenameNoReplace(t *testing.T) {
+	root, _ := openTestRoot(t)
+	for _, name := range []string{"a", "b"} {
+		if err := root.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := root.Mkdir("d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameNoReplace(root, "a", "b"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("renameNoReplace onto an existing file = %v, want %v", err, fs.ErrExist)
+	}
+	if b, err := root.ReadFile("b"); err != nil || string(b) != "b" {
+		t.Errorf("b = %q, %v; want it untouched", b, err)
+	}
+	if err := renameNoReplace(root, "a", "d/c"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := root.ReadFile("d/c"); err != nil || string(b) != "a" {
+		t.Errorf("d/c = %q, %v; want %q", b, err, "a")
+	}
+	if _, err := root.Lstat("a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a after rename: %v, want %v", err, fs.ErrNotExist)
+	}
+}
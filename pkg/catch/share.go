@@ -0,0 +1,448 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+)
+
+// Share links are stateless: the token in the URL carries the service, what
+// to show, when it was issued and the expiry, signed with a host-local key.
+// The only state is the time the links of each service were last revoked, in
+// share-revoked.json in the catch root; links issued before it are rejected.
+
+const (
+	shareKindLogs   = "logs"
+	shareKindStatus = "status"
+	shareRevoke     = "revoke"
+
+	// shareMaxTTL caps the lifetime of share links.
+	shareMaxTTL = 7 * 24 * time.Hour
+	// shareLogLines is the number of log lines shown on a logs share page.
+	shareLogLines = 500
+	// shareLogTimeout bounds how long a share page waits for logs.
+	shareLogTimeout = 10 * time.Second
+)
+
+// shareToken is the signed payload of a share link.
+type shareToken struct {
+	Service string `json:"s"`
+	Kind    string `json:"k"`
+	// Issued is when the link was created in nanoseconds since the epoch.
+	Issued int64 `json:"i"`
+	// Expires is the expiry in seconds since the epoch.
+	Expires int64 `json:"e"`
+}
+
+// shareKey returns the key share links are signed with, creating it if it
+// does not exist yet.
+func (s *Server) shareKey() ([]byte, error) {
+	p := filepath.Join(s.cfg.RootDir, "share.key")
+	key, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(p, key, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write share key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read share key: %w", err)
+	}
+	return key, nil
+}
+
+func shareMAC(key, payload []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+// signShare returns the token of a share link for t.
+func (s *Server) signShare(t shareToken) (string, error) {
+	key, err := s.shareKey()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(shareMAC(key, payload)), nil
+}
+
+var errInvalidShare = errors.New("invalid or expired share link")
+
+// verifyShare returns the payload of token if its signature is valid and it
+// has not expired at now.
+func (s *Server) verifyShare(token string, now time.Time) (shareToken, error) {
+	key, err := s.shareKey()
+	if err != nil {
+		return shareToken{}, err
+	}
+	enc := base64.RawURLEncoding
+	p, m, ok := strings.Cut(token, ".")
+	if !ok {
+		return shareToken{}, errInvalidShare
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return shareToken{}, errInvalidShare
+	}
+	mac, err := enc.DecodeString(m)
+	if err != nil || !hmac.Equal(mac, shareMAC(key, payload)) {
+		return shareToken{}, errInvalidShare
+	}
+	var t shareToken
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return shareToken{}, errInvalidShare
+	}
+	if now.Unix() >= t.Expires {
+		return shareToken{}, errInvalidShare
+	}
+	revoked, err := s.shareRevocations()
+	if err != nil {
+		return shareToken{}, err
+	}
+	if r, ok := revoked[t.Service]; ok && t.Issued <= r {
+		return shareToken{}, errInvalidShare
+	}
+	return t, nil
+}
+
+func (s *Server) shareRevokedPath() string {
+	return filepath.Join(s.cfg.RootDir, "share-revoked.json")
+}
+
+// shareRevocations returns the time the share links of each service were
+// last revoked, in nanoseconds since the epoch.
+func (s *Server) shareRevocations() (map[string]int64, error) {
+	b, err := os.ReadFile(s.shareRevokedPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read share revocations: %w", err)
+	}
+	var m map[string]int64
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse share revocations: %w", err)
+	}
+	return m, nil
+}
+
+// revokeShares revokes the share links of service sn issued up to now.
+func (s *Server) revokeShares(sn string, now time.Time) error {
+	s.shareMu.Lock()
+	defer s.shareMu.Unlock()
+	m, err := s.shareRevocations()
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = make(map[string]int64)
+	}
+	m[sn] = now.UnixNano()
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmp := s.shareRevokedPath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("failed to write share revocations: %w", err)
+	}
+	if err := os.Rename(tmp, s.shareRevokedPath()); err != nil {
+		return fmt.Errorf("failed to write share revocations: %w", err)
+	}
+	// Drop the cached pages of the revoked links.
+	s.apiCache.invalidate()
+	return nil
+}
+
+// shareURL returns the URL of the share link with token.
+func (s *Server) shareURL(token string) string {
+	host := s.cfg.ShareAddr
+	if host == "" {
+		host = s.cfg.ExternalRegistryAddr
+	}
+	return "https://" + host + "/share/" + token
+}
+
+// ShareHandler serves the pages of share links at /share/<token>. It is
+// mounted on the tailnet web listener and, if Funnel is available, on the
+// public share listener at Config.ShareAddr.
+func (s *Server) ShareHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /share/{token}", s.handleShare)
+	return mux
+}
+
+var shareTmpl = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.Service}} {{.Kind}}</title>
+<style>
+body { font-family: ui-monospace, monospace; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+pre { background: #f4f4f4; padding: 1em; overflow-x: auto; }
+.meta { color: #777; }
+</style>
+</head>
+<body>
+<h1>{{.Service}}</h1>
+<p class="meta">Snapshot taken {{.Now.Format "2006-01-02 15:04:05 MST"}}. This link expires {{.Expires.Format "2006-01-02 15:04:05 MST"}}.</p>
+{{with .Status}}<table>
+<tr><th>COMPONENT</th><th>STATUS</th><th>UPTIME</th><th>RESTARTS</th></tr>
+{{range .ComponentStatus}}<tr><td>{{.Name}}</td><td>{{.Status}}</td><td>{{.Uptime $.Now}}</td><td>{{.Restarts}}</td></tr>
+{{end}}</table>
+{{with .LastAction.Summary $.Now}}<p>{{.}}</p>{{end}}{{end}}
+{{if .ShowLogs}}<h2>Last {{.LogLines}} log lines</h2>
+<pre>{{range .Logs}}{{.Time.Format "2006-01-02T15:04:05Z07:00"}} {{.Source}}: {{.Line}}
+{{else}}No logs.{{end}}</pre>{{end}}
+{{with .Err}}<p>Error: {{.}}</p>{{end}}
+</body>
+</html>
+`))
+
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	t, err := s.verifyShare(r.PathValue("token"), now)
+	if errors.Is(err, errInvalidShare) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	data := struct {
+		Service  string
+		Kind     string
+		Now      time.Time
+		Expires  time.Time
+		Status   *ServiceStatusData
+		ShowLogs bool
+		LogLines int
+		Logs     []LogRecord
+		Err      string
+	}{
+		Service:  t.Service,
+		Kind:     t.Kind,
+		Expires:  time.Unix(t.Expires, 0),
+		ShowLogs: t.Kind == shareKindLogs,
+		LogLines: shareLogLines,
+	}
+	// Anyone with the link can load the page, so it is served from the
+	// API cache: however often it is loaded, the snapshot is taken at most
+	// once per apiCacheTTL.
+	e, err := s.apiCache.get("share/"+t.Service+"/"+t.Kind, func() (any, error) {
+		return s.shareSnapshot(t.Service, data.ShowLogs), nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var snap shareSnapshot
+	if err := json.Unmarshal(e.body, &snap); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Now, data.Status, data.Logs, data.Err = snap.Time, snap.Status, snap.Logs, snap.Err
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := shareTmpl.Execute(w, data); err != nil {
+		log.Printf("failed to render share page: %v", err)
+	}
+}
+
+// shareSnapshot is the status and logs shown on a share page.
+type shareSnapshot struct {
+	Time   time.Time          `json:"time"`
+	Status *ServiceStatusData `json:"status,omitempty"`
+	Logs   []LogRecord        `json:"logs,omitempty"`
+	Err    string             `json:"err,omitempty"`
+}
+
+// shareSnapshot returns the snapshot of service sn for a share page, with its
+// recent logs if logs is set. Compose services are read from their containers
+// alone, without loading the service and its secrets.
+func (s *Server) shareSnapshot(sn string, logs bool) shareSnapshot {
+	snap := shareSnapshot{Time: time.Now()}
+	status, err := s.shareStatus(sn)
+	if err != nil {
+		snap.Err = err.Error()
+		return snap
+	}
+	snap.Status = status
+	if logs {
+		if snap.Logs, err = s.recentLogs(context.Background(), sn, shareLogLines); err != nil {
+			snap.Err = err.Error()
+		}
+	}
+	return snap
+}
+
+// shareStatus returns the status of service sn for a share page.
+func (s *Server) shareStatus(sn string) (*ServiceStatusData, error) {
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		return nil, err
+	}
+	if sv.ServiceType() != db.ServiceTypeDockerCompose {
+		statuses, err := s.serviceStatusesWith(sn, statusDetails{runtime: true})
+		if err != nil || len(statuses) == 0 {
+			return nil, err
+		}
+		return &statuses[0], nil
+	}
+	st := &ServiceStatusData{
+		ServiceName: sn,
+		ServiceType: ServiceDataTypeDocker,
+		LastAction:  ServiceActionDataFromServiceAction(sv.LastAction()),
+		Generation:  sv.Generation(),
+	}
+	cs, err := svc.ProjectStatuses(sn)
+	if err != nil && !errors.Is(err, svc.ErrDockerStatusUnknown) {
+		return nil, err
+	}
+	if len(cs) == 0 {
+		st.ComponentStatus = append(st.ComponentStatus, ComponentStatusData{Name: sn, Status: ComponentStatusUnknown})
+	}
+	for cn, status := range cs {
+		st.ComponentStatus = append(st.ComponentStatus, ComponentStatusData{
+			Name:   cn,
+			Status: ComponentStatusFromServiceStatus(status),
+		})
+	}
+	if infos, err := svc.ProjectRuntimeInfos(sn); err == nil {
+		for i := range st.ComponentStatus {
+			if ri, ok := infos[st.ComponentStatus[i].Name]; ok {
+				st.ComponentStatus[i].setRuntimeInfo(ri)
+			}
+		}
+	}
+	slices.SortFunc(st.ComponentStatus, func(a, b ComponentStatusData) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	st.Status = ServiceStatus(st.ComponentStatus)
+	return st, nil
+}
+
+// recentLogs returns the last n log records of service sn.
+func (s *Server) recentLogs(ctx context.Context, sn string, n int) ([]LogRecord, error) {
+	st, err := s.serviceType(sn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, shareLogTimeout)
+	defer cancel()
+	opts := &svc.LogOptions{Lines: n}
+	var (
+		c     *exec.Cmd
+		parse func(string) (LogRecord, bool)
+	)
+	if st == db.ServiceTypeDockerCompose {
+		opts.Timestamps = true
+		if c, err = svc.ProjectLogsCmd(ctx, sn, opts); err != nil {
+			return nil, err
+		}
+		parse = parseComposeRecord
+	} else if c, parse, err = s.logRecordsCmd(ctx, sn, st, opts, nil); err != nil {
+		return nil, err
+	}
+	out, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("failed to get logs: %w", err)
+	}
+	var recs []LogRecord
+	sc := bufio.NewScanner(out)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if rec, ok := parse(sc.Text()); ok {
+			recs = append(recs, rec)
+		}
+	}
+	if err := c.Wait(); err != nil {
+		return recs, fmt.Errorf("failed to get logs: %w", err)
+	}
+	return recs, sc.Err()
+}
+
+func (e *ttyExecer) shareCmdFunc(cmd *cobra.Command, _ []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot share %q", e.sn)
+	}
+	if _, err := e.s.serviceView(e.sn); err != nil {
+		return err
+	}
+	kind := cmd.CalledAs()
+	if kind == shareRevoke {
+		if err := e.s.revokeShares(e.sn, time.Now()); err != nil {
+			return err
+		}
+		e.printf("Revoked all share links of %s\n", e.sn)
+		return nil
+	}
+	if kind != shareKindLogs && kind != shareKindStatus {
+		return fmt.Errorf("unknown share command %q", kind)
+	}
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	if ttl <= 0 || ttl > shareMaxTTL {
+		return fmt.Errorf("--ttl must be between 0 and %v", shareMaxTTL)
+	}
+	now := time.Now()
+	exp := now.Add(ttl)
+	token, err := e.s.signShare(shareToken{Service: e.sn, Kind: kind, Issued: now.UnixNano(), Expires: exp.Unix()})
+	if err != nil {
+		return fmt.Errorf("failed to sign share link: %w", err)
+	}
+	e.printf("%s\n", e.s.shareURL(token))
+	e.printf("Expires %s\n", exp.Format(time.DateTime))
+	if e.s.cfg.ShareAddr == "" {
+		e.printf("warning: catch is not serving share links through Funnel (see --share-funnel), the link only works on the tailnet\n")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShareRevoke(t *testing.T) {
+	s := &Server{cfg: Config{RootDir: t.TempDir()}}
+	now := time.Now()
+	sign := func(sn string, issued time.Time) string {
+		token, err := s.signShare(shareToken{Service: sn, Kind: shareKindLogs, Issued: issued.UnixNano(), Expires: now.Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	old, other := sign("web", now), sign("db", now)
+	if _, err := s.verifyShare(old, now); err != nil {
+		t.Fatalf("verifyShare before revoke: %v", err)
+	}
+	if _, err := s.verifyShare(old, now.Add(2*time.Hour)); !errors.Is(err, errInvalidShare) {
+		t.Fatalf("verifyShare after expiry = %v, want %v", err, errInvalidShare)
+	}
+
+	if err := s.revokeShares("web", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.verifyShare(old, now); !errors.Is(err, errInvalidShare) {
+		t.Errorf("verifyShare of revoked link = %v, want %v", err, errInvalidShare)
+	}
+	if _, err := s.verifyShare(other, now); err != nil {
+		t.Errorf("verifyShare of other service: %v", err)
+	}
+	if _, err := s.verifyShare(sign("web", now.Add(2*time.Second)), now); err != nil {
+		t.Errorf("verifyShare of link issued after revoke: %v", err)
+	}
+
+	// A tampered token doesn't verify.
+	if _, err := s.verifyShare(other[:len(other)-2]+"AA", now); !errors.Is(err, errInvalidShare) {
+		t.Errorf("verifyShare of tampered link = %v, want %v", err, errInvalidShare)
+	}
+}
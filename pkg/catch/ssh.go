@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 
 	gssh "tailscale.com/tempfork/gliderlabs/ssh"
 )
@@ -32,6 +33,16 @@ func (s *Server) SSHHandler(session gssh.Session) {
 		return
 	}
 
+	if args := session.Command(); isSCPCommand(args) {
+		if err := s.handleSCP(session, args); err != nil {
+			log.Printf("SCP to %q failed: %v", sn, err)
+			session.Exit(1)
+			return
+		}
+		session.Exit(0)
+		return
+	}
+
 	rwc := io.ReadWriteCloser(session)
 	ptyReq, ptyWCh, isPty := session.Pty()
 	execer := &ttyExecer{
@@ -45,6 +56,9 @@ func (s *Server) SSHHandler(session gssh.Session) {
 		ptyReq:    ptyReq,
 		ptyWCh:    ptyWCh,
 		rawCloser: session,
+
+		remoteAddr:    session.RemoteAddr().String(),
+		clientSession: clientSessionEnv(session.Environ()),
 	}
 
 	if err := execer.run(); err != nil {
@@ -54,3 +68,14 @@ func (s *Server) SSHHandler(session gssh.Session) {
 
 	session.Exit(0)
 }
+
+// clientSessionEnv returns the YEET_SESSION yeet sets in the environment of
+// its ssh sessions, if any.
+func clientSessionEnv(env []string) string {
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "YEET_SESSION="); ok {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,203 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yeetrun/yeet/pkg/cli"
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// Stage defaults are host-wide values of run and stage flags, e.g. --net=ts,
+// applied to services that have not been installed yet, whether they are
+// deployed with run, stage or a registry push, so that every new service on
+// the host is set up the same way without repeating the flags.
+// Flags given explicitly win over the defaults, and services that were
+// already installed keep their configuration. Defaults are only applied once
+// per service, so that flags staged explicitly before the first commit are
+// not overridden by it.
+
+// stageDefaultsExcluded are the flags that can't have a default, as their
+// value only makes sense for one service or deploy.
+var stageDefaultsExcluded = []string{"if-generation", "data-dir", "ts-auth-key", "macvlan-mac"}
+
+// sysDefaultsCmdFunc shows, sets or unsets the stage defaults of the host.
+func (e *ttyExecer) sysDefaultsCmdFunc(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return e.listStageDefaults()
+	}
+	switch args[0] {
+	case "set":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: sys defaults set <flag>=<value>...")
+		}
+		run, _, err := cmd.Root().Find([]string{"run"})
+		if err != nil {
+			return err
+		}
+		set := map[string]string{}
+		for _, a := range args[1:] {
+			name, v, ok := strings.Cut(strings.TrimPrefix(a, "--"), "=")
+			if !ok {
+				return fmt.Errorf("invalid default %q, expected <flag>=<value>", a)
+			}
+			if slices.Contains(stageDefaultsExcluded, name) {
+				return fmt.Errorf("--%s can't have a default", name)
+			}
+			if run.Flags().Lookup(name) == nil {
+				return fmt.Errorf("unknown run flag --%s", name)
+			}
+			// Parse the value with the flag of this session's run command,
+			// which is not used otherwise.
+			if err := run.Flags().Set(name, v); err != nil {
+				return fmt.Errorf("invalid value for --%s: %w", name, err)
+			}
+			set[name] = v
+		}
+		if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			for name, v := range set {
+				mak.Set(&d.StageDefaults, name, v)
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to update defaults: %w", err)
+		}
+	case "unset":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: sys defaults unset <flag>...")
+		}
+		if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			for _, name := range args[1:] {
+				delete(d.StageDefaults, strings.TrimPrefix(name, "--"))
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to update defaults: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid argument %q, expected list, set or unset", args[0])
+	}
+	return e.listStageDefaults()
+}
+
+func (e *ttyExecer) listStageDefaults() error {
+	dv, err := e.s.getDB()
+	if err != nil {
+		return err
+	}
+	defaults := dv.StageDefaults()
+	if defaults.Len() == 0 {
+		e.printf("No stage defaults\n")
+		return nil
+	}
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "FLAG\tVALUE\t")
+	for _, name := range slices.Sorted(maps.Keys(defaults.AsMap())) {
+		fmt.Fprintf(w, "--%s\t%s\t\n", name, defaults.Get(name))
+	}
+	return nil
+}
+
+// applyStageDefaults sets the flags of the run or stage command cmd that
+// were not given to the host's stage defaults, once per service before its
+// first install. It reports whether any default was set. The installer
+// records in the service that they were applied, with the rest of its config.
+func (e *ttyExecer) applyStageDefaults(cmd *cobra.Command) (bool, error) {
+	sv, err := e.s.serviceView(e.sn)
+	if err == nil && (sv.Generation() > 0 || sv.StageDefaultsApplied()) {
+		return false, nil
+	} else if err != nil && !errors.Is(err, errServiceNotFound) {
+		return false, err
+	}
+	dv, err := e.s.getDB()
+	if err != nil {
+		return false, err
+	}
+	defaults := dv.StageDefaults()
+	if defaults.Len() == 0 {
+		return false, nil
+	}
+	var applied bool
+	for _, name := range slices.Sorted(maps.Keys(defaults.AsMap())) {
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		v := defaults.Get(name)
+		if err := cmd.Flags().Set(name, v); err != nil {
+			return false, fmt.Errorf("invalid default --%s=%s: %w", name, v, err)
+		}
+		e.printf("Using host default --%s=%s\n", name, v)
+		applied = true
+	}
+	e.stageDefaultsApplied = true
+	return applied, nil
+}
+
+// stageDefaults stages the host's stage defaults for the service if it is
+// new, as `stage` with none of its flags would, for installs that don't pass
+// the flags of the stage command.
+func (e *ttyExecer) stageDefaults(stage *cobra.Command) error {
+	if applied, err := e.applyStageDefaults(stage); err != nil || !applied {
+		return err
+	}
+	if stage.Flags().Changed("runtime") {
+		if err := e.setRuntime(First(stage.Flags().GetString("runtime"))); err != nil {
+			return err
+		}
+	}
+	sfi := e.fileInstaller(stage, nil)
+	sfi.NoBinary = true
+	sfi.StageOnly = true
+	inst, err := NewFileInstaller(e.s, sfi)
+	if err != nil {
+		return fmt.Errorf("failed to create installer: %w", err)
+	}
+	if err := inst.Close(); err != nil {
+		return fmt.Errorf("failed to stage defaults: %w", err)
+	}
+	return nil
+}
+
+// stageDefaultsFor is stageDefaults for service sn, for installs that don't
+// go through the run and stage commands, like registry pushes. Its output
+// goes to the log.
+func (s *Server) stageDefaultsFor(sn string) error {
+	e := &ttyExecer{
+		ctx: s.ctx,
+		s:   s,
+		sn:  sn,
+		rw:  struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader(""), log.Writer()},
+	}
+	stage, _, err := cli.NewCommandHandler(e.rw, e.runE).RootCmd("catch").Find([]string{"stage"})
+	if err != nil {
+		return err
+	}
+	return e.stageDefaults(stage)
+}
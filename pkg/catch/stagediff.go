@@ -0,0 +1,263 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"gopkg.in/yaml.v3"
+)
+
+// Values of ConfigFieldDiff.Change.
+const (
+	FieldAdded   = "added"
+	FieldRemoved = "removed"
+	FieldChanged = "changed"
+)
+
+// StageDiff is what committing the staged configuration of a service would
+// change compared to the running generation.
+type StageDiff struct {
+	ServiceName string `json:"serviceName"`
+	// Generation is the running generation the staged configuration is
+	// compared to.
+	Generation int `json:"generation"`
+	// Changed reports whether committing would change anything.
+	Changed   bool              `json:"changed"`
+	Artifacts []ArtifactDiff    `json:"artifacts"`
+	Config    []ConfigFieldDiff `json:"config"`
+	Images    []ImageDiff       `json:"images"`
+}
+
+// ArtifactDiff is an artifact whose staged content differs from the running
+// one. Running or Staged is empty if the artifact is only in one of them.
+type ArtifactDiff struct {
+	Name    db.ArtifactName `json:"name"`
+	Running string          `json:"running,omitempty"`
+	Staged  string          `json:"staged,omitempty"`
+}
+
+// ConfigFieldDiff is a field of an artifact that changed, e.g. a variable of
+// the env file, a directive of a unit or a key of a compose service. Values
+// are left out as they may be secret.
+type ConfigFieldDiff struct {
+	Artifact db.ArtifactName `json:"artifact"`
+	Field    string          `json:"field"`
+	Change   string          `json:"change"`
+}
+
+// ImageDiff is an image of the service whose staged digest differs from the
+// running one.
+type ImageDiff struct {
+	Repo    string `json:"repo"`
+	Running string `json:"running,omitempty"`
+	Staged  string `json:"staged,omitempty"`
+}
+
+// stageDiff compares the staged configuration of service sn to its running
+// generation.
+func (s *Server) stageDiff(sn string) (*StageDiff, error) {
+	dv, err := s.getDB()
+	if err != nil {
+		return nil, err
+	}
+	sv, ok := dv.Services().GetOk(sn)
+	if !ok {
+		return nil, errServiceNotFound
+	}
+	service := sv.AsStruct()
+	gen := service.Generation
+	diff := &StageDiff{
+		ServiceName: sn,
+		Generation:  gen,
+		Artifacts:   []ArtifactDiff{},
+		Config:      []ConfigFieldDiff{},
+		Images:      []ImageDiff{},
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(service.Artifacts)) {
+		staged, ok := service.Artifacts.Staged(name)
+		if !ok {
+			continue
+		}
+		running, _ := service.Artifacts.Gen(name, gen)
+		if staged == running {
+			continue
+		}
+		sb, err := os.ReadFile(staged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read staged %s: %w", name, err)
+		}
+		var rb []byte
+		if running != "" {
+			if rb, err = os.ReadFile(running); err != nil {
+				return nil, fmt.Errorf("failed to read running %s: %w", name, err)
+			}
+			if bytes.Equal(sb, rb) {
+				continue
+			}
+		}
+		diff.Artifacts = append(diff.Artifacts, ArtifactDiff{Name: name, Running: running, Staged: staged})
+		diff.Config = append(diff.Config, configFieldDiffs(name, rb, sb)...)
+	}
+
+	for rn, ir := range dv.AsStruct().Images {
+		if repoSvc, _, _ := strings.Cut(string(rn), "/"); repoSvc != sn {
+			continue
+		}
+		staged, ok := ir.Refs["staged"]
+		if !ok {
+			continue
+		}
+		running := ir.Refs[db.ImageRef(db.Gen(gen))]
+		if staged.BlobHash == running.BlobHash {
+			continue
+		}
+		diff.Images = append(diff.Images, ImageDiff{Repo: string(rn), Running: running.BlobHash, Staged: staged.BlobHash})
+	}
+	slices.SortFunc(diff.Images, func(a, b ImageDiff) int {
+		return strings.Compare(a.Repo, b.Repo)
+	})
+
+	diff.Changed = len(diff.Artifacts) > 0 || len(diff.Images) > 0
+	return diff, nil
+}
+
+// configFieldDiffs returns the fields of artifact name that differ between
+// its running content rb and staged content sb. Artifacts that are not
+// made of fields, like binaries, have none.
+func configFieldDiffs(name db.ArtifactName, rb, sb []byte) []ConfigFieldDiff {
+	var parse func([]byte) map[string]string
+	switch name {
+	case db.ArtifactEnvFile, db.ArtifactNetNSEnv, db.ArtifactTSEnv,
+		db.ArtifactSystemdUnit, db.ArtifactSystemdTimerFile, db.ArtifactSystemdOverride,
+		db.ArtifactQuadletContainer, db.ArtifactQuadletNetwork, db.ArtifactNetNSService, db.ArtifactTSService:
+		parse = parseKeyValueFields
+	case db.ArtifactDockerComposeFile, db.ArtifactDockerComposeNetwork:
+		parse = parseComposeFields
+	case db.ArtifactTSConfig:
+		parse = parseJSONFields
+	default:
+		return nil
+	}
+	running, staged := parse(rb), parse(sb)
+	var diffs []ConfigFieldDiff
+	for _, f := range slices.Sorted(maps.Keys(staged)) {
+		if v, ok := running[f]; !ok {
+			diffs = append(diffs, ConfigFieldDiff{Artifact: name, Field: f, Change: FieldAdded})
+		} else if v != staged[f] {
+			diffs = append(diffs, ConfigFieldDiff{Artifact: name, Field: f, Change: FieldChanged})
+		}
+	}
+	for _, f := range slices.Sorted(maps.Keys(running)) {
+		if _, ok := staged[f]; !ok {
+			diffs = append(diffs, ConfigFieldDiff{Artifact: name, Field: f, Change: FieldRemoved})
+		}
+	}
+	return diffs
+}
+
+// parseKeyValueFields parses env files and systemd style unit files into
+// their KEY=value fields. Unit keys are prefixed with their section, e.g.
+// "Service.ExecStart". Repeated keys are joined.
+func parseKeyValueFields(b []byte) map[string]string {
+	fields := map[string]string{}
+	var section string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		if section != "" {
+			k = section + "." + k
+		}
+		if prev, ok := fields[k]; ok {
+			v = prev + "\n" + v
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+// parseComposeFields parses a compose file into the keys of each of its
+// services, e.g. "services.web.image", and the other top-level entries, e.g.
+// "networks.default" or "name".
+func parseComposeFields(b []byte) map[string]string {
+	var cf map[string]any
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		return map[string]string{"": string(b)}
+	}
+	fields := map[string]string{}
+	for top, v := range cf {
+		entries, ok := v.(map[string]any)
+		if !ok {
+			fields[top] = fieldValue(v)
+			continue
+		}
+		for name, v := range entries {
+			keys, ok := v.(map[string]any)
+			if top != "services" || !ok {
+				fields[top+"."+name] = fieldValue(v)
+				continue
+			}
+			for k, v := range keys {
+				fields[top+"."+name+"."+k] = fieldValue(v)
+			}
+		}
+	}
+	return fields
+}
+
+// parseJSONFields parses a JSON object into its top-level keys.
+func parseJSONFields(b []byte) map[string]string {
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return map[string]string{"": string(b)}
+	}
+	fields := map[string]string{}
+	for k, v := range m {
+		fields[k] = fieldValue(v)
+	}
+	return fields
+}
+
+// fieldValue returns a comparable representation of v.
+func fieldValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,243 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+)
+
+// cpuSampleInterval is the time between the two samples of the CPU time of
+// systemd services that their CPU usage is computed from.
+const cpuSampleInterval = 500 * time.Millisecond
+
+// serviceStats returns the resource usage of service sn, or of all services
+// if sn is SystemService. The result is sorted by service name.
+func (s *Server) serviceStats(sn string) ([]ServiceStatsData, error) {
+	var names []string
+	if sn == SystemService {
+		dv, err := s.cfg.DB.Get()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get services: %w", err)
+		}
+		for name, sv := range dv.Services().All() {
+			if name == CatchService || sv.ServiceType() == db.ServiceTypeExternal {
+				continue
+			}
+			names = append(names, name)
+		}
+		slices.Sort(names)
+	} else {
+		names = []string{sn}
+	}
+
+	// Sample the CPU time of all systemd services first so that they share
+	// one sample interval.
+	type systemdSample struct {
+		service *svc.SystemdService
+		usage   svc.Usage
+		at      time.Time
+	}
+	systemd := make(map[string]*systemdSample)
+	for _, name := range names {
+		st, err := s.serviceType(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get service type: %w", err)
+		}
+		if st != db.ServiceTypeSystemd {
+			continue
+		}
+		service, err := s.systemdService(name)
+		if err != nil {
+			return nil, err
+		}
+		u, err := service.Usage()
+		if err != nil {
+			return nil, err
+		}
+		systemd[name] = &systemdSample{service: service, usage: u, at: time.Now()}
+	}
+
+	// docker stats takes a couple of seconds per call, so compose services
+	// are sampled concurrently, and while the systemd services sleep.
+	type composeSample struct {
+		usages map[string]svc.Usage
+		err    error
+	}
+	compose := make(map[string]*composeSample)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		if _, ok := systemd[name]; ok {
+			continue
+		}
+		st, err := s.serviceType(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get service type: %w", err)
+		}
+		if st != db.ServiceTypeDockerCompose {
+			if sn != SystemService {
+				return nil, fmt.Errorf("stats are not supported for %s services", st)
+			}
+			continue
+		}
+		service, err := s.dockerComposeService(name)
+		if err != nil {
+			return nil, err
+		}
+		sample := &composeSample{}
+		compose[name] = sample
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sample.usages, sample.err = service.Usage()
+		}()
+	}
+	if len(systemd) > 0 {
+		time.Sleep(cpuSampleInterval)
+	}
+	wg.Wait()
+
+	stats := make([]ServiceStatsData, 0, len(names))
+	for _, name := range names {
+		if sample, ok := systemd[name]; ok {
+			u, err := sample.service.Usage()
+			if err != nil {
+				return nil, err
+			}
+			c := componentStats(name, u)
+			if elapsed := time.Since(sample.at); elapsed > 0 && u.CPUTime >= sample.usage.CPUTime {
+				c.CPUPercent = float64(u.CPUTime-sample.usage.CPUTime) / float64(elapsed) * 100
+			}
+			stats = append(stats, ServiceStatsData{
+				ServiceName: name,
+				ServiceType: ServiceDataTypeService,
+				Components:  []ComponentStatsData{c},
+			})
+			continue
+		}
+		sample, ok := compose[name]
+		if !ok {
+			continue
+		}
+		if sample.err != nil {
+			if sn != SystemService {
+				return nil, sample.err
+			}
+			// Don't fail the whole listing for one broken service.
+			log.Printf("failed to get stats of %q: %v", name, sample.err)
+		}
+		data := ServiceStatsData{
+			ServiceName: name,
+			ServiceType: ServiceDataTypeDocker,
+			Components:  []ComponentStatsData{},
+		}
+		for cn, u := range sample.usages {
+			data.Components = append(data.Components, componentStats(cn, u))
+		}
+		slices.SortFunc(data.Components, func(a, b ComponentStatsData) int {
+			return cmp.Compare(a.Name, b.Name)
+		})
+		stats = append(stats, data)
+	}
+	return stats, nil
+}
+
+func componentStats(name string, u svc.Usage) ComponentStatsData {
+	return ComponentStatsData{
+		Name:        name,
+		CPUPercent:  u.CPUPercent,
+		MemoryBytes: u.MemoryBytes,
+		NetRxBytes:  u.NetRxBytes,
+		NetTxBytes:  u.NetTxBytes,
+	}
+}
+
+// topCmdFunc prints the resource usage of the service, or of all services
+// when run against sys. With --follow it refreshes every --interval until
+// the session ends.
+func (e *ttyExecer) topCmdFunc(cmd *cobra.Command, _ []string) error {
+	formatOut, _ := cmd.Flags().GetString("format")
+	follow, _ := cmd.Flags().GetBool("follow")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	switch formatOut {
+	case "table", "json", "json-pretty":
+	default:
+		return fmt.Errorf("unknown format %q, use table, json or json-pretty", formatOut)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	out := cmd.OutOrStdout()
+	for {
+		stats, err := e.s.serviceStats(e.sn)
+		if err != nil {
+			return err
+		}
+		if follow && formatOut == "table" {
+			// Clear the screen and move the cursor home.
+			fmt.Fprint(out, "\033[H\033[2J")
+		}
+		if err := writeStats(out, formatOut, stats); err != nil {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+		select {
+		case <-time.After(interval):
+		case <-e.ctx.Done():
+			return nil
+		case <-cmd.Context().Done():
+			return nil
+		}
+	}
+}
+
+// writeStats writes stats to w in format, one of table, json or
+// json-pretty. JSON is written as one document per call so that --follow
+// output can be read as a stream.
+func writeStats(w io.Writer, format string, stats []ServiceStatsData) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(stats)
+	case "json-pretty":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tCONTAINER\tCPU\tMEM\tNET RX\tNET TX\t")
+	for _, st := range stats {
+		for _, c := range st.Components {
+			fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s\t%s\t%s\t\n",
+				st.ServiceName, c.Name, c.CPUPercent,
+				humanReadableBytes(float64(c.MemoryBytes)),
+				humanReadableBytes(float64(c.NetRxBytes)),
+				humanReadableBytes(float64(c.NetTxBytes)))
+		}
+	}
+	return tw.Flush()
+}
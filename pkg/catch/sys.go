@@ -0,0 +1,348 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// sysCmdFunc handles the host-wide `sys` subcommands.
+func (e *ttyExecer) sysCmdFunc(cmd *cobra.Command, args []string) error {
+	if e.sn != SystemService {
+		return fmt.Errorf("sys commands are only available on the %s service", SystemService)
+	}
+	switch cmd.CalledAs() {
+	case "ts-defaults":
+		return e.tsDefaultsCmdFunc(cmd, args)
+	case "commit":
+		return e.sysCommitCmdFunc(cmd, args)
+	case "gc":
+		return e.sysGCCmdFunc(cmd, args)
+	case "selfcheck":
+		return e.sysSelfCheckCmdFunc(cmd, args)
+	case "autodeploy":
+		return e.sysAutoDeployCmdFunc(cmd, args)
+	case "orphans":
+		return e.sysOrphansCmdFunc(cmd, args)
+	case "defaults":
+		return e.sysDefaultsCmdFunc(cmd, args)
+	case "migrate-units":
+		return e.sysMigrateUnitsCmdFunc(cmd, args)
+	case "prometheus-sd":
+		return e.sysPrometheusSDCmdFunc(cmd, args)
+	case "motd":
+		return e.sysMotdCmdFunc(cmd, args)
+	default:
+		return fmt.Errorf("unhandled sys command %q", cmd.CalledAs())
+	}
+}
+
+// autoDeployOff returns who turned registry auto-deploys off host-wide, or
+// nil if they are on.
+func (s *Server) autoDeployOff() *db.ServiceAction {
+	dv, err := s.getDB()
+	if err != nil {
+		log.Printf("getDB: %v", err)
+		return nil
+	}
+	return dv.AutoDeployOff()
+}
+
+// sysAutoDeployCmdFunc shows or sets whether pushes of the run tag install
+// the image. Turning auto-deploys off makes them stage-only on every
+// service, e.g. for a freeze or while a CI pipeline misbehaves.
+func (e *ttyExecer) sysAutoDeployCmdFunc(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		if off := e.s.autoDeployOff(); off != nil {
+			e.printf("autodeploy: off, %s\n", ServiceActionDataFromServiceAction(off).Summary(time.Now()))
+		} else {
+			e.printf("autodeploy: on\n")
+		}
+		return nil
+	}
+	var off *db.ServiceAction
+	switch args[0] {
+	case "on":
+	case "off":
+		reason, _ := cmd.Flags().GetString("reason")
+		off = &db.ServiceAction{
+			Action: "turned off",
+			Actor:  e.s.callerName(e.ctx, e.remoteAddr),
+			Reason: reason,
+			Time:   time.Now(),
+		}
+	default:
+		return fmt.Errorf("invalid argument %q, expected on or off", args[0])
+	}
+	if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+		d.AutoDeployOff = off
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to update autodeploy: %w", err)
+	}
+	if off != nil {
+		e.printf("autodeploy: off; pushes of the run tag are only staged\n")
+	} else {
+		e.printf("autodeploy: on\n")
+	}
+	return nil
+}
+
+func (e *ttyExecer) tsDefaultsCmdFunc(cmd *cobra.Command, _ []string) error {
+	if cmd.Flags().Changed("tags") || cmd.Flags().Changed("inherit-host-tags") {
+		if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			if cmd.Flags().Changed("tags") {
+				tags, _ := cmd.Flags().GetStringSlice("tags")
+				d.TSDefaultTags = nil
+				for _, t := range tags {
+					if t == "" {
+						continue
+					}
+					if !strings.HasPrefix(t, "tag:") {
+						return fmt.Errorf("invalid tag %q: must start with \"tag:\"", t)
+					}
+					d.TSDefaultTags = append(d.TSDefaultTags, t)
+				}
+			}
+			if cmd.Flags().Changed("inherit-host-tags") {
+				d.TSInheritHostTags, _ = cmd.Flags().GetBool("inherit-host-tags")
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to update tailscale defaults: %w", err)
+		}
+	}
+	dv, err := e.s.cfg.DB.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get db: %w", err)
+	}
+	tags := "-"
+	if dv.TSDefaultTags().Len() > 0 {
+		tags = strings.Join(dv.TSDefaultTags().AsSlice(), ",")
+	}
+	fmt.Fprintf(e.rw, "tags: %s\ninherit-host-tags: %v\n", tags, dv.TSInheritHostTags())
+	return nil
+}
+
+// uncommitService removes service sn, which had not been committed before
+// its first generation was, and undoes that commit, leaving the service
+// staged as it was before.
+func (e *ttyExecer) uncommitService(sn string) error {
+	sv, err := e.s.serviceView(sn)
+	if err != nil {
+		return err
+	}
+	gen := sv.Generation()
+	if gen == 0 {
+		// The commit failed before it was recorded.
+		return nil
+	}
+	runner, err := e.serviceRunnerFor(sn, e.newCmd)
+	if err != nil {
+		return err
+	}
+	if err := runner.Remove(); err != nil {
+		return err
+	}
+	return e.s.uncommitGen(sn, gen)
+}
+
+// uncommitGen undoes commitGen committing generation gen, the first one, of
+// service sn: the refs it added to its artifacts and images are removed,
+// and the data dir and resource limits it applied are staged again.
+func (s *Server) uncommitGen(sn string, gen int) error {
+	_, _, err := s.cfg.DB.MutateService(sn, func(d *db.Data, sv *db.Service) error {
+		if sv.Generation != gen {
+			return fmt.Errorf("service is at generation %d, expected %d", sv.Generation, gen)
+		}
+		refs := []string{"latest", string(db.Gen(gen))}
+		for _, a := range sv.Artifacts {
+			for _, ref := range refs {
+				delete(a.Refs, db.ArtifactRef(ref))
+			}
+		}
+		for rn, ir := range d.Images {
+			if isn, _, _ := strings.Cut(string(rn), "/"); isn != sn {
+				continue
+			}
+			for _, ref := range refs {
+				delete(ir.Refs, db.ImageRef(ref))
+			}
+		}
+		sv.Generation = 0
+		sv.LatestGeneration = gen - 1
+		if sv.DataDir != "" && sv.StagedDataDir == "" {
+			sv.StagedDataDir, sv.DataDir = sv.DataDir, ""
+		}
+		if sv.Resources != nil && sv.StagedResources == nil {
+			sv.StagedResources, sv.Resources = sv.Resources, nil
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to uncommit generation %d: %w", gen, err)
+	}
+	return nil
+}
+
+// commitResult is the outcome of committing one service in sysCommitCmdFunc.
+type commitResult struct {
+	prevGen int
+	newGen  int
+	err     error
+
+	rolledBack  bool
+	rollbackErr error
+}
+
+// sysCommitCmdFunc commits the staged configuration of multiple services
+// concurrently. In atomic mode, if any service fails all of them are rolled
+// back to the generation they were at before; services that had never been
+// committed are removed and left staged.
+func (e *ttyExecer) sysCommitCmdFunc(cmd *cobra.Command, args []string) error {
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	atomic, _ := cmd.Flags().GetBool("atomic")
+
+	dv, err := e.s.cfg.DB.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get services: %w", err)
+	}
+	services := slices.Compact(slices.Sorted(slices.Values(args)))
+	results := make(map[string]*commitResult, len(services))
+	for _, sn := range services {
+		if sn == SystemService || sn == CatchService {
+			return fmt.Errorf("cannot commit system service %q", sn)
+		}
+		sv, ok := dv.Services().GetOk(sn)
+		if !ok {
+			return fmt.Errorf("unknown service %q", sn)
+		}
+		results[sn] = &commitResult{prevGen: sv.Generation()}
+	}
+
+	width := 0
+	for _, sn := range services {
+		width = max(width, len(sn))
+	}
+	var mu sync.Mutex // serializes writes to e.rw
+	actor := e.s.callerName(e.ctx, e.remoteAddr)
+	installer := func(sn string) (*Installer, error) {
+		w := &prefixWriter{mu: &mu, w: e.rw, prefix: []byte(fmt.Sprintf("%-*s | ", width, sn))}
+		cfg := InstallerCfg{
+			ServiceName: sn,
+			User:        e.user,
+			Actor:       actor,
+			Printer: func(format string, a ...any) {
+				fmt.Fprintf(w, format, a...)
+			},
+			ClientOut: w,
+		}
+		i, err := e.s.NewInstaller(cfg)
+		if err != nil {
+			return nil, err
+		}
+		i.NewCmd = func(name string, args ...string) *exec.Cmd {
+			c := exec.CommandContext(e.ctx, name, args...)
+			c.Stdout = w
+			c.Stderr = w
+			return c
+		}
+		return i, nil
+	}
+
+	var g errgroup.Group
+	if parallel > 0 {
+		g.SetLimit(parallel)
+	}
+	for _, sn := range services {
+		r := results[sn]
+		g.Go(func() error {
+			i, err := installer(sn)
+			if err == nil {
+				err = i.Install()
+			}
+			if err != nil {
+				r.err = err
+				return nil
+			}
+			if sv, err := e.s.serviceView(sn); err == nil {
+				r.newGen = sv.Generation()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	failed := slices.ContainsFunc(services, func(sn string) bool { return results[sn].err != nil })
+	if failed && atomic {
+		for _, sn := range services {
+			r := results[sn]
+			g.Go(func() error {
+				r.rolledBack = true
+				if r.prevGen == 0 {
+					// Nothing to roll back to; remove the new service and
+					// leave it staged instead.
+					r.rollbackErr = e.uncommitService(sn)
+					return nil
+				}
+				i, err := installer(sn)
+				if err == nil {
+					i.icfg.Action = AuditActionRollback
+					i.icfg.Reason = "atomic commit failed"
+					i.icfg.skipApproval = true
+					err = i.InstallGen(r.prevGen)
+				}
+				r.rollbackErr = err
+				return nil
+			})
+		}
+		g.Wait()
+	}
+
+	w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tRESULT\tGENERATION\t")
+	for _, sn := range services {
+		r := results[sn]
+		result, gen := "ok", fmt.Sprintf("%d -> %d", r.prevGen, r.newGen)
+		if r.err != nil {
+			result, gen = "failed: "+r.err.Error(), fmt.Sprint(r.prevGen)
+		}
+		if r.rolledBack {
+			if r.rollbackErr != nil {
+				result += "; rollback failed: " + r.rollbackErr.Error()
+			} else {
+				result += "; rolled back"
+				gen = fmt.Sprint(r.prevGen)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", sn, result, gen)
+	}
+	w.Flush()
+	if failed {
+		return fmt.Errorf("failed to commit all services")
+	}
+	return nil
+}
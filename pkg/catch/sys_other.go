@@ -0,0 +1,39 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package catch
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// dupFile fails where catch doesn't support ptys.
+func dupFile(*os.File) (*os.File, error) {
+	return nil, errors.New("ptys are not supported on this platform")
+}
+
+// setWinsize is a no-op where catch doesn't support ptys.
+func setWinsize(*os.File, int, int) {}
+
+func ttyProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func backgroundProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// TestUncommitGen checks that the rollback of an atomic commit leaves a
+// service that had never been committed staged as it was before.
+func TestUncommitGen(t *testing.T) {
+	const sn = "svc"
+	s := uploadTestServer(t, sn)
+	if _, _, err := s.cfg.DB.MutateService(sn, func(d *db.Data, sv *db.Service) error {
+		sv.ServiceType = db.ServiceTypeDockerCompose
+		sv.Artifacts = db.ArtifactStore{
+			db.ArtifactDockerComposeFile: {Refs: map[db.ArtifactRef]string{"staged": "/compose.yml"}},
+		}
+		sv.StagedDataDir = "/srv/svc"
+		sv.StagedResources = &db.ResourceLimits{CPU: 1}
+		d.Images = map[db.ImageRepoName]*db.ImageRepo{
+			sn + "/app": {Refs: map[db.ImageRef]db.ImageManifest{"staged": {BlobHash: "abc"}}},
+			"other/app": {Refs: map[db.ImageRef]db.ImageManifest{"latest": {BlobHash: "def"}}},
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	si := &Installer{s: s, icfg: InstallerCfg{ServiceName: sn}}
+	if _, _, err := si.commitGen(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.uncommitGen(sn, 2); err == nil {
+		t.Error("uncommitGen of another generation succeeded")
+	}
+	if err := s.uncommitGen(sn, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	dv, err := s.getDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := dv.Services().Get(sn).AsStruct()
+	if sv.Generation != 0 || sv.LatestGeneration != 0 {
+		t.Errorf("generation = %d, latest = %d; want 0, 0", sv.Generation, sv.LatestGeneration)
+	}
+	if got := slices.Sorted(maps.Keys(sv.Artifacts[db.ArtifactDockerComposeFile].Refs)); !slices.Equal(got, []db.ArtifactRef{"staged"}) {
+		t.Errorf("compose file refs = %v, want [staged]", got)
+	}
+	images := dv.AsStruct().Images
+	if got := slices.Sorted(maps.Keys(images[sn+"/app"].Refs)); !slices.Equal(got, []db.ImageRef{"staged"}) {
+		t.Errorf("image refs = %v, want [staged]", got)
+	}
+	if _, ok := images["other/app"].Refs["latest"]; !ok {
+		t.Error("refs of another service's image were removed")
+	}
+	if sv.DataDir != "" || sv.StagedDataDir != "/srv/svc" {
+		t.Errorf("data dir = %q, staged %q; want it staged again", sv.DataDir, sv.StagedDataDir)
+	}
+	if sv.Resources != nil || sv.StagedResources == nil {
+		t.Errorf("resources = %v, staged %v; want them staged again", sv.Resources, sv.StagedResources)
+	}
+
+	// Committing again starts from the first generation.
+	if _, got, err := si.commitGen(0); err != nil {
+		t.Fatal(err)
+	} else if got.Generation != 1 {
+		t.Errorf("generation after recommit = %d, want 1", got.Generation)
+	}
+}
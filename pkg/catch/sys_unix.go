@@ -0,0 +1,55 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package catch
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// dupFile returns a new file for the same open file as f.
+func dupFile(f *os.File) (*os.File, error) {
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
+
+func setWinsize(f *os.File, w, h int) {
+	unix.IoctlSetWinsize(int(f.Fd()), syscall.TIOCSWINSZ, &unix.Winsize{
+		Row: uint16(h),
+		Col: uint16(w),
+	})
+}
+
+// ttyProcAttr returns the attributes of a process run on the pty of a
+// session, making it the controlling terminal of a new session.
+func ttyProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setctty: true,
+		Setsid:  true,
+	}
+}
+
+// backgroundProcAttr returns the attributes of a process that runs in its
+// own process group so that it doesn't try to grab the terminal.
+func backgroundProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
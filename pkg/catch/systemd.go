@@ -21,8 +21,15 @@ import (
 	"log"
 	"os/exec"
 	"strings"
+	"time"
+
+	"tailscale.com/util/mak"
 )
 
+// systemdUnitFailedMessageID is the journal message ID logged when a unit
+// fails. UNIT_RESULT holds the reason, e.g. "watchdog".
+const systemdUnitFailedMessageID = "d9b373ed55a64feb8242e02dbe79a49c"
+
 var systemdMessageIDs = map[string]ComponentStatus{
 	// From https://github.com/systemd/systemd-stable/blob/main/catalog/systemd.catalog.in
 	"7d4958e842da4a758f6c1cdc7b36dcc5": ComponentStatusStarting,
@@ -32,7 +39,7 @@ var systemdMessageIDs = map[string]ComponentStatus{
 
 	"5eb03494b6584870a536b337290809b3": "-", // restart scheduled
 	"98e322203f7a4ed290d09fe03c09fe15": "-", // exited
-	"d9b373ed55a64feb8242e02dbe79a49c": "-", // unit failed
+	systemdUnitFailedMessageID:         "-", // unit failed
 	"be02cf6855d2428ba40df7e9d022f03d": "-", // start job failed
 
 	// ignore
@@ -65,8 +72,9 @@ execLoop:
 		je := json.NewDecoder(stdout)
 		for {
 			var entry struct {
-				Unit      string `json:"UNIT"`
-				MessageID string `json:"MESSAGE_ID"`
+				Unit       string `json:"UNIT"`
+				MessageID  string `json:"MESSAGE_ID"`
+				UnitResult string `json:"UNIT_RESULT"`
 			}
 			if err := je.Decode(&entry); err != nil {
 				if errors.Is(err, io.EOF) {
@@ -78,6 +86,10 @@ execLoop:
 			if entry.MessageID == "" {
 				continue
 			}
+			if entry.MessageID == systemdUnitFailedMessageID && entry.UnitResult == "watchdog" {
+				s.recordWatchdogTrip(entry.Unit)
+				continue
+			}
 			status, ok := systemdMessageIDs[entry.MessageID]
 			if !ok {
 				log.Printf("unknown systemd message id: %+v", entry)
@@ -85,9 +97,11 @@ execLoop:
 			} else if status == "-" {
 				continue
 			}
-			sn, ok := strings.CutSuffix(entry.Unit, ".service")
+			sn, ok := s.externalServiceFor(entry.Unit, "")
 			if !ok {
-				continue
+				if sn, ok = strings.CutSuffix(entry.Unit, ".service"); !ok {
+					continue
+				}
 			}
 			if _, err := s.serviceView(sn); err != nil {
 				if errors.Is(err, errServiceNotFound) {
@@ -111,6 +125,7 @@ execLoop:
 			data := ServiceStatusData{
 				ServiceName: sn,
 				ServiceType: ServiceDataTypeService,
+				Status:      status,
 				ComponentStatus: []ComponentStatusData{
 					{
 						Name:   sn,
@@ -126,3 +141,34 @@ execLoop:
 		}
 	}
 }
+
+// recordWatchdogTrip records that the systemd watchdog killed unit and
+// publishes an event for it.
+func (s *Server) recordWatchdogTrip(unit string) {
+	sn, ok := strings.CutSuffix(unit, ".service")
+	if !ok {
+		return
+	}
+	if _, err := s.serviceView(sn); err != nil {
+		return
+	}
+	now := time.Now()
+	s.serviceStatus.mu.Lock()
+	mak.Set(&s.serviceStatus.watchdogTrips, sn, now)
+	s.serviceStatus.mu.Unlock()
+	log.Printf("Service %q watchdog timeout", unit)
+
+	s.PublishEvent(Event{
+		Type:        EventTypeServiceWatchdog,
+		ServiceName: sn,
+	})
+}
+
+// lastWatchdogTrip returns the time of the last watchdog trip of sn since catch
+// started.
+func (s *Server) lastWatchdogTrip(sn string) (time.Time, bool) {
+	s.serviceStatus.mu.Lock()
+	defer s.serviceStatus.mu.Unlock()
+	t, ok := s.serviceStatus.watchdogTrips[sn]
+	return t, ok
+}
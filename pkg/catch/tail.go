@@ -0,0 +1,159 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"slices"
+	"sync"
+
+	"github.com/yeetrun/yeet/pkg/svc"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// tailColors are the ANSI colors used to prefix log lines, one per service.
+var tailColors = []string{"31", "32", "33", "34", "35", "36", "91", "92", "93", "94", "95", "96"}
+
+// tailCmdFunc streams the logs of multiple services over a single session,
+// prefixing each line with the name of the service it came from.
+func (e *ttyExecer) tailCmdFunc(cmd *cobra.Command, args []string) error {
+	group, _ := cmd.Flags().GetString("group")
+	labels, _ := cmd.Flags().GetStringArray("label")
+	follow, _ := cmd.Flags().GetBool("follow")
+	lines, _ := cmd.Flags().GetInt("lines")
+
+	services, err := e.tailServices(group, labels, args)
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("no services to tail")
+	}
+	width := 0
+	for _, sn := range services {
+		width = max(width, len(sn))
+	}
+
+	var mu sync.Mutex // serializes writes to e.rw
+	var g errgroup.Group
+	for i, sn := range services {
+		prefix := fmt.Sprintf("%-*s | ", width, sn)
+		if e.isPty {
+			prefix = fmt.Sprintf("\x1b[%sm%s\x1b[0m", tailColors[i%len(tailColors)], prefix)
+		}
+		w := &prefixWriter{mu: &mu, w: e.rw, prefix: []byte(prefix)}
+		runner, err := e.serviceRunnerFor(sn, func(name string, args ...string) *exec.Cmd {
+			c := exec.CommandContext(e.ctx, name, args...)
+			c.Stdout = w
+			c.Stderr = w
+			c.SysProcAttr = backgroundProcAttr()
+			return c
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get service runner for %q: %w", sn, err)
+		}
+		g.Go(func() error {
+			defer w.Flush()
+			if err := runner.Logs(&svc.LogOptions{Follow: follow, Lines: lines}); err != nil && e.ctx.Err() == nil {
+				return fmt.Errorf("%s: %w", sn, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// tailServices returns the sorted list of services to tail: the services
+// named in args plus, if group or labels are set, all services whose name
+// matches the glob pattern group and whose labels match all "key=value" or
+// "key" selectors in labels.
+func (e *ttyExecer) tailServices(group string, labels, args []string) ([]string, error) {
+	dv, err := e.s.cfg.DB.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get services: %w", err)
+	}
+	var services []string
+	for _, sn := range args {
+		if !dv.Services().Contains(sn) {
+			return nil, fmt.Errorf("unknown service %q", sn)
+		}
+		services = append(services, sn)
+	}
+	if group != "" || len(labels) > 0 {
+		if _, err := path.Match(group, ""); err != nil {
+			return nil, fmt.Errorf("invalid group pattern %q: %w", group, err)
+		}
+		f := catalogFilter{Labels: labels}
+		for sn, sv := range dv.Services().All() {
+			if sn == SystemService || sn == CatchService {
+				continue
+			}
+			if ok, _ := path.Match(group, sn); group != "" && !ok {
+				continue
+			}
+			if f.match(sv) {
+				services = append(services, sn)
+			}
+		}
+	}
+	slices.Sort(services)
+	return slices.Compact(services), nil
+}
+
+// prefixWriter is an io.Writer that prefixes each line written to w with
+// prefix. Complete lines are written to w atomically while holding mu so that
+// lines from multiple writers sharing w are not interleaved.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	i := bytes.LastIndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+	var out []byte
+	for _, line := range bytes.SplitAfter(p.buf[:i+1], []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		out = append(out, p.prefix...)
+		out = append(out, line...)
+	}
+	p.buf = append(p.buf[:0], p.buf[i+1:]...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush writes any buffered partial line to w.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) == 0 {
+		return
+	}
+	p.Write([]byte("\n"))
+}
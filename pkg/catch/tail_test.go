@@ -0,0 +1,77 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+func TestTailServices(t *testing.T) {
+	s := uploadTestServer(t, "api-prod")
+	labels := map[string]map[string]string{
+		"api-prod":   {"env": "prod", "tier": "web"},
+		"api-dev":    {"env": "dev", "tier": "web"},
+		"db-prod":    {"env": "prod"},
+		"worker":     nil,
+		CatchService: {"env": "prod"},
+	}
+	for sn, l := range labels {
+		if _, _, err := s.cfg.DB.MutateService(sn, func(_ *db.Data, sv *db.Service) error {
+			sv.Labels = l
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := &ttyExecer{s: s}
+
+	tests := []struct {
+		name   string
+		group  string
+		labels []string
+		args   []string
+		want   []string
+	}{
+		{name: "args", args: []string{"worker", "api-dev"}, want: []string{"api-dev", "worker"}},
+		{name: "group", group: "api-*", want: []string{"api-dev", "api-prod"}},
+		{name: "label", labels: []string{"env=prod"}, want: []string{"api-prod", "db-prod"}},
+		{name: "bare-label", labels: []string{"tier"}, want: []string{"api-dev", "api-prod"}},
+		{name: "all-labels", labels: []string{"env=prod", "tier=web"}, want: []string{"api-prod"}},
+		{name: "group-and-label", group: "db-*", labels: []string{"env=prod"}, want: []string{"db-prod"}},
+		{name: "label-and-args", labels: []string{"env=dev"}, args: []string{"worker"}, want: []string{"api-dev", "worker"}},
+		{name: "no-match", labels: []string{"env=staging"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.tailServices(tt.group, tt.labels, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tailServices = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := e.tailServices("", nil, []string{"missing"}); err == nil {
+		t.Error("tailServices with an unknown service succeeded")
+	}
+	if _, err := e.tailServices("[", nil, nil); err == nil {
+		t.Error("tailServices with an invalid pattern succeeded")
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/blake2b"
+	"tailscale.com/util/mak"
+)
+
+// Content trust: services with RequireSigned set only accept files signed
+// with minisign and images signed with cosign by one of the keys added with
+// `trust add-key`. It is turned on with --require-signed and only turned off
+// with `trust require <svc> off`, so that a deploy can't turn it off for
+// itself.
+//
+// The minisign signature of a file is uploaded to stage/sig before the file
+// itself, as `yeet run` and `yeet stage` do for <file>.minisig, and is used up
+// by the next file staged or installed. Files staged without a verified
+// signature are recorded as the ArtifactUnsigned of their generation, which
+// is then never installed while signatures are required.
+//
+// Cosign signatures are pushed to the internal registry by `cosign sign`,
+// under the sha256-<digest>.sig tag of the image repo. An unsigned image
+// pushed to a tag is refused but kept by digest, so that it can be signed
+// with `cosign sign <repo>@<digest>` and pushed to the tag again.
+
+// signaturePath returns the path of the signature uploaded for the next file
+// of service sn.
+func (s *Server) signaturePath(sn string) string {
+	return filepath.Join(s.serviceBinDir(sn), "next.minisig")
+}
+
+// requiresSigned reports whether the artifacts of service sn must be signed.
+func (s *Server) requiresSigned(sn string) bool {
+	sv, err := s.serviceView(sn)
+	return err == nil && sv.RequireSigned()
+}
+
+// checkGenerationSigned returns an error if service sn requires signed
+// artifacts and generation gen, or the staged one if gen is 0, has a file
+// staged without a signature or an image not signed by a trusted key.
+func (s *Server) checkGenerationSigned(sn string, gen int) error {
+	dv, err := s.getDB()
+	if err != nil {
+		return err
+	}
+	sv, ok := dv.Services().GetOk(sn)
+	if !ok || !sv.RequireSigned() {
+		return nil
+	}
+	ref, name := db.ArtifactRef("staged"), "the staged generation"
+	if gen != 0 {
+		ref, name = db.Gen(gen), fmt.Sprintf("generation %d", gen)
+	}
+	if af, ok := sv.Artifacts().GetOk(db.ArtifactUnsigned); ok {
+		if _, ok := af.Refs().GetOk(ref); ok {
+			return fmt.Errorf("service %q requires signed files but %s was staged without a signature", sn, name)
+		}
+	}
+	for rn, ir := range dv.Images().All() {
+		if repoSvc, _, _ := strings.Cut(string(rn), "/"); repoSvc != sn {
+			continue
+		}
+		m, ok := ir.Refs().GetOk(db.ImageRef(ref))
+		if !ok {
+			continue
+		}
+		if err := s.registry.verifyImageSignature(string(rn), m.BlobHash); err != nil {
+			return fmt.Errorf("service %q requires signed images but %s has an unsigned image: %w", sn, name, err)
+		}
+	}
+	return nil
+}
+
+// parseTrustedKey parses a minisign public key, with or without its comment
+// line, or a PEM encoded cosign public key.
+func parseTrustedKey(text string) (db.TrustedKey, error) {
+	text = strings.TrimSpace(text)
+	if blk, _ := pem.Decode([]byte(text)); blk != nil {
+		pub, err := x509.ParsePKIXPublicKey(blk.Bytes)
+		if err != nil {
+			return db.TrustedKey{}, fmt.Errorf("invalid cosign public key: %w", err)
+		}
+		switch pub.(type) {
+		case *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return db.TrustedKey{}, fmt.Errorf("unsupported cosign key type %T", pub)
+		}
+		return db.TrustedKey{Type: db.TrustedKeyCosign, Key: string(pem.EncodeToMemory(blk))}, nil
+	}
+	var key string
+	for line := range strings.Lines(text) {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			key = line
+			break
+		}
+	}
+	if _, _, err := parseMinisignKey(key); err != nil {
+		return db.TrustedKey{}, err
+	}
+	return db.TrustedKey{Type: db.TrustedKeyMinisign, Key: key}, nil
+}
+
+// parseMinisignKey returns the key ID and ed25519 key of the base64 encoded
+// minisign public key.
+func parseMinisignKey(key string) (id []byte, pub ed25519.PublicKey, _ error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(b) != 2+8+ed25519.PublicKeySize || string(b[:2]) != "Ed" {
+		return nil, nil, errors.New("invalid minisign public key")
+	}
+	return b[2:10], ed25519.PublicKey(b[10:]), nil
+}
+
+// verifyMinisign verifies that sig, the contents of a .minisig file, is a
+// signature of the file at p by one of keys.
+func verifyMinisign(keys []db.TrustedKey, p string, sig []byte) error {
+	var lines []string
+	for line := range strings.Lines(string(sig)) {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid minisign signature")
+	}
+	sb, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sb) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return errors.New("invalid minisign signature")
+	}
+	alg, keyID, s := string(sb[:2]), sb[2:10], sb[10:]
+
+	var msg []byte
+	switch alg {
+	case "ED":
+		// Signatures of files are made over their BLAKE2b-512 hash by
+		// default.
+		h, _ := blake2b.New512(nil)
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		msg = h.Sum(nil)
+	case "Ed":
+		if msg, err = os.ReadFile(p); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", alg)
+	}
+	for _, k := range keys {
+		id, pub, err := parseMinisignKey(k.Key)
+		if k.Type != db.TrustedKeyMinisign || err != nil || !bytes.Equal(id, keyID) {
+			continue
+		}
+		if !ed25519.Verify(pub, msg, s) {
+			return errors.New("minisign signature does not match the file")
+		}
+		tc := strings.TrimPrefix(lines[2], "trusted comment: ")
+		if !ed25519.Verify(pub, append(slices.Clip(s), tc...), global) {
+			return errors.New("minisign trusted comment signature is invalid")
+		}
+		return nil
+	}
+	return fmt.Errorf("file is signed by minisign key %X, which is not trusted", reverse(keyID))
+}
+
+// reverse returns the bytes of b in reverse order, as minisign prints key IDs
+// little-endian.
+func reverse(b []byte) []byte {
+	r := slices.Clone(b)
+	slices.Reverse(r)
+	return r
+}
+
+// verifyFileSignature checks that the file at p, about to be staged for
+// service sn, is signed if required. It uses up the signature uploaded for
+// the file.
+func (s *Server) verifyFileSignature(sn, p string, required bool) error {
+	sigPath := s.signaturePath(sn)
+	defer os.Remove(sigPath)
+	if !required {
+		return nil
+	}
+	sig, err := os.ReadFile(sigPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("service %q requires signed files but no signature was uploaded; sign the file with minisign and deploy it with its .minisig next to it", sn)
+	} else if err != nil {
+		return err
+	}
+	dv, err := s.getDB()
+	if err != nil {
+		return err
+	}
+	keys := slices.Collect(maps.Values(dv.TrustedKeys().AsMap()))
+	if err := verifyMinisign(keys, p, sig); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+	return nil
+}
+
+// cosignSignatureTag returns the tag cosign pushes the signatures of the
+// manifest with hash mh to.
+func cosignSignatureTag(mh string) string {
+	return "sha256-" + mh + ".sig"
+}
+
+// isCosignSignatureTag reports whether tag is the tag of cosign signatures.
+func isCosignSignatureTag(tag string) bool {
+	return strings.HasPrefix(tag, "sha256-") && strings.HasSuffix(tag, ".sig")
+}
+
+// cosignPayload is the payload cosign signs for an image.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifyImageSignature checks that the manifest with hash mh in repo has a
+// cosign signature by one of the trusted keys.
+func (cr *containerRegistry) verifyImageSignature(repo, mh string) error {
+	dv, err := cr.s.getDB()
+	if err != nil {
+		return err
+	}
+	ir, ok := dv.Images().GetOk(db.ImageRepoName(repo))
+	if !ok {
+		return fmt.Errorf("no repo %q", repo)
+	}
+	ref, ok := ir.Refs().GetOk(db.ImageRef(cosignSignatureTag(mh)))
+	if !ok {
+		return fmt.Errorf("%s@sha256:%s is not signed; sign it with cosign first", repo, mh)
+	}
+	b, err := cr.readManifest(ref.BlobHash)
+	if err != nil {
+		return err
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("invalid signature manifest: %w", err)
+	}
+	var keys []any
+	for _, k := range dv.TrustedKeys().All() {
+		if k.Type != db.TrustedKeyCosign {
+			continue
+		}
+		if blk, _ := pem.Decode([]byte(k.Key)); blk != nil {
+			if pub, err := x509.ParsePKIXPublicKey(blk.Bytes); err == nil {
+				keys = append(keys, pub)
+			}
+		}
+	}
+	for _, l := range m.Layers {
+		sig, err := base64.StdEncoding.DecodeString(l.Annotations["dev.cosignproject.cosign/signature"])
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+		payload, err := os.ReadFile(cr.blobPath(l.Digest))
+		if err != nil {
+			continue
+		}
+		var p cosignPayload
+		if err := json.Unmarshal(payload, &p); err != nil || p.Critical.Image.DockerManifestDigest != "sha256:"+mh {
+			continue
+		}
+		digest := sha256.Sum256(payload)
+		for _, pub := range keys {
+			switch pub := pub.(type) {
+			case *ecdsa.PublicKey:
+				if ecdsa.VerifyASN1(pub, digest[:], sig) {
+					return nil
+				}
+			case ed25519.PublicKey:
+				if ed25519.Verify(pub, payload, sig) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%s@sha256:%s is not signed by a trusted cosign key", repo, mh)
+}
+
+// trustCmdFunc manages the keys signatures are verified against.
+func (e *ttyExecer) trustCmdFunc(cmd *cobra.Command, args []string) error {
+	switch cmd.CalledAs() {
+	case "add-key":
+		if len(args) == 0 {
+			return errors.New("missing key name")
+		}
+		name := args[0]
+		var text string
+		if len(args) > 1 {
+			text = strings.Join(args[1:], "\n")
+		} else {
+			b, err := io.ReadAll(io.LimitReader(e.rw, 64<<10))
+			if err != nil {
+				return fmt.Errorf("failed to read key: %w", err)
+			}
+			text = string(b)
+		}
+		k, err := parseTrustedKey(text)
+		if err != nil {
+			return err
+		}
+		k.Added = time.Now()
+		if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			if _, ok := d.TrustedKeys[name]; ok {
+				return fmt.Errorf("key %q already exists; remove it first", name)
+			}
+			mak.Set(&d.TrustedKeys, name, k)
+			return nil
+		}); err != nil {
+			return err
+		}
+		e.printf("Added %s key %q\n", k.Type, name)
+		return nil
+	case "rm":
+		if len(args) != 1 {
+			return errors.New("expected the name of the key")
+		}
+		if _, err := e.s.cfg.DB.MutateData(func(d *db.Data) error {
+			if _, ok := d.TrustedKeys[args[0]]; !ok {
+				return fmt.Errorf("no key %q", args[0])
+			}
+			delete(d.TrustedKeys, args[0])
+			return nil
+		}); err != nil {
+			return err
+		}
+		e.printf("Removed key %q\n", args[0])
+		return nil
+	case "require":
+		if len(args) == 0 {
+			return errors.New("missing service name")
+		}
+		sn := args[0]
+		sv, err := e.s.serviceView(sn)
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			e.printf("require-signed: %v\n", sv.RequireSigned())
+			return nil
+		}
+		var on bool
+		switch args[1] {
+		case "on":
+			on = true
+		case "off":
+		default:
+			return fmt.Errorf("invalid argument %q, expected on or off", args[1])
+		}
+		if _, _, err := e.s.cfg.DB.MutateService(sn, func(_ *db.Data, s *db.Service) error {
+			s.RequireSigned = on
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to update service: %w", err)
+		}
+		e.printf("require-signed: %v\n", on)
+		return nil
+	case "list", "trust":
+		dv, err := e.s.getDB()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+		defer w.Flush()
+		fmt.Fprintln(w, "NAME\tTYPE\tADDED\t")
+		for _, name := range slices.Sorted(maps.Keys(dv.TrustedKeys().AsMap())) {
+			k := dv.TrustedKeys().Get(name)
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", name, k.Type, k.Added.Format(time.DateTime))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown trust command %q", cmd.CalledAs())
+}
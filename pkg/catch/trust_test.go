@@ -0,0 +1,254 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"golang.org/x/crypto/blake2b"
+	"tailscale.com/util/mak"
+)
+
+// minisignKey returns a new minisign key pair, the public key as trusted.
+func minisignKey(t *testing.T) (db.TrustedKey, []byte, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	key := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...))
+	return db.TrustedKey{Type: db.TrustedKeyMinisign, Key: key}, id, priv
+}
+
+// minisign returns a prehashed minisign signature of b, as `minisign -S`
+// makes them.
+func minisign(id []byte, priv ed25519.PrivateKey, b []byte, comment string) []byte {
+	h := blake2b.Sum512(b)
+	sig := ed25519.Sign(priv, h[:])
+	global := ed25519.Sign(priv, append(sig, comment...))
+	return fmt.Appendf(nil, "untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("ED"), id...), sig...)),
+		comment,
+		base64.StdEncoding.EncodeToString(global))
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	key, id, priv := minisignKey(t)
+	other, otherID, otherPriv := minisignKey(t)
+	p := filepath.Join(t.TempDir(), "bin")
+	contents := []byte("#!/bin/sh\necho hi\n")
+	if err := os.WriteFile(p, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sig := minisign(id, priv, contents, "timestamp:1 file:bin")
+
+	if err := verifyMinisign([]db.TrustedKey{other, key}, p, sig); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := verifyMinisign([]db.TrustedKey{other}, p, sig); err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("signature by untrusted key = %v, want not trusted", err)
+	}
+	if err := verifyMinisign([]db.TrustedKey{key}, p, minisign(id, otherPriv, contents, "x")); err == nil {
+		t.Error("signature by another key with the same key ID verified")
+	}
+	if err := verifyMinisign([]db.TrustedKey{key, other}, p, minisign(otherID, otherPriv, []byte("other file"), "x")); err == nil {
+		t.Error("signature of another file verified")
+	}
+	tampered := strings.Replace(string(sig), "file:bin", "file:evil", 1)
+	if err := verifyMinisign([]db.TrustedKey{key}, p, []byte(tampered)); err == nil {
+		t.Error("signature with a tampered trusted comment verified")
+	}
+	if err := verifyMinisign([]db.TrustedKey{key}, p, []byte("untrusted comment: x\n")); err == nil {
+		t.Error("truncated signature verified")
+	}
+}
+
+// testRegistry returns a registry of a server with an empty DB, rooted in a
+// temporary directory.
+func testRegistry(t *testing.T) *containerRegistry {
+	t.Helper()
+	dir := t.TempDir()
+	s := &Server{cfg: Config{
+		DB:           db.NewStore(filepath.Join(dir, "db.json"), filepath.Join(dir, "services")),
+		RegistryRoot: filepath.Join(dir, "registry"),
+	}}
+	cr := &containerRegistry{s: s, manifestDir: filepath.Join(dir, "registry", "manifests")}
+	s.registry = cr
+	for _, d := range []string{filepath.Join(cr.manifestDir, "sha256"), filepath.Join(dir, "registry", "blobs", "sha256")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cr
+}
+
+// cosignSign stores a cosign signature of the manifest with hash mh in repo
+// by key, as `cosign sign` pushes it.
+func cosignSign(t *testing.T, cr *containerRegistry, repo, mh string, key *ecdsa.PrivateKey) {
+	t.Helper()
+	var p cosignPayload
+	p.Critical.Image.DockerManifestDigest = "sha256:" + mh
+	payload, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph := v1.Hash{Algorithm: "sha256", Hex: fmt.Sprintf("%x", digest)}
+	if err := os.WriteFile(cr.blobPath(ph), payload, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := json.Marshal(v1.Manifest{
+		SchemaVersion: 2,
+		Config:        v1.Descriptor{Digest: ph, Size: int64(len(payload))},
+		Layers: []v1.Descriptor{{
+			Digest:      ph,
+			Size:        int64(len(payload)),
+			Annotations: map[string]string{"dev.cosignproject.cosign/signature": base64.StdEncoding.EncodeToString(sig)},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := cr.storeManifest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cr.s.cfg.DB.MutateData(func(d *db.Data) error {
+		ir := d.Images[db.ImageRepoName(repo)]
+		if ir == nil {
+			ir = &db.ImageRepo{Refs: map[db.ImageRef]db.ImageManifest{}}
+			mak.Set(&d.Images, db.ImageRepoName(repo), ir)
+		}
+		ir.Refs[db.ImageRef(cosignSignatureTag(mh))] = db.ImageManifest{BlobHash: sh}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cosignKey returns a new cosign key pair, the public key as trusted.
+func cosignKey(t *testing.T) (db.TrustedKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := parseTrustedKey(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, priv
+}
+
+func TestVerifyImageSignature(t *testing.T) {
+	cr := testRegistry(t)
+	key, priv := cosignKey(t)
+	_, otherPriv := cosignKey(t)
+	if _, err := cr.s.cfg.DB.MutateData(func(d *db.Data) error {
+		mak.Set(&d.TrustedKeys, "ci", key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	const repo = "web/app"
+	signed, unsigned, other := strings.Repeat("a", 64), strings.Repeat("b", 64), strings.Repeat("c", 64)
+	cosignSign(t, cr, repo, signed, priv)
+	cosignSign(t, cr, repo, other, otherPriv)
+
+	if err := cr.verifyImageSignature(repo, signed); err != nil {
+		t.Errorf("signed image: %v", err)
+	}
+	if err := cr.verifyImageSignature(repo, unsigned); err == nil || !strings.Contains(err.Error(), "is not signed") {
+		t.Errorf("unsigned image = %v, want not signed", err)
+	}
+	if err := cr.verifyImageSignature(repo, other); err == nil || !strings.Contains(err.Error(), "not signed by a trusted") {
+		t.Errorf("image signed by untrusted key = %v, want not signed by a trusted key", err)
+	}
+	if err := cr.verifyImageSignature("api/app", signed); err == nil {
+		t.Error("signature of another repo verified")
+	}
+}
+
+func TestCheckGenerationSigned(t *testing.T) {
+	cr := testRegistry(t)
+	s := cr.s
+	if _, _, err := s.cfg.DB.MutateService("web", func(_ *db.Data, sv *db.Service) error {
+		sv.RequireSigned = true
+		sv.Artifacts = db.ArtifactStore{
+			db.ArtifactBinary:   {Refs: map[db.ArtifactRef]string{"staged": "/b3", db.Gen(1): "/b1", db.Gen(2): "/b2"}},
+			db.ArtifactUnsigned: {Refs: map[db.ArtifactRef]string{db.Gen(2): "/b2"}},
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkGenerationSigned("web", 1); err != nil {
+		t.Errorf("signed generation: %v", err)
+	}
+	if err := s.checkGenerationSigned("web", 0); err != nil {
+		t.Errorf("signed staged generation: %v", err)
+	}
+	if err := s.checkGenerationSigned("web", 2); err == nil {
+		t.Error("unsigned generation passed the check")
+	}
+
+	// Images of the generation must be signed too.
+	if _, err := s.cfg.DB.MutateData(func(d *db.Data) error {
+		mak.Set(&d.Images, "web/app", &db.ImageRepo{Refs: map[db.ImageRef]db.ImageManifest{
+			db.ImageRef(db.Gen(1)): {BlobHash: strings.Repeat("a", 64)},
+		}})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkGenerationSigned("web", 1); err == nil {
+		t.Error("generation with an unsigned image passed the check")
+	}
+
+	if _, _, err := s.cfg.DB.MutateService("web", func(_ *db.Data, sv *db.Service) error {
+		sv.RequireSigned = false
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkGenerationSigned("web", 2); err != nil {
+		t.Errorf("service not requiring signatures: %v", err)
+	}
+}
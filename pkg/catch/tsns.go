@@ -21,10 +21,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/Masterminds/semver/v3"
@@ -191,6 +193,24 @@ func generateTailscaleAuthKey(ctx context.Context, tags []string) (string, error
 	return authkey, nil
 }
 
+// serviceTSTags returns the tags to use for a service's tailscale node: the
+// host-wide default tags, the host's own tags if TSInheritHostTags is set, and
+// the explicitly requested tags.
+func (s *Server) serviceTSTags(ctx context.Context, dv db.DataView, requested []string) []string {
+	tags := dv.TSDefaultTags().AsSlice()
+	if dv.TSInheritHostTags() && s.cfg.LocalClient != nil {
+		st, err := s.cfg.LocalClient.StatusWithoutPeers(ctx)
+		if err != nil {
+			log.Printf("failed to get host tags: %v", err)
+		} else if st.Self.Tags != nil {
+			tags = append(tags, st.Self.Tags.AsSlice()...)
+		}
+	}
+	tags = append(tags, requested...)
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
 func (s *Server) getTailscaleAuthKey(ctx context.Context, tags []string) (string, error) {
 	return generateTailscaleAuthKey(ctx, tags)
 }
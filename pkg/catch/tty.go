@@ -22,16 +22,16 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"os"
 	"os/exec"
+	"net/netip"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"runtime/debug"
 	"slices"
 	"strconv"
 	"strings"
-	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -43,8 +43,8 @@ import (
 	"github.com/yeetrun/yeet/pkg/svc"
 	"github.com/creack/pty"
 	"github.com/spf13/cobra"
-	"golang.org/x/sys/unix"
 	gssh "tailscale.com/tempfork/gliderlabs/ssh"
+	"tailscale.com/types/ptr"
 	"tailscale.com/util/mak"
 )
 
@@ -73,8 +73,19 @@ type ttyExecer struct {
 	ptyReq    gssh.Pty
 	ptyWCh    <-chan gssh.Window
 
+	// remoteAddr is the address of the caller, used to attribute actions.
+	remoteAddr string
+	// clientSession identifies the yeet command the session is part of, as
+	// one yeet command may run several, so that the host banner is shown
+	// once for all of them. It is empty for other clients.
+	clientSession string
+
 	// Assigned during run
 	rw io.ReadWriter // May be a pty
+	// stageDefaultsApplied records that applyStageDefaults applied the
+	// host's stage defaults to the flags, for the installer to record it in
+	// the service.
+	stageDefaultsApplied bool
 }
 
 func (e *ttyExecer) run() error {
@@ -87,14 +98,13 @@ func (e *ttyExecer) run() error {
 			fmt.Fprintf(e.rw, "Error: %v\n", err)
 			return err
 		}
-		dup, err := syscall.Dup(int(stdin.Fd()))
+		stdout, err := dupFile(stdin)
 		if err != nil {
 			stdin.Close()
 			tty.Close()
 			log.Printf("Error duping pty: %v", err)
 			return err
 		}
-		stdout := os.NewFile(uintptr(dup), stdin.Name())
 
 		e.rw = tty
 		closer = tty
@@ -169,33 +179,82 @@ func (e *ttyExecer) runE(cmd *cobra.Command, args []string) error {
 		c = c.Parent()
 		subCmdCalledAs = c.Use
 	}
+	e.printNotices(cmd, subCmdCalledAs)
 
 	switch subCmdCalledAs {
+	case "build":
+		return e.buildCmdFunc(cmd, args)
+	case "convert":
+		return e.convertCmdFunc(cmd, args)
 	case "cron":
 		cronexpr := strings.Join(args[0:5], " ")
 		return e.cronCmdFunc(cmd, cronexpr, args[5:])
+	case "diff":
+		return e.diffCmdFunc(cmd, args)
 	case "disable":
 		return e.disableCmdFunc(cmd, args)
 	case "edit":
 		return e.editCmdFunc(cmd, args)
+	case "generations":
+		return e.generationsCmdFunc(cmd, args)
+	case "health":
+		return e.healthCmdFunc(cmd, args)
+	case "exec":
+		return e.execCmdFunc(cmd, args)
+	case "audit":
+		return e.auditCmdFunc(cmd, args)
+	case "lint":
+		return e.lintCmdFunc(cmd, args)
 	case "events":
 		return e.eventsCmdFunc(cmd, args)
+	case "external":
+		return e.externalCmdFunc(cmd, args)
 	case "enable":
 		return e.enableCmdFunc(cmd, args)
+	case "approve", "deny":
+		return e.approveCmdFunc(cmd, args)
+	case "protect":
+		return e.protectCmdFunc(cmd, args)
 	case "mount":
 		return e.mountCmdFunc(cmd, args)
+	case "image":
+		return e.imageCmdFunc(cmd, args)
+	case "images":
+		return e.imagesCmdFunc(cmd, args)
+	case "secret":
+		return e.secretCmdFunc(cmd, args)
+	case "share":
+		return e.shareCmdFunc(cmd, args)
 	case "ip":
 		return e.ipCmdFunc(cmd, args)
+	case "trust":
+		return e.trustCmdFunc(cmd, args)
+	case "block-sums":
+		return e.blockSumsCmdFunc(cmd, args)
+	case "upload":
+		return e.uploadCmdFunc(cmd, args)
 	case "ts":
 		return e.tsCmdFunc(cmd, args)
 	case "umount":
 		return e.umountCmdFunc(cmd, args)
 	case "env":
 		return e.envCmdFunc(cmd, args)
+	case "label":
+		return e.labelCmdFunc(cmd, args)
+	case "ls":
+		return e.lsCmdFunc(cmd, args)
 	case "logs":
 		return e.logsCmdFunc(cmd, args)
+	case "net":
+		return e.netCmdFunc(cmd, args)
 	case "remove":
 		return e.removeCmdFunc(cmd, args)
+	case "quadlet":
+		return e.quadletCmdFunc(cmd, args)
+	case "runtime":
+		return e.runtimeCmdFunc(cmd, args)
+	case "registry":
+		return e.registryCmdFunc(cmd, args)
 	case "restart":
 		return e.restartCmdFunc(cmd, args)
 	case "rollback":
@@ -210,6 +269,16 @@ func (e *ttyExecer) runE(cmd *cobra.Command, args []string) error {
 		return e.statusCmdFunc(cmd, args)
 	case "stop":
 		return e.stopCmdFunc(cmd, args)
+	case "sys", "gc":
+		return e.sysCmdFunc(cmd, args)
+	case "top":
+		return e.topCmdFunc(cmd, args)
+	case "tail":
+		return e.tailCmdFunc(cmd, args)
+	case "template":
+		return e.templateCmdFunc(cmd, args)
+	case "undelete":
+		return e.undeleteCmdFunc(cmd, args)
 	case "version":
 		j, _ := cmd.Flags().GetBool("json")
 		if j {
@@ -278,14 +347,19 @@ func makePadding(oldLen, newLen int) string {
 	return ""
 }
 
+// Progress of uploads is updated in place every progressInterval on a pty.
+// Other sessions, like CI jobs, get a line every progressLogInterval instead,
+// so that carriage returns don't garble their logs.
+const (
+	progressInterval    = 250 * time.Millisecond
+	progressLogInterval = 5 * time.Second
+)
+
 // install installs a service by reading the binary from the `in` input stream.
 // The service is configured via `cfg`, an InstallerCfg struct. Client output
-// can be written to `out`. An error is returned if the installation fails.
-func (e *ttyExecer) install(in io.Reader, cfg FileInstallerCfg) error {
-	if runtime.GOOS == "darwin" {
-		// Don't do anything on macOS yet.
-		return nil
-	}
+// can be written to `out`. Unless noProgress is set, the progress of the
+// upload is printed. An error is returned if the installation fails.
+func (e *ttyExecer) install(in io.Reader, cfg FileInstallerCfg, noProgress bool) error {
 	e.printf("Installing service %q\n", e.sn)
 
 	inst, err := NewFileInstaller(e.s, cfg)
@@ -314,29 +388,8 @@ func (e *ttyExecer) install(in io.Reader, cfg FileInstallerCfg) error {
 				}
 				return
 			}
-
-			// Keep track of the longest printed string length
-			var lastPrintedLen int
-
-			print := func() {
-				humanReadable := fmt.Sprintf("\rReceived: %s\tRate: %s/s", humanReadableBytes(inst.Received()), humanReadableBytes(inst.Rate()))
-				ln := len(humanReadable)
-				e.printf("%s%s", humanReadable, makePadding(lastPrintedLen, ln))
-
-				lastPrintedLen = ln
-			}
-
-			for {
-				select {
-				case <-e.ctx.Done():
-					return
-				case <-done:
-					print()
-					e.printf("\n")
-					return
-				case <-time.After(100 * time.Millisecond):
-					print()
-				}
+			if !noProgress {
+				e.printProgress(inst, done)
 			}
 		}()
 		if _, err := io.CopyN(inst, in, 1); err != nil {
@@ -357,6 +410,50 @@ func (e *ttyExecer) install(in io.Reader, cfg FileInstallerCfg) error {
 	return nil
 }
 
+// printProgress prints how much inst received until done is closed.
+func (e *ttyExecer) printProgress(inst *FileInstaller, done <-chan struct{}) {
+	status := func() string {
+		return fmt.Sprintf("Received: %s\tRate: %s/s", humanReadableBytes(inst.Received()), humanReadableBytes(inst.Rate()))
+	}
+	if !e.isPty {
+		for {
+			select {
+			case <-e.ctx.Done():
+				return
+			case <-done:
+				e.printf("%s\n", status())
+				return
+			case <-time.After(progressLogInterval):
+				e.printf("%s\n", status())
+			}
+		}
+	}
+
+	// Keep track of the longest printed string length
+	var lastPrintedLen int
+
+	print := func() {
+		humanReadable := "\r" + status()
+		ln := len(humanReadable)
+		e.printf("%s%s", humanReadable, makePadding(lastPrintedLen, ln))
+
+		lastPrintedLen = ln
+	}
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-done:
+			print()
+			e.printf("\n")
+			return
+		case <-time.After(progressInterval):
+			print()
+		}
+	}
+}
+
 func (e *ttyExecer) printf(format string, a ...any) {
 	fmt.Fprintf(e.rw, format, a...)
 }
@@ -367,6 +464,60 @@ func (e *ttyExecer) fileInstaller(cmd *cobra.Command, argsIn []string) FileInsta
 		args = argsIn
 	}
 	ic := e.installerCfg()
+	if cmd.Flags().Changed("if-generation") {
+		gen, _ := cmd.Flags().GetInt("if-generation")
+		ic.IfGeneration = &gen
+	}
+	ic.RollbackGrace, _ = cmd.Flags().GetDuration("rollback-grace")
+	var needs []string
+	if cmd.Flags().Changed("needs") {
+		needs = First(cmd.Flags().GetStringSlice("needs"))
+		if needs == nil {
+			// An empty --needs= clears the services needed.
+			needs = []string{}
+		}
+	}
+	var res *ResourceOpts
+	if f := cmd.Flags(); f.Changed("cpu") || f.Changed("memory") || f.Changed("io-weight") {
+		res = &ResourceOpts{}
+		if f.Changed("cpu") {
+			res.CPU = ptr.To(First(f.GetFloat64("cpu")))
+		}
+		if f.Changed("memory") {
+			res.Memory = ptr.To(First(f.GetString("memory")))
+		}
+		if f.Changed("io-weight") {
+			res.IOWeight = ptr.To(First(f.GetInt("io-weight")))
+		}
+	}
+	var metrics *string
+	if cmd.Flags().Changed("metrics") {
+		metrics = ptr.To(First(cmd.Flags().GetString("metrics")))
+	}
+	var keep *int
+	if cmd.Flags().Changed("keep-generations") {
+		keep = ptr.To(First(cmd.Flags().GetInt("keep-generations")))
+	}
+	var allowPrivileged *bool
+	if cmd.Flags().Changed("allow-privileged") {
+		allowPrivileged = ptr.To(First(cmd.Flags().GetBool("allow-privileged")))
+	}
+	var noAutoRollback *bool
+	if cmd.Flags().Changed("no-auto-rollback") {
+		noAutoRollback = ptr.To(First(cmd.Flags().GetBool("no-auto-rollback")))
+	}
+	var watchdog *time.Duration
+	if cmd.Flags().Changed("watchdog") {
+		watchdog = ptr.To(First(cmd.Flags().GetDuration("watchdog")))
+	}
+	var vlan *int
+	if cmd.Flags().Changed("macvlan-vlan") {
+		vlan = ptr.To(First(cmd.Flags().GetInt("macvlan-vlan")))
+	}
+	var requireSigned *bool
+	if cmd.Flags().Changed("require-signed") {
+		requireSigned = ptr.To(First(cmd.Flags().GetBool("require-signed")))
+	}
 	return FileInstallerCfg{
 		InstallerCfg: ic,
 		Network: NetworkOpts{
@@ -380,11 +531,23 @@ func (e *ttyExecer) fileInstaller(cmd *cobra.Command, argsIn []string) FileInsta
 			Macvlan: MacvlanOpts{
 				Parent: First(cmd.Flags().GetString("macvlan-parent")),
 				Mac:    First(cmd.Flags().GetString("macvlan-mac")),
-				VLAN:   First(cmd.Flags().GetInt("macvlan-vlan")),
+				VLAN:   vlan,
 			},
 		},
-		Args:   args,
-		NewCmd: e.newCmd,
+		Args:     args,
+		DataDir:  First(cmd.Flags().GetString("data-dir")),
+		Watchdog: watchdog,
+		NewCmd:   e.newCmd,
+
+		AllowPrivileged: allowPrivileged,
+		NoAutoRollback:  noAutoRollback,
+		Resources:       res,
+		Needs:           needs,
+		Metrics:         metrics,
+		KeepGenerations: keep,
+		RequireSigned:   requireSigned,
+
+		StageDefaultsApplied: e.stageDefaultsApplied,
 	}
 }
 
@@ -395,6 +558,7 @@ func (e *ttyExecer) installerCfg() InstallerCfg {
 		Printer:          e.printf,
 		ClientOut:        e.rw,
 		SSHSessionCloser: sessionCloser{e.rawCloser},
+		Actor:            e.s.callerName(e.ctx, e.remoteAddr),
 	}
 }
 
@@ -402,8 +566,17 @@ func (e *ttyExecer) runCmdFunc(cmd *cobra.Command, argsIn []string) error {
 	if e.sn == SystemService {
 		return fmt.Errorf("cannot %s, reserved service name", cmd.CalledAs())
 	}
+	if _, err := e.applyStageDefaults(cmd); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("runtime") {
+		if err := e.setRuntime(First(cmd.Flags().GetString("runtime"))); err != nil {
+			return err
+		}
+	}
 	cfg := e.fileInstaller(cmd, argsIn)
-	return e.install(e.rw, cfg)
+	noProgress, _ := cmd.Flags().GetBool("no-progress")
+	return e.install(e.rw, cfg, noProgress)
 }
 
 type sessionCloser struct {
@@ -427,6 +600,23 @@ func (e *ttyExecer) stageCmdFunc(cmd *cobra.Command, args []string) error {
 	if e.sn == SystemService {
 		return fmt.Errorf("cannot stage system service")
 	}
+	switch cmd.CalledAs() {
+	case "stage":
+		if _, err := e.applyStageDefaults(cmd); err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("runtime") {
+			if err := e.setRuntime(First(cmd.Flags().GetString("runtime"))); err != nil {
+				return err
+			}
+		}
+	case "commit":
+		// commit has none of the stage flags, so stage the defaults
+		// first as `stage <flags>` would.
+		if err := e.stageDefaults(cmd.Parent()); err != nil {
+			return err
+		}
+	}
 	fi := e.fileInstaller(cmd, args)
 	if err := e.s.ensureDirs(e.sn, e.user); err != nil {
 		return fmt.Errorf("failed to ensure directories: %w", err)
@@ -438,7 +628,13 @@ func (e *ttyExecer) stageCmdFunc(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			log.Printf("%v", err)
 		}
-		if showEnv, _ := cmd.PersistentFlags().GetBool("env"); showEnv {
+		if showDiff, _ := cmd.Flags().GetBool("diff"); showDiff {
+			diff, err := e.s.stageDiff(e.sn)
+			if err != nil {
+				return fmt.Errorf("failed to diff staged configuration: %w", err)
+			}
+			fmt.Fprintf(e.rw, "%s\n", asJSON(diff))
+		} else if showEnv, _ := cmd.PersistentFlags().GetBool("env"); showEnv {
 			if err := e.s.printEnv(e.rw, sv, true); err != nil {
 				return fmt.Errorf("failed to print env: %w", err)
 			}
@@ -469,10 +665,15 @@ func (e *ttyExecer) stageCmdFunc(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func (e *ttyExecer) startCmdFunc(_ *cobra.Command, _ []string) error {
+func (e *ttyExecer) startCmdFunc(cmd *cobra.Command, _ []string) error {
 	if e.sn == SystemService || e.sn == CatchService {
 		return fmt.Errorf("cannot start system service")
 	}
+	if noDeps, _ := cmd.Flags().GetBool("no-deps"); !noDeps {
+		if err := e.startDependencies(); err != nil {
+			return err
+		}
+	}
 	runner, err := e.serviceRunner()
 	if err != nil {
 		return fmt.Errorf("failed to get service runner: %w", err)
@@ -480,13 +681,20 @@ func (e *ttyExecer) startCmdFunc(_ *cobra.Command, _ []string) error {
 	if err := runner.Start(); err != nil {
 		return fmt.Errorf("failed to start service: %w", err)
 	}
+	e.recordServiceAction(cmd, "start")
 	return nil
 }
 
-func (e *ttyExecer) stopCmdFunc(_ *cobra.Command, _ []string) error {
+func (e *ttyExecer) stopCmdFunc(cmd *cobra.Command, _ []string) error {
 	if e.sn == SystemService || e.sn == CatchService {
 		return fmt.Errorf("cannot stop system service")
 	}
+	if noDeps, _ := cmd.Flags().GetBool("no-deps"); !noDeps {
+		if err := e.stopDependents(); err != nil {
+			return err
+		}
+	}
+	e.warnRunningDependents()
 	runner, err := e.serviceRunner()
 	if err != nil {
 		return fmt.Errorf("failed to get service runner: %w", err)
@@ -494,38 +702,93 @@ func (e *ttyExecer) stopCmdFunc(_ *cobra.Command, _ []string) error {
 	if err := runner.Stop(); err != nil {
 		return fmt.Errorf("failed to stop service: %w", err)
 	}
+	e.recordServiceAction(cmd, "stop")
 	return nil
 }
 
+// recordServiceAction records a manual action on the service along with who
+// took it and the optional --reason, and publishes it as an event. Failures
+// are logged but not returned as the action itself already succeeded.
+func (e *ttyExecer) recordServiceAction(cmd *cobra.Command, action string) {
+	reason, _ := cmd.Flags().GetString("reason")
+	a := &db.ServiceAction{
+		Action: action,
+		Actor:  e.s.callerName(e.ctx, e.remoteAddr),
+		Reason: reason,
+		Time:   time.Now(),
+	}
+	if _, _, err := e.s.cfg.DB.MutateService(e.sn, func(_ *db.Data, s *db.Service) error {
+		s.LastAction = a
+		return nil
+	}); err != nil {
+		log.Printf("failed to record %s of %q: %v", action, e.sn, err)
+		return
+	}
+	e.s.PublishEvent(Event{
+		Type:        EventTypeServiceAction,
+		ServiceName: e.sn,
+		Data:        EventData{ServiceActionDataFromServiceAction(a)},
+	})
+}
+
 func (e *ttyExecer) rollbackCmdFunc(cmd *cobra.Command, _ []string) error {
-	_, s, err := e.s.cfg.DB.MutateService(e.sn, func(d *db.Data, s *db.Service) error {
-		if s.Generation == 0 {
+	to, _ := cmd.Flags().GetInt("to")
+	digest, _ := cmd.Flags().GetString("digest")
+	if to != 0 && digest != "" {
+		return fmt.Errorf("--to and --digest are mutually exclusive")
+	}
+	var gen int
+	// Read from a snapshot rather than under the DB lock: --digest hashes
+	// binaries, which may take a while.
+	err := func() error {
+		dv, err := e.s.cfg.DB.Get()
+		if err != nil {
+			return err
+		}
+		d := dv.AsStruct()
+		s, ok := d.Services[e.sn]
+		if !ok || s.Generation == 0 {
 			return fmt.Errorf("no generation to rollback")
 		}
-		minG := s.LatestGeneration - maxGenerations
-		gen := s.Generation - 1
+		minG := minGeneration(d, s)
+		gen = s.Generation - 1
+		if digest != "" {
+			g, err := e.s.generationForDigest(d, s, digest)
+			if err != nil {
+				return err
+			}
+			gen = g
+		} else if to != 0 {
+			if to == s.Generation {
+				return fmt.Errorf("generation %d is already active", to)
+			}
+			if to > s.LatestGeneration || to < 1 || !hasGeneration(s, to) {
+				return fmt.Errorf("generation %d does not exist, see `yeet generations`", to)
+			}
+			gen = to
+		}
 		if gen < minG {
 			return fmt.Errorf("generation %d is too old, earliest rollback is %d", gen, minG)
 		}
 		if gen == 0 {
 			return fmt.Errorf("generation %d is the oldest, cannot rollback", s.Generation)
 		}
-		s.Generation = gen
 		return nil
-	})
+	}()
 	if err != nil {
 		return fmt.Errorf("failed to rollback service: %w", err)
 	}
 	cfg := e.installerCfg()
+	cfg.Action = AuditActionRollback
 	i, err := e.s.NewInstaller(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create installer: %w", err)
 	}
 	i.NewCmd = e.newCmd
-	return i.InstallGen(s.Generation)
+	return i.InstallGen(gen)
 }
 
-func (e *ttyExecer) restartCmdFunc(_ *cobra.Command, _ []string) error {
+func (e *ttyExecer) restartCmdFunc(cmd *cobra.Command, _ []string) error {
 	e.printf("Restarting service %q\n", e.sn)
 	runner, err := e.serviceRunner()
 	if err != nil {
@@ -534,6 +797,7 @@ func (e *ttyExecer) restartCmdFunc(_ *cobra.Command, _ []string) error {
 	if err := runner.Restart(); err != nil {
 		return fmt.Errorf("failed to restart service: %w", err)
 	}
+	e.recordServiceAction(cmd, "restart")
 	e.printf("Restarted service %q\n", e.sn)
 	return nil
 }
@@ -550,6 +814,17 @@ func (e *ttyExecer) editCmdFunc(c *cobra.Command, _ []string) error {
 	}
 	editEnv, _ := c.PersistentFlags().GetBool("env")
 	editConfig, _ := c.PersistentFlags().GetBool("config")
+	force, _ := c.PersistentFlags().GetBool("force")
+
+	release, warning, err := e.s.acquireEditLease(e.sn, e.s.callerName(e.ctx, e.remoteAddr), force)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if warning != "" {
+		e.printf("Warning: %s\n", warning)
+	}
+	base := editFingerprint(sv, editConfig)
 
 	var srcPath string
 
@@ -592,26 +867,45 @@ func (e *ttyExecer) editCmdFunc(c *cobra.Command, _ []string) error {
 			}
 			defer srcf.Close()
 
-			count := 0
-			for _, name := range []db.ArtifactName{db.ArtifactSystemdUnit, db.ArtifactSystemdTimerFile} {
+			// The generated unit is shown for reference only; changes to
+			// the service go into a drop-in override so that they survive
+			// the unit being regenerated.
+			unitPath, ok := af.Latest(db.ArtifactSystemdUnit)
+			if !ok {
+				return fmt.Errorf("no unit files found")
+			}
+			base, err := os.ReadFile(unitPath)
+			if err != nil {
+				return fmt.Errorf("failed to read unit file: %w", err)
+			}
+			fmt.Fprintf(srcf, "# Generated %s (read-only). Add changes to the %s section\n", db.ArtifactSystemdUnit, db.ArtifactSystemdOverride)
+			fmt.Fprintf(srcf, "# below, they are applied as a drop-in on top of this unit.\n#\n")
+			for _, l := range strings.Split(strings.TrimSpace(string(base)), "\n") {
+				fmt.Fprintf(srcf, "# %s\n", l)
+			}
+			fmt.Fprintf(srcf, "\n")
+
+			for _, name := range []db.ArtifactName{db.ArtifactSystemdOverride, db.ArtifactSystemdTimerFile} {
 				path, ok := af.Latest(name)
-				if !ok {
+				if !ok && name != db.ArtifactSystemdOverride {
 					continue
 				}
-				if count > 0 {
-					fmt.Fprintf(srcf, "\n\n")
-				}
+				fmt.Fprintf(srcf, "\n")
 				fmt.Fprintf(srcf, editUnitsSeparator, name)
 				fmt.Fprintf(srcf, "\n\n")
 				systemdUnitsBeingEdited = append(systemdUnitsBeingEdited, path)
+				if !ok {
+					continue
+				}
 				f, err := os.Open(path)
 				if err != nil {
 					return fmt.Errorf("failed to open unit file: %w", err)
 				}
 				if _, err := io.Copy(srcf, f); err != nil {
+					f.Close()
 					return fmt.Errorf("failed to write to temp file: %w", err)
 				}
-				count++
+				f.Close()
 			}
 			if err := srcf.Close(); err != nil {
 				return fmt.Errorf("failed to close temp file: %w", err)
@@ -636,6 +930,9 @@ func (e *ttyExecer) editCmdFunc(c *cobra.Command, _ []string) error {
 		e.printf("No changes detected\n")
 		return nil
 	}
+	checkBase := func(s *db.Service) error {
+		return checkEditBase(s, base, editConfig)
+	}
 
 	if editConfig {
 		bs, err := os.ReadFile(tmpPath)
@@ -647,6 +944,23 @@ func (e *ttyExecer) editCmdFunc(c *cobra.Command, _ []string) error {
 			return fmt.Errorf("failed to unmarshal temp file: %w", err)
 		}
 		_, _, err = e.s.cfg.DB.MutateService(e.sn, func(d *db.Data, s *db.Service) error {
+			if err := checkBase(s); err != nil {
+				return err
+			}
+			if s.Protected {
+				// The config holds what gets installed; editing it would
+				// bypass approvals.
+				return fmt.Errorf("service %q is protected; its config can't be edited", e.sn)
+			}
+			if s.RequireSigned {
+				// The config points at the artifacts that get installed,
+				// which would bypass signature checks.
+				return fmt.Errorf("service %q requires signed files; its config can't be edited", e.sn)
+			}
+			// Protection is only changed with `protect`.
+			s2.Protected = s.Protected
+			s2.PendingDeploy = s.PendingDeploy
+			s2.PendingUnprotect = s.PendingUnprotect
 			*s = s2
 			return nil
 		})
@@ -669,6 +983,7 @@ func (e *ttyExecer) editCmdFunc(c *cobra.Command, _ []string) error {
 		defer f.Close()
 		icfg := e.fileInstaller(c, nil)
 		icfg.EnvFile = editEnv
+		icfg.checkBase = checkBase
 		fi, err := NewFileInstaller(e.s, icfg)
 		if err != nil {
 			return fmt.Errorf("failed to create installer: %w", err)
@@ -724,6 +1039,11 @@ func (e *ttyExecer) editCmdFunc(c *cobra.Command, _ []string) error {
 				return fmt.Errorf("failed to close temp file: %w", err)
 			}
 			p, ok := af.Latest(db.ArtifactName(name))
+			if !ok && db.ArtifactName(name) == db.ArtifactSystemdOverride {
+				// First override, place it next to the unit.
+				unitPath, _ := af.Latest(db.ArtifactSystemdUnit)
+				p, ok = filepath.Join(filepath.Dir(unitPath), "override.conf"), true
+			}
 			if !ok {
 				return fmt.Errorf("no unit file found for %q", name)
 			}
@@ -734,8 +1054,16 @@ func (e *ttyExecer) editCmdFunc(c *cobra.Command, _ []string) error {
 			newArtifacts[db.ArtifactName(name)] = binPath
 		}
 		_, _, err = e.s.cfg.DB.MutateService(e.sn, func(d *db.Data, s *db.Service) error {
+			if err := checkBase(s); err != nil {
+				return err
+			}
 			for name, path := range newArtifacts {
-				s.Artifacts[name].Refs["staged"] = path
+				a, ok := s.Artifacts[name]
+				if !ok {
+					a = &db.Artifact{Refs: map[db.ArtifactRef]string{}}
+					mak.Set(&s.Artifacts, name, a)
+				}
+				a.Refs["staged"] = path
 			}
 			return nil
 		})
@@ -771,13 +1099,6 @@ func copyToTmpFile(src string) (string, error) {
 	return tmpf.Name(), nil
 }
 
-func setWinsize(f *os.File, w, h int) {
-	unix.IoctlSetWinsize(int(f.Fd()), syscall.TIOCSWINSZ, &unix.Winsize{
-		Row: uint16(h),
-		Col: uint16(w),
-	})
-}
-
 func (e *ttyExecer) editFile(path string) error {
 	if !e.isPty {
 		return fmt.Errorf("edit requires a pty, please run ssh with -t")
@@ -814,7 +1135,15 @@ func (s *Server) printEnv(w io.Writer, sv db.ServiceView, staged bool) error {
 	return nil
 }
 
-func (e *ttyExecer) envCmdFunc(_ *cobra.Command, _ []string) error {
+func (e *ttyExecer) envCmdFunc(cmd *cobra.Command, _ []string) error {
+	if cmd.CalledAs() == "pubkey" {
+		kp, err := e.s.envKeyPair()
+		if err != nil {
+			return err
+		}
+		e.printf("%s\n", kp.PublicKey())
+		return nil
+	}
 	sv, err := e.s.serviceView(e.sn)
 	if err != nil {
 		return err
@@ -865,31 +1194,244 @@ func (e *ttyExecer) logsCmdFunc(cmd *cobra.Command, _ []string) error {
 	}
 	follow, _ := cmd.Flags().GetBool("follow")
 	lines, _ := cmd.Flags().GetInt("lines")
-	return runner.Logs(&svc.LogOptions{Follow: follow, Lines: lines})
+	grep, _ := cmd.Flags().GetString("grep")
+	opts := &svc.LogOptions{Follow: follow, Lines: lines, Grep: grep}
+	now := time.Now()
+	for flag, t := range map[string]*time.Time{"since": &opts.Since, "until": &opts.Until} {
+		v, _ := cmd.Flags().GetString(flag)
+		if *t, err = parseLogTime(v, now); err != nil {
+			return fmt.Errorf("invalid --%s: %w", flag, err)
+		}
+	}
+	if cmd.Flags().Changed("download") {
+		if v, _ := cmd.Flags().GetString("download"); v != "-" {
+			return fmt.Errorf("--download to a file needs the yeet client, use --download=- to stream the export")
+		}
+		offset, _ := cmd.Flags().GetInt64("offset")
+		rl, _ := cmd.Flags().GetString("rate-limit")
+		rate, err := parseByteSize(rl)
+		if err != nil {
+			return fmt.Errorf("invalid --rate-limit: %w", err)
+		}
+		return e.downloadLogs(opts, offset, rate)
+	}
+	if opts.Follow && !opts.Until.IsZero() {
+		return fmt.Errorf("--follow and --until cannot be used together")
+	}
+	return runner.Logs(opts)
+}
+
+// parseLogTime parses v as a time for the logs --since and --until flags.
+// It accepts a duration like "90m", meaning that long before now, or a
+// timestamp. Timestamps without a zone are in the host's local time. An
+// empty v returns the zero time.
+func parseLogTime(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration nor a timestamp", v)
+}
+
+// statusRow is a row of the status table, one per component of a service.
+type statusRow struct {
+	status    *ServiceStatusData
+	component *ComponentStatusData
+	note      string
+	now       time.Time
+}
+
+// statusColumn is a column of the status table.
+type statusColumn struct {
+	header string
+	// details are the status details the column needs.
+	details statusDetails
+	value   func(r statusRow) string
+}
+
+// statusColumns are the columns of the status table by name.
+var statusColumns = map[string]statusColumn{
+	"service": {header: "SERVICE", value: func(r statusRow) string { return r.status.ServiceName }},
+	"type":    {header: "TYPE", value: func(r statusRow) string { return string(r.status.ServiceType) }},
+	"container": {header: "CONTAINER", value: func(r statusRow) string {
+		if r.status.ServiceType == ServiceDataTypeDocker {
+			return r.component.Name
+		}
+		return "-"
+	}},
+	"status": {header: "STATUS", value: func(r statusRow) string { return string(r.component.Status) }},
+	"state":  {header: "STATE", value: func(r statusRow) string { return string(r.status.Status) }},
+	"uptime": {header: "UPTIME", details: statusDetails{runtime: true}, value: func(r statusRow) string {
+		return r.component.Uptime(r.now)
+	}},
+	"restarts": {header: "RESTARTS", details: statusDetails{runtime: true}, value: func(r statusRow) string {
+		return strconv.Itoa(r.component.Restarts)
+	}},
+	"health": {header: "HEALTH", details: statusDetails{runtime: true}, value: func(r statusRow) string {
+		if r.component.Health == "" {
+			return "-"
+		}
+		return string(r.component.Health)
+	}},
+	"note":       {header: "NOTE", value: func(r statusRow) string { return r.note }},
+	"generation": {header: "GEN", value: func(r statusRow) string { return strconv.Itoa(r.status.Generation) }},
+	"deps": {header: "DEPENDS ON", value: func(r statusRow) string {
+		if len(r.status.DependsOn) == 0 {
+			return "-"
+		}
+		return strings.Join(r.status.DependsOn, ",")
+	}},
+	"ips": {header: "IPS", details: statusDetails{runtime: true, ips: true}, value: func(r statusRow) string {
+		ips := r.status.IPs
+		if len(r.component.IPs) > 0 {
+			ips = r.component.IPs
+		}
+		if len(ips) == 0 {
+			return "-"
+		}
+		return strings.Join(ips, ",")
+	}},
+	"image": {header: "IMAGE", details: statusDetails{runtime: true}, value: func(r statusRow) string {
+		if r.component.Image == "" {
+			return "-"
+		}
+		// Shorten image IDs like docker does.
+		id := strings.TrimPrefix(r.component.Image, "sha256:")
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		return id
+	}},
 }
 
+// defaultStatusColumns are the columns shown by status when --columns is not
+// set.
+var defaultStatusColumns = []string{"service", "type", "state", "container", "status", "uptime", "restarts", "note"}
+
 func (e *ttyExecer) statusCmdFunc(cmd *cobra.Command, _ []string) error {
 	formatOut, _ := cmd.Flags().GetString("format")
+	names, _ := cmd.Flags().GetStringSlice("columns")
+	if len(names) == 0 {
+		names = defaultStatusColumns
+	}
+	var columns []statusColumn
+	var sd statusDetails
+	for _, name := range names {
+		c, ok := statusColumns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return fmt.Errorf("unknown status column %q, valid columns are %s", name, strings.Join(slices.Sorted(maps.Keys(statusColumns)), ", "))
+		}
+		columns = append(columns, c)
+		sd.runtime = sd.runtime || c.details.runtime
+		sd.ips = sd.ips || c.details.ips
+	}
+	if formatOut != "table" {
+		// JSON output always has every field.
+		sd = allStatusDetails
+	}
 
-	dv, err := e.s.cfg.DB.Get()
+	statuses, err := e.s.serviceStatusesWith(e.sn, sd)
 	if err != nil {
-		return fmt.Errorf("failed to get services: %w", err)
+		return err
+	}
+
+	if formatOut == "json" {
+		return json.NewEncoder(cmd.OutOrStdout()).Encode(statuses)
+	}
+	if formatOut == "json-pretty" {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	}
+
+	if e.sn == SystemService {
+		if off := e.s.autoDeployOff(); off != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Auto-deploys are off: %s\n\n", ServiceActionDataFromServiceAction(off).Summary(time.Now()))
+		}
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+	defer w.Flush()
+
+	for _, c := range columns {
+		fmt.Fprintf(w, "%s\t", c.header)
+	}
+	fmt.Fprintln(w)
+
+	now := time.Now()
+	for i := range statuses {
+		status := &statuses[i]
+		note := status.LastAction.Summary(now)
+		if status.LastWatchdogTrip != 0 {
+			trip := "watchdog tripped " + formatAgo(now.Sub(time.UnixMilli(status.LastWatchdogTrip)))
+			if note != "" {
+				note = trip + "; " + note
+			} else {
+				note = trip
+			}
+		}
+		for j := range status.ComponentStatus {
+			r := statusRow{status: status, component: &status.ComponentStatus[j], note: note, now: now}
+			for _, c := range columns {
+				fmt.Fprintf(w, "%s\t", c.value(r))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
+
+// statusDetails selects the parts of a service status that are expensive to
+// gather.
+type statusDetails struct {
+	// runtime is the start time, restart count, image and container IPs of
+	// each component.
+	runtime bool
+	// ips is the addresses of the service's network namespace.
+	ips bool
+}
+
+// allStatusDetails gathers every part of a service status.
+var allStatusDetails = statusDetails{runtime: true, ips: true}
+
+// serviceStatuses returns the status of service sn, or of all services if sn
+// is SystemService.
+func (s *Server) serviceStatuses(sn string) ([]ServiceStatusData, error) {
+	return s.serviceStatusesWith(sn, allStatusDetails)
+}
+
+// serviceStatusesWith is like serviceStatuses but only gathers the details
+// selected by sd.
+func (s *Server) serviceStatusesWith(sn string, sd statusDetails) ([]ServiceStatusData, error) {
+	dv, err := s.cfg.DB.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get services: %w", err)
 	}
 	if !dv.Valid() {
-		return fmt.Errorf("no services found")
+		return nil, fmt.Errorf("no services found")
 	}
 
 	var statuses []ServiceStatusData
 
-	if e.sn == SystemService {
-		systemdStatuses, err := e.s.SystemdStatuses()
+	if sn == SystemService {
+		systemdStatuses, err := s.SystemdStatuses()
 		if err != nil {
-			return fmt.Errorf("failed to get systemd statuses: %w", err)
+			return nil, fmt.Errorf("failed to get systemd statuses: %w", err)
 		}
 		for sn, status := range systemdStatuses {
-			service, err := e.s.serviceView(sn)
+			service, err := s.serviceView(sn)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			statuses = append(statuses, ServiceStatusData{
 				ServiceName: sn,
@@ -902,9 +1444,9 @@ func (e *ttyExecer) statusCmdFunc(cmd *cobra.Command, _ []string) error {
 				},
 			})
 		}
-		composeStatuses, err := e.s.DockerComposeStatuses()
+		composeStatuses, err := s.DockerComposeStatuses()
 		if err != nil {
-			return fmt.Errorf("failed to get all docker compose statuses: %w", err)
+			return nil, fmt.Errorf("failed to get all docker compose statuses: %w", err)
 		}
 		for sn, cs := range composeStatuses {
 			if len(cs) == 0 {
@@ -933,37 +1475,47 @@ func (e *ttyExecer) statusCmdFunc(cmd *cobra.Command, _ []string) error {
 			}
 			statuses = append(statuses, data)
 		}
+		for sn, sv := range dv.Services().All() {
+			if sv.ServiceType() == db.ServiceTypeExternal {
+				statuses = append(statuses, s.externalStatusData(sn, sv.External()))
+			}
+		}
 	} else {
-		st, err := e.s.serviceType(e.sn)
+		st, err := s.serviceType(sn)
 		if err != nil {
-			return fmt.Errorf("failed to get service type: %w", err)
+			return nil, fmt.Errorf("failed to get service type: %w", err)
 		}
 		data := ServiceStatusData{
-			ServiceName:     e.sn,
+			ServiceName:     sn,
 			ServiceType:     ServiceDataTypeFromServiceType(st),
 			ComponentStatus: []ComponentStatusData{},
 		}
 		switch st {
+		case db.ServiceTypeExternal:
+			sv, err := s.serviceView(sn)
+			if err != nil {
+				return nil, err
+			}
+			data = s.externalStatusData(sn, sv.External())
 		case db.ServiceTypeSystemd:
-			status, err := e.s.SystemdStatus(e.sn)
+			status, err := s.SystemdStatus(sn)
 			if err != nil {
-				return fmt.Errorf("failed to get systemd status: %w", err)
+				return nil, fmt.Errorf("failed to get systemd status: %w", err)
 			}
 			data.ComponentStatus = append(data.ComponentStatus, ComponentStatusData{
-				Name:   e.sn,
+				Name:   sn,
 				Status: ComponentStatusFromServiceStatus(status),
 			})
 		case db.ServiceTypeDockerCompose:
-			cs, err := e.s.DockerComposeStatus(e.sn)
+			cs, err := s.DockerComposeStatus(sn)
 			if err != nil {
-				return fmt.Errorf("failed to get docker compose statuses: %w", err)
+				return nil, fmt.Errorf("failed to get docker compose statuses: %w", err)
 			}
 			if len(cs) == 0 {
 				data.ComponentStatus = append(data.ComponentStatus, ComponentStatusData{
-					Name:   e.sn,
+					Name:   sn,
 					Status: ComponentStatusUnknown,
 				})
-				return nil
 			}
 			for cn, status := range cs {
 				data.ComponentStatus = append(data.ComponentStatus, ComponentStatusData{
@@ -974,39 +1526,40 @@ func (e *ttyExecer) statusCmdFunc(cmd *cobra.Command, _ []string) error {
 		}
 		statuses = append(statuses, data)
 	}
+	for i := range statuses {
+		sv, ok := dv.Services().GetOk(statuses[i].ServiceName)
+		if ok {
+			statuses[i].LastAction = ServiceActionDataFromServiceAction(sv.LastAction())
+			statuses[i].Generation = sv.Generation()
+			statuses[i].DependsOn = dependencyNames(sv.Dependencies().AsSlice())
+		}
+		if t, ok := s.lastWatchdogTrip(statuses[i].ServiceName); ok {
+			statuses[i].LastWatchdogTrip = t.UnixMilli()
+		}
+		if health, lastErr := s.serviceHealth(statuses[i].ServiceName); health != "" {
+			for j := range statuses[i].ComponentStatus {
+				if c := &statuses[i].ComponentStatus[j]; c.Status == ComponentStatusRunning {
+					c.Health, c.HealthError = health, lastErr
+				}
+			}
+		}
+		if sd.runtime {
+			s.fillRuntimeInfo(&statuses[i])
+		}
+		if sd.ips && ok {
+			statuses[i].IPs = s.netnsIPs(sv)
+		}
+	}
 	slices.SortFunc(statuses, func(a, b ServiceStatusData) int {
 		return strings.Compare(a.ServiceName, b.ServiceName)
 	})
-	for _, status := range statuses {
+	for i, status := range statuses {
 		slices.SortFunc(status.ComponentStatus, func(a, b ComponentStatusData) int {
 			return strings.Compare(a.Name, b.Name)
 		})
+		statuses[i].Status = ServiceStatus(status.ComponentStatus)
 	}
-
-	if formatOut == "json" {
-		return json.NewEncoder(cmd.OutOrStdout()).Encode(statuses)
-	}
-	if formatOut == "json-pretty" {
-		encoder := json.NewEncoder(cmd.OutOrStdout())
-		encoder.SetIndent("", "  ")
-		return encoder.Encode(statuses)
-	}
-
-	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
-	defer w.Flush()
-
-	fmt.Fprintln(w, "SERVICE\tTYPE\tCONTAINER\tSTATUS\t")
-
-	for _, status := range statuses {
-		for _, component := range status.ComponentStatus {
-			if status.ServiceType == ServiceDataTypeDocker {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", status.ServiceName, status.ServiceType, component.Name, component.Status)
-			} else {
-				fmt.Fprintf(w, "%s\t%s\t-\t%s\t\n", status.ServiceName, status.ServiceType, component.Status)
-			}
-		}
-	}
-	return nil
+	return statuses, nil
 }
 
 func (e *ttyExecer) cronCmdFunc(cmd *cobra.Command, cronexpr string, args []string) error {
@@ -1019,17 +1572,32 @@ func (e *ttyExecer) cronCmdFunc(cmd *cobra.Command, cronexpr string, args []stri
 		OnCalendar: oncal,
 		Persistent: true, // This should be an option keyvalue in the future
 	}
-	return e.install(cmd.InOrStdin(), cfg)
+	noProgress, _ := cmd.Flags().GetBool("no-progress")
+	return e.install(cmd.InOrStdin(), cfg, noProgress)
 }
 
-func (e *ttyExecer) removeCmdFunc(_ *cobra.Command, _ []string) error {
+func (e *ttyExecer) removeCmdFunc(cmd *cobra.Command, _ []string) error {
 	if e.sn == SystemService || e.sn == CatchService {
 		return fmt.Errorf("cannot remove system service")
 	}
+	purge, _ := cmd.Flags().GetBool("purge")
+	force, _ := cmd.Flags().GetBool("force")
+	if dv, err := e.s.getDB(); err == nil {
+		if refs := e.s.dependencyRefs(dv, e.sn); len(refs) > 0 {
+			if !force {
+				return fmt.Errorf("other services depend on %q:\n%sremove them first, or pass --force to remove it anyway", e.sn, formatDependencyRefs(refs))
+			}
+			e.printf("warning: removing %q, which other services depend on:\n%s", e.sn, formatDependencyRefs(refs))
+		}
+	}
+	remove := e.s.ArchiveService
+	if purge {
+		remove = e.s.RemoveService
+	}
 	runner, err := e.serviceRunner()
 	if err != nil {
 		if errors.Is(err, errNoServiceConfigured) {
-			if err := e.s.RemoveService(e.sn); err != nil {
+			if err := remove(e.sn); err != nil {
 				return fmt.Errorf("failed to cleanup service %q: %w", e.sn, err)
 			}
 			e.printf("service %q not found\n", e.sn)
@@ -1051,13 +1619,65 @@ func (e *ttyExecer) removeCmdFunc(_ *cobra.Command, _ []string) error {
 	} else if err != nil {
 		return fmt.Errorf("failed to remove service: %w", err)
 	}
-	err = e.s.RemoveService(e.sn)
+	err = remove(e.sn)
 	if err != nil {
 		return fmt.Errorf("failed to cleanup service %q: %w", e.sn, err)
 	}
+	ae := AuditEntry{
+		ServiceName: e.sn,
+		Action:      AuditActionRemove,
+		Actor:       e.s.callerName(e.ctx, e.remoteAddr),
+		User:        e.user,
+	}
+	if purge {
+		ae.Reason = "purged"
+	}
+	e.s.recordAudit(ae)
+	if !purge {
+		e.printf("service %q archived; restore it within %v with `undelete`\n", e.sn, archiveRetention)
+	}
 	return nil
 }
 
+func (e *ttyExecer) undeleteCmdFunc(cmd *cobra.Command, _ []string) error {
+	if list, _ := cmd.Flags().GetBool("list"); list {
+		name := e.sn
+		if name == SystemService {
+			name = ""
+		}
+		archives, err := e.s.ArchivedServices(name)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+		defer w.Flush()
+		fmt.Fprintln(w, "SERVICE\tARCHIVED\tEXPIRES\t")
+		for _, as := range archives {
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", as.Name, as.ArchivedAt.Format(time.DateTime), as.ArchivedAt.Add(archiveRetention).Format(time.DateTime))
+		}
+		return nil
+	}
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot undelete system service")
+	}
+	sv, err := e.s.UndeleteService(e.sn)
+	if err != nil {
+		return err
+	}
+	e.printf("Restored service %q at generation %d\n", e.sn, sv.Generation)
+	if sv.Generation == 0 {
+		return nil
+	}
+	cfg := e.installerCfg()
+	cfg.Action = AuditActionUndelete
+	i, err := e.s.NewInstaller(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create installer: %w", err)
+	}
+	i.NewCmd = e.newCmd
+	return i.InstallGen(sv.Generation)
+}
+
 // ServiceRunner is an interface for the minimal set of methods required to
 // manage a service.
 type ServiceRunner interface {
@@ -1089,38 +1709,52 @@ func (e *ttyExecer) newCmd(name string, args ...string) *exec.Cmd {
 
 	if e.isPty {
 		c.Env = append(c.Env, fmt.Sprintf("TERM=%s", e.ptyReq.Term))
-		c.SysProcAttr = &syscall.SysProcAttr{
-			Setctty: true,
-			Setsid:  true,
-		}
+		c.SysProcAttr = ttyProcAttr()
 	}
 	return c
 }
 
 func (e *ttyExecer) serviceRunner() (ServiceRunner, error) {
-	st, err := e.s.serviceType(e.sn)
+	return e.serviceRunnerFor(e.sn, e.newCmd)
+}
+
+// serviceRunnerFor returns a ServiceRunner for the service sn which runs its
+// commands using newCmd.
+func (e *ttyExecer) serviceRunnerFor(sn string, newCmd func(string, ...string) *exec.Cmd) (ServiceRunner, error) {
+	st, err := e.s.serviceType(sn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get service type: %w", err)
 	}
 	var service ServiceRunner
 	switch st {
 	case db.ServiceTypeSystemd:
-		systemd, err := e.s.systemdService(e.sn)
+		hs, err := e.s.hostService(sn)
 		if err != nil {
 			return nil, err
 		}
-		service = &systemdServiceRunner{SystemdService: systemd}
+		switch hs := hs.(type) {
+		case *svc.SystemdService:
+			service = &systemdServiceRunner{SystemdService: hs}
+		case nativeService:
+			service = &nativeServiceRunner{nativeService: hs}
+		}
 	case db.ServiceTypeDockerCompose:
-		docker, err := e.s.dockerComposeService(e.sn)
+		docker, err := e.s.dockerComposeService(sn)
 		if err != nil {
 			return nil, err
 		}
 		service = &dockerComposeServiceRunner{DockerComposeService: docker}
+	case db.ServiceTypeExternal:
+		sv, err := e.s.serviceView(sn)
+		if err != nil {
+			return nil, err
+		}
+		service = &externalServiceRunner{ext: sv.External()}
 	default:
 		return nil, fmt.Errorf("unhandled service type %q", st)
 	}
 	if service != nil {
-		service.SetNewCmd(e.newCmd)
+		service.SetNewCmd(newCmd)
 	}
 	return service, nil
 }
@@ -1166,14 +1800,7 @@ func (s *systemdServiceRunner) Logs(opts *svc.LogOptions) error {
 	if opts == nil {
 		opts = &svc.LogOptions{}
 	}
-	args := []string{"--no-pager", "--output=cat"}
-	if opts.Follow {
-		args = append(args, "--follow")
-	}
-	if opts.Lines > 0 {
-		args = append(args, "--lines="+strconv.Itoa(opts.Lines))
-	}
-	args = append(args, "--unit="+s.SystemdService.Name())
+	args := append(opts.JournalctlArgs(), "--unit="+s.SystemdService.Name())
 	c := s.newCmd("journalctl", args...)
 	if err := c.Start(); err != nil {
 		return fmt.Errorf("failed to start journalctl: %w", err)
@@ -1221,19 +1848,34 @@ func (s *dockerComposeServiceRunner) Remove() error {
 
 // Add this method to the ttyExecer struct
 func (e *ttyExecer) eventsCmdFunc(cmd *cobra.Command, _ []string) error {
-	ch := make(chan Event)
 	all, _ := cmd.Flags().GetBool("all")
-	defer e.s.RemoveEventListener(e.s.AddEventListener(ch, func(et Event) bool {
+	filter := func(et Event) bool {
 		if all {
 			return true
 		}
 		return et.ServiceName == e.sn
-	}))
+	}
+	if history, _ := cmd.Flags().GetBool("history"); history {
+		sinceStr, _ := cmd.Flags().GetString("since")
+		since, err := parseLogTime(sinceStr, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		events, err := e.s.eventHistory(filter, since)
+		if err != nil {
+			return err
+		}
+		return e.writeEventHistory(events)
+	}
+	el := e.s.AddEventListener(filter)
+	defer e.s.RemoveEventListener(el)
 
 	for {
 		select {
-		case event := <-ch:
+		case event := <-el.Events():
 			e.printf("Received event: %v\n", event)
+		case <-el.Done():
+			return fmt.Errorf("disconnected for not keeping up with events")
 		case <-e.ctx.Done():
 			return nil
 		case <-cmd.Context().Done():
@@ -1242,6 +1884,23 @@ func (e *ttyExecer) eventsCmdFunc(cmd *cobra.Command, _ []string) error {
 	}
 }
 
+// writeEventHistory prints events as a table, one event per line.
+func (e *ttyExecer) writeEventHistory(events []Event) error {
+	tw := tabwriter.NewWriter(e.rw, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSERVICE\tTYPE\tDATA")
+	for _, event := range events {
+		data := "-"
+		if event.Data.Data != nil {
+			if b, err := json.Marshal(event.Data); err == nil {
+				data = string(b)
+			}
+		}
+		t := time.UnixMilli(event.Time).Format(time.RFC3339)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t, event.ServiceName, event.Type, data)
+	}
+	return tw.Flush()
+}
+
 func (e *ttyExecer) umountCmdFunc(_ *cobra.Command, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("invalid number of arguments")
@@ -1342,15 +2001,24 @@ func (e *ttyExecer) mountCmdFunc(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-var ipv4Re = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}/\d{1,2}\b`)
-
-func parseIPv4Addresses(text string) []string {
-	matches := ipv4Re.FindAllString(text, -1)
-
+// parseIPAddresses returns the global unicast addresses, both IPv4 and IPv6,
+// in the output of `ip -o addr list`.
+func parseIPAddresses(text string) []string {
 	var ips []string
-	for _, match := range matches {
-		ip := strings.Split(match, "/")[0]
-		ips = append(ips, ip)
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if (f != "inet" && f != "inet6") || i+1 >= len(fields) {
+				continue
+			}
+			pfx, err := netip.ParsePrefix(fields[i+1])
+			if err != nil {
+				continue
+			}
+			if ip := pfx.Addr(); ip.IsGlobalUnicast() || ip.IsPrivate() {
+				ips = append(ips, ip.String())
+			}
+		}
 	}
 	return ips
 }
@@ -1384,6 +2052,21 @@ func (e *ttyExecer) tsCmdFunc(_ *cobra.Command, args []string) error {
 	return nil
 }
 
+// netnsIPs returns the addresses of the network namespace of service sv, or
+// nil if it does not have one. Errors are logged.
+func (s *Server) netnsIPs(sv db.ServiceView) []string {
+	if _, ok := sv.AsStruct().Artifacts.Gen(db.ArtifactNetNSService, sv.Generation()); !ok {
+		return nil
+	}
+	netns := fmt.Sprintf("yeet-%s-ns", sv.Name())
+	bs, err := exec.Command("ip", "netns", "exec", netns, "ip", "-o", "addr", "list").CombinedOutput()
+	if err != nil {
+		log.Printf("failed to get IP addresses of %q: %v", sv.Name(), err)
+		return nil
+	}
+	return parseIPAddresses(string(bs))
+}
+
 func (e *ttyExecer) ipCmdFunc(_ *cobra.Command, _ []string) error {
 	if e.sn == CatchService {
 		st, err := e.s.cfg.LocalClient.StatusWithoutPeers(e.ctx)
@@ -1396,7 +2079,7 @@ func (e *ttyExecer) ipCmdFunc(_ *cobra.Command, _ []string) error {
 		return nil
 	}
 
-	args := []string{"-o", "-4", "addr", "list"}
+	args := []string{"-o", "addr", "list"}
 	if e.sn != SystemService {
 		sv, err := e.s.serviceView(e.sn)
 		if err != nil {
@@ -1412,12 +2095,7 @@ func (e *ttyExecer) ipCmdFunc(_ *cobra.Command, _ []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get IP addresses: %w", err)
 	}
-	ips := parseIPv4Addresses(string(bs))
-	for _, ip := range ips {
-		// Skip 127.0.0.1
-		if ip == "127.0.0.1" {
-			continue
-		}
+	for _, ip := range parseIPAddresses(string(bs)) {
 		fmt.Fprintln(e.rw, ip)
 	}
 	return nil
@@ -0,0 +1,268 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/netns"
+	"github.com/tailscale/golang-x-crypto/ssh"
+	gssh "tailscale.com/tempfork/gliderlabs/ssh"
+)
+
+// Reverse tunnels let a service reach a port on the client machine, e.g. a
+// mock API on a laptop, for as long as `yeet tunnel` runs. The client asks
+// for a remote forward (ssh -R) as <svc>@catch and catch listens on the
+// requested port on loopback in the network namespaces of the service, so
+// that the service reaches the client at localhost:<port>.
+
+// Payloads of the tcpip-forward requests and forwarded-tcpip channels, from
+// RFC 4254 section 7.
+type remoteForwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+type remoteForwardChannelData struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// tunnelHandler handles the remote forwards of one SSH connection. They are
+// closed when the connection closes.
+type tunnelHandler struct {
+	s *Server
+
+	mu        sync.Mutex
+	listeners map[uint32][]net.Listener // by port
+}
+
+func (s *Server) newTunnelHandler() *tunnelHandler {
+	return &tunnelHandler{s: s, listeners: make(map[uint32][]net.Listener)}
+}
+
+// handleForward is the gssh.RequestHandler for tcpip-forward requests.
+func (h *tunnelHandler) handleForward(ctx gssh.Context, _ *gssh.Server, req *ssh.Request) (bool, []byte) {
+	var r remoteForwardRequest
+	if err := ssh.Unmarshal(req.Payload, &r); err != nil {
+		return false, nil
+	}
+	sn, _, err := h.s.serviceAndUser(ctx)
+	if err != nil || sn == SystemService || sn == CatchService {
+		return false, nil
+	}
+	if r.BindPort == 0 {
+		// The service needs to know the port to reach.
+		return false, nil
+	}
+	conn, ok := ctx.Value(gssh.ContextKeyConn).(*ssh.ServerConn)
+	if !ok {
+		return false, nil
+	}
+	nss, err := h.s.serviceNetNSPaths(sn)
+	if err != nil {
+		log.Printf("tunnel for %q: %v", sn, err)
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.listeners[r.BindPort]; ok {
+		return false, nil
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(int(r.BindPort)))
+	var lns []net.Listener
+	for _, ns := range nss {
+		ln, err := listenInNetNS(ns, addr)
+		if err != nil {
+			log.Printf("tunnel for %q: %v", sn, err)
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return false, nil
+		}
+		lns = append(lns, ln)
+	}
+	h.listeners[r.BindPort] = lns
+	log.Printf("tunnel for %q: forwarding localhost:%d to the client", sn, r.BindPort)
+
+	for _, ln := range lns {
+		go h.serve(conn, ln, r)
+	}
+	go func() {
+		<-ctx.Done()
+		h.cancel(r.BindPort)
+	}()
+	return true, ssh.Marshal(struct{ BindPort uint32 }{r.BindPort})
+}
+
+// handleCancel is the gssh.RequestHandler for cancel-tcpip-forward requests.
+func (h *tunnelHandler) handleCancel(_ gssh.Context, _ *gssh.Server, req *ssh.Request) (bool, []byte) {
+	var r remoteForwardRequest
+	if err := ssh.Unmarshal(req.Payload, &r); err != nil {
+		return false, nil
+	}
+	h.cancel(r.BindPort)
+	return true, nil
+}
+
+func (h *tunnelHandler) cancel(port uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ln := range h.listeners[port] {
+		ln.Close()
+	}
+	delete(h.listeners, port)
+}
+
+// serve forwards the connections accepted by ln to the client over conn
+// until ln is closed.
+func (h *tunnelHandler) serve(conn *ssh.ServerConn, ln net.Listener, r remoteForwardRequest) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		origin, port, _ := net.SplitHostPort(c.RemoteAddr().String())
+		originPort, _ := strconv.Atoi(port)
+		payload := ssh.Marshal(&remoteForwardChannelData{
+			DestAddr:   r.BindAddr,
+			DestPort:   r.BindPort,
+			OriginAddr: origin,
+			OriginPort: uint32(originPort),
+		})
+		go func() {
+			defer c.Close()
+			ch, reqs, err := conn.OpenChannel("forwarded-tcpip", payload)
+			if err != nil {
+				return
+			}
+			defer ch.Close()
+			go ssh.DiscardRequests(reqs)
+			done := make(chan struct{}, 2)
+			go func() {
+				io.Copy(ch, c)
+				ch.CloseWrite()
+				done <- struct{}{}
+			}()
+			go func() {
+				io.Copy(c, ch)
+				done <- struct{}{}
+			}()
+			<-done
+		}()
+	}
+}
+
+// serviceNetNSPaths returns the paths of the network namespaces the service
+// runs in. An empty path is catch's own namespace.
+func (s *Server) serviceNetNSPaths(sn string) ([]string, error) {
+	sv, err := s.serviceView(sn)
+	if err != nil {
+		return nil, err
+	}
+	switch sv.ServiceType() {
+	case db.ServiceTypeSystemd:
+		if _, ok := sv.AsStruct().Artifacts.Gen(db.ArtifactNetNSService, sv.Generation()); ok {
+			ns := netns.Service{ServiceName: sn}
+			return []string{filepath.Join("/var/run/netns", ns.NetNS())}, nil
+		}
+		return []string{""}, nil
+	case db.ServiceTypeDockerCompose:
+		service, err := s.dockerComposeService(sn)
+		if err != nil {
+			return nil, err
+		}
+		pids, err := service.ContainerPIDs()
+		if err != nil {
+			return nil, err
+		}
+		if len(pids) == 0 {
+			return nil, fmt.Errorf("service has no running containers")
+		}
+		return uniqueNetNSPaths(pids), nil
+	default:
+		return nil, fmt.Errorf("tunnels are not supported for %s services", sv.ServiceType())
+	}
+}
+
+// uniqueNetNSPaths returns the paths of the network namespaces of the
+// processes pids, once per namespace: containers of a compose service
+// usually share one, and listening on the same port in it twice fails. A
+// process in catch's own namespace yields an empty path.
+func uniqueNetNSPaths(pids []int) []string {
+	var paths []string
+	var seen []os.FileInfo
+	self, _ := os.Stat("/proc/self/ns/net")
+	for _, pid := range pids {
+		p := fmt.Sprintf("/proc/%d/ns/net", pid)
+		fi, err := os.Stat(p)
+		if err != nil {
+			// Let listenInNetNS report it.
+			paths = append(paths, p)
+			continue
+		}
+		if self != nil && os.SameFile(fi, self) {
+			p = ""
+		}
+		if slices.ContainsFunc(seen, func(o os.FileInfo) bool { return os.SameFile(fi, o) }) {
+			continue
+		}
+		seen = append(seen, fi)
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// listenInNetNS listens on TCP address addr in the network namespace at
+// nsPath, or in catch's own namespace if nsPath is empty.
+func listenInNetNS(nsPath, addr string) (net.Listener, error) {
+	var ln net.Listener
+	var lerr error
+	if err := inNetNS(nsPath, func() { ln, lerr = net.Listen("tcp", addr) }); err != nil {
+		if ln != nil {
+			ln.Close()
+		}
+		return nil, err
+	}
+	return ln, lerr
+}
+
+// dialInNetNS dials addr in the network namespace at nsPath, or in catch's
+// own namespace if nsPath is empty.
+func dialInNetNS(ctx context.Context, nsPath, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	var c net.Conn
+	var derr error
+	if err := inNetNS(nsPath, func() { c, derr = d.DialContext(ctx, network, addr) }); err != nil {
+		if c != nil {
+			c.Close()
+		}
+		return nil, err
+	}
+	return c, derr
+}
@@ -0,0 +1,60 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// inNetNS runs fn with the current thread in the network namespace at nsPath,
+// or just runs fn if nsPath is empty. Sockets stay in the namespace they were
+// created in, so fn can create them for use after inNetNS returns. It returns
+// an error if the namespace can't be entered, in which case fn is not run, or
+// restored.
+func inNetNS(nsPath string, fn func()) error {
+	if nsPath == "" {
+		fn()
+		return nil
+	}
+	ns, err := os.Open(nsPath)
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+
+	runtime.LockOSThread()
+	orig, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer orig.Close()
+	if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to enter %s: %w", nsPath, err)
+	}
+	fn()
+	if err := unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET); err != nil {
+		// Keep the thread locked so that it exits with this goroutine
+		// instead of running others in the wrong namespace.
+		return fmt.Errorf("failed to restore network namespace: %w", err)
+	}
+	runtime.UnlockOSThread()
+	return nil
+}
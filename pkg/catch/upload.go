@@ -0,0 +1,273 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"tailscale.com/util/mak"
+)
+
+// Resumable uploads: files uploaded with an upload ID, the hex prefix of
+// their SHA-256, are received into a part file named after it that is kept
+// when the connection drops. The client asks how many bytes were received
+// and sends the rest, either over the exec channel with
+//
+//	upload --id=<id> --offset=<n> [--stage] < rest-of-file
+//
+// or over SFTP to /upload/<id> or /stage/upload/<id>, which `sftp reput`
+// resumes by itself. The file is only installed once its hash matches the ID;
+// a part file that doesn't match once all of it was sent is discarded. Only
+// one upload of a file writes into its part file at a time.
+//
+// For throughput on high-latency links, the client can also send ranges of
+// the file over parallel SSH connections with
+//
+//	upload --id=<id> --part-at=<offset> < range
+//
+// which only write the range into a separate ranges file, so that a partial
+// parallel upload is never resumed from, and then install it with
+//
+//	upload --id=<id> --join [--stage]
+//
+// which makes the ranges file the part file.
+
+// uploadIDRE matches upload IDs.
+var uploadIDRE = regexp.MustCompile(`^[0-9a-f]{16,64}$`)
+
+// staleUploadAge is how long incomplete uploads are kept.
+const staleUploadAge = 24 * time.Hour
+
+// uploadPartPath returns the path of the part file of upload id of service
+// sn.
+func (s *Server) uploadPartPath(sn, id string) string {
+	return filepath.Join(s.serviceBinDir(sn), "upload-"+id+".part")
+}
+
+// uploadRangesPath returns the path of the file the ranges of upload id of
+// service sn sent in parallel are written to.
+func (s *Server) uploadRangesPath(sn, id string) string {
+	return filepath.Join(s.serviceBinDir(sn), "upload-"+id+"-ranges.part")
+}
+
+// uploadReceived returns how many bytes of upload id of service sn were
+// received.
+func (s *Server) uploadReceived(sn, id string) int64 {
+	st, err := os.Stat(s.uploadPartPath(sn, id))
+	if err != nil {
+		return 0
+	}
+	return st.Size()
+}
+
+// removeStaleUploads removes the incomplete uploads of service sn older than
+// staleUploadAge.
+func (s *Server) removeStaleUploads(sn string) {
+	parts, _ := filepath.Glob(filepath.Join(s.serviceBinDir(sn), "upload-*.part"))
+	for _, p := range parts {
+		if st, err := os.Stat(p); err == nil && time.Since(st.ModTime()) > staleUploadAge {
+			log.Printf("Removing stale upload %s", p)
+			os.Remove(p)
+		}
+	}
+}
+
+// parseUploadPath returns the upload ID of the SFTP path p of a resumable
+// upload, /upload/<id> or /stage/upload/<id>, and whether it is staged.
+func parseUploadPath(p string) (id string, stage, ok bool) {
+	if id, ok = strings.CutPrefix(p, "/stage/upload/"); ok {
+		stage = true
+	} else if id, ok = strings.CutPrefix(p, "/upload/"); !ok {
+		return "", false, false
+	}
+	if !uploadIDRE.MatchString(id) {
+		return "", false, false
+	}
+	return id, stage, true
+}
+
+// lockUpload reserves the part file of upload id of service sn, so that two
+// uploads of the same file don't write into it at once. It returns a func to
+// release it.
+func (s *Server) lockUpload(sn, id string) (unlock func(), _ error) {
+	p := s.uploadPartPath(sn, id)
+	s.uploads.mu.Lock()
+	defer s.uploads.mu.Unlock()
+	if s.uploads.active.Contains(p) {
+		return nil, fmt.Errorf("upload %s is already in progress", id)
+	}
+	mak.Set(&s.uploads.active, p, struct{}{})
+	return func() {
+		s.uploads.mu.Lock()
+		defer s.uploads.mu.Unlock()
+		s.uploads.active.Delete(p)
+	}, nil
+}
+
+// openUploadPart opens the part file of the upload, truncated to
+// UploadOffset so that writes continue from there.
+func (i *FileInstaller) openUploadPart() (*os.File, error) {
+	if !uploadIDRE.MatchString(i.cfg.UploadID) {
+		return nil, fmt.Errorf("invalid upload id %q", i.cfg.UploadID)
+	}
+	if i.cfg.UploadJoin {
+		if err := os.Rename(i.s.uploadRangesPath(i.cfg.ServiceName, i.cfg.UploadID), i.tempFilePath()); err != nil {
+			return nil, fmt.Errorf("failed to join upload ranges: %w", err)
+		}
+		i.cfg.UploadOffset = i.s.uploadReceived(i.cfg.ServiceName, i.cfg.UploadID)
+	}
+	f, err := os.OpenFile(i.tempFilePath(), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if off := i.cfg.UploadOffset; off < 0 || off > st.Size() {
+		f.Close()
+		return nil, fmt.Errorf("cannot resume upload %s at %d, only %d bytes were received", i.cfg.UploadID, off, st.Size())
+	}
+	if err := f.Truncate(i.cfg.UploadOffset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(i.cfg.UploadOffset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// verifyUpload checks that the part file of the upload is the whole file by
+// comparing its hash with the upload ID. It is only called once the client
+// sent all of the file, so a part file that doesn't match is removed.
+func (i *FileInstaller) verifyUpload() error {
+	p := i.tempFilePath()
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(hex.EncodeToString(h.Sum(nil)), i.cfg.UploadID) {
+		// Resuming it would only append to it.
+		os.Remove(p)
+		return fmt.Errorf("upload %s does not match its hash after %d bytes and was discarded; upload it again", i.cfg.UploadID, n)
+	}
+	return nil
+}
+
+// uploadCmdFunc receives a resumable upload from stdin, or prints how many
+// bytes of it were received with --status. With --part-at it only receives a
+// range of it, and with --join it installs the ranges received.
+func (e *ttyExecer) uploadCmdFunc(cmd *cobra.Command, _ []string) error {
+	if e.sn == SystemService || e.sn == CatchService {
+		return fmt.Errorf("cannot upload to %q", e.sn)
+	}
+	id, _ := cmd.Flags().GetString("id")
+	if !uploadIDRE.MatchString(id) {
+		return fmt.Errorf("invalid upload id %q", id)
+	}
+	if status, _ := cmd.Flags().GetBool("status"); status {
+		e.printf("%d\n", e.s.uploadReceived(e.sn, id))
+		return nil
+	}
+	if cmd.Flags().Changed("part-at") {
+		at, _ := cmd.Flags().GetInt64("part-at")
+		return e.s.writeUploadRange(e.sn, e.user, id, at, cmd.InOrStdin())
+	}
+	offset, _ := cmd.Flags().GetInt64("offset")
+	cfg := FileInstallerCfg{
+		InstallerCfg: e.installerCfg(),
+		StageOnly:    First(cmd.Flags().GetBool("stage")),
+		UploadID:     id,
+		UploadOffset: offset,
+		UploadJoin:   First(cmd.Flags().GetBool("join")),
+	}
+	inst, err := NewFileInstaller(e.s, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create installer: %w", err)
+	}
+	if _, err := io.Copy(inst, cmd.InOrStdin()); err != nil {
+		inst.Fail()
+		inst.Close()
+		return fmt.Errorf("upload interrupted: %w", err)
+	}
+	return inst.Close()
+}
+
+// writeUploadRange writes the range of upload id of service sn starting at
+// offset at from r into its ranges file.
+func (s *Server) writeUploadRange(sn, user, id string, at int64, r io.Reader) error {
+	if at < 0 {
+		return fmt.Errorf("invalid offset %d", at)
+	}
+	if err := s.ensureDirs(sn, user); err != nil {
+		return fmt.Errorf("failed to ensure directories: %w", err)
+	}
+	f, err := os.OpenFile(s.uploadRangesPath(sn, id), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.NewOffsetWriter(f, at), r); err != nil {
+		f.Close()
+		return fmt.Errorf("upload interrupted: %w", err)
+	}
+	return f.Close()
+}
+
+// uploadPart returns the installer for the SFTP upload to the resumable path
+// p. Unless trunc is set, writes continue after the bytes already received.
+func (f *fileHandler) uploadPart(p, id string, stage, trunc bool) (*FileInstaller, error) {
+	sn, user, err := f.s.serviceAndUser(f.session)
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	if !trunc {
+		offset = f.s.uploadReceived(sn, id)
+	}
+	fi, err := NewFileInstaller(f.s, FileInstallerCfg{
+		InstallerCfg: InstallerCfg{
+			ServiceName:      sn,
+			SSHSessionCloser: f.session,
+			User:             user,
+		},
+		StageOnly:    stage,
+		UploadID:     id,
+		UploadOffset: offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.fileMapping.Store(p, fi)
+	return fi, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// uploadTestServer returns a server with the directories of service sn.
+func uploadTestServer(t *testing.T, sn string) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	s := &Server{cfg: Config{
+		DB:           db.NewStore(filepath.Join(dir, "db.json"), filepath.Join(dir, "services")),
+		ServicesRoot: filepath.Join(dir, "services"),
+	}}
+	if err := s.ensureDirs(sn, ""); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// uploadID returns the upload ID of b, as the client derives it.
+func uploadID(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])[:16]
+}
+
+// writeUploadPart writes b into the part file of the upload of i, resuming
+// it at i.cfg.UploadOffset.
+func writeUploadPart(t *testing.T, i *FileInstaller, b []byte) {
+	t.Helper()
+	f, err := i.openUploadPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadResume(t *testing.T) {
+	s := uploadTestServer(t, "web")
+	file := bytes.Repeat([]byte("0123456789"), 1000)
+	id := uploadID(file)
+	upload := func(offset int64) *FileInstaller {
+		return &FileInstaller{s: s, cfg: FileInstallerCfg{
+			InstallerCfg: InstallerCfg{ServiceName: "web"},
+			UploadID:     id,
+			UploadOffset: offset,
+		}}
+	}
+
+	writeUploadPart(t, upload(0), file[:4000])
+	if got := s.uploadReceived("web", id); got != 4000 {
+		t.Fatalf("uploadReceived = %d, want 4000", got)
+	}
+	if _, err := upload(5000).openUploadPart(); err == nil {
+		t.Fatal("resuming past the bytes received succeeded")
+	}
+	// Resuming before the end drops what was received after it.
+	writeUploadPart(t, upload(3000), file[3000:6000])
+	if got := s.uploadReceived("web", id); got != 6000 {
+		t.Fatalf("uploadReceived = %d, want 6000", got)
+	}
+	writeUploadPart(t, upload(6000), file[6000:])
+	if err := upload(0).verifyUpload(); err != nil {
+		t.Fatalf("verifyUpload of the complete upload: %v", err)
+	}
+	got, err := os.ReadFile(s.uploadPartPath("web", id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, file) {
+		t.Error("resumed upload differs from the file")
+	}
+}
+
+func TestUploadJoin(t *testing.T) {
+	s := uploadTestServer(t, "web")
+	file := bytes.Repeat([]byte("abcdefghij"), 1000)
+	id := uploadID(file)
+	// Ranges arrive in any order over parallel connections.
+	for _, at := range []int{5000, 0, 2500, 7500} {
+		if err := s.writeUploadRange("web", "", id, int64(at), bytes.NewReader(file[at:at+2500])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.uploadReceived("web", id); got != 0 {
+		t.Errorf("uploadReceived before join = %d, want 0", got)
+	}
+	i := &FileInstaller{s: s, cfg: FileInstallerCfg{
+		InstallerCfg: InstallerCfg{ServiceName: "web"},
+		UploadID:     id,
+		UploadJoin:   true,
+	}}
+	writeUploadPart(t, i, nil)
+	if i.cfg.UploadOffset != int64(len(file)) {
+		t.Errorf("UploadOffset after join = %d, want %d", i.cfg.UploadOffset, len(file))
+	}
+	if err := i.verifyUpload(); err != nil {
+		t.Fatalf("verifyUpload of the joined upload: %v", err)
+	}
+	if _, err := os.Stat(s.uploadRangesPath("web", id)); !os.IsNotExist(err) {
+		t.Errorf("ranges file still exists after join: %v", err)
+	}
+}
+
+func TestVerifyUploadMismatch(t *testing.T) {
+	s := uploadTestServer(t, "web")
+	id := uploadID([]byte("the file"))
+	i := &FileInstaller{s: s, cfg: FileInstallerCfg{
+		InstallerCfg: InstallerCfg{ServiceName: "web"},
+		UploadID:     id,
+	}}
+	writeUploadPart(t, i, []byte("the fil3"))
+	if err := i.verifyUpload(); err == nil {
+		t.Fatal("verifyUpload of a corrupt upload succeeded")
+	}
+	if _, err := os.Stat(s.uploadPartPath("web", id)); !os.IsNotExist(err) {
+		t.Errorf("part file of the corrupt upload was kept: %v", err)
+	}
+}
+
+func TestLockUpload(t *testing.T) {
+	s := &Server{}
+	unlock, err := s.lockUpload("web", "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.lockUpload("web", "0123456789abcdef"); err == nil {
+		t.Error("second upload of the same file got the lock")
+	}
+	unlockOther, err := s.lockUpload("api", "0123456789abcdef")
+	if err != nil {
+		t.Errorf("upload of the same file to another service: %v", err)
+	} else {
+		unlockOther()
+	}
+	unlock()
+	unlock, err = s.lockUpload("web", "0123456789abcdef")
+	if err != nil {
+		t.Errorf("upload after the first finished: %v", err)
+	} else {
+		unlock()
+	}
+}
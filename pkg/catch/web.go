@@ -70,5 +70,7 @@ func (s *Server) WebMux() (http.Handler, error) {
 	mux.Handle("/v2/", s.registry)
 	// Mount the API handler at /api/v0/.
 	mux.Handle("/api/v0/", s.handleAPI())
+	mux.Handle("/share/", s.ShareHandler())
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
 	return mux, nil
 }
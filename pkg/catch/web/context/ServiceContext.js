@@ -179,12 +179,7 @@ export const ServiceProvider = ({ children }) => {
     connectWebSocket();
 
     // Fetch initial state
-    const url = new URL("/api/v0/run-command", window.location.origin);
-    url.searchParams.set("command", "status");
-    url.searchParams.set("service", "sys");
-    url.searchParams.set("tty", "false");
-    url.searchParams.set("args", "--format=json");
-    fetch(url)
+    fetch("/api/v0/status")
       .then((response) => response.json())
       .then((services) => {
         dispatch({ type: ActionTypes.INITIALIZE_SERVICES, payload: services });
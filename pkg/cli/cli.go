@@ -18,6 +18,7 @@ import (
 	"io"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -46,16 +47,37 @@ func (h *CommandHandler) RootCmd(name string) *cobra.Command {
 	cmd.SetOutput(h.client)
 
 	cmd.AddCommand(
+		h.buildCmd(),
 		h.cronCmd(),
+		h.approveCmd(),
+		h.denyCmd(),
+		h.diffCmd(),
 		h.disableCmd(),
 		h.editCmd(),
 		h.envCmd(),
 		h.enableCmd(),
 		h.eventsCmd(),
+		h.auditCmd(),
+		h.lintCmd(),
+		h.execCmd(),
+		h.generationsCmd(),
+		h.healthCmd(),
+		h.externalCmd(),
 		h.logsCmd(),
 		h.mountCmd(),
+		h.imageCmd(),
+		h.imagesCmd(),
+		h.labelCmd(),
+		h.lsCmd(),
+		h.trustCmd(),
+		h.blockSumsCmd(),
+		h.uploadCmd(),
+		h.secretCmd(),
+		h.shareCmd(),
 		h.ipCmd(),
+		h.netCmd(),
 		h.umountCmd(),
+		h.convertCmd(),
 		h.removeCmd(),
 		h.restartCmd(),
 		h.rollbackCmd(),
@@ -63,8 +85,18 @@ func (h *CommandHandler) RootCmd(name string) *cobra.Command {
 		h.startCmd(),
 		h.stageCmd(),
 		h.statusCmd(),
+		h.tailCmd(),
+		h.templateCmd(),
+		h.topCmd(),
 		h.tsCmd(),
 		h.stopCmd(),
+		h.undeleteCmd(),
+		h.sysCmd(),
+		h.gcCmd(),
+		h.registryCmd(),
+		h.quadletCmd(),
+		h.runtimeCmd(),
+		h.protectCmd(),
 		h.versionCmd(),
 	)
 
@@ -101,6 +133,12 @@ func (h *CommandHandler) envCmd() *cobra.Command {
 		Short: "Manage environment variables",
 		RunE:  h.runE,
 	}
+	c.AddCommand(&cobra.Command{
+		Use:   "pubkey",
+		Short: "Print the public key env values are sealed to",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	})
 	return c
 }
 
@@ -162,6 +200,17 @@ func (h *CommandHandler) stageCmd() *cobra.Command {
 	cmd.Flags().String("macvlan-mac", "", "Macvlan interface mac address to use; when net=macvlan")
 	cmd.Flags().Int("macvlan-vlan", 0, "Macvlan VLAN ID to use; when net=macvlan")
 	cmd.Flags().String("macvlan-parent", "", "Macvlan parent interface; when net=macvlan")
+	cmd.Flags().String("data-dir", "", "Absolute path to use as the service data directory instead of the default")
+	cmd.Flags().Duration("watchdog", 0, "Restart the service if it does not ping the systemd watchdog within this interval, 0 to turn it off; binary services only")
+	cmd.Flags().Bool("allow-privileged", false, "Allow privileged containers in a compose file; =false disallows them again")
+	cmd.Flags().Float64("cpu", 0, "Limit the service to this many CPUs, e.g. 0.5; 0 removes the limit")
+	cmd.Flags().String("memory", "", "Limit the memory of the service, e.g. 512M or 2G; 0 removes the limit")
+	cmd.Flags().Int("io-weight", 0, "Block IO weight of the service relative to others, 1-10000 (default 100); 0 removes it")
+	cmd.Flags().StringSlice("needs", nil, "Services this service needs; it is started after and stopped with them")
+	cmd.Flags().String("metrics", "", "Port and optional path Prometheus scrapes metrics from, e.g. 9100 or 8080/stats; empty removes it")
+	cmd.Flags().Int("keep-generations", 0, "Number of previous generations to keep for rollbacks; 0 uses the host default")
+	cmd.Flags().String("runtime", "", "How pushed images run: compose, or oci for a single container run by a systemd unit")
+	cmd.Flags().Bool("require-signed", false, "Only accept files and images signed by a key added with trust add-key; only trust require turns it off")
 
 	show := &cobra.Command{
 		Use:   "show",
@@ -169,6 +218,7 @@ func (h *CommandHandler) stageCmd() *cobra.Command {
 		RunE:  h.runE,
 	}
 	show.PersistentFlags().Bool("env", false, "Show environment variables")
+	show.Flags().Bool("diff", false, "Show what committing would change compared to the running generation, as JSON")
 	cmd.AddCommand(show)
 	cmd.AddCommand(&cobra.Command{
 		Use:   "clear",
@@ -182,6 +232,9 @@ func (h *CommandHandler) stageCmd() *cobra.Command {
 		RunE:  h.runE,
 	}
 	commit.PersistentFlags().Bool("restart", true, "Whether to restart the service after committing")
+	commit.PersistentFlags().Int("if-generation", 0, "Only commit if the service is currently at this generation")
+	commit.PersistentFlags().Bool("no-auto-rollback", false, "Don't roll back to the previous generation if the service crashes right after a deploy; kept for future deploys, including registry pushes")
+	commit.PersistentFlags().Duration("rollback-grace", 10*time.Second, "How long to watch the service for crashes after the deploy")
 	cmd.AddCommand(commit)
 	return cmd
 }
@@ -205,41 +258,82 @@ func (h *CommandHandler) runCmd() *cobra.Command {
 	cmd.Flags().String("macvlan-mac", "", "Macvlan interface mac address to use; when net=macvlan")
 	cmd.Flags().Int("macvlan-vlan", 0, "Macvlan VLAN ID to use; when net=macvlan")
 	cmd.Flags().String("macvlan-parent", "", "Macvlan parent interface; when net=macvlan")
+	cmd.Flags().String("data-dir", "", "Absolute path to use as the service data directory instead of the default")
+	cmd.Flags().Duration("watchdog", 0, "Restart the service if it does not ping the systemd watchdog within this interval, 0 to turn it off; binary services only")
+	cmd.Flags().Bool("allow-privileged", false, "Allow privileged containers in a compose file; =false disallows them again")
+	cmd.Flags().Float64("cpu", 0, "Limit the service to this many CPUs, e.g. 0.5; 0 removes the limit")
+	cmd.Flags().String("memory", "", "Limit the memory of the service, e.g. 512M or 2G; 0 removes the limit")
+	cmd.Flags().Int("io-weight", 0, "Block IO weight of the service relative to others, 1-10000 (default 100); 0 removes it")
+	cmd.Flags().StringSlice("needs", nil, "Services this service needs; it is started after and stopped with them")
+	cmd.Flags().String("metrics", "", "Port and optional path Prometheus scrapes metrics from, e.g. 9100 or 8080/stats; empty removes it")
+	cmd.Flags().Int("keep-generations", 0, "Number of previous generations to keep for rollbacks; 0 uses the host default")
+	cmd.Flags().String("runtime", "", "How pushed images run: compose, or oci for a single container run by a systemd unit")
+	cmd.Flags().Bool("require-signed", false, "Only accept files and images signed by a key added with trust add-key; only trust require turns it off")
 	cmd.Flags().Bool("restart", true, "Whether to restart the service after installation")
+	cmd.Flags().Int("if-generation", 0, "Only install if the service is currently at this generation")
+	cmd.Flags().Bool("no-auto-rollback", false, "Don't roll back to the previous generation if the service crashes right after a deploy; kept for future deploys, including registry pushes")
+	cmd.Flags().Duration("rollback-grace", 10*time.Second, "How long to watch the service for crashes after the deploy")
+	cmd.Flags().Bool("no-progress", false, "Don't print the progress of the upload")
 
 	return cmd
 }
 
 func (h *CommandHandler) startCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "Start a service",
 		RunE:  h.runE,
 	}
+	cmd.Flags().String("reason", "", "Reason for the start, shown in status and events")
+	cmd.Flags().Bool("no-deps", false, "Do not start the services this service depends on")
+	return cmd
 }
 
 func (h *CommandHandler) stopCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "stop",
 		Short: "Stop a service",
 		RunE:  h.runE,
 	}
+	cmd.Flags().String("reason", "", "Reason for the stop, shown in status and events")
+	cmd.Flags().Bool("no-deps", false, "Do not stop the services that need this service")
+	return cmd
 }
 
 func (h *CommandHandler) rollbackCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "rollback",
 		Short: "Rollback a service",
 		RunE:  h.runE,
 	}
+	cmd.Flags().Int("to", 0, "Generation to roll back to instead of the previous one, see yeet generations")
+	cmd.Flags().String("digest", "", "Roll back to the newest generation with this image digest or binary sha256 (sha256:...)")
+	return cmd
+}
+
+func (h *CommandHandler) generationsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generations",
+		Short: "List the retained generations of a service",
+		Long: `List the generations of a service that can be rolled back to, newest first,
+with when and by whom they were deployed, the hashes of their binary and
+compose file, their image digests and which one is active.`,
+		Example: "  yeet generations web\n  yeet rollback web --to=3",
+		Args:    cobra.NoArgs,
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("format", "table", "Output format (table, json, json-pretty)")
+	return cmd
 }
 
 func (h *CommandHandler) restartCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "restart",
 		Short: "Restart a service",
 		RunE:  h.runE,
 	}
+	cmd.Flags().String("reason", "", "Reason for the restart, shown in status and events")
+	return cmd
 }
 
 func (h *CommandHandler) editCmd() *cobra.Command {
@@ -251,6 +345,7 @@ func (h *CommandHandler) editCmd() *cobra.Command {
 	edit.PersistentFlags().Bool("env", false, "Edit environment variables")
 	edit.PersistentFlags().Bool("config", false, "Edit internal configuration")
 	edit.PersistentFlags().Bool("ts", false, "Edit Tailscale configuration")
+	edit.PersistentFlags().Bool("force", false, "Edit even if someone else is editing the service")
 	// TODO: We have to add this flag otherwise restart=false which is not what we want
 	edit.PersistentFlags().Bool("restart", true, "Whether to restart the service after editing")
 	return edit
@@ -274,12 +369,602 @@ func (h *CommandHandler) disableCmd() *cobra.Command {
 
 func (h *CommandHandler) logsCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "logs",
-		Short: "Show logs of a service",
-		RunE:  h.runE,
+		Use:     "logs",
+		Short:   "Show logs of a service",
+		Example: "  yeet logs web --since=2h --until=1h --grep='panic|fatal'",
+		RunE:    h.runE,
 	}
 	cmd.Flags().BoolP("follow", "f", false, "Follow the logs")
 	cmd.Flags().IntP("lines", "n", -1, "Number of lines to show from the end of the logs")
+	cmd.Flags().String("since", "", `Show logs since a time, either a duration ago like "2h" or a timestamp like "2025-01-02 15:04"`)
+	cmd.Flags().String("until", "", `Show logs until a time, either a duration ago like "1h" or a timestamp`)
+	cmd.Flags().String("grep", "", "Only show lines matching the regular expression")
+	cmd.Flags().String("download", "", "Save the logs to a gzip file instead of showing them; interrupted downloads resume when run again")
+	cmd.Flags().String("rate-limit", "10M", "Bytes per second to download logs at with --download; 0 for no limit")
+	cmd.Flags().Int64("offset", 0, "Byte offset to resume a --download from")
+	cmd.Flags().MarkHidden("offset")
+	return cmd
+}
+
+func (h *CommandHandler) tailCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tail [-g <pattern>] [-l <key=value>] [service...]",
+		Short: "Show the merged logs of multiple services",
+		RunE:  h.runE,
+	}
+	cmd.Flags().StringP("group", "g", "", "Tail all services whose name matches the glob pattern")
+	cmd.Flags().StringArrayP("label", "l", nil, "Tail all services with this label, as key=value or key; with -g, only those that also match the pattern")
+	cmd.Flags().BoolP("follow", "f", true, "Follow the logs")
+	cmd.Flags().IntP("lines", "n", 10, "Number of lines to show from the end of the logs of each service")
+	return cmd
+}
+
+func (h *CommandHandler) sysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sys",
+		Short: "Manage host-wide catch settings",
+	}
+	tsDefaults := &cobra.Command{
+		Use:   "ts-defaults",
+		Short: "Show or set the default tags of service tailscale nodes",
+		Long: `Show or set the default tags of service tailscale nodes.
+
+The default tags, and the host's own tags if --inherit-host-tags is set, are
+added to the tags of every service deployed with --net=ts. Without flags the
+current defaults are printed.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	}
+	tsDefaults.Flags().StringSlice("tags", nil, "Default tags, e.g. tag:yeet-svc; pass an empty value to clear")
+	tsDefaults.Flags().Bool("inherit-host-tags", false, "Whether to also add the tags of the catch host")
+	cmd.AddCommand(tsDefaults)
+
+	commit := &cobra.Command{
+		Use:   "commit <svc>...",
+		Short: "Commit the staged configuration of multiple services concurrently",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.runE,
+	}
+	commit.Flags().Int("parallel", 4, "Maximum number of services to install at once")
+	commit.Flags().Bool("atomic", false, "Roll back all services if any of them fails to install")
+	cmd.AddCommand(commit)
+
+	cmd.AddCommand(h.gcCmd())
+
+	autodeploy := &cobra.Command{
+		Use:   "autodeploy [on|off]",
+		Short: "Show or set whether pushes of the run tag install the image",
+		Long: `Show or set whether registry pushes of the run tag deploy the image on this
+host. When off, run pushes are treated like latest and only staged, on every
+service, e.g. during a freeze or while debugging a bad CI pipeline.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: h.runE,
+	}
+	autodeploy.Flags().String("reason", "", "Why auto-deploys are turned off, shown in status")
+	cmd.AddCommand(autodeploy)
+
+	orphans := &cobra.Command{
+		Use:   "orphans [list | adopt <svc> | destroy <svc>]",
+		Short: "Manage docker compose projects of catch that have no service",
+		Long: `List the docker compose projects named like the ones catch creates but with no
+service, e.g. left over from a crash during a remove or from running docker
+compose by hand. adopt turns one into a service using the compose file it was
+started with; destroy takes it down.`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: h.runE,
+	}
+	orphans.Flags().Bool("volumes", false, "Also remove the volumes of destroyed projects")
+	cmd.AddCommand(orphans)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "defaults [list | set <flag>=<value>... | unset <flag>...]",
+		Short: "Manage the default run and stage flags of new services",
+		Long: `Manage host-wide defaults of run and stage flags, e.g. net=ts or
+allow-privileged=true. They apply to services that have not been installed
+yet, unless the flag is given explicitly; installed services keep their
+configuration.`,
+		Example: "  yeet sys defaults set net=ts ts-tags=tag:web\n  yeet sys defaults unset net",
+		RunE:    h.runE,
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "motd [show | edit | clear] [svc]",
+		Short: "Manage the host banner and the notices of services",
+		Long: `Show, edit or clear the host banner, shown at the start of interactive
+sessions, e.g. for maintenance notices or contact info. Given a service, manage
+its notice instead, shown before commands that change the service such as run,
+stage, stop or remove. edit opens $EDITOR and needs a terminal.`,
+		Example: "  yeet sys motd edit\n  yeet sys motd edit billing",
+		Args:    cobra.MaximumNArgs(2),
+		RunE:    h.runE,
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "prometheus-sd",
+		Short: "Print the Prometheus scrape targets of the services",
+		Long: `Print the services deployed with --metrics as Prometheus file service
+discovery targets. The same list is served for HTTP service discovery at
+/api/v0/prometheus-sd.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	})
+
+	migrateUnits := &cobra.Command{
+		Use:   "migrate-units",
+		Short: "Re-render generated units of services with the current templates",
+		Long: `Re-render the systemd units and compose network files generated for services
+with older templates, so that fixes in the templates of a newer catch reach
+existing services. The new files are staged per service; commit them with
+yeet sys commit.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	}
+	migrateUnits.Flags().Bool("dry-run", false, "Only list the services with outdated units")
+	cmd.AddCommand(migrateUnits)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "selfcheck",
+		Short: "Check that the host can run services",
+		Long: `Check that catch is reachable over SSH on the tailnet, that systemd, docker
+compose and network namespaces work, and that the registry can store and serve
+images. Prints a pass/fail report and fails if any check failed.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	})
+	return cmd
+}
+
+// gcCmd returns the gc command, which is available both as `sys gc` and as a
+// top-level command.
+func (h *CommandHandler) gcCmd() *cobra.Command {
+	gc := &cobra.Command{
+		Use:   "gc",
+		Short: "Clean up old generations, registry data, images, orphaned units and archives",
+		Long: `Clean up old generations, unreferenced registry manifests and blobs, unused
+image root filesystems, dangling docker images, the units and network
+namespaces of removed services, and expired archives.
+
+With --every, schedule catch to run the cleanup periodically instead; pass 0
+to disable it. With --keep-generations, set how many previous generations of
+each service are kept for rollbacks, unless the service sets its own; pass 0
+for the default of 10.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	}
+	gc.Flags().Bool("dry-run", false, "Only report what would be removed")
+	gc.Flags().BoolP("verbose", "v", false, "List every removed item")
+	gc.Flags().Duration("every", 0, "Run the cleanup periodically at this interval")
+	gc.Flags().Int("keep-generations", 0, "Number of previous generations of each service to keep")
+	return gc
+}
+
+func (h *CommandHandler) protectCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "protect [on|off]",
+		Short: "Show or set whether deploys of the service need a second person's approval",
+		Long: `Show or set whether the service is protected. Deploys of a protected
+service, whether committed, pushed with the run tag, rolled back or undeleted,
+are held until someone other than the requester runs approve within an hour.
+Its config can't be edited with edit --config.
+
+Turning the protection off must be confirmed by a second person running
+protect off within an hour.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: h.runE,
+	}
+}
+
+func (h *CommandHandler) approveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "approve",
+		Short: "Approve and install the pending deploy of a protected service",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	}
+}
+
+func (h *CommandHandler) denyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "deny",
+		Short: "Deny the pending deploy of a protected service",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	}
+}
+
+func (h *CommandHandler) quadletCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "quadlet [on|off]",
+		Short: "Show or set whether pushed images run as podman quadlets instead of compose",
+		Long: `Show or set whether pushed images for the service are rendered as podman
+quadlet .container and .network files managed by systemd instead of a docker
+compose file. The setting takes effect on the next push.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: h.runE,
+	}
+}
+
+func (h *CommandHandler) runtimeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "runtime [compose|oci]",
+		Short: "Show or set whether pushed images run with compose or as a single container",
+		Long: `Show or set how pushed images for the service are run. With compose, the
+default, a docker compose file is generated for the image. With oci, catch
+generates a systemd unit that pulls the image from its registry and runs it
+with docker run, or nerdctl on hosts with only containerd. The setting takes
+effect on the next push.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: h.runE,
+	}
+}
+
+func (h *CommandHandler) externalCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "external",
+		Short: "Monitor a systemd unit or docker container that yeet does not manage",
+		Long: `Register the service as a reference to an existing systemd unit or docker
+container. Its status, logs and events show up in yeet, but yeet never
+installs, starts, stops or removes it. Removing the service only forgets it.`,
+		Example: "  yeet external nginx --unit=nginx.service",
+		Args:    cobra.NoArgs,
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("unit", "", "Name of the systemd unit")
+	cmd.Flags().String("container", "", "Name of the docker container")
+	return cmd
+}
+
+func (h *CommandHandler) execCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec <svc> -- <cmd> [args...]",
+		Short: "Run a one-off command in the environment of a service",
+		Long: `Run a one-off command in the environment of a service. For docker compose
+services it runs in the main container, the one named after the service or the
+only running one. For systemd services it runs as a transient unit with the
+user, env file, working directory, network namespace and sandbox of the
+service's unit.`,
+		Example: "  yeet exec web -- sh -c 'echo $DATABASE_URL'",
+		Args:    cobra.MinimumNArgs(1),
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("container", "", "Compose service to run the command in")
+	return cmd
+}
+
+func (h *CommandHandler) healthCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Show or set the health check of a service",
+		Long: `Show or set the health check of a systemd service. catch probes the service
+in its network namespace every --interval and reports it as unhealthy in status
+after --retries consecutive failures. An --exec probe runs like the service:
+as its user, with its env file and in its root directory and sandbox. Without
+flags the current check and its result are printed.
+
+Docker compose services report the healthchecks of their containers instead.`,
+		Example: "  yeet health web --http=http://localhost:8080/healthz --interval=10s",
+		Args:    cobra.NoArgs,
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("http", "", "URL that must respond with a status below 400")
+	cmd.Flags().String("tcp", "", "host:port that must accept connections")
+	cmd.Flags().String("exec", "", "Shell command that must exit with status 0")
+	cmd.Flags().Duration("interval", 30*time.Second, "Time between probes")
+	cmd.Flags().Duration("timeout", 5*time.Second, "Timeout of each probe")
+	cmd.Flags().Int("retries", 3, "Consecutive failures after which the service is unhealthy")
+	cmd.Flags().Bool("off", false, "Remove the health check")
+	return cmd
+}
+
+func (h *CommandHandler) imageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Manage the images of a service",
+	}
+	replicate := &cobra.Command{
+		Use:   "replicate <svc> --to=<host>[,<host>...]",
+		Short: "Copy the staged images of a service to other catch hosts",
+		Long: `Copy the staged images of a service from this host's registry to the
+registries of other catch hosts over the tailnet. With --auto, new images of the
+service are replicated as they arrive.`,
+		Example: "  yeet image replicate web --to=edge-1,edge-2 --run",
+		Args:    cobra.NoArgs,
+		RunE:    h.runE,
+	}
+	replicate.Flags().StringSlice("to", nil, "Hosts to replicate to")
+	replicate.Flags().Bool("run", false, "Deploy the images on arrival instead of only staging them")
+	replicate.Flags().Bool("auto", false, "Replicate new images to the --to hosts automatically; --auto=false disables it")
+	cmd.AddCommand(replicate)
+	return cmd
+}
+
+func (h *CommandHandler) trustCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Manage the keys signatures of files and images are verified against",
+		Long: `Manage the minisign and cosign public keys that signatures are verified against
+for services deployed with --require-signed. Such services only accept files
+signed with minisign, deployed with their .minisig next to them, and images
+signed with cosign in the internal registry. Rollbacks to generations staged
+without a signature are refused too.
+
+An unsigned image pushed to such a service is refused but kept by digest: sign
+it with cosign sign <registry>/<svc>/<name>@<digest> and push the tag again.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:     "add-key <name> [key]",
+		Short:   "Trust a minisign or PEM encoded cosign public key, read from stdin if not given",
+		Example: "  yeet trust add-key release < minisign.pub\n  yeet trust add-key ci < cosign.pub",
+		Args:    cobra.RangeArgs(1, 2),
+		RunE:    h.runE,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the trusted keys",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "require <svc> [on|off]",
+		Short: "Show or set whether the service only accepts signed files and images",
+		Long: `Show or set whether the service only accepts signed files and images, as
+--require-signed does. It can only be turned off with this command, not by
+deploying with --require-signed=false.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: h.runE,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm <name>",
+		Short: "Stop trusting a key",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.runE,
+	})
+	return cmd
+}
+
+func (h *CommandHandler) blockSumsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:    "block-sums",
+		Short:  "Print the block checksums yeet makes binary deltas against",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE:   h.runE,
+	}
+}
+
+func (h *CommandHandler) uploadCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "upload",
+		Short:  "Receive a resumable upload of a file from stdin",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE:   h.runE,
+	}
+	cmd.Flags().String("id", "", "Hex prefix of the SHA-256 of the file")
+	cmd.Flags().Int64("offset", 0, "Offset in the file stdin starts at")
+	cmd.Flags().Bool("stage", false, "Stage the file instead of installing it")
+	cmd.Flags().Bool("status", false, "Print how many bytes of the upload were received")
+	cmd.Flags().Int64("part-at", 0, "Only write stdin at this offset of the upload, for parallel streams")
+	cmd.Flags().Bool("join", false, "Install the ranges written with --part-at")
+	return cmd
+}
+
+func (h *CommandHandler) lsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the services of the host with their owner, labels and description",
+		Long: `List the services of the host from its catalog, optionally only those with
+all the given labels or matching a search. The catalog is also served at
+/api/v0/catalog, e.g. /api/v0/catalog?label=team=infra&q=db.`,
+		Example: "  yeet ls -l team=infra\n  yeet ls --search=postgres",
+		Args:    cobra.NoArgs,
+		RunE:    h.runE,
+	}
+	cmd.Flags().StringArrayP("label", "l", nil, "Only list services with this label, as key=value or key")
+	cmd.Flags().StringP("search", "s", "", "Only list services whose name, owner or description contain this")
+	cmd.Flags().Bool("json", false, "Output as JSON")
+	return cmd
+}
+
+func (h *CommandHandler) labelCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "label [key=value | key-]...",
+		Short: "Show or set the labels, owner and description of a service",
+		Long: `Show or set the catalog metadata of a service: key=value sets a label, key-
+removes it, and --owner and --description set those. They are listed by ls
+and /api/v0/catalog and can also be edited with "edit --config".`,
+		Example: "  yeet label db team=infra tier=data --owner=infra@example.com",
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("description", "", "What the service is")
+	cmd.Flags().String("owner", "", "Who to contact about the service")
+	return cmd
+}
+
+func (h *CommandHandler) imagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List the images in the internal registry",
+		Long: `List the repos, tags, digests and sizes of the images in the internal
+registry, of all services or, as "images <svc>", only of the given one.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	}
+	rm := &cobra.Command{
+		Use:   "rm <svc>/<img>:<tag>",
+		Short: "Delete a tag from the internal registry",
+		Long: `Delete a tag from the internal registry, then remove the manifests and blobs
+no longer referenced by any tag. Deleting the latest tag or the tag of the
+current generation of an installed service needs --force.`,
+		Example: "  yeet images rm web/web:gen-3",
+		Args:    cobra.ExactArgs(1),
+		RunE:    h.runE,
+	}
+	rm.Flags().Bool("force", false, "Delete the latest or current generation tag of an installed service")
+	rm.Flags().Duration("grace", 10*time.Minute, "Keep unreferenced files younger than this, e.g. of pushes in flight")
+	cmd.AddCommand(rm)
+	return cmd
+}
+
+func (h *CommandHandler) secretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage the secrets of a service",
+		Long: `Manage the secrets of a service. Secrets are stored encrypted on the host and
+only decrypted when the service starts. Systemd services read them from
+$CREDENTIALS_DIRECTORY/<name>; docker compose services get them in the
+environment of compose, to pass on with "environment: [<name>]".`,
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:     "set <svc> <name>",
+			Short:   "Set a secret, reading its value from stdin",
+			Example: "  yeet secret set web API_KEY < key.txt",
+			Args:    cobra.ExactArgs(1),
+			RunE:    h.runE,
+		},
+		&cobra.Command{
+			Use:   "get <svc> <name>",
+			Short: "Print the value of a secret",
+			Args:  cobra.ExactArgs(1),
+			RunE:  h.runE,
+		},
+		&cobra.Command{
+			Use:   "rm <svc> <name>",
+			Short: "Remove a secret",
+			Args:  cobra.ExactArgs(1),
+			RunE:  h.runE,
+		},
+		&cobra.Command{
+			Use:   "list <svc>",
+			Short: "List the names of the secrets of a service",
+			Args:  cobra.NoArgs,
+			RunE:  h.runE,
+		},
+	)
+	return cmd
+}
+
+func (h *CommandHandler) shareCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "share",
+		Short: "Create an expiring link to the logs or status of a service",
+		Long: `Create a signed link that shows a read-only snapshot of the logs or status of
+a service until it expires. The link is served through Tailscale Funnel when
+catch runs with --share-funnel, so it works for people not on the tailnet.
+Links can be revoked before they expire with "share revoke".`,
+	}
+	logs := &cobra.Command{
+		Use:     "logs <svc>",
+		Short:   "Share the recent logs and status of a service",
+		Example: "  yeet share logs web --ttl=1h",
+		Args:    cobra.NoArgs,
+		RunE:    h.runE,
+	}
+	status := &cobra.Command{
+		Use:   "status <svc>",
+		Short: "Share the status of a service",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	}
+	for _, c := range []*cobra.Command{logs, status} {
+		c.Flags().Duration("ttl", time.Hour, "How long the link is valid for, at most a week")
+		cmd.AddCommand(c)
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "revoke <svc>",
+		Short: "Revoke all share links of a service created so far",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	})
+	return cmd
+}
+
+func (h *CommandHandler) netCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "net",
+		Short: "Manage the network of a service",
+	}
+	rules := &cobra.Command{
+		Use:   "rules",
+		Short: "Manage the nftables rules of the service network",
+		Long: `Manage the nftables rules of the service network. Published ports and
+any extra rules are applied as a single ruleset, so an edit either takes effect
+completely or not at all. Every edit or rollback makes a new generation of the
+extra rules; the last 10 previous generations are kept.`,
+	}
+	show := &cobra.Command{
+		Use:   "show",
+		Short: "Show the live ruleset",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	}
+	show.Flags().Int("gen", -1, "Show the ruleset rendered with the extra rules of this generation instead")
+	rules.AddCommand(show)
+	rules.AddCommand(&cobra.Command{
+		Use:   "edit",
+		Short: "Edit the extra rules, validating them before they are applied",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	})
+	rules.AddCommand(&cobra.Command{
+		Use:   "history",
+		Short: "List the kept generations of the extra rules",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	})
+	rules.AddCommand(&cobra.Command{
+		Use:   "rollback [generation]",
+		Short: "Apply the extra rules of a previous generation, by default the one before the last edit",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  h.runE,
+	})
+	cmd.AddCommand(rules)
+	return cmd
+}
+
+func (h *CommandHandler) registryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Manage upstream registry credentials and the internal registry",
+	}
+	cmd.PersistentFlags().String("svc", "", "Scope the credentials to this service instead of the whole host")
+	login := &cobra.Command{
+		Use:     "login <registry>",
+		Short:   "Store credentials used to pull images from a registry",
+		Example: "  yeet registry login ghcr.io -u octocat --password-stdin < token.txt",
+		Args:    cobra.ExactArgs(1),
+		RunE:    h.runE,
+	}
+	login.Flags().StringP("username", "u", "", "Registry username")
+	login.Flags().Bool("password-stdin", false, "Read the password from stdin")
+	cmd.AddCommand(login)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "logout <registry>",
+		Short: "Remove stored credentials for a registry",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.runE,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List stored registry credentials",
+		Args:  cobra.NoArgs,
+		RunE:  h.runE,
+	})
+	prune := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove manifests and blobs of the internal registry no image references",
+		Long: `Remove the manifests and blobs of the internal registry that are not referenced
+by any image, directly or through a manifest list. Files younger than --grace
+are kept so that pushes in flight are not collected. This is also done by gc.`,
+		Args: cobra.NoArgs,
+		RunE: h.runE,
+	}
+	prune.Flags().Bool("dry-run", false, "Only report what would be removed")
+	prune.Flags().Duration("grace", time.Hour, "Keep files younger than this")
+	cmd.AddCommand(prune)
 	return cmd
 }
 
@@ -299,24 +984,129 @@ func (h *CommandHandler) statusCmd() *cobra.Command {
 		RunE:  h.runE,
 	}
 	cmd.Flags().String("format", "table", "Output format (table, json, json-pretty)")
+	cmd.Flags().StringSlice("columns", nil, "Columns of the table (service, type, state, container, status, health, uptime, restarts, note, generation, deps, ips, image)")
+	return cmd
+}
+
+func (h *CommandHandler) topCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "top",
+		Aliases: []string{"stats"},
+		Short:   "Show CPU, memory and network usage of a service",
+		Long: `Show the CPU, memory and network usage of a service, or of all services when
+run against sys. Systemd services are measured from their cgroup accounting and
+docker compose services from docker stats.`,
+		Example: "  yeet top web --follow",
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("format", "table", "Output format (table, json, json-pretty)")
+	cmd.Flags().BoolP("follow", "f", false, "Keep refreshing the usage")
+	cmd.Flags().Duration("interval", 2*time.Second, "How often to refresh with --follow")
+	return cmd
+}
+
+func (h *CommandHandler) templateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Manage the compose template used for pushed images",
+		Long: `Manage the compose template used to generate a compose file when an
+image is pushed for a service that does not have one yet.
+
+Use the "sys" service to manage the host-wide template. Templates are Go
+text/template files with the fields .ServiceName, .Image, .DataDir, .Restart,
+.Ports and .Volumes.`,
+		RunE: h.runE,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show the compose template",
+		RunE:  h.runE,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "edit",
+		Short: "Edit the compose template",
+		RunE:  h.runE,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "reset",
+		Short: "Reset the compose template to the default",
+		RunE:  h.runE,
+	})
+	return cmd
+}
+
+func (h *CommandHandler) buildCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "build <compose service>",
+		Short: "Build the image of a compose service from the build context tarball received from stdin",
+		Long: `Build the image of a compose service from the tarball of its build context
+received from stdin with docker buildx, and stage it in the internal registry.
+Installing a compose file replaces the build: section of the service with the
+built image. yeet run and stage do this for every service with a build:
+section.`,
+		Args: cobra.ExactArgs(1),
+		RunE: h.runE,
+	}
+	cmd.Flags().String("dockerfile", "", "Path of the Dockerfile in the build context")
+	cmd.Flags().String("target", "", "Build stage to build")
+	cmd.Flags().StringArray("build-arg", nil, "Build argument as KEY=value, may be repeated")
 	return cmd
 }
 
 func (h *CommandHandler) cronCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   `cron "<cron expression>" [-- <binary args>]`,
 		Short: "Install a cron with the binary received from stdin",
 		Args:  cobra.MinimumNArgs(2),
 		RunE:  h.runE,
 	}
+	cmd.Flags().Bool("no-progress", false, "Don't print the progress of the upload")
+	return cmd
+}
+
+func (h *CommandHandler) convertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert --to=compose|systemd [file]",
+		Short: "Convert a service between a systemd binary and docker compose",
+		Long: `Convert a service to another service type. The service is stopped, its units
+or containers are removed and the artifacts of the old type are archived with
+its config. The data directory and env file are kept. If a file is given, it
+is staged as the new artifact; commit it with "stage commit".`,
+		Example: "  yeet convert api --to=compose compose.yml",
+		Args:    cobra.MaximumNArgs(1),
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("to", "", "Service type to convert to: compose or systemd")
+	return cmd
 }
 
 func (h *CommandHandler) removeCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "remove",
 		Short: "Remove a service",
+		Long: `Remove a service.
+
+By default the service's files and config are moved to an archive for 7 days
+and can be restored with "undelete". The data directory is always kept.
+
+Removing a service that others depend on, through --needs, depends_on, its
+docker networks or volumes, or mounts of its directories, is refused unless
+--force is given.`,
+		RunE: h.runE,
+	}
+	cmd.Flags().Bool("purge", false, "Delete the service permanently instead of archiving it")
+	cmd.Flags().Bool("force", false, "Remove the service even if other services depend on it")
+	return cmd
+}
+
+func (h *CommandHandler) undeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "undelete",
+		Short: "Restore a removed service from the archive",
 		RunE:  h.runE,
 	}
+	cmd.Flags().Bool("list", false, "List the archived versions of the service instead")
+	return cmd
 }
 
 func (h *CommandHandler) eventsCmd() *cobra.Command {
@@ -326,9 +1116,58 @@ func (h *CommandHandler) eventsCmd() *cobra.Command {
 		RunE:  h.runE,
 	}
 	events.Flags().Bool("all", false, "Show all events")
+	events.Flags().Bool("history", false, "Show logged past events instead of following new ones")
+	events.Flags().String("since", "", "With --history, show events since a time (e.g. 1h, 2024-01-02T15:04:05Z)")
 	return events
 }
 
+func (h *CommandHandler) auditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show who installed, rolled back or removed a service",
+		Long: `Show the audit trail of a service, or of all services when run against sys.
+Each install, rollback, undelete and removal is recorded with the Tailscale
+identity and SSH user that requested it.`,
+		Example: "  yeet audit web --since=24h",
+		RunE:    h.runE,
+	}
+	cmd.Flags().String("since", "", "Show entries since a time (e.g. 24h, 2024-01-02T15:04:05Z)")
+	cmd.Flags().String("format", "table", "Output format (table, json, json-pretty)")
+	return cmd
+}
+
+func (h *CommandHandler) diffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show a diff of the staged configuration against the running one",
+		Long: `Show a unified diff of the artifacts of the running generation of a service,
+like its compose file, units and env file, against the staged ones, to review
+them before stage commit. Env values are only shown with --env.`,
+		Example: "  yeet diff web\n  yeet diff web --env",
+		Args:    cobra.NoArgs,
+		RunE:    h.runE,
+	}
+	cmd.Flags().Bool("env", false, "Also show the diff of the env file")
+	cmd.Flags().IntP("context", "U", 3, "Number of context lines")
+	return cmd
+}
+
+func (h *CommandHandler) lintCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the staged or running configuration of a service without installing it",
+		Long: `Check the unit and compose files of a service: unit syntax, compose schema,
+env references, port conflicts with other services and whether images can be
+pulled. The staged generation is checked, or the running one if nothing is
+staged or --running is given. Exits non-zero if any errors are found.`,
+		Example: "  yeet lint web\n  yeet lint web --running --format=json",
+		RunE:    h.runE,
+	}
+	cmd.Flags().Bool("running", false, "Check the running generation instead of the staged one")
+	cmd.Flags().String("format", "table", "Output format (table, json, json-pretty)")
+	return cmd
+}
+
 func (h *CommandHandler) mountCmd() *cobra.Command {
 	mountCmd := &cobra.Command{
 		Use:   "mount | host:path [target] [--type=nfs] [--opts=default]",
@@ -0,0 +1,327 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Deltas are rsync-style: the receiver sends the checksums of the blocks of
+// the file it has, the base, and the sender replies with a delta made of the
+// blocks of the base found anywhere in the new file, found with a rolling
+// checksum, and the bytes in between.
+//
+// A delta is DeltaMagic, the SHA-256 of the base and of the new file and a
+// zstd stream of operations: 'C' followed by the uvarint index and count of
+// blocks of the base to copy, 'L' followed by the uvarint length and bytes of
+// a literal, and 'E' at the end.
+
+// DeltaMagic starts every delta.
+const DeltaMagic = "YEETDLT1"
+
+// DefaultBlockSize is the block size used for the checksums of files.
+const DefaultBlockSize = 16 << 10
+
+// maxLiteral is the maximum length of a literal operation.
+const maxLiteral = 1 << 20
+
+// BlockSums are the checksums of the full blocks of a file.
+type BlockSums struct {
+	BlockSize int `json:"blockSize"`
+	// FileHash is the SHA-256 of the whole file.
+	FileHash []byte `json:"fileHash"`
+	// Weak are the rolling checksums of the blocks.
+	Weak []uint32 `json:"weak"`
+	// Strong are the first 16 bytes of the SHA-256 of the blocks.
+	Strong [][]byte `json:"strong"`
+}
+
+// rollingSum is the rsync rolling checksum of a window of bytes.
+type rollingSum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingSum(p []byte) rollingSum {
+	r := rollingSum{n: uint32(len(p))}
+	for i, c := range p {
+		r.a += uint32(c)
+		r.b += uint32(len(p)-i) * uint32(c)
+	}
+	return r
+}
+
+// roll slides the window by one byte, removing out and adding in.
+func (r *rollingSum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+func (r rollingSum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+func strongSum(p []byte) []byte {
+	h := sha256.Sum256(p)
+	return h[:16]
+}
+
+// ComputeBlockSums returns the checksums of the blocks of blockSize bytes of
+// the file at p.
+func ComputeBlockSums(p string, blockSize int) (*BlockSums, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	bs := &BlockSums{BlockSize: blockSize}
+	fh := sha256.New()
+	buf := make([]byte, blockSize)
+	r := bufio.NewReader(io.TeeReader(f, fh))
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n == blockSize {
+			bs.Weak = append(bs.Weak, newRollingSum(buf).sum())
+			bs.Strong = append(bs.Strong, strongSum(buf))
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	bs.FileHash = fh.Sum(nil)
+	return bs, nil
+}
+
+// WriteDelta writes the delta of the file at p against the base sums was
+// computed from to w.
+func WriteDelta(w io.Writer, p string, sums *BlockSums) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	fileHash := sha256.Sum256(data)
+	if _, err := fmt.Fprintf(w, "%s%s%s", DeltaMagic, sums.FileHash, fileHash[:]); err != nil {
+		return err
+	}
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	dw := &deltaWriter{w: bufio.NewWriter(zw)}
+
+	blocks := make(map[uint32][]int, len(sums.Weak))
+	for i, s := range sums.Weak {
+		blocks[s] = append(blocks[s], i)
+	}
+	bs := sums.BlockSize
+	lit := 0 // start of the pending literal
+	i := 0
+	var rs rollingSum
+	if len(data) >= bs {
+		rs = newRollingSum(data[:bs])
+	}
+	for i+bs <= len(data) {
+		match := -1
+		if cands, ok := blocks[rs.sum()]; ok {
+			strong := strongSum(data[i : i+bs])
+			for _, c := range cands {
+				if bytes.Equal(sums.Strong[c], strong) {
+					match = c
+					break
+				}
+			}
+		}
+		if match < 0 {
+			if i+bs < len(data) {
+				rs.roll(data[i], data[i+bs])
+			}
+			i++
+			continue
+		}
+		dw.literal(data[lit:i])
+		dw.copyBlock(match)
+		i += bs
+		lit = i
+		if i+bs <= len(data) {
+			rs = newRollingSum(data[i : i+bs])
+		}
+	}
+	dw.literal(data[lit:])
+	dw.end()
+	if dw.err != nil {
+		return dw.err
+	}
+	if err := dw.w.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// deltaWriter writes the operations of a delta, merging copies of
+// consecutive blocks.
+type deltaWriter struct {
+	w   *bufio.Writer
+	err error
+
+	// copyStart and copyN are the pending copy, if copyN > 0.
+	copyStart, copyN int
+}
+
+func (dw *deltaWriter) op(op byte, args ...int) {
+	if dw.err != nil {
+		return
+	}
+	b := []byte{op}
+	for _, a := range args {
+		b = binary.AppendUvarint(b, uint64(a))
+	}
+	_, dw.err = dw.w.Write(b)
+}
+
+func (dw *deltaWriter) flushCopy() {
+	if dw.copyN > 0 {
+		dw.op('C', dw.copyStart, dw.copyN)
+		dw.copyN = 0
+	}
+}
+
+func (dw *deltaWriter) copyBlock(i int) {
+	if dw.copyN > 0 && dw.copyStart+dw.copyN == i {
+		dw.copyN++
+		return
+	}
+	dw.flushCopy()
+	dw.copyStart, dw.copyN = i, 1
+}
+
+func (dw *deltaWriter) literal(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	dw.flushCopy()
+	for len(p) > 0 && dw.err == nil {
+		n := min(len(p), maxLiteral)
+		dw.op('L', n)
+		if dw.err == nil {
+			_, dw.err = dw.w.Write(p[:n])
+		}
+		p = p[n:]
+	}
+}
+
+func (dw *deltaWriter) end() {
+	dw.flushCopy()
+	dw.op('E')
+}
+
+// IsDelta reports whether the file at p is a delta.
+func IsDelta(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	b := make([]byte, len(DeltaMagic))
+	_, err = io.ReadFull(f, b)
+	return err == nil && string(b) == DeltaMagic
+}
+
+// ApplyDelta writes the file the delta at p was made from to dst, copying
+// blocks of blockSize bytes from the file at base.
+func ApplyDelta(dst, p, base string, blockSize int) error {
+	df, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+	hdr := make([]byte, len(DeltaMagic)+2*sha256.Size)
+	if _, err := io.ReadFull(df, hdr); err != nil || string(hdr[:len(DeltaMagic)]) != DeltaMagic {
+		return errors.New("invalid delta")
+	}
+	baseHash, fileHash := hdr[len(DeltaMagic):len(DeltaMagic)+sha256.Size], hdr[len(DeltaMagic)+sha256.Size:]
+
+	bf, err := os.Open(base)
+	if err != nil {
+		return err
+	}
+	defer bf.Close()
+	bh := sha256.New()
+	if _, err := io.Copy(bh, bf); err != nil {
+		return err
+	}
+	if !bytes.Equal(bh.Sum(nil), baseHash) {
+		return errors.New("delta was made against another version of the file")
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zr, err := zstd.NewReader(df)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	r := bufio.NewReader(zr)
+	fh := sha256.New()
+	w := io.MultiWriter(out, fh)
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("invalid delta: %w", err)
+		}
+		switch op {
+		case 'C':
+			start, err1 := binary.ReadUvarint(r)
+			n, err2 := binary.ReadUvarint(r)
+			if err := errors.Join(err1, err2); err != nil {
+				return fmt.Errorf("invalid delta: %w", err)
+			}
+			sr := io.NewSectionReader(bf, int64(start)*int64(blockSize), int64(n)*int64(blockSize))
+			if m, err := io.Copy(w, sr); err != nil {
+				return err
+			} else if m != int64(n)*int64(blockSize) {
+				return errors.New("invalid delta: copy past the end of the base")
+			}
+		case 'L':
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > maxLiteral {
+				return errors.New("invalid delta: bad literal")
+			}
+			if _, err := io.CopyN(w, r, int64(n)); err != nil {
+				return fmt.Errorf("invalid delta: %w", err)
+			}
+		case 'E':
+			if !bytes.Equal(fh.Sum(nil), fileHash) {
+				return errors.New("file built from delta does not match")
+			}
+			return out.Close()
+		default:
+			return fmt.Errorf("invalid delta: unknown operation %q", op)
+		}
+	}
+}
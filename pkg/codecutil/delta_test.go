@@ -0,0 +1,189 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const testBlockSize = 1 << 10
+
+// writeDelta writes base and file to dir and returns the paths of the base
+// and of the delta of file against it.
+func writeDelta(t *testing.T, dir string, base, file []byte) (basePath, deltaPath string) {
+	t.Helper()
+	basePath = filepath.Join(dir, "base")
+	filePath := filepath.Join(dir, "file")
+	deltaPath = filepath.Join(dir, "delta")
+	if err := os.WriteFile(basePath, base, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := ComputeBlockSums(basePath, testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteDelta(&buf, filePath, sums); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deltaPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return basePath, deltaPath
+}
+
+func randomBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.Uint32())
+	}
+	return b
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	base := randomBytes(r, 64*testBlockSize+123)
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"unchanged", base},
+		{"empty", nil},
+		{"insert", slices.Concat(base[:10*testBlockSize+7], []byte("inserted"), base[10*testBlockSize+7:])},
+		{"overwrite", slices.Concat(base[:3*testBlockSize], randomBytes(r, 2*testBlockSize), base[5*testBlockSize:])},
+		{"reorder", slices.Concat(base[40*testBlockSize:], base[:40*testBlockSize])},
+		{"truncate", base[:20*testBlockSize+1]},
+		{"unrelated", randomBytes(r, 3*maxLiteral/2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			basePath, deltaPath := writeDelta(t, dir, base, tt.file)
+			if !IsDelta(deltaPath) {
+				t.Fatal("IsDelta = false")
+			}
+			dst := filepath.Join(dir, "out")
+			if err := ApplyDelta(dst, deltaPath, basePath, testBlockSize); err != nil {
+				t.Fatalf("ApplyDelta: %v", err)
+			}
+			got, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.file) {
+				t.Fatalf("ApplyDelta built %d bytes, want the %d of the file", len(got), len(tt.file))
+			}
+		})
+	}
+
+	// Mostly copies: the delta of a small change is small.
+	_, deltaPath := writeDelta(t, t.TempDir(), base, tests[2].file)
+	if st, err := os.Stat(deltaPath); err != nil {
+		t.Fatal(err)
+	} else if st.Size() > 4*testBlockSize {
+		t.Errorf("delta of an 8 byte insert is %d bytes", st.Size())
+	}
+}
+
+func TestDeltaWrongBase(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	base := randomBytes(r, 16*testBlockSize)
+	dir := t.TempDir()
+	basePath, deltaPath := writeDelta(t, dir, base, slices.Concat(base, []byte("more")))
+
+	other := slices.Clone(base)
+	other[5*testBlockSize] ^= 0xff
+	if err := os.WriteFile(basePath, other, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := ApplyDelta(filepath.Join(dir, "out"), deltaPath, basePath, testBlockSize)
+	if err == nil || !strings.Contains(err.Error(), "another version") {
+		t.Fatalf("ApplyDelta against another base = %v, want another version error", err)
+	}
+}
+
+// deltaOf returns a delta with the header of base and file and the zstd
+// compressed operations ops.
+func deltaOf(t *testing.T, base, file, ops []byte) []byte {
+	t.Helper()
+	bh, fh := sha256.Sum256(base), sha256.Sum256(file)
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zw.EncodeAll(ops, slices.Concat([]byte(DeltaMagic), bh[:], fh[:]))
+}
+
+func TestDeltaCorrupt(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	base := randomBytes(r, 8*testBlockSize)
+	file := slices.Concat(base[:4*testBlockSize], []byte("changed"), base[4*testBlockSize:])
+	dir := t.TempDir()
+	basePath, deltaPath := writeDelta(t, dir, base, file)
+	good, err := os.ReadFile(deltaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyOp := func(start, n uint64) []byte {
+		return binary.AppendUvarint(binary.AppendUvarint([]byte{'C'}, start), n)
+	}
+	literal := binary.AppendUvarint([]byte{'L'}, 7)
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"not a delta", []byte("#!/bin/sh\n")},
+		{"truncated header", good[:len(DeltaMagic)+10]},
+		{"truncated", good[:len(good)-8]},
+		{"garbage stream", slices.Concat(good[:len(DeltaMagic)+2*sha256.Size], []byte("not zstd at all"))},
+		{"wrong file hash", deltaOf(t, base, []byte("other"), slices.Concat(copyOp(0, 4), literal, []byte("changed"), copyOp(4, 4), []byte{'E'}))},
+		{"no end", deltaOf(t, base, file, copyOp(0, 4))},
+		{"copy past end", deltaOf(t, base, file, slices.Concat(copyOp(6, 4), []byte{'E'}))},
+		{"huge copy", deltaOf(t, base, file, slices.Concat(copyOp(1<<62, 1<<62), []byte{'E'}))},
+		{"short literal", deltaOf(t, base, file, slices.Concat(literal, []byte("cha")))},
+		{"huge literal", deltaOf(t, base, file, binary.AppendUvarint([]byte{'L'}, maxLiteral+1))},
+		{"unknown op", deltaOf(t, base, file, []byte{'X'})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "delta")
+			if err := os.WriteFile(p, tt.delta, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ApplyDelta(filepath.Join(t.TempDir(), "out"), p, basePath, testBlockSize); err == nil {
+				t.Fatal("ApplyDelta of a corrupt delta succeeded")
+			}
+		})
+	}
+
+	// The intact delta still applies.
+	if err := ApplyDelta(filepath.Join(dir, "out"), deltaPath, basePath, testBlockSize); err != nil {
+		t.Fatalf("ApplyDelta: %v", err)
+	}
+}
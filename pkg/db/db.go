@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/yeetrun/yeet/pkg/fileutil"
 	"tailscale.com/tailcfg"
@@ -30,6 +31,51 @@ type Data struct {
 	Volumes map[string]*Volume
 
 	DockerNetworks map[string]*DockerNetwork
+
+	// ComposeTemplate, if set, overrides the built-in template used to
+	// generate a compose file when an image is pushed for a service that does
+	// not have one yet. See Service.ComposeTemplate for a per-service
+	// override.
+	ComposeTemplate string `json:",omitempty"`
+
+	// TSDefaultTags are added to the tags of every service tailscale node,
+	// in addition to any tags given at deploy time.
+	TSDefaultTags []string `json:",omitempty"`
+
+	// TSInheritHostTags, if true, also adds the tags of the catch host's own
+	// tailscale node to every service tailscale node.
+	TSInheritHostTags bool `json:",omitempty"`
+
+	// RegistryAuths are host-wide credentials for upstream container
+	// registries, keyed by registry host. See Service.RegistryAuths for
+	// per-service credentials.
+	RegistryAuths map[string]RegistryAuth `json:",omitempty"`
+
+	// GCInterval, if non-zero, is how often catch runs `sys gc`.
+	GCInterval time.Duration `json:",omitempty"`
+
+	// AutoDeployOff, if set, makes the registry treat pushes of the run tag
+	// like pushes of latest, staging the image without installing it, on
+	// every service of the host. It records who turned auto-deploys off,
+	// when and why.
+	AutoDeployOff *ServiceAction `json:",omitempty"`
+
+	// StageDefaults are values of run and stage flags by flag name, e.g.
+	// "net": "ts", used for services that have not been installed yet
+	// unless the flag is given explicitly.
+	StageDefaults map[string]string `json:",omitempty"`
+
+	// KeepGenerations, if non-zero, is how many generations of each service
+	// are kept for rollbacks, unless the service overrides it.
+	KeepGenerations int `json:",omitempty"`
+
+	// Motd is the host banner shown at the start of interactive sessions,
+	// e.g. maintenance notices or who to contact about the host.
+	Motd string `json:",omitempty"`
+
+	// TrustedKeys are the public keys, by name, that signatures of the
+	// artifacts of services with RequireSigned set are verified against.
+	TrustedKeys map[string]TrustedKey `json:",omitempty"`
 }
 
 type DockerNetwork struct {
@@ -45,6 +91,21 @@ type DockerNetwork struct {
 	EndpointAddrs map[string]netip.Prefix
 
 	PortMap map[string]*EndpointPort // key is "proto/hostport"
+
+	// ExtraRules are user-edited nftables statements appended to the
+	// network's generated ruleset, e.g. extra chains.
+	ExtraRules string `json:",omitempty"`
+	// RulesGeneration is incremented every time ExtraRules is edited.
+	RulesGeneration int `json:",omitempty"`
+	// RulesHistory holds the previous generations of ExtraRules, oldest
+	// first, to show and roll back to.
+	RulesHistory []RulesVersion `json:",omitempty"`
+}
+
+// RulesVersion is a previous generation of the ExtraRules of a network.
+type RulesVersion struct {
+	Generation int
+	ExtraRules string `json:",omitempty"`
 }
 
 type EndpointPort struct {
@@ -100,6 +161,9 @@ type ServiceType string
 const (
 	ServiceTypeDockerCompose ServiceType = "docker-compose"
 	ServiceTypeSystemd       ServiceType = "systemd"
+	// ServiceTypeExternal is a service that yeet only monitors; it is
+	// installed and managed by something else. See Service.External.
+	ServiceTypeExternal ServiceType = "external"
 )
 
 // Service is the configuration for one service.
@@ -124,6 +188,268 @@ type Service struct {
 	SvcNetwork *SvcNetwork
 	Macvlan    *MacvlanNetwork
 	TSNet      *TailscaleNetwork
+
+	// ComposeTemplate, if set, overrides Data.ComposeTemplate for this
+	// service.
+	ComposeTemplate string `json:",omitempty"`
+
+	// LastAction is the last manual start, stop or restart of the service.
+	LastAction *ServiceAction `json:",omitempty"`
+
+	// DataDir, if set, overrides the default data directory of the service
+	// (<ServicesRoot>/<name>/data), e.g. to place it on a larger volume.
+	DataDir string `json:",omitempty"`
+	// StagedDataDir, if set, is the data directory staged with the next
+	// generation. It replaces DataDir when that is committed.
+	StagedDataDir string `json:",omitempty"`
+
+	// RegistryAuths are credentials for upstream container registries used
+	// when pulling this service's images, keyed by registry host. They take
+	// precedence over Data.RegistryAuths.
+	RegistryAuths map[string]RegistryAuth `json:",omitempty"`
+
+	// Quadlet, if true, renders pushed images for this service as podman
+	// quadlet files run by systemd instead of a docker compose file.
+	Quadlet bool `json:",omitempty"`
+
+	// Runtime is how pushed images for this service are run: "" for a
+	// docker compose file, or RuntimeOCI for a single container run with
+	// docker (or nerdctl) from a generated systemd unit.
+	Runtime string `json:",omitempty"`
+
+	// External is the unit or container referenced by a service of type
+	// ServiceTypeExternal.
+	External *ExternalService `json:",omitempty"`
+
+	// Protected, if true, holds deploys of the service until a second
+	// identity approves them.
+	Protected bool `json:",omitempty"`
+	// PendingDeploy is the deploy of a protected service awaiting approval.
+	PendingDeploy *PendingDeploy `json:",omitempty"`
+	// PendingUnprotect is a request to lift the protection of the service,
+	// which a second identity must confirm.
+	PendingUnprotect *PendingDeploy `json:",omitempty"`
+
+	// ReplicateTo lists catch hosts that new images of the service are
+	// copied to as they arrive.
+	ReplicateTo []string `json:",omitempty"`
+
+	// Secrets are the service's secrets by name, encrypted with the host's
+	// secrets key and base64 encoded. They are provided to the service at
+	// start time and never written to disk in the clear.
+	Secrets map[string]string `json:",omitempty"`
+
+	// AllowPrivileged, if true, allows privileged containers in the
+	// service's compose file.
+	AllowPrivileged bool `json:",omitempty"`
+
+	// NoAutoRollback, if true, keeps new generations of the service even if
+	// they crash right after the deploy instead of rolling back to the
+	// previous one.
+	NoAutoRollback bool `json:",omitempty"`
+
+	// HealthCheck, if set, is probed periodically by catch to report the
+	// health of a systemd service.
+	HealthCheck *HealthCheck `json:",omitempty"`
+
+	// Resources, if set, limits the CPU, memory and IO the service may use.
+	// Unlike artifacts they are not tied to a generation, so they survive
+	// rollbacks.
+	Resources *ResourceLimits `json:",omitempty"`
+	// StagedResources, if set, are the resource limits staged with the
+	// next generation. They replace Resources when it is committed; a zero
+	// value removes all limits.
+	StagedResources *ResourceLimits `json:",omitempty"`
+
+	// Metrics, if set, is where Prometheus scrapes the metrics of the
+	// service, listed by the Prometheus service discovery endpoint.
+	Metrics *MetricsTarget `json:",omitempty"`
+
+	// KeepGenerations, if non-zero, overrides how many generations of the
+	// service are kept for rollbacks.
+	KeepGenerations int `json:",omitempty"`
+
+	// StageDefaultsApplied records that the host's stage defaults were
+	// applied to the service, so that they are only applied once, before
+	// its first install.
+	StageDefaultsApplied bool `json:",omitempty"`
+
+	// Dependencies are the services this service depends on, declared with
+	// --needs or discovered from its compose file when it is staged.
+	Dependencies []Dependency `json:",omitempty"`
+
+	// Notice is shown before commands that change the service, e.g. to warn
+	// that it is shared or to say who owns it.
+	Notice string `json:",omitempty"`
+
+	// Labels are free-form key=value metadata used to find services in the
+	// catalog, e.g. team=infra.
+	Labels map[string]string `json:",omitempty"`
+	// Description says what the service is, shown in the catalog.
+	Description string `json:",omitempty"`
+	// Owner is who to contact about the service, shown in the catalog.
+	Owner string `json:",omitempty"`
+
+	// RequireSigned, if true, refuses to stage or install binaries and
+	// images of the service that are not signed by one of
+	// Data.TrustedKeys.
+	RequireSigned bool `json:",omitempty"`
+}
+
+// RuntimeOCI is the Runtime of services whose image is run directly as a
+// single container instead of through a compose file.
+const RuntimeOCI = "oci"
+
+// DependencyKind is how a dependency between services was discovered.
+type DependencyKind string
+
+const (
+	// DependencyDependsOn is a compose depends_on entry naming another
+	// service.
+	DependencyDependsOn DependencyKind = "depends_on"
+	// DependencyNetwork is an external network owned by another service.
+	DependencyNetwork DependencyKind = "network"
+	// DependencyVolume is a volume or bind mount from another service's
+	// directory.
+	DependencyVolume DependencyKind = "volume"
+	// DependencyNeeds is declared with --needs. Unlike the others it is
+	// also enforced by systemd, which orders the service after and stops
+	// it with the needed service.
+	DependencyNeeds DependencyKind = "needs"
+)
+
+// Dependency is a service another service depends on.
+type Dependency struct {
+	// Service is the name of the service depended on.
+	Service string
+	Kind    DependencyKind
+	// Ref is what creates the dependency, e.g. the network name or the
+	// mounted path.
+	Ref string `json:",omitempty"`
+}
+
+// PendingDeploy is a deploy of a protected service that awaits approval. It
+// is also used for a pending request to lift the protection.
+type PendingDeploy struct {
+	// RequestedBy is who requested the deploy, if known.
+	RequestedBy string `json:",omitempty"`
+	// RequestedAt is when the deploy was requested.
+	RequestedAt time.Time
+	// Expires is when the request lapses if not approved.
+	Expires time.Time
+	// Gen is the generation to install, or 0 for the staged one.
+	Gen int `json:",omitempty"`
+	// Staged fingerprints what was staged when the deploy was requested,
+	// so that a deploy staged afterwards isn't installed by the approval.
+	Staged string `json:",omitempty"`
+}
+
+// ExternalService references a systemd unit or docker container that yeet
+// does not manage. Exactly one of Unit and Container is set.
+type ExternalService struct {
+	// Unit is the name of the systemd unit, e.g. "nginx.service".
+	Unit string `json:",omitempty"`
+	// Container is the name of the docker container.
+	Container string `json:",omitempty"`
+}
+
+// HealthCheck is a periodic probe of the health of a service. Exactly one of
+// HTTP, TCP and Exec is set. Probes run in the service's network namespace.
+type HealthCheck struct {
+	// HTTP is a URL that must respond with a status below 400.
+	HTTP string `json:",omitempty"`
+	// TCP is a host:port that must accept connections.
+	TCP string `json:",omitempty"`
+	// Exec is a shell command that must exit with status 0.
+	Exec string `json:",omitempty"`
+
+	// Interval is the time between probes.
+	Interval time.Duration
+	// Timeout bounds each probe.
+	Timeout time.Duration
+	// Retries is the number of consecutive failed probes after which the
+	// service is unhealthy.
+	Retries int
+}
+
+// Probe returns a description of the probe of hc, e.g. "tcp localhost:80".
+func (hc *HealthCheck) Probe() string {
+	switch {
+	case hc.HTTP != "":
+		return "http " + hc.HTTP
+	case hc.TCP != "":
+		return "tcp " + hc.TCP
+	default:
+		return "exec " + hc.Exec
+	}
+}
+
+// ResourceLimits are limits on the resources a service may use. A zero
+// value means no limit.
+type ResourceLimits struct {
+	// CPU is the number of CPUs the service may use, e.g. 0.5 for half of
+	// one.
+	CPU float64 `json:",omitempty"`
+	// Memory is the maximum memory of the service in bytes.
+	Memory int64 `json:",omitempty"`
+	// IOWeight is the block IO weight of the service relative to others,
+	// from 1 to 10000 as for systemd's IOWeight=. The default is 100.
+	IOWeight int `json:",omitempty"`
+}
+
+// IsZero reports whether rl is nil or sets no limits.
+func (rl *ResourceLimits) IsZero() bool {
+	return rl == nil || *rl == ResourceLimits{}
+}
+
+// MetricsTarget is the endpoint serving the Prometheus metrics of a
+// service.
+type MetricsTarget struct {
+	// Port is the port of the endpoint, on the service's tailscale node for
+	// services on --net=ts and on the host otherwise.
+	Port int
+	// Path is the HTTP path of the endpoint, "/metrics" if empty.
+	Path string `json:",omitempty"`
+}
+
+// RegistryAuth is a credential for a container registry.
+type RegistryAuth struct {
+	Username string
+	// Password is the password encrypted with the host's registry auth key,
+	// base64 encoded.
+	Password string
+}
+
+// Types of TrustedKey.
+const (
+	// TrustedKeyMinisign is a minisign public key, used to verify files.
+	TrustedKeyMinisign = "minisign"
+	// TrustedKeyCosign is a PEM encoded cosign public key, used to verify
+	// images.
+	TrustedKeyCosign = "cosign"
+)
+
+// TrustedKey is a public key that signatures are verified against.
+type TrustedKey struct {
+	// Type is TrustedKeyMinisign or TrustedKeyCosign.
+	Type string
+	// Key is the public key, as in the key file minus comments.
+	Key string
+	// Added is when the key was added.
+	Added time.Time
+}
+
+// ServiceAction records a manual action taken on a service, so that others
+// can tell why a service is in the state it is in.
+type ServiceAction struct {
+	// Action is the action taken, e.g. "start", "stop" or "restart".
+	Action string
+	// Actor is who took the action, if known.
+	Actor string `json:",omitempty"`
+	// Reason is the optional reason given for the action.
+	Reason string `json:",omitempty"`
+	// Time is when the action was taken.
+	Time time.Time
 }
 
 type TailscaleNetwork struct {
@@ -193,6 +519,11 @@ const (
 	ArtifactTypeScriptFile       ArtifactName = "main.ts"
 	ArtifactSystemdUnit          ArtifactName = "systemd.service"
 	ArtifactSystemdTimerFile     ArtifactName = "systemd.timer"
+	// ArtifactSystemdOverride is a drop-in applied on top of the generated
+	// systemd unit, holding the user's edits to it.
+	ArtifactSystemdOverride  ArtifactName = "systemd.override.conf"
+	ArtifactQuadletContainer ArtifactName = "quadlet.container"
+	ArtifactQuadletNetwork   ArtifactName = "quadlet.network"
 
 	ArtifactNetNSService ArtifactName = "netns.service"
 	ArtifactNetNSEnv     ArtifactName = "netns.env"
@@ -201,6 +532,11 @@ const (
 	ArtifactTSBinary     ArtifactName = "tailscaled"
 	ArtifactTSConfig     ArtifactName = "tailscaled.json"
 	ArtifactNetNSResolv  ArtifactName = "resolv.conf"
+
+	// ArtifactUnsigned is the file of the generation if it was staged
+	// without a verified signature, which services with RequireSigned
+	// refuse to install.
+	ArtifactUnsigned ArtifactName = "unsigned"
 )
 
 // ArtifactRef is a reference to an artifact.
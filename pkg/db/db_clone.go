@@ -8,6 +8,7 @@ package db
 import (
 	"maps"
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/ptr"
@@ -61,16 +62,33 @@ func (src *Data) Clone() *Data {
 			}
 		}
 	}
+	dst.TSDefaultTags = append(src.TSDefaultTags[:0:0], src.TSDefaultTags...)
+	dst.RegistryAuths = maps.Clone(src.RegistryAuths)
+	if dst.AutoDeployOff != nil {
+		dst.AutoDeployOff = ptr.To(*src.AutoDeployOff)
+	}
+	dst.StageDefaults = maps.Clone(src.StageDefaults)
+	dst.TrustedKeys = maps.Clone(src.TrustedKeys)
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _DataCloneNeedsRegeneration = Data(struct {
-	DataVersion    int
-	Services       map[string]*Service
-	Images         map[ImageRepoName]*ImageRepo
-	Volumes        map[string]*Volume
-	DockerNetworks map[string]*DockerNetwork
+	DataVersion       int
+	Services          map[string]*Service
+	Images            map[ImageRepoName]*ImageRepo
+	Volumes           map[string]*Volume
+	DockerNetworks    map[string]*DockerNetwork
+	ComposeTemplate   string
+	TSDefaultTags     []string
+	TSInheritHostTags bool
+	RegistryAuths     map[string]RegistryAuth
+	GCInterval        time.Duration
+	AutoDeployOff     *ServiceAction
+	StageDefaults     map[string]string
+	KeepGenerations   int
+	Motd              string
+	TrustedKeys       map[string]TrustedKey
 }{})
 
 // Clone makes a deep copy of Service.
@@ -98,20 +116,76 @@ func (src *Service) Clone() *Service {
 		dst.Macvlan = ptr.To(*src.Macvlan)
 	}
 	dst.TSNet = src.TSNet.Clone()
+	if dst.LastAction != nil {
+		dst.LastAction = ptr.To(*src.LastAction)
+	}
+	dst.RegistryAuths = maps.Clone(src.RegistryAuths)
+	if dst.External != nil {
+		dst.External = ptr.To(*src.External)
+	}
+	if dst.PendingDeploy != nil {
+		dst.PendingDeploy = ptr.To(*src.PendingDeploy)
+	}
+	if dst.PendingUnprotect != nil {
+		dst.PendingUnprotect = ptr.To(*src.PendingUnprotect)
+	}
+	dst.ReplicateTo = append(src.ReplicateTo[:0:0], src.ReplicateTo...)
+	dst.Secrets = maps.Clone(src.Secrets)
+	if dst.HealthCheck != nil {
+		dst.HealthCheck = ptr.To(*src.HealthCheck)
+	}
+	if dst.Resources != nil {
+		dst.Resources = ptr.To(*src.Resources)
+	}
+	if dst.StagedResources != nil {
+		dst.StagedResources = ptr.To(*src.StagedResources)
+	}
+	if dst.Metrics != nil {
+		dst.Metrics = ptr.To(*src.Metrics)
+	}
+	dst.Dependencies = append(src.Dependencies[:0:0], src.Dependencies...)
+	dst.Labels = maps.Clone(src.Labels)
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServiceCloneNeedsRegeneration = Service(struct {
-	Name             string
-	ServiceType      ServiceType
-	Dir              string
-	Generation       int
-	LatestGeneration int
-	Artifacts        ArtifactStore
-	SvcNetwork       *SvcNetwork
-	Macvlan          *MacvlanNetwork
-	TSNet            *TailscaleNetwork
+	Name                 string
+	ServiceType          ServiceType
+	Dir                  string
+	Generation           int
+	LatestGeneration     int
+	Artifacts            ArtifactStore
+	SvcNetwork           *SvcNetwork
+	Macvlan              *MacvlanNetwork
+	TSNet                *TailscaleNetwork
+	ComposeTemplate      string
+	LastAction           *ServiceAction
+	DataDir              string
+	StagedDataDir        string
+	RegistryAuths        map[string]RegistryAuth
+	Quadlet              bool
+	Runtime              string
+	External             *ExternalService
+	Protected            bool
+	PendingDeploy        *PendingDeploy
+	PendingUnprotect     *PendingDeploy
+	ReplicateTo          []string
+	Secrets              map[string]string
+	AllowPrivileged      bool
+	NoAutoRollback       bool
+	HealthCheck          *HealthCheck
+	Resources            *ResourceLimits
+	StagedResources      *ResourceLimits
+	Metrics              *MetricsTarget
+	KeepGenerations      int
+	StageDefaultsApplied bool
+	Dependencies         []Dependency
+	Notice               string
+	Labels               map[string]string
+	Description          string
+	Owner                string
+	RequireSigned        bool
 }{})
 
 // Clone makes a deep copy of Volume.
@@ -198,18 +272,22 @@ func (src *DockerNetwork) Clone() *DockerNetwork {
 			}
 		}
 	}
+	dst.RulesHistory = append(src.RulesHistory[:0:0], src.RulesHistory...)
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _DockerNetworkCloneNeedsRegeneration = DockerNetwork(struct {
-	NetworkID     string
-	NetNS         string
-	IPv4Gateway   netip.Prefix
-	IPv4Range     netip.Prefix
-	Endpoints     map[string]*DockerEndpoint
-	EndpointAddrs map[string]netip.Prefix
-	PortMap       map[string]*EndpointPort
+	NetworkID       string
+	NetNS           string
+	IPv4Gateway     netip.Prefix
+	IPv4Range       netip.Prefix
+	Endpoints       map[string]*DockerEndpoint
+	EndpointAddrs   map[string]netip.Prefix
+	PortMap         map[string]*EndpointPort
+	ExtraRules      string
+	RulesGeneration int
+	RulesHistory    []RulesVersion
 }{})
 
 // Clone makes a deep copy of DockerEndpoint.
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/views"
@@ -84,13 +85,47 @@ func (v DataView) DockerNetworks() views.MapFn[string, *DockerNetwork, DockerNet
 	})
 }
 
+func (v DataView) ComposeTemplate() string            { return v.ж.ComposeTemplate }
+func (v DataView) TSDefaultTags() views.Slice[string] { return views.SliceOf(v.ж.TSDefaultTags) }
+func (v DataView) TSInheritHostTags() bool            { return v.ж.TSInheritHostTags }
+
+func (v DataView) RegistryAuths() views.Map[string, RegistryAuth] {
+	return views.MapOf(v.ж.RegistryAuths)
+}
+func (v DataView) GCInterval() time.Duration { return v.ж.GCInterval }
+func (v DataView) AutoDeployOff() *ServiceAction {
+	if v.ж.AutoDeployOff == nil {
+		return nil
+	}
+	x := *v.ж.AutoDeployOff
+	return &x
+}
+func (v DataView) StageDefaults() views.Map[string, string] {
+	return views.MapOf(v.ж.StageDefaults)
+}
+func (v DataView) KeepGenerations() int { return v.ж.KeepGenerations }
+func (v DataView) Motd() string         { return v.ж.Motd }
+func (v DataView) TrustedKeys() views.Map[string, TrustedKey] {
+	return views.MapOf(v.ж.TrustedKeys)
+}
+
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _DataViewNeedsRegeneration = Data(struct {
-	DataVersion    int
-	Services       map[string]*Service
-	Images         map[ImageRepoName]*ImageRepo
-	Volumes        map[string]*Volume
-	DockerNetworks map[string]*DockerNetwork
+	DataVersion       int
+	Services          map[string]*Service
+	Images            map[ImageRepoName]*ImageRepo
+	Volumes           map[string]*Volume
+	DockerNetworks    map[string]*DockerNetwork
+	ComposeTemplate   string
+	TSDefaultTags     []string
+	TSInheritHostTags bool
+	RegistryAuths     map[string]RegistryAuth
+	GCInterval        time.Duration
+	AutoDeployOff     *ServiceAction
+	StageDefaults     map[string]string
+	KeepGenerations   int
+	Motd              string
+	TrustedKeys       map[string]TrustedKey
 }{})
 
 // View returns a readonly view of Service.
@@ -166,18 +201,125 @@ func (v ServiceView) Macvlan() *MacvlanNetwork {
 }
 
 func (v ServiceView) TSNet() TailscaleNetworkView { return v.ж.TSNet.View() }
+func (v ServiceView) ComposeTemplate() string     { return v.ж.ComposeTemplate }
+func (v ServiceView) LastAction() *ServiceAction {
+	if v.ж.LastAction == nil {
+		return nil
+	}
+	x := *v.ж.LastAction
+	return &x
+}
+func (v ServiceView) DataDir() string       { return v.ж.DataDir }
+func (v ServiceView) StagedDataDir() string { return v.ж.StagedDataDir }
+
+func (v ServiceView) RegistryAuths() views.Map[string, RegistryAuth] {
+	return views.MapOf(v.ж.RegistryAuths)
+}
+func (v ServiceView) Quadlet() bool   { return v.ж.Quadlet }
+func (v ServiceView) Runtime() string { return v.ж.Runtime }
+func (v ServiceView) External() *ExternalService {
+	if v.ж.External == nil {
+		return nil
+	}
+	x := *v.ж.External
+	return &x
+}
+func (v ServiceView) Protected() bool { return v.ж.Protected }
+func (v ServiceView) PendingDeploy() *PendingDeploy {
+	if v.ж.PendingDeploy == nil {
+		return nil
+	}
+	x := *v.ж.PendingDeploy
+	return &x
+}
+func (v ServiceView) PendingUnprotect() *PendingDeploy {
+	if v.ж.PendingUnprotect == nil {
+		return nil
+	}
+	x := *v.ж.PendingUnprotect
+	return &x
+}
+func (v ServiceView) ReplicateTo() views.Slice[string] { return views.SliceOf(v.ж.ReplicateTo) }
+
+func (v ServiceView) Secrets() views.Map[string, string] { return views.MapOf(v.ж.Secrets) }
+func (v ServiceView) AllowPrivileged() bool              { return v.ж.AllowPrivileged }
+func (v ServiceView) NoAutoRollback() bool               { return v.ж.NoAutoRollback }
+func (v ServiceView) HealthCheck() *HealthCheck {
+	if v.ж.HealthCheck == nil {
+		return nil
+	}
+	x := *v.ж.HealthCheck
+	return &x
+}
+func (v ServiceView) Resources() *ResourceLimits {
+	if v.ж.Resources == nil {
+		return nil
+	}
+	x := *v.ж.Resources
+	return &x
+}
+func (v ServiceView) StagedResources() *ResourceLimits {
+	if v.ж.StagedResources == nil {
+		return nil
+	}
+	x := *v.ж.StagedResources
+	return &x
+}
+func (v ServiceView) Metrics() *MetricsTarget {
+	if v.ж.Metrics == nil {
+		return nil
+	}
+	x := *v.ж.Metrics
+	return &x
+}
+func (v ServiceView) KeepGenerations() int                  { return v.ж.KeepGenerations }
+func (v ServiceView) StageDefaultsApplied() bool            { return v.ж.StageDefaultsApplied }
+func (v ServiceView) Dependencies() views.Slice[Dependency] { return views.SliceOf(v.ж.Dependencies) }
+func (v ServiceView) Notice() string                        { return v.ж.Notice }
+
+func (v ServiceView) Labels() views.Map[string, string] { return views.MapOf(v.ж.Labels) }
+func (v ServiceView) Description() string               { return v.ж.Description }
+func (v ServiceView) Owner() string                     { return v.ж.Owner }
+func (v ServiceView) RequireSigned() bool               { return v.ж.RequireSigned }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ServiceViewNeedsRegeneration = Service(struct {
-	Name             string
-	ServiceType      ServiceType
-	Dir              string
-	Generation       int
-	LatestGeneration int
-	Artifacts        ArtifactStore
-	SvcNetwork       *SvcNetwork
-	Macvlan          *MacvlanNetwork
-	TSNet            *TailscaleNetwork
+	Name                 string
+	ServiceType          ServiceType
+	Dir                  string
+	Generation           int
+	LatestGeneration     int
+	Artifacts            ArtifactStore
+	SvcNetwork           *SvcNetwork
+	Macvlan              *MacvlanNetwork
+	TSNet                *TailscaleNetwork
+	ComposeTemplate      string
+	LastAction           *ServiceAction
+	DataDir              string
+	StagedDataDir        string
+	RegistryAuths        map[string]RegistryAuth
+	Quadlet              bool
+	Runtime              string
+	External             *ExternalService
+	Protected            bool
+	PendingDeploy        *PendingDeploy
+	PendingUnprotect     *PendingDeploy
+	ReplicateTo          []string
+	Secrets              map[string]string
+	AllowPrivileged      bool
+	NoAutoRollback       bool
+	HealthCheck          *HealthCheck
+	Resources            *ResourceLimits
+	StagedResources      *ResourceLimits
+	Metrics              *MetricsTarget
+	KeepGenerations      int
+	StageDefaultsApplied bool
+	Dependencies         []Dependency
+	Notice               string
+	Labels               map[string]string
+	Description          string
+	Owner                string
+	RequireSigned        bool
 }{})
 
 // View returns a readonly view of Volume.
@@ -411,16 +553,24 @@ func (v DockerNetworkView) PortMap() views.MapFn[string, *EndpointPort, Endpoint
 		return t.View()
 	})
 }
+func (v DockerNetworkView) ExtraRules() string   { return v.ж.ExtraRules }
+func (v DockerNetworkView) RulesGeneration() int { return v.ж.RulesGeneration }
+func (v DockerNetworkView) RulesHistory() views.Slice[RulesVersion] {
+	return views.SliceOf(v.ж.RulesHistory)
+}
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _DockerNetworkViewNeedsRegeneration = DockerNetwork(struct {
-	NetworkID     string
-	NetNS         string
-	IPv4Gateway   netip.Prefix
-	IPv4Range     netip.Prefix
-	Endpoints     map[string]*DockerEndpoint
-	EndpointAddrs map[string]netip.Prefix
-	PortMap       map[string]*EndpointPort
+	NetworkID       string
+	NetNS           string
+	IPv4Gateway     netip.Prefix
+	IPv4Range       netip.Prefix
+	Endpoints       map[string]*DockerEndpoint
+	EndpointAddrs   map[string]netip.Prefix
+	PortMap         map[string]*EndpointPort
+	ExtraRules      string
+	RulesGeneration int
+	RulesHistory    []RulesVersion
 }{})
 
 // View returns a readonly view of DockerEndpoint.
@@ -0,0 +1,62 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diffutil
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"Equal", "a\nb\n", "a\nb\n", 3, ""},
+		{"Change", "a\nb\nc\n", "a\nx\nc\n", 3, "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"No Context", "a\nb\nc\n", "a\nx\nc\n", 0, "--- old\n+++ new\n@@ -2 +2 @@\n-b\n+x\n"},
+		{"Negative Context", "a\nb\nc\n", "a\nx\nc\n", -1, "--- old\n+++ new\n@@ -2 +2 @@\n-b\n+x\n"},
+		{"Insert", "a\nc\n", "a\nb\nc\n", 0, "--- old\n+++ new\n@@ -1,0 +2 @@\n+b\n"},
+		{"Delete", "a\nb\nc\n", "a\nc\n", 0, "--- old\n+++ new\n@@ -2 +1,0 @@\n-b\n"},
+		{"From Empty", "", "a\n", 3, "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{"To Empty", "a\n", "", 3, "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n"},
+		{"No Newline", "a\n", "a", 3, "--- old\n+++ new\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n"},
+		{"Two Hunks", "1\n2\n3\n4\n5\n6\n7\n", "x\n2\n3\n4\n5\n6\ny\n", 1, "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+y\n"},
+		{"Merged Hunks", "1\n2\n3\n4\n", "x\n2\n3\ny\n", 1, "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", []byte(tt.a), []byte(tt.b), tt.context)
+			if got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"", false},
+		{"hello\n", false},
+		{"hel\x00lo", true},
+	}
+	for _, tt := range tests {
+		if got := IsBinary([]byte(tt.in)); got != tt.want {
+			t.Errorf("IsBinary(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
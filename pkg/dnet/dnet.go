@@ -18,8 +18,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"net"
 	"net/http"
 	"net/netip"
 	"os"
@@ -118,26 +116,7 @@ func runCmd(name string, args ...string) error {
 	return nil
 }
 
-const (
-	postroutingChainName = "YEET_POSTROUTING"
-	preroutingChainName  = "YEET_PREROUTING"
-)
-
-func ensurePreroutingChain() error {
-	if err := runCmd("iptables", "-t", "nat", "-L", preroutingChainName); err == nil {
-		return nil
-	}
-	if err := runCmd("iptables", "-t", "nat", "-N", preroutingChainName); err != nil {
-		return err
-	}
-	if err := runCmd("iptables", "-t", "nat", "-A", "PREROUTING", "-j", preroutingChainName); err != nil {
-		return err
-	}
-	if err := runCmd("iptables", "-t", "nat", "-A", preroutingChainName, "-i", "br0", "-j", "RETURN"); err != nil {
-		return err
-	}
-	return nil
-}
+const postroutingChainName = "YEET_POSTROUTING"
 
 func ensurePostroutingChain() error {
 	if err := runCmd("iptables", "-t", "nat", "-L", postroutingChainName); err == nil {
@@ -170,34 +149,27 @@ func (p *plugin) LeaveNetwork(w http.ResponseWriter, r *http.Request) {
 	eid := req["EndpointID"].(string)
 	ifName := "yv-" + eid[:4]
 	var netns string
-	var ep *db.DockerEndpoint
-	var toDelete map[string]*db.EndpointPort
+	var n *db.DockerNetwork
 	if _, err := p.db.MutateData(func(d *db.Data) error {
-		n, ok := d.DockerNetworks[nid]
+		var ok bool
+		n, ok = d.DockerNetworks[nid]
 		if !ok {
 			return fmt.Errorf("network not found")
 		}
 		netns = n.NetNS
-		ep, ok = n.Endpoints[eid]
-		if !ok {
+		if _, ok = n.Endpoints[eid]; !ok {
 			return fmt.Errorf("endpoint not found")
 		}
 		delete(n.Endpoints, eid)
-		for k, pm := range n.PortMap {
-			if pm.EndpointID == eid {
-				mak.Set(&toDelete, k, pm)
-			}
-		}
+		n = n.Clone()
 		return nil
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	if err := p.runInNetNS(netns, func() error {
-		for hp, dst := range toDelete {
-			if err := p.forwardPort(ep, hp, dst, false); err != nil {
-				return err
-			}
+		if err := p.applyRules(n); err != nil {
+			return err
 		}
 		if err := runCmd("ip", "link", "del", ifName); err != nil {
 			return err
@@ -263,8 +235,7 @@ func (p *plugin) JoinNetwork(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "network not found", http.StatusBadRequest)
 		return
 	}
-	ep, ok := n.Endpoints[eid]
-	if !ok {
+	if _, ok := n.Endpoints[eid]; !ok {
 		http.Error(w, "endpoint not found", http.StatusBadRequest)
 		return
 	}
@@ -296,12 +267,7 @@ func (p *plugin) JoinNetwork(w http.ResponseWriter, r *http.Request) {
 		if err := ensurePostroutingChain(); err != nil {
 			return err
 		}
-		for hp, dst := range n.PortMap {
-			if err := p.forwardPort(ep, hp, dst, true); err != nil {
-				return err
-			}
-		}
-		return nil
+		return p.applyRules(n)
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -317,58 +283,6 @@ func (p *plugin) JoinNetwork(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (p *plugin) forwardPort(ep *db.DockerEndpoint, hp string, dst *db.EndpointPort, add bool) error {
-	if dst.EndpointID != ep.EndpointID {
-		return nil
-	}
-	if err := ensurePreroutingChain(); err != nil {
-		return err
-	}
-	var hpProto db.ProtoPort
-	if err := hpProto.Parse(hp); err != nil {
-		return err
-	}
-	var proto string
-	switch hpProto.Proto {
-	case 6:
-		proto = "tcp"
-	case 17:
-		proto = "udp"
-	default:
-		return fmt.Errorf("unsupported protocol: %d", hpProto.Proto)
-	}
-	var cmd string
-	if add {
-		cmd = "-A"
-	} else {
-		cmd = "-D"
-	}
-	log.Printf("adding forward for %s:%d -> %s:%d", proto, hpProto.Port, ep.IPv4.Addr().String(), dst.Port)
-	if err := runCmd("iptables",
-		"-t", "nat",
-		cmd, preroutingChainName,
-		"-p", proto,
-		"--dport", fmt.Sprint(hpProto.Port),
-		"-j", "DNAT",
-		"--to-destination", net.JoinHostPort(ep.IPv4.Addr().String(), fmt.Sprint(dst.Port)),
-	); err != nil {
-		return err
-	}
-
-	if err := runCmd("iptables",
-		"-t", "nat",
-		cmd, "OUTPUT",
-		"-p", proto,
-		"-o", "lo",
-		"--dport", fmt.Sprint(hpProto.Port),
-		"-j", "DNAT",
-		"--to-destination", net.JoinHostPort(ep.IPv4.Addr().String(), fmt.Sprint(dst.Port)),
-	); err != nil {
-		return err
-	}
-	return nil
-}
-
 func (p *plugin) DeleteNetwork(w http.ResponseWriter, r *http.Request) {
 	body := requestLogger(r)
 	var req struct {
@@ -489,7 +403,7 @@ func (p *plugin) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
 		for k, ep := range n.Endpoints {
 			if ep.IPv4 == pfx && k != ep.EndpointID {
 				delete(n.Endpoints, k)
-				// TODO: do we have to update iptables?
+				// TODO: do we have to update the rules?
 			}
 		}
 		mak.Set(&n.Endpoints, req.EndpointID, ep)
@@ -551,6 +465,7 @@ func New(db *db.Store) http.Handler {
 	p := &plugin{
 		db: db,
 	}
+	p.migrateRules()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/Plugin.Activate", p.PluginActivate)
 	mux.HandleFunc("/NetworkDriver.CreateNetwork", p.CreateNetwork)
@@ -0,0 +1,215 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnet
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// RulesTable is the nftables table holding the rules of a network, inside the
+// network's namespace.
+const RulesTable = "yeet"
+
+// RenderRules renders the nftables ruleset of network n: the DNAT rules for
+// its published ports followed by the user's ExtraRules. The ruleset replaces
+// the whole table, so applying it with `nft -f` is atomic: either all of it
+// takes effect or, if any rule fails, none of it does and the previous
+// ruleset stays in place.
+func RenderRules(n *db.DockerNetwork, extra string) string {
+	type forward struct {
+		proto string
+		port  uint16
+		dst   string
+	}
+	var fwds []forward
+	for hp, dst := range n.PortMap {
+		ep, ok := n.Endpoints[dst.EndpointID]
+		if !ok {
+			continue
+		}
+		var pp db.ProtoPort
+		if err := pp.Parse(hp); err != nil {
+			continue
+		}
+		proto, ok := protoName(pp.Proto)
+		if !ok {
+			continue
+		}
+		fwds = append(fwds, forward{proto, pp.Port, net.JoinHostPort(ep.IPv4.Addr().String(), fmt.Sprint(dst.Port))})
+	}
+	slices.SortFunc(fwds, func(a, b forward) int {
+		if c := strings.Compare(a.proto, b.proto); c != 0 {
+			return c
+		}
+		return int(a.port) - int(b.port)
+	})
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "table ip %s\ndelete table ip %s\n", RulesTable, RulesTable)
+	fmt.Fprintf(&b, "table ip %s {\n", RulesTable)
+	fmt.Fprintf(&b, "\tchain prerouting {\n\t\ttype nat hook prerouting priority dstnat; policy accept;\n")
+	fmt.Fprintf(&b, "\t\tiifname \"br0\" return\n")
+	for _, f := range fwds {
+		fmt.Fprintf(&b, "\t\t%s dport %d dnat to %s\n", f.proto, f.port, f.dst)
+	}
+	fmt.Fprintf(&b, "\t}\n")
+	fmt.Fprintf(&b, "\tchain output {\n\t\ttype nat hook output priority -100; policy accept;\n")
+	for _, f := range fwds {
+		fmt.Fprintf(&b, "\t\toifname \"lo\" %s dport %d dnat to %s\n", f.proto, f.port, f.dst)
+	}
+	fmt.Fprintf(&b, "\t}\n")
+	if extra = strings.TrimSpace(extra); extra != "" {
+		fmt.Fprintf(&b, "\n\t# Extra rules\n")
+		for _, l := range strings.Split(extra, "\n") {
+			fmt.Fprintf(&b, "\t%s\n", l)
+		}
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.String()
+}
+
+// MaxRulesHistory is the number of previous generations of the extra rules
+// kept for each network.
+const MaxRulesHistory = 10
+
+// SetExtraRules makes extra the extra rules of network n as a new generation,
+// keeping the current ones in its history.
+func SetExtraRules(n *db.DockerNetwork, extra string) {
+	n.RulesHistory = append(n.RulesHistory, db.RulesVersion{
+		Generation: n.RulesGeneration,
+		ExtraRules: n.ExtraRules,
+	})
+	if over := len(n.RulesHistory) - MaxRulesHistory; over > 0 {
+		n.RulesHistory = slices.Delete(n.RulesHistory, 0, over)
+	}
+	n.ExtraRules = extra
+	n.RulesGeneration++
+}
+
+// ExtraRulesAt returns the extra rules of generation gen of network n. It
+// reports false if the generation is unknown or no longer kept.
+func ExtraRulesAt(n *db.DockerNetwork, gen int) (string, bool) {
+	if gen == n.RulesGeneration {
+		return n.ExtraRules, true
+	}
+	for _, v := range n.RulesHistory {
+		if v.Generation == gen {
+			return v.ExtraRules, true
+		}
+	}
+	return "", false
+}
+
+func protoName(proto int) (string, bool) {
+	switch proto {
+	case 6:
+		return "tcp", true
+	case 17:
+		return "udp", true
+	}
+	return "", false
+}
+
+// ApplyRules atomically replaces the ruleset of the network namespace at
+// nsPath with rules. If check is set, the ruleset is only validated.
+func ApplyRules(nsPath, rules string, check bool) error {
+	args := []string{"--net=" + nsPath, "nft"}
+	if check {
+		args = append(args, "--check")
+	}
+	args = append(args, "-f", "-")
+	cmd := exec.Command("nsenter", args...)
+	cmd.Stdin = strings.NewReader(rules)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to apply rules: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// applyRules renders and applies the ruleset of network n.
+func (p *plugin) applyRules(n *db.DockerNetwork) error {
+	return ApplyRules(n.NetNS, RenderRules(n, n.ExtraRules), false)
+}
+
+// legacyPreroutingChain is the iptables chain that held the DNAT rules of a
+// network before they moved to the RulesTable nftables table.
+const legacyPreroutingChain = "YEET_PREROUTING"
+
+// removeLegacyRules removes the iptables DNAT rules of the network namespace
+// at nsPath written by older versions, which would otherwise keep forwarding
+// ports that are no longer published.
+func removeLegacyRules(nsPath string) error {
+	ipt := func(args ...string) ([]byte, error) {
+		return exec.Command("nsenter", append([]string{"--net=" + nsPath, "iptables", "-t", "nat"}, args...)...).CombinedOutput()
+	}
+	if _, err := ipt("-S", legacyPreroutingChain); err != nil {
+		return nil // Nothing to migrate.
+	}
+	// The chain also had a matching rule in OUTPUT for every port.
+	out, err := ipt("-S", "OUTPUT")
+	if err != nil {
+		return fmt.Errorf("failed to list OUTPUT rules: %w: %s", err, bytes.TrimSpace(out))
+	}
+	for _, l := range strings.Split(string(out), "\n") {
+		f := strings.Fields(l)
+		if len(f) < 2 || f[0] != "-A" || !slices.Contains(f, "DNAT") || !strings.Contains(l, "-o lo ") {
+			continue
+		}
+		if out, err := ipt(append([]string{"-D"}, f[1:]...)...); err != nil {
+			return fmt.Errorf("failed to delete rule %q: %w: %s", l, err, bytes.TrimSpace(out))
+		}
+	}
+	for {
+		if _, err := ipt("-D", "PREROUTING", "-j", legacyPreroutingChain); err != nil {
+			break
+		}
+	}
+	for _, op := range []string{"-F", "-X"} {
+		if out, err := ipt(op, legacyPreroutingChain); err != nil {
+			return fmt.Errorf("failed to remove %s: %w: %s", legacyPreroutingChain, err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+// migrateRules replaces the legacy iptables rules of every network with its
+// nftables ruleset.
+func (p *plugin) migrateRules() {
+	dv, err := p.db.Get()
+	if err != nil {
+		log.Printf("dnet: failed to migrate rules: %v", err)
+		return
+	}
+	for id, n := range dv.AsStruct().DockerNetworks {
+		if n.NetNS == "" {
+			continue
+		}
+		if err := removeLegacyRules(n.NetNS); err != nil {
+			log.Printf("dnet: network %s: %v", id, err)
+			continue
+		}
+		if err := p.applyRules(n); err != nil {
+			log.Printf("dnet: network %s: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnet
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func testNetwork() *db.DockerNetwork {
+	return &db.DockerNetwork{
+		Endpoints: map[string]*db.DockerEndpoint{
+			"web": {EndpointID: "web", IPv4: netip.MustParsePrefix("10.0.0.2/24")},
+			"dns": {EndpointID: "dns", IPv4: netip.MustParsePrefix("10.0.0.3/24")},
+		},
+		PortMap: map[string]*db.EndpointPort{
+			"6/8080": {EndpointID: "web", Port: 80},
+			"6/443":  {EndpointID: "web", Port: 8443},
+			"17/53":  {EndpointID: "dns", Port: 53},
+			"6/53":   {EndpointID: "dns", Port: 53},
+			"6/9000": {EndpointID: "gone", Port: 9000}, // Endpoint was removed.
+			"1/0":    {EndpointID: "web", Port: 0},     // Unsupported protocol.
+		},
+	}
+}
+
+func TestRenderRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		n     *db.DockerNetwork
+		extra string
+	}{
+		{name: "empty", n: &db.DockerNetwork{}},
+		{name: "ports", n: testNetwork()},
+		{
+			name: "extra",
+			n:    testNetwork(),
+			extra: `
+chain input {
+	type filter hook input priority filter; policy accept;
+	tcp dport 22 drop
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderRules(tt.n, tt.extra)
+			golden := filepath.Join("testdata", "rules-"+tt.name+".nft")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("RenderRules mismatch (run with -update to regenerate)\ngot:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSetExtraRules(t *testing.T) {
+	n := &db.DockerNetwork{}
+	for i := 1; i <= MaxRulesHistory+2; i++ {
+		SetExtraRules(n, fmt.Sprintf("# rules %d", i))
+	}
+	if got, want := n.RulesGeneration, MaxRulesHistory+2; got != want {
+		t.Fatalf("RulesGeneration = %d, want %d", got, want)
+	}
+	if got := len(n.RulesHistory); got != MaxRulesHistory {
+		t.Fatalf("len(RulesHistory) = %d, want %d", got, MaxRulesHistory)
+	}
+	for i, v := range n.RulesHistory {
+		if want := i + 2; v.Generation != want {
+			t.Errorf("RulesHistory[%d].Generation = %d, want %d", i, v.Generation, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		gen    int
+		want   string
+		wantOK bool
+	}{
+		{gen: MaxRulesHistory + 2, want: fmt.Sprintf("# rules %d", MaxRulesHistory+2), wantOK: true},
+		{gen: 5, want: "# rules 5", wantOK: true},
+		{gen: 2, want: "# rules 2", wantOK: true},
+		{gen: 1, wantOK: false}, // Dropped from the history.
+		{gen: 0, wantOK: false},
+		{gen: 100, wantOK: false},
+	} {
+		got, ok := ExtraRulesAt(n, tt.gen)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ExtraRulesAt(%d) = %q, %v; want %q, %v", tt.gen, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
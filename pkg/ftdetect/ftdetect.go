@@ -15,15 +15,18 @@
 package ftdetect
 
 import (
+	"archive/tar"
 	"debug/elf"
 	"debug/macho"
+	"debug/pe"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path"
 
-	"github.com/evanw/esbuild/pkg/api"
 	"gopkg.in/yaml.v3"
 )
 
@@ -36,8 +39,49 @@ const (
 	TypeScript
 	Script
 	Zstd
+	ImageArchive
 )
 
+func (ft FileType) String() string {
+	switch ft {
+	case Binary:
+		return "binary"
+	case DockerCompose:
+		return "Docker Compose"
+	case TypeScript:
+		return "TypeScript"
+	case Script:
+		return "script"
+	case Zstd:
+		return "zstd"
+	case ImageArchive:
+		return "image archive"
+	default:
+		return "unknown"
+	}
+}
+
+// DetectorFunc reports whether the contents of r are of a particular file
+// type. r is positioned at the start of the file.
+type DetectorFunc func(r io.ReadSeeker) (bool, error)
+
+type detector struct {
+	ft FileType
+	fn DetectorFunc
+}
+
+// extraDetectors are detectors registered by other packages. They are run, in
+// registration order, after the built-in detectors. Heavy detectors (e.g.
+// TypeScript, which pulls in esbuild) live in their own packages so that
+// binaries which do not need them can leave them out.
+var extraDetectors []detector
+
+// Register registers fn as a detector for ft. It is meant to be called from
+// an init function and is not safe for concurrent use with DetectFile.
+func Register(ft FileType, fn DetectorFunc) {
+	extraDetectors = append(extraDetectors, detector{ft: ft, fn: fn})
+}
+
 type file struct {
 	f      *os.File
 	goos   string
@@ -55,6 +99,17 @@ func DetectFile(path, goos, goarch string) (FileType, error) {
 	return f.detect()
 }
 
+// IsImageArchive reports whether the file at path is a tarball of a
+// container image, as written by `docker save` or of an OCI image layout.
+func IsImageArchive(path string) (bool, error) {
+	f, err := newFile(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return f.detectImageArchive()
+}
+
 func newFile(path string) (*file, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -73,12 +128,9 @@ func (f *file) detect() (FileType, error) {
 		return Unknown, fmt.Errorf("failed to detect binary: %w", err)
 	} else if is {
 		log.Printf("Detected binary file")
-		if same, err := f.isSameArch(); err != nil {
-			log.Printf("Failed to check architecture: %v", err)
-			return Unknown, fmt.Errorf("failed to check architecture: %w", err)
-		} else if !same {
-			log.Printf("Architecture mismatch")
-			return Unknown, fmt.Errorf("architecture mismatch")
+		if err := f.checkPlatform(); err != nil {
+			log.Printf("Failed to check platform: %v", err)
+			return Unknown, err
 		}
 		return Binary, nil
 	}
@@ -93,17 +145,26 @@ func (f *file) detect() (FileType, error) {
 	} else if is {
 		return Script, nil
 	}
+	if is, err := f.detectImageArchive(); err != nil {
+		return Unknown, fmt.Errorf("failed to detect image archive: %w", err)
+	} else if is {
+		return ImageArchive, nil
+	}
 	// Docker Compose file
 	if is, err := f.detectDockerCompose(); err != nil {
 		return Unknown, fmt.Errorf("failed to detect Docker Compose: %w", err)
 	} else if is {
 		return DockerCompose, nil
 	}
-	// TypeScript file
-	if is, err := f.detectTypeScript(); err != nil {
-		return Unknown, fmt.Errorf("failed to detect TypeScript: %w", err)
-	} else if is {
-		return TypeScript, nil
+	for _, d := range extraDetectors {
+		if err := f.checkAndSeek0(); err != nil {
+			return Unknown, err
+		}
+		if is, err := d.fn(f.f); err != nil {
+			return Unknown, fmt.Errorf("failed to detect %v: %w", d.ft, err)
+		} else if is {
+			return d.ft, nil
+		}
 	}
 	return Unknown, fmt.Errorf("unable to detect file type")
 }
@@ -118,28 +179,31 @@ func (f *file) checkAndSeek0() error {
 	return nil
 }
 
-func (f *file) detectBinary() (bool, error) {
+// binaryFormat returns the executable format of the file from its magic
+// number, or "" if it is not an executable.
+func (f *file) binaryFormat() (string, error) {
 	if err := f.checkAndSeek0(); err != nil {
-		return false, err
+		return "", err
 	}
 	var magic [4]byte
 	if _, err := io.ReadFull(f.f, magic[:]); err != nil {
-		return false, fmt.Errorf("failed to read file: %w", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
-	mn := binary.LittleEndian.Uint32(magic[:])
-	switch mn {
+	if magic[0] == 'M' && magic[1] == 'Z' { // PE (Windows) magic number
+		return "pe", nil
+	}
+	switch binary.LittleEndian.Uint32(magic[:]) {
 	case 0x464C457F: // ELF magic number (0x7f 'E' 'L' 'F')
-		if f.goos == "darwin" {
-			return false, fmt.Errorf("non-darwin (ELF) binary on darwin system")
-		}
-		return true, nil
+		return "elf", nil
 	case macho.Magic32, macho.Magic64, macho.MagicFat: // Mach-O magic numbers
-		if f.goos != "darwin" {
-			return false, fmt.Errorf("darwin binary (Mach-O) on non-darwin system")
-		}
-		return true, nil
+		return "macho", nil
 	}
-	return false, nil
+	return "", nil
+}
+
+func (f *file) detectBinary() (bool, error) {
+	format, err := f.binaryFormat()
+	return format != "", err
 }
 
 func (f *file) detectZstd() (bool, error) {
@@ -156,16 +220,117 @@ func (f *file) detectZstd() (bool, error) {
 	return true, nil
 }
 
-func (f *file) isSameArch() (bool, error) {
-	binArch, err := f.detectArchitectureElf()
+// PlatformError is returned by DetectFile for binaries built for another
+// platform than the one they are deployed to.
+type PlatformError struct {
+	// GOOS and GOARCH are the platform of the binary. GOARCH is "unknown"
+	// for architectures Go does not support.
+	GOOS, GOARCH string
+	// HostGOOS and HostGOARCH are the platform DetectFile was called with.
+	HostGOOS, HostGOARCH string
+}
+
+func (e *PlatformError) Error() string {
+	return fmt.Sprintf("binary is for %s/%s, host is %s/%s", e.GOOS, e.GOARCH, e.HostGOOS, e.HostGOARCH)
+}
+
+// checkPlatform returns a *PlatformError if the binary does not run on the
+// platform of the host.
+func (f *file) checkPlatform() error {
+	goos, goarch, err := f.binaryPlatform()
 	if err != nil {
-		return false, fmt.Errorf("failed to detect architecture: %w", err)
+		return fmt.Errorf("failed to detect architecture: %w", err)
 	}
-	hostArch := f.hostArchitecture()
-	if binArch == hostArch {
-		return true, nil
+	if goos != f.goos || goarch != f.goarch {
+		return &PlatformError{GOOS: goos, GOARCH: goarch, HostGOOS: f.goos, HostGOARCH: f.goarch}
+	}
+	return nil
+}
+
+// binaryPlatform returns the GOOS and GOARCH of the binary. ELF binaries are
+// assumed to be for the host system unless it uses another format, as Go
+// binaries for the BSDs and Linux differ only in their syscalls.
+func (f *file) binaryPlatform() (goos, goarch string, _ error) {
+	format, err := f.binaryFormat()
+	if err != nil {
+		return "", "", err
+	}
+	if err := f.checkAndSeek0(); err != nil {
+		return "", "", err
+	}
+	switch format {
+	case "pe":
+		goarch, err = f.detectArchitecturePE()
+		return "windows", goarch, err
+	case "macho":
+		goarch, err = f.detectArchitectureMachO()
+		return "darwin", goarch, err
+	}
+	goos = f.goos
+	if goos == "darwin" || goos == "windows" {
+		goos = "linux"
+	}
+	goarch, err = f.detectArchitectureElf()
+	return goos, goarch, err
+}
+
+// detectArchitectureMachO returns the architecture of a Mach-O binary. For
+// universal binaries, that is the host architecture if they contain it.
+func (f *file) detectArchitectureMachO() (string, error) {
+	if fat, err := macho.NewFatFile(f.f); err == nil {
+		defer fat.Close()
+		for _, a := range fat.Arches {
+			if arch := machoArchitecture(a.Cpu); arch == f.goarch {
+				return arch, nil
+			}
+		}
+		if len(fat.Arches) == 0 {
+			return "unknown", nil
+		}
+		return machoArchitecture(fat.Arches[0].Cpu), nil
+	}
+	if err := f.checkAndSeek0(); err != nil {
+		return "", err
+	}
+	mf, err := macho.NewFile(f.f)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse Mach-O file: %v", err)
+	}
+	return machoArchitecture(mf.Cpu), nil
+}
+
+func machoArchitecture(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuArm64:
+		return "arm64"
+	default:
+		return "unknown"
+	}
+}
+
+func (f *file) detectArchitecturePE() (string, error) {
+	pf, err := pe.NewFile(f.f)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse PE file: %v", err)
+	}
+	switch pf.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64", nil
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386", nil
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm", nil
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64", nil
+	default:
+		return "unknown", nil
 	}
-	return false, fmt.Errorf("binary architecture %s does not match host architecture %s", binArch, hostArch)
 }
 
 func (f *file) detectArchitectureElf() (string, error) {
@@ -177,35 +342,43 @@ func (f *file) detectArchitectureElf() (string, error) {
 		return "", fmt.Errorf("failed to parse ELF file: %v", err)
 	}
 
+	le := elfFile.ByteOrder == binary.LittleEndian
+	is64 := elfFile.Class == elf.ELFCLASS64
 	switch elfFile.Machine {
 	case elf.EM_X86_64:
-		return "x86_64", nil
+		return "amd64", nil
 	case elf.EM_386:
-		return "x86", nil
+		return "386", nil
 	case elf.EM_ARM:
-		return "ARM", nil
+		return "arm", nil
 	case elf.EM_AARCH64:
-		return "ARM64", nil
+		return "arm64", nil
+	case elf.EM_RISCV:
+		return "riscv64", nil
+	case elf.EM_LOONGARCH:
+		return "loong64", nil
+	case elf.EM_S390:
+		return "s390x", nil
+	case elf.EM_PPC64:
+		if le {
+			return "ppc64le", nil
+		}
+		return "ppc64", nil
+	case elf.EM_MIPS:
+		switch {
+		case is64 && le:
+			return "mips64le", nil
+		case is64:
+			return "mips64", nil
+		case le:
+			return "mipsle", nil
+		}
+		return "mips", nil
 	default:
 		return "unknown", nil
 	}
 }
 
-func (f *file) hostArchitecture() string {
-	switch f.goarch {
-	case "amd64":
-		return "x86_64"
-	case "386":
-		return "x86"
-	case "arm":
-		return "ARM"
-	case "arm64":
-		return "ARM64"
-	default:
-		return "unknown"
-	}
-}
-
 // detectScript verifies that the given file is a script by checking for a
 // shebang at the start of the file.
 func (f *file) detectScript() (bool, error) {
@@ -226,6 +399,55 @@ func (f *file) detectScript() (bool, error) {
 	return true, nil
 }
 
+// detectImageArchive reports whether the file is a tarball of a container
+// image, as written by `docker save` or of an OCI image layout. It requires
+// the manifest.json of a docker archive, or the oci-layout and index.json of
+// an OCI layout, to parse; a tarball merely containing such a name isn't one.
+func (f *file) detectImageArchive() (bool, error) {
+	if err := f.checkAndSeek0(); err != nil {
+		return false, err
+	}
+	var ociLayout, ociIndex bool
+	tr := tar.NewReader(f.f)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			// Either the end of the archive or not a tarball at all.
+			return ociLayout && ociIndex, nil
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		switch path.Clean(h.Name) {
+		case "manifest.json":
+			var m []struct {
+				Config string
+				Layers []string
+			}
+			if json.NewDecoder(io.LimitReader(tr, maxImageMetadata)).Decode(&m) == nil && len(m) > 0 && m[0].Config != "" {
+				return true, nil
+			}
+		case "oci-layout":
+			var l struct {
+				ImageLayoutVersion string `json:"imageLayoutVersion"`
+			}
+			ociLayout = json.NewDecoder(io.LimitReader(tr, maxImageMetadata)).Decode(&l) == nil && l.ImageLayoutVersion != ""
+		case "index.json":
+			var idx struct {
+				Manifests []json.RawMessage `json:"manifests"`
+			}
+			ociIndex = json.NewDecoder(io.LimitReader(tr, maxImageMetadata)).Decode(&idx) == nil && len(idx.Manifests) > 0
+		}
+		if ociLayout && ociIndex {
+			return true, nil
+		}
+	}
+}
+
+// maxImageMetadata bounds how much of the metadata files of an image archive
+// is read to detect it.
+const maxImageMetadata = 1 << 20
+
 // detectDockerCompose verifies that the given file is a valid Docker Compose by
 // unmarshalling it and checking for errors. It only checks for the presence of
 // the top-level `services` key.
@@ -250,21 +472,3 @@ func (f *file) detectDockerCompose() (bool, error) {
 
 	return true, nil
 }
-
-func (f *file) detectTypeScript() (bool, error) {
-	if err := f.checkAndSeek0(); err != nil {
-		return false, fmt.Errorf("failed to seek to start of file: %w", err)
-	}
-	bs, err := io.ReadAll(f.f)
-	if err != nil {
-		return false, fmt.Errorf("failed to read file: %v", err)
-	}
-	// TODO: This is pretty heavy-handed in terms of binary size impact.
-	result := api.Transform(string(bs), api.TransformOptions{
-		Loader: api.LoaderTS,
-	})
-	if len(result.Errors) > 0 {
-		return false, fmt.Errorf("failed to parse TypeScript: %v", result.Errors)
-	}
-	return true, nil
-}
@@ -0,0 +1,44 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tsdetect registers a TypeScript detector with ftdetect. It is split
+// out of ftdetect because esbuild adds significantly to the binary size;
+// import it for its side effects in binaries that need to detect TypeScript.
+package tsdetect
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/yeetrun/yeet/pkg/ftdetect"
+)
+
+func init() {
+	ftdetect.Register(ftdetect.TypeScript, detectTypeScript)
+}
+
+func detectTypeScript(r io.ReadSeeker) (bool, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %v", err)
+	}
+	result := api.Transform(string(bs), api.TransformOptions{
+		Loader: api.LoaderTS,
+	})
+	if len(result.Errors) > 0 {
+		return false, fmt.Errorf("failed to parse TypeScript: %v", result.Errors)
+	}
+	return true, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package preflight checks that payloads (binaries, scripts, compose files
+// and images) can run on the host they are deployed to, before they are
+// uploaded or installed. The yeet client runs the checks against the
+// platform catch reports and catch runs them again against its own, so that
+// payloads uploaded by other means get the same errors.
+//
+// Errors say how to fix the payload, e.g. which GOARCH to rebuild with.
+package preflight
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/ftdetect"
+	v1 "github.com/yeetrun/yeet/tempfork/google/go-containerregistry/pkg/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a payload that can't run on the host, with how to fix it.
+type Error struct {
+	// Problem describes the incompatibility.
+	Problem string
+	// Fix suggests how to make the payload compatible.
+	Fix string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s; %s", e.Problem, e.Fix)
+}
+
+// CheckFile detects the type of the file at p and checks that it can run on
+// a goos/goarch host.
+func CheckFile(p, goos, goarch string) (ftdetect.FileType, error) {
+	ft, err := ftdetect.DetectFile(p, goos, goarch)
+	var pe *ftdetect.PlatformError
+	if errors.As(err, &pe) {
+		return ft, binaryError(pe)
+	} else if err != nil {
+		return ft, err
+	}
+	if ft == ftdetect.DockerCompose {
+		return ft, checkCompose(p, goos, goarch)
+	}
+	return ft, nil
+}
+
+func binaryError(pe *ftdetect.PlatformError) error {
+	e := &Error{
+		Problem: pe.Error(),
+		Fix:     fmt.Sprintf("rebuild it with GOOS=%s GOARCH=%s", pe.HostGOOS, pe.HostGOARCH),
+	}
+	if pe.GOOS == "darwin" && pe.HostGOOS == "darwin" {
+		e.Fix += ", or as a universal binary with lipo"
+	}
+	return e
+}
+
+// checkCompose checks the platform the services of the compose file at p
+// ask for, if any.
+func checkCompose(p, goos, goarch string) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	var cf struct {
+		Services map[string]struct {
+			Platform string `yaml:"platform"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		// Templates are only valid YAML once rendered on the host.
+		return nil
+	}
+	for name, s := range cf.Services {
+		if s.Platform == "" || matchPlatform(s.Platform, goos, goarch) {
+			continue
+		}
+		return &Error{
+			Problem: fmt.Sprintf("compose service %q has platform %s, host is %s/%s", name, s.Platform, goos, goarch),
+			Fix:     fmt.Sprintf("set platform: %s/%s or remove it and use a multi-arch image", goos, goarch),
+		}
+	}
+	return nil
+}
+
+// matchPlatform reports whether platform, as os/arch[/variant], is goos/goarch.
+func matchPlatform(platform, goos, goarch string) bool {
+	parts := strings.Split(platform, "/")
+	return len(parts) >= 2 && parts[0] == goos && parts[1] == goarch
+}
+
+// CheckImage checks that image, whose config has the platform imgOS/imgArch,
+// can run on a goos/goarch host.
+func CheckImage(image, imgOS, imgArch, goos, goarch string) error {
+	if imgOS == goos && imgArch == goarch {
+		return nil
+	}
+	return &Error{
+		Problem: fmt.Sprintf("image %s is for %s/%s, host is %s/%s", image, imgOS, imgArch, goos, goarch),
+		Fix:     fmt.Sprintf("rebuild it with docker buildx build --platform=%s/%s, or push a multi-arch image", goos, goarch),
+	}
+}
+
+// NoImageForPlatform returns the error for a multi-arch image with no image
+// for a goos/goarch host.
+func NoImageForPlatform(image, goos, goarch string) error {
+	e := &Error{
+		Problem: fmt.Sprintf("no image found for %s/%s", goos, goarch),
+		Fix:     fmt.Sprintf("add %s/%s to the platforms the image is built for", goos, goarch),
+	}
+	if image != "" {
+		e.Problem = fmt.Sprintf("%s has no image for %s/%s", image, goos, goarch)
+	}
+	return e
+}
+
+// PlatformImage returns the image of idx for a goos/goarch host. Images
+// without a platform are assumed to match.
+func PlatformImage(idx v1.ImageIndex, goos, goarch string) (v1.Image, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range im.Manifests {
+		if desc.Platform != nil && (desc.Platform.OS != goos || desc.Platform.Architecture != goarch) {
+			continue
+		}
+		switch {
+		case desc.MediaType.IsImage():
+			return idx.Image(desc.Digest)
+		case desc.MediaType.IsIndex():
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if img, err := PlatformImage(child, goos, goarch); err == nil {
+				return img, nil
+			}
+		}
+	}
+	return nil, NoImageForPlatform("", goos, goarch)
+}
+
+// CheckInterpreter checks that the interpreter in the shebang of the script
+// at p is installed. It is only meaningful on the host itself.
+func CheckInterpreter(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("failed to read script: %w", err)
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return &Error{Problem: "script has an empty shebang", Fix: "start it with e.g. #!/bin/sh"}
+	}
+	interp := fields[0]
+	if strings.HasSuffix(interp, "/env") && len(fields) > 1 {
+		// #!/usr/bin/env [-S] name
+		if i := slices.IndexFunc(fields[1:], func(f string) bool { return !strings.HasPrefix(f, "-") }); i >= 0 {
+			name := fields[1+i]
+			if _, err := exec.LookPath(name); err != nil {
+				return &Error{
+					Problem: fmt.Sprintf("script interpreter %s is not installed on the host", name),
+					Fix:     fmt.Sprintf("install %s on the host, or deploy a binary instead", name),
+				}
+			}
+			return nil
+		}
+	}
+	if _, err := os.Stat(interp); err != nil {
+		return &Error{
+			Problem: fmt.Sprintf("script interpreter %s does not exist on the host", interp),
+			Fix:     "install it, or change the shebang to where the host has it, e.g. #!/usr/bin/env <name>",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets encrypts small values, like passwords and API keys, so
+// that they can be stored at rest in the catch DB or sealed by clients for
+// the host.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Box seals and opens values with a host-local AES-256-GCM key.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// Open returns a Box using the key stored at keyPath, creating a new random
+// key there if it does not exist yet.
+func Open(keyPath string) (*Box, error) {
+	key, err := os.ReadFile(keyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, key, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext and returns it base64 encoded.
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Unseal decrypts a value returned by Seal.
+func (b *Box) Unseal(sealed string) ([]byte, error) {
+	ct, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	ns := b.aead.NonceSize()
+	if len(ct) < ns {
+		return nil, errors.New("ciphertext too short")
+	}
+	pt, err := b.aead.Open(nil, ct[:ns], ct[ns:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return pt, nil
+}
+
+// SealedPrefix marks a value sealed with SealTo, e.g. in an env file.
+const SealedPrefix = "yeet-sealed:"
+
+// sealInfo binds keys derived by SealTo to their use.
+const sealInfo = "yeet sealed value v1"
+
+// KeyPair opens values sealed to its public key with SealTo. Unlike a Box,
+// values can be sealed without access to the host, so clients can encrypt
+// values that only the host can read.
+type KeyPair struct {
+	priv *ecdh.PrivateKey
+}
+
+// OpenKeyPair returns the X25519 key pair stored at keyPath, creating a new
+// random one there if it does not exist yet.
+func OpenKeyPair(keyPath string) (*KeyPair, error) {
+	key, err := os.ReadFile(keyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, priv.Bytes(), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write key: %w", err)
+		}
+		return &KeyPair{priv: priv}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return &KeyPair{priv: priv}, nil
+}
+
+// PublicKey returns the base64 encoded public key to pass to SealTo.
+func (k *KeyPair) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.priv.PublicKey().Bytes())
+}
+
+// SealTo encrypts plaintext so that only the holder of the KeyPair with
+// the base64 encoded publicKey can read it. The result is prefixed with
+// SealedPrefix.
+func SealTo(publicKey string, plaintext []byte) (string, error) {
+	pb, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(pb)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	aead, err := sealAEAD(eph, pub, eph.PublicKey())
+	if err != nil {
+		return "", err
+	}
+	// The sealed value is the ephemeral public key, nonce and ciphertext.
+	out := eph.PublicKey().Bytes()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, plaintext, nil)
+	return SealedPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Open decrypts a value returned by SealTo for the public key of k.
+func (k *KeyPair) Open(sealed string) ([]byte, error) {
+	enc, ok := strings.CutPrefix(sealed, SealedPrefix)
+	if !ok {
+		return nil, errors.New("value is not sealed")
+	}
+	b, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, err
+	}
+	const keySize = 32
+	if len(b) < keySize {
+		return nil, errors.New("sealed value too short")
+	}
+	eph, err := ecdh.X25519().NewPublicKey(b[:keySize])
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed value: %w", err)
+	}
+	aead, err := sealAEAD(k.priv, eph, eph)
+	if err != nil {
+		return nil, err
+	}
+	b = b[keySize:]
+	ns := aead.NonceSize()
+	if len(b) < ns {
+		return nil, errors.New("sealed value too short")
+	}
+	pt, err := aead.Open(nil, b[:ns], b[ns:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return pt, nil
+}
+
+// sealAEAD returns the AES-256-GCM cipher keyed with the X25519 shared
+// secret of priv and peer. eph is the ephemeral public key of the value,
+// which is mixed into the key.
+func sealAEAD(priv *ecdh.PrivateKey, peer, eph *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Key(sha256.New, shared, eph.Bytes(), sealInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tamper returns the base64 encoded b with f applied to its decoded bytes.
+func tamper(t *testing.T, b string, f func([]byte) []byte) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(f(raw))
+}
+
+func flipLast(b []byte) []byte {
+	b[len(b)-1] ^= 1
+	return b
+}
+
+func TestBox(t *testing.T) {
+	dir := t.TempDir()
+	box, err := Open(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Open(filepath.Join(dir, "other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Opening the key again returns a Box with the same key.
+	again, err := Open(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("hunter2")
+	sealed, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		box     *Box
+		sealed  string
+		wantErr bool
+	}{
+		{name: "round-trip", box: box, sealed: sealed},
+		{name: "reopened-key", box: again, sealed: sealed},
+		{name: "wrong-key", box: other, sealed: sealed, wantErr: true},
+		{name: "tampered", box: box, sealed: tamper(t, sealed, flipLast), wantErr: true},
+		{name: "truncated", box: box, sealed: tamper(t, sealed, func(b []byte) []byte { return b[:len(b)-1] }), wantErr: true},
+		{name: "shorter-than-nonce", box: box, sealed: tamper(t, sealed, func(b []byte) []byte { return b[:4] }), wantErr: true},
+		{name: "empty", box: box, sealed: "", wantErr: true},
+		{name: "not-base64", box: box, sealed: "!!!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.box.Unseal(tt.sealed)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Unseal = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(plaintext) {
+				t.Errorf("Unseal = %q, want %q", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestSealTo(t *testing.T) {
+	dir := t.TempDir()
+	kp, err := OpenKeyPair(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := OpenKeyPair(filepath.Join(dir, "other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := OpenKeyPair(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.PublicKey() != kp.PublicKey() {
+		t.Fatalf("reopened key pair has public key %s, want %s", again.PublicKey(), kp.PublicKey())
+	}
+	plaintext := []byte("postgres://user:pass@db/prod")
+	sealed, err := SealTo(kp.PublicKey(), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, SealedPrefix) {
+		t.Fatalf("SealTo = %q, want prefix %q", sealed, SealedPrefix)
+	}
+	enc := strings.TrimPrefix(sealed, SealedPrefix)
+	mangle := func(f func([]byte) []byte) string {
+		return SealedPrefix + tamper(t, enc, f)
+	}
+
+	tests := []struct {
+		name    string
+		kp      *KeyPair
+		sealed  string
+		wantErr bool
+	}{
+		{name: "round-trip", kp: kp, sealed: sealed},
+		{name: "reopened-key", kp: again, sealed: sealed},
+		{name: "wrong-key", kp: other, sealed: sealed, wantErr: true},
+		{name: "tampered-ciphertext", kp: kp, sealed: mangle(flipLast), wantErr: true},
+		{name: "tampered-ephemeral-key", kp: kp, sealed: mangle(func(b []byte) []byte { b[0] ^= 1; return b }), wantErr: true},
+		{name: "truncated", kp: kp, sealed: mangle(func(b []byte) []byte { return b[:len(b)-1] }), wantErr: true},
+		{name: "shorter-than-key", kp: kp, sealed: mangle(func(b []byte) []byte { return b[:16] }), wantErr: true},
+		{name: "shorter-than-nonce", kp: kp, sealed: mangle(func(b []byte) []byte { return b[:40] }), wantErr: true},
+		{name: "no-prefix", kp: kp, sealed: enc, wantErr: true},
+		{name: "not-base64", kp: kp, sealed: SealedPrefix + "!!!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.kp.Open(tt.sealed)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Open = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(plaintext) {
+				t.Errorf("Open = %q, want %q", got, plaintext)
+			}
+		})
+	}
+
+	if _, err := SealTo("not a key", plaintext); err == nil {
+		t.Error("SealTo with an invalid public key succeeded")
+	}
+}
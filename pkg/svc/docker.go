@@ -15,6 +15,7 @@
 package svc
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -22,6 +23,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/yeetrun/yeet/pkg/db"
 	"github.com/yeetrun/yeet/pkg/fileutil"
@@ -43,7 +45,19 @@ type DockerComposeService struct {
 	NewCmd               func(name string, arg ...string) *exec.Cmd
 	Images               map[db.ImageRepoName]*db.ImageRepo
 	InternalRegistryAddr string
-	sd                   *SystemdService
+	// DockerConfig, if set, writes a docker config with the credentials
+	// for private registries and returns its directory, used as
+	// DOCKER_CONFIG for the compose commands that pull images, and a
+	// function that removes it again. The directory is empty if there are
+	// no credentials.
+	DockerConfig func() (dir string, cleanup func(), _ error)
+	// SecretEnv are NAME=value pairs added to the environment of compose
+	// commands, so that the compose file can pass them to containers.
+	SecretEnv []string
+	// CopyEnvFile, if set, installs the env file artifact from src to dst
+	// instead of copying it as is, e.g. to decrypt sealed values.
+	CopyEnvFile func(src, dst string) error
+	sd          *SystemdService
 
 	installEnvOnce lazy.SyncValue[error]
 }
@@ -73,7 +87,7 @@ func (s *DockerComposeService) command(args ...string) (*exec.Cmd, error) {
 	}
 	nargs := []string{
 		"compose",
-		"--project-name", s.projectName(s.Name),
+		"--project-name", s.projectName(),
 		"--project-directory", s.DataDir,
 	}
 	cf, ok := s.cfg.Artifacts.Gen(db.ArtifactDockerComposeFile, s.cfg.Generation)
@@ -86,10 +100,17 @@ func (s *DockerComposeService) command(args ...string) (*exec.Cmd, error) {
 	if cf, ok := s.cfg.Artifacts.Gen(db.ArtifactDockerComposeNetwork, s.cfg.Generation); ok {
 		nargs = append(nargs, "--file", cf)
 	}
+	if rf := s.resourcesFilePath(); fileExists(rf) {
+		nargs = append(nargs, "--file", rf)
+	}
 
 	if err := s.installEnvOnce.Get(func() error {
 		if ef, ok := s.cfg.Artifacts.Gen(db.ArtifactEnvFile, s.cfg.Generation); ok {
-			return fileutil.CopyFile(ef, filepath.Join(s.DataDir, ".env"))
+			copyFile := fileutil.CopyFile
+			if s.CopyEnvFile != nil {
+				copyFile = s.CopyEnvFile
+			}
+			return copyFile(ef, filepath.Join(s.DataDir, ".env"))
 		}
 		os.Remove(filepath.Join(s.DataDir, ".env"))
 		return nil
@@ -99,9 +120,38 @@ func (s *DockerComposeService) command(args ...string) (*exec.Cmd, error) {
 	args = append(nargs, args...)
 	c := s.NewCmd(dockerPath, args...)
 	c.Dir = s.DataDir
+	if len(s.SecretEnv) > 0 {
+		c.Env = append(os.Environ(), s.SecretEnv...)
+	}
 	return c, nil
 }
 
+// runPullCommand runs a compose command that may pull images, with the
+// registry credentials of DockerConfig, which only exist while it runs.
+func (s *DockerComposeService) runPullCommand(args ...string) error {
+	cmd, err := s.command(args...)
+	if err != nil {
+		return fmt.Errorf("failed to create docker-compose command: %v", err)
+	}
+	if s.DockerConfig != nil {
+		dir, cleanup, err := s.DockerConfig()
+		if err != nil {
+			return fmt.Errorf("failed to write registry credentials: %v", err)
+		}
+		defer cleanup()
+		if dir != "" {
+			if cmd.Env == nil {
+				cmd.Env = os.Environ()
+			}
+			cmd.Env = append(cmd.Env, "DOCKER_CONFIG="+dir)
+		}
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run docker command: %v", err)
+	}
+	return nil
+}
+
 func (s *DockerComposeService) runCommand(args ...string) error {
 	cmd, err := s.command(args...)
 	if err != nil {
@@ -131,11 +181,24 @@ func (s *DockerComposeService) Install() error {
 	if err := s.Down(); err != nil {
 		return fmt.Errorf("failed to stop service: %v", err)
 	}
+	if err := s.writeResourcesFile(); err != nil {
+		return fmt.Errorf("failed to write resource limits: %v", err)
+	}
+	s.sd.CopyEnvFile = s.CopyEnvFile
 	return s.sd.Install()
 }
 
+// Up pulls the images of the service and starts it.
 func (s *DockerComposeService) Up() error {
-	s.sd.Start()
+	if err := s.Pull(); err != nil {
+		return err
+	}
+	return s.UpPulled()
+}
+
+// Pull pulls the images of the service that were pushed to catch. Other
+// images are pulled by UpPulled as it starts the service.
+func (s *DockerComposeService) Pull() error {
 	// Ok so this is a bit of a hack. We want to use a nice looking image
 	// name catchit.dev/svc/img instead of a weirdo loopback
 	// 127.0.0.1:42353/svc/img address or with a random port. So to pull
@@ -145,9 +208,8 @@ func (s *DockerComposeService) Up() error {
 	// but it works for now. We likely want to replace docker with
 	// containerd but we need to figure out how to get the same compose
 	// functionality with containerd.
-	isInternal := false
-	for _, ref := range matchingRefs(s.Images, s.Name, "latest") {
-		isInternal = true
+	refs := matchingRefs(s.Images, s.Name, "latest")
+	for _, ref := range refs {
 		internalRef := fmt.Sprintf("%s/%s:latest", s.InternalRegistryAddr, ref)
 		canonicalRef := fmt.Sprintf("%s/%s:latest", InternalRegistryHost, ref)
 		if err := do(
@@ -159,12 +221,20 @@ func (s *DockerComposeService) Up() error {
 			return fmt.Errorf("failed to tag image: %v", err)
 		}
 	}
+	return nil
+}
+
+// UpPulled starts the service with the images pulled by Pull, pulling any
+// other image first.
+func (s *DockerComposeService) UpPulled() error {
+	s.sd.Start()
 	pull := "always"
-	if isInternal {
-		// Skip pulling from catchit.dev since it's a virtual registry that doesn't actually exist
+	if len(matchingRefs(s.Images, s.Name, "latest")) > 0 {
+		// Skip pulling from catchit.dev since it's a virtual registry that
+		// doesn't actually exist; Pull retagged its images.
 		pull = "never"
 	}
-	return s.runCommand("up", "--pull", pull, "-d")
+	return s.runPullCommand("up", "--pull", pull, "-d")
 }
 
 func (s *DockerComposeService) Remove() error {
@@ -223,6 +293,57 @@ func (s *DockerComposeService) Status() (Status, error) {
 	return StatusUnknown, fmt.Errorf("not implemented")
 }
 
+// RuntimeInfos returns the runtime info of each container in the project,
+// keyed by compose service name.
+func (s *DockerComposeService) RuntimeInfos() (map[string]RuntimeInfo, error) {
+	cmd, err := s.command("ps", "-a", "-q")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker-compose command: %v", err)
+	}
+	cmd.Stdout = nil
+	ob, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run docker command: %v (%s)", err, ob)
+	}
+	return inspectRuntimeInfos(strings.Fields(string(ob)))
+}
+
+// inspectRuntimeInfos returns the runtime info of the containers ids, keyed
+// by compose service name.
+func inspectRuntimeInfos(ids []string) (map[string]RuntimeInfo, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	dockerPath, err := DockerCmd()
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"inspect", "--format",
+		`{{index .Config.Labels "com.docker.compose.service"}},{{.State.Running}},{{.State.StartedAt}},{{.RestartCount}},{{.Image}},{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}},{{if .State.Health}}{{.State.Health.Status}}{{end}}`}, ids...)
+	ob, err := exec.Command(dockerPath, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run docker inspect: %v", err)
+	}
+	infos := make(map[string]RuntimeInfo)
+	for _, line := range strings.Split(strings.TrimSpace(string(ob)), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		if len(fields) != 7 {
+			log.Printf("unexpected docker inspect output: %s", line)
+			continue
+		}
+		var ri RuntimeInfo
+		ri.Restarts, _ = strconv.Atoi(fields[3])
+		ri.Image = fields[4]
+		ri.IPs = strings.Fields(fields[5])
+		ri.Health = fields[6]
+		if fields[1] == "true" {
+			ri.StartedAt, _ = time.Parse(time.RFC3339Nano, fields[2])
+		}
+		infos[fields[0]] = ri
+	}
+	return infos, nil
+}
+
 func (s *DockerComposeService) Statuses() (DockerComposeStatus, error) {
 	cmd, err := s.command("ps", "-a",
 		"--format", `{{.Label "com.docker.compose.service"}},{{.State}}`)
@@ -235,7 +356,12 @@ func (s *DockerComposeService) Statuses() (DockerComposeStatus, error) {
 		return nil, fmt.Errorf("failed to run docker command: %v (%s)", err, ob)
 	}
 
-	output := string(ob)
+	return parseComposeStatuses(string(ob))
+}
+
+// parseComposeStatuses parses the output of `ps --format
+// '{{.Label "com.docker.compose.service"}},{{.State}}'`.
+func parseComposeStatuses(output string) (DockerComposeStatus, error) {
 	if strings.TrimSpace(output) == "" {
 		return nil, ErrDockerStatusUnknown
 	}
@@ -265,21 +391,130 @@ func (s *DockerComposeService) Statuses() (DockerComposeStatus, error) {
 	return statuses, nil
 }
 
+// ProjectStatuses is like Statuses for the compose project of service sn,
+// but only lists its containers: it doesn't load the compose file, env or
+// registry credentials of the service.
+func ProjectStatuses(sn string) (DockerComposeStatus, error) {
+	ob, err := projectContainers(sn, "--format", `{{.Label "com.docker.compose.service"}},{{.State}}`)
+	if err != nil {
+		return nil, err
+	}
+	return parseComposeStatuses(string(ob))
+}
+
+// ProjectRuntimeInfos is like RuntimeInfos for the compose project of service
+// sn, without loading the service.
+func ProjectRuntimeInfos(sn string) (map[string]RuntimeInfo, error) {
+	ob, err := projectContainers(sn, "-q")
+	if err != nil {
+		return nil, err
+	}
+	return inspectRuntimeInfos(strings.Fields(string(ob)))
+}
+
+// ProjectLogsCmd is like LogsCmd for the compose project of service sn,
+// without loading the service.
+func ProjectLogsCmd(ctx context.Context, sn string, opts *LogOptions) (*exec.Cmd, error) {
+	dockerPath, err := DockerCmd()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"compose", "--project-name", fmt.Sprintf("%s-%s", dockerContainerNamePrefix, sn), "logs"}
+	return exec.CommandContext(ctx, dockerPath, append(args, opts.DockerArgs()...)...), nil
+}
+
+// projectContainers runs `docker ps -a` with args over the containers of the
+// compose project of service sn.
+func projectContainers(sn string, args ...string) ([]byte, error) {
+	dockerPath, err := DockerCmd()
+	if err != nil {
+		return nil, err
+	}
+	filter := fmt.Sprintf("label=com.docker.compose.project=%s-%s", dockerContainerNamePrefix, sn)
+	ob, err := exec.Command(dockerPath, append([]string{"ps", "-a", "--filter", filter}, args...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run docker ps: %v", err)
+	}
+	return ob, nil
+}
+
 func (s *DockerComposeService) Logs(opts *LogOptions) error {
 	if opts == nil {
 		opts = &LogOptions{}
 	}
-	args := []string{"logs"}
-	if opts.Follow {
-		args = append(args, "--follow")
+	cmd, err := s.LogsCmd(opts)
+	if err != nil {
+		return err
+	}
+	flush, err := FilterLogs(cmd, opts.Grep)
+	if err != nil {
+		return err
+	}
+	defer flush()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run docker command: %v", err)
 	}
-	if opts.Lines > 0 {
-		args = append(args, "--tail", strconv.Itoa(opts.Lines))
+	return nil
+}
+
+// ContainerPIDs returns the PIDs of the running containers of the project.
+func (s *DockerComposeService) ContainerPIDs() ([]int, error) {
+	cmd, err := s.command("ps", "-q")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker-compose command: %v", err)
+	}
+	cmd.Stdout = nil
+	ob, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run docker command: %v (%s)", err, ob)
+	}
+	ids := strings.Fields(string(ob))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	dockerPath, err := DockerCmd()
+	if err != nil {
+		return nil, err
+	}
+	ob, err = exec.Command(dockerPath, append([]string{"inspect", "--format", "{{.State.Pid}}"}, ids...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect containers: %v", err)
+	}
+	var pids []int
+	for _, f := range strings.Fields(string(ob)) {
+		if pid, err := strconv.Atoi(f); err == nil && pid > 0 {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// LogsCmd returns the `docker compose logs` command selecting the logs
+// described by opts. It ignores opts.Grep.
+func (s *DockerComposeService) LogsCmd(opts *LogOptions) (*exec.Cmd, error) {
+	cmd, err := s.command(append([]string{"logs"}, opts.DockerArgs()...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker-compose command: %v", err)
+	}
+	return cmd, nil
+}
+
+// ExecCmd returns a command that runs args in the running container of
+// compose service container. A pseudo-terminal is allocated if tty is set.
+func (s *DockerComposeService) ExecCmd(container string, tty bool, args ...string) (*exec.Cmd, error) {
+	eargs := []string{"exec"}
+	if !tty {
+		eargs = append(eargs, "-T")
+	}
+	eargs = append(eargs, container)
+	cmd, err := s.command(append(eargs, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker-compose command: %v", err)
 	}
-	return s.runCommand(args...)
+	return cmd, nil
 }
 
-// projectName returns the docker-compose project name for the given service name.
-func (s *DockerComposeService) projectName(sn string) string {
-	return fmt.Sprintf("%s-%s", dockerContainerNamePrefix, sn)
+// projectName returns the docker-compose project name of the service.
+func (s *DockerComposeService) projectName() string {
+	return fmt.Sprintf("%s-%s", dockerContainerNamePrefix, s.Name)
 }
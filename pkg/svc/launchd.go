@@ -0,0 +1,297 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+const launchdPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+{{range .Program}}		<string>{{xml .}}</string>
+{{end}}	</array>
+{{if .WorkingDirectory}}	<key>WorkingDirectory</key>
+	<string>{{xml .WorkingDirectory}}</string>
+{{end}}{{if .User}}	<key>UserName</key>
+	<string>{{xml .User}}</string>
+{{end}}{{if .Env}}	<key>EnvironmentVariables</key>
+	<dict>
+{{range .Env}}		<key>{{xml .Key}}</key>
+		<string>{{xml .Value}}</string>
+{{end}}	</dict>
+{{end}}	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	{{if .OneShot}}<false/>{{else}}<true/>{{end}}
+	<key>ThrottleInterval</key>
+	<integer>1</integer>
+	<key>StandardOutPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogPath}}</string>
+</dict>
+</plist>
+`
+
+var launchdPlistTmpl = template.Must(template.New("launchdPlist").Funcs(template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var b bytes.Buffer
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+}).Parse(launchdPlistTemplate))
+
+// LaunchdService is a service run by launchd on macOS, as a system daemon
+// defined by a property list generated from its service unit.
+type LaunchdService struct {
+	cfg    db.ServiceView
+	runDir string
+
+	// CopyEnvFile, if set, installs the env file artifact from src to dst
+	// instead of copying it as is, e.g. to decrypt sealed values.
+	CopyEnvFile func(src, dst string) error
+	// ReadEnvFile reads the KEY=value pairs of an env file. launchd has no
+	// env files, so the variables are written to the property list. If nil,
+	// the env file is ignored.
+	ReadEnvFile func(p string) ([]string, error)
+}
+
+// NewLaunchdService creates a new launchd service from its config.
+func NewLaunchdService(cfg db.ServiceView, runDir string) *LaunchdService {
+	return &LaunchdService{cfg: cfg, runDir: runDir}
+}
+
+func (s *LaunchdService) Name() string {
+	return s.cfg.Name()
+}
+
+// label is the launchd label of the service.
+func (s *LaunchdService) label() string {
+	return "dev.yeet." + s.Name()
+}
+
+// target is the launchctl service target of the service.
+func (s *LaunchdService) target() string {
+	return "system/" + s.label()
+}
+
+func (s *LaunchdService) plistPath() string {
+	return "/Library/LaunchDaemons/" + s.label() + ".plist"
+}
+
+// logPath is the file launchd writes the output of the service to.
+func (s *LaunchdService) logPath() string {
+	return filepath.Join(s.runDir, s.Name()+".log")
+}
+
+func (s *LaunchdService) run(args ...string) error {
+	cmd := exec.Command("launchctl", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run launchctl %s: %v\n%s", strings.Join(args, " "), err, string(out))
+	}
+	return nil
+}
+
+func (s *LaunchdService) isInstalled() bool {
+	return fileExists(s.plistPath())
+}
+
+// isLoaded reports whether the service is loaded into launchd.
+func (s *LaunchdService) isLoaded() bool {
+	return exec.Command("launchctl", "print", s.target()).Run() == nil
+}
+
+// Install installs the binary and env file of the service and writes its
+// property list. The service is loaded by Start.
+func (s *LaunchdService) Install() error {
+	u, err := nativeUnit(s.cfg, "launchd")
+	if err != nil {
+		return err
+	}
+	envFile := filepath.Join(s.runDir, "env")
+	if err := installNativeArtifacts(s.cfg, map[db.ArtifactName]string{
+		db.ArtifactBinary:  filepath.Join(s.runDir, s.Name()),
+		db.ArtifactEnvFile: envFile,
+	}, s.CopyEnvFile); err != nil {
+		return err
+	}
+	env, err := nativeEnv(u, envFile, s.ReadEnvFile)
+	if err != nil {
+		return err
+	}
+
+	type kv struct{ Key, Value string }
+	data := struct {
+		Label            string
+		Program          []string
+		WorkingDirectory string
+		User             string
+		Env              []kv
+		OneShot          bool
+		LogPath          string
+	}{
+		Label:            s.label(),
+		Program:          append([]string{u.Executable}, u.Arguments...),
+		WorkingDirectory: u.WorkingDirectory,
+		User:             u.User,
+		OneShot:          u.OneShot,
+		LogPath:          s.logPath(),
+	}
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		data.Env = append(data.Env, kv{k, v})
+	}
+	if u.WorkingDirectory != "" {
+		if err := os.MkdirAll(u.WorkingDirectory, 0755); err != nil {
+			return err
+		}
+	}
+	var b bytes.Buffer
+	if err := launchdPlistTmpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("failed to render property list: %v", err)
+	}
+	if err := os.WriteFile(s.plistPath(), b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write property list: %v", err)
+	}
+	if s.isLoaded() {
+		// Reload the service with the new property list.
+		if err := s.run("bootout", s.target()); err != nil {
+			return err
+		}
+		return s.run("bootstrap", "system", s.plistPath())
+	}
+	return nil
+}
+
+// Uninstall unloads the service and removes its property list.
+func (s *LaunchdService) Uninstall() error {
+	if s.isLoaded() {
+		if err := s.run("bootout", s.target()); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(s.plistPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Start loads the service, which starts it, or kicks it if it is loaded.
+func (s *LaunchdService) Start() error {
+	if !s.isLoaded() {
+		return s.run("bootstrap", "system", s.plistPath())
+	}
+	return s.run("kickstart", s.target())
+}
+
+// Stop unloads the service, as launchd restarts a loaded service that
+// exits.
+func (s *LaunchdService) Stop() error {
+	if !s.isLoaded() {
+		return nil
+	}
+	return s.run("bootout", s.target())
+}
+
+func (s *LaunchdService) Restart() error {
+	if !s.isLoaded() {
+		return s.Start()
+	}
+	return s.run("kickstart", "-k", s.target())
+}
+
+func (s *LaunchdService) Enable() error {
+	return s.run("enable", s.target())
+}
+
+func (s *LaunchdService) Disable() error {
+	if !s.isInstalled() {
+		return nil
+	}
+	return s.run("disable", s.target())
+}
+
+// print returns the properties of the loaded service reported by launchctl
+// print, or nil if it is not loaded.
+func (s *LaunchdService) print() map[string]string {
+	out, err := exec.Command("launchctl", "print", s.target()).Output()
+	if err != nil {
+		return nil
+	}
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), " = "); ok {
+			if _, seen := props[k]; !seen {
+				props[k] = v
+			}
+		}
+	}
+	return props
+}
+
+func (s *LaunchdService) Status() (Status, error) {
+	if !s.isInstalled() {
+		return StatusUnknown, nil
+	}
+	if props := s.print(); props != nil && props["state"] == "running" {
+		return StatusRunning, nil
+	}
+	return StatusStopped, nil
+}
+
+// RuntimeInfo returns how many times launchd has restarted the service.
+// launchd doesn't report when the service was started.
+func (s *LaunchdService) RuntimeInfo() (RuntimeInfo, error) {
+	var ri RuntimeInfo
+	props := s.print()
+	if runs, err := strconv.Atoi(props["runs"]); err == nil && runs > 0 {
+		ri.Restarts = runs - 1
+	}
+	return ri, nil
+}
+
+// LogCommand returns the command that prints the logs of the service
+// selected by opts. The log file has no timestamps, so opts.Since and
+// opts.Until are not supported.
+func (s *LaunchdService) LogCommand(opts *LogOptions) (string, []string, error) {
+	if !opts.Since.IsZero() || !opts.Until.IsZero() {
+		return "", nil, fmt.Errorf("--since and --until are not supported for launchd services")
+	}
+	lines := "+1"
+	if opts.Lines > 0 {
+		lines = strconv.Itoa(opts.Lines)
+	}
+	args := []string{"-n", lines}
+	if opts.Follow {
+		args = append(args, "-F")
+	}
+	return "tail", append(args, s.logPath()), nil
+}
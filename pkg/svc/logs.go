@@ -0,0 +1,126 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// JournalctlArgs returns the journalctl flags selecting the logs described
+// by o.
+func (o *LogOptions) JournalctlArgs() []string {
+	args := []string{"--no-pager", "--output=cat"}
+	if o.Follow {
+		args = append(args, "--follow")
+	}
+	if o.Lines > 0 {
+		args = append(args, "--lines="+strconv.Itoa(o.Lines))
+	}
+	if !o.Since.IsZero() {
+		args = append(args, fmt.Sprintf("--since=@%d", o.Since.Unix()))
+	}
+	if !o.Until.IsZero() {
+		args = append(args, fmt.Sprintf("--until=@%d", o.Until.Unix()))
+	}
+	if o.Grep != "" {
+		args = append(args, "--grep="+o.Grep)
+	}
+	return args
+}
+
+// DockerArgs returns the `docker logs` and `docker compose logs` flags
+// selecting the logs described by o. Docker has no equivalent of Grep; use
+// FilterLogs for that.
+func (o *LogOptions) DockerArgs() []string {
+	var args []string
+	if o.Follow {
+		args = append(args, "--follow")
+	}
+	if o.Lines > 0 {
+		args = append(args, "--tail="+strconv.Itoa(o.Lines))
+	}
+	if !o.Since.IsZero() {
+		args = append(args, "--since="+strconv.FormatInt(o.Since.Unix(), 10))
+	}
+	if !o.Until.IsZero() {
+		args = append(args, "--until="+strconv.FormatInt(o.Until.Unix(), 10))
+	}
+	if o.Timestamps {
+		args = append(args, "--timestamps")
+	}
+	return args
+}
+
+// FilterLogs makes c only output the lines matching the regular expression
+// grep. The returned function must be called after c exits to flush a final
+// line without a trailing newline.
+func FilterLogs(c *exec.Cmd, grep string) (flush func(), _ error) {
+	if grep == "" {
+		return func() {}, nil
+	}
+	re, err := regexp.Compile(grep)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grep pattern: %w", err)
+	}
+	stdout := &lineFilter{w: c.Stdout, re: re}
+	stderr := &lineFilter{w: c.Stderr, re: re}
+	c.Stdout, c.Stderr = stdout, stderr
+	return func() {
+		stdout.flush()
+		stderr.flush()
+	}, nil
+}
+
+// lineFilter is an io.Writer that writes only the lines matching re to w.
+type lineFilter struct {
+	w   io.Writer
+	re  *regexp.Regexp
+	buf []byte // incomplete last line
+}
+
+func (f *lineFilter) Write(p []byte) (int, error) {
+	f.buf = append(f.buf, p...)
+	for {
+		i := bytes.IndexByte(f.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := f.writeLine(f.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		f.buf = append(f.buf[:0], f.buf[i+1:]...)
+	}
+	return len(p), nil
+}
+
+func (f *lineFilter) writeLine(line []byte) error {
+	if f.w == nil || !f.re.Match(line) {
+		return nil
+	}
+	_, err := f.w.Write(line)
+	return err
+}
+
+func (f *lineFilter) flush() {
+	if len(f.buf) > 0 {
+		f.writeLine(f.buf)
+		f.buf = nil
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"github.com/yeetrun/yeet/pkg/fileutil"
+)
+
+// On macOS and Windows, services are run by launchd and the service control
+// manager instead of systemd. They are staged with the same artifacts as on
+// Linux: the service unit generated by catch describes how to run the binary
+// and is translated to the configuration of the native service manager.
+
+// systemdOnlyArtifacts are the artifacts of features only systemd services
+// have.
+var systemdOnlyArtifacts = map[db.ArtifactName]string{
+	db.ArtifactSystemdTimerFile: "cron timers",
+	db.ArtifactNetNSService:     "network namespaces (--net)",
+	db.ArtifactTSService:        "tailscale sidecars (--net=ts)",
+	db.ArtifactQuadletContainer: "quadlet containers",
+	db.ArtifactTypeScriptFile:   "TypeScript services",
+}
+
+// nativeUnit returns the service unit of the installed generation of cfg,
+// which is run by the native service manager named manager. It fails if the
+// service uses features only systemd supports.
+func nativeUnit(cfg db.ServiceView, manager string) (*SystemdUnit, error) {
+	af := cfg.AsStruct().Artifacts
+	for a, feature := range systemdOnlyArtifacts {
+		if _, ok := af.Gen(a, cfg.Generation()); ok {
+			return nil, fmt.Errorf("%s are not supported with %s", feature, manager)
+		}
+	}
+	p, ok := af.Gen(db.ArtifactSystemdUnit, cfg.Generation())
+	if !ok {
+		return nil, fmt.Errorf("service has no unit to install")
+	}
+	u, err := ParseSystemdUnit(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service unit: %v", err)
+	}
+	if u.RootDirectory != "" {
+		return nil, fmt.Errorf("root filesystem images are not supported with %s", manager)
+	}
+	return u, nil
+}
+
+// installNativeArtifacts copies the binary and env file of the installed
+// generation of cfg to their paths in dsts, removing those it doesn't have.
+// copyEnvFile, if set, installs the env file instead of copying it.
+func installNativeArtifacts(cfg db.ServiceView, dsts map[db.ArtifactName]string, copyEnvFile func(src, dst string) error) error {
+	af := cfg.AsStruct().Artifacts
+	for _, k := range []db.ArtifactName{db.ArtifactBinary, db.ArtifactEnvFile} {
+		dst := dsts[k]
+		src, ok := af.Gen(k, cfg.Generation())
+		if !ok {
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove optional artifact %s: %v", dst, err)
+			}
+			continue
+		}
+		log.Printf("copying %s to %s", src, dst)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		copyFile := fileutil.CopyFile
+		if k == db.ArtifactEnvFile && copyEnvFile != nil {
+			copyFile = copyEnvFile
+		}
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nativeEnv returns the environment of unit u: the variables of the env file
+// at envFile, read with readEnvFile, followed by those of the unit.
+func nativeEnv(u *SystemdUnit, envFile string, readEnvFile func(string) ([]string, error)) ([]string, error) {
+	var env []string
+	if readEnvFile != nil && fileExists(envFile) {
+		var err error
+		if env, err = readEnvFile(envFile); err != nil {
+			return nil, err
+		}
+	}
+	return append(env, u.Environment...), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// needsUnit returns the unit that orders the service after the ones it
+// needs: the service unit of systemd services, and for docker compose
+// services the unit that wraps their containers in a network namespace, if
+// they have one. It returns "" if the service has no such unit.
+func (s *SystemdService) needsUnit() string {
+	switch s.cfg.ServiceType() {
+	case db.ServiceTypeSystemd:
+		return s.serviceUnit()
+	case db.ServiceTypeDockerCompose:
+		if _, ok := s.cfg.AsStruct().Artifacts.Gen(db.ArtifactNetNSService, s.cfg.Generation()); ok {
+			return s.netnsServiceUnit()
+		}
+	}
+	return ""
+}
+
+// needsPath returns the path of the drop-in ordering unit after the units of
+// the services it needs.
+func needsPath(unit string) string {
+	return "/etc/systemd/system/" + unit + ".d/yeet-needs.conf"
+}
+
+// installNeeds writes the drop-in that makes the needsUnit of the service
+// require and start after the units of the services declared with --needs,
+// or removes it if there are none. Needed services that were removed since
+// are skipped. The caller must reload systemd.
+func (s *SystemdService) installNeeds() error {
+	unit := s.needsUnit()
+	var units []string
+	if unit != "" {
+		for _, d := range s.cfg.Dependencies().All() {
+			if d.Kind != db.DependencyNeeds {
+				continue
+			}
+			u, err := s.neededUnit(d.Service)
+			if err != nil {
+				return err
+			}
+			if u == "" {
+				log.Printf("needed service %q not found, not ordering %s after it", d.Service, unit)
+				continue
+			}
+			if !slices.Contains(units, u) {
+				units = append(units, u)
+			}
+		}
+	}
+	// Remove the drop-ins of the other units, which the service may have
+	// used before.
+	for _, u := range []string{s.serviceUnit(), s.netnsServiceUnit()} {
+		if u == unit && len(units) > 0 {
+			continue
+		}
+		if err := os.Remove(needsPath(u)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	conf := fmt.Sprintf("# Generated by catch from the service config, do not edit.\n[Unit]\nAfter=%[1]s\nRequires=%[1]s\n", strings.Join(units, " "))
+	if err := os.MkdirAll(filepath.Dir(needsPath(unit)), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(needsPath(unit), []byte(conf), 0644)
+}
+
+// UpdateNeeds rewrites the drop-in of installNeeds and reloads systemd, for
+// when a service it needs was removed.
+func (s *SystemdService) UpdateNeeds() error {
+	if err := s.installNeeds(); err != nil {
+		return err
+	}
+	return s.run("daemon-reload")
+}
+
+// neededUnit returns the unit that the service sn runs as, or "" if there is
+// no service sn. Docker compose services without a unit of their own are
+// represented by docker.
+func (s *SystemdService) neededUnit(sn string) (string, error) {
+	dv, err := s.db.Get()
+	if err != nil {
+		return "", err
+	}
+	sv, ok := dv.Services().GetOk(sn)
+	if !ok {
+		return "", nil
+	}
+	if sv.ServiceType() == db.ServiceTypeDockerCompose {
+		if _, ok := sv.AsStruct().Artifacts.Gen(db.ArtifactNetNSService, sv.Generation()); ok {
+			return netnsServiceUnit(sn), nil
+		}
+		return "docker.service", nil
+	}
+	return sn + ".service", nil
+}
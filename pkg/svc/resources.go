@@ -0,0 +1,139 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/db"
+	"gopkg.in/yaml.v3"
+)
+
+// Resource limits of a service are applied as a drop-in for systemd
+// services. For docker compose services they are set on a slice, which an
+// extra compose file makes the cgroup parent of every container of the
+// project, so that they limit the project as a whole rather than each
+// container. Both are written on install from db.Service.Resources, so they
+// follow the config rather than the generation.
+
+// resourcesPath returns the path of the drop-in holding the resource limits
+// of the service unit.
+func (s *SystemdService) resourcesPath() string {
+	return "/etc/systemd/system/" + s.serviceUnit() + ".d/yeet-resources.conf"
+}
+
+// resourcesSlice returns the name of the slice holding the containers of a
+// docker compose service.
+func (s *SystemdService) resourcesSlice() string {
+	// Dashes separate the levels of slices, so escape those of the name as
+	// systemd-escape would.
+	return "yeet-" + strings.ReplaceAll(s.Name(), "-", `\x2d`) + ".slice"
+}
+
+// resourcesSlicePath returns the path of the unit of resourcesSlice.
+func (s *SystemdService) resourcesSlicePath() string {
+	return "/etc/systemd/system/" + s.resourcesSlice()
+}
+
+// installResources writes the drop-in or slice with the resource limits of
+// the service, and removes the other, or both if the service has none. The
+// caller must reload systemd.
+func (s *SystemdService) installResources() error {
+	rl := s.cfg.Resources()
+	var path, section string
+	if !rl.IsZero() {
+		switch s.cfg.ServiceType() {
+		case db.ServiceTypeSystemd:
+			path, section = s.resourcesPath(), "Service"
+		case db.ServiceTypeDockerCompose:
+			path, section = s.resourcesSlicePath(), "Slice"
+		}
+	}
+	for _, p := range []string{s.resourcesPath(), s.resourcesSlicePath()} {
+		if p == path {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if path == "" {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by catch from the service config, do not edit.\n[%s]\n", section)
+	if rl.CPU > 0 {
+		fmt.Fprintf(&b, "CPUQuota=%s%%\n", strconv.FormatFloat(rl.CPU*100, 'f', -1, 64))
+	}
+	if rl.Memory > 0 {
+		fmt.Fprintf(&b, "MemoryMax=%d\n", rl.Memory)
+	}
+	if rl.IOWeight > 0 {
+		fmt.Fprintf(&b, "IOWeight=%d\n", rl.IOWeight)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// resourcesFilePath returns the path of the compose file placing the
+// containers of the service in its resource slice.
+func (s *DockerComposeService) resourcesFilePath() string {
+	return filepath.Join(s.sd.runDir, "compose.resources.yml")
+}
+
+// writeResourcesFile writes the compose file that makes the resource slice
+// of the service the cgroup parent of every service of its compose file, or
+// removes it if the service has no limits.
+func (s *DockerComposeService) writeResourcesFile() error {
+	rl := s.cfg.Resources
+	if rl.IsZero() {
+		if err := os.Remove(s.resourcesFilePath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	cf, ok := s.cfg.Artifacts.Gen(db.ArtifactDockerComposeFile, s.cfg.Generation)
+	if !ok {
+		return fmt.Errorf("compose file not found")
+	}
+	b, err := os.ReadFile(cf)
+	if err != nil {
+		return err
+	}
+	var project struct {
+		Services map[string]any `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(b, &project); err != nil {
+		return fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	services := map[string]any{}
+	for name := range project.Services {
+		services[name] = map[string]any{"cgroup_parent": s.sd.resourcesSlice()}
+	}
+	out, err := yaml.Marshal(map[string]any{"services": services})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.resourcesFilePath()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.resourcesFilePath(), out, 0644)
+}
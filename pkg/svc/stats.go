@@ -0,0 +1,190 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// Usage is the resource usage of a service or container.
+type Usage struct {
+	// CPUTime is the CPU time used since the unit started. It is only set
+	// for systemd services, whose CPU usage is computed from two samples.
+	CPUTime time.Duration
+	// CPUPercent is the CPU usage in percent of one core. It is only set for
+	// containers.
+	CPUPercent float64
+	// MemoryBytes is the memory currently used.
+	MemoryBytes uint64
+	// NetRxBytes and NetTxBytes are the bytes received and sent on the
+	// network namespace of the service. They are zero for services that use
+	// the host network.
+	NetRxBytes uint64
+	NetTxBytes uint64
+}
+
+// Usage returns the resource usage of the service unit from its cgroup
+// accounting.
+func (s *SystemdService) Usage() (Usage, error) {
+	var u Usage
+	out, err := exec.Command("systemctl", "show",
+		"--property=CPUUsageNSec,MemoryCurrent,MainPID", s.serviceUnit()).Output()
+	if err != nil {
+		return u, fmt.Errorf("failed to run systemctl show: %v", err)
+	}
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = v
+		}
+	}
+	// Unset values are reported as "[not set]" or the max uint64.
+	if ns, err := strconv.ParseUint(props["CPUUsageNSec"], 10, 64); err == nil && ns != ^uint64(0) {
+		u.CPUTime = time.Duration(ns)
+	}
+	if m, err := strconv.ParseUint(props["MemoryCurrent"], 10, 64); err == nil && m != ^uint64(0) {
+		u.MemoryBytes = m
+	}
+	if s.hasArtifact(db.ArtifactNetNSService) {
+		if pid, err := strconv.Atoi(props["MainPID"]); err == nil && pid > 0 {
+			u.NetRxBytes, u.NetTxBytes, _ = netDevBytes(pid)
+		}
+	}
+	return u, nil
+}
+
+// Usage returns the resource usage of each container of the service as
+// reported by docker stats, keyed by compose service name.
+func (s *DockerComposeService) Usage() (map[string]Usage, error) {
+	cmd, err := s.command("ps", "--format", `{{.ID}},{{.Service}}`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker-compose command: %v", err)
+	}
+	cmd.Stdout = nil
+	ob, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run docker compose ps: %v", err)
+	}
+	services := make(map[string]string) // container ID -> compose service
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(string(ob)), "\n") {
+		id, svc, ok := strings.Cut(strings.TrimSpace(line), ",")
+		if !ok {
+			continue
+		}
+		services[id] = svc
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	dockerPath, err := DockerCmd()
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"stats", "--no-stream", "--format", `{{.ID}},{{.CPUPerc}},{{.MemUsage}},{{.NetIO}}`}, ids...)
+	ob, err = exec.Command(dockerPath, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run docker stats: %v", err)
+	}
+	usages := make(map[string]Usage)
+	for _, line := range strings.Split(strings.TrimSpace(string(ob)), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		if len(fields) != 4 {
+			continue
+		}
+		var svc string
+		for id, sn := range services {
+			// docker stats reports short IDs.
+			if strings.HasPrefix(id, fields[0]) || strings.HasPrefix(fields[0], id) {
+				svc = sn
+				break
+			}
+		}
+		if svc == "" {
+			continue
+		}
+		var u Usage
+		u.CPUPercent, _ = strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+		mem, _, _ := strings.Cut(fields[2], "/")
+		u.MemoryBytes = parseDockerSize(mem)
+		rx, tx, _ := strings.Cut(fields[3], "/")
+		u.NetRxBytes, u.NetTxBytes = parseDockerSize(rx), parseDockerSize(tx)
+		usages[svc] = u
+	}
+	return usages, nil
+}
+
+// dockerSizeUnits are the unit suffixes docker stats uses, longest first so
+// that "MiB" is matched before "B".
+var dockerSizeUnits = []struct {
+	suffix string
+	mult   float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// parseDockerSize parses a size like "12.5MiB" or "648B" as printed by
+// docker stats. It returns 0 for sizes it can't parse.
+func parseDockerSize(v string) uint64 {
+	v = strings.TrimSpace(v)
+	for _, u := range dockerSizeUnits {
+		if n, ok := strings.CutSuffix(v, u.suffix); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil {
+				return 0
+			}
+			return uint64(f * u.mult)
+		}
+	}
+	return 0
+}
+
+// netDevBytes returns the bytes received and sent on all interfaces but
+// loopback of the network namespace of process pid.
+func netDevBytes(pid int) (rx, tx uint64, _ error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		iface, counters, ok := strings.Cut(sc.Text(), ":")
+		if !ok || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		// Receive bytes are the first field and transmit bytes the ninth.
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx, sc.Err()
+}
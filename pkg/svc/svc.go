@@ -16,6 +16,7 @@ package svc
 
 import (
 	"errors"
+	"time"
 
 	"github.com/yeetrun/yeet/pkg/cmdutil"
 	"github.com/yeetrun/yeet/pkg/db"
@@ -28,6 +29,36 @@ var (
 type LogOptions struct {
 	Follow bool
 	Lines  int
+
+	// Since and Until, if non-zero, limit the logs to entries in that
+	// window.
+	Since time.Time
+	Until time.Time
+
+	// Grep, if set, is a regular expression that log lines must match.
+	Grep string
+
+	// Timestamps prefixes docker log lines with their RFC 3339 timestamp.
+	Timestamps bool
+}
+
+// RuntimeInfo describes the current run of a service or container.
+type RuntimeInfo struct {
+	// StartedAt is when the service was last started. It is zero if the
+	// service is not running.
+	StartedAt time.Time
+	// Restarts is the number of times the service has been restarted
+	// automatically.
+	Restarts int
+	// Image is the ID of the image of a container. It is empty for systemd
+	// services.
+	Image string
+	// IPs are the addresses of a container on its docker networks.
+	IPs []string
+	// Health is the result of the docker healthcheck of a container:
+	// "starting", "healthy" or "unhealthy". It is empty if the container has
+	// no healthcheck.
+	Health string
 }
 
 // NewSystemdService creates a new systemd service from a SystemdConfigView.
@@ -22,6 +22,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -51,13 +52,16 @@ type TimerConfig struct {
 
 const (
 	systemdServiceTemplate = `[Unit]
-ConditionFileIsExecutable={{.Executable}}
+{{if not .RootDirectory}}ConditionFileIsExecutable={{.Executable}}{{end}}
 {{if .Requires}}Requires={{.Requires}}{{end}}
 {{if .Requires}}After={{.Requires}}{{end}}
 
 [Service]
-ExecStart={{.Executable}}{{range .Arguments}} {{.}}{{end}}
+ExecStart={{.Executable}}{{range .Arguments}} {{systemdArg .}}{{end}}
 {{if or .OneShot .Timer}}Type=oneshot{{end}}
+{{if .WatchdogSec}}Type=notify
+NotifyAccess=main
+WatchdogSec={{.WatchdogSec}}{{end}}
 {{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory}}{{end}}
 {{if .Restart}}Restart={{.Restart}}{{end}}
 RestartSec=1
@@ -71,6 +75,17 @@ RestartMaxDelaySec=60
 {{if .ResolvConf}}
 BindPaths={{.ResolvConf}}:/etc/resolv.conf
 PrivateMounts=yes
+{{end}}{{if .RootDirectory}}
+RootDirectory={{.RootDirectory}}
+MountAPIVFS=yes
+{{if not .ResolvConf}}BindReadOnlyPaths=/etc/resolv.conf{{end}}
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectControlGroups=yes
+{{end}}{{range .BindPaths}}BindPaths={{.}}
+{{end}}{{range .Environment}}Environment={{systemdQuote .}}
 {{end}}
 [Install]
 WantedBy=multi-user.target
@@ -87,10 +102,111 @@ WantedBy=timers.target
 )
 
 var (
-	systemdServiceTmpl = template.Must(template.New("systemdService").Parse(systemdServiceTemplate))
+	systemdServiceTmpl = template.Must(template.New("systemdService").Funcs(template.FuncMap{
+		"systemdQuote": systemdQuote,
+		"systemdArg":   systemdArg,
+	}).Parse(systemdServiceTemplate))
 	systemdTimerTmpl   = template.Must(template.New("systemdTimer").Parse(systemdTimerTemplate))
 )
 
+// systemdQuote returns s as a double quoted systemd value, with the
+// characters systemd would interpret escaped, so that values such as the
+// environment of an image can't break out of their directive.
+func systemdQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '%':
+			b.WriteString("%%")
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// systemdArg returns s as an ExecStart argument: as is if it is a single
+// word without special characters, quoted with systemdQuote otherwise.
+func systemdArg(s string) string {
+	if s != "" && !strings.ContainsFunc(s, func(r rune) bool {
+		return r <= ' ' || r == 0x7f || r == '"' || r == '\'' || r == '\\'
+	}) {
+		return s
+	}
+	return systemdQuote(s)
+}
+
+// systemdUnquote splits the value of a directive into its words, undoing
+// systemdQuote.
+func systemdUnquote(v string) ([]string, error) {
+	var words []string
+	for i := 0; i < len(v); {
+		if v[i] == ' ' || v[i] == '\t' {
+			i++
+			continue
+		}
+		if v[i] != '"' {
+			j := i
+			for j < len(v) && v[j] != ' ' && v[j] != '\t' {
+				j++
+			}
+			words = append(words, v[i:j])
+			i = j
+			continue
+		}
+		var b strings.Builder
+		i++
+		for {
+			if i >= len(v) {
+				return nil, fmt.Errorf("unterminated quote in %q", v)
+			}
+			c := v[i]
+			if c == '"' {
+				i++
+				break
+			}
+			switch {
+			case c == '%' && i+1 < len(v) && v[i+1] == '%':
+				b.WriteByte('%')
+				i += 2
+			case c == '\\' && i+1 < len(v):
+				switch e := v[i+1]; e {
+				case 'n':
+					b.WriteByte('\n')
+					i += 2
+				case 'x':
+					if i+4 > len(v) {
+						return nil, fmt.Errorf("invalid escape in %q", v)
+					}
+					n, err := strconv.ParseUint(v[i+2:i+4], 16, 8)
+					if err != nil {
+						return nil, fmt.Errorf("invalid escape in %q", v)
+					}
+					b.WriteByte(byte(n))
+					i += 4
+				default:
+					b.WriteByte(e)
+					i += 2
+				}
+			default:
+				b.WriteByte(c)
+				i++
+			}
+		}
+		words = append(words, b.String())
+	}
+	return words, nil
+}
+
 type SystemdUnit struct {
 	Name string // Required name of the service. No spaces suggested.
 
@@ -130,6 +246,21 @@ type SystemdUnit struct {
 
 	// ResolvConf is the path to the resolv.conf file to use.
 	ResolvConf string
+
+	// RootDirectory, if set, runs the service chrooted into this directory
+	// with its own mount namespace. Executable is resolved inside it.
+	RootDirectory string
+
+	// BindPaths are extra bind mounts in systemd's "src:dst" format.
+	BindPaths []string
+
+	// Environment are extra "KEY=value" environment variables.
+	Environment []string
+
+	// WatchdogSec, if non-zero, makes the service a Type=notify service
+	// which is restarted if it fails to send a watchdog keep-alive via
+	// sd_notify within this many seconds.
+	WatchdogSec int
 }
 
 func (u *SystemdUnit) serviceUnit() string {
@@ -171,6 +302,9 @@ func (u *SystemdUnit) writeOutService(path string) error {
 		return err
 	}
 	defer f.Close()
+	if _, err := f.WriteString(templateHeader()); err != nil {
+		return err
+	}
 	return systemdServiceTmpl.Execute(f, struct {
 		*SystemdUnit
 		Restart string
@@ -186,6 +320,9 @@ func (u *SystemdUnit) writeOutTimer(path string) error {
 		return err
 	}
 	defer f.Close()
+	if _, err := f.WriteString(templateHeader()); err != nil {
+		return err
+	}
 	return systemdTimerTmpl.Execute(f, u.Timer)
 }
 
@@ -193,6 +330,10 @@ type SystemdService struct {
 	db     *db.Store
 	cfg    db.ServiceView
 	runDir string
+
+	// CopyEnvFile, if set, installs the env file artifact from src to dst
+	// instead of copying it as is, e.g. to decrypt sealed values.
+	CopyEnvFile func(src, dst string) error
 }
 
 func (s *SystemdService) Name() string {
@@ -217,6 +358,9 @@ type artifactInstall struct {
 func (s *SystemdService) artifactInstaller() map[db.ArtifactName]artifactInstall {
 	return map[db.ArtifactName]artifactInstall{
 		db.ArtifactSystemdUnit:      {dstPath: s.servicePath(), unit: s.serviceUnit()},
+		db.ArtifactSystemdOverride:  {dstPath: s.overridePath()},
+		db.ArtifactQuadletContainer: {dstPath: s.quadletPath(".container")},
+		db.ArtifactQuadletNetwork:   {dstPath: s.quadletPath(".network")},
 		db.ArtifactSystemdTimerFile: {dstPath: s.timerPath(), unit: s.timerUnit(), primaryUnitIfAvailable: true},
 
 		db.ArtifactNetNSService: {dstPath: s.netnsServicePath(), unit: s.netnsServiceUnit()},
@@ -240,6 +384,9 @@ func (s *SystemdService) Install() error {
 	unitsToEnable := []string{}
 	for _, k := range []db.ArtifactName{
 		db.ArtifactSystemdUnit,
+		db.ArtifactSystemdOverride,
+		db.ArtifactQuadletContainer,
+		db.ArtifactQuadletNetwork,
 		db.ArtifactSystemdTimerFile,
 		db.ArtifactNetNSService,
 		db.ArtifactNetNSEnv,
@@ -263,7 +410,14 @@ func (s *SystemdService) Install() error {
 			continue
 		}
 		log.Printf("copying %s to %s", srcPath, dst.dstPath)
-		if err := fileutil.CopyFile(srcPath, dst.dstPath); err != nil {
+		if err := os.MkdirAll(filepath.Dir(dst.dstPath), 0755); err != nil {
+			return err
+		}
+		copyFile := fileutil.CopyFile
+		if k == db.ArtifactEnvFile && s.CopyEnvFile != nil {
+			copyFile = s.CopyEnvFile
+		}
+		if err := copyFile(srcPath, dst.dstPath); err != nil {
 			return err
 		}
 		if dst.unit != "" {
@@ -276,6 +430,13 @@ func (s *SystemdService) Install() error {
 		}
 	}
 
+	if err := s.installResources(); err != nil {
+		return fmt.Errorf("failed to install resource limits: %v", err)
+	}
+	if err := s.installNeeds(); err != nil {
+		return fmt.Errorf("failed to install service ordering: %v", err)
+	}
+
 	if err := s.run("daemon-reload"); err != nil {
 		return fmt.Errorf("failed to reload systemd: %v", err)
 	}
@@ -297,7 +458,13 @@ func (s *SystemdService) timerUnit() string {
 }
 
 func (s *SystemdService) netnsServiceUnit() string {
-	return "yeet-" + s.Name() + "-ns.service"
+	return netnsServiceUnit(s.Name())
+}
+
+// netnsServiceUnit returns the unit that sets up the network namespace of
+// service sn.
+func netnsServiceUnit(sn string) string {
+	return "yeet-" + sn + "-ns.service"
 }
 
 func (s *SystemdService) tailscaledServiceUnit() string {
@@ -308,6 +475,19 @@ func (s *SystemdService) servicePath() string {
 	return "/etc/systemd/system/" + s.serviceUnit()
 }
 
+// quadletPath returns the path of the quadlet file with the given extension.
+// The quadlet generator turns these into <name>.service on daemon-reload; the
+// generated unit can't be enabled and is started via its [Install] section.
+func (s *SystemdService) quadletPath(ext string) string {
+	return "/etc/containers/systemd/" + s.Name() + ext
+}
+
+// overridePath returns the path of the drop-in holding user edits to the
+// service unit.
+func (s *SystemdService) overridePath() string {
+	return "/etc/systemd/system/" + s.serviceUnit() + ".d/yeet-override.conf"
+}
+
 func (s *SystemdService) tailscaledServicePath() string {
 	return "/etc/systemd/system/" + s.tailscaledServiceUnit()
 }
@@ -324,7 +504,7 @@ func (s *SystemdService) isInstalled() bool {
 	if s.isTimer() && !fileExists(s.timerPath()) {
 		return false
 	}
-	return fileExists(s.servicePath())
+	return fileExists(s.servicePath()) || fileExists(s.quadletPath(".container"))
 }
 
 func fileExists(path string) bool {
@@ -345,7 +525,20 @@ func (s *SystemdService) primaryUnit() string {
 }
 
 func (s *SystemdService) Uninstall() error {
-	if s.isInstalled() {
+	if fileExists(s.quadletPath(".container")) {
+		if err := s.run("stop", s.serviceUnit()); err != nil {
+			return err
+		}
+		for _, ext := range []string{".container", ".network"} {
+			if err := os.Remove(s.quadletPath(ext)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		// Drop the units generated from them right away.
+		if err := s.run("daemon-reload"); err != nil {
+			return err
+		}
+	} else if s.isInstalled() {
 		if err := s.run("disable", "--now", s.primaryUnit()); err != nil {
 			return err
 		}
@@ -355,6 +548,15 @@ func (s *SystemdService) Uninstall() error {
 		if err := os.Remove(s.servicePath()); err != nil && !os.IsNotExist(err) {
 			return err
 		}
+		if err := os.RemoveAll(filepath.Dir(s.overridePath())); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(s.resourcesSlicePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(needsPath(s.netnsServiceUnit())); err != nil && !os.IsNotExist(err) {
+		return err
 	}
 	s.run("disable", "--now", s.netnsServiceUnit())
 	if err := os.Remove(s.netnsServicePath()); err != nil && !os.IsNotExist(err) {
@@ -377,6 +579,30 @@ func (s *SystemdService) Status() (Status, error) {
 	return StatusRunning, nil
 }
 
+// RuntimeInfo returns when the service was last started and how many times
+// systemd has restarted it.
+func (s *SystemdService) RuntimeInfo() (RuntimeInfo, error) {
+	var ri RuntimeInfo
+	out, err := exec.Command("systemctl", "show", "--timestamp=unix",
+		"--property=ActiveState,ActiveEnterTimestamp,NRestarts", s.serviceUnit()).Output()
+	if err != nil {
+		return ri, fmt.Errorf("failed to run systemctl show: %v", err)
+	}
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = v
+		}
+	}
+	ri.Restarts, _ = strconv.Atoi(props["NRestarts"])
+	if props["ActiveState"] == "active" {
+		if sec, err := strconv.ParseInt(strings.TrimPrefix(props["ActiveEnterTimestamp"], "@"), 10, 64); err == nil {
+			ri.StartedAt = time.Unix(sec, 0)
+		}
+	}
+	return ri, nil
+}
+
 func (s *SystemdService) isActive(unit string) bool {
 	if err := s.run("is-active", unit); err != nil {
 		return false
@@ -0,0 +1,118 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"A=b", `"A=b"`},
+		{`A="b"`, `"A=\"b\""`},
+		{`A=c:\d`, `"A=c:\\d"`},
+		{"A=100%", `"A=100%%"`},
+		{"A=b\nExecStartPre=/bin/evil", `"A=b\nExecStartPre=/bin/evil"`},
+		{"A=\x01", `"A=\x01"`},
+	}
+	for _, tt := range tests {
+		got := systemdQuote(tt.in)
+		if got != tt.want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		back, err := systemdUnquote(got)
+		if err != nil || !reflect.DeepEqual(back, []string{tt.in}) {
+			t.Errorf("systemdUnquote(%s) = %q, %v", got, back, err)
+		}
+	}
+}
+
+func TestSystemdUnquoteArgs(t *testing.T) {
+	args := []string{"--port=80", "hello world", "", "a\"b", "--x=%h"}
+	line := "/bin/app"
+	for _, a := range args {
+		line += " " + systemdArg(a)
+	}
+	got, err := systemdUnquote(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]string{"/bin/app"}, args...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("systemdUnquote(%s) = %q, want %q", line, got, want)
+	}
+}
+
+func TestUnitRootDirectory(t *testing.T) {
+	tests := []struct {
+		unit, want string
+	}{
+		{"[Service]\nRootDirectory=/srv/a/rootfs/1\n", "/srv/a/rootfs/1"},
+		{"[Service]\nRootDirectory = /srv/a/rootfs/1/ \r\n", "/srv/a/rootfs/1"},
+		{"[Service]\nRootDirectory=/srv/a/rootfs/1", "/srv/a/rootfs/1"},
+		{"[Service]\n# RootDirectory=/srv/a/rootfs/1\n", ""},
+		{"[Service]\nExecStart=/bin/app\n", ""},
+	}
+	for _, tt := range tests {
+		p := filepath.Join(t.TempDir(), "a.service")
+		if err := os.WriteFile(p, []byte(tt.unit), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := UnitRootDirectory(p)
+		if err != nil || got != tt.want {
+			t.Errorf("UnitRootDirectory(%q) = %q, %v; want %q", tt.unit, got, err, tt.want)
+		}
+	}
+}
+
+func TestRunProperties(t *testing.T) {
+	dir := t.TempDir()
+	unit := filepath.Join(dir, "a.service")
+	override := filepath.Join(dir, "override.conf")
+	if err := os.WriteFile(unit, []byte(`[Unit]
+After=network.target
+
+[Service]
+ExecStart=/srv/a/bin/a
+User=a
+EnvironmentFile=/srv/a/env
+NetworkNamespacePath=/var/run/netns/yeet-a-ns
+Restart=always
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte("[Service]\nEnvironment=FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := RunProperties(unit, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-p", "User=a",
+		"-p", "EnvironmentFile=/srv/a/env",
+		"-p", "NetworkNamespacePath=/var/run/netns/yeet-a-ns",
+		"-p", "Environment=FOO=bar",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("RunProperties = %q, want %q", got, want)
+	}
+}
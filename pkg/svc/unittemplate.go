@@ -0,0 +1,315 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yeetrun/yeet/pkg/fileutil"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateVersion is the version of the templates of the unit and compose
+// network files generated for services. Bump it when a template changes so
+// that `sys migrate-units` re-renders the files of existing services.
+const TemplateVersion = 1
+
+// templateVersionPrefix starts the first line of generated files, followed
+// by the TemplateVersion they were rendered with.
+const templateVersionPrefix = "# yeet-template-version: "
+
+func templateHeader() string {
+	return templateVersionPrefix + strconv.Itoa(TemplateVersion) + "\n"
+}
+
+// ArtifactTemplateVersion returns the template version of the generated file
+// at p, or 0 if it was generated before templates were versioned.
+func ArtifactTemplateVersion(p string) (int, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	v, ok := strings.CutPrefix(strings.TrimSpace(line), strings.TrimSpace(templateVersionPrefix))
+	if err != nil || !ok {
+		return 0, nil
+	}
+	return strconv.Atoi(strings.TrimSpace(v))
+}
+
+// derivedDirectives are the directives of the service template that follow
+// from other fields, and are ignored when parsing a unit back.
+var derivedDirectives = []string{
+	"ConditionFileIsExecutable", "After", "Type", "NotifyAccess", "Restart",
+	"RestartSec", "RestartSteps", "RestartMaxDelaySec", "PrivateMounts",
+	"MountAPIVFS", "BindReadOnlyPaths", "PrivateTmp", "PrivateDevices",
+	"ProtectKernelTunables", "ProtectKernelModules", "ProtectControlGroups",
+	"WantedBy",
+}
+
+// ParseSystemdUnit parses a service unit generated from the service template
+// back into the fields it was rendered from. It fails on directives the
+// template doesn't write, so that a re-render doesn't drop them.
+func ParseSystemdUnit(p string) (*SystemdUnit, error) {
+	u := &SystemdUnit{}
+	err := parseUnitDirectives(p, func(k, v string) error {
+		switch k {
+		case "ExecStart":
+			f, err := systemdUnquote(v)
+			if err != nil {
+				return err
+			}
+			if len(f) == 0 {
+				return fmt.Errorf("empty ExecStart")
+			}
+			u.Executable = f[0]
+			if len(f) > 1 {
+				u.Arguments = f[1:]
+			}
+		case "WatchdogSec":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid WatchdogSec %q", v)
+			}
+			u.WatchdogSec = n
+		case "Requires":
+			u.Requires = v
+		case "WorkingDirectory":
+			u.WorkingDirectory = v
+		case "User":
+			u.User = v
+		case "EnvironmentFile":
+			u.EnvFile = v
+		case "NetworkNamespacePath":
+			u.NetNS = strings.TrimPrefix(v, "/var/run/netns/")
+		case "RemainAfterExit":
+			u.OneShot = v == "yes"
+		case "ExecStop":
+			u.StopCmd = v
+		case "BindPaths":
+			if rc, ok := strings.CutSuffix(v, ":/etc/resolv.conf"); ok {
+				u.ResolvConf = rc
+			} else {
+				u.BindPaths = append(u.BindPaths, v)
+			}
+		case "RootDirectory":
+			u.RootDirectory = v
+		case "Environment":
+			f, err := systemdUnquote(v)
+			if err != nil {
+				return err
+			}
+			if len(f) != 1 {
+				return fmt.Errorf("invalid Environment %q", v)
+			}
+			u.Environment = append(u.Environment, f[0])
+		default:
+			for _, d := range derivedDirectives {
+				if k == d {
+					return nil
+				}
+			}
+			return fmt.Errorf("unknown directive %q", k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if u.Executable == "" {
+		return nil, fmt.Errorf("%s has no ExecStart", p)
+	}
+	return u, nil
+}
+
+// ParseTimerUnit parses a timer unit generated from the timer template back
+// into its config.
+func ParseTimerUnit(p string) (*TimerConfig, error) {
+	t := &TimerConfig{}
+	err := parseUnitDirectives(p, func(k, v string) error {
+		switch k {
+		case "OnCalendar":
+			t.OnCalendar = v
+		case "Persistent":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid Persistent %q", v)
+			}
+			t.Persistent = b
+		case "WantedBy":
+		default:
+			return fmt.Errorf("unknown directive %q", k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// UnitRootDirectory returns the RootDirectory= of the unit file at p, or an
+// empty string if it has none.
+func UnitRootDirectory(p string) (string, error) {
+	var dir string
+	err := parseUnitDirectives(p, func(k, v string) error {
+		if strings.TrimSpace(k) == "RootDirectory" {
+			dir = filepath.Clean(strings.TrimSpace(v))
+		}
+		return nil
+	})
+	return dir, err
+}
+
+// runDirectives are the directives of a service unit that set up the
+// environment its command runs in.
+var runDirectives = []string{
+	"User", "Group", "EnvironmentFile", "Environment", "WorkingDirectory",
+	"NetworkNamespacePath", "RootDirectory", "BindPaths", "BindReadOnlyPaths",
+	"PrivateTmp", "PrivateDevices", "PrivateMounts", "MountAPIVFS",
+	"ProtectKernelTunables", "ProtectKernelModules", "ProtectControlGroups",
+	"LoadCredential",
+}
+
+// RunProperties returns the directives of the unit files at paths that set
+// up the environment of the service, its user, env, namespaces and sandbox,
+// as systemd-run -p arguments, so that a one-off command runs like the
+// service does.
+func RunProperties(paths ...string) ([]string, error) {
+	var args []string
+	for _, p := range paths {
+		err := parseUnitDirectives(p, func(k, v string) error {
+			if slices.Contains(runDirectives, strings.TrimSpace(k)) {
+				args = append(args, "-p", strings.TrimSpace(k)+"="+strings.TrimSpace(v))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// parseUnitDirectives calls fn with the key and value of every directive of
+// the unit file at p.
+func parseUnitDirectives(p string, fn func(k, v string) error) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '[' {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s: invalid line %q", p, line)
+		}
+		if err := fn(k, v); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return sc.Err()
+}
+
+// RerenderServiceUnit renders the service unit at p, and its timer at
+// timerPath if not empty, with the current template into a new version of p
+// and returns its path.
+func RerenderServiceUnit(p, timerPath string) (string, error) {
+	u, err := ParseSystemdUnit(p)
+	if err != nil {
+		return "", err
+	}
+	if timerPath != "" {
+		if u.Timer, err = ParseTimerUnit(timerPath); err != nil {
+			return "", err
+		}
+	}
+	np := fileutil.UpdateVersion(p)
+	if err := u.writeOutService(np); err != nil {
+		return "", err
+	}
+	return np, nil
+}
+
+// RerenderTimerUnit renders the timer unit at p with the current template
+// into a new version of p and returns its path.
+func RerenderTimerUnit(p string) (string, error) {
+	t, err := ParseTimerUnit(p)
+	if err != nil {
+		return "", err
+	}
+	np := fileutil.UpdateVersion(p)
+	u := &SystemdUnit{Timer: t}
+	if err := u.writeOutTimer(np); err != nil {
+		return "", err
+	}
+	return np, nil
+}
+
+// ComposeNetworkNetNSOpt is the driver option of the yeet docker network
+// plugin naming the network namespace to join.
+const ComposeNetworkNetNSOpt = "dev.catchit.netns"
+
+// WriteComposeNetwork writes the compose file at p that puts the containers
+// of a docker compose service in the network namespace at netnsPath.
+func WriteComposeNetwork(p, netnsPath string) error {
+	b := fmt.Sprintf(`%snetworks:
+  default:
+    driver: yeet
+    driver_opts:
+      %s: %q
+`, templateHeader(), ComposeNetworkNetNSOpt, netnsPath)
+	return os.WriteFile(p, []byte(b), 0644)
+}
+
+// RerenderComposeNetwork renders the compose network file at p with the
+// current template into a new version of p and returns its path.
+func RerenderComposeNetwork(p string) (string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	var cf struct {
+		Networks struct {
+			Default struct {
+				DriverOpts map[string]string `yaml:"driver_opts"`
+			} `yaml:"default"`
+		} `yaml:"networks"`
+	}
+	if err := yaml.Unmarshal(b, &cf); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", p, err)
+	}
+	netnsPath := cf.Networks.Default.DriverOpts[ComposeNetworkNetNSOpt]
+	if netnsPath == "" {
+		return "", fmt.Errorf("%s has no %s driver option", p, ComposeNetworkNetNSOpt)
+	}
+	np := fileutil.UpdateVersion(p)
+	if err := WriteComposeNetwork(np, netnsPath); err != nil {
+		return "", err
+	}
+	return np, nil
+}
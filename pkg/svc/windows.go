@@ -0,0 +1,224 @@
+// Copyright 2025 AUTHORS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeetrun/yeet/pkg/db"
+)
+
+// windowsStopTimeout is how long Restart waits for a Windows service to
+// stop before starting it again.
+const windowsStopTimeout = 30 * time.Second
+
+// WindowsService is a service run by the Windows service control manager,
+// managed with sc.exe. The binary must implement the service control
+// protocol, e.g. with golang.org/x/sys/windows/svc. Windows services have no
+// working directory or output capture, so those of the unit are not used.
+type WindowsService struct {
+	cfg    db.ServiceView
+	runDir string
+
+	// CopyEnvFile, if set, installs the env file artifact from src to dst
+	// instead of copying it as is, e.g. to decrypt sealed values.
+	CopyEnvFile func(src, dst string) error
+	// ReadEnvFile reads the KEY=value pairs of an env file. The variables
+	// are set in the registry key of the service. If nil, the env file is
+	// ignored.
+	ReadEnvFile func(p string) ([]string, error)
+}
+
+// NewWindowsService creates a new Windows service from its config.
+func NewWindowsService(cfg db.ServiceView, runDir string) *WindowsService {
+	return &WindowsService{cfg: cfg, runDir: runDir}
+}
+
+func (s *WindowsService) Name() string {
+	return s.cfg.Name()
+}
+
+// exePath is where the binary of the service is installed. The service
+// control manager only runs files with an extension.
+func (s *WindowsService) exePath() string {
+	return filepath.Join(s.runDir, s.Name()+".exe")
+}
+
+// registryKey is the registry key of the service.
+func (s *WindowsService) registryKey() string {
+	return `HKLM\SYSTEM\CurrentControlSet\Services\` + s.Name()
+}
+
+func (s *WindowsService) run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run %s %s: %v\n%s", name, strings.Join(args, " "), err, string(out))
+	}
+	return nil
+}
+
+func (s *WindowsService) sc(args ...string) error {
+	return s.run("sc.exe", args...)
+}
+
+// state returns the state of the service reported by sc query, e.g.
+// "RUNNING" or "STOPPED", or "" if it is not installed.
+func (s *WindowsService) state() string {
+	out, err := exec.Command("sc.exe", "query", s.Name()).Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(k) != "STATE" {
+			continue
+		}
+		// e.g. "STATE : 4  RUNNING"
+		if f := strings.Fields(v); len(f) >= 2 {
+			return f[1]
+		}
+	}
+	return ""
+}
+
+func (s *WindowsService) isInstalled() bool {
+	return s.state() != ""
+}
+
+// Install installs the binary and env file of the service and creates or
+// reconfigures it.
+func (s *WindowsService) Install() error {
+	u, err := nativeUnit(s.cfg, "Windows services")
+	if err != nil {
+		return err
+	}
+	if u.User != "" {
+		return fmt.Errorf("running Windows services as another user is not supported")
+	}
+	envFile := filepath.Join(s.runDir, "env")
+	if err := installNativeArtifacts(s.cfg, map[db.ArtifactName]string{
+		db.ArtifactBinary:  s.exePath(),
+		db.ArtifactEnvFile: envFile,
+	}, s.CopyEnvFile); err != nil {
+		return err
+	}
+	env, err := nativeEnv(u, envFile, s.ReadEnvFile)
+	if err != nil {
+		return err
+	}
+
+	binPath := strconv.Quote(s.exePath())
+	for _, a := range u.Arguments {
+		binPath += " " + a
+	}
+	if s.isInstalled() {
+		err = s.sc("config", s.Name(), "binPath=", binPath)
+	} else {
+		err = s.sc("create", s.Name(), "binPath=", binPath, "start=", "auto", "DisplayName=", "yeet "+s.Name())
+	}
+	if err != nil {
+		return err
+	}
+	if !u.OneShot {
+		// Restart the service when it fails, like Restart= of the unit.
+		if err := s.sc("failure", s.Name(), "reset=", "86400", "actions=", "restart/1000/restart/10000/restart/60000"); err != nil {
+			return err
+		}
+	}
+	if len(env) > 0 {
+		return s.run("reg.exe", "add", s.registryKey(), "/v", "Environment", "/t", "REG_MULTI_SZ", "/d", strings.Join(env, `\0`), "/f")
+	}
+	// The value may not exist, which is fine.
+	s.run("reg.exe", "delete", s.registryKey(), "/v", "Environment", "/f")
+	return nil
+}
+
+// Uninstall stops and deletes the service.
+func (s *WindowsService) Uninstall() error {
+	if !s.isInstalled() {
+		return nil
+	}
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	return s.sc("delete", s.Name())
+}
+
+func (s *WindowsService) Start() error {
+	if s.state() == "RUNNING" {
+		return nil
+	}
+	return s.sc("start", s.Name())
+}
+
+func (s *WindowsService) Stop() error {
+	if st := s.state(); st == "" || st == "STOPPED" {
+		return nil
+	}
+	return s.sc("stop", s.Name())
+}
+
+// Restart stops the service, waits for it to stop and starts it again.
+func (s *WindowsService) Restart() error {
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(windowsStopTimeout)
+	for st := s.state(); st != "" && st != "STOPPED"; st = s.state() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s to stop", s.Name())
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return s.sc("start", s.Name())
+}
+
+func (s *WindowsService) Enable() error {
+	return s.sc("config", s.Name(), "start=", "auto")
+}
+
+func (s *WindowsService) Disable() error {
+	if !s.isInstalled() {
+		return nil
+	}
+	return s.sc("config", s.Name(), "start=", "demand")
+}
+
+func (s *WindowsService) Status() (Status, error) {
+	switch s.state() {
+	case "":
+		return StatusUnknown, nil
+	case "RUNNING":
+		return StatusRunning, nil
+	}
+	return StatusStopped, nil
+}
+
+// RuntimeInfo returns nothing, as the service control manager doesn't
+// report when a service started or how often it was restarted.
+func (s *WindowsService) RuntimeInfo() (RuntimeInfo, error) {
+	return RuntimeInfo{}, nil
+}
+
+// LogCommand returns an error: the output of Windows services is not
+// captured, they log to the Windows event log.
+func (s *WindowsService) LogCommand(*LogOptions) (string, []string, error) {
+	return "", nil, fmt.Errorf("the output of Windows services is not captured; see the Windows event log")
+}
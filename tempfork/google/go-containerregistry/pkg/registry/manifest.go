@@ -113,12 +113,35 @@ func (m *memManifestHandler) DeleteManifest(repo, target string) {
 type Manifest struct {
 	ContentType string
 	Blob        []byte
+	// Pusher identifies who pushed the manifest, as returned by the func
+	// set with WithPusher. It is only set on manifests passed to
+	// SetManifest.
+	Pusher string
+}
+
+// ManifestDesc describes a stored manifest.
+type ManifestDesc struct {
+	ContentType string
+	Digest      string
+	Size        int64
+}
+
+// ManifestStreamer is optionally implemented by a ManifestHandler that can
+// describe and stream manifests without holding them in memory. When
+// implemented, it is used to serve GET and HEAD requests.
+type ManifestStreamer interface {
+	// StatManifest returns the description of a manifest.
+	StatManifest(repo, target string) (ManifestDesc, bool)
+	// OpenManifest returns the description and contents of a manifest. The
+	// caller must close the returned reader.
+	OpenManifest(repo, target string) (io.ReadCloser, ManifestDesc, bool)
 }
 
 type manifests struct {
 	// maps repo -> manifest tag/digest -> manifest
 	manifestHandler ManifestHandler
 	log             *log.Logger
+	pusher          func(*http.Request) string
 }
 
 func isManifest(req *http.Request) bool {
@@ -159,6 +182,13 @@ func isReferrers(req *http.Request) bool {
 	return elems[len(elems)-2] == "referrers"
 }
 
+func writeManifestHeaders(resp http.ResponseWriter, desc ManifestDesc) {
+	resp.Header().Set("Docker-Content-Digest", desc.Digest)
+	resp.Header().Set("Content-Type", desc.ContentType)
+	resp.Header().Set("Content-Length", fmt.Sprint(desc.Size))
+	resp.WriteHeader(http.StatusOK)
+}
+
 // https://github.com/opencontainers/distribution-spec/blob/master/spec.md#pulling-an-image-manifest
 // https://github.com/opencontainers/distribution-spec/blob/master/spec.md#pushing-an-image
 func (m *manifests) handle(resp http.ResponseWriter, req *http.Request, cbh CallbackHandler) *regError {
@@ -169,6 +199,20 @@ func (m *manifests) handle(resp http.ResponseWriter, req *http.Request, cbh Call
 
 	switch req.Method {
 	case http.MethodGet:
+		if ms, ok := m.manifestHandler.(ManifestStreamer); ok {
+			rc, desc, ok := ms.OpenManifest(repo, target)
+			if !ok {
+				return &regError{
+					Status:  http.StatusNotFound,
+					Code:    "MANIFEST_UNKNOWN",
+					Message: "Unknown manifest",
+				}
+			}
+			defer rc.Close()
+			writeManifestHeaders(resp, desc)
+			io.Copy(resp, rc)
+			return nil
+		}
 
 		m, ok := m.manifestHandler.Manifest(repo, target)
 		if !ok {
@@ -196,6 +240,18 @@ func (m *manifests) handle(resp http.ResponseWriter, req *http.Request, cbh Call
 				Message: "Unknown name",
 			}
 		}
+		if ms, ok := m.manifestHandler.(ManifestStreamer); ok {
+			desc, ok := ms.StatManifest(repo, target)
+			if !ok {
+				return &regError{
+					Status:  http.StatusNotFound,
+					Code:    "MANIFEST_UNKNOWN",
+					Message: "Unknown manifest",
+				}
+			}
+			writeManifestHeaders(resp, desc)
+			return nil
+		}
 		m, ok := m.manifestHandler.Manifest(repo, target)
 		if !ok {
 			return &regError{
@@ -221,6 +277,9 @@ func (m *manifests) handle(resp http.ResponseWriter, req *http.Request, cbh Call
 			Blob:        b.Bytes(),
 			ContentType: req.Header.Get("Content-Type"),
 		}
+		if m.pusher != nil {
+			mf.Pusher = m.pusher(req)
+		}
 
 		// If the manifest is a manifest list, check that the manifest
 		// list's constituent manifests are already uploaded.
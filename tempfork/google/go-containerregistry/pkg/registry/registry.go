@@ -154,6 +154,14 @@ func WithManifestHandler(h ManifestHandler) Option {
 	}
 }
 
+// WithPusher sets the func identifying who pushed a manifest, recorded as
+// Manifest.Pusher.
+func WithPusher(f func(*http.Request) string) Option {
+	return func(r *registry) {
+		r.manifests.pusher = f
+	}
+}
+
 type CallbackHandler interface {
 	OnImageReceived(repo, tag, manifest string) error
 }
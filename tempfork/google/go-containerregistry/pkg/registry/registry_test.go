@@ -652,3 +652,50 @@ func TestCalls(t *testing.T) {
 		t.Run(tc.Description+" - custom log", testf)
 	}
 }
+
+// pushRecorder is a registry.ManifestHandler that records who pushed each
+// manifest.
+type pushRecorder struct {
+	pushers map[string]string
+}
+
+func (p *pushRecorder) AllRepos() []string          { return nil }
+func (p *pushRecorder) RepoExists(repo string) bool { return false }
+func (p *pushRecorder) Manifests(repo string) (map[string]registry.Manifest, bool) {
+	return nil, false
+}
+func (p *pushRecorder) Manifest(repo, target string) (registry.Manifest, bool) {
+	return registry.Manifest{}, false
+}
+func (p *pushRecorder) SetManifests(repo string, manifests map[string]registry.Manifest) {}
+func (p *pushRecorder) SetManifest(repo, target string, manifest registry.Manifest) {
+	p.pushers[repo+":"+target] = manifest.Pusher
+}
+func (p *pushRecorder) DeleteManifest(repo, target string) {}
+
+func TestPusher(t *testing.T) {
+	rec := &pushRecorder{pushers: map[string]string{}}
+	s := httptest.NewServer(registry.New(
+		registry.WithManifestHandler(rec),
+		registry.WithPusher(func(r *http.Request) string { return r.Header.Get("X-Pusher") }),
+	))
+	defer s.Close()
+
+	req, err := http.NewRequest("PUT", s.URL+"/v2/web/app/manifests/run", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+	req.Header.Set("X-Pusher", "alice@example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT manifest = %s, want %d", resp.Status, http.StatusCreated)
+	}
+	if got := rec.pushers["web/app:run"]; got != "alice@example.com" {
+		t.Errorf("Pusher = %q, want %q", got, "alice@example.com")
+	}
+}